@@ -8,14 +8,18 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	// the zone database is embedded , the production image doesn't ship one and doctors' timezones are loaded by name
+	_ "time/tzdata"
 
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/mbeka02/lyra_backend/config"
 	"github.com/mbeka02/lyra_backend/internal/auth"
 	"github.com/mbeka02/lyra_backend/internal/fhir"
+	"github.com/mbeka02/lyra_backend/internal/mailer"
 	"github.com/mbeka02/lyra_backend/internal/objstore"
 	"github.com/mbeka02/lyra_backend/internal/payment"
 	"github.com/mbeka02/lyra_backend/internal/server"
+	"github.com/mbeka02/lyra_backend/internal/server/service"
 	"github.com/mbeka02/lyra_backend/internal/streamsdk"
 )
 
@@ -53,6 +57,11 @@ func setupServer() (*http.Server, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to setup the auth token maker:%v", err)
 	}
+	// encrypts secrets like TOTP seeds before they are stored
+	secretCipher, err := auth.NewSecretCipher(conf.SYMMETRIC_KEY)
+	if err != nil {
+		return nil, fmt.Errorf("unable to setup the secret cipher:%v", err)
+	}
 	// cloud storage setup for images
 	imgStorage, err := objstore.NewGCStorage(conf.GCLOUD_PROJECT_ID, conf.GCLOUD_IMAGE_BUCKET)
 	if err != nil {
@@ -73,22 +82,101 @@ func setupServer() (*http.Server, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to setup fhir client:%v", err)
 	}
+	// transactional emails
+	emailSender, err := mailer.NewSendGridMailer(conf.SENDGRID_API_KEY, conf.MAIL_FROM_NAME, conf.MAIL_FROM_ADDRESS)
+	if err != nil {
+		return nil, fmt.Errorf("unable to setup the mailer:%v", err)
+	}
 	// external payment service setup
-	processor := payment.NewPaymentProcessor(conf.PAYSTACK_API_KEY)
+	// doctors are paid out through paystack subaccounts
+	paystack := payment.NewPaystack(conf.PAYSTACK_API_KEY)
+	providers := []payment.Provider{paystack}
+	if conf.MPESA_CONSUMER_KEY != "" {
+		providers = append(providers, payment.NewMpesa(payment.MpesaConfig{
+			BaseURL:            conf.MPESA_BASE_URL,
+			ConsumerKey:        conf.MPESA_CONSUMER_KEY,
+			ConsumerSecret:     conf.MPESA_CONSUMER_SECRET,
+			ShortCode:          conf.MPESA_SHORTCODE,
+			PassKey:            conf.MPESA_PASSKEY,
+			CallbackURL:        conf.MPESA_CALLBACK_URL,
+			CallbackToken:      conf.MPESA_CALLBACK_TOKEN,
+			InitiatorName:      conf.MPESA_INITIATOR_NAME,
+			SecurityCredential: conf.MPESA_SECURITY_CREDENTIAL,
+			B2CShortCode:       conf.MPESA_B2C_SHORTCODE,
+		}))
+	}
+	paymentProviders := payment.NewProviders(providers...)
 	streamClient, err := streamsdk.NewStreamClient(conf.GETSTREAM_API_KEY, conf.GETSTREAM_API_SECRET)
 	if err != nil {
 		return nil, fmt.Errorf("unable to initialize the getstream client:%v", err)
 	}
 	// Configutation Options
 	opts := server.ConfigOptions{
-		Port:                conf.PORT,
-		AccessTokenDuration: conf.ACCESS_TOKEN_DURATION,
-		AuthMaker:           maker,
-		ImageStorage:        imgStorage,
-		PaymentProcessor:    processor,
-		StreamClient:        streamClient,
-		FileStorage:         fileStorage,
-		FHIRClient:          fhirClient,
+		Port:                 conf.PORT,
+		AccessTokenDuration:  conf.ACCESS_TOKEN_DURATION,
+		RefreshTokenDuration: conf.REFRESH_TOKEN_DURATION,
+		AuthMaker:            maker,
+		ImageStorage:         imgStorage,
+		PaymentProviders:     paymentProviders,
+		Subaccounts:          paystack,
+		StreamClient:         streamClient,
+		FileStorage:          fileStorage,
+		FHIRClient:           fhirClient,
+		Mailer:               emailSender,
+		Verification: service.VerificationConfig{
+			BaseURL:        conf.APP_BASE_URL,
+			TokenDuration:  conf.EMAIL_VERIFICATION_TOKEN_DURATION,
+			ResendInterval: conf.VERIFICATION_RESEND_INTERVAL,
+		},
+		PasswordReset: service.PasswordResetConfig{
+			ResetURL:      conf.PASSWORD_RESET_URL,
+			TokenDuration: conf.PASSWORD_RESET_TOKEN_DURATION,
+		},
+		SecretCipher: secretCipher,
+		TwoFactor: service.TwoFactorConfig{
+			Issuer:            conf.MFA_ISSUER,
+			EnforcedRoles:     conf.MFA_ENFORCED_ROLES,
+			ChallengeDuration: conf.MFA_CHALLENGE_DURATION,
+		},
+		BookingPolicy: service.BookingPolicy{
+			RequireVerifiedEmail: conf.REQUIRE_VERIFIED_EMAIL_FOR_BOOKING,
+			RescheduleLimit:      conf.RESCHEDULE_LIMIT,
+			RescheduleCutoff:     conf.RESCHEDULE_CUTOFF,
+		},
+		PaymentHold: service.PaymentHoldConfig{
+			Duration:      conf.PAYMENT_HOLD_DURATION,
+			SweepInterval: conf.PAYMENT_HOLD_SWEEP_INTERVAL,
+		},
+		Reconciliation: service.PaymentReconciliationConfig{
+			StaleAfter: conf.RECONCILIATION_STALE_AFTER,
+			Interval:   conf.RECONCILIATION_INTERVAL,
+			BatchSize:  conf.RECONCILIATION_BATCH_SIZE,
+		},
+		RefundPolicy: service.RefundPolicy{
+			FullRefundWindow:     conf.REFUND_FULL_WINDOW,
+			PartialRefundPercent: conf.REFUND_PARTIAL_PERCENT,
+		},
+		PricingPolicy: service.PricingPolicy{
+			PlatformFeePercent: conf.PLATFORM_FEE_PERCENT,
+			TaxPercent:         conf.TAX_PERCENT,
+		},
+		BreakGlass: service.BreakGlassConfig{
+			Duration: conf.BREAK_GLASS_DURATION,
+		},
+		Lockout: service.LockoutConfig{
+			FreeAttempts:         conf.LOGIN_FREE_ATTEMPTS,
+			BaseDelay:            conf.LOGIN_BACKOFF_BASE_DELAY,
+			MaxDelay:             conf.LOGIN_BACKOFF_MAX_DELAY,
+			MaxAttempts:          conf.LOGIN_MAX_ATTEMPTS,
+			LockoutDuration:      conf.LOGIN_LOCKOUT_DURATION,
+			MaxChallengeAttempts: conf.MFA_MAX_CHALLENGE_ATTEMPTS,
+			UnlockURL:            conf.ACCOUNT_UNLOCK_URL,
+		},
+		Calendar: service.CalendarConfig{
+			BaseURL:        conf.APP_BASE_URL,
+			OrganizerName:  conf.MAIL_FROM_NAME,
+			OrganizerEmail: conf.MAIL_FROM_ADDRESS,
+		},
 	}
 	server := server.NewServer(opts)
 	return server, nil
@@ -7,18 +7,59 @@ import (
 )
 
 type Config struct {
-	SYMMETRIC_KEY                string        `mapstructure:"SYMMETRIC_KEY"`
-	ACCESS_TOKEN_DURATION        time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
-	SENDGRID_API_KEY             string        `mapstructure:"SENDGRID_API_KEY"`
-	GCLOUD_PROJECT_ID            string        `mapstructure:"GCLOUD_PROJECT_ID"`
-	GCLOUD_IMAGE_BUCKET          string        `mapstructure:"GCLOUD_IMAGE_BUCKET"`
-	GCLOUD_PATIENT_RECORD_BUCKET string        `mapstructure:"GCLOUD_PATIENT_RECORD_BUCKET"`
-	GCLOUD_DATASET_LOCATION      string        `mapstructure:"GCLOUD_DATASET_LOCATION"`
-	GCLOUD_DATASET_ID            string        `mapstructure:"GCLOUD_DATASET_ID"`
-	GCLOUD_FHIR_STORE_ID         string        `mapstructure:"GCLOUD_FHIR_STORE_ID"`
-	PAYSTACK_API_KEY             string        `mapstructure:"PAYSTACK_API_KEY"`
-	GETSTREAM_API_KEY            string        `mapstructure:"GETSTREAM_API_KEY"`
-	GETSTREAM_API_SECRET         string        `mapstructure:"GETSTREAM_API_SECRET"`
+	SYMMETRIC_KEY                      string        `mapstructure:"SYMMETRIC_KEY"`
+	ACCESS_TOKEN_DURATION              time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
+	REFRESH_TOKEN_DURATION             time.Duration `mapstructure:"REFRESH_TOKEN_DURATION"`
+	SENDGRID_API_KEY                   string        `mapstructure:"SENDGRID_API_KEY"`
+	MAIL_FROM_NAME                     string        `mapstructure:"MAIL_FROM_NAME"`
+	MAIL_FROM_ADDRESS                  string        `mapstructure:"MAIL_FROM_ADDRESS"`
+	APP_BASE_URL                       string        `mapstructure:"APP_BASE_URL"`
+	EMAIL_VERIFICATION_TOKEN_DURATION  time.Duration `mapstructure:"EMAIL_VERIFICATION_TOKEN_DURATION"`
+	VERIFICATION_RESEND_INTERVAL       time.Duration `mapstructure:"VERIFICATION_RESEND_INTERVAL"`
+	REQUIRE_VERIFIED_EMAIL_FOR_BOOKING bool          `mapstructure:"REQUIRE_VERIFIED_EMAIL_FOR_BOOKING"`
+	PAYMENT_HOLD_DURATION              time.Duration `mapstructure:"PAYMENT_HOLD_DURATION"`
+	PAYMENT_HOLD_SWEEP_INTERVAL        time.Duration `mapstructure:"PAYMENT_HOLD_SWEEP_INTERVAL"`
+	RECONCILIATION_STALE_AFTER         time.Duration `mapstructure:"RECONCILIATION_STALE_AFTER"`
+	RECONCILIATION_INTERVAL            time.Duration `mapstructure:"RECONCILIATION_INTERVAL"`
+	RECONCILIATION_BATCH_SIZE          int32         `mapstructure:"RECONCILIATION_BATCH_SIZE"`
+	RESCHEDULE_LIMIT                   int64         `mapstructure:"RESCHEDULE_LIMIT"`
+	RESCHEDULE_CUTOFF                  time.Duration `mapstructure:"RESCHEDULE_CUTOFF"`
+	REFUND_FULL_WINDOW                 time.Duration `mapstructure:"REFUND_FULL_WINDOW"`
+	REFUND_PARTIAL_PERCENT             int64         `mapstructure:"REFUND_PARTIAL_PERCENT"`
+	PLATFORM_FEE_PERCENT               int64         `mapstructure:"PLATFORM_FEE_PERCENT"`
+	TAX_PERCENT                        int64         `mapstructure:"TAX_PERCENT"`
+	PASSWORD_RESET_URL                 string        `mapstructure:"PASSWORD_RESET_URL"`
+	PASSWORD_RESET_TOKEN_DURATION      time.Duration `mapstructure:"PASSWORD_RESET_TOKEN_DURATION"`
+	MFA_ISSUER                         string        `mapstructure:"MFA_ISSUER"`
+	MFA_ENFORCED_ROLES                 []string      `mapstructure:"MFA_ENFORCED_ROLES"`
+	MFA_CHALLENGE_DURATION             time.Duration `mapstructure:"MFA_CHALLENGE_DURATION"`
+	BREAK_GLASS_DURATION               time.Duration `mapstructure:"BREAK_GLASS_DURATION"`
+	LOGIN_FREE_ATTEMPTS                int           `mapstructure:"LOGIN_FREE_ATTEMPTS"`
+	LOGIN_BACKOFF_BASE_DELAY           time.Duration `mapstructure:"LOGIN_BACKOFF_BASE_DELAY"`
+	LOGIN_BACKOFF_MAX_DELAY            time.Duration `mapstructure:"LOGIN_BACKOFF_MAX_DELAY"`
+	LOGIN_MAX_ATTEMPTS                 int           `mapstructure:"LOGIN_MAX_ATTEMPTS"`
+	LOGIN_LOCKOUT_DURATION             time.Duration `mapstructure:"LOGIN_LOCKOUT_DURATION"`
+	MFA_MAX_CHALLENGE_ATTEMPTS         int           `mapstructure:"MFA_MAX_CHALLENGE_ATTEMPTS"`
+	ACCOUNT_UNLOCK_URL                 string        `mapstructure:"ACCOUNT_UNLOCK_URL"`
+	GCLOUD_PROJECT_ID                  string        `mapstructure:"GCLOUD_PROJECT_ID"`
+	GCLOUD_IMAGE_BUCKET                string        `mapstructure:"GCLOUD_IMAGE_BUCKET"`
+	GCLOUD_PATIENT_RECORD_BUCKET       string        `mapstructure:"GCLOUD_PATIENT_RECORD_BUCKET"`
+	GCLOUD_DATASET_LOCATION            string        `mapstructure:"GCLOUD_DATASET_LOCATION"`
+	GCLOUD_DATASET_ID                  string        `mapstructure:"GCLOUD_DATASET_ID"`
+	GCLOUD_FHIR_STORE_ID               string        `mapstructure:"GCLOUD_FHIR_STORE_ID"`
+	PAYSTACK_API_KEY                   string        `mapstructure:"PAYSTACK_API_KEY"`
+	MPESA_BASE_URL                     string        `mapstructure:"MPESA_BASE_URL"`
+	MPESA_CONSUMER_KEY                 string        `mapstructure:"MPESA_CONSUMER_KEY"`
+	MPESA_CONSUMER_SECRET              string        `mapstructure:"MPESA_CONSUMER_SECRET"`
+	MPESA_SHORTCODE                    string        `mapstructure:"MPESA_SHORTCODE"`
+	MPESA_PASSKEY                      string        `mapstructure:"MPESA_PASSKEY"`
+	MPESA_CALLBACK_URL                 string        `mapstructure:"MPESA_CALLBACK_URL"`
+	MPESA_CALLBACK_TOKEN               string        `mapstructure:"MPESA_CALLBACK_TOKEN"`
+	MPESA_INITIATOR_NAME               string        `mapstructure:"MPESA_INITIATOR_NAME"`
+	MPESA_SECURITY_CREDENTIAL          string        `mapstructure:"MPESA_SECURITY_CREDENTIAL"`
+	MPESA_B2C_SHORTCODE                string        `mapstructure:"MPESA_B2C_SHORTCODE"`
+	GETSTREAM_API_KEY                  string        `mapstructure:"GETSTREAM_API_KEY"`
+	GETSTREAM_API_SECRET               string        `mapstructure:"GETSTREAM_API_SECRET"`
 	// DB_CONNECTION_STRING  string        `mapstructure:"DB_CONNECTION_STRING"`
 	PORT string `mapstructure:"PORT"`
 }
@@ -28,6 +69,7 @@ func LoadConfig(path string) (*Config, error) {
 	// tell Viper the location of the config file
 	viper.AddConfigPath(path)
 	viper.SetConfigFile(".env")
+	setDefaults()
 	// read values
 	err := viper.ReadInConfig()
 	if err != nil {
@@ -39,3 +81,43 @@ func LoadConfig(path string) (*Config, error) {
 	}
 	return config, nil
 }
+
+func setDefaults() {
+	viper.SetDefault("REFRESH_TOKEN_DURATION", 30*24*time.Hour)
+	viper.SetDefault("MAIL_FROM_NAME", "Lyra")
+	viper.SetDefault("MAIL_FROM_ADDRESS", "lyra.telemedicine@gmail.com")
+	viper.SetDefault("EMAIL_VERIFICATION_TOKEN_DURATION", 24*time.Hour)
+	viper.SetDefault("VERIFICATION_RESEND_INTERVAL", 2*time.Minute)
+	viper.SetDefault("REQUIRE_VERIFIED_EMAIL_FOR_BOOKING", true)
+	// unpaid appointments hold their slot for this long before they are cancelled
+	viper.SetDefault("PAYMENT_HOLD_DURATION", 15*time.Minute)
+	viper.SetDefault("PAYMENT_HOLD_SWEEP_INTERVAL", time.Minute)
+	// payments still pending this long after checkout are checked with paystack in case their webhook was lost ,
+	// this is shorter than the hold so that paid appointments are confirmed before the hold runs out
+	viper.SetDefault("RECONCILIATION_STALE_AFTER", 10*time.Minute)
+	viper.SetDefault("RECONCILIATION_INTERVAL", 5*time.Minute)
+	viper.SetDefault("RECONCILIATION_BATCH_SIZE", 100)
+	viper.SetDefault("RESCHEDULE_LIMIT", 2)
+	viper.SetDefault("RESCHEDULE_CUTOFF", 12*time.Hour)
+	// patients that cancel inside the window (but before the appointment starts) get the partial percentage back
+	viper.SetDefault("REFUND_FULL_WINDOW", 24*time.Hour)
+	viper.SetDefault("REFUND_PARTIAL_PERCENT", 50)
+	// added on top of the doctor's prorated price , no fees or taxes are charged unless they are configured
+	viper.SetDefault("PLATFORM_FEE_PERCENT", 0)
+	viper.SetDefault("TAX_PERCENT", 0)
+	// M-Pesa payments are only offered when the daraja consumer key is set
+	viper.SetDefault("MPESA_BASE_URL", "https://sandbox.safaricom.co.ke")
+	viper.SetDefault("PASSWORD_RESET_TOKEN_DURATION", 30*time.Minute)
+	viper.SetDefault("MFA_ISSUER", "Lyra")
+	// comma separated list of roles that must use two factor authentication
+	viper.SetDefault("MFA_ENFORCED_ROLES", []string{"specialist"})
+	viper.SetDefault("MFA_CHALLENGE_DURATION", 5*time.Minute)
+	viper.SetDefault("BREAK_GLASS_DURATION", time.Hour)
+	viper.SetDefault("LOGIN_FREE_ATTEMPTS", 3)
+	viper.SetDefault("LOGIN_BACKOFF_BASE_DELAY", time.Second)
+	viper.SetDefault("LOGIN_BACKOFF_MAX_DELAY", 5*time.Minute)
+	viper.SetDefault("LOGIN_MAX_ATTEMPTS", 10)
+	viper.SetDefault("LOGIN_LOCKOUT_DURATION", 30*time.Minute)
+	// wrong codes allowed before the user has to log in again
+	viper.SetDefault("MFA_MAX_CHALLENGE_ATTEMPTS", 5)
+}
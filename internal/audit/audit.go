@@ -0,0 +1,116 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+type Action string
+
+const (
+	ActionRead   Action = "read"
+	ActionList   Action = "list"
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+	// a specialist was given emergency access to a patient
+	ActionBreakGlass Action = "break_glass"
+)
+
+type ResourceType string
+
+const (
+	ResourcePatient     ResourceType = "patient"
+	ResourceAllergy     ResourceType = "allergy_intolerance"
+	ResourceMedication  ResourceType = "medication_statement"
+	ResourceObservation ResourceType = "observation"
+	ResourceDocument    ResourceType = "document_reference"
+	ResourceBreakGlass  ResourceType = "break_glass_grant"
+)
+
+// GenesisHash is the previous hash of the first event in the chain
+const GenesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// Event is a single entry in the audit log
+type Event struct {
+	ActorUserID  int64
+	ActorRole    string
+	PatientID    int64
+	ResourceType ResourceType
+	ResourceID   string
+	Action       Action
+	RequestID    string
+	ClientIP     string
+	OccurredAt   time.Time
+}
+
+// Hash chains the event to the one before it , changing any field of an event (or removing one) changes every hash after it
+func Hash(prevHash string, e Event) string {
+	// the fields are encoded in a fixed order so the same event always produces the same hash
+	canonical, _ := json.Marshal(struct {
+		ActorUserID  int64  `json:"actor_user_id"`
+		ActorRole    string `json:"actor_role"`
+		PatientID    int64  `json:"patient_id"`
+		ResourceType string `json:"resource_type"`
+		ResourceID   string `json:"resource_id"`
+		Action       string `json:"action"`
+		RequestID    string `json:"request_id"`
+		ClientIP     string `json:"client_ip"`
+		OccurredAt   string `json:"occurred_at"`
+	}{
+		ActorUserID:  e.ActorUserID,
+		ActorRole:    e.ActorRole,
+		PatientID:    e.PatientID,
+		ResourceType: string(e.ResourceType),
+		ResourceID:   e.ResourceID,
+		Action:       string(e.Action),
+		RequestID:    e.RequestID,
+		ClientIP:     e.ClientIP,
+		// postgres stores microseconds so anything finer would not survive a round trip
+		OccurredAt: e.OccurredAt.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano),
+	})
+	sum := sha256.Sum256(append([]byte(prevHash+"\n"), canonical...))
+	return hex.EncodeToString(sum[:])
+}
+
+// ChainedEvent is an event as it was stored along with its place in the chain
+type ChainedEvent struct {
+	EventID  int64
+	PrevHash string
+	Hash     string
+	Event
+}
+
+// VerifyChain checks a run of events ordered by id , prevHash is the hash of the event before the first one.
+// It returns the id of the first event that doesn't match the chain and false , or 0 and true if they all do
+func VerifyChain(prevHash string, events []ChainedEvent) (int64, bool) {
+	for _, e := range events {
+		if e.PrevHash != prevHash || Hash(prevHash, e.Event) != e.Hash {
+			return e.EventID, false
+		}
+		prevHash = e.Hash
+	}
+	return 0, true
+}
+
+// RequestInfo identifies who made the request an event is recorded for
+type RequestInfo struct {
+	ActorUserID int64
+	ActorRole   string
+	RequestID   string
+	ClientIP    string
+}
+
+type contextKey struct{}
+
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, contextKey{}, info)
+}
+
+func RequestInfoFromContext(ctx context.Context) (RequestInfo, bool) {
+	info, ok := ctx.Value(contextKey{}).(RequestInfo)
+	return info, ok
+}
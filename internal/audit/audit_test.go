@@ -0,0 +1,82 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newChain(t *testing.T, n int) []ChainedEvent {
+	prevHash := GenesisHash
+	events := make([]ChainedEvent, n)
+	for i := range events {
+		e := Event{
+			ActorUserID:  int64(i + 1),
+			ActorRole:    "specialist",
+			PatientID:    42,
+			ResourceType: ResourceAllergy,
+			ResourceID:   "b5a2c1f0",
+			Action:       ActionRead,
+			RequestID:    "host/abc-000001",
+			ClientIP:     "10.0.0.1",
+			OccurredAt:   time.Date(2025, 3, 1, 10, 0, i, 123456789, time.UTC),
+		}
+		hash := Hash(prevHash, e)
+		events[i] = ChainedEvent{EventID: int64(i + 1), PrevHash: prevHash, Hash: hash, Event: e}
+		prevHash = hash
+	}
+	return events
+}
+
+func TestHashIsDeterministic(t *testing.T) {
+	e := newChain(t, 1)[0].Event
+	require.Equal(t, Hash(GenesisHash, e), Hash(GenesisHash, e))
+	require.Len(t, Hash(GenesisHash, e), 64)
+
+	// the same instant read back from the database in another zone with microsecond precision
+	roundTripped := e
+	roundTripped.OccurredAt = e.OccurredAt.Truncate(time.Microsecond).In(time.FixedZone("EAT", 3*60*60))
+	require.Equal(t, Hash(GenesisHash, e), Hash(GenesisHash, roundTripped))
+
+	// every field is covered
+	changed := e
+	changed.Action = ActionDelete
+	require.NotEqual(t, Hash(GenesisHash, e), Hash(GenesisHash, changed))
+	require.NotEqual(t, Hash(GenesisHash, e), Hash("other", e))
+}
+
+func TestVerifyChain(t *testing.T) {
+	events := newChain(t, 5)
+	id, ok := VerifyChain(GenesisHash, events)
+	require.True(t, ok)
+	require.Zero(t, id)
+
+	// verifying can start part way through the chain
+	_, ok = VerifyChain(events[1].Hash, events[2:])
+	require.True(t, ok)
+
+	// an edited event
+	tampered := append([]ChainedEvent(nil), events...)
+	tampered[2].PatientID = 7
+	id, ok = VerifyChain(GenesisHash, tampered)
+	require.False(t, ok)
+	require.Equal(t, int64(3), id)
+
+	// a deleted event
+	deleted := append(append([]ChainedEvent(nil), events[:1]...), events[2:]...)
+	id, ok = VerifyChain(GenesisHash, deleted)
+	require.False(t, ok)
+	require.Equal(t, int64(3), id)
+}
+
+func TestRequestInfoContext(t *testing.T) {
+	_, ok := RequestInfoFromContext(context.Background())
+	require.False(t, ok)
+
+	info := RequestInfo{ActorUserID: 1, ActorRole: "patient", RequestID: "abc", ClientIP: "127.0.0.1"}
+	got, ok := RequestInfoFromContext(WithRequestInfo(context.Background(), info))
+	require.True(t, ok)
+	require.Equal(t, info, got)
+}
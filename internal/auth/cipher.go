@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+var ErrInvalidCiphertext = errors.New("the ciphertext is invalid")
+
+// SecretCipher encrypts small secrets (e.g TOTP seeds) before they are stored in the database
+type SecretCipher struct {
+	key []byte
+}
+
+func NewSecretCipher(symmetricKey string) (*SecretCipher, error) {
+	if len(symmetricKey) < minimumSecretLength {
+		return nil, fmt.Errorf("invalid key length , it must be atleast %d characters", minimumSecretLength)
+	}
+	// derive a fixed size key so any sufficiently long secret can be used
+	key := sha256.Sum256([]byte(symmetricKey))
+	return &SecretCipher{key: key[:]}, nil
+}
+
+// Encrypt returns base64(nonce || ciphertext)
+func (c *SecretCipher) Encrypt(plaintext string) (string, error) {
+	aead, err := chacha20poly1305.NewX(c.key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (c *SecretCipher) Decrypt(ciphertext string) (string, error) {
+	aead, err := chacha20poly1305.NewX(c.key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrInvalidCiphertext
+	}
+	nonce, data := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, data, nil)
+	if err != nil {
+		return "", ErrInvalidCiphertext
+	}
+	return string(plaintext), nil
+}
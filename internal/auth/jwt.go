@@ -30,11 +30,18 @@ func NewJWTMaker(secret string) (Maker, error) {
 }
 
 // This method is used to create a new JWT token , it implements the Maker interface
-func (maker *JWTMaker) Create(userId int64, email, role string, duration time.Duration) (string, error) {
-	payload := NewPayload(userId, email, role, duration)
+func (maker *JWTMaker) Create(params PayloadParams, duration time.Duration) (string, *Payload, error) {
+	payload, err := NewPayload(params, duration)
+	if err != nil {
+		return "", nil, err
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
-	return token.SignedString([]byte(maker.secret))
+	tokenString, err := token.SignedString([]byte(maker.secret))
+	if err != nil {
+		return "", nil, err
+	}
+	return tokenString, payload, nil
 }
 
 // This method is used to verify a new JWT token , it implements the Maker interface
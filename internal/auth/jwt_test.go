@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/mbeka02/lyra_backend/internal/util"
 	"github.com/stretchr/testify/require"
 )
@@ -14,17 +15,28 @@ func TestJWTMaker(t *testing.T) {
 	email := util.RandEmail()
 	userId := util.RandInt(1, 100)
 	role := util.RandRole()
+	sessionId := uuid.New()
 	duration := time.Minute
 	issuedAt := time.Now()
 	expiresAt := time.Now().Add(duration)
 
-	token, err := maker.Create(userId, email, role, duration)
+	token, payload, err := maker.Create(PayloadParams{
+		UserID:    userId,
+		Email:     email,
+		Role:      role,
+		SessionID: sessionId,
+		TokenType: TokenTypeRefresh,
+	}, duration)
 	require.NoError(t, err)
 	require.NotEmpty(t, token)
+	require.NotEmpty(t, payload)
 
 	claims, err := maker.Verify(token)
 	require.NoError(t, err)
 	require.NotEmpty(t, claims)
+	require.Equal(t, payload.TokenID, claims.TokenID)
+	require.Equal(t, sessionId, claims.SessionID)
+	require.Equal(t, TokenTypeRefresh, claims.TokenType)
 	require.Equal(t, email, claims.Email)
 	require.Equal(t, userId, claims.UserID)
 	require.Equal(t, role, claims.Role)
@@ -32,6 +44,22 @@ func TestJWTMaker(t *testing.T) {
 	require.WithinDuration(t, expiresAt, claims.ExpiresAt, time.Second)
 }
 
+func TestJWTMakerDefaultsToAccessToken(t *testing.T) {
+	maker, err := NewJWTMaker(util.RandString(32))
+	require.NoError(t, err)
+
+	token, _, err := maker.Create(PayloadParams{
+		UserID: util.RandInt(1, 100),
+		Email:  util.RandEmail(),
+		Role:   util.RandRole(),
+	}, time.Minute)
+	require.NoError(t, err)
+
+	claims, err := maker.Verify(token)
+	require.NoError(t, err)
+	require.Equal(t, TokenTypeAccess, claims.TokenType)
+}
+
 func TestExpiredJWTToken(t *testing.T) {
 	maker, err := NewJWTMaker(util.RandString(32))
 	require.NoError(t, err)
@@ -39,7 +67,7 @@ func TestExpiredJWTToken(t *testing.T) {
 	userId := util.RandInt(1, 100)
 	duration := -time.Minute
 	role := util.RandRole()
-	token, err := maker.Create(userId, email, role, duration)
+	token, _, err := maker.Create(PayloadParams{UserID: userId, Email: email, Role: role}, duration)
 
 	require.NoError(t, err)
 	require.NotEmpty(t, token)
@@ -3,6 +3,6 @@ package auth
 import "time"
 
 type Maker interface {
-	Create(userId int64, email, role string, duration time.Duration) (string, error)
+	Create(params PayloadParams, duration time.Duration) (string, *Payload, error)
 	Verify(tokenString string) (*Payload, error)
 }
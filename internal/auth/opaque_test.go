@@ -0,0 +1,22 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpaqueToken(t *testing.T) {
+	token, err := NewOpaqueToken()
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+
+	other, err := NewOpaqueToken()
+	require.NoError(t, err)
+	require.NotEqual(t, token, other)
+
+	hash := HashOpaqueToken(token)
+	require.Len(t, hash, 64)
+	require.Equal(t, hash, HashOpaqueToken(token))
+	require.NotEqual(t, hash, HashOpaqueToken(other))
+}
@@ -23,10 +23,17 @@ func NewPasetoMaker(symmetricKey string) (Maker, error) {
 	}, nil
 }
 
-func (maker *PasetoMaker) Create(userId int64, email, role string, duration time.Duration) (string, error) {
-	payload := NewPayload(userId, email, role, duration)
+func (maker *PasetoMaker) Create(params PayloadParams, duration time.Duration) (string, *Payload, error) {
+	payload, err := NewPayload(params, duration)
+	if err != nil {
+		return "", nil, err
+	}
 	// key has to be 32 bytes
-	return maker.paseto.Encrypt(maker.symmetricKey, payload, nil)
+	token, err := maker.paseto.Encrypt(maker.symmetricKey, payload, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, payload, nil
 }
 
 func (maker *PasetoMaker) Verify(tokenString string) (*Payload, error) {
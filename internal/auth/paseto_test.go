@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/mbeka02/lyra_backend/internal/util"
 	"github.com/stretchr/testify/require"
 )
@@ -14,17 +15,28 @@ func TestPasetoMaker(t *testing.T) {
 	email := util.RandEmail()
 	role := util.RandRole()
 	userId := util.RandInt(1, 100)
+	sessionId := uuid.New()
 	duration := time.Minute
 	issuedAt := time.Now()
 	expiresAt := time.Now().Add(duration)
-	token, err := maker.Create(userId, email, role, duration)
+	token, payload, err := maker.Create(PayloadParams{
+		UserID:    userId,
+		Email:     email,
+		Role:      role,
+		SessionID: sessionId,
+		TokenType: TokenTypeRefresh,
+	}, duration)
 
 	require.NoError(t, err)
 	require.NotEmpty(t, token)
+	require.NotEmpty(t, payload)
 
 	claims, err := maker.Verify(token)
 	require.NoError(t, err)
 	require.NotEmpty(t, claims)
+	require.Equal(t, payload.TokenID, claims.TokenID)
+	require.Equal(t, sessionId, claims.SessionID)
+	require.Equal(t, TokenTypeRefresh, claims.TokenType)
 	require.Equal(t, email, claims.Email)
 	require.WithinDuration(t, issuedAt, claims.IssuedAt, time.Second)
 	require.WithinDuration(t, expiresAt, claims.ExpiresAt, time.Second)
@@ -37,7 +49,7 @@ func TestExpiredPasetoToken(t *testing.T) {
 	userId := util.RandInt(1, 100)
 	role := util.RandRole()
 	duration := -time.Minute
-	token, err := maker.Create(userId, email, role, duration)
+	token, _, err := maker.Create(PayloadParams{UserID: userId, Email: email, Role: role}, duration)
 
 	require.NoError(t, err)
 	require.NotEmpty(t, token)
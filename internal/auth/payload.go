@@ -4,9 +4,25 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// TokenType distinguishes what a token can be used for so that, for example, a refresh token can't be presented as an access token
+type TokenType string
+
+const (
+	TokenTypeAccess  TokenType = "access"
+	TokenTypeRefresh TokenType = "refresh"
+	// TokenTypeEmailVerification is embedded in the link sent to users to confirm their email address
+	TokenTypeEmailVerification TokenType = "email_verification"
+	// TokenTypeMFAChallenge proves the password step of a two-step login succeeded
+	TokenTypeMFAChallenge TokenType = "mfa_challenge"
 )
 
 type Payload struct {
+	TokenID   uuid.UUID `json:"token_id"`
+	SessionID uuid.UUID `json:"session_id"`
+	TokenType TokenType `json:"token_type"`
 	Email     string    `json:"email"`
 	IssuedAt  time.Time `json:"issued_at"`
 	ExpiresAt time.Time `json:"expires_at"`
@@ -15,12 +31,32 @@ type Payload struct {
 	jwt.RegisteredClaims
 }
 
-func NewPayload(userId int64, email, role string, duration time.Duration) *Payload {
-	return &Payload{
-		UserID:    userId,
-		Email:     email,
-		Role:      role,
-		IssuedAt:  time.Now(),
-		ExpiresAt: time.Now().Add(duration),
+type PayloadParams struct {
+	UserID    int64
+	Email     string
+	Role      string
+	SessionID uuid.UUID
+	TokenType TokenType
+}
+
+func NewPayload(params PayloadParams, duration time.Duration) (*Payload, error) {
+	tokenId, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
 	}
+	tokenType := params.TokenType
+	if tokenType == "" {
+		tokenType = TokenTypeAccess
+	}
+	now := time.Now()
+	return &Payload{
+		TokenID:   tokenId,
+		SessionID: params.SessionID,
+		TokenType: tokenType,
+		UserID:    params.UserID,
+		Email:     params.Email,
+		Role:      params.Role,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(duration),
+	}, nil
 }
@@ -0,0 +1,101 @@
+package auth
+
+// roles, these mirror the values of the role enum in the database
+const (
+	RolePatient    = "patient"
+	RoleSpecialist = "specialist"
+	RoleAdmin      = "admin"
+)
+
+// Permission is a single action a role is allowed to perform
+type Permission string
+
+const (
+	// read a patient's health record (allergies, medications, observations , documents)
+	PermissionEHRRead Permission = "ehr:read"
+	// add to or edit a patient's health record
+	PermissionEHRWrite Permission = "ehr:write"
+	// write clinical notes from a consultation
+	PermissionNotesWrite Permission = "notes:write"
+	// create a patient profile
+	PermissionPatientsOnboard Permission = "patients:onboard"
+	// create a doctor profile
+	PermissionDoctorsOnboard Permission = "doctors:onboard"
+	// list the patients under the doctor's care
+	PermissionPatientsView Permission = "patients:view"
+	// book appointments and view the patient's own appointments
+	PermissionAppointmentsBook Permission = "appointments:book"
+	// cancel an appointment the user is taking part in
+	PermissionAppointmentsCancel Permission = "appointments:cancel"
+	// move appointments through their lifecycle
+	PermissionAppointmentsManage Permission = "appointments:manage"
+	// manage a doctor's availability and view their schedule
+	PermissionScheduleManage Permission = "schedule:manage"
+	// request time-boxed emergency access to a patient outside the care relationship
+	PermissionBreakGlass Permission = "ehr:break_glass"
+	// view access reports
+	PermissionAuditRead Permission = "audit:read"
+	// see who has accessed the patient's own record
+	PermissionAccessLogRead Permission = "audit:read_own"
+	// review doctor licenses
+	PermissionDoctorsVerify Permission = "doctors:verify"
+	// administer user accounts
+	PermissionUsersManage Permission = "users:manage"
+	// review payment reconciliation and payout reports
+	PermissionPaymentsReview Permission = "payments:review"
+	// register the doctor's payout account and view their earnings
+	PermissionPayoutsManage Permission = "payouts:manage"
+)
+
+var rolePermissions = map[string][]Permission{
+	RolePatient: {
+		PermissionEHRRead,
+		PermissionEHRWrite,
+		PermissionPatientsOnboard,
+		PermissionAppointmentsBook,
+		PermissionAppointmentsCancel,
+		PermissionAccessLogRead,
+	},
+	RoleSpecialist: {
+		PermissionEHRRead,
+		PermissionEHRWrite,
+		PermissionNotesWrite,
+		PermissionBreakGlass,
+		PermissionDoctorsOnboard,
+		PermissionPatientsView,
+		PermissionAppointmentsCancel,
+		PermissionAppointmentsManage,
+		PermissionScheduleManage,
+		PermissionPayoutsManage,
+	},
+	RoleAdmin: {
+		PermissionAppointmentsManage,
+		PermissionDoctorsVerify,
+		PermissionUsersManage,
+		PermissionAuditRead,
+		PermissionPaymentsReview,
+	},
+}
+
+// PermissionsForRole returns the permissions granted to a role, unknown roles get none
+func PermissionsForRole(role string) []Permission {
+	return rolePermissions[role]
+}
+
+// HasPermissions reports whether the role has been granted every one of the permissions
+func HasPermissions(role string, permissions ...Permission) bool {
+	granted := rolePermissions[role]
+	for _, required := range permissions {
+		found := false
+		for _, permission := range granted {
+			if permission == required {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
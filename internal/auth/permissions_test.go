@@ -0,0 +1,23 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHasPermissions(t *testing.T) {
+	require.True(t, HasPermissions(RoleSpecialist, PermissionEHRRead, PermissionNotesWrite))
+	require.True(t, HasPermissions(RolePatient, PermissionAppointmentsBook))
+	require.True(t, HasPermissions(RoleAdmin, PermissionDoctorsVerify))
+	require.True(t, HasPermissions(RoleSpecialist, PermissionPayoutsManage))
+	// every permission has to be granted
+	require.False(t, HasPermissions(RolePatient, PermissionEHRRead, PermissionNotesWrite))
+	require.False(t, HasPermissions(RolePatient, PermissionAppointmentsManage))
+	require.False(t, HasPermissions(RoleSpecialist, PermissionDoctorsVerify))
+	require.False(t, HasPermissions(RolePatient, PermissionPayoutsManage))
+	// admins don't get access to health records through their role
+	require.False(t, HasPermissions(RoleAdmin, PermissionEHRRead))
+	require.False(t, HasPermissions("unknown", PermissionEHRRead))
+	require.Empty(t, PermissionsForRole("unknown"))
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/util"
+	"github.com/stretchr/testify/require"
+)
+
+// the SHA1 test vectors from RFC 6238 appendix B , truncated to 6 digits
+func TestGenerateTOTPCodeRFCVectors(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, expected := range vectors {
+		code, err := GenerateTOTPCode(secret, time.Unix(unix, 0))
+		require.NoError(t, err)
+		require.Equal(t, expected, code, "unix time %d", unix)
+	}
+}
+
+func TestValidateTOTPCode(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	require.NoError(t, err)
+	now := time.Now()
+
+	code, err := GenerateTOTPCode(secret, now)
+	require.NoError(t, err)
+	step, ok := ValidateTOTPCode(secret, code, now)
+	require.True(t, ok)
+	require.Equal(t, TOTPStep(now), step)
+
+	// the previous period is still accepted to allow for clock drift
+	previous, err := GenerateTOTPCode(secret, now.Add(-30*time.Second))
+	require.NoError(t, err)
+	_, ok = ValidateTOTPCode(secret, previous, now)
+	require.True(t, ok)
+
+	stale, err := GenerateTOTPCode(secret, now.Add(-5*time.Minute))
+	require.NoError(t, err)
+	if stale != code && stale != previous {
+		_, ok = ValidateTOTPCode(secret, stale, now)
+		require.False(t, ok)
+	}
+
+	_, ok = ValidateTOTPCode(secret, "12345", now)
+	require.False(t, ok)
+	_, ok = ValidateTOTPCode("not base32!", code, now)
+	require.False(t, ok)
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("Lyra", "doc@example.com", "JBSWY3DPEHPK3PXP")
+	require.True(t, strings.HasPrefix(uri, "otpauth://totp/Lyra:doc@example.com?"))
+	require.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	require.Contains(t, uri, "issuer=Lyra")
+}
+
+func TestSecretCipher(t *testing.T) {
+	cipher, err := NewSecretCipher(util.RandString(32))
+	require.NoError(t, err)
+
+	ciphertext, err := cipher.Encrypt("JBSWY3DPEHPK3PXP")
+	require.NoError(t, err)
+	require.NotContains(t, ciphertext, "JBSWY3DPEHPK3PXP")
+
+	plaintext, err := cipher.Decrypt(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, "JBSWY3DPEHPK3PXP", plaintext)
+
+	other, err := NewSecretCipher(util.RandString(32))
+	require.NoError(t, err)
+	_, err = other.Decrypt(ciphertext)
+	require.ErrorIs(t, err, ErrInvalidCiphertext)
+
+	_, err = NewSecretCipher("short")
+	require.Error(t, err)
+}
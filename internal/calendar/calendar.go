@@ -0,0 +1,163 @@
+package calendar
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Method is the iTIP method of a calendar (RFC 5546) , feeds are published and invites are requests or cancellations
+type Method string
+
+const (
+	MethodPublish Method = "PUBLISH"
+	MethodRequest Method = "REQUEST"
+	MethodCancel  Method = "CANCEL"
+)
+
+type Status string
+
+const (
+	StatusConfirmed Status = "CONFIRMED"
+	StatusCancelled Status = "CANCELLED"
+)
+
+const (
+	productID = "-//Lyra//Appointments//EN"
+	// times are always written in UTC so that no VTIMEZONE has to be sent with them
+	dateTimeLayout = "20060102T150405Z"
+	// content lines are folded at 75 octets (RFC 5545 3.1)
+	maxLineOctets = 75
+)
+
+type Person struct {
+	Name  string
+	Email string
+}
+
+// Event is a single VEVENT , the UID has to stay the same for every version of the event
+// and Sequence has to go up whenever its time changes or it is cancelled
+type Event struct {
+	UID          string
+	Sequence     int
+	Status       Status
+	Start        time.Time
+	End          time.Time
+	Summary      string
+	Description  string
+	URL          string
+	Organizer    Person
+	Attendees    []Person
+	LastModified time.Time
+}
+
+type Calendar struct {
+	Method Method
+	// the name calendar apps show for a subscribed feed
+	Name   string
+	Events []Event
+}
+
+// AppointmentUID is the stable UID of an appointment , domain keeps it unique across the calendars it ends up in
+func AppointmentUID(appointmentId int64, domain string) string {
+	return fmt.Sprintf("appointment-%d@%s", appointmentId, domain)
+}
+
+// Encode writes the calendar as an RFC 5545 iCalendar object , stamp is the DTSTAMP of its events
+func (c Calendar) Encode(stamp time.Time) []byte {
+	var w writer
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", productID)
+	w.line("CALSCALE", "GREGORIAN")
+	if c.Method != "" {
+		w.line("METHOD", string(c.Method))
+	}
+	if c.Name != "" {
+		w.line("X-WR-CALNAME", escapeText(c.Name))
+	}
+	for _, event := range c.Events {
+		w.event(event, stamp)
+	}
+	w.line("END", "VCALENDAR")
+	return []byte(w.String())
+}
+
+type writer struct {
+	strings.Builder
+}
+
+func (w *writer) event(e Event, stamp time.Time) {
+	w.line("BEGIN", "VEVENT")
+	w.line("UID", e.UID)
+	w.line("DTSTAMP", formatTime(stamp))
+	w.line("DTSTART", formatTime(e.Start))
+	w.line("DTEND", formatTime(e.End))
+	w.line("SEQUENCE", fmt.Sprint(e.Sequence))
+	status := e.Status
+	if status == "" {
+		status = StatusConfirmed
+	}
+	w.line("STATUS", string(status))
+	w.line("SUMMARY", escapeText(e.Summary))
+	if e.Description != "" {
+		w.line("DESCRIPTION", escapeText(e.Description))
+	}
+	if e.URL != "" {
+		w.line("URL", e.URL)
+	}
+	if !e.LastModified.IsZero() {
+		w.line("LAST-MODIFIED", formatTime(e.LastModified))
+	}
+	if e.Organizer.Email != "" {
+		w.line("ORGANIZER"+commonName(e.Organizer.Name), "mailto:"+e.Organizer.Email)
+	}
+	for _, attendee := range e.Attendees {
+		w.line("ATTENDEE"+commonName(attendee.Name)+";ROLE=REQ-PARTICIPANT;PARTSTAT=ACCEPTED", "mailto:"+attendee.Email)
+	}
+	w.line("END", "VEVENT")
+}
+
+// line writes a content line ending in CRLF , lines longer than 75 octets are folded without splitting a UTF-8 character
+func (w *writer) line(name, value string) {
+	content := name + ":" + value
+	limit := maxLineOctets
+	for len(content) > limit {
+		cut := limit
+		for !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		w.WriteString(content[:cut])
+		w.WriteString("\r\n ")
+		content = content[cut:]
+		// the space that starts a continuation line counts towards its length
+		limit = maxLineOctets - 1
+	}
+	w.WriteString(content)
+	w.WriteString("\r\n")
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(dateTimeLayout)
+}
+
+// escapeText escapes a TEXT value (RFC 5545 3.3.11)
+func escapeText(value string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(value)
+}
+
+// commonName is the CN parameter of a person , it is quoted since names can hold commas and colons
+func commonName(name string) string {
+	if name == "" {
+		return ""
+	}
+	// double quotes can't appear in a quoted parameter value
+	return `;CN="` + strings.ReplaceAll(name, `"`, "'") + `"`
+}
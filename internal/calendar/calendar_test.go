@@ -0,0 +1,97 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newInvite(method Method, sequence int) Calendar {
+	event := Event{
+		UID:      AppointmentUID(42, "api.lyra.test"),
+		Sequence: sequence,
+		Start:    time.Date(2026, 3, 29, 9, 0, 0, 0, time.FixedZone("EAT", 3*60*60)),
+		End:      time.Date(2026, 3, 29, 10, 0, 0, 0, time.FixedZone("EAT", 3*60*60)),
+		Summary:  "Consultation with Dr. Wanjiru, Achieng",
+		Organizer: Person{
+			Name:  "Lyra",
+			Email: "appointments@lyra.test",
+		},
+		Attendees: []Person{
+			{Name: "Amina Odhiambo", Email: "amina@example.com"},
+			{Name: `Dr. "Jo" Wanjiru`, Email: "jo@example.com"},
+		},
+	}
+	if method == MethodCancel {
+		event.Status = StatusCancelled
+	}
+	return Calendar{Method: method, Events: []Event{event}}
+}
+
+func unfold(ics string) []string {
+	return strings.Split(strings.TrimSuffix(strings.ReplaceAll(ics, "\r\n ", ""), "\r\n"), "\r\n")
+}
+
+func TestEncodeInvite(t *testing.T) {
+	stamp := time.Date(2026, 3, 1, 8, 30, 0, 0, time.UTC)
+	ics := string(newInvite(MethodRequest, 0).Encode(stamp))
+	lines := unfold(ics)
+
+	require.Equal(t, "BEGIN:VCALENDAR", lines[0])
+	require.Equal(t, "END:VCALENDAR", lines[len(lines)-1])
+	require.Contains(t, lines, "METHOD:REQUEST")
+	require.Contains(t, lines, "UID:appointment-42@api.lyra.test")
+	require.Contains(t, lines, "DTSTAMP:20260301T083000Z")
+	// the times are written in UTC
+	require.Contains(t, lines, "DTSTART:20260329T060000Z")
+	require.Contains(t, lines, "DTEND:20260329T070000Z")
+	require.Contains(t, lines, "SEQUENCE:0")
+	require.Contains(t, lines, "STATUS:CONFIRMED")
+	require.Contains(t, lines, `SUMMARY:Consultation with Dr. Wanjiru\, Achieng`)
+	require.Contains(t, lines, `ORGANIZER;CN="Lyra":mailto:appointments@lyra.test`)
+	require.Contains(t, lines, `ATTENDEE;CN="Dr. 'Jo' Wanjiru";ROLE=REQ-PARTICIPANT;PARTSTAT=ACCEPTED:mailto:jo@example.com`)
+	// every line ends in CRLF
+	require.NotContains(t, strings.ReplaceAll(ics, "\r\n", ""), "\n")
+}
+
+func TestEncodeCancellation(t *testing.T) {
+	stamp := time.Date(2026, 3, 2, 8, 30, 0, 0, time.UTC)
+	request := unfold(string(newInvite(MethodRequest, 1).Encode(stamp)))
+	cancel := unfold(string(newInvite(MethodCancel, 2).Encode(stamp)))
+
+	require.Contains(t, cancel, "METHOD:CANCEL")
+	require.Contains(t, cancel, "STATUS:CANCELLED")
+	require.Contains(t, cancel, "SEQUENCE:2")
+	// a cancellation refers to the event it cancels by its UID
+	uid := "UID:appointment-42@api.lyra.test"
+	require.Contains(t, request, uid)
+	require.Contains(t, cancel, uid)
+}
+
+func TestFoldLongLines(t *testing.T) {
+	calendar := Calendar{
+		Method: MethodPublish,
+		Name:   "Lyra appointments",
+		Events: []Event{{
+			UID:     AppointmentUID(7, "api.lyra.test"),
+			Start:   time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC),
+			End:     time.Date(2026, 1, 5, 10, 0, 0, 0, time.UTC),
+			Summary: "Ushauri na daktari 🩺 " + strings.Repeat("ü", 80),
+			Description: "Line one\nLine two; with a semicolon\\ and a backslash , " +
+				strings.Repeat("a long description ", 10),
+		}},
+	}
+	ics := string(calendar.Encode(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)))
+	for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+		require.LessOrEqual(t, len(line), 75)
+		// multi-octet characters are never split across lines
+		require.True(t, utf8.ValidString(line), line)
+	}
+	lines := unfold(ics)
+	require.Contains(t, lines, "SUMMARY:Ushauri na daktari 🩺 "+strings.Repeat("ü", 80))
+	require.Contains(t, lines, `DESCRIPTION:Line one\nLine two\; with a semicolon\\ and a backslash \, `+strings.Repeat("a long description ", 10))
+	require.Contains(t, lines, "X-WR-CALNAME:Lyra appointments")
+}
@@ -0,0 +1,108 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: appointment_reschedules.sql
+
+package database
+
+import (
+	"context"
+	"time"
+)
+
+const countAppointmentReschedules = `-- name: CountAppointmentReschedules :one
+SELECT COUNT(*) FROM appointment_reschedules WHERE appointment_id = $1
+`
+
+func (q *Queries) CountAppointmentReschedules(ctx context.Context, appointmentID int64) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countAppointmentReschedules, appointmentID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createAppointmentReschedule = `-- name: CreateAppointmentReschedule :one
+INSERT INTO appointment_reschedules (
+  appointment_id,
+  previous_start_time,
+  previous_end_time,
+  new_start_time,
+  new_end_time,
+  reason,
+  rescheduled_by
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7
+) RETURNING reschedule_id, appointment_id, previous_start_time, previous_end_time, new_start_time, new_end_time, reason, rescheduled_by, created_at
+`
+
+type CreateAppointmentRescheduleParams struct {
+	AppointmentID     int64     `json:"appointment_id"`
+	PreviousStartTime time.Time `json:"previous_start_time"`
+	PreviousEndTime   time.Time `json:"previous_end_time"`
+	NewStartTime      time.Time `json:"new_start_time"`
+	NewEndTime        time.Time `json:"new_end_time"`
+	Reason            string    `json:"reason"`
+	RescheduledBy     int64     `json:"rescheduled_by"`
+}
+
+func (q *Queries) CreateAppointmentReschedule(ctx context.Context, arg CreateAppointmentRescheduleParams) (AppointmentReschedule, error) {
+	row := q.db.QueryRowContext(ctx, createAppointmentReschedule,
+		arg.AppointmentID,
+		arg.PreviousStartTime,
+		arg.PreviousEndTime,
+		arg.NewStartTime,
+		arg.NewEndTime,
+		arg.Reason,
+		arg.RescheduledBy,
+	)
+	var i AppointmentReschedule
+	err := row.Scan(
+		&i.RescheduleID,
+		&i.AppointmentID,
+		&i.PreviousStartTime,
+		&i.PreviousEndTime,
+		&i.NewStartTime,
+		&i.NewEndTime,
+		&i.Reason,
+		&i.RescheduledBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listAppointmentReschedules = `-- name: ListAppointmentReschedules :many
+SELECT reschedule_id, appointment_id, previous_start_time, previous_end_time, new_start_time, new_end_time, reason, rescheduled_by, created_at FROM appointment_reschedules WHERE appointment_id = $1 ORDER BY created_at
+`
+
+func (q *Queries) ListAppointmentReschedules(ctx context.Context, appointmentID int64) ([]AppointmentReschedule, error) {
+	rows, err := q.db.QueryContext(ctx, listAppointmentReschedules, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AppointmentReschedule
+	for rows.Next() {
+		var i AppointmentReschedule
+		if err := rows.Scan(
+			&i.RescheduleID,
+			&i.AppointmentID,
+			&i.PreviousStartTime,
+			&i.PreviousEndTime,
+			&i.NewStartTime,
+			&i.NewEndTime,
+			&i.Reason,
+			&i.RescheduledBy,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,81 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: appointment_status_history.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+const createAppointmentStatusHistory = `-- name: CreateAppointmentStatusHistory :exec
+INSERT INTO appointment_status_history (
+  appointment_id,
+  from_status,
+  to_status,
+  actor,
+  changed_by,
+  reason
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+`
+
+type CreateAppointmentStatusHistoryParams struct {
+	AppointmentID int64             `json:"appointment_id"`
+	FromStatus    AppointmentStatus `json:"from_status"`
+	ToStatus      AppointmentStatus `json:"to_status"`
+	Actor         string            `json:"actor"`
+	ChangedBy     sql.NullInt64     `json:"changed_by"`
+	Reason        string            `json:"reason"`
+}
+
+func (q *Queries) CreateAppointmentStatusHistory(ctx context.Context, arg CreateAppointmentStatusHistoryParams) error {
+	_, err := q.db.ExecContext(ctx, createAppointmentStatusHistory,
+		arg.AppointmentID,
+		arg.FromStatus,
+		arg.ToStatus,
+		arg.Actor,
+		arg.ChangedBy,
+		arg.Reason,
+	)
+	return err
+}
+
+const listAppointmentStatusHistory = `-- name: ListAppointmentStatusHistory :many
+SELECT history_id, appointment_id, from_status, to_status, actor, changed_by, reason, created_at FROM appointment_status_history WHERE appointment_id = $1 ORDER BY created_at, history_id
+`
+
+func (q *Queries) ListAppointmentStatusHistory(ctx context.Context, appointmentID int64) ([]AppointmentStatusHistory, error) {
+	rows, err := q.db.QueryContext(ctx, listAppointmentStatusHistory, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AppointmentStatusHistory
+	for rows.Next() {
+		var i AppointmentStatusHistory
+		if err := rows.Scan(
+			&i.HistoryID,
+			&i.AppointmentID,
+			&i.FromStatus,
+			&i.ToStatus,
+			&i.Actor,
+			&i.ChangedBy,
+			&i.Reason,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -11,6 +11,122 @@ import (
 	"time"
 )
 
+const checkAppointmentSlot = `-- name: CheckAppointmentSlot :one
+WITH params AS (
+  SELECT
+    $1::bigint AS doctor_id,
+    $2::bigint AS appointment_id,
+    $3::timestamptz AS start_time,
+    $4::timestamptz AS end_time,
+    $5::timestamptz AS held_after
+),
+requested AS (
+  SELECT
+    params.doctor_id, params.appointment_id, params.start_time, params.end_time, params.held_after,
+    (params.start_time AT TIME ZONE d.timezone) AS local_start,
+    (params.end_time AT TIME ZONE d.timezone) AS local_end,
+    d.observes_public_holidays,
+    COALESCE(r.buffer_minutes, 0) AS buffer_minutes,
+    COALESCE(r.min_notice_minutes, 0) AS min_notice_minutes,
+    COALESCE(r.horizon_days, 0) AS horizon_days
+  FROM params
+  JOIN doctors d ON d.doctor_id = params.doctor_id
+  LEFT JOIN booking_rules r ON r.doctor_id = d.doctor_id
+)
+SELECT
+  EXISTS (
+    SELECT 1 WHERE (
+      EXISTS (
+        SELECT 1 FROM availability av
+        WHERE av.doctor_id = requested.doctor_id
+          AND av.is_recurring = true
+          AND av.day_of_week = EXTRACT(DOW FROM requested.local_start)
+          AND (av.start_time, av.end_time) OVERLAPS (requested.local_start::time, requested.local_end::time)
+          AND NOT (
+            requested.observes_public_holidays
+            AND EXISTS (SELECT 1 FROM public_holidays h WHERE h.holiday_date = requested.local_start::date)
+          )
+      ) OR EXISTS (
+        SELECT 1 FROM availability_exceptions ex
+        WHERE ex.doctor_id = requested.doctor_id
+          AND ex.kind = 'extra'
+          AND tstzrange(ex.starts_at, ex.ends_at, '[)') && tstzrange(requested.start_time, requested.end_time, '[)')
+      )
+    ) AND NOT EXISTS (
+      SELECT 1 FROM availability_exceptions bl
+      WHERE bl.doctor_id = requested.doctor_id
+        AND bl.kind = 'block'
+        AND tstzrange(bl.starts_at, bl.ends_at, '[)') && tstzrange(requested.start_time, requested.end_time, '[)')
+    )
+  ) AS within_availability,
+  EXISTS (
+    SELECT 1 FROM appointments ap
+    WHERE ap.doctor_id = requested.doctor_id
+      AND (ap.current_status IN ('scheduled', 'in_progress')
+        OR (ap.current_status = 'pending_payment' AND ap.created_at > requested.held_after))
+      AND ap.appointment_id != requested.appointment_id
+      AND ap.time_range && tstzrange(requested.start_time, requested.end_time, '[)')
+  ) AS already_booked,
+  requested.start_time < now() + requested.min_notice_minutes * interval '1 minute' AS too_soon,
+  EXISTS (
+    SELECT 1 WHERE requested.horizon_days > 0 AND requested.start_time > now() + requested.horizon_days * interval '1 day'
+  ) AS too_far,
+  EXISTS (
+    SELECT 1 FROM appointments ap
+    WHERE ap.doctor_id = requested.doctor_id
+      AND (ap.current_status IN ('scheduled', 'in_progress')
+        OR (ap.current_status = 'pending_payment' AND ap.created_at > requested.held_after))
+      AND ap.appointment_id != requested.appointment_id
+      AND ap.time_range && tstzrange(
+        requested.start_time - requested.buffer_minutes * interval '1 minute',
+        requested.end_time + requested.buffer_minutes * interval '1 minute',
+        '[)'
+      )
+  ) AS too_close
+FROM requested
+`
+
+type CheckAppointmentSlotParams struct {
+	DoctorID      int64     `json:"doctor_id"`
+	AppointmentID int64     `json:"appointment_id"`
+	StartTime     time.Time `json:"start_time"`
+	EndTime       time.Time `json:"end_time"`
+	HeldAfter     time.Time `json:"held_after"`
+}
+
+type CheckAppointmentSlotRow struct {
+	WithinAvailability bool `json:"within_availability"`
+	AlreadyBooked      bool `json:"already_booked"`
+	TooSoon            bool `json:"too_soon"`
+	TooFar             bool `json:"too_far"`
+	TooClose           bool `json:"too_close"`
+}
+
+// applies the same rules as the check_appointment_availability trigger and the no_overlapping_appointments constraint ,
+// the appointment being moved doesn't count as an overlap and neither do unpaid appointments created at or before held_after
+// (their hold has run out , they are expired when the appointment is added like they are hidden from the slot listing)
+// (the time has to be in a weekly window on a day that isn't an observed holiday or in extra hours , and not in a block) ,
+// the weekly windows are in the doctor's timezone , too_soon , too_far and too_close are the doctor's booking rules and are
+// returned apart so that the patient can be told which one the time breaks
+func (q *Queries) CheckAppointmentSlot(ctx context.Context, arg CheckAppointmentSlotParams) (CheckAppointmentSlotRow, error) {
+	row := q.db.QueryRowContext(ctx, checkAppointmentSlot,
+		arg.DoctorID,
+		arg.AppointmentID,
+		arg.StartTime,
+		arg.EndTime,
+		arg.HeldAfter,
+	)
+	var i CheckAppointmentSlotRow
+	err := row.Scan(
+		&i.WithinAvailability,
+		&i.AlreadyBooked,
+		&i.TooSoon,
+		&i.TooFar,
+		&i.TooClose,
+	)
+	return i, err
+}
+
 const checkSpecialistPatientAppointmentExists = `-- name: CheckSpecialistPatientAppointmentExists :one
 SELECT EXISTS(
   SELECT 1
@@ -34,7 +150,7 @@ func (q *Queries) CheckSpecialistPatientAppointmentExists(ctx context.Context, a
 }
 
 const createAppointment = `-- name: CreateAppointment :one
-INSERT INTO appointments(patient_id,doctor_id,start_time,end_time, reason) VALUES ($1,$2,$3,$4,$5) RETURNING appointment_id, patient_id, doctor_id, current_status, reason, notes, start_time, end_time, created_at, updated_at
+INSERT INTO appointments(patient_id,doctor_id,start_time,end_time, reason) VALUES ($1,$2,$3,$4,$5) RETURNING appointment_id, patient_id, doctor_id, current_status, reason, notes, start_time, end_time, created_at, updated_at, time_range
 `
 
 type CreateAppointmentParams struct {
@@ -65,6 +181,7 @@ func (q *Queries) CreateAppointment(ctx context.Context, arg CreateAppointmentPa
 		&i.EndTime,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.TimeRange,
 	)
 	return i, err
 }
@@ -78,6 +195,71 @@ func (q *Queries) DeleteAppointment(ctx context.Context, appointmentID int64) er
 	return err
 }
 
+const expirePendingAppointments = `-- name: ExpirePendingAppointments :many
+WITH expired AS (
+  UPDATE appointments SET current_status = 'cancelled', updated_at = now()
+  WHERE appointments.current_status = 'pending_payment' AND appointments.created_at <= $1
+    AND ($2::bigint = 0 OR appointments.doctor_id = $2::bigint)
+  RETURNING appointment_id
+)
+INSERT INTO appointment_status_history (appointment_id, from_status, to_status, actor, reason)
+SELECT appointment_id, 'pending_payment', 'cancelled', 'system', 'the payment hold expired'
+FROM expired
+RETURNING appointment_id
+`
+
+type ExpirePendingAppointmentsParams struct {
+	CreatedBefore time.Time `json:"created_before"`
+	DoctorID      int64     `json:"doctor_id"`
+}
+
+// cancels the unpaid appointments whose hold has run out (only the doctor's if doctor_id isn't 0) and records the change in their history
+func (q *Queries) ExpirePendingAppointments(ctx context.Context, arg ExpirePendingAppointmentsParams) ([]int64, error) {
+	rows, err := q.db.QueryContext(ctx, expirePendingAppointments, arg.CreatedBefore, arg.DoctorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int64
+	for rows.Next() {
+		var appointment_id int64
+		if err := rows.Scan(&appointment_id); err != nil {
+			return nil, err
+		}
+		items = append(items, appointment_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAppointmentById = `-- name: GetAppointmentById :one
+SELECT appointment_id, patient_id, doctor_id, current_status, reason, notes, start_time, end_time, created_at, updated_at, time_range FROM appointments WHERE appointment_id=$1
+`
+
+func (q *Queries) GetAppointmentById(ctx context.Context, appointmentID int64) (Appointment, error) {
+	row := q.db.QueryRowContext(ctx, getAppointmentById, appointmentID)
+	var i Appointment
+	err := row.Scan(
+		&i.AppointmentID,
+		&i.PatientID,
+		&i.DoctorID,
+		&i.CurrentStatus,
+		&i.Reason,
+		&i.Notes,
+		&i.StartTime,
+		&i.EndTime,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TimeRange,
+	)
+	return i, err
+}
+
 const getAppointmentIDs = `-- name: GetAppointmentIDs :many
 WITH params AS (
   SELECT
@@ -124,9 +306,64 @@ func (q *Queries) GetAppointmentIDs(ctx context.Context, arg GetAppointmentIDsPa
 	return items, nil
 }
 
+const getAppointmentParticipants = `-- name: GetAppointmentParticipants :one
+SELECT
+  a.appointment_id,
+  a.start_time,
+  a.end_time,
+  a.current_status,
+  a.updated_at,
+  d.timezone AS doctor_timezone,
+  du.full_name AS doctor_name,
+  du.email AS doctor_email,
+  pu.full_name AS patient_name,
+  pu.email AS patient_email,
+  (SELECT COUNT(*) FROM appointment_reschedules r WHERE r.appointment_id = a.appointment_id) AS reschedule_count
+FROM appointments a
+JOIN doctors d ON d.doctor_id = a.doctor_id
+JOIN users du ON du.user_id = d.user_id
+JOIN patients p ON p.patient_id = a.patient_id
+JOIN users pu ON pu.user_id = p.user_id
+WHERE a.appointment_id = $1
+`
+
+type GetAppointmentParticipantsRow struct {
+	AppointmentID   int64             `json:"appointment_id"`
+	StartTime       time.Time         `json:"start_time"`
+	EndTime         time.Time         `json:"end_time"`
+	CurrentStatus   AppointmentStatus `json:"current_status"`
+	UpdatedAt       sql.NullTime      `json:"updated_at"`
+	DoctorTimezone  string            `json:"doctor_timezone"`
+	DoctorName      string            `json:"doctor_name"`
+	DoctorEmail     string            `json:"doctor_email"`
+	PatientName     string            `json:"patient_name"`
+	PatientEmail    string            `json:"patient_email"`
+	RescheduleCount int64             `json:"reschedule_count"`
+}
+
+// the appointment with the doctor and the patient it is sent to , reschedule_count versions the calendar invites
+func (q *Queries) GetAppointmentParticipants(ctx context.Context, appointmentID int64) (GetAppointmentParticipantsRow, error) {
+	row := q.db.QueryRowContext(ctx, getAppointmentParticipants, appointmentID)
+	var i GetAppointmentParticipantsRow
+	err := row.Scan(
+		&i.AppointmentID,
+		&i.StartTime,
+		&i.EndTime,
+		&i.CurrentStatus,
+		&i.UpdatedAt,
+		&i.DoctorTimezone,
+		&i.DoctorName,
+		&i.DoctorEmail,
+		&i.PatientName,
+		&i.PatientEmail,
+		&i.RescheduleCount,
+	)
+	return i, err
+}
+
 const getDoctorAppointments = `-- name: GetDoctorAppointments :many
 SELECT 
-a.appointment_id, a.patient_id, a.doctor_id, a.current_status, a.reason, a.notes, a.start_time, a.end_time, a.created_at, a.updated_at, 
+a.appointment_id, a.patient_id, a.doctor_id, a.current_status, a.reason, a.notes, a.start_time, a.end_time, a.created_at, a.updated_at, a.time_range, 
 u.full_name AS patient_name,
 u.profile_image_url AS patient_profile_image_url
 FROM appointments a 
@@ -156,6 +393,7 @@ type GetDoctorAppointmentsRow struct {
 	EndTime                time.Time         `json:"end_time"`
 	CreatedAt              time.Time         `json:"created_at"`
 	UpdatedAt              sql.NullTime      `json:"updated_at"`
+	TimeRange              string            `json:"-"`
 	PatientName            string            `json:"patient_name"`
 	PatientProfileImageUrl string            `json:"patient_profile_image_url"`
 }
@@ -180,6 +418,7 @@ func (q *Queries) GetDoctorAppointments(ctx context.Context, arg GetDoctorAppoin
 			&i.EndTime,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.TimeRange,
 			&i.PatientName,
 			&i.PatientProfileImageUrl,
 		); err != nil {
@@ -198,7 +437,7 @@ func (q *Queries) GetDoctorAppointments(ctx context.Context, arg GetDoctorAppoin
 
 const getPatientAppointments = `-- name: GetPatientAppointments :many
 SELECT
-a.appointment_id, a.patient_id, a.doctor_id, a.current_status, a.reason, a.notes, a.start_time, a.end_time, a.created_at, a.updated_at,
+a.appointment_id, a.patient_id, a.doctor_id, a.current_status, a.reason, a.notes, a.start_time, a.end_time, a.created_at, a.updated_at, a.time_range,
 d.specialization,
 u.full_name AS doctor_name,
 u.profile_image_url AS doctor_profile_image_url
@@ -230,6 +469,7 @@ type GetPatientAppointmentsRow struct {
 	EndTime               time.Time         `json:"end_time"`
 	CreatedAt             time.Time         `json:"created_at"`
 	UpdatedAt             sql.NullTime      `json:"updated_at"`
+	TimeRange             string            `json:"-"`
 	Specialization        string            `json:"specialization"`
 	DoctorName            string            `json:"doctor_name"`
 	DoctorProfileImageUrl string            `json:"doctor_profile_image_url"`
@@ -255,6 +495,7 @@ func (q *Queries) GetPatientAppointments(ctx context.Context, arg GetPatientAppo
 			&i.EndTime,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.TimeRange,
 			&i.Specialization,
 			&i.DoctorName,
 			&i.DoctorProfileImageUrl,
@@ -272,16 +513,62 @@ func (q *Queries) GetPatientAppointments(ctx context.Context, arg GetPatientAppo
 	return items, nil
 }
 
-const updateAppointmentStatus = `-- name: UpdateAppointmentStatus :exec
-UPDATE appointments SET current_status=$1 WHERE appointment_id=$2
+const rescheduleAppointment = `-- name: RescheduleAppointment :one
+UPDATE appointments SET start_time = $1, end_time = $2, updated_at = now()
+WHERE appointment_id = $3
+  AND current_status = 'scheduled'
+  AND start_time = $4
+RETURNING appointment_id, patient_id, doctor_id, current_status, reason, notes, start_time, end_time, created_at, updated_at, time_range
 `
 
-type UpdateAppointmentStatusParams struct {
-	CurrentStatus AppointmentStatus `json:"current_status"`
+type RescheduleAppointmentParams struct {
+	StartTime         time.Time `json:"start_time"`
+	EndTime           time.Time `json:"end_time"`
+	AppointmentID     int64     `json:"appointment_id"`
+	PreviousStartTime time.Time `json:"previous_start_time"`
+}
+
+// only succeeds if the appointment is still scheduled at the time it was read at
+func (q *Queries) RescheduleAppointment(ctx context.Context, arg RescheduleAppointmentParams) (Appointment, error) {
+	row := q.db.QueryRowContext(ctx, rescheduleAppointment,
+		arg.StartTime,
+		arg.EndTime,
+		arg.AppointmentID,
+		arg.PreviousStartTime,
+	)
+	var i Appointment
+	err := row.Scan(
+		&i.AppointmentID,
+		&i.PatientID,
+		&i.DoctorID,
+		&i.CurrentStatus,
+		&i.Reason,
+		&i.Notes,
+		&i.StartTime,
+		&i.EndTime,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TimeRange,
+	)
+	return i, err
+}
+
+const transitionAppointmentStatus = `-- name: TransitionAppointmentStatus :execrows
+UPDATE appointments SET current_status = $1, updated_at = now()
+WHERE appointment_id = $2 AND current_status = $3
+`
+
+type TransitionAppointmentStatusParams struct {
+	ToStatus      AppointmentStatus `json:"to_status"`
 	AppointmentID int64             `json:"appointment_id"`
+	FromStatus    AppointmentStatus `json:"from_status"`
 }
 
-func (q *Queries) UpdateAppointmentStatus(ctx context.Context, arg UpdateAppointmentStatusParams) error {
-	_, err := q.db.ExecContext(ctx, updateAppointmentStatus, arg.CurrentStatus, arg.AppointmentID)
-	return err
+// only succeeds if the appointment is still in from_status
+func (q *Queries) TransitionAppointmentStatus(ctx context.Context, arg TransitionAppointmentStatusParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, transitionAppointmentStatus, arg.ToStatus, arg.AppointmentID, arg.FromStatus)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
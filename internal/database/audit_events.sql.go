@@ -0,0 +1,278 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: audit_events.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const createAuditEvent = `-- name: CreateAuditEvent :one
+INSERT INTO audit_events(
+  actor_user_id, actor_role, patient_id, resource_type, resource_id, action, request_id, client_ip, occurred_at, prev_hash, hash
+) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11) RETURNING event_id, actor_user_id, actor_role, patient_id, resource_type, resource_id, action, request_id, client_ip, occurred_at, prev_hash, hash
+`
+
+type CreateAuditEventParams struct {
+	ActorUserID  int64     `json:"actor_user_id"`
+	ActorRole    string    `json:"actor_role"`
+	PatientID    int64     `json:"patient_id"`
+	ResourceType string    `json:"resource_type"`
+	ResourceID   string    `json:"resource_id"`
+	Action       string    `json:"action"`
+	RequestID    string    `json:"request_id"`
+	ClientIp     string    `json:"client_ip"`
+	OccurredAt   time.Time `json:"occurred_at"`
+	PrevHash     string    `json:"prev_hash"`
+	Hash         string    `json:"hash"`
+}
+
+func (q *Queries) CreateAuditEvent(ctx context.Context, arg CreateAuditEventParams) (AuditEvent, error) {
+	row := q.db.QueryRowContext(ctx, createAuditEvent,
+		arg.ActorUserID,
+		arg.ActorRole,
+		arg.PatientID,
+		arg.ResourceType,
+		arg.ResourceID,
+		arg.Action,
+		arg.RequestID,
+		arg.ClientIp,
+		arg.OccurredAt,
+		arg.PrevHash,
+		arg.Hash,
+	)
+	var i AuditEvent
+	err := row.Scan(
+		&i.EventID,
+		&i.ActorUserID,
+		&i.ActorRole,
+		&i.PatientID,
+		&i.ResourceType,
+		&i.ResourceID,
+		&i.Action,
+		&i.RequestID,
+		&i.ClientIp,
+		&i.OccurredAt,
+		&i.PrevHash,
+		&i.Hash,
+	)
+	return i, err
+}
+
+const getAuditEventHash = `-- name: GetAuditEventHash :one
+SELECT hash FROM audit_events WHERE event_id=$1
+`
+
+func (q *Queries) GetAuditEventHash(ctx context.Context, eventID int64) (string, error) {
+	row := q.db.QueryRowContext(ctx, getAuditEventHash, eventID)
+	var hash string
+	err := row.Scan(&hash)
+	return hash, err
+}
+
+const getLastAuditEventHash = `-- name: GetLastAuditEventHash :one
+SELECT hash FROM audit_events ORDER BY event_id DESC LIMIT 1
+`
+
+func (q *Queries) GetLastAuditEventHash(ctx context.Context) (string, error) {
+	row := q.db.QueryRowContext(ctx, getLastAuditEventHash)
+	var hash string
+	err := row.Scan(&hash)
+	return hash, err
+}
+
+const listAuditChain = `-- name: ListAuditChain :many
+SELECT event_id, actor_user_id, actor_role, patient_id, resource_type, resource_id, action, request_id, client_ip, occurred_at, prev_hash, hash FROM audit_events WHERE event_id > $1 ORDER BY event_id LIMIT $2::int
+`
+
+type ListAuditChainParams struct {
+	AfterEventID int64 `json:"after_event_id"`
+	SetLimit     int32 `json:"set_limit"`
+}
+
+func (q *Queries) ListAuditChain(ctx context.Context, arg ListAuditChainParams) ([]AuditEvent, error) {
+	rows, err := q.db.QueryContext(ctx, listAuditChain, arg.AfterEventID, arg.SetLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditEvent
+	for rows.Next() {
+		var i AuditEvent
+		if err := rows.Scan(
+			&i.EventID,
+			&i.ActorUserID,
+			&i.ActorRole,
+			&i.PatientID,
+			&i.ResourceType,
+			&i.ResourceID,
+			&i.Action,
+			&i.RequestID,
+			&i.ClientIp,
+			&i.OccurredAt,
+			&i.PrevHash,
+			&i.Hash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAuditEvents = `-- name: ListAuditEvents :many
+SELECT event_id, actor_user_id, actor_role, patient_id, resource_type, resource_id, action, request_id, client_ip, occurred_at, prev_hash, hash FROM audit_events
+WHERE occurred_at >= $1 AND occurred_at < $2
+AND ($3::bigint = 0 OR patient_id = $3::bigint)
+AND ($4::bigint = 0 OR actor_user_id = $4::bigint)
+AND (TRIM($5::text) = '' OR resource_type = $5::text)
+AND (TRIM($6::text) = '' OR action = $6::text)
+ORDER BY event_id DESC
+LIMIT $8::int OFFSET $7::int
+`
+
+type ListAuditEventsParams struct {
+	OccurredAfter  time.Time `json:"occurred_after"`
+	OccurredBefore time.Time `json:"occurred_before"`
+	PatientID      int64     `json:"patient_id"`
+	ActorUserID    int64     `json:"actor_user_id"`
+	ResourceType   string    `json:"resource_type"`
+	Action         string    `json:"action"`
+	SetOffset      int32     `json:"set_offset"`
+	SetLimit       int32     `json:"set_limit"`
+}
+
+func (q *Queries) ListAuditEvents(ctx context.Context, arg ListAuditEventsParams) ([]AuditEvent, error) {
+	rows, err := q.db.QueryContext(ctx, listAuditEvents,
+		arg.OccurredAfter,
+		arg.OccurredBefore,
+		arg.PatientID,
+		arg.ActorUserID,
+		arg.ResourceType,
+		arg.Action,
+		arg.SetOffset,
+		arg.SetLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditEvent
+	for rows.Next() {
+		var i AuditEvent
+		if err := rows.Scan(
+			&i.EventID,
+			&i.ActorUserID,
+			&i.ActorRole,
+			&i.PatientID,
+			&i.ResourceType,
+			&i.ResourceID,
+			&i.Action,
+			&i.RequestID,
+			&i.ClientIp,
+			&i.OccurredAt,
+			&i.PrevHash,
+			&i.Hash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPatientRecordAccesses = `-- name: ListPatientRecordAccesses :many
+SELECT
+    e.event_id,
+    e.actor_user_id,
+    u.full_name AS actor_name,
+    e.actor_role,
+    e.resource_type,
+    e.action,
+    e.occurred_at
+FROM audit_events e
+LEFT JOIN users u ON u.user_id = e.actor_user_id
+WHERE e.patient_id = $1 AND e.actor_user_id <> $2
+ORDER BY e.event_id DESC
+LIMIT $4::int OFFSET $3::int
+`
+
+type ListPatientRecordAccessesParams struct {
+	PatientID     int64 `json:"patient_id"`
+	PatientUserID int64 `json:"patient_user_id"`
+	SetOffset     int32 `json:"set_offset"`
+	SetLimit      int32 `json:"set_limit"`
+}
+
+type ListPatientRecordAccessesRow struct {
+	EventID      int64          `json:"event_id"`
+	ActorUserID  int64          `json:"actor_user_id"`
+	ActorName    sql.NullString `json:"actor_name"`
+	ActorRole    string         `json:"actor_role"`
+	ResourceType string         `json:"resource_type"`
+	Action       string         `json:"action"`
+	OccurredAt   time.Time      `json:"occurred_at"`
+}
+
+// everyone other than the patient who touched the patient's record
+func (q *Queries) ListPatientRecordAccesses(ctx context.Context, arg ListPatientRecordAccessesParams) ([]ListPatientRecordAccessesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listPatientRecordAccesses,
+		arg.PatientID,
+		arg.PatientUserID,
+		arg.SetOffset,
+		arg.SetLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListPatientRecordAccessesRow
+	for rows.Next() {
+		var i ListPatientRecordAccessesRow
+		if err := rows.Scan(
+			&i.EventID,
+			&i.ActorUserID,
+			&i.ActorName,
+			&i.ActorRole,
+			&i.ResourceType,
+			&i.Action,
+			&i.OccurredAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockAuditChain = `-- name: LockAuditChain :exec
+SELECT pg_advisory_xact_lock(hashtext('audit_events'))
+`
+
+// serializes appends so that every event is chained to the one inserted right before it
+func (q *Queries) LockAuditChain(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, lockAuditChain)
+	return err
+}
@@ -78,48 +78,117 @@ func (q *Queries) DeleteAvailabityById(ctx context.Context, arg DeleteAvailabity
 }
 
 const getAppointmentSlots = `-- name: GetAppointmentSlots :many
-WITH time_slots AS (
-  SELECT 
+WITH params AS (
+  SELECT
+    $1::bigint AS doctor_id,
+    $2::date AS slot_date,
+    $3::timestamptz AS held_after
+),
+doctor AS (
+  SELECT
+    d.doctor_id,
+    d.timezone,
+    d.observes_public_holidays,
+    COALESCE(r.buffer_minutes, 0) AS buffer_minutes,
+    COALESCE(r.min_notice_minutes, 0) AS min_notice_minutes,
+    COALESCE(r.horizon_days, 0) AS horizon_days
+  FROM params, doctors d
+  LEFT JOIN booking_rules r ON r.doctor_id = d.doctor_id
+  WHERE d.doctor_id = params.doctor_id
+),
+time_slots AS (
+  SELECT
     a.doctor_id,
-    slot_time::time AS slot_start_time,
-    (slot_time + (a.interval_minutes * interval '1 minute'))::time AS slot_end_time
-  FROM availability a,
+    local_slot AT TIME ZONE doctor.timezone AS slot_start,
+    (local_slot AT TIME ZONE doctor.timezone) + (a.interval_minutes * interval '1 minute') AS slot_end
+  FROM params, doctor, availability a,
   LATERAL generate_series(
-    ($3::date + a.start_time)::timestamp,
-    ($3::date + a.end_time - (a.interval_minutes * interval '1 minute'))::timestamp,
+    (params.slot_date + a.start_time)::timestamp,
+    (params.slot_date + a.end_time - (a.interval_minutes * interval '1 minute'))::timestamp,
     (a.interval_minutes * interval '1 minute')
-  ) AS slot_time
-  WHERE a.doctor_id = $1
-  AND a.day_of_week = $2
+  ) AS local_slot
+  WHERE a.doctor_id = doctor.doctor_id
+  AND a.day_of_week = EXTRACT(DOW FROM params.slot_date)
+  -- the local time doesn't exist on the day the clocks go forward
+  AND ((local_slot AT TIME ZONE doctor.timezone) AT TIME ZONE doctor.timezone) = local_slot
+  AND NOT (
+    doctor.observes_public_holidays
+    AND EXISTS (SELECT 1 FROM public_holidays h WHERE h.holiday_date = params.slot_date)
+  )
+  UNION
+  SELECT
+    e.doctor_id,
+    slot_start,
+    slot_start + (e.interval_minutes * interval '1 minute') AS slot_end
+  FROM params, doctor, availability_exceptions e,
+  LATERAL generate_series(
+    e.starts_at,
+    e.ends_at - (e.interval_minutes * interval '1 minute'),
+    (e.interval_minutes * interval '1 minute')
+  ) AS slot_start
+  WHERE e.doctor_id = doctor.doctor_id
+  AND e.kind = 'extra'
+  AND (e.starts_at AT TIME ZONE doctor.timezone)::date = params.slot_date
 )
 SELECT
-  ts.slot_start_time,
-  ts.slot_end_time,
+  ts.slot_start::timestamptz AS slot_start,
+  ts.slot_end::timestamptz AS slot_end,
+  (ts.slot_start AT TIME ZONE doctor.timezone)::time AS slot_start_time,
+  (ts.slot_end AT TIME ZONE doctor.timezone)::time AS slot_end_time,
+  doctor.timezone,
   CASE 
-    WHEN appt.appointment_id IS NOT NULL THEN 'booked'
+    WHEN EXISTS (
+      SELECT 1 FROM appointments appt
+      WHERE appt.doctor_id = ts.doctor_id
+        AND appt.time_range && tstzrange(
+          ts.slot_start - doctor.buffer_minutes * interval '1 minute',
+          ts.slot_end + doctor.buffer_minutes * interval '1 minute',
+          '[)'
+        )
+        AND (
+          appt.current_status IN ('scheduled', 'in_progress')
+          OR (appt.current_status = 'pending_payment' AND appt.created_at > params.held_after)
+        )
+    ) THEN 'booked'
     ELSE 'available'
   END AS slot_status
-FROM time_slots ts
-LEFT JOIN appointments appt
-  ON appt.doctor_id = ts.doctor_id
-  AND appt.start_time::time = ts.slot_start_time
-  AND appt.start_time::date = $3::date
+FROM params, doctor, time_slots ts
+WHERE NOT EXISTS (
+  SELECT 1 FROM availability_exceptions b
+  WHERE b.doctor_id = ts.doctor_id
+    AND b.kind = 'block'
+    AND tstzrange(b.starts_at, b.ends_at, '[)') && tstzrange(ts.slot_start, ts.slot_end, '[)')
+)
+AND ts.slot_start >= now() + doctor.min_notice_minutes * interval '1 minute'
+AND (doctor.horizon_days = 0 OR ts.slot_start <= now() + doctor.horizon_days * interval '1 day')
+ORDER BY ts.slot_start
 `
 
 type GetAppointmentSlotsParams struct {
 	DoctorID  int64     `json:"doctor_id"`
-	DayOfWeek int32     `json:"day_of_week"`
-	Column3   time.Time `json:"column_3"`
+	SlotDate  time.Time `json:"slot_date"`
+	HeldAfter time.Time `json:"held_after"`
 }
 
 type GetAppointmentSlotsRow struct {
-	SlotStartTime string `json:"slot_start_time"`
-	SlotEndTime   string `json:"slot_end_time"`
-	SlotStatus    string `json:"slot_status"`
+	SlotStart     time.Time `json:"slot_start"`
+	SlotEnd       time.Time `json:"slot_end"`
+	SlotStartTime string    `json:"slot_start_time"`
+	SlotEndTime   string    `json:"slot_end_time"`
+	Timezone      string    `json:"timezone"`
+	SlotStatus    string    `json:"slot_status"`
 }
 
+// the slots are generated in the doctor's timezone , slot_date is a date on their calendar and the weekly windows are wall clock times
+// on it , local times that are skipped when the clocks go forward aren't offered and slots are as long as their interval even when
+// the clocks change during them
+// a slot is booked if it overlaps a scheduled appointment or an unpaid one created after the hold cutoff (a live hold) ,
+// the weekly windows are skipped on public holidays the doctor observes , extra hours added for the date are offered
+// and slots that fall in a block are left out
+// the doctor's booking rules apply , slots closer than the minimum notice or past the horizon are left out and a slot
+// is booked if an appointment is within the buffer of it
 func (q *Queries) GetAppointmentSlots(ctx context.Context, arg GetAppointmentSlotsParams) ([]GetAppointmentSlotsRow, error) {
-	rows, err := q.db.QueryContext(ctx, getAppointmentSlots, arg.DoctorID, arg.DayOfWeek, arg.Column3)
+	rows, err := q.db.QueryContext(ctx, getAppointmentSlots, arg.DoctorID, arg.SlotDate, arg.HeldAfter)
 	if err != nil {
 		return nil, err
 	}
@@ -127,7 +196,14 @@ func (q *Queries) GetAppointmentSlots(ctx context.Context, arg GetAppointmentSlo
 	var items []GetAppointmentSlotsRow
 	for rows.Next() {
 		var i GetAppointmentSlotsRow
-		if err := rows.Scan(&i.SlotStartTime, &i.SlotEndTime, &i.SlotStatus); err != nil {
+		if err := rows.Scan(
+			&i.SlotStart,
+			&i.SlotEnd,
+			&i.SlotStartTime,
+			&i.SlotEndTime,
+			&i.Timezone,
+			&i.SlotStatus,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -219,3 +295,212 @@ func (q *Queries) GetAvailabilityByDoctorAndDay(ctx context.Context, arg GetAvai
 	}
 	return items, nil
 }
+
+const searchAvailableSlots = `-- name: SearchAvailableSlots :many
+WITH params AS (
+  SELECT
+    $1::date AS from_date,
+    $2::date AS to_date,
+    $3::timestamptz AS held_after,
+    $4::integer AS slots_per_doctor
+),
+candidate_doctors AS (
+  SELECT
+    d.doctor_id,
+    d.timezone,
+    d.observes_public_holidays,
+    COALESCE(r.buffer_minutes, 0) AS buffer_minutes,
+    COALESCE(r.min_notice_minutes, 0) AS min_notice_minutes,
+    COALESCE(r.horizon_days, 0) AS horizon_days
+  FROM doctors d
+  LEFT JOIN booking_rules r ON r.doctor_id = d.doctor_id
+  WHERE d.verification_status = 'verified'
+    AND (TRIM($5::text) = '' OR d.county ILIKE '%' || $5::text || '%')
+    AND (TRIM($6::text) = '' OR d.specialization ILIKE '%' || $6::text || '%')
+    AND (NULLIF($7::text, '')::numeric IS NULL OR d.price_per_hour >= NULLIF($7::text, '')::numeric)
+    AND (NULLIF($8::text, '')::numeric IS NULL OR d.price_per_hour <= NULLIF($8::text, '')::numeric)
+    AND d.years_of_experience >= $9::int
+    AND d.years_of_experience <= $10::int
+),
+days AS (
+  SELECT day::date AS slot_date
+  FROM params, generate_series(params.from_date::timestamp, params.to_date::timestamp - interval '1 day', interval '1 day') AS day
+),
+time_slots AS (
+  SELECT
+    cd.doctor_id,
+    local_slot AT TIME ZONE cd.timezone AS slot_start,
+    (local_slot AT TIME ZONE cd.timezone) + (a.interval_minutes * interval '1 minute') AS slot_end
+  FROM candidate_doctors cd
+  JOIN availability a ON a.doctor_id = cd.doctor_id
+  JOIN days ON a.day_of_week = EXTRACT(DOW FROM days.slot_date),
+  LATERAL generate_series(
+    (days.slot_date + a.start_time)::timestamp,
+    (days.slot_date + a.end_time - (a.interval_minutes * interval '1 minute'))::timestamp,
+    (a.interval_minutes * interval '1 minute')
+  ) AS local_slot
+  WHERE ((local_slot AT TIME ZONE cd.timezone) AT TIME ZONE cd.timezone) = local_slot
+  AND NOT (
+    cd.observes_public_holidays
+    AND EXISTS (SELECT 1 FROM public_holidays h WHERE h.holiday_date = days.slot_date)
+  )
+  UNION
+  SELECT
+    cd.doctor_id,
+    slot_start,
+    slot_start + (e.interval_minutes * interval '1 minute') AS slot_end
+  FROM params, candidate_doctors cd
+  JOIN availability_exceptions e ON e.doctor_id = cd.doctor_id AND e.kind = 'extra',
+  LATERAL generate_series(
+    e.starts_at,
+    e.ends_at - (e.interval_minutes * interval '1 minute'),
+    (e.interval_minutes * interval '1 minute')
+  ) AS slot_start
+  WHERE (e.starts_at AT TIME ZONE cd.timezone)::date >= params.from_date
+  AND (e.starts_at AT TIME ZONE cd.timezone)::date < params.to_date
+),
+open_slots AS (
+  SELECT
+    ts.doctor_id,
+    ts.slot_start,
+    ts.slot_end,
+    ROW_NUMBER() OVER (PARTITION BY ts.doctor_id ORDER BY ts.slot_start) AS slot_rank
+  FROM params, time_slots ts
+  JOIN candidate_doctors cd ON cd.doctor_id = ts.doctor_id
+  WHERE ts.slot_start > now()
+    AND ts.slot_start >= now() + cd.min_notice_minutes * interval '1 minute'
+    AND (cd.horizon_days = 0 OR ts.slot_start <= now() + cd.horizon_days * interval '1 day')
+    AND NOT EXISTS (
+      SELECT 1 FROM availability_exceptions b
+      WHERE b.doctor_id = ts.doctor_id
+        AND b.kind = 'block'
+        AND tstzrange(b.starts_at, b.ends_at, '[)') && tstzrange(ts.slot_start, ts.slot_end, '[)')
+    )
+    AND NOT EXISTS (
+      SELECT 1 FROM appointments appt
+      WHERE appt.doctor_id = ts.doctor_id
+        AND appt.time_range && tstzrange(
+          ts.slot_start - cd.buffer_minutes * interval '1 minute',
+          ts.slot_end + cd.buffer_minutes * interval '1 minute',
+          '[)'
+        )
+        AND (
+          appt.current_status IN ('scheduled', 'in_progress')
+          OR (appt.current_status = 'pending_payment' AND appt.created_at > params.held_after)
+        )
+    )
+),
+page AS (
+  SELECT doctor_id, MIN(slot_start) AS first_slot
+  FROM open_slots
+  GROUP BY doctor_id
+  ORDER BY first_slot, doctor_id
+  LIMIT $12::int OFFSET $11::int
+)
+SELECT
+  d.doctor_id,
+  u.full_name,
+  d.specialization,
+  u.profile_image_url,
+  d.description,
+  d.county,
+  d.price_per_hour,
+  d.years_of_experience,
+  d.timezone,
+  os.slot_start::timestamptz AS slot_start,
+  os.slot_end::timestamptz AS slot_end,
+  (os.slot_start AT TIME ZONE d.timezone)::time AS slot_start_time,
+  (os.slot_end AT TIME ZONE d.timezone)::time AS slot_end_time
+FROM page
+JOIN open_slots os ON os.doctor_id = page.doctor_id
+JOIN doctors d ON d.doctor_id = page.doctor_id
+JOIN users u ON u.user_id = d.user_id
+CROSS JOIN params
+WHERE os.slot_rank <= params.slots_per_doctor
+ORDER BY page.first_slot, page.doctor_id, os.slot_start
+`
+
+type SearchAvailableSlotsParams struct {
+	FromDate          time.Time `json:"from_date"`
+	ToDate            time.Time `json:"to_date"`
+	HeldAfter         time.Time `json:"held_after"`
+	SlotsPerDoctor    int32     `json:"slots_per_doctor"`
+	SetCounty         string    `json:"set_county"`
+	SetSpecialization string    `json:"set_specialization"`
+	SetMinPrice       string    `json:"set_min_price"`
+	SetMaxPrice       string    `json:"set_max_price"`
+	SetMinExperience  int32     `json:"set_min_experience"`
+	SetMaxExperience  int32     `json:"set_max_experience"`
+	SetOffset         int32     `json:"set_offset"`
+	SetLimit          int32     `json:"set_limit"`
+}
+
+type SearchAvailableSlotsRow struct {
+	DoctorID          int64     `json:"doctor_id"`
+	FullName          string    `json:"full_name"`
+	Specialization    string    `json:"specialization"`
+	ProfileImageUrl   string    `json:"profile_image_url"`
+	Description       string    `json:"description"`
+	County            string    `json:"county"`
+	PricePerHour      string    `json:"price_per_hour"`
+	YearsOfExperience int32     `json:"years_of_experience"`
+	Timezone          string    `json:"timezone"`
+	SlotStart         time.Time `json:"slot_start"`
+	SlotEnd           time.Time `json:"slot_end"`
+	SlotStartTime     string    `json:"slot_start_time"`
+	SlotEndTime       string    `json:"slot_end_time"`
+}
+
+// the earliest open slots of the verified doctors that match the same filters as GetDoctors , [from_date, to_date) are dates
+// on each doctor's own calendar and the slots are generated the same way as in GetAppointmentSlots ,
+// the doctors are ordered by their first open slot and paginated , at most slots_per_doctor slots are returned for each of them ,
+// the booking rules of each doctor apply like in GetAppointmentSlots
+func (q *Queries) SearchAvailableSlots(ctx context.Context, arg SearchAvailableSlotsParams) ([]SearchAvailableSlotsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchAvailableSlots,
+		arg.FromDate,
+		arg.ToDate,
+		arg.HeldAfter,
+		arg.SlotsPerDoctor,
+		arg.SetCounty,
+		arg.SetSpecialization,
+		arg.SetMinPrice,
+		arg.SetMaxPrice,
+		arg.SetMinExperience,
+		arg.SetMaxExperience,
+		arg.SetOffset,
+		arg.SetLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchAvailableSlotsRow
+	for rows.Next() {
+		var i SearchAvailableSlotsRow
+		if err := rows.Scan(
+			&i.DoctorID,
+			&i.FullName,
+			&i.Specialization,
+			&i.ProfileImageUrl,
+			&i.Description,
+			&i.County,
+			&i.PricePerHour,
+			&i.YearsOfExperience,
+			&i.Timezone,
+			&i.SlotStart,
+			&i.SlotEnd,
+			&i.SlotStartTime,
+			&i.SlotEndTime,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,281 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: availability_exceptions.sql
+
+package database
+
+import (
+	"context"
+	"time"
+)
+
+const createAvailabilityException = `-- name: CreateAvailabilityException :one
+INSERT INTO availability_exceptions (
+  doctor_id, kind, starts_at, ends_at, interval_minutes, reason
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+) RETURNING exception_id, doctor_id, kind, starts_at, ends_at, interval_minutes, reason, created_at
+`
+
+type CreateAvailabilityExceptionParams struct {
+	DoctorID        int64                     `json:"doctor_id"`
+	Kind            AvailabilityExceptionKind `json:"kind"`
+	StartsAt        time.Time                 `json:"starts_at"`
+	EndsAt          time.Time                 `json:"ends_at"`
+	IntervalMinutes int32                     `json:"interval_minutes"`
+	Reason          string                    `json:"reason"`
+}
+
+func (q *Queries) CreateAvailabilityException(ctx context.Context, arg CreateAvailabilityExceptionParams) (AvailabilityException, error) {
+	row := q.db.QueryRowContext(ctx, createAvailabilityException,
+		arg.DoctorID,
+		arg.Kind,
+		arg.StartsAt,
+		arg.EndsAt,
+		arg.IntervalMinutes,
+		arg.Reason,
+	)
+	var i AvailabilityException
+	err := row.Scan(
+		&i.ExceptionID,
+		&i.DoctorID,
+		&i.Kind,
+		&i.StartsAt,
+		&i.EndsAt,
+		&i.IntervalMinutes,
+		&i.Reason,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteAvailabilityException = `-- name: DeleteAvailabilityException :execrows
+DELETE FROM availability_exceptions WHERE exception_id = $1 AND doctor_id = $2
+`
+
+type DeleteAvailabilityExceptionParams struct {
+	ExceptionID int64 `json:"exception_id"`
+	DoctorID    int64 `json:"doctor_id"`
+}
+
+func (q *Queries) DeleteAvailabilityException(ctx context.Context, arg DeleteAvailabilityExceptionParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteAvailabilityException, arg.ExceptionID, arg.DoctorID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const listAvailabilityExceptions = `-- name: ListAvailabilityExceptions :many
+SELECT exception_id, doctor_id, kind, starts_at, ends_at, interval_minutes, reason, created_at FROM availability_exceptions
+WHERE doctor_id = $1
+  AND starts_at < $2::timestamptz
+  AND ends_at > $3::timestamptz
+ORDER BY starts_at
+`
+
+type ListAvailabilityExceptionsParams struct {
+	DoctorID int64     `json:"doctor_id"`
+	ToTime   time.Time `json:"to_time"`
+	FromTime time.Time `json:"from_time"`
+}
+
+// the exceptions that overlap [from_time, to_time)
+func (q *Queries) ListAvailabilityExceptions(ctx context.Context, arg ListAvailabilityExceptionsParams) ([]AvailabilityException, error) {
+	rows, err := q.db.QueryContext(ctx, listAvailabilityExceptions, arg.DoctorID, arg.ToTime, arg.FromTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AvailabilityException
+	for rows.Next() {
+		var i AvailabilityException
+		if err := rows.Scan(
+			&i.ExceptionID,
+			&i.DoctorID,
+			&i.Kind,
+			&i.StartsAt,
+			&i.EndsAt,
+			&i.IntervalMinutes,
+			&i.Reason,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listBlockConflicts = `-- name: ListBlockConflicts :many
+SELECT appointment_id, start_time, end_time, current_status FROM appointments
+WHERE doctor_id = $1
+  AND time_range && tstzrange($2::timestamptz, $3::timestamptz, '[)')
+  AND (
+    current_status IN ('scheduled', 'in_progress')
+    OR (current_status = 'pending_payment' AND created_at > $4::timestamptz)
+  )
+ORDER BY start_time
+`
+
+type ListBlockConflictsParams struct {
+	DoctorID  int64     `json:"doctor_id"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	HeldAfter time.Time `json:"held_after"`
+}
+
+type ListBlockConflictsRow struct {
+	AppointmentID int64             `json:"appointment_id"`
+	StartTime     time.Time         `json:"start_time"`
+	EndTime       time.Time         `json:"end_time"`
+	CurrentStatus AppointmentStatus `json:"current_status"`
+}
+
+// the active appointments of a doctor that overlap [starts_at, ends_at) , unpaid ones only count while their hold is live
+func (q *Queries) ListBlockConflicts(ctx context.Context, arg ListBlockConflictsParams) ([]ListBlockConflictsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listBlockConflicts,
+		arg.DoctorID,
+		arg.StartsAt,
+		arg.EndsAt,
+		arg.HeldAfter,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListBlockConflictsRow
+	for rows.Next() {
+		var i ListBlockConflictsRow
+		if err := rows.Scan(
+			&i.AppointmentID,
+			&i.StartTime,
+			&i.EndTime,
+			&i.CurrentStatus,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listHolidayConflicts = `-- name: ListHolidayConflicts :many
+SELECT a.appointment_id, a.start_time, a.end_time, a.current_status FROM appointments a
+JOIN doctors d ON d.doctor_id = a.doctor_id
+JOIN public_holidays h ON h.holiday_date = (a.start_time AT TIME ZONE d.timezone)::date
+WHERE a.doctor_id = $1
+  AND a.start_time > now()
+  AND (
+    a.current_status IN ('scheduled', 'in_progress')
+    OR (a.current_status = 'pending_payment' AND a.created_at > $2::timestamptz)
+  )
+ORDER BY a.start_time
+`
+
+type ListHolidayConflictsParams struct {
+	DoctorID  int64     `json:"doctor_id"`
+	HeldAfter time.Time `json:"held_after"`
+}
+
+type ListHolidayConflictsRow struct {
+	AppointmentID int64             `json:"appointment_id"`
+	StartTime     time.Time         `json:"start_time"`
+	EndTime       time.Time         `json:"end_time"`
+	CurrentStatus AppointmentStatus `json:"current_status"`
+}
+
+// the upcoming active appointments of a doctor that fall on a public holiday in their timezone
+func (q *Queries) ListHolidayConflicts(ctx context.Context, arg ListHolidayConflictsParams) ([]ListHolidayConflictsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listHolidayConflicts, arg.DoctorID, arg.HeldAfter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListHolidayConflictsRow
+	for rows.Next() {
+		var i ListHolidayConflictsRow
+		if err := rows.Scan(
+			&i.AppointmentID,
+			&i.StartTime,
+			&i.EndTime,
+			&i.CurrentStatus,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPublicHolidays = `-- name: ListPublicHolidays :many
+SELECT holiday_date, name FROM public_holidays
+WHERE holiday_date >= $1::date AND holiday_date < $2::date
+ORDER BY holiday_date
+`
+
+type ListPublicHolidaysParams struct {
+	FromDate time.Time `json:"from_date"`
+	ToDate   time.Time `json:"to_date"`
+}
+
+// the holidays in [from_date, to_date)
+func (q *Queries) ListPublicHolidays(ctx context.Context, arg ListPublicHolidaysParams) ([]PublicHoliday, error) {
+	rows, err := q.db.QueryContext(ctx, listPublicHolidays, arg.FromDate, arg.ToDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PublicHoliday
+	for rows.Next() {
+		var i PublicHoliday
+		if err := rows.Scan(&i.HolidayDate, &i.Name); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setObservesPublicHolidays = `-- name: SetObservesPublicHolidays :one
+UPDATE doctors SET observes_public_holidays = $1, updated_at = now()
+WHERE doctor_id = $2
+RETURNING observes_public_holidays
+`
+
+type SetObservesPublicHolidaysParams struct {
+	ObservesPublicHolidays bool  `json:"observes_public_holidays"`
+	DoctorID               int64 `json:"doctor_id"`
+}
+
+func (q *Queries) SetObservesPublicHolidays(ctx context.Context, arg SetObservesPublicHolidaysParams) (bool, error) {
+	row := q.db.QueryRowContext(ctx, setObservesPublicHolidays, arg.ObservesPublicHolidays, arg.DoctorID)
+	var observes_public_holidays bool
+	err := row.Scan(&observes_public_holidays)
+	return observes_public_holidays, err
+}
@@ -0,0 +1,66 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: booking_rules.sql
+
+package database
+
+import (
+	"context"
+)
+
+const getBookingRules = `-- name: GetBookingRules :one
+SELECT doctor_id, buffer_minutes, min_notice_minutes, horizon_days, updated_at FROM booking_rules WHERE doctor_id = $1
+`
+
+func (q *Queries) GetBookingRules(ctx context.Context, doctorID int64) (BookingRule, error) {
+	row := q.db.QueryRowContext(ctx, getBookingRules, doctorID)
+	var i BookingRule
+	err := row.Scan(
+		&i.DoctorID,
+		&i.BufferMinutes,
+		&i.MinNoticeMinutes,
+		&i.HorizonDays,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const upsertBookingRules = `-- name: UpsertBookingRules :one
+INSERT INTO booking_rules (
+  doctor_id, buffer_minutes, min_notice_minutes, horizon_days
+) VALUES (
+  $1, $2, $3, $4
+)
+ON CONFLICT (doctor_id) DO UPDATE SET
+  buffer_minutes = EXCLUDED.buffer_minutes,
+  min_notice_minutes = EXCLUDED.min_notice_minutes,
+  horizon_days = EXCLUDED.horizon_days,
+  updated_at = now()
+RETURNING doctor_id, buffer_minutes, min_notice_minutes, horizon_days, updated_at
+`
+
+type UpsertBookingRulesParams struct {
+	DoctorID         int64 `json:"doctor_id"`
+	BufferMinutes    int32 `json:"buffer_minutes"`
+	MinNoticeMinutes int32 `json:"min_notice_minutes"`
+	HorizonDays      int32 `json:"horizon_days"`
+}
+
+func (q *Queries) UpsertBookingRules(ctx context.Context, arg UpsertBookingRulesParams) (BookingRule, error) {
+	row := q.db.QueryRowContext(ctx, upsertBookingRules,
+		arg.DoctorID,
+		arg.BufferMinutes,
+		arg.MinNoticeMinutes,
+		arg.HorizonDays,
+	)
+	var i BookingRule
+	err := row.Scan(
+		&i.DoctorID,
+		&i.BufferMinutes,
+		&i.MinNoticeMinutes,
+		&i.HorizonDays,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
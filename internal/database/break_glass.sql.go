@@ -0,0 +1,197 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: break_glass.sql
+
+package database
+
+import (
+	"context"
+	"time"
+)
+
+const createBreakGlassGrant = `-- name: CreateBreakGlassGrant :one
+INSERT INTO break_glass_grants(doctor_id, patient_id, reason, expires_at) VALUES ($1,$2,$3,$4) RETURNING grant_id, doctor_id, patient_id, reason, expires_at, created_at
+`
+
+type CreateBreakGlassGrantParams struct {
+	DoctorID  int64     `json:"doctor_id"`
+	PatientID int64     `json:"patient_id"`
+	Reason    string    `json:"reason"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (q *Queries) CreateBreakGlassGrant(ctx context.Context, arg CreateBreakGlassGrantParams) (BreakGlassGrant, error) {
+	row := q.db.QueryRowContext(ctx, createBreakGlassGrant,
+		arg.DoctorID,
+		arg.PatientID,
+		arg.Reason,
+		arg.ExpiresAt,
+	)
+	var i BreakGlassGrant
+	err := row.Scan(
+		&i.GrantID,
+		&i.DoctorID,
+		&i.PatientID,
+		&i.Reason,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getActiveBreakGlassGrant = `-- name: GetActiveBreakGlassGrant :one
+SELECT grant_id, doctor_id, patient_id, reason, expires_at, created_at FROM break_glass_grants
+WHERE doctor_id=$1 AND patient_id=$2 AND expires_at > now()
+ORDER BY expires_at DESC
+LIMIT 1
+`
+
+type GetActiveBreakGlassGrantParams struct {
+	DoctorID  int64 `json:"doctor_id"`
+	PatientID int64 `json:"patient_id"`
+}
+
+func (q *Queries) GetActiveBreakGlassGrant(ctx context.Context, arg GetActiveBreakGlassGrantParams) (BreakGlassGrant, error) {
+	row := q.db.QueryRowContext(ctx, getActiveBreakGlassGrant, arg.DoctorID, arg.PatientID)
+	var i BreakGlassGrant
+	err := row.Scan(
+		&i.GrantID,
+		&i.DoctorID,
+		&i.PatientID,
+		&i.Reason,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listBreakGlassAccesses = `-- name: ListBreakGlassAccesses :many
+SELECT access_id, grant_id, resource, accessed_at FROM break_glass_accesses WHERE grant_id=$1 ORDER BY accessed_at
+`
+
+func (q *Queries) ListBreakGlassAccesses(ctx context.Context, grantID int64) ([]BreakGlassAccess, error) {
+	rows, err := q.db.QueryContext(ctx, listBreakGlassAccesses, grantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []BreakGlassAccess
+	for rows.Next() {
+		var i BreakGlassAccess
+		if err := rows.Scan(
+			&i.AccessID,
+			&i.GrantID,
+			&i.Resource,
+			&i.AccessedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listBreakGlassGrants = `-- name: ListBreakGlassGrants :many
+SELECT
+    g.grant_id,
+    g.doctor_id,
+    du.full_name AS doctor_name,
+    g.patient_id,
+    pu.full_name AS patient_name,
+    g.reason,
+    g.expires_at,
+    g.created_at,
+    (SELECT COUNT(*) FROM break_glass_accesses a WHERE a.grant_id = g.grant_id) AS access_count
+FROM break_glass_grants g
+JOIN doctors d ON d.doctor_id = g.doctor_id
+JOIN users du ON du.user_id = d.user_id
+JOIN patients p ON p.patient_id = g.patient_id
+JOIN users pu ON pu.user_id = p.user_id
+WHERE g.created_at >= $1 AND g.created_at < $2
+AND ($3::bigint = 0 OR g.patient_id = $3::bigint)
+AND ($4::bigint = 0 OR g.doctor_id = $4::bigint)
+ORDER BY g.created_at DESC
+LIMIT $6::int OFFSET $5::int
+`
+
+type ListBreakGlassGrantsParams struct {
+	CreatedAfter  time.Time `json:"created_after"`
+	CreatedBefore time.Time `json:"created_before"`
+	PatientID     int64     `json:"patient_id"`
+	DoctorID      int64     `json:"doctor_id"`
+	SetOffset     int32     `json:"set_offset"`
+	SetLimit      int32     `json:"set_limit"`
+}
+
+type ListBreakGlassGrantsRow struct {
+	GrantID     int64     `json:"grant_id"`
+	DoctorID    int64     `json:"doctor_id"`
+	DoctorName  string    `json:"doctor_name"`
+	PatientID   int64     `json:"patient_id"`
+	PatientName string    `json:"patient_name"`
+	Reason      string    `json:"reason"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+	AccessCount int64     `json:"access_count"`
+}
+
+func (q *Queries) ListBreakGlassGrants(ctx context.Context, arg ListBreakGlassGrantsParams) ([]ListBreakGlassGrantsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listBreakGlassGrants,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.PatientID,
+		arg.DoctorID,
+		arg.SetOffset,
+		arg.SetLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListBreakGlassGrantsRow
+	for rows.Next() {
+		var i ListBreakGlassGrantsRow
+		if err := rows.Scan(
+			&i.GrantID,
+			&i.DoctorID,
+			&i.DoctorName,
+			&i.PatientID,
+			&i.PatientName,
+			&i.Reason,
+			&i.ExpiresAt,
+			&i.CreatedAt,
+			&i.AccessCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const recordBreakGlassAccess = `-- name: RecordBreakGlassAccess :exec
+INSERT INTO break_glass_accesses(grant_id, resource) VALUES ($1,$2)
+`
+
+type RecordBreakGlassAccessParams struct {
+	GrantID  int64  `json:"grant_id"`
+	Resource string `json:"resource"`
+}
+
+func (q *Queries) RecordBreakGlassAccess(ctx context.Context, arg RecordBreakGlassAccessParams) error {
+	_, err := q.db.ExecContext(ctx, recordBreakGlassAccess, arg.GrantID, arg.Resource)
+	return err
+}
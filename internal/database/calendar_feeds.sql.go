@@ -0,0 +1,58 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: calendar_feeds.sql
+
+package database
+
+import (
+	"context"
+)
+
+const deleteCalendarFeed = `-- name: DeleteCalendarFeed :execrows
+DELETE FROM calendar_feeds WHERE user_id = $1
+`
+
+func (q *Queries) DeleteCalendarFeed(ctx context.Context, userID int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteCalendarFeed, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getCalendarFeedOwner = `-- name: GetCalendarFeedOwner :one
+SELECT u.user_id, u.user_role FROM calendar_feeds f
+JOIN users u ON u.user_id = f.user_id
+WHERE f.token_hash = $1
+`
+
+type GetCalendarFeedOwnerRow struct {
+	UserID   int64 `json:"user_id"`
+	UserRole Role  `json:"user_role"`
+}
+
+func (q *Queries) GetCalendarFeedOwner(ctx context.Context, tokenHash string) (GetCalendarFeedOwnerRow, error) {
+	row := q.db.QueryRowContext(ctx, getCalendarFeedOwner, tokenHash)
+	var i GetCalendarFeedOwnerRow
+	err := row.Scan(&i.UserID, &i.UserRole)
+	return i, err
+}
+
+const upsertCalendarFeed = `-- name: UpsertCalendarFeed :one
+INSERT INTO calendar_feeds (user_id, token_hash) VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE SET token_hash = EXCLUDED.token_hash, created_at = now()
+RETURNING user_id, token_hash, created_at
+`
+
+type UpsertCalendarFeedParams struct {
+	UserID    int64  `json:"user_id"`
+	TokenHash string `json:"token_hash"`
+}
+
+func (q *Queries) UpsertCalendarFeed(ctx context.Context, arg UpsertCalendarFeedParams) (CalendarFeed, error) {
+	row := q.db.QueryRowContext(ctx, upsertCalendarFeed, arg.UserID, arg.TokenHash)
+	var i CalendarFeed
+	err := row.Scan(&i.UserID, &i.TokenHash, &i.CreatedAt)
+	return i, err
+}
@@ -0,0 +1,308 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: doctor_payouts.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const getDoctorEarningsSummary = `-- name: GetDoctorEarningsSummary :one
+SELECT
+  COALESCE(SUM(gross_amount), 0)::numeric(12,2)::text AS gross_amount,
+  COALESCE(SUM(commission), 0)::numeric(12,2)::text AS commission,
+  COALESCE(SUM(net_amount), 0)::numeric(12,2)::text AS net_amount,
+  COALESCE(SUM(net_amount) FILTER (WHERE settled_by_provider), 0)::numeric(12,2)::text AS settled_amount,
+  COALESCE(SUM(net_amount) FILTER (WHERE NOT settled_by_provider), 0)::numeric(12,2)::text AS owed_amount
+FROM doctor_earnings
+WHERE doctor_id = $1
+  AND created_at >= $2
+  AND created_at < $3
+`
+
+type GetDoctorEarningsSummaryParams struct {
+	DoctorID    int64     `json:"doctor_id"`
+	CreatedFrom time.Time `json:"created_from"`
+	CreatedTo   time.Time `json:"created_to"`
+}
+
+type GetDoctorEarningsSummaryRow struct {
+	GrossAmount   string `json:"gross_amount"`
+	Commission    string `json:"commission"`
+	NetAmount     string `json:"net_amount"`
+	SettledAmount string `json:"settled_amount"`
+	OwedAmount    string `json:"owed_amount"`
+}
+
+func (q *Queries) GetDoctorEarningsSummary(ctx context.Context, arg GetDoctorEarningsSummaryParams) (GetDoctorEarningsSummaryRow, error) {
+	row := q.db.QueryRowContext(ctx, getDoctorEarningsSummary, arg.DoctorID, arg.CreatedFrom, arg.CreatedTo)
+	var i GetDoctorEarningsSummaryRow
+	err := row.Scan(
+		&i.GrossAmount,
+		&i.Commission,
+		&i.NetAmount,
+		&i.SettledAmount,
+		&i.OwedAmount,
+	)
+	return i, err
+}
+
+const getDoctorPayoutAccount = `-- name: GetDoctorPayoutAccount :one
+SELECT doctor_id, subaccount_code, business_name, bank_code, settlement_bank, account_number_last4, created_at, updated_at FROM doctor_payout_accounts WHERE doctor_id = $1
+`
+
+func (q *Queries) GetDoctorPayoutAccount(ctx context.Context, doctorID int64) (DoctorPayoutAccount, error) {
+	row := q.db.QueryRowContext(ctx, getDoctorPayoutAccount, doctorID)
+	var i DoctorPayoutAccount
+	err := row.Scan(
+		&i.DoctorID,
+		&i.SubaccountCode,
+		&i.BusinessName,
+		&i.BankCode,
+		&i.SettlementBank,
+		&i.AccountNumberLast4,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const listDoctorEarnings = `-- name: ListDoctorEarnings :many
+SELECT entry_id, doctor_id, payment_id, appointment_id, refund_id, entry_type, gross_amount, commission, net_amount, currency, settled_by_provider, created_at FROM doctor_earnings
+WHERE doctor_id = $1
+  AND created_at >= $2
+  AND created_at < $3
+ORDER BY created_at DESC, entry_id DESC
+LIMIT $5 OFFSET $4
+`
+
+type ListDoctorEarningsParams struct {
+	DoctorID    int64     `json:"doctor_id"`
+	CreatedFrom time.Time `json:"created_from"`
+	CreatedTo   time.Time `json:"created_to"`
+	SetOffset   int32     `json:"set_offset"`
+	SetLimit    int32     `json:"set_limit"`
+}
+
+func (q *Queries) ListDoctorEarnings(ctx context.Context, arg ListDoctorEarningsParams) ([]DoctorEarning, error) {
+	rows, err := q.db.QueryContext(ctx, listDoctorEarnings,
+		arg.DoctorID,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.SetOffset,
+		arg.SetLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DoctorEarning
+	for rows.Next() {
+		var i DoctorEarning
+		if err := rows.Scan(
+			&i.EntryID,
+			&i.DoctorID,
+			&i.PaymentID,
+			&i.AppointmentID,
+			&i.RefundID,
+			&i.EntryType,
+			&i.GrossAmount,
+			&i.Commission,
+			&i.NetAmount,
+			&i.Currency,
+			&i.SettledByProvider,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDoctorPayouts = `-- name: ListDoctorPayouts :many
+SELECT
+  e.doctor_id,
+  u.full_name,
+  COALESCE(a.subaccount_code, '')::text AS subaccount_code,
+  COUNT(*) FILTER (WHERE e.entry_type = 'earning') AS payments,
+  COALESCE(SUM(e.gross_amount), 0)::numeric(12,2)::text AS gross_amount,
+  COALESCE(SUM(e.commission), 0)::numeric(12,2)::text AS commission,
+  COALESCE(SUM(e.net_amount), 0)::numeric(12,2)::text AS net_amount,
+  COALESCE(SUM(e.net_amount) FILTER (WHERE e.settled_by_provider), 0)::numeric(12,2)::text AS settled_amount,
+  COALESCE(SUM(e.net_amount) FILTER (WHERE NOT e.settled_by_provider), 0)::numeric(12,2)::text AS owed_amount
+FROM doctor_earnings e
+JOIN doctors d ON d.doctor_id = e.doctor_id
+JOIN users u ON u.user_id = d.user_id
+LEFT JOIN doctor_payout_accounts a ON a.doctor_id = e.doctor_id
+WHERE e.created_at >= $1
+  AND e.created_at < $2
+GROUP BY e.doctor_id, u.full_name, a.subaccount_code
+ORDER BY SUM(e.net_amount) FILTER (WHERE NOT e.settled_by_provider) DESC NULLS LAST, e.doctor_id
+LIMIT $4 OFFSET $3
+`
+
+type ListDoctorPayoutsParams struct {
+	CreatedFrom time.Time `json:"created_from"`
+	CreatedTo   time.Time `json:"created_to"`
+	SetOffset   int32     `json:"set_offset"`
+	SetLimit    int32     `json:"set_limit"`
+}
+
+type ListDoctorPayoutsRow struct {
+	DoctorID       int64  `json:"doctor_id"`
+	FullName       string `json:"full_name"`
+	SubaccountCode string `json:"subaccount_code"`
+	Payments       int64  `json:"payments"`
+	GrossAmount    string `json:"gross_amount"`
+	Commission     string `json:"commission"`
+	NetAmount      string `json:"net_amount"`
+	SettledAmount  string `json:"settled_amount"`
+	OwedAmount     string `json:"owed_amount"`
+}
+
+// what each doctor earned over the period , owed_amount is what the platform still has to pay out because it collected the payment itself
+func (q *Queries) ListDoctorPayouts(ctx context.Context, arg ListDoctorPayoutsParams) ([]ListDoctorPayoutsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listDoctorPayouts,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.SetOffset,
+		arg.SetLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListDoctorPayoutsRow
+	for rows.Next() {
+		var i ListDoctorPayoutsRow
+		if err := rows.Scan(
+			&i.DoctorID,
+			&i.FullName,
+			&i.SubaccountCode,
+			&i.Payments,
+			&i.GrossAmount,
+			&i.Commission,
+			&i.NetAmount,
+			&i.SettledAmount,
+			&i.OwedAmount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const recordPaymentEarning = `-- name: RecordPaymentEarning :exec
+INSERT INTO doctor_earnings (doctor_id, payment_id, appointment_id, entry_type, gross_amount, commission, net_amount, currency, settled_by_provider)
+SELECT p.doctor_id, p.payment_id, p.appointment_id, 'earning', p.amount, p.amount - p.consultation_fee, p.consultation_fee, p.currency, p.subaccount_code <> ''
+FROM payments p WHERE p.payment_id = $1
+ON CONFLICT DO NOTHING
+`
+
+// the doctor's share is the consultation fee , the platform keeps its fee and the tax
+func (q *Queries) RecordPaymentEarning(ctx context.Context, paymentID int64) error {
+	_, err := q.db.ExecContext(ctx, recordPaymentEarning, paymentID)
+	return err
+}
+
+const recordRefundEarning = `-- name: RecordRefundEarning :exec
+INSERT INTO doctor_earnings (doctor_id, payment_id, appointment_id, refund_id, entry_type, gross_amount, commission, net_amount, currency, settled_by_provider)
+SELECT p.doctor_id, p.payment_id, r.appointment_id, r.refund_id, 'refund', -r.amount,
+  -(r.amount - ROUND(r.amount * p.consultation_fee / p.amount, 2)),
+  -ROUND(r.amount * p.consultation_fee / p.amount, 2),
+  r.currency, p.subaccount_code <> ''
+FROM refunds r JOIN payments p ON p.payment_id = r.payment_id
+WHERE r.refund_id = $1 AND p.amount > 0
+ON CONFLICT DO NOTHING
+`
+
+// the refund comes out of the doctor's share and the commission in the same proportion they were paid in
+func (q *Queries) RecordRefundEarning(ctx context.Context, refundID int64) error {
+	_, err := q.db.ExecContext(ctx, recordRefundEarning, refundID)
+	return err
+}
+
+const reverseRefundEarning = `-- name: ReverseRefundEarning :exec
+INSERT INTO doctor_earnings (doctor_id, payment_id, appointment_id, refund_id, entry_type, gross_amount, commission, net_amount, currency, settled_by_provider)
+SELECT e.doctor_id, e.payment_id, e.appointment_id, e.refund_id, 'refund_reversal', -e.gross_amount, -e.commission, -e.net_amount, e.currency, e.settled_by_provider
+FROM doctor_earnings e
+WHERE e.refund_id = $1 AND e.entry_type = 'refund'
+ON CONFLICT DO NOTHING
+`
+
+// a failed refund gives the doctor their share back
+func (q *Queries) ReverseRefundEarning(ctx context.Context, refundID sql.NullInt64) error {
+	_, err := q.db.ExecContext(ctx, reverseRefundEarning, refundID)
+	return err
+}
+
+const upsertDoctorPayoutAccount = `-- name: UpsertDoctorPayoutAccount :one
+INSERT INTO doctor_payout_accounts (
+  doctor_id,
+  subaccount_code,
+  business_name,
+  bank_code,
+  settlement_bank,
+  account_number_last4
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+ON CONFLICT (doctor_id) DO UPDATE SET
+  subaccount_code = EXCLUDED.subaccount_code,
+  business_name = EXCLUDED.business_name,
+  bank_code = EXCLUDED.bank_code,
+  settlement_bank = EXCLUDED.settlement_bank,
+  account_number_last4 = EXCLUDED.account_number_last4,
+  updated_at = now()
+RETURNING doctor_id, subaccount_code, business_name, bank_code, settlement_bank, account_number_last4, created_at, updated_at
+`
+
+type UpsertDoctorPayoutAccountParams struct {
+	DoctorID           int64  `json:"doctor_id"`
+	SubaccountCode     string `json:"subaccount_code"`
+	BusinessName       string `json:"business_name"`
+	BankCode           string `json:"bank_code"`
+	SettlementBank     string `json:"settlement_bank"`
+	AccountNumberLast4 string `json:"account_number_last4"`
+}
+
+func (q *Queries) UpsertDoctorPayoutAccount(ctx context.Context, arg UpsertDoctorPayoutAccountParams) (DoctorPayoutAccount, error) {
+	row := q.db.QueryRowContext(ctx, upsertDoctorPayoutAccount,
+		arg.DoctorID,
+		arg.SubaccountCode,
+		arg.BusinessName,
+		arg.BankCode,
+		arg.SettlementBank,
+		arg.AccountNumberLast4,
+	)
+	var i DoctorPayoutAccount
+	err := row.Scan(
+		&i.DoctorID,
+		&i.SubaccountCode,
+		&i.BusinessName,
+		&i.BankCode,
+		&i.SettlementBank,
+		&i.AccountNumberLast4,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,304 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: doctor_verification.sql
+
+package database
+
+import (
+	"context"
+	"time"
+)
+
+const createDoctorLicenseDocument = `-- name: CreateDoctorLicenseDocument :one
+INSERT INTO doctor_license_documents(doctor_id, file_url, file_name, content_type) VALUES ($1,$2,$3,$4) RETURNING document_id, doctor_id, file_url, file_name, content_type, uploaded_at
+`
+
+type CreateDoctorLicenseDocumentParams struct {
+	DoctorID    int64  `json:"doctor_id"`
+	FileUrl     string `json:"file_url"`
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+}
+
+func (q *Queries) CreateDoctorLicenseDocument(ctx context.Context, arg CreateDoctorLicenseDocumentParams) (DoctorLicenseDocument, error) {
+	row := q.db.QueryRowContext(ctx, createDoctorLicenseDocument,
+		arg.DoctorID,
+		arg.FileUrl,
+		arg.FileName,
+		arg.ContentType,
+	)
+	var i DoctorLicenseDocument
+	err := row.Scan(
+		&i.DocumentID,
+		&i.DoctorID,
+		&i.FileUrl,
+		&i.FileName,
+		&i.ContentType,
+		&i.UploadedAt,
+	)
+	return i, err
+}
+
+const createDoctorVerificationEvent = `-- name: CreateDoctorVerificationEvent :exec
+INSERT INTO doctor_verification_events(doctor_id, from_status, to_status, reason, changed_by) VALUES ($1,$2,$3,$4,$5)
+`
+
+type CreateDoctorVerificationEventParams struct {
+	DoctorID   int64              `json:"doctor_id"`
+	FromStatus VerificationStatus `json:"from_status"`
+	ToStatus   VerificationStatus `json:"to_status"`
+	Reason     string             `json:"reason"`
+	ChangedBy  int64              `json:"changed_by"`
+}
+
+func (q *Queries) CreateDoctorVerificationEvent(ctx context.Context, arg CreateDoctorVerificationEventParams) error {
+	_, err := q.db.ExecContext(ctx, createDoctorVerificationEvent,
+		arg.DoctorID,
+		arg.FromStatus,
+		arg.ToStatus,
+		arg.Reason,
+		arg.ChangedBy,
+	)
+	return err
+}
+
+const getDoctorById = `-- name: GetDoctorById :one
+SELECT doctor_id, user_id, description, specialization, years_of_experience, county, price_per_hour, license_number, created_at, updated_at, verification_status, verification_reason, verified_at, observes_public_holidays, timezone FROM doctors WHERE doctor_id=$1
+`
+
+func (q *Queries) GetDoctorById(ctx context.Context, doctorID int64) (Doctor, error) {
+	row := q.db.QueryRowContext(ctx, getDoctorById, doctorID)
+	var i Doctor
+	err := row.Scan(
+		&i.DoctorID,
+		&i.UserID,
+		&i.Description,
+		&i.Specialization,
+		&i.YearsOfExperience,
+		&i.County,
+		&i.PricePerHour,
+		&i.LicenseNumber,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.VerificationStatus,
+		&i.VerificationReason,
+		&i.VerifiedAt,
+		&i.ObservesPublicHolidays,
+		&i.Timezone,
+	)
+	return i, err
+}
+
+const getDoctorByUserId = `-- name: GetDoctorByUserId :one
+SELECT doctor_id, user_id, description, specialization, years_of_experience, county, price_per_hour, license_number, created_at, updated_at, verification_status, verification_reason, verified_at, observes_public_holidays, timezone FROM doctors WHERE user_id=$1
+`
+
+func (q *Queries) GetDoctorByUserId(ctx context.Context, userID int64) (Doctor, error) {
+	row := q.db.QueryRowContext(ctx, getDoctorByUserId, userID)
+	var i Doctor
+	err := row.Scan(
+		&i.DoctorID,
+		&i.UserID,
+		&i.Description,
+		&i.Specialization,
+		&i.YearsOfExperience,
+		&i.County,
+		&i.PricePerHour,
+		&i.LicenseNumber,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.VerificationStatus,
+		&i.VerificationReason,
+		&i.VerifiedAt,
+		&i.ObservesPublicHolidays,
+		&i.Timezone,
+	)
+	return i, err
+}
+
+const listDoctorLicenseDocuments = `-- name: ListDoctorLicenseDocuments :many
+SELECT document_id, doctor_id, file_url, file_name, content_type, uploaded_at FROM doctor_license_documents WHERE doctor_id=$1 ORDER BY uploaded_at DESC
+`
+
+func (q *Queries) ListDoctorLicenseDocuments(ctx context.Context, doctorID int64) ([]DoctorLicenseDocument, error) {
+	rows, err := q.db.QueryContext(ctx, listDoctorLicenseDocuments, doctorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DoctorLicenseDocument
+	for rows.Next() {
+		var i DoctorLicenseDocument
+		if err := rows.Scan(
+			&i.DocumentID,
+			&i.DoctorID,
+			&i.FileUrl,
+			&i.FileName,
+			&i.ContentType,
+			&i.UploadedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDoctorVerificationEvents = `-- name: ListDoctorVerificationEvents :many
+SELECT event_id, doctor_id, from_status, to_status, reason, changed_by, created_at FROM doctor_verification_events WHERE doctor_id=$1 ORDER BY created_at DESC, event_id DESC
+`
+
+func (q *Queries) ListDoctorVerificationEvents(ctx context.Context, doctorID int64) ([]DoctorVerificationEvent, error) {
+	rows, err := q.db.QueryContext(ctx, listDoctorVerificationEvents, doctorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DoctorVerificationEvent
+	for rows.Next() {
+		var i DoctorVerificationEvent
+		if err := rows.Scan(
+			&i.EventID,
+			&i.DoctorID,
+			&i.FromStatus,
+			&i.ToStatus,
+			&i.Reason,
+			&i.ChangedBy,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDoctorsByVerificationStatus = `-- name: ListDoctorsByVerificationStatus :many
+SELECT
+    doctors.doctor_id,
+    doctors.user_id,
+    users.full_name,
+    users.email,
+    doctors.specialization,
+    doctors.license_number,
+    doctors.verification_status,
+    doctors.verification_reason,
+    doctors.created_at,
+    (SELECT COUNT(*) FROM doctor_license_documents d WHERE d.doctor_id = doctors.doctor_id) AS document_count
+FROM doctors
+INNER JOIN users ON doctors.user_id = users.user_id
+WHERE doctors.verification_status = $1
+ORDER BY doctors.created_at ASC
+LIMIT $3::int OFFSET $2::int
+`
+
+type ListDoctorsByVerificationStatusParams struct {
+	Status    VerificationStatus `json:"status"`
+	SetOffset int32              `json:"set_offset"`
+	SetLimit  int32              `json:"set_limit"`
+}
+
+type ListDoctorsByVerificationStatusRow struct {
+	DoctorID           int64              `json:"doctor_id"`
+	UserID             int64              `json:"user_id"`
+	FullName           string             `json:"full_name"`
+	Email              string             `json:"email"`
+	Specialization     string             `json:"specialization"`
+	LicenseNumber      string             `json:"license_number"`
+	VerificationStatus VerificationStatus `json:"verification_status"`
+	VerificationReason string             `json:"verification_reason"`
+	CreatedAt          time.Time          `json:"created_at"`
+	DocumentCount      int64              `json:"document_count"`
+}
+
+// the review queue , oldest first so doctors are reviewed in the order they signed up
+func (q *Queries) ListDoctorsByVerificationStatus(ctx context.Context, arg ListDoctorsByVerificationStatusParams) ([]ListDoctorsByVerificationStatusRow, error) {
+	rows, err := q.db.QueryContext(ctx, listDoctorsByVerificationStatus, arg.Status, arg.SetOffset, arg.SetLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListDoctorsByVerificationStatusRow
+	for rows.Next() {
+		var i ListDoctorsByVerificationStatusRow
+		if err := rows.Scan(
+			&i.DoctorID,
+			&i.UserID,
+			&i.FullName,
+			&i.Email,
+			&i.Specialization,
+			&i.LicenseNumber,
+			&i.VerificationStatus,
+			&i.VerificationReason,
+			&i.CreatedAt,
+			&i.DocumentCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateDoctorVerificationStatus = `-- name: UpdateDoctorVerificationStatus :one
+UPDATE doctors SET verification_status = $1, verification_reason = $2,
+verified_at = CASE WHEN $1 = 'verified' THEN now() ELSE verified_at END,
+updated_at = now()
+WHERE doctor_id = $3 AND verification_status = $4
+RETURNING doctor_id, user_id, description, specialization, years_of_experience, county, price_per_hour, license_number, created_at, updated_at, verification_status, verification_reason, verified_at, observes_public_holidays, timezone
+`
+
+type UpdateDoctorVerificationStatusParams struct {
+	ToStatus   VerificationStatus `json:"to_status"`
+	Reason     string             `json:"reason"`
+	DoctorID   int64              `json:"doctor_id"`
+	FromStatus VerificationStatus `json:"from_status"`
+}
+
+// only succeeds if the status hasn't changed since it was read
+func (q *Queries) UpdateDoctorVerificationStatus(ctx context.Context, arg UpdateDoctorVerificationStatusParams) (Doctor, error) {
+	row := q.db.QueryRowContext(ctx, updateDoctorVerificationStatus,
+		arg.ToStatus,
+		arg.Reason,
+		arg.DoctorID,
+		arg.FromStatus,
+	)
+	var i Doctor
+	err := row.Scan(
+		&i.DoctorID,
+		&i.UserID,
+		&i.Description,
+		&i.Specialization,
+		&i.YearsOfExperience,
+		&i.County,
+		&i.PricePerHour,
+		&i.LicenseNumber,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.VerificationStatus,
+		&i.VerificationReason,
+		&i.VerifiedAt,
+		&i.ObservesPublicHolidays,
+		&i.Timezone,
+	)
+	return i, err
+}
@@ -11,7 +11,7 @@ import (
 )
 
 const createDoctor = `-- name: CreateDoctor :one
-INSERT INTO doctors(user_id,specialization,license_number,description , years_of_experience , county , price_per_hour) VALUES ($1,$2,$3,$4,$5,$6,$7)RETURNING doctor_id, user_id, description, specialization, years_of_experience, county, price_per_hour, license_number, created_at, updated_at
+INSERT INTO doctors(user_id,specialization,license_number,description , years_of_experience , county , price_per_hour, timezone) VALUES ($1,$2,$3,$4,$5,$6,$7,$8)RETURNING doctor_id, user_id, description, specialization, years_of_experience, county, price_per_hour, license_number, created_at, updated_at, verification_status, verification_reason, verified_at, observes_public_holidays, timezone
 `
 
 type CreateDoctorParams struct {
@@ -22,6 +22,7 @@ type CreateDoctorParams struct {
 	YearsOfExperience int32  `json:"years_of_experience"`
 	County            string `json:"county"`
 	PricePerHour      string `json:"price_per_hour"`
+	Timezone          string `json:"timezone"`
 }
 
 func (q *Queries) CreateDoctor(ctx context.Context, arg CreateDoctorParams) (Doctor, error) {
@@ -33,6 +34,7 @@ func (q *Queries) CreateDoctor(ctx context.Context, arg CreateDoctorParams) (Doc
 		arg.YearsOfExperience,
 		arg.County,
 		arg.PricePerHour,
+		arg.Timezone,
 	)
 	var i Doctor
 	err := row.Scan(
@@ -46,6 +48,11 @@ func (q *Queries) CreateDoctor(ctx context.Context, arg CreateDoctorParams) (Doc
 		&i.LicenseNumber,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.VerificationStatus,
+		&i.VerificationReason,
+		&i.VerifiedAt,
+		&i.ObservesPublicHolidays,
+		&i.Timezone,
 	)
 	return i, err
 }
@@ -70,12 +77,15 @@ SELECT
     doctors.description, 
     doctors.county, 
     doctors.price_per_hour, 
-    doctors.years_of_experience
+    doctors.years_of_experience,
+    doctors.timezone
 FROM doctors
 INNER JOIN users ON doctors.user_id = users.user_id
 WHERE 
+    -- only doctors whose license has been verified are listed
+    doctors.verification_status = 'verified'
     -- Filter for county - returns all results when empty
-    (TRIM($1::text) = '' OR doctors.county ILIKE '%' || $1::text || '%')
+    AND (TRIM($1::text) = '' OR doctors.county ILIKE '%' || $1::text || '%')
     AND (TRIM($2::text) = '' OR doctors.specialization ILIKE '%' || $2::text || '%')
 AND (NULLIF($3::text, '')::numeric IS NULL OR doctors.price_per_hour >= NULLIF($3::text, '')::numeric)
     AND (NULLIF($4::text, '')::numeric IS NULL OR doctors.price_per_hour <= NULLIF($4::text, '')::numeric)
@@ -119,6 +129,7 @@ type GetDoctorsRow struct {
 	County            string `json:"county"`
 	PricePerHour      string `json:"price_per_hour"`
 	YearsOfExperience int32  `json:"years_of_experience"`
+	Timezone          string `json:"timezone"`
 }
 
 func (q *Queries) GetDoctors(ctx context.Context, arg GetDoctorsParams) ([]GetDoctorsRow, error) {
@@ -150,6 +161,7 @@ func (q *Queries) GetDoctors(ctx context.Context, arg GetDoctorsParams) ([]GetDo
 			&i.County,
 			&i.PricePerHour,
 			&i.YearsOfExperience,
+			&i.Timezone,
 		); err != nil {
 			return nil, err
 		}
@@ -220,3 +232,21 @@ func (q *Queries) ListPatientsUnderDoctorCare(ctx context.Context, doctorID int6
 	}
 	return items, nil
 }
+
+const setDoctorTimezone = `-- name: SetDoctorTimezone :one
+UPDATE doctors SET timezone = $1, updated_at = now()
+WHERE doctor_id = $2
+RETURNING timezone
+`
+
+type SetDoctorTimezoneParams struct {
+	Timezone string `json:"timezone"`
+	DoctorID int64  `json:"doctor_id"`
+}
+
+func (q *Queries) SetDoctorTimezone(ctx context.Context, arg SetDoctorTimezoneParams) (string, error) {
+	row := q.db.QueryRowContext(ctx, setDoctorTimezone, arg.Timezone, arg.DoctorID)
+	var timezone string
+	err := row.Scan(&timezone)
+	return timezone, err
+}
@@ -0,0 +1,159 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: login_attempts.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const blockLogin = `-- name: BlockLogin :exec
+UPDATE login_attempts SET retry_after = $1, locked_until = $2 WHERE email = lower($3)
+`
+
+type BlockLoginParams struct {
+	RetryAfter  sql.NullTime `json:"retry_after"`
+	LockedUntil sql.NullTime `json:"locked_until"`
+	Email       string       `json:"email"`
+}
+
+func (q *Queries) BlockLogin(ctx context.Context, arg BlockLoginParams) error {
+	_, err := q.db.ExecContext(ctx, blockLogin, arg.RetryAfter, arg.LockedUntil, arg.Email)
+	return err
+}
+
+const clearLoginAttempts = `-- name: ClearLoginAttempts :exec
+DELETE FROM login_attempts WHERE email=lower($1)
+`
+
+func (q *Queries) ClearLoginAttempts(ctx context.Context, email string) error {
+	_, err := q.db.ExecContext(ctx, clearLoginAttempts, email)
+	return err
+}
+
+const consumeAccountUnlockToken = `-- name: ConsumeAccountUnlockToken :one
+UPDATE account_unlock_tokens SET used_at=now()
+WHERE token_hash=$1 AND used_at IS NULL AND expires_at > now()
+RETURNING token_id, user_id, token_hash, expires_at, used_at, created_at
+`
+
+func (q *Queries) ConsumeAccountUnlockToken(ctx context.Context, tokenHash string) (AccountUnlockToken, error) {
+	row := q.db.QueryRowContext(ctx, consumeAccountUnlockToken, tokenHash)
+	var i AccountUnlockToken
+	err := row.Scan(
+		&i.TokenID,
+		&i.UserID,
+		&i.TokenHash,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createAccountUnlockToken = `-- name: CreateAccountUnlockToken :exec
+INSERT INTO account_unlock_tokens(user_id, token_hash, expires_at) VALUES ($1,$2,$3)
+`
+
+type CreateAccountUnlockTokenParams struct {
+	UserID    int64     `json:"user_id"`
+	TokenHash string    `json:"token_hash"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (q *Queries) CreateAccountUnlockToken(ctx context.Context, arg CreateAccountUnlockTokenParams) error {
+	_, err := q.db.ExecContext(ctx, createAccountUnlockToken, arg.UserID, arg.TokenHash, arg.ExpiresAt)
+	return err
+}
+
+const getLoginAttempt = `-- name: GetLoginAttempt :one
+SELECT email, failed_attempts, last_failed_at, retry_after, locked_until, challenge_id, challenge_failures FROM login_attempts WHERE email=lower($1)
+`
+
+// emails are compared case insensitively so changing the case doesn't give an attacker a fresh set of attempts
+func (q *Queries) GetLoginAttempt(ctx context.Context, email string) (LoginAttempt, error) {
+	row := q.db.QueryRowContext(ctx, getLoginAttempt, email)
+	var i LoginAttempt
+	err := row.Scan(
+		&i.Email,
+		&i.FailedAttempts,
+		&i.LastFailedAt,
+		&i.RetryAfter,
+		&i.LockedUntil,
+		&i.ChallengeID,
+		&i.ChallengeFailures,
+	)
+	return i, err
+}
+
+const invalidateAccountUnlockTokens = `-- name: InvalidateAccountUnlockTokens :exec
+UPDATE account_unlock_tokens SET used_at=now() WHERE user_id=$1 AND used_at IS NULL
+`
+
+func (q *Queries) InvalidateAccountUnlockTokens(ctx context.Context, userID int64) error {
+	_, err := q.db.ExecContext(ctx, invalidateAccountUnlockTokens, userID)
+	return err
+}
+
+const recordFailedLogin = `-- name: RecordFailedLogin :one
+INSERT INTO login_attempts(email, failed_attempts, last_failed_at) VALUES (lower($1), 1, now())
+ON CONFLICT (email) DO UPDATE SET
+failed_attempts = CASE WHEN login_attempts.locked_until IS NOT NULL AND login_attempts.locked_until <= now() THEN 1 ELSE login_attempts.failed_attempts + 1 END,
+locked_until = CASE WHEN login_attempts.locked_until IS NOT NULL AND login_attempts.locked_until <= now() THEN NULL ELSE login_attempts.locked_until END,
+last_failed_at = now()
+RETURNING email, failed_attempts, last_failed_at, retry_after, locked_until, challenge_id, challenge_failures
+`
+
+// counting starts again once a lockout has run out
+func (q *Queries) RecordFailedLogin(ctx context.Context, email string) (LoginAttempt, error) {
+	row := q.db.QueryRowContext(ctx, recordFailedLogin, email)
+	var i LoginAttempt
+	err := row.Scan(
+		&i.Email,
+		&i.FailedAttempts,
+		&i.LastFailedAt,
+		&i.RetryAfter,
+		&i.LockedUntil,
+		&i.ChallengeID,
+		&i.ChallengeFailures,
+	)
+	return i, err
+}
+
+const recordFailedSecondFactor = `-- name: RecordFailedSecondFactor :one
+INSERT INTO login_attempts(email, failed_attempts, last_failed_at, challenge_id, challenge_failures) VALUES (lower($1), 1, now(), $2, 1)
+ON CONFLICT (email) DO UPDATE SET
+failed_attempts = CASE WHEN login_attempts.locked_until IS NOT NULL AND login_attempts.locked_until <= now() THEN 1 ELSE login_attempts.failed_attempts + 1 END,
+locked_until = CASE WHEN login_attempts.locked_until IS NOT NULL AND login_attempts.locked_until <= now() THEN NULL ELSE login_attempts.locked_until END,
+last_failed_at = now(),
+challenge_failures = CASE WHEN login_attempts.challenge_id = EXCLUDED.challenge_id THEN login_attempts.challenge_failures + 1 ELSE 1 END,
+challenge_id = EXCLUDED.challenge_id
+RETURNING email, failed_attempts, last_failed_at, retry_after, locked_until, challenge_id, challenge_failures
+`
+
+type RecordFailedSecondFactorParams struct {
+	Email       string        `json:"email"`
+	ChallengeID uuid.NullUUID `json:"challenge_id"`
+}
+
+// the challenge count starts again with every new challenge , the login count carries on until the second factor succeeds
+func (q *Queries) RecordFailedSecondFactor(ctx context.Context, arg RecordFailedSecondFactorParams) (LoginAttempt, error) {
+	row := q.db.QueryRowContext(ctx, recordFailedSecondFactor, arg.Email, arg.ChallengeID)
+	var i LoginAttempt
+	err := row.Scan(
+		&i.Email,
+		&i.FailedAttempts,
+		&i.LastFailedAt,
+		&i.RetryAfter,
+		&i.LockedUntil,
+		&i.ChallengeID,
+		&i.ChallengeFailures,
+	)
+	return i, err
+}
@@ -7,6 +7,7 @@ package database
 import (
 	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -59,12 +60,99 @@ func (ns NullAppointmentStatus) Value() (driver.Value, error) {
 	return string(ns.AppointmentStatus), nil
 }
 
+type AvailabilityExceptionKind string
+
+const (
+	AvailabilityExceptionKindBlock AvailabilityExceptionKind = "block"
+	AvailabilityExceptionKindExtra AvailabilityExceptionKind = "extra"
+)
+
+func (e *AvailabilityExceptionKind) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = AvailabilityExceptionKind(s)
+	case string:
+		*e = AvailabilityExceptionKind(s)
+	default:
+		return fmt.Errorf("unsupported scan type for AvailabilityExceptionKind: %T", src)
+	}
+	return nil
+}
+
+type NullAvailabilityExceptionKind struct {
+	AvailabilityExceptionKind AvailabilityExceptionKind `json:"availability_exception_kind"`
+	Valid                     bool                      `json:"valid"` // Valid is true if AvailabilityExceptionKind is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullAvailabilityExceptionKind) Scan(value interface{}) error {
+	if value == nil {
+		ns.AvailabilityExceptionKind, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.AvailabilityExceptionKind.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullAvailabilityExceptionKind) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.AvailabilityExceptionKind), nil
+}
+
+type EarningEntryType string
+
+const (
+	EarningEntryTypeEarning        EarningEntryType = "earning"
+	EarningEntryTypeRefund         EarningEntryType = "refund"
+	EarningEntryTypeRefundReversal EarningEntryType = "refund_reversal"
+)
+
+func (e *EarningEntryType) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = EarningEntryType(s)
+	case string:
+		*e = EarningEntryType(s)
+	default:
+		return fmt.Errorf("unsupported scan type for EarningEntryType: %T", src)
+	}
+	return nil
+}
+
+type NullEarningEntryType struct {
+	EarningEntryType EarningEntryType `json:"earning_entry_type"`
+	Valid            bool             `json:"valid"` // Valid is true if EarningEntryType is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullEarningEntryType) Scan(value interface{}) error {
+	if value == nil {
+		ns.EarningEntryType, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.EarningEntryType.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullEarningEntryType) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.EarningEntryType), nil
+}
+
 type PaymentStatus string
 
 const (
-	PaymentStatusPending   PaymentStatus = "pending"
-	PaymentStatusCompleted PaymentStatus = "completed"
-	PaymentStatusFailed    PaymentStatus = "failed"
+	PaymentStatusPending           PaymentStatus = "pending"
+	PaymentStatusCompleted         PaymentStatus = "completed"
+	PaymentStatusFailed            PaymentStatus = "failed"
+	PaymentStatusRefunded          PaymentStatus = "refunded"
+	PaymentStatusPartiallyRefunded PaymentStatus = "partially_refunded"
 )
 
 func (e *PaymentStatus) Scan(src interface{}) error {
@@ -107,6 +195,7 @@ type Role string
 const (
 	RolePatient    Role = "patient"
 	RoleSpecialist Role = "specialist"
+	RoleAdmin      Role = "admin"
 )
 
 func (e *Role) Scan(src interface{}) error {
@@ -144,6 +233,59 @@ func (ns NullRole) Value() (driver.Value, error) {
 	return string(ns.Role), nil
 }
 
+type VerificationStatus string
+
+const (
+	VerificationStatusPending   VerificationStatus = "pending"
+	VerificationStatusVerified  VerificationStatus = "verified"
+	VerificationStatusRejected  VerificationStatus = "rejected"
+	VerificationStatusSuspended VerificationStatus = "suspended"
+)
+
+func (e *VerificationStatus) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = VerificationStatus(s)
+	case string:
+		*e = VerificationStatus(s)
+	default:
+		return fmt.Errorf("unsupported scan type for VerificationStatus: %T", src)
+	}
+	return nil
+}
+
+type NullVerificationStatus struct {
+	VerificationStatus VerificationStatus `json:"verification_status"`
+	Valid              bool               `json:"valid"` // Valid is true if VerificationStatus is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullVerificationStatus) Scan(value interface{}) error {
+	if value == nil {
+		ns.VerificationStatus, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.VerificationStatus.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullVerificationStatus) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.VerificationStatus), nil
+}
+
+type AccountUnlockToken struct {
+	TokenID   int64        `json:"token_id"`
+	UserID    int64        `json:"user_id"`
+	TokenHash string       `json:"token_hash"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	UsedAt    sql.NullTime `json:"used_at"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
 type AllergyIntolerance struct {
 	ID                        uuid.UUID      `json:"id"`
 	PatientID                 int64          `json:"patient_id"`
@@ -169,6 +311,45 @@ type Appointment struct {
 	EndTime       time.Time         `json:"end_time"`
 	CreatedAt     time.Time         `json:"created_at"`
 	UpdatedAt     sql.NullTime      `json:"updated_at"`
+	TimeRange     string            `json:"-"`
+}
+
+type AppointmentReschedule struct {
+	RescheduleID      int64     `json:"reschedule_id"`
+	AppointmentID     int64     `json:"appointment_id"`
+	PreviousStartTime time.Time `json:"previous_start_time"`
+	PreviousEndTime   time.Time `json:"previous_end_time"`
+	NewStartTime      time.Time `json:"new_start_time"`
+	NewEndTime        time.Time `json:"new_end_time"`
+	Reason            string    `json:"reason"`
+	RescheduledBy     int64     `json:"rescheduled_by"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+type AppointmentStatusHistory struct {
+	HistoryID     int64             `json:"history_id"`
+	AppointmentID int64             `json:"appointment_id"`
+	FromStatus    AppointmentStatus `json:"from_status"`
+	ToStatus      AppointmentStatus `json:"to_status"`
+	Actor         string            `json:"actor"`
+	ChangedBy     sql.NullInt64     `json:"changed_by"`
+	Reason        string            `json:"reason"`
+	CreatedAt     time.Time         `json:"created_at"`
+}
+
+type AuditEvent struct {
+	EventID      int64     `json:"event_id"`
+	ActorUserID  int64     `json:"actor_user_id"`
+	ActorRole    string    `json:"actor_role"`
+	PatientID    int64     `json:"patient_id"`
+	ResourceType string    `json:"resource_type"`
+	ResourceID   string    `json:"resource_id"`
+	Action       string    `json:"action"`
+	RequestID    string    `json:"request_id"`
+	ClientIp     string    `json:"client_ip"`
+	OccurredAt   time.Time `json:"occurred_at"`
+	PrevHash     string    `json:"prev_hash"`
+	Hash         string    `json:"hash"`
 }
 
 type Availability struct {
@@ -183,17 +364,118 @@ type Availability struct {
 	IntervalMinutes int32        `json:"interval_minutes"`
 }
 
+type AvailabilityException struct {
+	ExceptionID     int64                     `json:"exception_id"`
+	DoctorID        int64                     `json:"doctor_id"`
+	Kind            AvailabilityExceptionKind `json:"kind"`
+	StartsAt        time.Time                 `json:"starts_at"`
+	EndsAt          time.Time                 `json:"ends_at"`
+	IntervalMinutes int32                     `json:"interval_minutes"`
+	Reason          string                    `json:"reason"`
+	CreatedAt       time.Time                 `json:"created_at"`
+}
+
+type BookingRule struct {
+	DoctorID         int64     `json:"doctor_id"`
+	BufferMinutes    int32     `json:"buffer_minutes"`
+	MinNoticeMinutes int32     `json:"min_notice_minutes"`
+	HorizonDays      int32     `json:"horizon_days"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+type BreakGlassAccess struct {
+	AccessID   int64     `json:"access_id"`
+	GrantID    int64     `json:"grant_id"`
+	Resource   string    `json:"resource"`
+	AccessedAt time.Time `json:"accessed_at"`
+}
+
+type BreakGlassGrant struct {
+	GrantID   int64     `json:"grant_id"`
+	DoctorID  int64     `json:"doctor_id"`
+	PatientID int64     `json:"patient_id"`
+	Reason    string    `json:"reason"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CalendarFeed struct {
+	UserID    int64     `json:"user_id"`
+	TokenHash string    `json:"token_hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 type Doctor struct {
-	DoctorID          int64        `json:"doctor_id"`
-	UserID            int64        `json:"user_id"`
-	Description       string       `json:"description"`
-	Specialization    string       `json:"specialization"`
-	YearsOfExperience int32        `json:"years_of_experience"`
-	County            string       `json:"county"`
-	PricePerHour      string       `json:"price_per_hour"`
-	LicenseNumber     string       `json:"license_number"`
-	CreatedAt         time.Time    `json:"created_at"`
-	UpdatedAt         sql.NullTime `json:"updated_at"`
+	DoctorID               int64              `json:"doctor_id"`
+	UserID                 int64              `json:"user_id"`
+	Description            string             `json:"description"`
+	Specialization         string             `json:"specialization"`
+	YearsOfExperience      int32              `json:"years_of_experience"`
+	County                 string             `json:"county"`
+	PricePerHour           string             `json:"price_per_hour"`
+	LicenseNumber          string             `json:"license_number"`
+	CreatedAt              time.Time          `json:"created_at"`
+	UpdatedAt              sql.NullTime       `json:"updated_at"`
+	VerificationStatus     VerificationStatus `json:"verification_status"`
+	VerificationReason     string             `json:"verification_reason"`
+	VerifiedAt             sql.NullTime       `json:"verified_at"`
+	ObservesPublicHolidays bool               `json:"observes_public_holidays"`
+	Timezone               string             `json:"timezone"`
+}
+
+type DoctorEarning struct {
+	EntryID           int64            `json:"entry_id"`
+	DoctorID          int64            `json:"doctor_id"`
+	PaymentID         int64            `json:"payment_id"`
+	AppointmentID     int64            `json:"appointment_id"`
+	RefundID          sql.NullInt64    `json:"refund_id"`
+	EntryType         EarningEntryType `json:"entry_type"`
+	GrossAmount       string           `json:"gross_amount"`
+	Commission        string           `json:"commission"`
+	NetAmount         string           `json:"net_amount"`
+	Currency          string           `json:"currency"`
+	SettledByProvider bool             `json:"settled_by_provider"`
+	CreatedAt         time.Time        `json:"created_at"`
+}
+
+type DoctorLicenseDocument struct {
+	DocumentID  int64     `json:"document_id"`
+	DoctorID    int64     `json:"doctor_id"`
+	FileUrl     string    `json:"file_url"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type"`
+	UploadedAt  time.Time `json:"uploaded_at"`
+}
+
+type DoctorPayoutAccount struct {
+	DoctorID           int64     `json:"doctor_id"`
+	SubaccountCode     string    `json:"subaccount_code"`
+	BusinessName       string    `json:"business_name"`
+	BankCode           string    `json:"bank_code"`
+	SettlementBank     string    `json:"settlement_bank"`
+	AccountNumberLast4 string    `json:"account_number_last4"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+type DoctorVerificationEvent struct {
+	EventID    int64              `json:"event_id"`
+	DoctorID   int64              `json:"doctor_id"`
+	FromStatus VerificationStatus `json:"from_status"`
+	ToStatus   VerificationStatus `json:"to_status"`
+	Reason     string             `json:"reason"`
+	ChangedBy  int64              `json:"changed_by"`
+	CreatedAt  time.Time          `json:"created_at"`
+}
+
+type LoginAttempt struct {
+	Email             string        `json:"email"`
+	FailedAttempts    int32         `json:"failed_attempts"`
+	LastFailedAt      time.Time     `json:"last_failed_at"`
+	RetryAfter        sql.NullTime  `json:"retry_after"`
+	LockedUntil       sql.NullTime  `json:"locked_until"`
+	ChallengeID       uuid.NullUUID `json:"challenge_id"`
+	ChallengeFailures int32         `json:"challenge_failures"`
 }
 
 type MedicationStatement struct {
@@ -220,6 +502,15 @@ type Observation struct {
 	UpdatedAt         time.Time `json:"updated_at"`
 }
 
+type PasswordResetToken struct {
+	TokenID   int64        `json:"token_id"`
+	UserID    int64        `json:"user_id"`
+	TokenHash string       `json:"token_hash"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	UsedAt    sql.NullTime `json:"used_at"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
 type Patient struct {
 	PatientID             int64        `json:"patient_id"`
 	UserID                int64        `json:"user_id"`
@@ -238,32 +529,135 @@ type Patient struct {
 }
 
 type Payment struct {
-	PaymentID     int64                 `json:"payment_id"`
-	Reference     string                `json:"reference"`
-	CurrentStatus PaymentStatus         `json:"current_status"`
-	Amount        string                `json:"amount"`
-	Metadata      pqtype.NullRawMessage `json:"metadata"`
-	PaymentMethod sql.NullString        `json:"payment_method"`
-	Currency      string                `json:"currency"`
-	AppointmentID int64                 `json:"appointment_id"`
-	PatientID     int64                 `json:"patient_id"`
-	DoctorID      int64                 `json:"doctor_id"`
-	CreatedAt     time.Time             `json:"created_at"`
-	UpdatedAt     sql.NullTime          `json:"updated_at"`
-	CompletedAt   sql.NullTime          `json:"completed_at"`
+	PaymentID             int64                 `json:"payment_id"`
+	Reference             string                `json:"reference"`
+	CurrentStatus         PaymentStatus         `json:"current_status"`
+	Amount                string                `json:"amount"`
+	Metadata              pqtype.NullRawMessage `json:"metadata"`
+	PaymentMethod         string                `json:"payment_method"`
+	Currency              string                `json:"currency"`
+	AppointmentID         int64                 `json:"appointment_id"`
+	PatientID             int64                 `json:"patient_id"`
+	DoctorID              int64                 `json:"doctor_id"`
+	CreatedAt             time.Time             `json:"created_at"`
+	UpdatedAt             sql.NullTime          `json:"updated_at"`
+	CompletedAt           sql.NullTime          `json:"completed_at"`
+	ConsultationFee       string                `json:"consultation_fee"`
+	PlatformFee           string                `json:"platform_fee"`
+	Tax                   string                `json:"tax"`
+	ProviderTransactionID string                `json:"provider_transaction_id"`
+	PayerPhone            string                `json:"payer_phone"`
+	SubaccountCode        string                `json:"subaccount_code"`
 }
 
-type User struct {
-	UserID            int64        `json:"user_id"`
-	DateOfBirth       time.Time    `json:"date_of_birth"`
-	FullName          string       `json:"full_name"`
-	Password          string       `json:"password"`
-	Email             string       `json:"email"`
-	TelephoneNumber   string       `json:"telephone_number"`
-	ProfileImageUrl   string       `json:"profile_image_url"`
+type PaymentDispute struct {
+	DisputeID         int64        `json:"dispute_id"`
+	PaymentID         int64        `json:"payment_id"`
+	ProviderDisputeID string       `json:"provider_dispute_id"`
+	Status            string       `json:"status"`
+	Resolution        string       `json:"resolution"`
+	RefundAmount      string       `json:"refund_amount"`
+	Currency          string       `json:"currency"`
 	CreatedAt         time.Time    `json:"created_at"`
-	UserRole          Role         `json:"user_role"`
-	VerifiedAt        sql.NullTime `json:"verified_at"`
-	IsOnboarded       bool         `json:"is_onboarded"`
-	PasswordChangedAt time.Time    `json:"password_changed_at"`
+	UpdatedAt         sql.NullTime `json:"updated_at"`
+}
+
+type PublicHoliday struct {
+	HolidayDate time.Time `json:"holiday_date"`
+	Name        string    `json:"name"`
+}
+
+type ReconciliationItem struct {
+	ItemID           int64          `json:"item_id"`
+	RunID            int64          `json:"run_id"`
+	PaymentID        int64          `json:"payment_id"`
+	Reference        string         `json:"reference"`
+	Outcome          string         `json:"outcome"`
+	ProviderStatus   string         `json:"provider_status"`
+	ExpectedAmount   string         `json:"expected_amount"`
+	ProviderAmount   sql.NullString `json:"provider_amount"`
+	ExpectedCurrency string         `json:"expected_currency"`
+	ProviderCurrency string         `json:"provider_currency"`
+	Detail           string         `json:"detail"`
+	CreatedAt        time.Time      `json:"created_at"`
+}
+
+type ReconciliationRun struct {
+	RunID      int64        `json:"run_id"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt sql.NullTime `json:"finished_at"`
+	Checked    int32        `json:"checked"`
+	Updated    int32        `json:"updated"`
+	Mismatched int32        `json:"mismatched"`
+	Failed     int32        `json:"failed"`
+}
+
+type Refund struct {
+	RefundID         int64         `json:"refund_id"`
+	PaymentID        int64         `json:"payment_id"`
+	AppointmentID    int64         `json:"appointment_id"`
+	Amount           string        `json:"amount"`
+	Currency         string        `json:"currency"`
+	Reason           string        `json:"reason"`
+	InitiatedBy      sql.NullInt64 `json:"initiated_by"`
+	ProviderRefundID string        `json:"provider_refund_id"`
+	ProviderStatus   string        `json:"provider_status"`
+	CreatedAt        time.Time     `json:"created_at"`
+	UpdatedAt        sql.NullTime  `json:"updated_at"`
+	IdempotencyKey   string        `json:"idempotency_key"`
+}
+
+type Session struct {
+	SessionID      uuid.UUID    `json:"session_id"`
+	UserID         int64        `json:"user_id"`
+	RefreshTokenID uuid.UUID    `json:"refresh_token_id"`
+	UserAgent      string       `json:"user_agent"`
+	ClientIp       string       `json:"client_ip"`
+	IsRevoked      bool         `json:"is_revoked"`
+	ExpiresAt      time.Time    `json:"expires_at"`
+	CreatedAt      time.Time    `json:"created_at"`
+	RevokedAt      sql.NullTime `json:"revoked_at"`
+}
+
+type TwoFactorRecoveryCode struct {
+	CodeID    int64        `json:"code_id"`
+	UserID    int64        `json:"user_id"`
+	CodeHash  string       `json:"code_hash"`
+	UsedAt    sql.NullTime `json:"used_at"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+type User struct {
+	UserID             int64        `json:"user_id"`
+	DateOfBirth        time.Time    `json:"date_of_birth"`
+	FullName           string       `json:"full_name"`
+	Password           string       `json:"password"`
+	Email              string       `json:"email"`
+	TelephoneNumber    string       `json:"telephone_number"`
+	ProfileImageUrl    string       `json:"profile_image_url"`
+	CreatedAt          time.Time    `json:"created_at"`
+	UserRole           Role         `json:"user_role"`
+	VerifiedAt         sql.NullTime `json:"verified_at"`
+	IsOnboarded        bool         `json:"is_onboarded"`
+	PasswordChangedAt  time.Time    `json:"password_changed_at"`
+	VerificationSentAt sql.NullTime `json:"verification_sent_at"`
+}
+
+type UserTwoFactor struct {
+	UserID           int64        `json:"user_id"`
+	SecretCiphertext string       `json:"secret_ciphertext"`
+	EnabledAt        sql.NullTime `json:"enabled_at"`
+	LastUsedStep     int64        `json:"last_used_step"`
+	CreatedAt        time.Time    `json:"created_at"`
+}
+
+type WebhookEvent struct {
+	EventID     string          `json:"event_id"`
+	Provider    string          `json:"provider"`
+	Event       string          `json:"event"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int32           `json:"attempts"`
+	ReceivedAt  time.Time       `json:"received_at"`
+	ProcessedAt sql.NullTime    `json:"processed_at"`
+	ClaimedAt   sql.NullTime    `json:"claimed_at"`
 }
@@ -0,0 +1,62 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: payment_disputes.sql
+
+package database
+
+import (
+	"context"
+)
+
+const upsertPaymentDispute = `-- name: UpsertPaymentDispute :one
+INSERT INTO payment_disputes (
+  payment_id,
+  provider_dispute_id,
+  status,
+  resolution,
+  refund_amount,
+  currency
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+ON CONFLICT (provider_dispute_id) DO UPDATE SET
+  status = EXCLUDED.status,
+  resolution = EXCLUDED.resolution,
+  refund_amount = EXCLUDED.refund_amount,
+  updated_at = now()
+RETURNING dispute_id, payment_id, provider_dispute_id, status, resolution, refund_amount, currency, created_at, updated_at
+`
+
+type UpsertPaymentDisputeParams struct {
+	PaymentID         int64  `json:"payment_id"`
+	ProviderDisputeID string `json:"provider_dispute_id"`
+	Status            string `json:"status"`
+	Resolution        string `json:"resolution"`
+	RefundAmount      string `json:"refund_amount"`
+	Currency          string `json:"currency"`
+}
+
+func (q *Queries) UpsertPaymentDispute(ctx context.Context, arg UpsertPaymentDisputeParams) (PaymentDispute, error) {
+	row := q.db.QueryRowContext(ctx, upsertPaymentDispute,
+		arg.PaymentID,
+		arg.ProviderDisputeID,
+		arg.Status,
+		arg.Resolution,
+		arg.RefundAmount,
+		arg.Currency,
+	)
+	var i PaymentDispute
+	err := row.Scan(
+		&i.DisputeID,
+		&i.PaymentID,
+		&i.ProviderDisputeID,
+		&i.Status,
+		&i.Resolution,
+		&i.RefundAmount,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
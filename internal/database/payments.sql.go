@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"time"
 )
 
 const createPayment = `-- name: CreatePayment :one
@@ -15,18 +16,30 @@ INSERT INTO payments (
   amount,
   patient_id,
   doctor_id,
-  appointment_id
+  appointment_id,
+  consultation_fee,
+  platform_fee,
+  tax,
+  payment_method,
+  payer_phone,
+  subaccount_code
 ) VALUES (
-  $1, $2, $3, $4, $5
-) RETURNING payment_id, reference, current_status, amount, metadata, payment_method, currency, appointment_id, patient_id, doctor_id, created_at, updated_at, completed_at
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+) RETURNING payment_id, reference, current_status, amount, metadata, payment_method, currency, appointment_id, patient_id, doctor_id, created_at, updated_at, completed_at, consultation_fee, platform_fee, tax, provider_transaction_id, payer_phone, subaccount_code
 `
 
 type CreatePaymentParams struct {
-	Reference     string `json:"reference"`
-	Amount        string `json:"amount"`
-	PatientID     int64  `json:"patient_id"`
-	DoctorID      int64  `json:"doctor_id"`
-	AppointmentID int64  `json:"appointment_id"`
+	Reference       string `json:"reference"`
+	Amount          string `json:"amount"`
+	PatientID       int64  `json:"patient_id"`
+	DoctorID        int64  `json:"doctor_id"`
+	AppointmentID   int64  `json:"appointment_id"`
+	ConsultationFee string `json:"consultation_fee"`
+	PlatformFee     string `json:"platform_fee"`
+	Tax             string `json:"tax"`
+	PaymentMethod   string `json:"payment_method"`
+	PayerPhone      string `json:"payer_phone"`
+	SubaccountCode  string `json:"subaccount_code"`
 }
 
 func (q *Queries) CreatePayment(ctx context.Context, arg CreatePaymentParams) (Payment, error) {
@@ -36,6 +49,12 @@ func (q *Queries) CreatePayment(ctx context.Context, arg CreatePaymentParams) (P
 		arg.PatientID,
 		arg.DoctorID,
 		arg.AppointmentID,
+		arg.ConsultationFee,
+		arg.PlatformFee,
+		arg.Tax,
+		arg.PaymentMethod,
+		arg.PayerPhone,
+		arg.SubaccountCode,
 	)
 	var i Payment
 	err := row.Scan(
@@ -52,12 +71,70 @@ func (q *Queries) CreatePayment(ctx context.Context, arg CreatePaymentParams) (P
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.CompletedAt,
+		&i.ConsultationFee,
+		&i.PlatformFee,
+		&i.Tax,
+		&i.ProviderTransactionID,
+		&i.PayerPhone,
+		&i.SubaccountCode,
+	)
+	return i, err
+}
+
+const failExpiredHoldPayments = `-- name: FailExpiredHoldPayments :exec
+UPDATE payments p SET current_status = 'failed', updated_at = NOW()
+FROM appointments a
+WHERE a.appointment_id = p.appointment_id
+  AND a.current_status = 'pending_payment'
+  AND a.created_at <= $1
+  AND ($2::bigint = 0 OR a.doctor_id = $2::bigint)
+  AND p.current_status = 'pending'
+`
+
+type FailExpiredHoldPaymentsParams struct {
+	CreatedBefore time.Time `json:"created_before"`
+	DoctorID      int64     `json:"doctor_id"`
+}
+
+// fails the payments of the unpaid appointments whose hold has run out (only the doctor's if doctor_id isn't 0)
+func (q *Queries) FailExpiredHoldPayments(ctx context.Context, arg FailExpiredHoldPaymentsParams) error {
+	_, err := q.db.ExecContext(ctx, failExpiredHoldPayments, arg.CreatedBefore, arg.DoctorID)
+	return err
+}
+
+const getPaymentByAppointmentId = `-- name: GetPaymentByAppointmentId :one
+SELECT payment_id, reference, current_status, amount, metadata, payment_method, currency, appointment_id, patient_id, doctor_id, created_at, updated_at, completed_at, consultation_fee, platform_fee, tax, provider_transaction_id, payer_phone, subaccount_code FROM payments WHERE appointment_id = $1 LIMIT 1
+`
+
+func (q *Queries) GetPaymentByAppointmentId(ctx context.Context, appointmentID int64) (Payment, error) {
+	row := q.db.QueryRowContext(ctx, getPaymentByAppointmentId, appointmentID)
+	var i Payment
+	err := row.Scan(
+		&i.PaymentID,
+		&i.Reference,
+		&i.CurrentStatus,
+		&i.Amount,
+		&i.Metadata,
+		&i.PaymentMethod,
+		&i.Currency,
+		&i.AppointmentID,
+		&i.PatientID,
+		&i.DoctorID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.CompletedAt,
+		&i.ConsultationFee,
+		&i.PlatformFee,
+		&i.Tax,
+		&i.ProviderTransactionID,
+		&i.PayerPhone,
+		&i.SubaccountCode,
 	)
 	return i, err
 }
 
 const getPaymentByReference = `-- name: GetPaymentByReference :one
-SELECT payment_id, reference, current_status, amount, metadata, payment_method, currency, appointment_id, patient_id, doctor_id, created_at, updated_at, completed_at FROM payments WHERE reference = $1 LIMIT 1
+SELECT payment_id, reference, current_status, amount, metadata, payment_method, currency, appointment_id, patient_id, doctor_id, created_at, updated_at, completed_at, consultation_fee, platform_fee, tax, provider_transaction_id, payer_phone, subaccount_code FROM payments WHERE reference = $1 LIMIT 1
 `
 
 func (q *Queries) GetPaymentByReference(ctx context.Context, reference string) (Payment, error) {
@@ -77,6 +154,12 @@ func (q *Queries) GetPaymentByReference(ctx context.Context, reference string) (
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.CompletedAt,
+		&i.ConsultationFee,
+		&i.PlatformFee,
+		&i.Tax,
+		&i.ProviderTransactionID,
+		&i.PayerPhone,
+		&i.SubaccountCode,
 	)
 	return i, err
 }
@@ -87,16 +170,33 @@ SET
   current_status = $1,
   --NB: Cast string literal to the appropriate type (payment status)
   completed_at = CASE WHEN $1 = 'completed'::payment_status THEN NOW() ELSE completed_at END,
+  -- only set when the provider reports it
+  provider_transaction_id = COALESCE(NULLIF($2::text, ''), provider_transaction_id),
   updated_at = NOW()
-WHERE reference = $2
+WHERE reference = $3
 `
 
 type UpdatePaymentStatusParams struct {
-	CurrentStatus PaymentStatus `json:"current_status"`
-	Reference     string        `json:"reference"`
+	CurrentStatus         PaymentStatus `json:"current_status"`
+	ProviderTransactionID string        `json:"provider_transaction_id"`
+	Reference             string        `json:"reference"`
 }
 
 func (q *Queries) UpdatePaymentStatus(ctx context.Context, arg UpdatePaymentStatusParams) error {
-	_, err := q.db.ExecContext(ctx, updatePaymentStatus, arg.CurrentStatus, arg.Reference)
+	_, err := q.db.ExecContext(ctx, updatePaymentStatus, arg.CurrentStatus, arg.ProviderTransactionID, arg.Reference)
+	return err
+}
+
+const updatePaymentStatusById = `-- name: UpdatePaymentStatusById :exec
+UPDATE payments SET current_status = $1, updated_at = NOW() WHERE payment_id = $2
+`
+
+type UpdatePaymentStatusByIdParams struct {
+	CurrentStatus PaymentStatus `json:"current_status"`
+	PaymentID     int64         `json:"payment_id"`
+}
+
+func (q *Queries) UpdatePaymentStatusById(ctx context.Context, arg UpdatePaymentStatusByIdParams) error {
+	_, err := q.db.ExecContext(ctx, updatePaymentStatusById, arg.CurrentStatus, arg.PaymentID)
 	return err
 }
@@ -0,0 +1,292 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: reconciliation.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const createReconciliationItem = `-- name: CreateReconciliationItem :one
+INSERT INTO reconciliation_items (
+  run_id,
+  payment_id,
+  reference,
+  outcome,
+  provider_status,
+  expected_amount,
+  provider_amount,
+  expected_currency,
+  provider_currency,
+  detail
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10
+) RETURNING item_id, run_id, payment_id, reference, outcome, provider_status, expected_amount, provider_amount, expected_currency, provider_currency, detail, created_at
+`
+
+type CreateReconciliationItemParams struct {
+	RunID            int64          `json:"run_id"`
+	PaymentID        int64          `json:"payment_id"`
+	Reference        string         `json:"reference"`
+	Outcome          string         `json:"outcome"`
+	ProviderStatus   string         `json:"provider_status"`
+	ExpectedAmount   string         `json:"expected_amount"`
+	ProviderAmount   sql.NullString `json:"provider_amount"`
+	ExpectedCurrency string         `json:"expected_currency"`
+	ProviderCurrency string         `json:"provider_currency"`
+	Detail           string         `json:"detail"`
+}
+
+func (q *Queries) CreateReconciliationItem(ctx context.Context, arg CreateReconciliationItemParams) (ReconciliationItem, error) {
+	row := q.db.QueryRowContext(ctx, createReconciliationItem,
+		arg.RunID,
+		arg.PaymentID,
+		arg.Reference,
+		arg.Outcome,
+		arg.ProviderStatus,
+		arg.ExpectedAmount,
+		arg.ProviderAmount,
+		arg.ExpectedCurrency,
+		arg.ProviderCurrency,
+		arg.Detail,
+	)
+	var i ReconciliationItem
+	err := row.Scan(
+		&i.ItemID,
+		&i.RunID,
+		&i.PaymentID,
+		&i.Reference,
+		&i.Outcome,
+		&i.ProviderStatus,
+		&i.ExpectedAmount,
+		&i.ProviderAmount,
+		&i.ExpectedCurrency,
+		&i.ProviderCurrency,
+		&i.Detail,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createReconciliationRun = `-- name: CreateReconciliationRun :one
+INSERT INTO reconciliation_runs DEFAULT VALUES RETURNING run_id, started_at, finished_at, checked, updated, mismatched, failed
+`
+
+func (q *Queries) CreateReconciliationRun(ctx context.Context) (ReconciliationRun, error) {
+	row := q.db.QueryRowContext(ctx, createReconciliationRun)
+	var i ReconciliationRun
+	err := row.Scan(
+		&i.RunID,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.Checked,
+		&i.Updated,
+		&i.Mismatched,
+		&i.Failed,
+	)
+	return i, err
+}
+
+const finishReconciliationRun = `-- name: FinishReconciliationRun :one
+UPDATE reconciliation_runs SET
+  finished_at = now(),
+  checked = $1,
+  updated = $2,
+  mismatched = $3,
+  failed = $4
+WHERE run_id = $5
+RETURNING run_id, started_at, finished_at, checked, updated, mismatched, failed
+`
+
+type FinishReconciliationRunParams struct {
+	Checked    int32 `json:"checked"`
+	Updated    int32 `json:"updated"`
+	Mismatched int32 `json:"mismatched"`
+	Failed     int32 `json:"failed"`
+	RunID      int64 `json:"run_id"`
+}
+
+func (q *Queries) FinishReconciliationRun(ctx context.Context, arg FinishReconciliationRunParams) (ReconciliationRun, error) {
+	row := q.db.QueryRowContext(ctx, finishReconciliationRun,
+		arg.Checked,
+		arg.Updated,
+		arg.Mismatched,
+		arg.Failed,
+		arg.RunID,
+	)
+	var i ReconciliationRun
+	err := row.Scan(
+		&i.RunID,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.Checked,
+		&i.Updated,
+		&i.Mismatched,
+		&i.Failed,
+	)
+	return i, err
+}
+
+const getReconciliationRun = `-- name: GetReconciliationRun :one
+SELECT run_id, started_at, finished_at, checked, updated, mismatched, failed FROM reconciliation_runs WHERE run_id = $1
+`
+
+func (q *Queries) GetReconciliationRun(ctx context.Context, runID int64) (ReconciliationRun, error) {
+	row := q.db.QueryRowContext(ctx, getReconciliationRun, runID)
+	var i ReconciliationRun
+	err := row.Scan(
+		&i.RunID,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.Checked,
+		&i.Updated,
+		&i.Mismatched,
+		&i.Failed,
+	)
+	return i, err
+}
+
+const listReconciliationItems = `-- name: ListReconciliationItems :many
+SELECT item_id, run_id, payment_id, reference, outcome, provider_status, expected_amount, provider_amount, expected_currency, provider_currency, detail, created_at FROM reconciliation_items WHERE run_id = $1 ORDER BY item_id
+`
+
+func (q *Queries) ListReconciliationItems(ctx context.Context, runID int64) ([]ReconciliationItem, error) {
+	rows, err := q.db.QueryContext(ctx, listReconciliationItems, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ReconciliationItem
+	for rows.Next() {
+		var i ReconciliationItem
+		if err := rows.Scan(
+			&i.ItemID,
+			&i.RunID,
+			&i.PaymentID,
+			&i.Reference,
+			&i.Outcome,
+			&i.ProviderStatus,
+			&i.ExpectedAmount,
+			&i.ProviderAmount,
+			&i.ExpectedCurrency,
+			&i.ProviderCurrency,
+			&i.Detail,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listReconciliationRuns = `-- name: ListReconciliationRuns :many
+SELECT run_id, started_at, finished_at, checked, updated, mismatched, failed FROM reconciliation_runs ORDER BY started_at DESC LIMIT $2 OFFSET $1
+`
+
+type ListReconciliationRunsParams struct {
+	SetOffset int32 `json:"set_offset"`
+	SetLimit  int32 `json:"set_limit"`
+}
+
+func (q *Queries) ListReconciliationRuns(ctx context.Context, arg ListReconciliationRunsParams) ([]ReconciliationRun, error) {
+	rows, err := q.db.QueryContext(ctx, listReconciliationRuns, arg.SetOffset, arg.SetLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ReconciliationRun
+	for rows.Next() {
+		var i ReconciliationRun
+		if err := rows.Scan(
+			&i.RunID,
+			&i.StartedAt,
+			&i.FinishedAt,
+			&i.Checked,
+			&i.Updated,
+			&i.Mismatched,
+			&i.Failed,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStalePendingPayments = `-- name: ListStalePendingPayments :many
+SELECT payment_id, reference, current_status, amount, metadata, payment_method, currency, appointment_id, patient_id, doctor_id, created_at, updated_at, completed_at, consultation_fee, platform_fee, tax, provider_transaction_id, payer_phone, subaccount_code FROM payments p
+WHERE p.current_status = 'pending'
+  AND p.created_at <= $1
+  AND NOT EXISTS (
+    SELECT 1 FROM reconciliation_items i
+    WHERE i.payment_id = p.payment_id AND i.outcome = 'mismatch'
+  )
+ORDER BY p.created_at
+LIMIT $2
+`
+
+type ListStalePendingPaymentsParams struct {
+	CreatedBefore time.Time `json:"created_before"`
+	SetLimit      int32     `json:"set_limit"`
+}
+
+// payments that have been pending for too long , the ones already flagged for a mismatch are left to the admins
+func (q *Queries) ListStalePendingPayments(ctx context.Context, arg ListStalePendingPaymentsParams) ([]Payment, error) {
+	rows, err := q.db.QueryContext(ctx, listStalePendingPayments, arg.CreatedBefore, arg.SetLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Payment
+	for rows.Next() {
+		var i Payment
+		if err := rows.Scan(
+			&i.PaymentID,
+			&i.Reference,
+			&i.CurrentStatus,
+			&i.Amount,
+			&i.Metadata,
+			&i.PaymentMethod,
+			&i.Currency,
+			&i.AppointmentID,
+			&i.PatientID,
+			&i.DoctorID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.CompletedAt,
+			&i.ConsultationFee,
+			&i.PlatformFee,
+			&i.Tax,
+			&i.ProviderTransactionID,
+			&i.PayerPhone,
+			&i.SubaccountCode,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
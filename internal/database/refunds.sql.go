@@ -0,0 +1,148 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: refunds.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+const createRefund = `-- name: CreateRefund :one
+INSERT INTO refunds (
+  payment_id,
+  appointment_id,
+  amount,
+  currency,
+  reason,
+  initiated_by,
+  provider_refund_id,
+  provider_status,
+  idempotency_key
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9
+) RETURNING refund_id, payment_id, appointment_id, amount, currency, reason, initiated_by, provider_refund_id, provider_status, created_at, updated_at, idempotency_key
+`
+
+type CreateRefundParams struct {
+	PaymentID        int64         `json:"payment_id"`
+	AppointmentID    int64         `json:"appointment_id"`
+	Amount           string        `json:"amount"`
+	Currency         string        `json:"currency"`
+	Reason           string        `json:"reason"`
+	InitiatedBy      sql.NullInt64 `json:"initiated_by"`
+	ProviderRefundID string        `json:"provider_refund_id"`
+	ProviderStatus   string        `json:"provider_status"`
+	IdempotencyKey   string        `json:"idempotency_key"`
+}
+
+func (q *Queries) CreateRefund(ctx context.Context, arg CreateRefundParams) (Refund, error) {
+	row := q.db.QueryRowContext(ctx, createRefund,
+		arg.PaymentID,
+		arg.AppointmentID,
+		arg.Amount,
+		arg.Currency,
+		arg.Reason,
+		arg.InitiatedBy,
+		arg.ProviderRefundID,
+		arg.ProviderStatus,
+		arg.IdempotencyKey,
+	)
+	var i Refund
+	err := row.Scan(
+		&i.RefundID,
+		&i.PaymentID,
+		&i.AppointmentID,
+		&i.Amount,
+		&i.Currency,
+		&i.Reason,
+		&i.InitiatedBy,
+		&i.ProviderRefundID,
+		&i.ProviderStatus,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.IdempotencyKey,
+	)
+	return i, err
+}
+
+const setRefundProviderResult = `-- name: SetRefundProviderResult :one
+UPDATE refunds SET
+  provider_refund_id = $1,
+  provider_status = CASE WHEN provider_status = 'pending' THEN $2::text ELSE provider_status END,
+  updated_at = now()
+WHERE refund_id = $3
+RETURNING refund_id, payment_id, appointment_id, amount, currency, reason, initiated_by, provider_refund_id, provider_status, created_at, updated_at, idempotency_key
+`
+
+type SetRefundProviderResultParams struct {
+	ProviderRefundID string `json:"provider_refund_id"`
+	ProviderStatus   string `json:"provider_status"`
+	RefundID         int64  `json:"refund_id"`
+}
+
+// records what the provider answered when the refund was sent , a status the refund webhook already set is kept
+func (q *Queries) SetRefundProviderResult(ctx context.Context, arg SetRefundProviderResultParams) (Refund, error) {
+	row := q.db.QueryRowContext(ctx, setRefundProviderResult, arg.ProviderRefundID, arg.ProviderStatus, arg.RefundID)
+	var i Refund
+	err := row.Scan(
+		&i.RefundID,
+		&i.PaymentID,
+		&i.AppointmentID,
+		&i.Amount,
+		&i.Currency,
+		&i.Reason,
+		&i.InitiatedBy,
+		&i.ProviderRefundID,
+		&i.ProviderStatus,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.IdempotencyKey,
+	)
+	return i, err
+}
+
+const updateRefundProviderStatus = `-- name: UpdateRefundProviderStatus :one
+UPDATE refunds SET provider_status = $1, updated_at = now()
+WHERE refund_id = (
+  SELECT r.refund_id FROM refunds r
+  JOIN payments p ON p.payment_id = r.payment_id
+  WHERE ($2::text = '' OR p.reference = $2::text)
+    -- the webhook can arrive before the provider's answer to the refund request has been recorded
+    AND ($3::text = '' OR r.provider_refund_id = $3::text
+      OR (r.provider_refund_id = '' AND $2::text <> ''))
+  ORDER BY r.created_at DESC
+  LIMIT 1
+)
+RETURNING refund_id, payment_id, appointment_id, amount, currency, reason, initiated_by, provider_refund_id, provider_status, created_at, updated_at, idempotency_key
+`
+
+type UpdateRefundProviderStatusParams struct {
+	ProviderStatus   string `json:"provider_status"`
+	Reference        string `json:"reference"`
+	ProviderRefundID string `json:"provider_refund_id"`
+}
+
+// the latest refund of the payment is updated when the provider doesn't send the refund id ,
+// the refund is found by its id alone when the provider doesn't send the payment reference
+func (q *Queries) UpdateRefundProviderStatus(ctx context.Context, arg UpdateRefundProviderStatusParams) (Refund, error) {
+	row := q.db.QueryRowContext(ctx, updateRefundProviderStatus, arg.ProviderStatus, arg.Reference, arg.ProviderRefundID)
+	var i Refund
+	err := row.Scan(
+		&i.RefundID,
+		&i.PaymentID,
+		&i.AppointmentID,
+		&i.Amount,
+		&i.Currency,
+		&i.Reason,
+		&i.InitiatedBy,
+		&i.ProviderRefundID,
+		&i.ProviderStatus,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.IdempotencyKey,
+	)
+	return i, err
+}
@@ -0,0 +1,151 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: sessions.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createSession = `-- name: CreateSession :one
+INSERT INTO sessions(session_id, user_id, refresh_token_id, user_agent, client_ip, expires_at) VALUES ($1,$2,$3,$4,$5,$6) RETURNING session_id, user_id, refresh_token_id, user_agent, client_ip, is_revoked, expires_at, created_at, revoked_at
+`
+
+type CreateSessionParams struct {
+	SessionID      uuid.UUID `json:"session_id"`
+	UserID         int64     `json:"user_id"`
+	RefreshTokenID uuid.UUID `json:"refresh_token_id"`
+	UserAgent      string    `json:"user_agent"`
+	ClientIp       string    `json:"client_ip"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error) {
+	row := q.db.QueryRowContext(ctx, createSession,
+		arg.SessionID,
+		arg.UserID,
+		arg.RefreshTokenID,
+		arg.UserAgent,
+		arg.ClientIp,
+		arg.ExpiresAt,
+	)
+	var i Session
+	err := row.Scan(
+		&i.SessionID,
+		&i.UserID,
+		&i.RefreshTokenID,
+		&i.UserAgent,
+		&i.ClientIp,
+		&i.IsRevoked,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const getSession = `-- name: GetSession :one
+SELECT session_id, user_id, refresh_token_id, user_agent, client_ip, is_revoked, expires_at, created_at, revoked_at FROM sessions WHERE session_id=$1
+`
+
+func (q *Queries) GetSession(ctx context.Context, sessionID uuid.UUID) (Session, error) {
+	row := q.db.QueryRowContext(ctx, getSession, sessionID)
+	var i Session
+	err := row.Scan(
+		&i.SessionID,
+		&i.UserID,
+		&i.RefreshTokenID,
+		&i.UserAgent,
+		&i.ClientIp,
+		&i.IsRevoked,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const getSessionForAuth = `-- name: GetSessionForAuth :one
+SELECT s.session_id, s.user_id, s.is_revoked, u.password_changed_at
+FROM sessions s
+JOIN users u ON u.user_id = s.user_id
+WHERE s.session_id=$1
+`
+
+type GetSessionForAuthRow struct {
+	SessionID         uuid.UUID `json:"session_id"`
+	UserID            int64     `json:"user_id"`
+	IsRevoked         bool      `json:"is_revoked"`
+	PasswordChangedAt time.Time `json:"password_changed_at"`
+}
+
+// everything the auth middleware needs to decide if an access token is still valid
+func (q *Queries) GetSessionForAuth(ctx context.Context, sessionID uuid.UUID) (GetSessionForAuthRow, error) {
+	row := q.db.QueryRowContext(ctx, getSessionForAuth, sessionID)
+	var i GetSessionForAuthRow
+	err := row.Scan(
+		&i.SessionID,
+		&i.UserID,
+		&i.IsRevoked,
+		&i.PasswordChangedAt,
+	)
+	return i, err
+}
+
+const revokeSession = `-- name: RevokeSession :exec
+UPDATE sessions SET is_revoked=true, revoked_at=now() WHERE session_id=$1 AND is_revoked=false
+`
+
+func (q *Queries) RevokeSession(ctx context.Context, sessionID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeSession, sessionID)
+	return err
+}
+
+const revokeUserSessions = `-- name: RevokeUserSessions :exec
+UPDATE sessions SET is_revoked=true, revoked_at=now() WHERE user_id=$1 AND is_revoked=false
+`
+
+func (q *Queries) RevokeUserSessions(ctx context.Context, userID int64) error {
+	_, err := q.db.ExecContext(ctx, revokeUserSessions, userID)
+	return err
+}
+
+const rotateSessionRefreshToken = `-- name: RotateSessionRefreshToken :one
+UPDATE sessions SET refresh_token_id = $1, expires_at = $2
+WHERE session_id = $3 AND refresh_token_id = $4 AND is_revoked=false
+RETURNING session_id, user_id, refresh_token_id, user_agent, client_ip, is_revoked, expires_at, created_at, revoked_at
+`
+
+type RotateSessionRefreshTokenParams struct {
+	NewRefreshTokenID     uuid.UUID `json:"new_refresh_token_id"`
+	ExpiresAt             time.Time `json:"expires_at"`
+	SessionID             uuid.UUID `json:"session_id"`
+	CurrentRefreshTokenID uuid.UUID `json:"current_refresh_token_id"`
+}
+
+func (q *Queries) RotateSessionRefreshToken(ctx context.Context, arg RotateSessionRefreshTokenParams) (Session, error) {
+	row := q.db.QueryRowContext(ctx, rotateSessionRefreshToken,
+		arg.NewRefreshTokenID,
+		arg.ExpiresAt,
+		arg.SessionID,
+		arg.CurrentRefreshTokenID,
+	)
+	var i Session
+	err := row.Scan(
+		&i.SessionID,
+		&i.UserID,
+		&i.RefreshTokenID,
+		&i.UserAgent,
+		&i.ClientIp,
+		&i.IsRevoked,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
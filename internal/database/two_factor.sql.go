@@ -0,0 +1,134 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: two_factor.sql
+
+package database
+
+import (
+	"context"
+)
+
+const createRecoveryCode = `-- name: CreateRecoveryCode :exec
+INSERT INTO two_factor_recovery_codes(user_id, code_hash) VALUES ($1,$2)
+`
+
+type CreateRecoveryCodeParams struct {
+	UserID   int64  `json:"user_id"`
+	CodeHash string `json:"code_hash"`
+}
+
+func (q *Queries) CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) error {
+	_, err := q.db.ExecContext(ctx, createRecoveryCode, arg.UserID, arg.CodeHash)
+	return err
+}
+
+const deleteRecoveryCodes = `-- name: DeleteRecoveryCodes :exec
+DELETE FROM two_factor_recovery_codes WHERE user_id=$1
+`
+
+func (q *Queries) DeleteRecoveryCodes(ctx context.Context, userID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteRecoveryCodes, userID)
+	return err
+}
+
+const deleteTwoFactor = `-- name: DeleteTwoFactor :exec
+DELETE FROM user_two_factor WHERE user_id=$1
+`
+
+func (q *Queries) DeleteTwoFactor(ctx context.Context, userID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteTwoFactor, userID)
+	return err
+}
+
+const enableTwoFactor = `-- name: EnableTwoFactor :exec
+UPDATE user_two_factor SET enabled_at=now(), last_used_step=$2 WHERE user_id=$1 AND enabled_at IS NULL
+`
+
+type EnableTwoFactorParams struct {
+	UserID       int64 `json:"user_id"`
+	LastUsedStep int64 `json:"last_used_step"`
+}
+
+func (q *Queries) EnableTwoFactor(ctx context.Context, arg EnableTwoFactorParams) error {
+	_, err := q.db.ExecContext(ctx, enableTwoFactor, arg.UserID, arg.LastUsedStep)
+	return err
+}
+
+const getUserTwoFactor = `-- name: GetUserTwoFactor :one
+SELECT user_id, secret_ciphertext, enabled_at, last_used_step, created_at FROM user_two_factor WHERE user_id=$1
+`
+
+func (q *Queries) GetUserTwoFactor(ctx context.Context, userID int64) (UserTwoFactor, error) {
+	row := q.db.QueryRowContext(ctx, getUserTwoFactor, userID)
+	var i UserTwoFactor
+	err := row.Scan(
+		&i.UserID,
+		&i.SecretCiphertext,
+		&i.EnabledAt,
+		&i.LastUsedStep,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const upsertPendingTwoFactor = `-- name: UpsertPendingTwoFactor :one
+INSERT INTO user_two_factor(user_id, secret_ciphertext) VALUES ($1,$2)
+ON CONFLICT (user_id) DO UPDATE SET secret_ciphertext=EXCLUDED.secret_ciphertext, last_used_step=0, created_at=now()
+WHERE user_two_factor.enabled_at IS NULL
+RETURNING user_id, secret_ciphertext, enabled_at, last_used_step, created_at
+`
+
+type UpsertPendingTwoFactorParams struct {
+	UserID           int64  `json:"user_id"`
+	SecretCiphertext string `json:"secret_ciphertext"`
+}
+
+// starts (or restarts) enrolment , an enabled configuration is never overwritten
+func (q *Queries) UpsertPendingTwoFactor(ctx context.Context, arg UpsertPendingTwoFactorParams) (UserTwoFactor, error) {
+	row := q.db.QueryRowContext(ctx, upsertPendingTwoFactor, arg.UserID, arg.SecretCiphertext)
+	var i UserTwoFactor
+	err := row.Scan(
+		&i.UserID,
+		&i.SecretCiphertext,
+		&i.EnabledAt,
+		&i.LastUsedStep,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const useRecoveryCode = `-- name: UseRecoveryCode :one
+UPDATE two_factor_recovery_codes SET used_at=now()
+WHERE user_id=$1 AND code_hash=$2 AND used_at IS NULL
+RETURNING code_id
+`
+
+type UseRecoveryCodeParams struct {
+	UserID   int64  `json:"user_id"`
+	CodeHash string `json:"code_hash"`
+}
+
+func (q *Queries) UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, useRecoveryCode, arg.UserID, arg.CodeHash)
+	var code_id int64
+	err := row.Scan(&code_id)
+	return code_id, err
+}
+
+const useTwoFactorStep = `-- name: UseTwoFactorStep :one
+UPDATE user_two_factor SET last_used_step=$2 WHERE user_id=$1 AND last_used_step < $2 RETURNING user_id
+`
+
+type UseTwoFactorStepParams struct {
+	UserID       int64 `json:"user_id"`
+	LastUsedStep int64 `json:"last_used_step"`
+}
+
+// records the accepted TOTP step , returns no rows if the step (or a later one) was already used
+func (q *Queries) UseTwoFactorStep(ctx context.Context, arg UseTwoFactorStepParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, useTwoFactorStep, arg.UserID, arg.LastUsedStep)
+	var user_id int64
+	err := row.Scan(&user_id)
+	return user_id, err
+}
@@ -20,7 +20,7 @@ func (q *Queries) CompleteOnboarding(ctx context.Context, userID int64) error {
 }
 
 const createUser = `-- name: CreateUser :one
-INSERT INTO users(full_name , password ,date_of_birth, email , telephone_number ,user_role) VALUES ($1,$2,$3,$4,$5,$6) RETURNING user_id, date_of_birth, full_name, password, email, telephone_number, profile_image_url, created_at, user_role, verified_at, is_onboarded, password_changed_at
+INSERT INTO users(full_name , password ,date_of_birth, email , telephone_number ,user_role) VALUES ($1,$2,$3,$4,$5,$6) RETURNING user_id, date_of_birth, full_name, password, email, telephone_number, profile_image_url, created_at, user_role, verified_at, is_onboarded, password_changed_at, verification_sent_at
 `
 
 type CreateUserParams struct {
@@ -55,12 +55,13 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.VerifiedAt,
 		&i.IsOnboarded,
 		&i.PasswordChangedAt,
+		&i.VerificationSentAt,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT user_id, date_of_birth, full_name, password, email, telephone_number, profile_image_url, created_at, user_role, verified_at, is_onboarded, password_changed_at FROM users WHERE email=$1
+SELECT user_id, date_of_birth, full_name, password, email, telephone_number, profile_image_url, created_at, user_role, verified_at, is_onboarded, password_changed_at, verification_sent_at FROM users WHERE email=$1
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
@@ -79,12 +80,13 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.VerifiedAt,
 		&i.IsOnboarded,
 		&i.PasswordChangedAt,
+		&i.VerificationSentAt,
 	)
 	return i, err
 }
 
 const getUserById = `-- name: GetUserById :one
-SELECT user_id, date_of_birth, full_name, password, email, telephone_number, profile_image_url, created_at, user_role, verified_at, is_onboarded, password_changed_at FROM users WHERE user_id=$1
+SELECT user_id, date_of_birth, full_name, password, email, telephone_number, profile_image_url, created_at, user_role, verified_at, is_onboarded, password_changed_at, verification_sent_at FROM users WHERE user_id=$1
 `
 
 func (q *Queries) GetUserById(ctx context.Context, userID int64) (User, error) {
@@ -103,6 +105,7 @@ func (q *Queries) GetUserById(ctx context.Context, userID int64) (User, error) {
 		&i.VerifiedAt,
 		&i.IsOnboarded,
 		&i.PasswordChangedAt,
+		&i.VerificationSentAt,
 	)
 	return i, err
 }
@@ -145,6 +148,40 @@ func (q *Queries) GetUsers(ctx context.Context, arg GetUsersParams) ([]GetUsersR
 	return items, nil
 }
 
+const markVerificationEmailSent = `-- name: MarkVerificationEmailSent :one
+UPDATE users SET verification_sent_at=now()
+WHERE user_id = $1 AND verified_at IS NULL
+AND (verification_sent_at IS NULL OR verification_sent_at < $2::timestamptz)
+RETURNING user_id, date_of_birth, full_name, password, email, telephone_number, profile_image_url, created_at, user_role, verified_at, is_onboarded, password_changed_at, verification_sent_at
+`
+
+type MarkVerificationEmailSentParams struct {
+	UserID     int64     `json:"user_id"`
+	SentBefore time.Time `json:"sent_before"`
+}
+
+// only succeeds if the user is unverified and the last email was sent before @sent_before
+func (q *Queries) MarkVerificationEmailSent(ctx context.Context, arg MarkVerificationEmailSentParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, markVerificationEmailSent, arg.UserID, arg.SentBefore)
+	var i User
+	err := row.Scan(
+		&i.UserID,
+		&i.DateOfBirth,
+		&i.FullName,
+		&i.Password,
+		&i.Email,
+		&i.TelephoneNumber,
+		&i.ProfileImageUrl,
+		&i.CreatedAt,
+		&i.UserRole,
+		&i.VerifiedAt,
+		&i.IsOnboarded,
+		&i.PasswordChangedAt,
+		&i.VerificationSentAt,
+	)
+	return i, err
+}
+
 const updateProfilePicture = `-- name: UpdateProfilePicture :exec
 UPDATE users SET profile_image_url=$1 WHERE user_id=$2
 `
@@ -160,7 +197,9 @@ func (q *Queries) UpdateProfilePicture(ctx context.Context, arg UpdateProfilePic
 }
 
 const updateUser = `-- name: UpdateUser :exec
-UPDATE users SET full_name=$1 ,email=$2 , telephone_number=$3 WHERE user_id=$4
+UPDATE users SET full_name=$1 ,email=$2 , telephone_number=$3,
+verified_at = CASE WHEN email=$2 THEN verified_at ELSE NULL END
+WHERE user_id=$4
 `
 
 type UpdateUserParams struct {
@@ -170,6 +209,7 @@ type UpdateUserParams struct {
 	UserID          int64  `json:"user_id"`
 }
 
+// changing the email address means the new one has to be verified again
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) error {
 	_, err := q.db.ExecContext(ctx, updateUser,
 		arg.FullName,
@@ -179,3 +219,32 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) error {
 	)
 	return err
 }
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users SET password=$1, password_changed_at=$2 WHERE user_id=$3
+`
+
+type UpdateUserPasswordParams struct {
+	Password          string    `json:"password"`
+	PasswordChangedAt time.Time `json:"password_changed_at"`
+	UserID            int64     `json:"user_id"`
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.Password, arg.PasswordChangedAt, arg.UserID)
+	return err
+}
+
+const verifyUserEmail = `-- name: VerifyUserEmail :exec
+UPDATE users SET verified_at=now() WHERE user_id=$1 AND email=$2 AND verified_at IS NULL
+`
+
+type VerifyUserEmailParams struct {
+	UserID int64  `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) error {
+	_, err := q.db.ExecContext(ctx, verifyUserEmail, arg.UserID, arg.Email)
+	return err
+}
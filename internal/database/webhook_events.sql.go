@@ -0,0 +1,79 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: webhook_events.sql
+
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const claimWebhookEvent = `-- name: ClaimWebhookEvent :one
+INSERT INTO webhook_events (
+  event_id,
+  provider,
+  event,
+  payload,
+  claimed_at
+) VALUES (
+  $1, $2, $3, $4, now()
+)
+ON CONFLICT (event_id) DO UPDATE SET attempts = webhook_events.attempts + 1, claimed_at = now()
+WHERE webhook_events.processed_at IS NULL
+  AND (webhook_events.claimed_at IS NULL OR webhook_events.claimed_at < $5::timestamptz)
+RETURNING event_id, provider, event, payload, attempts, received_at, processed_at, claimed_at
+`
+
+type ClaimWebhookEventParams struct {
+	EventID       string          `json:"event_id"`
+	Provider      string          `json:"provider"`
+	Event         string          `json:"event"`
+	Payload       json.RawMessage `json:"payload"`
+	ClaimedBefore time.Time       `json:"claimed_before"`
+}
+
+// returns no rows if the event has already been processed or another delivery of it is being processed ,
+// events that failed part way are claimed again and so are claims older than claimed_before (the server stopped part way)
+func (q *Queries) ClaimWebhookEvent(ctx context.Context, arg ClaimWebhookEventParams) (WebhookEvent, error) {
+	row := q.db.QueryRowContext(ctx, claimWebhookEvent,
+		arg.EventID,
+		arg.Provider,
+		arg.Event,
+		arg.Payload,
+		arg.ClaimedBefore,
+	)
+	var i WebhookEvent
+	err := row.Scan(
+		&i.EventID,
+		&i.Provider,
+		&i.Event,
+		&i.Payload,
+		&i.Attempts,
+		&i.ReceivedAt,
+		&i.ProcessedAt,
+		&i.ClaimedAt,
+	)
+	return i, err
+}
+
+const markWebhookEventProcessed = `-- name: MarkWebhookEventProcessed :exec
+UPDATE webhook_events SET processed_at = now() WHERE event_id = $1
+`
+
+func (q *Queries) MarkWebhookEventProcessed(ctx context.Context, eventID string) error {
+	_, err := q.db.ExecContext(ctx, markWebhookEventProcessed, eventID)
+	return err
+}
+
+const releaseWebhookEvent = `-- name: ReleaseWebhookEvent :exec
+UPDATE webhook_events SET claimed_at = NULL WHERE event_id = $1 AND processed_at IS NULL
+`
+
+// lets the provider's retry of an event that failed be processed straight away
+func (q *Queries) ReleaseWebhookEvent(ctx context.Context, eventID string) error {
+	_, err := q.db.ExecContext(ctx, releaseWebhookEvent, eventID)
+	return err
+}
@@ -1,34 +1,29 @@
 package mailer
 
-//
-// type Mailer interface {
-// 	SendEmail() error
-// }
 import (
-	"fmt"
-	"log"
-	"os"
+	"context"
+	"errors"
+)
 
-	_ "github.com/joho/godotenv/autoload"
+var ErrMissingRecipient = errors.New("the email has no recipient")
 
-	"github.com/sendgrid/sendgrid-go"
-	"github.com/sendgrid/sendgrid-go/helpers/mail"
-)
+// Message is a single transactional email
+type Message struct {
+	ToName    string
+	ToAddress string
+	Subject   string
+	PlainText string
+	HTML      string
+	// files sent with the email , e.g. a calendar invite
+	Attachments []Attachment
+}
+
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+}
 
-func SendEmail() {
-	from := mail.NewEmail("Example User", "lyra.telemedicine@gmail.com")
-	subject := "Sending with SendGrid is Fun"
-	to := mail.NewEmail("Example User", "test@example.com")
-	plainTextContent := "and easy to do anywhere, even with Go"
-	htmlContent := "<strong>and easy to do anywhere, even with Go</strong>"
-	message := mail.NewSingleEmail(from, subject, to, plainTextContent, htmlContent)
-	client := sendgrid.NewSendClient(os.Getenv("SENDGRID_API_KEY"))
-	response, err := client.Send(message)
-	if err != nil {
-		log.Println(err)
-	} else {
-		fmt.Println(response.StatusCode)
-		fmt.Println(response.Body)
-		fmt.Println(response.Headers)
-	}
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
 }
@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+type SendGridMailer struct {
+	client    *sendgrid.Client
+	fromName  string
+	fromEmail string
+}
+
+func NewSendGridMailer(apiKey, fromName, fromEmail string) (Mailer, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("the sendgrid api key is missing")
+	}
+	if fromEmail == "" {
+		return nil, fmt.Errorf("the sender email address is missing")
+	}
+	return &SendGridMailer{
+		client:    sendgrid.NewSendClient(apiKey),
+		fromName:  fromName,
+		fromEmail: fromEmail,
+	}, nil
+}
+
+func (m *SendGridMailer) Send(ctx context.Context, message Message) error {
+	if message.ToAddress == "" {
+		return ErrMissingRecipient
+	}
+	from := mail.NewEmail(m.fromName, m.fromEmail)
+	to := mail.NewEmail(message.ToName, message.ToAddress)
+	email := mail.NewSingleEmail(from, message.Subject, to, message.PlainText, message.HTML)
+	for _, file := range message.Attachments {
+		attachment := mail.NewAttachment()
+		attachment.SetFilename(file.Filename)
+		attachment.SetType(file.ContentType)
+		attachment.SetDisposition("attachment")
+		attachment.SetContent(base64.StdEncoding.EncodeToString(file.Content))
+		email.AddAttachment(attachment)
+	}
+
+	response, err := m.client.SendWithContext(ctx, email)
+	if err != nil {
+		return fmt.Errorf("unable to send the email:%v", err)
+	}
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("unable to send the email , sendgrid responded with status %d: %s", response.StatusCode, response.Body)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package mailer
+
+import (
+	"fmt"
+	"html"
+	"time"
+)
+
+func NewVerificationEmail(name, address, link string) Message {
+	return Message{
+		ToName:    name,
+		ToAddress: address,
+		Subject:   "Verify your Lyra email address",
+		PlainText: fmt.Sprintf("Hi %s,\n\nPlease verify your email address by opening the link below:\n\n%s\n\nIf you didn't create a Lyra account you can ignore this email.", name, link),
+		HTML: fmt.Sprintf(`<p>Hi %s,</p><p>Please verify your email address by clicking the link below:</p><p><a href="%s">Verify my email</a></p><p>If you didn't create a Lyra account you can ignore this email.</p>`,
+			html.EscapeString(name), html.EscapeString(link)),
+	}
+}
+
+func NewPasswordResetEmail(name, address, link string, validFor time.Duration) Message {
+	return Message{
+		ToName:    name,
+		ToAddress: address,
+		Subject:   "Reset your Lyra password",
+		PlainText: fmt.Sprintf("Hi %s,\n\nWe received a request to reset your password. Open the link below to choose a new one, it expires in %s:\n\n%s\n\nIf you didn't request a password reset you can ignore this email.", name, validFor, link),
+		HTML: fmt.Sprintf(`<p>Hi %s,</p><p>We received a request to reset your password. Click the link below to choose a new one, it expires in %s:</p><p><a href="%s">Reset my password</a></p><p>If you didn't request a password reset you can ignore this email.</p>`,
+			html.EscapeString(name), validFor, html.EscapeString(link)),
+	}
+}
+
+func NewBreakGlassNotificationEmail(name, address, doctorName, reason string, expiresAt time.Time) Message {
+	until := expiresAt.UTC().Format("2 Jan 2006 15:04 MST")
+	return Message{
+		ToName:    name,
+		ToAddress: address,
+		Subject:   "Emergency access to your Lyra health record",
+		PlainText: fmt.Sprintf("Hi %s,\n\nDr. %s has been given emergency access to your health record until %s.\n\nThe reason they gave was:\n\n%s\n\nIf you have any concerns please contact our support team.", name, doctorName, until, reason),
+		HTML: fmt.Sprintf(`<p>Hi %s,</p><p>Dr. %s has been given emergency access to your health record until %s.</p><p>The reason they gave was:</p><blockquote>%s</blockquote><p>If you have any concerns please contact our support team.</p>`,
+			html.EscapeString(name), html.EscapeString(doctorName), until, html.EscapeString(reason)),
+	}
+}
+
+func NewAccountLockedEmail(name, address, link string, lockedUntil time.Time) Message {
+	until := lockedUntil.UTC().Format("2 Jan 2006 15:04 MST")
+	return Message{
+		ToName:    name,
+		ToAddress: address,
+		Subject:   "Your Lyra account has been locked",
+		PlainText: fmt.Sprintf("Hi %s,\n\nWe locked your account until %s after several failed attempts to log in. If this was you, open the link below to unlock it now:\n\n%s\n\nIf it wasn't you, someone may be trying to guess your password. We recommend resetting it once you're back in.", name, until, link),
+		HTML: fmt.Sprintf(`<p>Hi %s,</p><p>We locked your account until %s after several failed attempts to log in. If this was you, click the link below to unlock it now:</p><p><a href="%s">Unlock my account</a></p><p>If it wasn't you, someone may be trying to guess your password. We recommend resetting it once you're back in.</p>`,
+			html.EscapeString(name), until, html.EscapeString(link)),
+	}
+}
+
+// NewAppointmentInviteEmail carries the calendar invite of an appointment , or its cancellation ,
+// the invite is attached as an .ics file that mail clients offer to add to the recipient's calendar
+func NewAppointmentInviteEmail(name, address, title string, start time.Time, cancelled bool, invite []byte, method string) Message {
+	when := start.Format("Mon 2 Jan 2006 15:04 MST")
+	subject := fmt.Sprintf("Invitation: %s on %s", title, when)
+	text := fmt.Sprintf("Hi %s,\n\nYour appointment (%s) is on %s. The attached invite adds it to your calendar and keeps it up to date if it changes.", name, title, when)
+	body := fmt.Sprintf(`<p>Hi %s,</p><p>Your appointment (%s) is on %s. The attached invite adds it to your calendar and keeps it up to date if it changes.</p>`,
+		html.EscapeString(name), html.EscapeString(title), when)
+	if cancelled {
+		subject = fmt.Sprintf("Cancelled: %s on %s", title, when)
+		text = fmt.Sprintf("Hi %s,\n\nYour appointment (%s) on %s has been cancelled. The attached update removes it from your calendar.", name, title, when)
+		body = fmt.Sprintf(`<p>Hi %s,</p><p>Your appointment (%s) on %s has been cancelled. The attached update removes it from your calendar.</p>`,
+			html.EscapeString(name), html.EscapeString(title), when)
+	}
+	return Message{
+		ToName:    name,
+		ToAddress: address,
+		Subject:   subject,
+		PlainText: text,
+		HTML:      body,
+		Attachments: []Attachment{{
+			Filename:    "invite.ics",
+			ContentType: fmt.Sprintf("text/calendar; charset=utf-8; method=%s", method),
+			Content:     invite,
+		}},
+	}
+}
@@ -5,11 +5,38 @@ import "time"
 type UpdateAppointmentStatusRequest struct {
 	AppointmentID int64  `json:"appointment_id" validate:"required"`
 	Status        string `json:"status" validate:"required"`
+	Reason        string `json:"reason" validate:"max=500"`
 }
 type CreateAppointmentRequest struct {
 	DoctorID  int64     `json:"doctor_id" validate:"required"`
 	StartTime time.Time `json:"start_time" validate:"required"`
 	EndTime   time.Time `json:"end_time" validate:"required" `
 	Reason    string    `json:"reason" validate:"required"`
-	Amount    string    `json:"amount" validate:"required"`
+	// paystack when it's empty
+	PaymentMethod string `json:"payment_method" validate:"omitempty,oneof=paystack mpesa"`
+	// the phone the M-Pesa prompt is sent to
+	PhoneNumber string `json:"phone_number" validate:"required_if=PaymentMethod mpesa"`
+}
+type CreateAppointmentResponse struct {
+	PaymentMethod string `json:"payment_method"`
+	Reference     string `json:"reference"`
+	// the checkout page the patient pays on , empty for M-Pesa where the patient confirms a prompt on their phone instead
+	AuthorizationURL string `json:"authorization_url,omitempty"`
+	Amount           string `json:"amount"`
+	Message          string `json:"message"`
+}
+type CancelAppointmentRequest struct {
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+type CancelAppointmentResponse struct {
+	AppointmentID int64  `json:"appointment_id"`
+	Status        string `json:"status"`
+	PaymentStatus string `json:"payment_status"`
+	RefundAmount  string `json:"refund_amount"`
+	// the status of the refund on paystack , refunds are processed asynchronously so this starts out as pending
+	RefundStatus string `json:"refund_status,omitempty"`
+}
+type RescheduleAppointmentRequest struct {
+	StartTime time.Time `json:"start_time" validate:"required"`
+	Reason    string    `json:"reason" validate:"max=500"`
 }
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+)
+
+type ListAuditEventsResponse struct {
+	Events  []database.AuditEvent `json:"events"`
+	HasMore bool                  `json:"has_more"`
+}
+
+// RecordAccess is a single entry of the patient's "who accessed my record" view
+type RecordAccess struct {
+	ActorName    string    `json:"actor_name"`
+	ActorRole    string    `json:"actor_role"`
+	ResourceType string    `json:"resource_type"`
+	Action       string    `json:"action"`
+	OccurredAt   time.Time `json:"occurred_at"`
+}
+
+type ListRecordAccessesResponse struct {
+	Accesses []RecordAccess `json:"accesses"`
+	HasMore  bool           `json:"has_more"`
+}
+
+type AuditChainVerification struct {
+	Valid         bool  `json:"valid"`
+	EventsChecked int64 `json:"events_checked"`
+	// set when the chain is broken , every event from this one on can't be trusted
+	FirstInvalidEventID int64 `json:"first_invalid_event_id,omitempty"`
+}
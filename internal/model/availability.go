@@ -12,7 +12,73 @@ type CreateAvailabilityRequest struct {
 }
 
 type GetSlotsRequest struct {
-	DoctorID  int64     `json:"doctor_id" validate:"required"`
-	DayOfWeek int32     `json:"day_of_week" default:"0"`
-	SlotDate  time.Time `json:"slot_date" validate:"required"`
+	DoctorID int64 `json:"doctor_id" validate:"required"`
+	// the date on the doctor's calendar , its day of the week is worked out from it
+	SlotDate time.Time `json:"slot_date" validate:"required"`
+}
+
+// Slot is a slot of a doctor's schedule , in UTC and in the doctor's timezone
+type Slot struct {
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	// the same times with the doctor's UTC offset
+	LocalStartTime time.Time `json:"local_start_time"`
+	LocalEndTime   time.Time `json:"local_end_time"`
+	Timezone       string    `json:"timezone"`
+	// the doctor's wall clock times
+	SlotStartTime string `json:"slot_start_time"`
+	SlotEndTime   string `json:"slot_end_time"`
+	SlotStatus    string `json:"slot_status"`
+}
+
+type SetTimezoneRequest struct {
+	Timezone string `json:"timezone" validate:"required"`
+}
+
+// SetBookingRulesRequest replaces the doctor's booking rules , a zero horizon means bookings can be made any time ahead
+type SetBookingRulesRequest struct {
+	BufferMinutes    int32 `json:"buffer_minutes" validate:"min=0,max=240"`
+	MinNoticeMinutes int32 `json:"min_notice_minutes" validate:"min=0,max=43200"`
+	HorizonDays      int32 `json:"horizon_days" validate:"min=0,max=730"`
+}
+
+type CreateAvailabilityExceptionRequest struct {
+	// a block takes the doctor out for the range , extra hours open slots of interval_minutes in it
+	Kind            string    `json:"kind" validate:"required,oneof=block extra"`
+	StartsAt        time.Time `json:"starts_at" validate:"required"`
+	EndsAt          time.Time `json:"ends_at" validate:"required"`
+	IntervalMinutes int32     `json:"interval_minutes"`
+	Reason          string    `json:"reason" validate:"max=255"`
+}
+
+type SetPublicHolidaysRequest struct {
+	Observe *bool `json:"observe" validate:"required"`
+}
+
+// SlotSearchRequest looks for open slots of the doctors that match the GetDoctors filters in [From, To)
+type SlotSearchRequest struct {
+	County         string
+	Specialization string
+	MinPrice       string
+	MaxPrice       string
+	MinExperience  int32
+	MaxExperience  int32
+	// dates on each doctor's own calendar
+	From time.Time
+	To   time.Time
+	// how many of the earliest open slots are returned for each doctor
+	SlotsPerDoctor int32
+	Limit          int32
+	Offset         int32
+}
+
+// DoctorSlots is a doctor with their earliest open slots
+type DoctorSlots struct {
+	DoctorDetails
+	Slots []Slot `json:"slots"`
+}
+
+type SlotSearchResponse struct {
+	HasMore bool          `json:"has_more"`
+	Doctors []DoctorSlots `json:"doctors"`
 }
@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+// PatientAccessRequest describes a request that touches a patient's records
+type PatientAccessRequest struct {
+	// 0 when the caller didn't name a patient
+	PatientID int64
+	// only reads can be made under break-glass access
+	ReadOnly bool
+	// e.g "GET /api/v1/patients/1/allergies" , recorded for reads made under break-glass access
+	Resource string
+}
+
+type BreakGlassRequest struct {
+	PatientID int64 `json:"patient_id" validate:"required,gt=0"`
+	// a written justification is mandatory
+	Reason string `json:"reason" validate:"required,min=20,max=1000"`
+}
+
+type BreakGlassGrantResponse struct {
+	GrantID   int64     `json:"grant_id"`
+	PatientID int64     `json:"patient_id"`
+	Reason    string    `json:"reason"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ListBreakGlassGrantsResponse struct {
+	Grants  []BreakGlassGrantReport `json:"grants"`
+	HasMore bool                    `json:"has_more"`
+}
+
+type BreakGlassGrantReport struct {
+	GrantID     int64     `json:"grant_id"`
+	DoctorID    int64     `json:"doctor_id"`
+	DoctorName  string    `json:"doctor_name"`
+	PatientID   int64     `json:"patient_id"`
+	PatientName string    `json:"patient_name"`
+	Reason      string    `json:"reason"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+	// number of reads made under the grant
+	AccessCount int64 `json:"access_count"`
+}
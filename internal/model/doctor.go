@@ -1,6 +1,10 @@
 package model
 
-import "github.com/mbeka02/lyra_backend/internal/database"
+import (
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+)
 
 type CreateDoctorRequest struct {
 	Specialization    string `json:"specialization" validate:"required"`
@@ -9,6 +13,8 @@ type CreateDoctorRequest struct {
 	County            string `json:"county" validate:"required"`
 	PricePerHour      string `json:"price_per_hour"  validate:"required"`
 	YearsOfExperience int32  `json:"years_of_experience" validate:"required"  `
+	// an IANA timezone like Africa/Nairobi , the doctor's availability is in it
+	Timezone string `json:"timezone"`
 }
 
 type DoctorDetails struct {
@@ -20,6 +26,7 @@ type DoctorDetails struct {
 	County            string `json:"county"`
 	PricePerHour      string `json:"price_per_hour"`
 	YearsOfExperience int32  `json:"years_of_experience"`
+	Timezone          string `json:"timezone"`
 }
 type GetDoctorsResponse struct {
 	HasMore bool            `json:"has_more"`
@@ -39,8 +46,38 @@ func NewDoctorDetails(rows []database.GetDoctorsRow) []DoctorDetails {
 			County:            row.County,
 			PricePerHour:      row.PricePerHour,
 			YearsOfExperience: row.YearsOfExperience,
+			Timezone:          row.Timezone,
 		})
 	}
 
 	return resp
 }
+
+// ReviewDoctorRequest is sent by admins when approving , rejecting or suspending a doctor
+type ReviewDoctorRequest struct {
+	Reason string `json:"reason" validate:"max=1000"`
+}
+
+type LicenseDocumentResponse struct {
+	DocumentID  int64  `json:"document_id"`
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	// a short lived link to the file
+	URL        string    `json:"url"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+type DoctorVerificationResponse struct {
+	DoctorID      int64                              `json:"doctor_id"`
+	LicenseNumber string                             `json:"license_number"`
+	Status        database.VerificationStatus        `json:"status"`
+	Reason        string                             `json:"reason"`
+	VerifiedAt    *time.Time                         `json:"verified_at,omitempty"`
+	Documents     []LicenseDocumentResponse          `json:"documents"`
+	History       []database.DoctorVerificationEvent `json:"history"`
+}
+
+type ListDoctorVerificationsResponse struct {
+	Doctors []database.ListDoctorsByVerificationStatusRow `json:"doctors"`
+	HasMore bool                                          `json:"has_more"`
+}
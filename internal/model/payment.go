@@ -1,6 +1,10 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
 
 type InitializeTransactionRequest struct {
 	Amount            int64    `json:"amount" validate:"required"`
@@ -13,7 +17,7 @@ type InitializeTransactionRequest struct {
 	Metadata          string   `json:"metadata,omitempty"`
 	SplitCode         string   `json:"split_code,omitempty"`
 	SubAccount        string   `json:"subaccount,omitempty"`
-	TransactionCharge int      `json:"transaction_charge,omitempty"`
+	TransactionCharge int64    `json:"transaction_charge,omitempty"` // A flat fee (in the subunit) the main account keeps when the payment is split with SubAccount , overrides the subaccount's percentage
 	Bearer            string   `json:"bearer,omitempty"`
 	Reference         string   `json:"reference,omitempty"`
 }
@@ -173,10 +177,42 @@ type VerifyTransactionResponse struct {
 	} `json:"data"`
 }
 
-// represents the payload sent to the webhook endpoint
+// represents the payload sent to the webhook endpoint , the shape of the data depends on the event
 type PaystackWebhookPayload struct {
-	Event string             `json:"event"`
-	Data  PaystackChargeData `json:"data"`
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// PaystackID is the id of a paystack object , some events send it as a number and others as a string
+type PaystackID string
+
+func (id *PaystackID) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	*id = PaystackID(strings.Trim(string(data), `"`))
+	return nil
+}
+
+// the data sent with refund.* events
+type PaystackRefundData struct {
+	ID                   PaystackID `json:"id"`
+	Status               string     `json:"status"`
+	TransactionReference string     `json:"transaction_reference"`
+	Currency             string     `json:"currency"`
+}
+
+// the data sent with charge.dispute.* events
+type PaystackDisputeData struct {
+	ID           PaystackID `json:"id"`
+	Status       string     `json:"status"`
+	Resolution   string     `json:"resolution"`
+	RefundAmount int64      `json:"refund_amount"`
+	Currency     string     `json:"currency"`
+	Transaction  struct {
+		Reference string `json:"reference"`
+		Currency  string `json:"currency"`
+	} `json:"transaction"`
 }
 
 type PaystackChargeData struct {
@@ -241,3 +277,63 @@ type Authorization struct {
 	Brand             string `json:"brand"`
 	AccountName       string `json:"account_name"`
 }
+
+// The request sent to paystack to refund a transaction , the amount is in the subunit of the currency and the whole transaction is refunded when it's left out
+type RefundRequest struct {
+	Transaction  string `json:"transaction" validate:"required"` // the reference or id of the transaction
+	Amount       int64  `json:"amount,omitempty"`
+	Currency     string `json:"currency,omitempty"`
+	CustomerNote string `json:"customer_note,omitempty"`
+	MerchantNote string `json:"merchant_note,omitempty"`
+}
+
+// Represents the paystack API response for creating a refund
+type RefundResponse struct {
+	Status  bool   `json:"status"`
+	Message string `json:"message"`
+	Data    struct {
+		ID             uint64 `json:"id"`
+		Domain         string `json:"domain"`
+		Amount         int64  `json:"amount"`
+		DeductedAmount int64  `json:"deducted_amount"`
+		Currency       string `json:"currency"`
+		Status         string `json:"status"`
+		CustomerNote   string `json:"customer_note"`
+		MerchantNote   string `json:"merchant_note"`
+		RefundedAt     string `json:"refunded_at"`
+		CreatedAt      string `json:"createdAt"`
+		Transaction    struct {
+			ID        uint64 `json:"id"`
+			Reference string `json:"reference"`
+			Amount    int64  `json:"amount"`
+			Currency  string `json:"currency"`
+		} `json:"transaction"`
+	} `json:"data"`
+}
+
+// The request sent to paystack to create or update the subaccount a doctor is paid out to
+type SubaccountRequest struct {
+	BusinessName        string  `json:"business_name"`
+	SettlementBank      string  `json:"settlement_bank"` // the bank code
+	AccountNumber       string  `json:"account_number"`
+	PercentageCharge    float64 `json:"percentage_charge"` // what the main account keeps when a transaction doesn't set its own charge
+	Description         string  `json:"description,omitempty"`
+	PrimaryContactEmail string  `json:"primary_contact_email,omitempty"`
+	PrimaryContactName  string  `json:"primary_contact_name,omitempty"`
+}
+
+// Represents the paystack API response for creating or updating a subaccount
+type SubaccountResponse struct {
+	Status  bool   `json:"status"`
+	Message string `json:"message"`
+	Data    struct {
+		ID               uint64  `json:"id"`
+		SubaccountCode   string  `json:"subaccount_code"`
+		BusinessName     string  `json:"business_name"`
+		SettlementBank   string  `json:"settlement_bank"` // the bank name
+		AccountNumber    string  `json:"account_number"`
+		PercentageCharge float64 `json:"percentage_charge"`
+		IsVerified       bool    `json:"is_verified"`
+		Currency         string  `json:"currency"`
+	} `json:"data"`
+}
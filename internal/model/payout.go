@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+)
+
+// The bank account a doctor wants their share of each payment settled to
+type RegisterPayoutAccountRequest struct {
+	BusinessName  string `json:"business_name" validate:"required,max=255"`
+	BankCode      string `json:"bank_code" validate:"required,max=20"`
+	AccountNumber string `json:"account_number" validate:"required,numeric,min=6,max=20"`
+}
+
+type DoctorEarningsResponse struct {
+	Summary database.GetDoctorEarningsSummaryRow `json:"summary"`
+	Entries []database.DoctorEarning             `json:"entries"`
+	HasMore bool                                 `json:"has_more"`
+}
+
+// PayoutReport is what each doctor earned over a period and what the platform still owes them
+type PayoutReport struct {
+	From    time.Time                       `json:"from"`
+	To      time.Time                       `json:"to"`
+	Doctors []database.ListDoctorPayoutsRow `json:"doctors"`
+	HasMore bool                            `json:"has_more"`
+}
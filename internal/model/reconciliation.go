@@ -0,0 +1,14 @@
+package model
+
+import "github.com/mbeka02/lyra_backend/internal/database"
+
+type ListReconciliationRunsResponse struct {
+	Runs    []database.ReconciliationRun `json:"runs"`
+	HasMore bool                         `json:"has_more"`
+}
+
+// ReconciliationReport is what a single reconciliation run found for each payment it checked
+type ReconciliationReport struct {
+	Run   database.ReconciliationRun    `json:"run"`
+	Items []database.ReconciliationItem `json:"items"`
+}
@@ -0,0 +1,47 @@
+package model
+
+import "time"
+
+type TwoFactorEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	// otpauth:// URI to render as a QR code for authenticator apps
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type ConfirmTwoFactorRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+type TwoFactorChallengeRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+}
+
+type VerifyTwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required_without=RecoveryCode"`
+	RecoveryCode   string `json:"recovery_code" validate:"required_without=Code"`
+}
+
+// MFAChallenge is returned instead of tokens when the password was correct but a second factor is still needed
+type MFAChallenge struct {
+	ChallengeToken string    `json:"challenge_token"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	// EnrollmentRequired is set when the user's role requires 2FA but they haven't set it up yet
+	EnrollmentRequired bool `json:"enrollment_required"`
+}
+
+type LoginResponse struct {
+	*AuthResponse
+	MFAChallenge *MFAChallenge `json:"mfa_challenge,omitempty"`
+	// only returned once , when 2FA is enabled as part of logging in
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
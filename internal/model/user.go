@@ -3,6 +3,7 @@ package model
 import (
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/mbeka02/lyra_backend/internal/database"
 )
 
@@ -11,7 +12,7 @@ type CreateUserRequest struct {
 	Email           string        `json:"email" validate:"required,email"`
 	TelephoneNumber string        `json:"telephone_number" validate:"required,max=15"`
 	Password        string        `json:"password" validate:"required,min=8"`
-	Role            database.Role `json:"role" validate:"required"`
+	Role            database.Role `json:"role" validate:"required,oneof=patient specialist"`
 	DateOfBirth     time.Time     `json:"date_of_birth" validate:"required"`
 }
 type UpdateUserRequest struct {
@@ -27,6 +28,7 @@ type UserResponse struct {
 	Role            database.Role `json:"role" `
 	ProfileImageURL string        `json:"profile_image_url"`
 	IsOnboarded     bool          `json:"is_onboarded"`
+	IsEmailVerified bool          `json:"is_email_verified"`
 }
 
 type LoginRequest struct {
@@ -34,8 +36,44 @@ type LoginRequest struct {
 	Password string `json:"password" validate:"required,min=8"`
 }
 
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type UnlockAccountRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=8"`
+}
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=8"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// ClientInfo describes the device a session was started from
+type ClientInfo struct {
+	UserAgent string
+	ClientIP  string
+}
+
+type TokenResponse struct {
+	SessionID             uuid.UUID `json:"session_id"`
+	AccessToken           string    `json:"access_token"`
+	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+}
+
 type AuthResponse struct {
-	AccessToken    string       `json:"access_token"`
+	TokenResponse
 	GetStreamToken string       `json:"get_stream_token"`
 	User           UserResponse `json:"user"`
 }
@@ -49,5 +87,6 @@ func NewUserResponse(user *database.User) UserResponse {
 		Role:            user.UserRole,
 		ProfileImageURL: user.ProfileImageUrl,
 		IsOnboarded:     user.IsOnboarded,
+		IsEmailVerified: user.VerifiedAt.Valid,
 	}
 }
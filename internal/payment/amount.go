@@ -0,0 +1,44 @@
+package payment
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ToMinorUnits converts a decimal amount such as "1500.50" (the way postgres returns a NUMERIC(10,2)) to the subunit of the currency (cents) without going through a float
+func ToMinorUnits(amount string) (int64, error) {
+	whole, fraction, _ := strings.Cut(strings.TrimSpace(amount), ".")
+	if !isDigits(whole) || len(fraction) > 2 || (fraction != "" && !isDigits(fraction)) {
+		return 0, fmt.Errorf("invalid amount:%q", amount)
+	}
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount:%q", amount)
+	}
+	// pad the fraction so that "1500.5" is read as 50 cents
+	cents, _ := strconv.ParseInt((fraction + "00")[:2], 10, 64)
+	return units*100 + cents, nil
+}
+
+// FormatMinorUnits converts an amount in cents back to the decimal form stored in the database
+func FormatMinorUnits(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
+func isDigits(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,29 @@
+package payment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToMinorUnits(t *testing.T) {
+	valid := map[string]int64{
+		"1500.00": 150000,
+		"1500.5":  150050,
+		"1500":    150000,
+		"0.07":    7,
+		"19.99":   1999,
+	}
+	for amount, expected := range valid {
+		cents, err := ToMinorUnits(amount)
+		require.NoError(t, err, amount)
+		require.Equal(t, expected, cents, amount)
+		if amount == "1500.00" || amount == "0.07" || amount == "19.99" {
+			require.Equal(t, amount, FormatMinorUnits(cents))
+		}
+	}
+	for _, amount := range []string{"", "abc", "-10.00", "10.001", "10.-5", ".50", "1e3"} {
+		_, err := ToMinorUnits(amount)
+		require.Error(t, err, amount)
+	}
+}
@@ -0,0 +1,416 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// daraja expects its timestamps in East Africa Time
+var nairobi = time.FixedZone("EAT", 3*60*60)
+
+const mpesaTimestampLayout = "20060102150405"
+
+var ErrInvalidPhoneNumber = errors.New("invalid M-Pesa phone number")
+
+// the error code an STK push query gets while the patient still hasn't responded to the prompt
+const mpesaStillProcessing = "500.001.1001"
+
+type MpesaConfig struct {
+	// https://sandbox.safaricom.co.ke or https://api.safaricom.co.ke
+	BaseURL        string
+	ConsumerKey    string
+	ConsumerSecret string
+	// the paybill or till number payments are made to
+	ShortCode string
+	PassKey   string
+	// the public URL of the callback endpoint , daraja sends the results of STK pushes and reversals to it
+	CallbackURL string
+	// daraja doesn't sign its callbacks , the callback URL carries this token instead
+	CallbackToken string
+	// the API operator that refunds are made as and their encrypted password
+	InitiatorName      string
+	SecurityCredential string
+	// the shortcode partial refunds are paid from , the paybill is used when it's empty
+	B2CShortCode string
+}
+
+// Mpesa takes payments with an M-Pesa STK push , the patient confirms the payment on a prompt sent to their phone
+type Mpesa struct {
+	config MpesaConfig
+	client *http.Client
+	// the oauth token is reused until it expires
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+	// overridden in tests
+	now func() time.Time
+}
+
+func NewMpesa(config MpesaConfig) *Mpesa {
+	return &Mpesa{
+		config: config,
+		client: &http.Client{Timeout: 30 * time.Second},
+		now:    time.Now,
+	}
+}
+
+func (m *Mpesa) Name() string {
+	return MethodMpesa
+}
+
+func (m *Mpesa) token(ctx context.Context) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.accessToken != "" && m.now().Before(m.expiresAt) {
+		return m.accessToken, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.config.BaseURL+"/oauth/v1/generate?grant_type=client_credentials", nil)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(m.config.ConsumerKey, m.config.ConsumerSecret)
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("mpesa error:unable to get an access token (%s)", resp.Status)
+	}
+	var respBody struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   string `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+		return "", err
+	}
+	seconds, err := strconv.Atoi(respBody.ExpiresIn)
+	if err != nil {
+		seconds = 3599
+	}
+	m.accessToken = respBody.AccessToken
+	// refreshed a minute early so that it doesn't expire mid request
+	m.expiresAt = m.now().Add(time.Duration(seconds)*time.Second - time.Minute)
+	return m.accessToken, nil
+}
+
+// send makes an authenticated request to daraja and decodes the response into out
+func (m *Mpesa) send(ctx context.Context, path string, payload interface{}, out interface{}) error {
+	token, err := m.token(ctx)
+	if err != nil {
+		return err
+	}
+	buff, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.config.BaseURL+path, bytes.NewBuffer(buff))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Authorization", "Bearer "+token)
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	// failed requests come back with an error code instead of the usual response
+	var failure struct {
+		ErrorCode    string `json:"errorCode"`
+		ErrorMessage string `json:"errorMessage"`
+	}
+	if err := json.Unmarshal(respBody, &failure); err == nil && failure.ErrorCode != "" {
+		return &MpesaError{Code: failure.ErrorCode, Message: failure.ErrorMessage}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("mpesa error:%s", resp.Status)
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+type MpesaError struct {
+	Code    string
+	Message string
+}
+
+func (e *MpesaError) Error() string {
+	return fmt.Sprintf("mpesa error:%s (%s)", e.Message, e.Code)
+}
+
+// password is what daraja expects STK requests to be signed with
+func (m *Mpesa) password(timestamp string) string {
+	return base64.StdEncoding.EncodeToString([]byte(m.config.ShortCode + m.config.PassKey + timestamp))
+}
+
+func (m *Mpesa) callbackURL() string {
+	return m.config.CallbackURL + "?token=" + m.config.CallbackToken
+}
+
+// refundCallbackURL carries the reference of the payment , the result of a refund can arrive before
+// the ConversationID it is sent with has been saved
+func (m *Mpesa) refundCallbackURL(reference string) string {
+	return m.callbackURL() + "&reference=" + url.QueryEscape(reference)
+}
+
+func (m *Mpesa) Initialize(ctx context.Context, request InitializeRequest) (*InitializeResult, error) {
+	phone, err := normalizePhoneNumber(request.PhoneNumber)
+	if err != nil {
+		return nil, err
+	}
+	// M-Pesa only takes whole shillings
+	shillings := (request.Amount + 99) / 100
+	timestamp := m.now().In(nairobi).Format(mpesaTimestampLayout)
+	description := truncate(request.Description, 13)
+	var respBody struct {
+		MerchantRequestID   string `json:"MerchantRequestID"`
+		CheckoutRequestID   string `json:"CheckoutRequestID"`
+		ResponseCode        string `json:"ResponseCode"`
+		ResponseDescription string `json:"ResponseDescription"`
+		CustomerMessage     string `json:"CustomerMessage"`
+	}
+	err = m.send(ctx, "/mpesa/stkpush/v1/processrequest", map[string]interface{}{
+		"BusinessShortCode": m.config.ShortCode,
+		"Password":          m.password(timestamp),
+		"Timestamp":         timestamp,
+		"TransactionType":   "CustomerPayBillOnline",
+		"Amount":            shillings,
+		"PartyA":            phone,
+		"PartyB":            m.config.ShortCode,
+		"PhoneNumber":       phone,
+		"CallBackURL":       m.callbackURL(),
+		"AccountReference":  "Lyra",
+		"TransactionDesc":   description,
+	}, &respBody)
+	if err != nil {
+		return nil, err
+	}
+	if respBody.ResponseCode != "0" {
+		return nil, fmt.Errorf("mpesa error:%s", respBody.ResponseDescription)
+	}
+	return &InitializeResult{
+		Reference: respBody.CheckoutRequestID,
+		Amount:    shillings * 100,
+		Message:   respBody.CustomerMessage,
+	}, nil
+}
+
+func (m *Mpesa) Verify(ctx context.Context, payment PaymentDetails) (*Verification, error) {
+	timestamp := m.now().In(nairobi).Format(mpesaTimestampLayout)
+	var respBody struct {
+		ResponseCode string `json:"ResponseCode"`
+		ResultCode   string `json:"ResultCode"`
+		ResultDesc   string `json:"ResultDesc"`
+	}
+	err := m.send(ctx, "/mpesa/stkpushquery/v1/query", map[string]interface{}{
+		"BusinessShortCode": m.config.ShortCode,
+		"Password":          m.password(timestamp),
+		"Timestamp":         timestamp,
+		"CheckoutRequestID": payment.Reference,
+	}, &respBody)
+	if err != nil {
+		if mpesaErr, ok := err.(*MpesaError); ok && mpesaErr.Code == mpesaStillProcessing {
+			return &Verification{Status: StatusPending, ProviderStatus: mpesaErr.Message, TransactionID: payment.TransactionID}, nil
+		}
+		return nil, err
+	}
+	// the query doesn't report the amount , the push was for exactly what was charged so that's what was paid
+	verification := &Verification{
+		Status:         StatusFailed,
+		ProviderStatus: respBody.ResultDesc,
+		Amount:         payment.Amount,
+		Currency:       "KES",
+		TransactionID:  payment.TransactionID,
+	}
+	if respBody.ResultCode == "0" {
+		verification.Status = StatusSucceeded
+	}
+	return verification, nil
+}
+
+// Refund reverses the M-Pesa transaction when all of it is refunded , daraja can only reverse whole transactions
+// so partial refunds are sent back to the patient's phone as a B2C payment
+func (m *Mpesa) Refund(ctx context.Context, request RefundRequest) (*RefundResult, error) {
+	var respBody struct {
+		ConversationID      string `json:"ConversationID"`
+		ResponseCode        string `json:"ResponseCode"`
+		ResponseDescription string `json:"ResponseDescription"`
+	}
+	var err error
+	if request.Amount >= request.Payment.Amount {
+		if request.Payment.TransactionID == "" {
+			return nil, fmt.Errorf("mpesa error:the payment has no M-Pesa receipt to reverse")
+		}
+		err = m.send(ctx, "/mpesa/reversal/v1/request", map[string]interface{}{
+			"Initiator":              m.config.InitiatorName,
+			"SecurityCredential":     m.config.SecurityCredential,
+			"CommandID":              "TransactionReversal",
+			"TransactionID":          request.Payment.TransactionID,
+			"Amount":                 request.Payment.Amount / 100,
+			"ReceiverParty":          m.config.ShortCode,
+			"RecieverIdentifierType": "11",
+			"ResultURL":              m.refundCallbackURL(request.Payment.Reference),
+			"QueueTimeOutURL":        m.refundCallbackURL(request.Payment.Reference),
+			"Remarks":                truncate(request.Reason, 100),
+			"Occasion":               truncate(request.Note, 100),
+		}, &respBody)
+	} else {
+		phone, phoneErr := normalizePhoneNumber(request.Payment.PhoneNumber)
+		if phoneErr != nil {
+			return nil, phoneErr
+		}
+		// a partial refund is rounded down so that more than the refund policy allows is never sent
+		err = m.send(ctx, "/mpesa/b2c/v1/paymentrequest", map[string]interface{}{
+			"InitiatorName":      m.config.InitiatorName,
+			"SecurityCredential": m.config.SecurityCredential,
+			"CommandID":          "BusinessPayment",
+			"Amount":             request.Amount / 100,
+			"PartyA":             m.b2cShortCode(),
+			"PartyB":             phone,
+			"Remarks":            truncate(request.Reason, 100),
+			"QueueTimeOutURL":    m.refundCallbackURL(request.Payment.Reference),
+			"ResultURL":          m.refundCallbackURL(request.Payment.Reference),
+			"Occassion":          truncate(request.Note, 100),
+		}, &respBody)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if respBody.ResponseCode != "0" {
+		return nil, fmt.Errorf("mpesa error:%s", respBody.ResponseDescription)
+	}
+	return &RefundResult{
+		ID:     respBody.ConversationID,
+		Status: StatusPending,
+	}, nil
+}
+
+func (m *Mpesa) b2cShortCode() string {
+	if m.config.B2CShortCode != "" {
+		return m.config.B2CShortCode
+	}
+	return m.config.ShortCode
+}
+
+// the body daraja posts to the callback URL when an STK push finishes
+type mpesaSTKCallback struct {
+	Body struct {
+		StkCallback struct {
+			MerchantRequestID string `json:"MerchantRequestID"`
+			CheckoutRequestID string `json:"CheckoutRequestID"`
+			ResultCode        int    `json:"ResultCode"`
+			ResultDesc        string `json:"ResultDesc"`
+			CallbackMetadata  struct {
+				Item []struct {
+					Name  string          `json:"Name"`
+					Value json.RawMessage `json:"Value"`
+				} `json:"Item"`
+			} `json:"CallbackMetadata"`
+		} `json:"stkCallback"`
+	} `json:"Body"`
+	// the body daraja posts when a reversal or B2C payment finishes
+	Result *struct {
+		ResultCode     int    `json:"ResultCode"`
+		ResultDesc     string `json:"ResultDesc"`
+		ConversationID string `json:"ConversationID"`
+		TransactionID  string `json:"TransactionID"`
+	} `json:"Result"`
+}
+
+func (m *Mpesa) ParseWebhook(request WebhookRequest) (*WebhookEvent, error) {
+	token := request.Query.Get("token")
+	if m.config.CallbackToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(m.config.CallbackToken)) != 1 {
+		return nil, ErrInvalidSignature
+	}
+	var callback mpesaSTKCallback
+	if err := json.Unmarshal(request.Body, &callback); err != nil {
+		return nil, ErrInvalidPayload
+	}
+	if callback.Result != nil {
+		if callback.Result.ConversationID == "" {
+			return nil, ErrInvalidPayload
+		}
+		event := &WebhookEvent{
+			ID:           fmt.Sprintf("%s:result:%s", MethodMpesa, callback.Result.ConversationID),
+			Type:         EventRefundFailed,
+			ProviderType: "result",
+			Reference:    request.Query.Get("reference"),
+			RefundID:     callback.Result.ConversationID,
+			RefundStatus: "failed",
+		}
+		if callback.Result.ResultCode == 0 {
+			event.Type = EventRefundProcessed
+			event.RefundStatus = "processed"
+		}
+		return event, nil
+	}
+	stk := callback.Body.StkCallback
+	if stk.CheckoutRequestID == "" {
+		return nil, ErrInvalidPayload
+	}
+	event := &WebhookEvent{
+		ID:           fmt.Sprintf("%s:stk:%s", MethodMpesa, stk.CheckoutRequestID),
+		Type:         EventPaymentFailed,
+		ProviderType: "stk_callback",
+		Reference:    stk.CheckoutRequestID,
+		Currency:     "KES",
+	}
+	if stk.ResultCode != 0 {
+		return event, nil
+	}
+	event.Type = EventPaymentSucceeded
+	for _, item := range stk.CallbackMetadata.Item {
+		value := strings.Trim(string(item.Value), `"`)
+		switch item.Name {
+		case "Amount":
+			amount, err := ToMinorUnits(value)
+			if err != nil {
+				return nil, ErrInvalidPayload
+			}
+			event.Amount = amount
+		case "MpesaReceiptNumber":
+			event.TransactionID = value
+		}
+	}
+	return event, nil
+}
+
+// normalizePhoneNumber converts a Kenyan phone number (07XX , +2547XX , 2547XX) to the 2547XX form daraja expects
+func normalizePhoneNumber(phone string) (string, error) {
+	phone = strings.TrimPrefix(strings.ReplaceAll(strings.TrimSpace(phone), " ", ""), "+")
+	switch {
+	case strings.HasPrefix(phone, "0") && len(phone) == 10:
+		phone = "254" + phone[1:]
+	case (strings.HasPrefix(phone, "7") || strings.HasPrefix(phone, "1")) && len(phone) == 9:
+		phone = "254" + phone
+	}
+	if len(phone) != 12 || !strings.HasPrefix(phone, "254") || !isDigits(phone) {
+		return "", fmt.Errorf("%w:%q", ErrInvalidPhoneNumber, phone)
+	}
+	return phone, nil
+}
+
+// truncate shortens the free text fields to the number of characters daraja accepts , without splitting a character
+func truncate(value string, length int) string {
+	if utf8.RuneCountInString(value) > length {
+		return string([]rune(value)[:length])
+	}
+	return value
+}
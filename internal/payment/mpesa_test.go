@@ -0,0 +1,223 @@
+package payment
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestMpesa points an M-Pesa provider at a local stand-in for daraja , the oauth endpoint is served by the stand-in
+func newTestMpesa(t *testing.T, handler http.HandlerFunc) (*Mpesa, *int32) {
+	var tokens int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oauth/v1/generate" {
+			atomic.AddInt32(&tokens, 1)
+			key, secret, ok := r.BasicAuth()
+			require.True(t, ok)
+			require.Equal(t, "consumer_key", key)
+			require.Equal(t, "consumer_secret", secret)
+			w.Write([]byte(`{"access_token":"access_token","expires_in":"3599"}`))
+			return
+		}
+		require.Equal(t, "Bearer access_token", r.Header.Get("Authorization"))
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	mpesa := NewMpesa(MpesaConfig{
+		BaseURL:            server.URL,
+		ConsumerKey:        "consumer_key",
+		ConsumerSecret:     "consumer_secret",
+		ShortCode:          "174379",
+		PassKey:            "passkey",
+		CallbackURL:        "https://api.lyra.test/api/v1/payments/mpesa/callback",
+		CallbackToken:      "cb_token",
+		InitiatorName:      "testapi",
+		SecurityCredential: "credential",
+	})
+	// 2024-03-10 09:30:00 EAT
+	mpesa.now = func() time.Time { return time.Date(2024, 3, 10, 6, 30, 0, 0, time.UTC) }
+	return mpesa, &tokens
+}
+
+func decodeBody(t *testing.T, r *http.Request) map[string]any {
+	var body map[string]any
+	require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+	return body
+}
+
+func TestMpesaInitialize(t *testing.T) {
+	mpesa, tokens := newTestMpesa(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/mpesa/stkpush/v1/processrequest", r.URL.Path)
+		body := decodeBody(t, r)
+		require.Equal(t, "174379", body["BusinessShortCode"])
+		require.Equal(t, "20240310093000", body["Timestamp"])
+		require.Equal(t, base64.StdEncoding.EncodeToString([]byte("174379passkey20240310093000")), body["Password"])
+		require.Equal(t, "254708374149", body["PhoneNumber"])
+		// 1500.50 is rounded up to whole shillings
+		require.Equal(t, float64(1501), body["Amount"])
+		require.Equal(t, "https://api.lyra.test/api/v1/payments/mpesa/callback?token=cb_token", body["CallBackURL"])
+		w.Write([]byte(`{"MerchantRequestID":"29115","CheckoutRequestID":"ws_CO_191220191020363925","ResponseCode":"0","ResponseDescription":"Success. Request accepted for processing","CustomerMessage":"Success. Request accepted for processing"}`))
+	})
+	request := InitializeRequest{Amount: 150050, PhoneNumber: "0708 374149", Description: "Consultation"}
+	result, err := mpesa.Initialize(context.Background(), request)
+	require.NoError(t, err)
+	require.Equal(t, "ws_CO_191220191020363925", result.Reference)
+	require.Equal(t, int64(150100), result.Amount)
+	require.Empty(t, result.AuthorizationURL)
+
+	// the access token is reused
+	_, err = mpesa.Initialize(context.Background(), request)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(tokens))
+
+	_, err = mpesa.Initialize(context.Background(), InitializeRequest{Amount: 150000, PhoneNumber: "12345"})
+	require.ErrorIs(t, err, ErrInvalidPhoneNumber)
+}
+
+func TestMpesaVerify(t *testing.T) {
+	testCases := []struct {
+		name     string
+		response string
+		status   string
+	}{
+		{"paid", `{"ResponseCode":"0","ResultCode":"0","ResultDesc":"The service request is processed successfully."}`, StatusSucceeded},
+		{"cancelled", `{"ResponseCode":"0","ResultCode":"1032","ResultDesc":"Request cancelled by user"}`, StatusFailed},
+		{"still waiting for the patient", `{"requestId":"1","errorCode":"500.001.1001","errorMessage":"The transaction is being processed"}`, StatusPending},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mpesa, _ := newTestMpesa(t, func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "/mpesa/stkpushquery/v1/query", r.URL.Path)
+				require.Equal(t, "ws_CO_1", decodeBody(t, r)["CheckoutRequestID"])
+				if tc.status == StatusPending {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+				w.Write([]byte(tc.response))
+			})
+			verification, err := mpesa.Verify(context.Background(), PaymentDetails{Reference: "ws_CO_1", Amount: 150000})
+			require.NoError(t, err)
+			require.Equal(t, tc.status, verification.Status)
+		})
+	}
+
+	t.Run("unknown request", func(t *testing.T) {
+		mpesa, _ := newTestMpesa(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"requestId":"1","errorCode":"400.002.02","errorMessage":"Bad Request - Invalid CheckoutRequestID"}`))
+		})
+		_, err := mpesa.Verify(context.Background(), PaymentDetails{Reference: "ws_CO_1"})
+		require.Error(t, err)
+	})
+}
+
+func TestMpesaRefund(t *testing.T) {
+	payment := PaymentDetails{Reference: "ws_CO_1", TransactionID: "NLJ7RT61SV", Amount: 150000, PhoneNumber: "254708374149"}
+
+	t.Run("a full refund reverses the transaction", func(t *testing.T) {
+		mpesa, _ := newTestMpesa(t, func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "/mpesa/reversal/v1/request", r.URL.Path)
+			body := decodeBody(t, r)
+			require.Equal(t, "NLJ7RT61SV", body["TransactionID"])
+			require.Equal(t, float64(1500), body["Amount"])
+			// the result is matched to the payment's refund even before the ConversationID has been saved
+			require.Contains(t, body["ResultURL"], "&reference=ws_CO_1")
+			w.Write([]byte(`{"OriginatorConversationID":"1","ConversationID":"AG_1","ResponseCode":"0","ResponseDescription":"Accept the service request successfully."}`))
+		})
+		result, err := mpesa.Refund(context.Background(), RefundRequest{Payment: payment, Amount: 150000})
+		require.NoError(t, err)
+		require.Equal(t, "AG_1", result.ID)
+		require.Equal(t, StatusPending, result.Status)
+	})
+
+	t.Run("a partial refund is paid to the patient's phone", func(t *testing.T) {
+		mpesa, _ := newTestMpesa(t, func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "/mpesa/b2c/v1/paymentrequest", r.URL.Path)
+			body := decodeBody(t, r)
+			require.Equal(t, "254708374149", body["PartyB"])
+			// rounded down to whole shillings
+			require.Equal(t, float64(750), body["Amount"])
+			require.Contains(t, body["ResultURL"], "&reference=ws_CO_1")
+			w.Write([]byte(`{"OriginatorConversationID":"2","ConversationID":"AG_2","ResponseCode":"0","ResponseDescription":"Accept the service request successfully."}`))
+		})
+		result, err := mpesa.Refund(context.Background(), RefundRequest{Payment: payment, Amount: 75050})
+		require.NoError(t, err)
+		require.Equal(t, "AG_2", result.ID)
+	})
+
+	t.Run("a reversal needs the receipt number", func(t *testing.T) {
+		mpesa, _ := newTestMpesa(t, func(w http.ResponseWriter, r *http.Request) {
+			t.Fatal("daraja shouldn't be called")
+		})
+		_, err := mpesa.Refund(context.Background(), RefundRequest{Payment: PaymentDetails{Reference: "ws_CO_1", Amount: 150000}, Amount: 150000})
+		require.Error(t, err)
+	})
+}
+
+func TestMpesaParseWebhook(t *testing.T) {
+	mpesa := NewMpesa(MpesaConfig{CallbackToken: "cb_token"})
+	request := func(body, token string) WebhookRequest {
+		return WebhookRequest{Body: []byte(body), Query: url.Values{"token": []string{token}}}
+	}
+	refundResult := func(body string) WebhookRequest {
+		return WebhookRequest{Body: []byte(body), Query: url.Values{"token": []string{"cb_token"}, "reference": []string{"ws_CO_1"}}}
+	}
+
+	t.Run("payment succeeded", func(t *testing.T) {
+		event, err := mpesa.ParseWebhook(request(`{"Body":{"stkCallback":{"MerchantRequestID":"29115","CheckoutRequestID":"ws_CO_1","ResultCode":0,"ResultDesc":"The service request is processed successfully.","CallbackMetadata":{"Item":[{"Name":"Amount","Value":1500.00},{"Name":"MpesaReceiptNumber","Value":"NLJ7RT61SV"},{"Name":"Balance"},{"Name":"TransactionDate","Value":20191219102115},{"Name":"PhoneNumber","Value":254708374149}]}}}}`, "cb_token"))
+		require.NoError(t, err)
+		require.Equal(t, "mpesa:stk:ws_CO_1", event.ID)
+		require.Equal(t, EventPaymentSucceeded, event.Type)
+		require.Equal(t, "ws_CO_1", event.Reference)
+		require.Equal(t, "NLJ7RT61SV", event.TransactionID)
+		require.Equal(t, int64(150000), event.Amount)
+	})
+
+	t.Run("payment cancelled", func(t *testing.T) {
+		event, err := mpesa.ParseWebhook(request(`{"Body":{"stkCallback":{"CheckoutRequestID":"ws_CO_1","ResultCode":1032,"ResultDesc":"Request cancelled by user"}}}`, "cb_token"))
+		require.NoError(t, err)
+		require.Equal(t, EventPaymentFailed, event.Type)
+	})
+
+	t.Run("refund result", func(t *testing.T) {
+		event, err := mpesa.ParseWebhook(request(`{"Result":{"ResultType":0,"ResultCode":2001,"ResultDesc":"The initiator information is invalid.","ConversationID":"AG_1"}}`, "cb_token"))
+		require.NoError(t, err)
+		require.Equal(t, "mpesa:result:AG_1", event.ID)
+		require.Equal(t, EventRefundFailed, event.Type)
+		require.Equal(t, "AG_1", event.RefundID)
+		require.Empty(t, event.Reference)
+
+		event, err = mpesa.ParseWebhook(refundResult(`{"Result":{"ResultType":0,"ResultCode":0,"ResultDesc":"The service request is processed successfully.","ConversationID":"AG_2","TransactionID":"NLJ41HAY6Q"}}`))
+		require.NoError(t, err)
+		require.Equal(t, EventRefundProcessed, event.Type)
+		require.Equal(t, "ws_CO_1", event.Reference)
+		require.Equal(t, "AG_2", event.RefundID)
+	})
+
+	t.Run("wrong token", func(t *testing.T) {
+		_, err := mpesa.ParseWebhook(request(`{"Body":{"stkCallback":{"CheckoutRequestID":"ws_CO_1","ResultCode":0}}}`, "guessed"))
+		require.ErrorIs(t, err, ErrInvalidSignature)
+		_, err = NewMpesa(MpesaConfig{}).ParseWebhook(request(`{"Body":{"stkCallback":{"CheckoutRequestID":"ws_CO_1","ResultCode":0}}}`, ""))
+		require.ErrorIs(t, err, ErrInvalidSignature)
+	})
+
+	t.Run("malformed payload", func(t *testing.T) {
+		_, err := mpesa.ParseWebhook(request(`{"Body":{"stkCallback":{}}}`, "cb_token"))
+		require.ErrorIs(t, err, ErrInvalidPayload)
+	})
+}
+
+func TestTruncate(t *testing.T) {
+	require.Equal(t, "Consultation", truncate("Consultation", 13))
+	require.Equal(t, "Consultation ", truncate("Consultation fee", 13))
+	// characters are counted , not bytes
+	require.Equal(t, "Ziara ya daktari – Dkt. Wanjiru", truncate("Ziara ya daktari – Dkt. Wanjiru", 31))
+	require.Equal(t, "Daktari ☕☕", truncate("Daktari ☕☕☕", 10))
+}
@@ -2,26 +2,50 @@ package payment
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/mbeka02/lyra_backend/internal/model"
 )
 
 var baseURL = "https://api.paystack.co"
 
-type PaymentProcessor struct {
+// Paystack takes card and mobile money payments through a hosted checkout page
+type Paystack struct {
 	apiKey string
 	client *http.Client
 }
 
-func NewPaymentProcessor(apiKey string) *PaymentProcessor {
-	return &PaymentProcessor{apiKey, &http.Client{}}
+func NewPaystack(apiKey string) *Paystack {
+	return &Paystack{apiKey, &http.Client{}}
 }
 
-func (p *PaymentProcessor) FetchTransaction(transactionId uint64) (*model.FetchTransactionResponse, error) {
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/transaction/%v", baseURL, transactionId), nil)
+func (p *Paystack) Name() string {
+	return MethodPaystack
+}
+
+// send makes a request to the paystack API and decodes the response into out , the request fails if paystack reports it as unsuccessful
+func (p *Paystack) send(ctx context.Context, method, path string, payload interface{}, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		buff, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(buff)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, baseURL+path, body)
+	if err != nil {
+		return err
+	}
 	// Add content type header
 	req.Header.Add("Content-Type", "application/json")
 	// Add Authorization Header
@@ -29,66 +53,253 @@ func (p *PaymentProcessor) FetchTransaction(transactionId uint64) (*model.FetchT
 	// send request
 	resp, err := p.client.Do(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var status struct {
+		Status  bool   `json:"status"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(respBody, &status); err != nil {
+		return err
+	}
+	if !status.Status {
+		return &PaystackError{Message: status.Message}
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+// PaystackError is a request paystack turned down , e.g. invalid bank details
+type PaystackError struct {
+	Message string
+}
+
+func (e *PaystackError) Error() string {
+	return "paystack error:" + e.Message
+}
 
+func (p *Paystack) FetchTransaction(ctx context.Context, transactionId uint64) (*model.FetchTransactionResponse, error) {
 	var respBody model.FetchTransactionResponse
-	if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+	if err := p.send(ctx, http.MethodGet, fmt.Sprintf("/transaction/%v", transactionId), nil, &respBody); err != nil {
 		return nil, err
 	}
-	if !respBody.Status {
-		return nil, fmt.Errorf("paystack error:%s", respBody.Message)
-	}
 	return &respBody, nil
 }
 
-func (p *PaymentProcessor) VerifyTransaction(reference string) (*model.VerifyTransactionResponse, error) {
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/transaction/verify/%s", baseURL, reference), nil)
-	// Add content type header
-	req.Header.Add("Content-Type", "application/json")
-	// Add Authorization Header
-	req.Header.Add("Authorization", "Bearer "+p.apiKey)
-	// send request
-	resp, err := p.client.Do(req)
-	if err != nil {
+func (p *Paystack) VerifyTransaction(ctx context.Context, reference string) (*model.VerifyTransactionResponse, error) {
+	var respBody model.VerifyTransactionResponse
+	if err := p.send(ctx, http.MethodGet, fmt.Sprintf("/transaction/verify/%s", reference), nil, &respBody); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return &respBody, nil
+}
 
-	var respBody model.VerifyTransactionResponse
-	if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+func (p *Paystack) InitializeTransaction(ctx context.Context, request model.InitializeTransactionRequest) (*model.InitializeTransactionResponse, error) {
+	var respBody model.InitializeTransactionResponse
+	if err := p.send(ctx, http.MethodPost, "/transaction/initialize", request, &respBody); err != nil {
 		return nil, err
 	}
-	if !respBody.Status {
-		return nil, fmt.Errorf("paystack error:%s", respBody.Message)
+	return &respBody, nil
+}
+
+// RefundTransaction refunds all or part of a transaction , paystack processes refunds asynchronously so the refund starts out as pending
+func (p *Paystack) RefundTransaction(ctx context.Context, request model.RefundRequest) (*model.RefundResponse, error) {
+	var respBody model.RefundResponse
+	if err := p.send(ctx, http.MethodPost, "/refund", request, &respBody); err != nil {
+		return nil, err
 	}
 	return &respBody, nil
 }
 
-func (p *PaymentProcessor) InitializeTransaction(request model.InitializeTransactionRequest) (*model.InitializeTransactionResponse, error) {
-	buff, err := json.Marshal(request)
+func (p *Paystack) CreateSubaccount(ctx context.Context, request SubaccountRequest) (*Subaccount, error) {
+	var respBody model.SubaccountResponse
+	if err := p.send(ctx, http.MethodPost, "/subaccount", subaccountRequest(request), &respBody); err != nil {
+		return nil, err
+	}
+	return subaccount(respBody), nil
+}
+
+// UpdateSubaccount changes the bank account a subaccount is settled to , the code stays the same
+func (p *Paystack) UpdateSubaccount(ctx context.Context, code string, request SubaccountRequest) (*Subaccount, error) {
+	var respBody model.SubaccountResponse
+	if err := p.send(ctx, http.MethodPut, "/subaccount/"+code, subaccountRequest(request), &respBody); err != nil {
+		return nil, err
+	}
+	return subaccount(respBody), nil
+}
+
+func subaccountRequest(request SubaccountRequest) model.SubaccountRequest {
+	return model.SubaccountRequest{
+		BusinessName:        request.BusinessName,
+		SettlementBank:      request.BankCode,
+		AccountNumber:       request.AccountNumber,
+		PercentageCharge:    request.PercentageCharge,
+		Description:         "Lyra doctor payouts",
+		PrimaryContactEmail: request.Email,
+		PrimaryContactName:  request.Name,
+	}
+}
+
+func subaccount(response model.SubaccountResponse) *Subaccount {
+	return &Subaccount{
+		Code:           response.Data.SubaccountCode,
+		BusinessName:   response.Data.BusinessName,
+		SettlementBank: response.Data.SettlementBank,
+		AccountNumber:  response.Data.AccountNumber,
+		Verified:       response.Data.IsVerified,
+	}
+}
+
+// VerifyWebhookSignature checks the x-paystack-signature header of a webhook request ,
+// paystack signs the raw body with the secret key using HMAC SHA512
+func (p *Paystack) VerifyWebhookSignature(body []byte, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha512.New, []byte(p.apiKey))
+	mac.Write(body)
+	// constant time comparison so the signature can't be guessed byte by byte
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+func (p *Paystack) Initialize(ctx context.Context, request InitializeRequest) (*InitializeResult, error) {
+	transaction := model.InitializeTransactionRequest{
+		Email:  request.Email,
+		Amount: request.Amount,
+	}
+	if request.SubAccount != "" {
+		// the doctor's share is settled to their subaccount , the platform keeps its share and pays the paystack fees
+		transaction.SubAccount = request.SubAccount
+		transaction.TransactionCharge = request.PlatformShare
+		transaction.Bearer = "account"
+	}
+	response, err := p.InitializeTransaction(ctx, transaction)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/transaction/initialize", baseURL), bytes.NewBuffer(buff))
-	// Add content type header
-	req.Header.Add("Content-Type", "application/json")
-	// Add Authorization Header
-	req.Header.Add("Authorization", "Bearer "+p.apiKey)
-	// send request
-	resp, err := p.client.Do(req)
+	return &InitializeResult{
+		Reference:        response.Data.Reference,
+		AuthorizationURL: response.Data.AuthorizationURL,
+		Amount:           request.Amount,
+		Message:          response.Message,
+		SubAccount:       request.SubAccount,
+	}, nil
+}
+
+func (p *Paystack) Verify(ctx context.Context, payment PaymentDetails) (*Verification, error) {
+	response, err := p.VerifyTransaction(ctx, payment.Reference)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	verification := &Verification{
+		Status:         StatusPending,
+		ProviderStatus: response.Data.Status,
+		Amount:         int64(response.Data.Amount),
+		Currency:       response.Data.Currency,
+		TransactionID:  strconv.FormatUint(response.Data.ID, 10),
+	}
+	switch response.Data.Status {
+	case "success":
+		verification.Status = StatusSucceeded
+	case "failed", "reversed":
+		verification.Status = StatusFailed
+	}
+	// abandoned checkouts stay pending , the patient can still complete them
+	return verification, nil
+}
 
-	var respBody model.InitializeTransactionResponse
-	if err := json.NewDecoder(resp.Body).Decode(&respBody); err != nil {
+func (p *Paystack) Refund(ctx context.Context, request RefundRequest) (*RefundResult, error) {
+	response, err := p.RefundTransaction(ctx, model.RefundRequest{
+		Transaction:  request.Payment.Reference,
+		Amount:       request.Amount,
+		CustomerNote: request.Reason,
+		MerchantNote: request.Note,
+	})
+	if err != nil {
 		return nil, err
 	}
-	if !respBody.Status {
-		return nil, fmt.Errorf("paystack error:%s", respBody.Message)
+	return &RefundResult{
+		ID:     strconv.FormatUint(response.Data.ID, 10),
+		Status: response.Data.Status,
+	}, nil
+}
+
+func (p *Paystack) ParseWebhook(request WebhookRequest) (*WebhookEvent, error) {
+	if !p.VerifyWebhookSignature(request.Body, request.Header.Get("x-paystack-signature")) {
+		return nil, ErrInvalidSignature
 	}
-	return &respBody, nil
+	// the payload is decoded from the same bytes that were verified
+	var payload model.PaystackWebhookPayload
+	if err := json.Unmarshal(request.Body, &payload); err != nil || payload.Event == "" {
+		return nil, ErrInvalidPayload
+	}
+	var object struct {
+		ID model.PaystackID `json:"id"`
+	}
+	if len(payload.Data) > 0 {
+		if err := json.Unmarshal(payload.Data, &object); err != nil {
+			return nil, ErrInvalidPayload
+		}
+	}
+	event := &WebhookEvent{ProviderType: payload.Event}
+	// paystack doesn't send an id for the event itself , it's identified by its type and the object it's about (or the body when the object has no id)
+	if object.ID == "" {
+		sum := sha256.Sum256(request.Body)
+		event.ID = fmt.Sprintf("%s:%s:%s", MethodPaystack, payload.Event, hex.EncodeToString(sum[:]))
+	} else {
+		event.ID = fmt.Sprintf("%s:%s:%s", MethodPaystack, payload.Event, object.ID)
+	}
+
+	switch payload.Event {
+	case "charge.success", "charge.failed":
+		var charge model.PaystackChargeData
+		if err := json.Unmarshal(payload.Data, &charge); err != nil || charge.Reference == "" {
+			return nil, ErrInvalidPayload
+		}
+		event.Type = EventPaymentFailed
+		if payload.Event == "charge.success" {
+			event.Type = EventPaymentSucceeded
+		}
+		event.Reference = charge.Reference
+		event.TransactionID = strconv.FormatInt(charge.ID, 10)
+		event.Amount = charge.Amount
+		event.Currency = charge.Currency
+	case "refund.processed", "refund.failed":
+		var refund model.PaystackRefundData
+		if err := json.Unmarshal(payload.Data, &refund); err != nil || refund.TransactionReference == "" {
+			return nil, ErrInvalidPayload
+		}
+		event.Type = EventRefundFailed
+		if payload.Event == "refund.processed" {
+			event.Type = EventRefundProcessed
+		}
+		event.Reference = refund.TransactionReference
+		event.RefundID = string(refund.ID)
+		event.RefundStatus = refund.Status
+		event.Currency = refund.Currency
+	case "charge.dispute.create", "charge.dispute.remind", "charge.dispute.resolve":
+		var dispute model.PaystackDisputeData
+		if err := json.Unmarshal(payload.Data, &dispute); err != nil || dispute.ID == "" || dispute.Transaction.Reference == "" {
+			return nil, ErrInvalidPayload
+		}
+		currency := dispute.Currency
+		if currency == "" {
+			currency = dispute.Transaction.Currency
+		}
+		event.Type = EventDispute
+		event.Reference = dispute.Transaction.Reference
+		event.Dispute = &Dispute{
+			ID:           string(dispute.ID),
+			Status:       dispute.Status,
+			Resolution:   dispute.Resolution,
+			RefundAmount: dispute.RefundAmount,
+			Currency:     currency,
+		}
+	}
+	return event, nil
 }
@@ -0,0 +1,242 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+// useTestServer points the processor at a local server for the duration of the test
+func useTestServer(t *testing.T, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	previous := baseURL
+	baseURL = server.URL
+	t.Cleanup(func() {
+		baseURL = previous
+		server.Close()
+	})
+}
+
+func TestRefundTransaction(t *testing.T) {
+	t.Run("partial refund", func(t *testing.T) {
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, http.MethodPost, r.Method)
+			require.Equal(t, "/refund", r.URL.Path)
+			require.Equal(t, "Bearer sk_test", r.Header.Get("Authorization"))
+			var request model.RefundRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+			require.Equal(t, "ref_123", request.Transaction)
+			require.Equal(t, int64(75000), request.Amount)
+
+			w.Write([]byte(`{"status":true,"message":"Refund has been queued for processing","data":{"id":3018284,"amount":75000,"currency":"KES","status":"pending","transaction":{"id":1004,"reference":"ref_123","amount":150000}}}`))
+		})
+		processor := NewPaystack("sk_test")
+		response, err := processor.RefundTransaction(context.Background(), model.RefundRequest{Transaction: "ref_123", Amount: 75000})
+		require.NoError(t, err)
+		require.Equal(t, uint64(3018284), response.Data.ID)
+		require.Equal(t, "pending", response.Data.Status)
+		require.Equal(t, int64(75000), response.Data.Amount)
+		require.Equal(t, "ref_123", response.Data.Transaction.Reference)
+	})
+
+	t.Run("full refund leaves out the amount", func(t *testing.T) {
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]any
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			require.NotContains(t, body, "amount")
+			w.Write([]byte(`{"status":true,"message":"Refund has been queued for processing","data":{"id":1,"amount":150000,"status":"pending"}}`))
+		})
+		_, err := NewPaystack("sk_test").RefundTransaction(context.Background(), model.RefundRequest{Transaction: "ref_123"})
+		require.NoError(t, err)
+	})
+
+	t.Run("paystack rejects the refund", func(t *testing.T) {
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status":false,"message":"Transaction has been fully reversed"}`))
+		})
+		_, err := NewPaystack("sk_test").RefundTransaction(context.Background(), model.RefundRequest{Transaction: "ref_123"})
+		require.EqualError(t, err, "paystack error:Transaction has been fully reversed")
+	})
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	processor := NewPaystack("sk_test")
+	body := []byte(`{"event":"charge.success","data":{"id":1004,"reference":"ref_123"}}`)
+	mac := hmac.New(sha512.New, []byte("sk_test"))
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	require.True(t, processor.VerifyWebhookSignature(body, signature))
+	// signed with another key
+	require.False(t, NewPaystack("sk_other").VerifyWebhookSignature(body, signature))
+	// the body was changed after it was signed
+	require.False(t, processor.VerifyWebhookSignature([]byte(`{"event":"charge.success","data":{"id":1005,"reference":"ref_123"}}`), signature))
+	require.False(t, processor.VerifyWebhookSignature(body, ""))
+	require.False(t, processor.VerifyWebhookSignature(body, "not hex"))
+}
+
+func TestPaystackVerify(t *testing.T) {
+	testCases := []struct {
+		providerStatus string
+		status         string
+	}{
+		{"success", StatusSucceeded},
+		{"failed", StatusFailed},
+		{"reversed", StatusFailed},
+		{"abandoned", StatusPending},
+		{"ongoing", StatusPending},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.providerStatus, func(t *testing.T) {
+			useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "/transaction/verify/ref_123", r.URL.Path)
+				w.Write([]byte(`{"status":true,"message":"Verification successful","data":{"id":1004,"status":"` + tc.providerStatus + `","reference":"ref_123","amount":150000,"currency":"KES"}}`))
+			})
+			verification, err := NewPaystack("sk_test").Verify(context.Background(), PaymentDetails{Reference: "ref_123"})
+			require.NoError(t, err)
+			require.Equal(t, tc.status, verification.Status)
+			require.Equal(t, tc.providerStatus, verification.ProviderStatus)
+			require.Equal(t, int64(150000), verification.Amount)
+			require.Equal(t, "1004", verification.TransactionID)
+		})
+	}
+}
+
+func TestPaystackParseWebhook(t *testing.T) {
+	processor := NewPaystack("sk_test")
+	request := func(body string) WebhookRequest {
+		mac := hmac.New(sha512.New, []byte("sk_test"))
+		mac.Write([]byte(body))
+		return WebhookRequest{
+			Body:   []byte(body),
+			Header: http.Header{"X-Paystack-Signature": []string{hex.EncodeToString(mac.Sum(nil))}},
+		}
+	}
+
+	t.Run("charge success", func(t *testing.T) {
+		event, err := processor.ParseWebhook(request(`{"event":"charge.success","data":{"id":1004,"reference":"ref_123","amount":150000,"currency":"KES"}}`))
+		require.NoError(t, err)
+		require.Equal(t, "paystack:charge.success:1004", event.ID)
+		require.Equal(t, EventPaymentSucceeded, event.Type)
+		require.Equal(t, "ref_123", event.Reference)
+		require.Equal(t, "1004", event.TransactionID)
+		require.Equal(t, int64(150000), event.Amount)
+	})
+
+	t.Run("refund failed", func(t *testing.T) {
+		event, err := processor.ParseWebhook(request(`{"event":"refund.failed","data":{"id":"3018285","status":"failed","transaction_reference":"ref_123"}}`))
+		require.NoError(t, err)
+		require.Equal(t, EventRefundFailed, event.Type)
+		require.Equal(t, "3018285", event.RefundID)
+	})
+
+	t.Run("events without an id are identified by their body", func(t *testing.T) {
+		first, err := processor.ParseWebhook(request(`{"event":"subscription.create","data":{}}`))
+		require.NoError(t, err)
+		second, err := processor.ParseWebhook(request(`{"event":"subscription.create","data":{"plan":1}}`))
+		require.NoError(t, err)
+		require.Empty(t, first.Type)
+		require.NotEqual(t, first.ID, second.ID)
+	})
+
+	t.Run("invalid signature", func(t *testing.T) {
+		signed := request(`{"event":"charge.success","data":{"id":1004,"reference":"ref_123"}}`)
+		signed.Body = []byte(`{"event":"charge.success","data":{"id":1004,"reference":"ref_456"}}`)
+		_, err := processor.ParseWebhook(signed)
+		require.ErrorIs(t, err, ErrInvalidSignature)
+	})
+
+	t.Run("charge without a reference", func(t *testing.T) {
+		_, err := processor.ParseWebhook(request(`{"event":"charge.success","data":{"id":1004}}`))
+		require.ErrorIs(t, err, ErrInvalidPayload)
+	})
+}
+
+func TestPaystackInitializeSplit(t *testing.T) {
+	t.Run("split with the doctor's subaccount", func(t *testing.T) {
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "/transaction/initialize", r.URL.Path)
+			var request model.InitializeTransactionRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+			require.Equal(t, int64(120000), request.Amount)
+			require.Equal(t, "ACCT_8f4s1eq7ml6rlzj", request.SubAccount)
+			require.Equal(t, int64(20000), request.TransactionCharge)
+			require.Equal(t, "account", request.Bearer)
+			w.Write([]byte(`{"status":true,"message":"Authorization URL created","data":{"authorization_url":"https://checkout.paystack.com/0peioxfhpn","access_code":"0peioxfhpn","reference":"ref_123"}}`))
+		})
+		result, err := NewPaystack("sk_test").Initialize(context.Background(), InitializeRequest{
+			Amount:        120000,
+			Email:         "patient@example.com",
+			SubAccount:    "ACCT_8f4s1eq7ml6rlzj",
+			PlatformShare: 20000,
+		})
+		require.NoError(t, err)
+		require.Equal(t, "ref_123", result.Reference)
+		require.Equal(t, "ACCT_8f4s1eq7ml6rlzj", result.SubAccount)
+	})
+
+	t.Run("collected by the platform", func(t *testing.T) {
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]any
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			require.NotContains(t, body, "subaccount")
+			require.NotContains(t, body, "transaction_charge")
+			w.Write([]byte(`{"status":true,"message":"Authorization URL created","data":{"authorization_url":"https://checkout.paystack.com/0peioxfhpn","access_code":"0peioxfhpn","reference":"ref_123"}}`))
+		})
+		result, err := NewPaystack("sk_test").Initialize(context.Background(), InitializeRequest{Amount: 120000, Email: "patient@example.com", PlatformShare: 20000})
+		require.NoError(t, err)
+		require.Empty(t, result.SubAccount)
+	})
+}
+
+func TestPaystackSubaccounts(t *testing.T) {
+	request := SubaccountRequest{BusinessName: "Dr. Wanjiru", BankCode: "68", AccountNumber: "0123456789", PercentageCharge: 16.67}
+
+	t.Run("create", func(t *testing.T) {
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, http.MethodPost, r.Method)
+			require.Equal(t, "/subaccount", r.URL.Path)
+			var body model.SubaccountRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			require.Equal(t, "68", body.SettlementBank)
+			require.Equal(t, "0123456789", body.AccountNumber)
+			require.Equal(t, 16.67, body.PercentageCharge)
+			w.Write([]byte(`{"status":true,"message":"Subaccount created","data":{"id":55,"subaccount_code":"ACCT_8f4s1eq7ml6rlzj","business_name":"Dr. Wanjiru","settlement_bank":"Equity Bank","account_number":"0123456789","percentage_charge":16.67,"is_verified":false,"currency":"KES"}}`))
+		})
+		subaccount, err := NewPaystack("sk_test").CreateSubaccount(context.Background(), request)
+		require.NoError(t, err)
+		require.Equal(t, "ACCT_8f4s1eq7ml6rlzj", subaccount.Code)
+		require.Equal(t, "Equity Bank", subaccount.SettlementBank)
+	})
+
+	t.Run("update keeps the code", func(t *testing.T) {
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, http.MethodPut, r.Method)
+			require.Equal(t, "/subaccount/ACCT_8f4s1eq7ml6rlzj", r.URL.Path)
+			w.Write([]byte(`{"status":true,"message":"Subaccount updated","data":{"subaccount_code":"ACCT_8f4s1eq7ml6rlzj","business_name":"Dr. Wanjiru","settlement_bank":"KCB Bank"}}`))
+		})
+		subaccount, err := NewPaystack("sk_test").UpdateSubaccount(context.Background(), "ACCT_8f4s1eq7ml6rlzj", request)
+		require.NoError(t, err)
+		require.Equal(t, "KCB Bank", subaccount.SettlementBank)
+	})
+
+	t.Run("invalid bank details", func(t *testing.T) {
+		useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status":false,"message":"Account details are invalid"}`))
+		})
+		_, err := NewPaystack("sk_test").CreateSubaccount(context.Background(), request)
+		var paystackErr *PaystackError
+		require.ErrorAs(t, err, &paystackErr)
+		require.Equal(t, "Account details are invalid", paystackErr.Message)
+	})
+}
@@ -0,0 +1,192 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// the payment methods patients can choose from , each one is handled by its own provider
+const (
+	MethodPaystack = "paystack"
+	MethodMpesa    = "mpesa"
+)
+
+var (
+	ErrUnsupportedMethod = errors.New("unsupported payment method")
+	ErrInvalidSignature  = errors.New("invalid signature")
+	ErrInvalidPayload    = errors.New("invalid webhook payload")
+)
+
+// the state of a transaction as reported by a provider
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusPending   = "pending"
+)
+
+// the webhook events that are acted on , providers report anything else with an empty type
+const (
+	EventPaymentSucceeded = "payment.succeeded"
+	EventPaymentFailed    = "payment.failed"
+	EventRefundProcessed  = "refund.processed"
+	EventRefundFailed     = "refund.failed"
+	EventDispute          = "dispute"
+)
+
+// Provider is a payment gateway , all the amounts it works with are in the subunit of the currency (cents)
+type Provider interface {
+	// Name is the payment method the provider handles , it's stored with the payments it creates
+	Name() string
+	// Initialize starts a payment , the patient completes it outside of the app (a checkout page or a prompt on their phone)
+	Initialize(ctx context.Context, request InitializeRequest) (*InitializeResult, error)
+	// Verify asks the provider what happened to a payment
+	Verify(ctx context.Context, payment PaymentDetails) (*Verification, error)
+	// Refund returns all or part of a payment , refunds are processed asynchronously and finish with a webhook event
+	Refund(ctx context.Context, request RefundRequest) (*RefundResult, error)
+	// ParseWebhook authenticates a webhook request and decodes it from the same bytes
+	ParseWebhook(request WebhookRequest) (*WebhookEvent, error)
+}
+
+type InitializeRequest struct {
+	// charged in the provider's default currency
+	Amount      int64
+	Email       string
+	PhoneNumber string
+	// shown to the patient
+	Description string
+	// the doctor's subaccount the payment is split with , providers that can't split payments collect all of it
+	SubAccount string
+	// what the platform keeps of a split payment , the rest is settled to the subaccount
+	PlatformShare int64
+}
+
+type InitializeResult struct {
+	// the reference the payment is tracked by , webhooks and verifications refer to it
+	Reference string
+	// where the patient completes the payment , empty when the provider prompts them directly
+	AuthorizationURL string
+	// the amount that is actually charged , providers that only take whole units round it up
+	Amount  int64
+	Message string
+	// the subaccount the payment is split with , empty when it isn't split
+	SubAccount string
+}
+
+// Subaccounts registers the bank accounts doctors are paid out to with the provider
+type Subaccounts interface {
+	CreateSubaccount(ctx context.Context, request SubaccountRequest) (*Subaccount, error)
+	UpdateSubaccount(ctx context.Context, code string, request SubaccountRequest) (*Subaccount, error)
+}
+
+type SubaccountRequest struct {
+	BusinessName  string
+	BankCode      string
+	AccountNumber string
+	// what the platform keeps of payments that don't set their own share
+	PercentageCharge float64
+	Email            string
+	Name             string
+}
+
+type Subaccount struct {
+	Code         string
+	BusinessName string
+	// the name of the bank
+	SettlementBank string
+	AccountNumber  string
+	Verified       bool
+}
+
+// PaymentDetails is what a provider needs to find a payment it started
+type PaymentDetails struct {
+	Reference string
+	// the provider's own id for the completed transaction , e.g. the M-Pesa receipt number
+	TransactionID string
+	// what was charged
+	Amount int64
+	// the phone the payment was made from , if it was made from one
+	PhoneNumber string
+}
+
+type Verification struct {
+	// one of StatusSucceeded , StatusFailed and StatusPending
+	Status string
+	// what the provider reported , kept for reports
+	ProviderStatus string
+	Amount         int64
+	Currency       string
+	TransactionID  string
+}
+
+type RefundRequest struct {
+	Payment PaymentDetails
+	Amount  int64
+	Reason  string
+	// kept by the provider for the merchant
+	Note string
+}
+
+type RefundResult struct {
+	ID     string
+	Status string
+}
+
+// WebhookRequest is an incoming webhook , the body has already been read
+type WebhookRequest struct {
+	Body   []byte
+	Header http.Header
+	Query  url.Values
+}
+
+type WebhookEvent struct {
+	// identifies the event so that redeliveries can be ignored
+	ID string
+	// one of the Event constants , empty for events that aren't acted on
+	Type string
+	// the event type as the provider named it
+	ProviderType string
+	// the reference of the payment the event is about
+	Reference     string
+	TransactionID string
+	Amount        int64
+	Currency      string
+	// set for refund events , may be empty when the provider doesn't send it
+	RefundID     string
+	RefundStatus string
+	// set for dispute events
+	Dispute *Dispute
+}
+
+type Dispute struct {
+	ID           string
+	Status       string
+	Resolution   string
+	RefundAmount int64
+	Currency     string
+}
+
+// Providers holds the configured providers by payment method
+type Providers map[string]Provider
+
+func NewProviders(providers ...Provider) Providers {
+	registry := Providers{}
+	for _, provider := range providers {
+		registry[provider.Name()] = provider
+	}
+	return registry
+}
+
+// Get returns the provider for a payment method , payments made before the method was recorded went through paystack
+func (p Providers) Get(method string) (Provider, error) {
+	if method == "" {
+		method = MethodPaystack
+	}
+	provider, ok := p[method]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedMethod, method)
+	}
+	return provider, nil
+}
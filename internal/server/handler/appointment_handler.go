@@ -1,7 +1,13 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
 
 	"github.com/mbeka02/lyra_backend/internal/model"
 	"github.com/mbeka02/lyra_backend/internal/server/service"
@@ -18,14 +24,38 @@ func NewAppointmentHandler(appointmentService service.AppointmentService) *Appoi
 }
 
 func (h *AppointmentHandler) HandleUpdateStatus(w http.ResponseWriter, r *http.Request) {
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
 	var request model.UpdateAppointmentStatusRequest
 	if err := parseAndValidateRequest(r, &request); err != nil {
 		respondWithError(w, http.StatusBadRequest, err)
 		return
 	}
-	err := h.appointmentService.UpdateAppointmentStatus(r.Context(), request)
+	err := h.appointmentService.UpdateAppointmentStatus(r.Context(), service.UpdateAppointmentStatusParams{
+		UserID:        payload.UserID,
+		Role:          payload.Role,
+		AppointmentID: request.AppointmentID,
+		Status:        request.Status,
+		Reason:        request.Reason,
+	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err)
+		switch {
+		case errors.Is(err, service.ErrInvalidAppointmentStatus):
+			respondWithError(w, http.StatusBadRequest, err)
+		case errors.Is(err, service.ErrAppointmentNotFound):
+			respondWithError(w, http.StatusNotFound, err)
+		case errors.Is(err, service.ErrAppointmentAccessDenied),
+			errors.Is(err, service.ErrStatusTransitionForbidden):
+			respondWithError(w, http.StatusForbidden, err)
+		case errors.Is(err, service.ErrInvalidStatusTransition),
+			errors.Is(err, service.ErrAppointmentNotCancellable):
+			respondWithError(w, http.StatusConflict, err)
+		default:
+			log.Println(err)
+			respondWithError(w, http.StatusInternalServerError, errors.New("unable to update the appointment status"))
+		}
 		return
 	}
 
@@ -104,8 +134,169 @@ func (h *AppointmentHandler) HandleCreateAppointment(w http.ResponseWriter, r *h
 
 	appointment, err := h.appointmentService.CreateAppointmentWithPayment(r.Context(), request, payload.UserID, payload.Email)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err)
+		switch {
+		case errors.Is(err, service.ErrEmailNotVerified):
+			respondWithError(w, http.StatusForbidden, err)
+		case errors.Is(err, service.ErrDoctorNotFound):
+			respondWithError(w, http.StatusNotFound, err)
+		case errors.Is(err, service.ErrInvalidAppointmentDuration),
+			errors.Is(err, service.ErrUnsupportedPaymentMethod),
+			errors.Is(err, service.ErrInvalidPhoneNumber):
+			respondWithError(w, http.StatusBadRequest, err)
+		case errors.Is(err, service.ErrDoctorUnavailable),
+			errors.Is(err, service.ErrSlotUnavailable),
+			errors.Is(err, service.ErrSlotTaken),
+			errors.Is(err, service.ErrBookingRules):
+			respondWithError(w, http.StatusConflict, err)
+		default:
+			respondWithError(w, http.StatusInternalServerError, err)
+		}
 		return
 	}
 	respondWithJSON(w, http.StatusCreated, appointment)
 }
+
+func (h *AppointmentHandler) HandleCancelAppointment(w http.ResponseWriter, r *http.Request) {
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	appointmentID, err := parseAppointmentID(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	var request model.CancelAppointmentRequest
+	if err := parseAndValidateRequest(r, &request); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	response, err := h.appointmentService.CancelAppointment(r.Context(), service.CancelAppointmentParams{
+		UserID:        payload.UserID,
+		Role:          payload.Role,
+		AppointmentID: appointmentID,
+		Reason:        request.Reason,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrAppointmentNotFound):
+			respondWithError(w, http.StatusNotFound, err)
+		case errors.Is(err, service.ErrAppointmentAccessDenied),
+			errors.Is(err, service.ErrStatusTransitionForbidden):
+			respondWithError(w, http.StatusForbidden, err)
+		case errors.Is(err, service.ErrAppointmentNotCancellable):
+			respondWithError(w, http.StatusConflict, err)
+		default:
+			log.Println(err)
+			respondWithError(w, http.StatusInternalServerError, errors.New("unable to cancel the appointment"))
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (h *AppointmentHandler) HandleRescheduleAppointment(w http.ResponseWriter, r *http.Request) {
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	appointmentID, err := parseAppointmentID(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	var request model.RescheduleAppointmentRequest
+	if err := parseAndValidateRequest(r, &request); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	appointment, err := h.appointmentService.RescheduleAppointment(r.Context(), service.RescheduleAppointmentParams{
+		UserID:        payload.UserID,
+		Role:          payload.Role,
+		AppointmentID: appointmentID,
+		StartTime:     request.StartTime,
+		Reason:        request.Reason,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrAppointmentNotFound):
+			respondWithError(w, http.StatusNotFound, err)
+		case errors.Is(err, service.ErrAppointmentAccessDenied):
+			respondWithError(w, http.StatusForbidden, err)
+		case errors.Is(err, service.ErrInvalidAppointmentTime):
+			respondWithError(w, http.StatusBadRequest, err)
+		case errors.Is(err, service.ErrAppointmentNotReschedulable),
+			errors.Is(err, service.ErrRescheduleWindowClosed),
+			errors.Is(err, service.ErrRescheduleLimitReached),
+			errors.Is(err, service.ErrSlotUnavailable),
+			errors.Is(err, service.ErrSlotTaken),
+			errors.Is(err, service.ErrBookingRules):
+			respondWithError(w, http.StatusConflict, err)
+		default:
+			log.Println(err)
+			respondWithError(w, http.StatusInternalServerError, errors.New("unable to reschedule the appointment"))
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusOK, appointment)
+}
+
+func (h *AppointmentHandler) HandleListReschedules(w http.ResponseWriter, r *http.Request) {
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	appointmentID, err := parseAppointmentID(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	reschedules, err := h.appointmentService.ListReschedules(r.Context(), payload.UserID, payload.Role, appointmentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrAppointmentNotFound):
+			respondWithError(w, http.StatusNotFound, err)
+		case errors.Is(err, service.ErrAppointmentAccessDenied):
+			respondWithError(w, http.StatusForbidden, err)
+		default:
+			log.Println(err)
+			respondWithError(w, http.StatusInternalServerError, errors.New("unable to get the reschedule history"))
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusOK, reschedules)
+}
+
+func (h *AppointmentHandler) HandleListStatusHistory(w http.ResponseWriter, r *http.Request) {
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	appointmentID, err := parseAppointmentID(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	history, err := h.appointmentService.ListStatusHistory(r.Context(), payload.UserID, payload.Role, appointmentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrAppointmentNotFound):
+			respondWithError(w, http.StatusNotFound, err)
+		case errors.Is(err, service.ErrAppointmentAccessDenied):
+			respondWithError(w, http.StatusForbidden, err)
+		default:
+			log.Println(err)
+			respondWithError(w, http.StatusInternalServerError, errors.New("unable to get the status history"))
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusOK, history)
+}
+
+func parseAppointmentID(r *http.Request) (int64, error) {
+	appointmentID, err := strconv.ParseInt(chi.URLParam(r, "appointmentId"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid appointmentId in path")
+	}
+	return appointmentID, nil
+}
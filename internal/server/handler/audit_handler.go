@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+	"github.com/mbeka02/lyra_backend/internal/server/service"
+)
+
+type AuditHandler struct {
+	auditService service.AuditService
+}
+
+func NewAuditHandler(auditService service.AuditService) *AuditHandler {
+	return &AuditHandler{
+		auditService,
+	}
+}
+
+// HandleListEvents reports the audit events between the from and to dates (inclusive) , it defaults to the last 30 days
+func (h *AuditHandler) HandleListEvents(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParamExtractor(r)
+	from, to, err := parseReportRange(params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	page := params.GetInt32("page", 0)
+	pageSize := int32(50)
+
+	response, err := h.auditService.ListEvents(r.Context(), repository.ListAuditEventsParams{
+		OccurredAfter:  from,
+		OccurredBefore: to,
+		PatientID:      params.GetInt64("patientId", 0),
+		ActorUserID:    params.GetInt64("actorUserId", 0),
+		ResourceType:   params.GetString("resourceType"),
+		Action:         params.GetString("action"),
+		Limit:          pageSize,
+		Offset:         page * pageSize,
+	})
+	if err != nil {
+		log.Println(err)
+		respondWithError(w, http.StatusInternalServerError, errors.New("unable to get the audit log"))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (h *AuditHandler) HandleVerifyChain(w http.ResponseWriter, r *http.Request) {
+	result, err := h.auditService.VerifyChain(r.Context())
+	if err != nil {
+		log.Println(err)
+		respondWithError(w, http.StatusInternalServerError, errors.New("unable to verify the audit log"))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// HandleListRecordAccesses shows the patient who has read or changed their record
+func (h *AuditHandler) HandleListRecordAccesses(w http.ResponseWriter, r *http.Request) {
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	params := NewQueryParamExtractor(r)
+	page := params.GetInt32("page", 0)
+	pageSize := int32(20)
+
+	response, err := h.auditService.ListRecordAccesses(r.Context(), payload.UserID, pageSize, page*pageSize)
+	if err != nil {
+		log.Println(err)
+		respondWithError(w, http.StatusInternalServerError, errors.New("unable to get the access history of your record"))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
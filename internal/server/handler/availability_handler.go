@@ -1,11 +1,15 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/mbeka02/lyra_backend/internal/database"
 	"github.com/mbeka02/lyra_backend/internal/model"
 	"github.com/mbeka02/lyra_backend/internal/server/service"
 )
@@ -28,12 +32,57 @@ func (h *AvailabilityHandler) HandleGetSlots(w http.ResponseWriter, r *http.Requ
 	}
 	slots, err := h.availabilityService.GetSlots(r.Context(), request)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err)
+		log.Println(err)
+		respondWithError(w, http.StatusInternalServerError, errors.New("unable to get the slots"))
 		return
 	}
 	respondWithJSON(w, http.StatusCreated, slots)
 }
 
+// maxSearchPage keeps the offset of a search within int32 , no one pages this far through the results
+const maxSearchPage = 1000
+
+var errInvalidSearchPage = fmt.Errorf("page must be between 0 and %d", maxSearchPage)
+
+func (h *AvailabilityHandler) HandleSearchSlots(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParamExtractor(r)
+	page := params.GetInt32("page", 0)
+	if page < 0 || page > maxSearchPage {
+		respondWithError(w, http.StatusBadRequest, errInvalidSearchPage)
+		return
+	}
+	pageSize := int32(10)
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from, to, err := parseDateRange(params, today, today.AddDate(0, 0, 7))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	response, err := h.availabilityService.SearchSlots(r.Context(), model.SlotSearchRequest{
+		County:         params.GetString("county"),
+		Specialization: params.GetString("specialization"),
+		MinPrice:       params.GetString("minPrice"),
+		MaxPrice:       params.GetString("maxPrice"),
+		MinExperience:  params.GetInt32("minExperience", 0),
+		MaxExperience:  params.GetInt32("maxExperience", 10000),
+		From:           from,
+		To:             to,
+		SlotsPerDoctor: params.GetInt32("slots", 0),
+		Limit:          pageSize,
+		Offset:         page * pageSize,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidSearchRange) {
+			respondWithError(w, http.StatusBadRequest, err)
+			return
+		}
+		log.Println(err)
+		respondWithError(w, http.StatusInternalServerError, errors.New("unable to search for slots"))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
 func (h *AvailabilityHandler) HandleCreateAvailability(w http.ResponseWriter, r *http.Request) {
 	var request model.CreateAvailabilityRequest
 	if err := parseAndValidateRequest(r, &request); err != nil {
@@ -108,3 +157,195 @@ func (h *AvailabilityHandler) HandleGetAvailabilityByDoctor(w http.ResponseWrite
 	}
 	respondWithJSON(w, http.StatusOK, response)
 }
+
+// ScheduleConflictError is returned when a block or a holiday would fall on appointments the doctor still has
+type ScheduleConflictError struct {
+	APIError
+	Appointments []database.ListBlockConflictsRow `json:"appointments"`
+}
+
+func respondWithScheduleConflict(w http.ResponseWriter, err error, appointments []database.ListBlockConflictsRow) {
+	respondWithJSON(w, http.StatusConflict, ScheduleConflictError{
+		APIError: APIError{
+			Status:  http.StatusConflict,
+			Message: http.StatusText(http.StatusConflict),
+			Detail:  err.Error(),
+		},
+		Appointments: appointments,
+	})
+}
+
+func (h *AvailabilityHandler) HandleCreateException(w http.ResponseWriter, r *http.Request) {
+	var request model.CreateAvailabilityExceptionRequest
+	if err := parseAndValidateRequest(r, &request); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	exception, conflicts, err := h.availabilityService.CreateException(r.Context(), request, payload.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidExceptionRange),
+			errors.Is(err, service.ErrInvalidExtraHours):
+			respondWithError(w, http.StatusBadRequest, err)
+		case errors.Is(err, service.ErrScheduleConflict):
+			respondWithScheduleConflict(w, err, conflicts)
+		default:
+			log.Println(err)
+			respondWithError(w, http.StatusInternalServerError, errors.New("unable to add the exception"))
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, exception)
+}
+
+// HandleListExceptions lists the exceptions in a range of dates , the next 90 days by default
+func (h *AvailabilityHandler) HandleListExceptions(w http.ResponseWriter, r *http.Request) {
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from, to, err := parseDateRange(NewQueryParamExtractor(r), today, today.AddDate(0, 0, 90))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	exceptions, err := h.availabilityService.ListExceptions(r.Context(), payload.UserID, from, to)
+	if err != nil {
+		log.Println(err)
+		respondWithError(w, http.StatusInternalServerError, errors.New("unable to get the exceptions"))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, exceptions)
+}
+
+func (h *AvailabilityHandler) HandleDeleteException(w http.ResponseWriter, r *http.Request) {
+	exceptionId, err := strconv.ParseInt(chi.URLParam(r, "exceptionId"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Errorf("invalid exception id:%w", err))
+		return
+	}
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	if err := h.availabilityService.DeleteException(r.Context(), exceptionId, payload.UserID); err != nil {
+		if errors.Is(err, service.ErrExceptionNotFound) {
+			respondWithError(w, http.StatusNotFound, err)
+			return
+		}
+		log.Println(err)
+		respondWithError(w, http.StatusInternalServerError, errors.New("unable to remove the exception"))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, "removed the exception from your schedule")
+}
+
+// HandleListHolidays lists the public holidays in a range of dates , the rest of the year by default
+func (h *AvailabilityHandler) HandleListHolidays(w http.ResponseWriter, r *http.Request) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	endOfYear := time.Date(today.Year()+1, time.January, 1, 0, 0, 0, 0, time.UTC)
+	from, to, err := parseDateRange(NewQueryParamExtractor(r), today, endOfYear)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	holidays, err := h.availabilityService.ListHolidays(r.Context(), from, to)
+	if err != nil {
+		log.Println(err)
+		respondWithError(w, http.StatusInternalServerError, errors.New("unable to get the public holidays"))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, holidays)
+}
+
+func (h *AvailabilityHandler) HandleSetHolidays(w http.ResponseWriter, r *http.Request) {
+	var request model.SetPublicHolidaysRequest
+	if err := parseAndValidateRequest(r, &request); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	conflicts, err := h.availabilityService.SetObservesHolidays(r.Context(), payload.UserID, *request.Observe)
+	if err != nil {
+		if errors.Is(err, service.ErrScheduleConflict) {
+			respondWithScheduleConflict(w, err, conflicts)
+			return
+		}
+		log.Println(err)
+		respondWithError(w, http.StatusInternalServerError, errors.New("unable to update the holiday setting"))
+		return
+	}
+	if *request.Observe {
+		respondWithJSON(w, http.StatusOK, "you won't be booked on public holidays")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, "you can be booked on public holidays")
+}
+
+func (h *AvailabilityHandler) HandleSetTimezone(w http.ResponseWriter, r *http.Request) {
+	var request model.SetTimezoneRequest
+	if err := parseAndValidateRequest(r, &request); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	timezone, err := h.availabilityService.SetTimezone(r.Context(), payload.UserID, request.Timezone)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidTimezone) {
+			respondWithError(w, http.StatusBadRequest, err)
+			return
+		}
+		log.Println(err)
+		respondWithError(w, http.StatusInternalServerError, errors.New("unable to update the timezone"))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"timezone": timezone})
+}
+
+func (h *AvailabilityHandler) HandleGetBookingRules(w http.ResponseWriter, r *http.Request) {
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	rules, err := h.availabilityService.GetBookingRules(r.Context(), payload.UserID)
+	if err != nil {
+		log.Println(err)
+		respondWithError(w, http.StatusInternalServerError, errors.New("unable to get the booking rules"))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, rules)
+}
+
+func (h *AvailabilityHandler) HandleSetBookingRules(w http.ResponseWriter, r *http.Request) {
+	var request model.SetBookingRulesRequest
+	if err := parseAndValidateRequest(r, &request); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	rules, err := h.availabilityService.SetBookingRules(r.Context(), request, payload.UserID)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidBookingRules) {
+			respondWithError(w, http.StatusBadRequest, err)
+			return
+		}
+		log.Println(err)
+		respondWithError(w, http.StatusInternalServerError, errors.New("unable to update the booking rules"))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, rules)
+}
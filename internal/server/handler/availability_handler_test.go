@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/server/service"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAvailabilityService struct {
+	service.AvailabilityService
+	searches []model.SlotSearchRequest
+}
+
+func (f *fakeAvailabilityService) SearchSlots(ctx context.Context, req model.SlotSearchRequest) (model.SlotSearchResponse, error) {
+	f.searches = append(f.searches, req)
+	return model.SlotSearchResponse{}, nil
+}
+
+func TestHandleSearchSlotsPage(t *testing.T) {
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedOffset int32
+	}{
+		{"first page by default", "", http.StatusOK, 0},
+		{"later page", "?page=3", http.StatusOK, 30},
+		{"last page allowed", "?page=1000", http.StatusOK, 10000},
+		{"negative page", "?page=-1", http.StatusBadRequest, 0},
+		{"page past the cap", "?page=1001", http.StatusBadRequest, 0},
+		{"page that would overflow the offset", "?page=300000000", http.StatusBadRequest, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			availabilityService := &fakeAvailabilityService{}
+			h := NewAvailabilityHandler(availabilityService)
+
+			rec := httptest.NewRecorder()
+			h.HandleSearchSlots(rec, httptest.NewRequest(http.MethodGet, "/api/v1/doctors/availability/search"+tc.query, nil))
+
+			require.Equal(t, tc.expectedStatus, rec.Code)
+			if tc.expectedStatus != http.StatusOK {
+				require.Empty(t, availabilityService.searches)
+				return
+			}
+			require.Len(t, availabilityService.searches, 1)
+			require.Equal(t, tc.expectedOffset, availabilityService.searches[0].Offset)
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/server/service"
+)
+
+const reportDateLayout = "2006-01-02"
+
+type BreakGlassHandler struct {
+	breakGlassService service.BreakGlassService
+}
+
+func NewBreakGlassHandler(breakGlassService service.BreakGlassService) *BreakGlassHandler {
+	return &BreakGlassHandler{
+		breakGlassService,
+	}
+}
+
+func (h *BreakGlassHandler) HandleGrantAccess(w http.ResponseWriter, r *http.Request) {
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	request := model.BreakGlassRequest{}
+	if err := parseAndValidateRequest(r, &request); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	grant, err := h.breakGlassService.GrantAccess(r.Context(), payload.UserID, request)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrPatientNotFound):
+			respondWithError(w, http.StatusNotFound, err)
+		case errors.Is(err, service.ErrBreakGlassNotNeeded):
+			respondWithError(w, http.StatusConflict, err)
+		default:
+			log.Println(err)
+			respondWithError(w, http.StatusInternalServerError, errors.New("unable to grant emergency access"))
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, grant)
+}
+
+// HandleListGrants reports the grants made between the from and to dates (inclusive) , it defaults to the last 30 days
+func (h *BreakGlassHandler) HandleListGrants(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParamExtractor(r)
+	from, to, err := parseReportRange(params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	page := params.GetInt32("page", 0)
+	pageSize := int32(20)
+	offset := page * pageSize
+
+	response, err := h.breakGlassService.ListGrants(r.Context(), from, to, params.GetInt64("patientId", 0), params.GetInt64("doctorId", 0), pageSize, offset)
+	if err != nil {
+		log.Println(err)
+		respondWithError(w, http.StatusInternalServerError, errors.New("unable to get the emergency access report"))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (h *BreakGlassHandler) HandleListAccesses(w http.ResponseWriter, r *http.Request) {
+	grantID, err := strconv.ParseInt(chi.URLParam(r, "grantId"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Errorf("invalid grantId in path"))
+		return
+	}
+	accesses, err := h.breakGlassService.ListAccesses(r.Context(), grantID)
+	if err != nil {
+		log.Println(err)
+		respondWithError(w, http.StatusInternalServerError, errors.New("unable to get the reads made under this grant"))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, accesses)
+}
+
+// parseReportRange reads the from and to dates of a report , to is inclusive so the range ends at the start of the next day
+func parseReportRange(params *QueryParamExtractor) (time.Time, time.Time, error) {
+	now := time.Now().UTC()
+	return parseDateRange(params, now.AddDate(0, 0, -30), now)
+}
+
+// parseDateRange reads the from and to dates of a range , the defaults are used for the dates that aren't set
+func parseDateRange(params *QueryParamExtractor, from, to time.Time) (time.Time, time.Time, error) {
+	if value := params.GetString("to"); value != "" {
+		date, err := time.Parse(reportDateLayout, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to date , expected YYYY-MM-DD")
+		}
+		to = date.AddDate(0, 0, 1)
+	}
+	if value := params.GetString("from"); value != "" {
+		date, err := time.Parse(reportDateLayout, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from date , expected YYYY-MM-DD")
+		}
+		from = date
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("the from date must be before the to date")
+	}
+	return from, to, nil
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mbeka02/lyra_backend/internal/server/service"
+)
+
+type CalendarHandler struct {
+	calendarService service.CalendarService
+}
+
+func NewCalendarHandler(calendarService service.CalendarService) *CalendarHandler {
+	return &CalendarHandler{
+		calendarService,
+	}
+}
+
+func (h *CalendarHandler) HandleCreateFeed(w http.ResponseWriter, r *http.Request) {
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	feedURL, err := h.calendarService.CreateFeed(r.Context(), payload.UserID)
+	if err != nil {
+		log.Println(err)
+		respondWithError(w, http.StatusInternalServerError, errors.New("unable to create the calendar feed"))
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, map[string]string{"url": feedURL})
+}
+
+func (h *CalendarHandler) HandleDeleteFeed(w http.ResponseWriter, r *http.Request) {
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	if err := h.calendarService.DeleteFeed(r.Context(), payload.UserID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrCalendarFeedNotFound):
+			respondWithError(w, http.StatusNotFound, err)
+		default:
+			log.Println(err)
+			respondWithError(w, http.StatusInternalServerError, errors.New("unable to delete the calendar feed"))
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusOK, "calendar feed deleted")
+}
+
+// HandleGetFeed serves the feed to calendar apps , the token in the URL is the only credential
+func (h *CalendarHandler) HandleGetFeed(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimSuffix(chi.URLParam(r, "feed"), ".ics")
+	feed, err := h.calendarService.Feed(r.Context(), token)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrCalendarFeedNotFound):
+			respondWithError(w, http.StatusNotFound, err)
+		default:
+			log.Println(err)
+			respondWithError(w, http.StatusInternalServerError, errors.New("unable to get the calendar feed"))
+		}
+		return
+	}
+	if err := respondWithCalendar(w, feed); err != nil {
+		log.Println(err)
+	}
+}
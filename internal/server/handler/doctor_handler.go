@@ -59,6 +59,10 @@ func (h *DoctorHandler) HandleCreateDoctor(w http.ResponseWriter, r *http.Reques
 	}
 	response, err := h.doctorService.CreateDoctor(r.Context(), request, payload.UserID)
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidTimezone) {
+			respondWithError(w, http.StatusBadRequest, err)
+			return
+		}
 		respondWithError(w, http.StatusInternalServerError, err)
 		return
 	}
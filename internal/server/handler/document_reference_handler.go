@@ -5,30 +5,49 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"strconv"
 
+	"github.com/mbeka02/lyra_backend/internal/auth"
 	"github.com/mbeka02/lyra_backend/internal/model"
 	"github.com/mbeka02/lyra_backend/internal/server/middleware"
 	"github.com/mbeka02/lyra_backend/internal/server/service"
 )
 
 type DocumentReferenceHandler struct {
-	patientService  service.PatientService
+	accessPolicy    service.AccessPolicy
 	doctorService   service.DoctorService
 	documentService service.DocumentReferenceService
 }
 
-func NewDocumentReferenceHandler(patientService service.PatientService, doctorService service.DoctorService, documentService service.DocumentReferenceService) *DocumentReferenceHandler {
-	return &DocumentReferenceHandler{patientService, doctorService, documentService}
+func NewDocumentReferenceHandler(accessPolicy service.AccessPolicy, doctorService service.DoctorService, documentService service.DocumentReferenceService) *DocumentReferenceHandler {
+	return &DocumentReferenceHandler{accessPolicy, doctorService, documentService}
 }
 
 func (h *DocumentReferenceHandler) HandleCreateSignedURL(w http.ResponseWriter, r *http.Request) {
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
 	var request model.GetSignedURLRequest
 	if err := parseAndValidateRequest(r, &request); err != nil {
 		respondWithError(w, http.StatusBadRequest, err)
 		return
 	}
-	signedURL, err := h.documentService.GetSignedURL(r.Context(), request.UnsignedURL)
+	// only patient documents can be signed and only for users who can read the record of the patient they belong to
+	documentPatientID, err := service.DocumentPatientID(request.UnsignedURL)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	// downloading a document is a read , so it is allowed under break-glass access
+	patientID, ok := resolvePatientAccess(w, r, h.accessPolicy, payload, model.PatientAccessRequest{
+		PatientID: documentPatientID,
+		ReadOnly:  true,
+		Resource:  "GET " + request.UnsignedURL,
+	})
+	if !ok {
+		return
+	}
+	signedURL, err := h.documentService.GetSignedURL(r.Context(), patientID, request.UnsignedURL)
 	if err != nil {
 
 		log.Println(err)
@@ -72,30 +91,14 @@ func (h *DocumentReferenceHandler) HandleCreateDocumentReference(w http.Response
 		return
 	}
 
-	// determine Actual PatientID and SpecialistID using Services
-	var targetPatientID int64
+	// patients upload for themselves , specialists have to name a patient under their care in the metadata
+	targetPatientID, ok := resolvePatientID(w, r, h.accessPolicy, payload, reqMetadata.PatientID)
+	if !ok {
+		return
+	}
 	var uploaderSpecialistID *int64 // Pointer because it's optional
 
-	if payload.Role == "patient" {
-		// Patient uploads for themselves. Get their PatientID.
-		pID, err := h.patientService.GetPatientIdByUserId(r.Context(), payload.UserID) // Assume service method exists
-		if err != nil {
-			// Consider specific errors, e.g., sql.ErrNoRows -> Patient not found
-			respondWithError(w, http.StatusInternalServerError, fmt.Errorf("failed to find patient record for user: %w", err))
-			return
-		}
-		targetPatientID = pID
-		// SpecialistID remains nil
-
-	} else if payload.Role == "specialist" {
-		// Specialist uploads FOR a patient.
-		// Target PatientID *must* be in the metadata provided by the specialist.
-		if reqMetadata.PatientID == 0 { // Assuming 0 indicates not provided in JSON
-			respondWithError(w, http.StatusBadRequest, fmt.Errorf("metadata must include target patientId when uploaded by a specialist"))
-			return
-		}
-		targetPatientID = reqMetadata.PatientID // Trust the ID provided by the specialist (add validation/authz later)
-
+	if payload.Role == auth.RoleSpecialist {
 		// get the SpecialistID of the uploader (for Author field).
 		spID, err := h.doctorService.GetDoctorIdByUserId(r.Context(), payload.UserID) // Assume service method exists
 		if err != nil {
@@ -104,15 +107,8 @@ func (h *DocumentReferenceHandler) HandleCreateDocumentReference(w http.Response
 		}
 		tempSpID := spID                 // Create temp var to take address
 		uploaderSpecialistID = &tempSpID // Assign the pointer
-
-	} else {
-		respondWithError(w, http.StatusForbidden, fmt.Errorf("user role not permitted to upload documents"))
-		return
 	}
 
-	// Authorization Check
-	// E.g., If specialist, check if they are allowed to access/modify targetPatientID's records.
-
 	// prepare input for the DocumentReferenceService
 	// update the metadata struct with the *verified/derived* IDs
 	reqMetadata.PatientID = targetPatientID
@@ -139,62 +135,20 @@ func (h *DocumentReferenceHandler) HandleCreateDocumentReference(w http.Response
 
 // handleListPatientDocuments handles GET requests for a patient's documents.
 func (h *DocumentReferenceHandler) HandleListPatientDocuments(w http.ResponseWriter, r *http.Request) {
-	var blockTracker string
 	// ensure auth payload is present
 	payload, ok := getAuthPayload(w, r)
 	if !ok {
 		return
 	}
-	// Extract Target Patient ID
-	var targetPatientID int64
-	// params
 	params := NewQueryParamExtractor(r)
-	patientIdStr := params.GetString("patientId")
-
-	// Can the authenticated user (payload.UserID, payload.Role) view documents for targetPatientID?
-	authorized := false
-	if payload.Role == "patient" {
-		// Is the patient viewing their own documents?
-		pID, err := h.patientService.GetPatientIdByUserId(r.Context(), payload.UserID)
-		if err == nil {
-			authorized = true
-		}
-		blockTracker = "patient block"
-		targetPatientID = pID
-	} else if payload.Role == "specialist" {
-		blockTracker = "specialist block"
-		// Is the specialist viewing documents for a patient under their care?
-		// This requires logic in the specialistService/Repo to check the relationship.
-		if patientIdStr == "" {
-			respondWithError(w, http.StatusBadRequest, fmt.Errorf("missing required patientId parameter"))
-			return
-		}
-
-		pID, err := strconv.ParseInt(patientIdStr, 10, 64)
-		if err != nil {
-			respondWithError(w, http.StatusBadRequest, fmt.Errorf("invalid patientId parameter: %v", err))
-			return
-		}
-		targetPatientID = pID
-		// First, get the DoctorID for the logged-in user
-		doctorID, err := h.doctorService.GetDoctorIdByUserId(r.Context(), payload.UserID)
-		if err != nil {
-			log.Printf("Auth check failed for specialist user %d: %v\n", payload.UserID, err)
-			respondWithError(w, http.StatusInternalServerError, fmt.Errorf("failed to retrieve doctor information"))
-			return
-		}
-		// Now, check the care relationship using the service method
-		isUnderCare, err := h.doctorService.IsPatientUnderCare(r.Context(), doctorID, targetPatientID)
-		if err != nil {
-			// Log the error from the care check
-			log.Printf("Auth check error for doctor %d viewing patient %d: %v\n", doctorID, targetPatientID, err)
-		} else {
-			authorized = isUnderCare // Authorize if the service confirms care relationship
-		}
+	// patients can leave out the patientId , they only ever see their own documents
+	requestedPatientID, err := parseOptionalPatientID(params.GetString("patientId"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
 	}
-
-	if !authorized {
-		respondWithError(w, http.StatusForbidden, fmt.Errorf("you are not authorized to view documents for this patient"))
+	targetPatientID, ok := resolvePatientID(w, r, h.accessPolicy, payload, requestedPatientID)
+	if !ok {
 		return
 	}
 
@@ -206,7 +160,6 @@ func (h *DocumentReferenceHandler) HandleListPatientDocuments(w http.ResponseWri
 	}
 
 	pageToken := params.GetString("_page_token") // Or other token param if used
-	log.Printf("%s:%v", blockTracker, targetPatientID)
 	// Call the Service
 	bundle, err := h.documentService.ListPatientDocuments(r.Context(), targetPatientID, count, pageToken)
 	// log.Printf("...outputing the bundle fo the %s , bundle:%v", blockTracker, bundle)
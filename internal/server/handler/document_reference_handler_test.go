@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mbeka02/lyra_backend/internal/auth"
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/server/middleware"
+	"github.com/mbeka02/lyra_backend/internal/server/service"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAccessPolicy struct {
+	service.AccessPolicy
+	// the patients the user can read
+	allowed map[int64]bool
+	// the access the policy was asked about
+	access model.PatientAccessRequest
+}
+
+func (f *fakeAccessPolicy) ResolvePatientID(ctx context.Context, payload *auth.Payload, access model.PatientAccessRequest) (int64, error) {
+	f.access = access
+	if !f.allowed[access.PatientID] {
+		return 0, service.ErrPatientAccessDenied
+	}
+	return access.PatientID, nil
+}
+
+type fakeDocumentService struct {
+	service.DocumentReferenceService
+	signed []string
+}
+
+func (f *fakeDocumentService) GetSignedURL(ctx context.Context, patientID int64, unsignedURL string) (string, error) {
+	f.signed = append(f.signed, unsignedURL)
+	return unsignedURL + "?signed", nil
+}
+
+func TestHandleCreateSignedURL(t *testing.T) {
+	testCases := []struct {
+		name           string
+		unsignedURL    string
+		expectedStatus int
+	}{
+		{"document of a patient the user can read", "https://storage.googleapis.com/lyra-records/patients_7_documents_a1_.pdf", http.StatusCreated},
+		{"document of another patient", "https://storage.googleapis.com/lyra-records/patients_8_documents_a1_.pdf", http.StatusForbidden},
+		{"object outside the patient documents", "https://storage.googleapis.com/lyra-images/user_8_profile.jpg", http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy := &fakeAccessPolicy{allowed: map[int64]bool{7: true}}
+			documentService := &fakeDocumentService{}
+			h := NewDocumentReferenceHandler(policy, nil, documentService)
+
+			body := strings.NewReader(`{"unsigned_url":"` + tc.unsignedURL + `"}`)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/documents/signed-url", body)
+			req = req.WithContext(middleware.WithAuthPayload(req.Context(), &auth.Payload{UserID: 1, Role: auth.RoleSpecialist}))
+			rec := httptest.NewRecorder()
+			h.HandleCreateSignedURL(rec, req)
+
+			require.Equal(t, tc.expectedStatus, rec.Code)
+			if tc.expectedStatus == http.StatusCreated {
+				require.Equal(t, []string{tc.unsignedURL}, documentService.signed)
+			} else {
+				require.Empty(t, documentService.signed)
+			}
+			if tc.expectedStatus != http.StatusBadRequest {
+				// the download is checked as a read so that break-glass grants apply
+				require.True(t, policy.access.ReadOnly)
+			}
+		})
+	}
+}
@@ -4,13 +4,19 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/mbeka02/lyra_backend/internal/auth"
+	"github.com/mbeka02/lyra_backend/internal/model"
 	"github.com/mbeka02/lyra_backend/internal/server/middleware"
+	"github.com/mbeka02/lyra_backend/internal/server/service"
 )
 
 var validate *validator.Validate
@@ -147,6 +153,24 @@ func respondWithImage(w http.ResponseWriter, data []byte) error {
 	return nil
 }
 
+// respondWithCalendar writes an iCalendar object , calendar apps go by the content type when subscribing
+func respondWithCalendar(w http.ResponseWriter, data []byte) error {
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("unable to write the data to the connection:%v", err)
+	}
+	return nil
+}
+
+// setRetryAfter tells the client how many seconds to wait before retrying , it rounds up so it never undershoots
+func setRetryAfter(w http.ResponseWriter, retryAt time.Time) {
+	seconds := int64(math.Ceil(time.Until(retryAt).Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+}
+
 // respondWithError handles error responses in a consistent format
 func respondWithError(w http.ResponseWriter, status int, err error) {
 	apiError := APIError{
@@ -204,6 +228,56 @@ func getAuthPayload(w http.ResponseWriter, r *http.Request) (*auth.Payload, bool
 	return payload, true
 }
 
+// resolvePatientID runs the access policy for the patient whose records are being handled.
+// If the user isn't allowed to act on the patient, it writes an error response and returns false.
+func resolvePatientID(w http.ResponseWriter, r *http.Request, policy service.AccessPolicy, payload *auth.Payload, requestedPatientID int64) (int64, bool) {
+	return resolvePatientAccess(w, r, policy, payload, middleware.NewPatientAccessRequest(r, requestedPatientID))
+}
+
+// resolvePatientAccess is resolvePatientID for requests that don't map onto the method and path of the request ,
+// e.g. signing a download URL is a read even though it is a POST
+func resolvePatientAccess(w http.ResponseWriter, r *http.Request, policy service.AccessPolicy, payload *auth.Payload, access model.PatientAccessRequest) (int64, bool) {
+	requestedPatientID := access.PatientID
+	patientID, err := policy.ResolvePatientID(r.Context(), payload, access)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrPatientAccessDenied):
+			respondWithError(w, http.StatusForbidden, err)
+		case errors.Is(err, service.ErrMissingPatientID):
+			respondWithError(w, http.StatusBadRequest, err)
+		default:
+			log.Printf("access check failed for user %d on patient %d: %v", payload.UserID, requestedPatientID, err)
+			respondWithError(w, http.StatusInternalServerError, errors.New("unable to verify access to the records of this patient"))
+		}
+		return 0, false
+	}
+	return patientID, true
+}
+
+// parseOptionalPatientID parses a patientId that the caller is allowed to leave out , 0 means it wasn't set
+func parseOptionalPatientID(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	patientID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid patientId parameter: %v", err)
+	}
+	return patientID, nil
+}
+
+// getClientInfo describes the device making the request , RemoteAddr is already set to the real IP by the RealIP middleware
+func getClientInfo(r *http.Request) model.ClientInfo {
+	clientIP := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		clientIP = host
+	}
+	return model.ClientInfo{
+		UserAgent: r.UserAgent(),
+		ClientIP:  clientIP,
+	}
+}
+
 func init() {
 	validate = validator.New(validator.WithRequiredStructEnabled())
 }
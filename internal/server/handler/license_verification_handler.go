@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/server/service"
+)
+
+type LicenseVerificationHandler struct {
+	verificationService service.LicenseVerificationService
+}
+
+func NewLicenseVerificationHandler(verificationService service.LicenseVerificationService) *LicenseVerificationHandler {
+	return &LicenseVerificationHandler{
+		verificationService,
+	}
+}
+
+func (h *LicenseVerificationHandler) HandleUploadLicense(w http.ResponseWriter, r *http.Request) {
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	_, fileHeader, err := r.FormFile("license")
+	if err != nil {
+		if errors.Is(err, http.ErrMissingFile) {
+			respondWithError(w, http.StatusBadRequest, fmt.Errorf("missing required file field 'license'"))
+		} else {
+			respondWithError(w, http.StatusBadRequest, fmt.Errorf("error retrieving file 'license': %w", err))
+		}
+		return
+	}
+	document, err := h.verificationService.UploadLicense(r.Context(), payload.UserID, fileHeader)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidLicenseDocument) {
+			respondWithError(w, http.StatusBadRequest, err)
+			return
+		}
+		log.Println(err)
+		respondWithError(w, http.StatusInternalServerError, errors.New("unable to upload the license document"))
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, document)
+}
+
+func (h *LicenseVerificationHandler) HandleGetOwnVerification(w http.ResponseWriter, r *http.Request) {
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	response, err := h.verificationService.GetOwnVerification(r.Context(), payload.UserID)
+	if err != nil {
+		log.Println(err)
+		respondWithError(w, http.StatusInternalServerError, errors.New("unable to get the verification status"))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// HandleListDoctors returns the doctors in a verification status , it defaults to the pending review queue
+func (h *LicenseVerificationHandler) HandleListDoctors(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParamExtractor(r)
+	status := database.VerificationStatus(params.GetString("status"))
+	if status == "" {
+		status = database.VerificationStatusPending
+	}
+	switch status {
+	case database.VerificationStatusPending, database.VerificationStatusVerified, database.VerificationStatusRejected, database.VerificationStatusSuspended:
+	default:
+		respondWithError(w, http.StatusBadRequest, fmt.Errorf("invalid status , expected pending , verified , rejected or suspended"))
+		return
+	}
+	page := params.GetInt32("page", 0)
+	pageSize := int32(20)
+	response, err := h.verificationService.ListByStatus(r.Context(), status, pageSize, page*pageSize)
+	if err != nil {
+		log.Println(err)
+		respondWithError(w, http.StatusInternalServerError, errors.New("unable to get the doctors"))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (h *LicenseVerificationHandler) HandleGetVerification(w http.ResponseWriter, r *http.Request) {
+	doctorID, ok := parseDoctorID(w, r)
+	if !ok {
+		return
+	}
+	response, err := h.verificationService.GetVerification(r.Context(), doctorID)
+	if err != nil {
+		if errors.Is(err, service.ErrDoctorNotFound) {
+			respondWithError(w, http.StatusNotFound, err)
+			return
+		}
+		log.Println(err)
+		respondWithError(w, http.StatusInternalServerError, errors.New("unable to get the verification status"))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (h *LicenseVerificationHandler) HandleApprove(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, database.VerificationStatusVerified)
+}
+
+func (h *LicenseVerificationHandler) HandleReject(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, database.VerificationStatusRejected)
+}
+
+func (h *LicenseVerificationHandler) HandleSuspend(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, database.VerificationStatusSuspended)
+}
+
+func (h *LicenseVerificationHandler) review(w http.ResponseWriter, r *http.Request, to database.VerificationStatus) {
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	doctorID, ok := parseDoctorID(w, r)
+	if !ok {
+		return
+	}
+	request := model.ReviewDoctorRequest{}
+	if err := parseAndValidateRequest(r, &request); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	response, err := h.verificationService.Review(r.Context(), payload.UserID, doctorID, to, request)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrReviewReasonRequired):
+			respondWithError(w, http.StatusBadRequest, err)
+		case errors.Is(err, service.ErrDoctorNotFound):
+			respondWithError(w, http.StatusNotFound, err)
+		case errors.Is(err, service.ErrInvalidVerificationTransition):
+			respondWithError(w, http.StatusConflict, err)
+		default:
+			log.Println(err)
+			respondWithError(w, http.StatusInternalServerError, errors.New("unable to update the verification status"))
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func parseDoctorID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	doctorID, err := strconv.ParseInt(chi.URLParam(r, "doctorId"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Errorf("invalid doctorId in path"))
+		return 0, false
+	}
+	return doctorID, true
+}
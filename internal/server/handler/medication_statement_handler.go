@@ -43,8 +43,6 @@ func (h *MedicationHandler) HandleCreateMedication(w http.ResponseWriter, r *htt
 
 	// TODO: Add validation for req fields (e.g., status value from enum)
 
-	// TODO: Authorization check: Can payload.UserID create a medication statement for targetPatientID?
-
 	med, err := h.medicationService.CreateMedication(r.Context(), req, payload.UserID, targetPatientID)
 	if err != nil {
 		// Consider more specific error codes based on service error types
@@ -67,8 +65,6 @@ func (h *MedicationHandler) HandleListMedications(w http.ResponseWriter, r *http
 		return
 	}
 
-	// TODO: Authorization check: Can payload.UserID list medication statements for targetPatientID?
-
 	meds, err := h.medicationService.ListMedicationsForPatient(r.Context(), payload.UserID, targetPatientID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("failed to list medication statements: %w", err))
@@ -97,8 +93,6 @@ func (h *MedicationHandler) HandleGetMedication(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	// TODO: Authorization check: Can payload.UserID get this specific medication statement for targetPatientID?
-
 	med, err := h.medicationService.GetMedication(r.Context(), medicationID, payload.UserID, targetPatientID)
 	if err != nil {
 
@@ -134,7 +128,6 @@ func (h *MedicationHandler) HandleUpdateMedication(w http.ResponseWriter, r *htt
 		respondWithError(w, http.StatusBadRequest, err)
 		return
 	}
-	// TODO: Authorization check
 
 	updatedMed, err := h.medicationService.UpdateMedication(r.Context(), medicationID, req, payload.UserID, targetPatientID)
 	if err != nil {
@@ -164,8 +157,6 @@ func (h *MedicationHandler) HandleDeleteMedication(w http.ResponseWriter, r *htt
 		return
 	}
 
-	// TODO: Authorization check
-
 	err = h.medicationService.DeleteMedication(r.Context(), medicationID, payload.UserID, targetPatientID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("failed to delete medication statement: %w", err))
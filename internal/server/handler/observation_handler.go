@@ -3,7 +3,6 @@ package handler
 import (
 	"database/sql"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 
@@ -14,29 +13,23 @@ import (
 )
 
 type ObservationHandler struct {
-	patientService     service.PatientService
+	accessPolicy       service.AccessPolicy
 	doctorService      service.DoctorService
 	observationService service.ObservationService
 }
 
-func NewObservationHandler(patientService service.PatientService, doctorService service.DoctorService, observationService service.ObservationService) *ObservationHandler {
-	return &ObservationHandler{patientService, doctorService, observationService}
+func NewObservationHandler(accessPolicy service.AccessPolicy, doctorService service.DoctorService, observationService service.ObservationService) *ObservationHandler {
+	return &ObservationHandler{accessPolicy, doctorService, observationService}
 }
 
 // HandleCreateConsultationNote handles POST requests to create a new consultation note.
-// This endpoint should be restricted to specialists.
+// Only roles with the notes:write permission get to this handler.
 func (h *ObservationHandler) HandleCreateConsultationNote(w http.ResponseWriter, r *http.Request) {
 	// ensure auth payload is present
 	payload, ok := getAuthPayload(w, r)
 	if !ok {
 		return
 	}
-	// Ensure the user is a specialist
-	// TODO: Move these role checks to a middleware function
-	if payload.Role != "specialist" {
-		respondWithError(w, http.StatusForbidden, fmt.Errorf("access denied: only specialists can create notes"))
-		return
-	}
 
 	doctorID, err := h.doctorService.GetDoctorIdByUserId(r.Context(), payload.UserID)
 	if err != nil {
@@ -51,20 +44,8 @@ func (h *ObservationHandler) HandleCreateConsultationNote(w http.ResponseWriter,
 
 		return
 	}
-	// TODO: Make a utility function for these authorization checks
-	// Authorization Check: Is this doctor allowed to create notes for this patient?
-
-	authorized := false
-	isUnderCare, err := h.doctorService.IsPatientUnderCare(r.Context(), doctorID, request.PatientID)
-	if err != nil {
-		// Log the error from the care check
-		log.Printf("Auth check error for doctor %d viewing patient %d: %v\n", doctorID, request.PatientID, err)
-	} else {
-		authorized = isUnderCare // Authorize if the service confirms care relationship
-	}
-
-	if !authorized {
-		respondWithError(w, http.StatusForbidden, fmt.Errorf("you are not authorized to modify the details for this patient"))
+	// Is this doctor allowed to create notes for this patient?
+	if _, ok := resolvePatientID(w, r, h.accessPolicy, payload, request.PatientID); !ok {
 		return
 	}
 
@@ -84,51 +65,15 @@ func (h *ObservationHandler) HandleListPatientObservations(w http.ResponseWriter
 	if !ok {
 		return
 	}
-	// Extract Target Patient ID
-	var targetPatientID int64
-	// params
 	params := NewQueryParamExtractor(r)
-	patientIdStr := params.GetString("patientId")
-
-	// Authorization Check
-	// Can the authenticated user (payload.UserID, payload.Role) view observations for targetPatientID?
-	authorized := false
-	if payload.Role == "patient" {
-		// Is the patient viewing their own documents?
-		pID, err := h.patientService.GetPatientIdByUserId(r.Context(), payload.UserID)
-		if err == nil /*&& pID == targetPatientID*/ {
-			authorized = true
-		}
-		targetPatientID = pID
-	} else if payload.Role == "specialist" {
-		// Is the specialist viewing documents for a patient under their care?
-		if patientIdStr == "" {
-			respondWithError(w, http.StatusBadRequest, fmt.Errorf("missing required patientId parameter"))
-			return
-		}
-		targetPatientID, err := strconv.ParseInt(patientIdStr, 10, 64)
-		if err != nil {
-			respondWithError(w, http.StatusBadRequest, fmt.Errorf("invalid patientId parameter: %v", err))
-			return
-		}
-		// First, get the DoctorID for the logged-in user
-		doctorID, err := h.doctorService.GetDoctorIdByUserId(r.Context(), payload.UserID)
-		if err != nil {
-			log.Printf("Auth check failed for specialist user %d: %v\n", payload.UserID, err)
-			respondWithError(w, http.StatusInternalServerError, fmt.Errorf("failed to retrieve doctor information"))
-			return
-		}
-		// Now, check the care relationship using the service method
-		isUnderCare, err := h.doctorService.IsPatientUnderCare(r.Context(), doctorID, targetPatientID)
-		if err != nil {
-			// Log the error from the care check
-			log.Printf("Auth check error for doctor %d viewing patient %d: %v\n", doctorID, targetPatientID, err)
-		} else {
-			authorized = isUnderCare // Authorize if the service confirms care relationship
-		}
+	// patients can leave out the patientId , they only ever see their own observations
+	requestedPatientID, err := parseOptionalPatientID(params.GetString("patientId"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
 	}
-	if !authorized {
-		respondWithError(w, http.StatusForbidden, fmt.Errorf("not authorized to view observations for this patient"))
+	targetPatientID, ok := resolvePatientID(w, r, h.accessPolicy, payload, requestedPatientID)
+	if !ok {
 		return
 	}
 
@@ -292,8 +237,6 @@ func (h *ObservationHandler) HandleDeleteObservation(w http.ResponseWriter, r *h
 		return
 	}
 
-	// TODO: Authorization check
-
 	err = h.observationService.DeleteObservation(r.Context(), observationID, payload.UserID, targetPatientID)
 	if err != nil {
 		if err == sql.ErrNoRows {
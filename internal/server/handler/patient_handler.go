@@ -7,17 +7,20 @@ import (
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/mbeka02/lyra_backend/internal/audit"
 	"github.com/mbeka02/lyra_backend/internal/model"
 	"github.com/mbeka02/lyra_backend/internal/server/service"
 )
 
 type PatientHandler struct {
 	patientService service.PatientService
+	auditService   service.AuditService
 }
 
-func NewPatientHandler(patientService service.PatientService) *PatientHandler {
+func NewPatientHandler(patientService service.PatientService, auditService service.AuditService) *PatientHandler {
 	return &PatientHandler{
 		patientService,
+		auditService,
 	}
 }
 
@@ -34,6 +37,12 @@ func (h *PatientHandler) HandleGetPatient(w http.ResponseWriter, r *http.Request
 		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("unable to get patient details"))
 		return
 	}
+	h.auditService.Record(r.Context(), service.AuditEntry{
+		PatientID:    patientID,
+		ResourceType: audit.ResourcePatient,
+		ResourceID:   patientParam,
+		Action:       audit.ActionRead,
+	})
 	respondWithJSON(w, http.StatusOK, patientDetails)
 }
 
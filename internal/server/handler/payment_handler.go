@@ -1,20 +1,19 @@
 package handler
 
 import (
-	"crypto/hmac"
-	"crypto/sha512"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
-	"os"
 
-	_ "github.com/joho/godotenv/autoload"
-
-	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/payment"
 	"github.com/mbeka02/lyra_backend/internal/server/service"
 )
 
+// the webhook payloads are a few kilobytes , anything much bigger isn't from a payment provider
+const maxWebhookBodySize = 1 << 20
+
 type PaymentHandler struct {
 	paymentService service.PaymentService
 }
@@ -56,34 +55,58 @@ func (h *PaymentHandler) GetPaymentStatus(w http.ResponseWriter, r *http.Request
 	})
 }
 
-// this is the webhook endpoint that paystack will use
+// this is the webhook endpoint that paystack will use , any event that isn't acted on still gets a 200 so that paystack stops retrying it
 func (h *PaymentHandler) PaymentWebhook(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("error , unable to read request body:%v", err))
+	if err := h.handleWebhook(w, r, payment.MethodPaystack); err != nil {
+		respondWithError(w, webhookErrorStatus(err), err)
 		return
 	}
-	defer r.Body.Close()
-	secretKey := os.Getenv("PAYSTACK_API_KEY")
-	// create HMAC hash
-	mac := hmac.New(sha512.New, []byte(secretKey))
-	mac.Write(body)
-	expectedHash := hex.EncodeToString(mac.Sum(nil))
-	signature := r.Header.Get("x-paystack-signature")
-	if expectedHash != signature {
-		respondWithError(w, http.StatusUnauthorized, fmt.Errorf("invalid signature"))
+
+	var nilValue interface{}
+	respondWithJSON(w, http.StatusOK, nilValue)
+}
+
+// this is the callback endpoint that daraja will use for STK pushes and refunds , daraja expects a ResultCode in every response
+func (h *PaymentHandler) MpesaCallback(w http.ResponseWriter, r *http.Request) {
+	if err := h.handleWebhook(w, r, payment.MethodMpesa); err != nil {
+		respondWithJSON(w, webhookErrorStatus(err), map[string]interface{}{
+			"ResultCode": 1,
+			"ResultDesc": err.Error(),
+		})
 		return
 	}
-	request := model.PaystackWebhookPayload{}
-	if err := parseAndValidateRequest(r, &request); err != nil {
-		respondWithError(w, http.StatusBadRequest, err)
-		return
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"ResultCode": 0,
+		"ResultDesc": "Accepted",
+	})
+}
+
+// handleWebhook reads the body of a webhook request and passes it to the provider of the payment method
+func (h *PaymentHandler) handleWebhook(w http.ResponseWriter, r *http.Request, method string) error {
+	defer r.Body.Close()
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+	if err != nil {
+		return fmt.Errorf("%w:unable to read request body:%v", service.ErrInvalidWebhookPayload, err)
 	}
-	if err = h.paymentService.UpdateStatusWebhook(r.Context(), request); err != nil {
-		respondWithError(w, http.StatusInternalServerError, err)
-		return
+	err = h.paymentService.HandleWebhook(r.Context(), method, payment.WebhookRequest{
+		Body:   body,
+		Header: r.Header,
+		Query:  r.URL.Query(),
+	})
+	if err != nil && !errors.Is(err, service.ErrInvalidWebhookSignature) && !errors.Is(err, service.ErrInvalidWebhookPayload) {
+		log.Println(err)
+		return errors.New("unable to process the webhook event")
 	}
+	return err
+}
 
-	var nilValue interface{}
-	respondWithJSON(w, http.StatusOK, nilValue)
+func webhookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidWebhookSignature):
+		return http.StatusUnauthorized
+	case errors.Is(err, service.ErrInvalidWebhookPayload):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
 }
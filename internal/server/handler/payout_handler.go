@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/server/service"
+)
+
+type PayoutHandler struct {
+	payoutService service.PayoutService
+}
+
+func NewPayoutHandler(payoutService service.PayoutService) *PayoutHandler {
+	return &PayoutHandler{
+		payoutService,
+	}
+}
+
+// HandleRegisterAccount registers (or replaces) the bank account the doctor's share of each payment is settled to
+func (h *PayoutHandler) HandleRegisterAccount(w http.ResponseWriter, r *http.Request) {
+	var request model.RegisterPayoutAccountRequest
+	if err := parseAndValidateRequest(r, &request); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	account, err := h.payoutService.RegisterAccount(r.Context(), service.RegisterPayoutAccountParams{
+		UserID:  payload.UserID,
+		Email:   payload.Email,
+		Request: request,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrPayoutAccountRejected):
+			respondWithError(w, http.StatusBadRequest, err)
+		default:
+			log.Println(err)
+			respondWithError(w, http.StatusInternalServerError, errors.New("unable to register the payout account"))
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusOK, account)
+}
+
+func (h *PayoutHandler) HandleGetAccount(w http.ResponseWriter, r *http.Request) {
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	account, err := h.payoutService.GetAccount(r.Context(), payload.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrPayoutAccountNotFound):
+			respondWithError(w, http.StatusNotFound, err)
+		default:
+			log.Println(err)
+			respondWithError(w, http.StatusInternalServerError, errors.New("unable to get the payout account"))
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusOK, account)
+}
+
+// HandleGetEarnings lists the doctor's ledger entries between the from and to dates (the last 30 days by default)
+func (h *PayoutHandler) HandleGetEarnings(w http.ResponseWriter, r *http.Request) {
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	params := NewQueryParamExtractor(r)
+	from, to, err := parseReportRange(params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	page := params.GetInt32("page", 0)
+	pageSize := int32(20)
+
+	response, err := h.payoutService.GetEarnings(r.Context(), service.GetEarningsParams{
+		UserID: payload.UserID,
+		From:   from,
+		To:     to,
+		Limit:  pageSize,
+		Offset: page * pageSize,
+	})
+	if err != nil {
+		log.Println(err)
+		respondWithError(w, http.StatusInternalServerError, errors.New("unable to get the earnings"))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// HandleGetPayoutReport totals what each doctor earned between the from and to dates and what is still owed to them
+func (h *PayoutHandler) HandleGetPayoutReport(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParamExtractor(r)
+	from, to, err := parseReportRange(params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	page := params.GetInt32("page", 0)
+	pageSize := int32(50)
+
+	report, err := h.payoutService.GetPayoutReport(r.Context(), from, to, pageSize, page*pageSize)
+	if err != nil {
+		log.Println(err)
+		respondWithError(w, http.StatusInternalServerError, errors.New("unable to get the payout report"))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mbeka02/lyra_backend/internal/server/service"
+)
+
+type ReconciliationHandler struct {
+	reconciler service.PaymentReconciler
+}
+
+func NewReconciliationHandler(reconciler service.PaymentReconciler) *ReconciliationHandler {
+	return &ReconciliationHandler{
+		reconciler,
+	}
+}
+
+// HandleListRuns lists the reconciliation runs , latest first
+func (h *ReconciliationHandler) HandleListRuns(w http.ResponseWriter, r *http.Request) {
+	params := NewQueryParamExtractor(r)
+	page := params.GetInt32("page", 0)
+	pageSize := int32(20)
+
+	response, err := h.reconciler.ListRuns(r.Context(), pageSize, page*pageSize)
+	if err != nil {
+		log.Println(err)
+		respondWithError(w, http.StatusInternalServerError, errors.New("unable to get the reconciliation runs"))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// HandleGetReport shows what a single run found for each payment it checked
+func (h *ReconciliationHandler) HandleGetReport(w http.ResponseWriter, r *http.Request) {
+	runID, err := strconv.ParseInt(chi.URLParam(r, "runId"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Errorf("invalid runId in path"))
+		return
+	}
+	report, err := h.reconciler.GetReport(r.Context(), runID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrReconciliationRunNotFound):
+			respondWithError(w, http.StatusNotFound, err)
+		default:
+			log.Println(err)
+			respondWithError(w, http.StatusInternalServerError, errors.New("unable to get the reconciliation report"))
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusOK, report)
+}
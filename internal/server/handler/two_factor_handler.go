@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mbeka02/lyra_backend/internal/auth"
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/server/service"
+)
+
+type TwoFactorHandler struct {
+	userService      service.UserService
+	twoFactorService service.TwoFactorService
+}
+
+func NewTwoFactorHandler(userService service.UserService, twoFactorService service.TwoFactorService) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		userService,
+		twoFactorService,
+	}
+}
+
+// HandleVerifyLogin is the second step of /login for users with 2FA
+func (h *TwoFactorHandler) HandleVerifyLogin(w http.ResponseWriter, r *http.Request) {
+	var request model.VerifyTwoFactorLoginRequest
+	if err := parseAndValidateRequest(r, &request); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	response, err := h.userService.VerifyTwoFactorLogin(r.Context(), request, getClientInfo(r))
+	if err != nil {
+		var blocked *service.LoginBlockedError
+		if errors.As(err, &blocked) {
+			setRetryAfter(w, blocked.RetryAfter)
+		}
+		respondWithError(w, twoFactorErrorStatus(err), err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// HandleBeginLoginEnrollment returns a new secret for users who must enrol before they can finish logging in
+func (h *TwoFactorHandler) HandleBeginLoginEnrollment(w http.ResponseWriter, r *http.Request) {
+	var request model.TwoFactorChallengeRequest
+	if err := parseAndValidateRequest(r, &request); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	response, err := h.userService.BeginTwoFactorEnrollment(r.Context(), request)
+	if err != nil {
+		respondWithError(w, twoFactorErrorStatus(err), err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (h *TwoFactorHandler) HandleBeginEnrollment(w http.ResponseWriter, r *http.Request) {
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	response, err := h.twoFactorService.BeginEnrollment(r.Context(), payload.UserID, payload.Email)
+	if err != nil {
+		respondWithError(w, twoFactorErrorStatus(err), err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (h *TwoFactorHandler) HandleConfirmEnrollment(w http.ResponseWriter, r *http.Request) {
+	var request model.ConfirmTwoFactorRequest
+	if err := parseAndValidateRequest(r, &request); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	codes, err := h.twoFactorService.ConfirmEnrollment(r.Context(), payload.UserID, request.Code)
+	if err != nil {
+		respondWithError(w, twoFactorErrorStatus(err), err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, model.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (h *TwoFactorHandler) HandleDisable(w http.ResponseWriter, r *http.Request) {
+	var request model.DisableTwoFactorRequest
+	if err := parseAndValidateRequest(r, &request); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	if err := h.twoFactorService.Disable(r.Context(), payload.UserID, request); err != nil {
+		respondWithError(w, twoFactorErrorStatus(err), err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, "two factor authentication disabled")
+}
+
+func twoFactorErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidTwoFactorCode),
+		errors.Is(err, service.ErrIncorrectPassword),
+		errors.Is(err, service.ErrInvalidTokenType),
+		errors.Is(err, auth.ErrInvalidToken),
+		errors.Is(err, auth.ErrExpiredToken),
+		errors.Is(err, service.ErrChallengeExhausted):
+		return http.StatusUnauthorized
+	case errors.Is(err, service.ErrAccountLocked):
+		return http.StatusLocked
+	case errors.Is(err, service.ErrLoginThrottled):
+		return http.StatusTooManyRequests
+	case errors.Is(err, service.ErrTwoFactorAlreadyEnabled):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrTwoFactorRequired):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrTwoFactorNotEnrolled):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -1,21 +1,33 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/mbeka02/lyra_backend/internal/model"
 	"github.com/mbeka02/lyra_backend/internal/server/middleware"
 	"github.com/mbeka02/lyra_backend/internal/server/service"
 )
 
 type UserHandler struct {
-	userService service.UserService
+	userService         service.UserService
+	sessionService      service.SessionService
+	verificationService service.VerificationService
+	passwordService     service.PasswordService
+	lockoutService      service.LockoutService
 }
 
-func NewUserHandler(userService service.UserService) *UserHandler {
+func NewUserHandler(userService service.UserService, sessionService service.SessionService, verificationService service.VerificationService, passwordService service.PasswordService, lockoutService service.LockoutService) *UserHandler {
 	return &UserHandler{
-		userService: userService,
+		userService:         userService,
+		sessionService:      sessionService,
+		verificationService: verificationService,
+		passwordService:     passwordService,
+		lockoutService:      lockoutService,
 	}
 }
 
@@ -27,7 +39,7 @@ func (h *UserHandler) HandleCreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.userService.CreateUser(r.Context(), request)
+	user, err := h.userService.CreateUser(r.Context(), request, getClientInfo(r))
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err)
 		return
@@ -106,7 +118,34 @@ func (h *UserHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response, err := h.userService.Login(r.Context(), request)
+	response, err := h.userService.Login(r.Context(), request, getClientInfo(r))
+	if err != nil {
+		var blocked *service.LoginBlockedError
+		if errors.As(err, &blocked) {
+			setRetryAfter(w, blocked.RetryAfter)
+		}
+		switch {
+		case errors.Is(err, service.ErrAccountLocked):
+			respondWithError(w, http.StatusLocked, err)
+		case errors.Is(err, service.ErrLoginThrottled):
+			respondWithError(w, http.StatusTooManyRequests, err)
+		default:
+			respondWithError(w, http.StatusUnauthorized, err)
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (h *UserHandler) HandleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	request := model.RefreshTokenRequest{}
+	if err := parseAndValidateRequest(r, &request); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	response, err := h.sessionService.RefreshSession(r.Context(), request.RefreshToken)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, err)
 		return
@@ -114,3 +153,154 @@ func (h *UserHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 
 	respondWithJSON(w, http.StatusOK, response)
 }
+
+func (h *UserHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	if err := h.sessionService.RevokeSession(r.Context(), payload); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, "logged out")
+}
+
+// HandleLogoutAll revokes every session of the user i.e logs them out of all their devices
+func (h *UserHandler) HandleLogoutAll(w http.ResponseWriter, r *http.Request) {
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	if err := h.sessionService.RevokeAllSessions(r.Context(), payload.UserID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, "logged out of all devices")
+}
+
+// HandleVerifyEmail is the target of the link in the verification email
+func (h *UserHandler) HandleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := NewQueryParamExtractor(r).GetString("token")
+	if token == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("the verification token is missing"))
+		return
+	}
+	if err := h.verificationService.VerifyEmail(r.Context(), token); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, "email verified")
+}
+
+func (h *UserHandler) HandleResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	err := h.verificationService.ResendVerificationEmail(r.Context(), payload.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrVerificationThrottled):
+			respondWithError(w, http.StatusTooManyRequests, err)
+		case errors.Is(err, service.ErrEmailAlreadyVerified):
+			respondWithError(w, http.StatusConflict, err)
+		default:
+			respondWithError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusOK, "verification email sent")
+}
+
+func (h *UserHandler) HandleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	request := model.ForgotPasswordRequest{}
+	if err := parseAndValidateRequest(r, &request); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := h.passwordService.ForgotPassword(r.Context(), request); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// the same response is returned whether or not the account exists
+	respondWithJSON(w, http.StatusOK, "if an account exists for this email , a password reset link has been sent")
+}
+
+func (h *UserHandler) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	request := model.ResetPasswordRequest{}
+	if err := parseAndValidateRequest(r, &request); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := h.passwordService.ResetPassword(r.Context(), request); err != nil {
+		if errors.Is(err, service.ErrInvalidResetToken) {
+			respondWithError(w, http.StatusBadRequest, err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, "password reset , please login with your new password")
+}
+
+func (h *UserHandler) HandleUnlockAccount(w http.ResponseWriter, r *http.Request) {
+	request := model.UnlockAccountRequest{}
+	if err := parseAndValidateRequest(r, &request); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := h.lockoutService.Unlock(r.Context(), request); err != nil {
+		if errors.Is(err, service.ErrInvalidUnlockToken) {
+			respondWithError(w, http.StatusBadRequest, err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, "account unlocked , you can now login")
+}
+
+// HandleAdminUnlockUser lets an admin lift a lockout without the unlock link
+func (h *UserHandler) HandleAdminUnlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userId"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Errorf("invalid userId in path"))
+		return
+	}
+	if err := h.lockoutService.UnlockUser(r.Context(), userID); err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			respondWithError(w, http.StatusNotFound, err)
+			return
+		}
+		log.Println(err)
+		respondWithError(w, http.StatusInternalServerError, errors.New("unable to unlock the account"))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, "account unlocked")
+}
+
+func (h *UserHandler) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
+	request := model.ChangePasswordRequest{}
+	if err := parseAndValidateRequest(r, &request); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	payload, ok := getAuthPayload(w, r)
+	if !ok {
+		return
+	}
+	tokens, err := h.passwordService.ChangePassword(r.Context(), request, payload.UserID, getClientInfo(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrIncorrectPassword):
+			respondWithError(w, http.StatusUnauthorized, err)
+		case errors.Is(err, service.ErrPasswordUnchanged):
+			respondWithError(w, http.StatusBadRequest, err)
+		default:
+			respondWithError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusOK, tokens)
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/mbeka02/lyra_backend/internal/audit"
+)
+
+// RequestAuditInfo adds who made the request to its context so that the services can attribute the audit events they record.
+// It has to be mounted after AuthMiddleware and chi's RequestID middleware
+func RequestAuditInfo(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, err := GetAuthPayload(r.Context())
+		if err != nil {
+			respondWithVerificationError(w, err)
+			return
+		}
+		// RealIP may have already replaced the address with one that has no port
+		clientIP := r.RemoteAddr
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			clientIP = host
+		}
+		ctx := audit.WithRequestInfo(r.Context(), audit.RequestInfo{
+			ActorUserID: payload.UserID,
+			ActorRole:   payload.Role,
+			RequestID:   middleware.GetReqID(r.Context()),
+			ClientIP:    clientIP,
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/mbeka02/lyra_backend/internal/audit"
+	"github.com/mbeka02/lyra_backend/internal/auth"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestAuditInfo(t *testing.T) {
+	var info audit.RequestInfo
+	var found bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info, found = audit.RequestInfoFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := middleware.RequestID(RequestAuditInfo(next))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.7:51234"
+	payload := &auth.Payload{UserID: 42, Role: auth.RoleSpecialist}
+	req = req.WithContext(context.WithValue(req.Context(), authorizationPayloadKey, payload))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.True(t, found)
+	require.Equal(t, int64(42), info.ActorUserID)
+	require.Equal(t, auth.RoleSpecialist, info.ActorRole)
+	require.Equal(t, "10.0.0.7", info.ClientIP)
+	require.NotEmpty(t, info.RequestID)
+
+	rec = httptest.NewRecorder()
+	RequestAuditInfo(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
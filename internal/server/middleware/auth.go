@@ -29,8 +29,19 @@ var (
 	ErrMalformedAuth   = errors.New("malformed authorization header")
 	ErrUnsupportedAuth = errors.New("unsupported authorization type")
 	ErrInvalidPayload  = errors.New("invalid authorization payload")
+	ErrNotAccessToken  = errors.New("the token provided is not an access token")
 )
 
+// SessionValidator checks that the session an access token belongs to hasn't been revoked
+type SessionValidator interface {
+	ValidateSession(ctx context.Context, payload *auth.Payload) error
+}
+
+// WithAuthPayload returns a copy of the context carrying the payload of an authenticated request
+func WithAuthPayload(ctx context.Context, payload *auth.Payload) context.Context {
+	return context.WithValue(ctx, authorizationPayloadKey, payload)
+}
+
 func GetAuthPayload(ctx context.Context) (*auth.Payload, error) {
 	payload, ok := ctx.Value(authorizationPayloadKey).(*auth.Payload)
 	if !ok {
@@ -40,11 +51,15 @@ func GetAuthPayload(ctx context.Context) (*auth.Payload, error) {
 }
 
 func respondWithVerificationError(w http.ResponseWriter, err error) {
+	respondWithStatus(w, http.StatusUnauthorized, err)
+}
+
+func respondWithStatus(w http.ResponseWriter, status int, err error) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusUnauthorized)
+	w.WriteHeader(status)
 	apiError := APIError{
-		Status:  http.StatusUnauthorized,
-		Message: http.StatusText(http.StatusUnauthorized),
+		Status:  status,
+		Message: http.StatusText(status),
 		Detail:  err.Error(),
 	}
 	json.NewEncoder(w).Encode(apiError)
@@ -69,7 +84,7 @@ func extractAndVerifyToken(r *http.Request, maker auth.Maker) (*auth.Payload, er
 	return maker.Verify(fields[1])
 }
 
-func AuthMiddleware(maker auth.Maker) func(next http.Handler) http.Handler {
+func AuthMiddleware(maker auth.Maker, validator SessionValidator) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			payload, err := extractAndVerifyToken(r, maker)
@@ -77,10 +92,17 @@ func AuthMiddleware(maker auth.Maker) func(next http.Handler) http.Handler {
 				respondWithVerificationError(w, err)
 				return
 			}
+			// refresh tokens and other special purpose tokens can't be used to access the API
+			if payload.TokenType != auth.TokenTypeAccess {
+				respondWithVerificationError(w, ErrNotAccessToken)
+				return
+			}
+			if err := validator.ValidateSession(r.Context(), payload); err != nil {
+				respondWithVerificationError(w, err)
+				return
+			}
 
-			// Create new context with the payload
-			ctx := context.WithValue(r.Context(), authorizationPayloadKey, payload)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r.WithContext(WithAuthPayload(r.Context(), payload)))
 		})
 	}
 }
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mbeka02/lyra_backend/internal/auth"
+	"github.com/mbeka02/lyra_backend/internal/model"
+)
+
+var (
+	ErrInvalidPatientID    = errors.New("invalid patientId in path")
+	ErrPatientAccessDenied = errors.New("you are not authorized to access the records of this patient")
+	ErrAccessCheckFailed   = errors.New("unable to verify access to the records of this patient")
+)
+
+// PatientAccessPolicy decides whether the authenticated user can reach a patient's records
+type PatientAccessPolicy interface {
+	CanAccessPatient(ctx context.Context, payload *auth.Payload, access model.PatientAccessRequest) (bool, error)
+}
+
+// RequirePatientAccess guards the routes nested under /{patientId} , it has to be mounted after AuthMiddleware
+func RequirePatientAccess(policy PatientAccessPolicy) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			payload, err := GetAuthPayload(r.Context())
+			if err != nil {
+				respondWithVerificationError(w, err)
+				return
+			}
+			patientID, err := strconv.ParseInt(chi.URLParam(r, "patientId"), 10, 64)
+			if err != nil {
+				respondWithStatus(w, http.StatusBadRequest, ErrInvalidPatientID)
+				return
+			}
+			allowed, err := policy.CanAccessPatient(r.Context(), payload, NewPatientAccessRequest(r, patientID))
+			if err != nil {
+				log.Printf("access check failed for user %d on patient %d: %v", payload.UserID, patientID, err)
+				respondWithStatus(w, http.StatusInternalServerError, ErrAccessCheckFailed)
+				return
+			}
+			if !allowed {
+				respondWithStatus(w, http.StatusForbidden, ErrPatientAccessDenied)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// NewPatientAccessRequest describes the request for the access policy
+func NewPatientAccessRequest(r *http.Request, patientID int64) model.PatientAccessRequest {
+	return model.PatientAccessRequest{
+		PatientID: patientID,
+		ReadOnly:  r.Method == http.MethodGet || r.Method == http.MethodHead,
+		Resource:  r.Method + " " + r.URL.Path,
+	}
+}
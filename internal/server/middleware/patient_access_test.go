@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mbeka02/lyra_backend/internal/auth"
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePatientAccessPolicy struct {
+	allowed bool
+	err     error
+	// the patient the policy was asked about
+	patientID int64
+}
+
+func (f *fakePatientAccessPolicy) CanAccessPatient(ctx context.Context, payload *auth.Payload, access model.PatientAccessRequest) (bool, error) {
+	f.patientID = access.PatientID
+	return f.allowed, f.err
+}
+
+func TestRequirePatientAccess(t *testing.T) {
+	testCases := []struct {
+		name           string
+		path           string
+		policy         *fakePatientAccessPolicy
+		withPayload    bool
+		expectedStatus int
+	}{
+		{"allowed", "/patients/7/allergies", &fakePatientAccessPolicy{allowed: true}, true, http.StatusOK},
+		{"allowed on the patient itself", "/patients/7", &fakePatientAccessPolicy{allowed: true}, true, http.StatusOK},
+		{"denied", "/patients/7/allergies", &fakePatientAccessPolicy{}, true, http.StatusForbidden},
+		{"invalid patient id", "/patients/abc/allergies", &fakePatientAccessPolicy{allowed: true}, true, http.StatusBadRequest},
+		{"policy error", "/patients/7/allergies", &fakePatientAccessPolicy{err: errors.New("db down")}, true, http.StatusInternalServerError},
+		{"missing payload", "/patients/7/allergies", &fakePatientAccessPolicy{allowed: true}, false, http.StatusUnauthorized},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := chi.NewRouter()
+			r.Route("/patients/{patientId}", func(r chi.Router) {
+				r.Use(RequirePatientAccess(tc.policy))
+				r.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+				r.Get("/allergies", func(w http.ResponseWriter, r *http.Request) {})
+			})
+
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.withPayload {
+				payload := &auth.Payload{UserID: 1, Role: auth.RolePatient}
+				req = req.WithContext(context.WithValue(req.Context(), authorizationPayloadKey, payload))
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			require.Equal(t, tc.expectedStatus, rec.Code)
+			if tc.expectedStatus == http.StatusOK {
+				require.Equal(t, int64(7), tc.policy.patientID)
+			}
+		})
+	}
+}
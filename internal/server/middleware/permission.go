@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mbeka02/lyra_backend/internal/auth"
+)
+
+var ErrForbidden = errors.New("you don't have permission to perform this action")
+
+// RequirePermission only lets requests through if the role of the authenticated user has been granted all the permissions.
+// It has to be mounted after AuthMiddleware
+func RequirePermission(permissions ...auth.Permission) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			payload, err := GetAuthPayload(r.Context())
+			if err != nil {
+				respondWithVerificationError(w, err)
+				return
+			}
+			if !auth.HasPermissions(payload.Role, permissions...) {
+				respondWithStatus(w, http.StatusForbidden, ErrForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
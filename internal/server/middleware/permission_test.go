@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mbeka02/lyra_backend/internal/auth"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequirePermission(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := RequirePermission(auth.PermissionNotesWrite)(next)
+
+	testCases := []struct {
+		name           string
+		payload        *auth.Payload
+		expectedStatus int
+	}{
+		{"granted", &auth.Payload{Role: auth.RoleSpecialist}, http.StatusOK},
+		{"not granted", &auth.Payload{Role: auth.RolePatient}, http.StatusForbidden},
+		{"missing payload", nil, http.StatusUnauthorized},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tc.payload != nil {
+				req = req.WithContext(context.WithValue(req.Context(), authorizationPayloadKey, tc.payload))
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			require.Equal(t, tc.expectedStatus, rec.Code)
+		})
+	}
+}
@@ -2,12 +2,50 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/mbeka02/lyra_backend/internal/database"
 )
 
+// ErrSlotTaken is returned when an insert or update would make two active appointments of a doctor overlap
+var ErrSlotTaken = errors.New("the doctor already has an appointment at this time")
+
+// ErrSlotUnavailable is returned when the check_appointment_availability trigger refuses a time outside the doctor's availability
+var ErrSlotUnavailable = errors.New("the doctor isn't available at this time")
+
+// ErrBookingRules is returned when the check_appointment_availability trigger refuses a time that breaks the doctor's booking rules
+var ErrBookingRules = errors.New("the time breaks the doctor's booking rules")
+
+const (
+	exclusionViolationCode    = "23P01"
+	noOverlappingAppointments = "no_overlapping_appointments"
+	checkViolationCode        = "23514"
+	doctorAvailability        = "doctor_availability"
+	doctorBookingRules        = "doctor_booking_rules"
+)
+
+// translateSlotError turns a violation of the no_overlapping_appointments constraint into ErrSlotTaken
+// and a time the check_appointment_availability trigger refused into ErrSlotUnavailable or ErrBookingRules
+func translateSlotError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	switch {
+	case pgErr.Code == exclusionViolationCode && pgErr.ConstraintName == noOverlappingAppointments:
+		return ErrSlotTaken
+	case pgErr.Code == checkViolationCode && pgErr.ConstraintName == doctorAvailability:
+		return ErrSlotUnavailable
+	case pgErr.Code == checkViolationCode && pgErr.ConstraintName == doctorBookingRules:
+		return ErrBookingRules
+	}
+	return err
+}
+
 type CreateAppointmentParams struct {
 	DoctorID  int64
 	StartTime time.Time
@@ -21,7 +59,19 @@ type CreateAppointmentWithPaymentParams struct {
 	EndTime   time.Time
 	Reason    string
 	Reference string // payment reference
-	Amount    string // this will be cast to a postgres numeric
+	// the amounts will be cast to a postgres numeric , Amount is the total of the other three
+	Amount          string
+	ConsultationFee string
+	PlatformFee     string
+	Tax             string
+	// the provider the payment was started with
+	PaymentMethod string
+	// the phone the payment is made from , only set for mobile money
+	PayerPhone string
+	// the doctor's subaccount the payment is split with , empty when the platform collects all of it
+	SubaccountCode string
+	// the doctor's unpaid appointments created at or before this have lost their hold , they are expired before the appointment is added
+	HeldAfter time.Time
 }
 type GetPatientAppointmentsParams struct {
 	PatientID int64
@@ -43,19 +93,76 @@ type GetAppointmentIDsParams struct {
 }
 type UpdateAppointmentStatusParams struct {
 	AppointmentID int64
-	Status        string
+	// the update only succeeds if the appointment is still in this status
+	From database.AppointmentStatus
+	To   database.AppointmentStatus
+	// the role of the user making the change , or payment / system
+	Actor string
+	// the user making the change , 0 when it came from a payment or a background job
+	ChangedBy int64
+	Reason    string
 }
 type CheckAppointmentExistsParams struct {
 	PatientID int64
 	DoctorID  int64
 }
+type CancelAppointmentWithRefundParams struct {
+	// the reason and the user that cancelled are recorded against the refund as well
+	Cancellation UpdateAppointmentStatusParams
+	PaymentID    int64
+	// the status the payment moves to , refunded or partially_refunded
+	PaymentStatus database.PaymentStatus
+	Amount        string // this will be cast to a postgres numeric
+	Currency      string
+	// identifies the refund of this cancellation , a second refund with the same key is rejected
+	IdempotencyKey string
+}
+type CheckAppointmentSlotParams struct {
+	DoctorID int64
+	// the appointment being moved , it doesn't count as an overlapping booking
+	AppointmentID int64
+	StartTime     time.Time
+	EndTime       time.Time
+	// unpaid appointments created at or before this have lost their hold and don't count as bookings
+	HeldAfter time.Time
+}
+type RescheduleAppointmentParams struct {
+	AppointmentID     int64
+	DoctorID          int64
+	PreviousStartTime time.Time
+	PreviousEndTime   time.Time
+	StartTime         time.Time
+	EndTime           time.Time
+	Reason            string
+	RescheduledBy     int64
+	// the doctor's unpaid appointments created at or before this have lost their hold , they are expired before the appointment is moved
+	HeldAfter time.Time
+}
 type AppointmentRepository interface {
 	CreateAppointmentWithPayment(ctx context.Context, params CreateAppointmentWithPaymentParams) (*CreateAppointmentWithPaymentTxResults, error)
 	GetPatientAppointments(ctx context.Context, params GetPatientAppointmentsParams) ([]database.GetPatientAppointmentsRow, error)
 	GetDoctorAppointments(ctx context.Context, params GetDoctorAppointmentsParams) ([]database.GetDoctorAppointmentsRow, error)
+	// GetParticipants returns the appointment with the names and emails of the doctor and the patient
+	GetParticipants(ctx context.Context, appointmentId int64) (*database.GetAppointmentParticipantsRow, error)
 	GetAppointmentIDs(ctx context.Context, params GetAppointmentIDsParams) ([]int64, error)
+	// UpdateAppointmentStatus moves the appointment to a new status and records the change in its history ,
+	// it returns sql.ErrNoRows if the appointment is no longer in the From status
 	UpdateAppointmentStatus(ctx context.Context, params UpdateAppointmentStatusParams) error
+	ListStatusHistory(ctx context.Context, appointmentId int64) ([]database.AppointmentStatusHistory, error)
 	CheckAppointmentExists(ctx context.Context, params CheckAppointmentExistsParams) (bool, error)
+	GetById(ctx context.Context, appointmentId int64) (*database.Appointment, error)
+	// CancelAppointmentWithRefund cancels the appointment and records a pending refund of the payment in one transaction ,
+	// the refund is sent to the provider once this has returned. It returns sql.ErrNoRows if the appointment is no longer in the From status of the cancellation
+	CancelAppointmentWithRefund(ctx context.Context, params CancelAppointmentWithRefundParams) (*database.Refund, error)
+	CheckSlot(ctx context.Context, params CheckAppointmentSlotParams) (database.CheckAppointmentSlotRow, error)
+	// RescheduleAppointment moves the appointment and records its previous times ,
+	// it returns sql.ErrNoRows if the appointment is no longer scheduled at PreviousStartTime
+	RescheduleAppointment(ctx context.Context, params RescheduleAppointmentParams) (*database.Appointment, error)
+	CountReschedules(ctx context.Context, appointmentId int64) (int64, error)
+	ListReschedules(ctx context.Context, appointmentId int64) ([]database.AppointmentReschedule, error)
+	// ExpirePendingAppointments cancels the unpaid appointments created at or before createdBefore and fails their payments ,
+	// it returns the ids of the cancelled appointments
+	ExpirePendingAppointments(ctx context.Context, createdBefore time.Time) ([]int64, error)
 }
 
 type appointmentRepository struct {
@@ -68,6 +175,129 @@ func NewAppointmentRepository(store *database.Store) AppointmentRepository {
 	}
 }
 
+func (r *appointmentRepository) GetById(ctx context.Context, appointmentId int64) (*database.Appointment, error) {
+	appointment, err := r.store.GetAppointmentById(ctx, appointmentId)
+	if err != nil {
+		return nil, err
+	}
+	return &appointment, nil
+}
+
+func (r *appointmentRepository) CancelAppointmentWithRefund(ctx context.Context, params CancelAppointmentWithRefundParams) (*database.Refund, error) {
+	var refund database.Refund
+	err := r.store.ExecTx(ctx, func(q *database.Queries) error {
+		// the update locks the appointment row until the transaction ends
+		if err := updateAppointmentStatus(ctx, q, params.Cancellation); err != nil {
+			return err
+		}
+		var err error
+		refund, err = q.CreateRefund(ctx, database.CreateRefundParams{
+			PaymentID:      params.PaymentID,
+			AppointmentID:  params.Cancellation.AppointmentID,
+			Amount:         params.Amount,
+			Currency:       params.Currency,
+			Reason:         params.Cancellation.Reason,
+			InitiatedBy:    sql.NullInt64{Int64: params.Cancellation.ChangedBy, Valid: params.Cancellation.ChangedBy != 0},
+			ProviderStatus: RefundStatusPending,
+			IdempotencyKey: params.IdempotencyKey,
+		})
+		if err != nil {
+			return err
+		}
+		// the refund comes out of the doctor's earnings
+		if err := q.RecordRefundEarning(ctx, refund.RefundID); err != nil {
+			return err
+		}
+		return q.UpdatePaymentStatusById(ctx, database.UpdatePaymentStatusByIdParams{
+			CurrentStatus: params.PaymentStatus,
+			PaymentID:     params.PaymentID,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+func (r *appointmentRepository) CheckSlot(ctx context.Context, params CheckAppointmentSlotParams) (database.CheckAppointmentSlotRow, error) {
+	return r.store.CheckAppointmentSlot(ctx, database.CheckAppointmentSlotParams{
+		DoctorID:      params.DoctorID,
+		AppointmentID: params.AppointmentID,
+		StartTime:     params.StartTime,
+		EndTime:       params.EndTime,
+		HeldAfter:     params.HeldAfter,
+	})
+}
+
+func (r *appointmentRepository) RescheduleAppointment(ctx context.Context, params RescheduleAppointmentParams) (*database.Appointment, error) {
+	var appointment database.Appointment
+	err := r.store.ExecTx(ctx, func(q *database.Queries) error {
+		if _, err := expireHolds(ctx, q, params.DoctorID, params.HeldAfter); err != nil {
+			return err
+		}
+		var err error
+		appointment, err = q.RescheduleAppointment(ctx, database.RescheduleAppointmentParams{
+			AppointmentID:     params.AppointmentID,
+			PreviousStartTime: params.PreviousStartTime,
+			StartTime:         params.StartTime,
+			EndTime:           params.EndTime,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = q.CreateAppointmentReschedule(ctx, database.CreateAppointmentRescheduleParams{
+			AppointmentID:     params.AppointmentID,
+			PreviousStartTime: params.PreviousStartTime,
+			PreviousEndTime:   params.PreviousEndTime,
+			NewStartTime:      params.StartTime,
+			NewEndTime:        params.EndTime,
+			Reason:            params.Reason,
+			RescheduledBy:     params.RescheduledBy,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, translateSlotError(err)
+	}
+	return &appointment, nil
+}
+
+func (r *appointmentRepository) CountReschedules(ctx context.Context, appointmentId int64) (int64, error) {
+	return r.store.CountAppointmentReschedules(ctx, appointmentId)
+}
+
+func (r *appointmentRepository) ListReschedules(ctx context.Context, appointmentId int64) ([]database.AppointmentReschedule, error) {
+	return r.store.ListAppointmentReschedules(ctx, appointmentId)
+}
+
+func (r *appointmentRepository) ExpirePendingAppointments(ctx context.Context, createdBefore time.Time) ([]int64, error) {
+	var expired []int64
+	err := r.store.ExecTx(ctx, func(q *database.Queries) error {
+		var err error
+		expired, err = expireHolds(ctx, q, 0, createdBefore)
+		return err
+	})
+	return expired, err
+}
+
+// expireHolds cancels the unpaid appointments created at or before createdBefore (only the doctor's if doctorId isn't 0)
+// and fails their payments inside an existing transaction
+func expireHolds(ctx context.Context, q *database.Queries, doctorId int64, createdBefore time.Time) ([]int64, error) {
+	// the payments go first since they are found through the appointments that are still pending ,
+	// the expired appointments are recorded in their status history by the same query that cancels them
+	err := q.FailExpiredHoldPayments(ctx, database.FailExpiredHoldPaymentsParams{
+		CreatedBefore: createdBefore,
+		DoctorID:      doctorId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return q.ExpirePendingAppointments(ctx, database.ExpirePendingAppointmentsParams{
+		CreatedBefore: createdBefore,
+		DoctorID:      doctorId,
+	})
+}
+
 func (r *appointmentRepository) CheckAppointmentExists(ctx context.Context, params CheckAppointmentExistsParams) (bool, error) {
 	exists, err := r.store.CheckSpecialistPatientAppointmentExists(ctx,
 		database.CheckSpecialistPatientAppointmentExistsParams{
@@ -82,9 +312,35 @@ func (r *appointmentRepository) CheckAppointmentExists(ctx context.Context, para
 }
 
 func (r *appointmentRepository) UpdateAppointmentStatus(ctx context.Context, params UpdateAppointmentStatusParams) error {
-	return r.store.UpdateAppointmentStatus(ctx, database.UpdateAppointmentStatusParams{
-		CurrentStatus: database.AppointmentStatus(params.Status),
+	return r.store.ExecTx(ctx, func(q *database.Queries) error {
+		return updateAppointmentStatus(ctx, q, params)
+	})
+}
+
+func (r *appointmentRepository) ListStatusHistory(ctx context.Context, appointmentId int64) ([]database.AppointmentStatusHistory, error) {
+	return r.store.ListAppointmentStatusHistory(ctx, appointmentId)
+}
+
+// updateAppointmentStatus makes the status change inside an existing transaction
+func updateAppointmentStatus(ctx context.Context, q *database.Queries, params UpdateAppointmentStatusParams) error {
+	updated, err := q.TransitionAppointmentStatus(ctx, database.TransitionAppointmentStatusParams{
+		AppointmentID: params.AppointmentID,
+		FromStatus:    params.From,
+		ToStatus:      params.To,
+	})
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return sql.ErrNoRows
+	}
+	return q.CreateAppointmentStatusHistory(ctx, database.CreateAppointmentStatusHistoryParams{
 		AppointmentID: params.AppointmentID,
+		FromStatus:    params.From,
+		ToStatus:      params.To,
+		Actor:         params.Actor,
+		ChangedBy:     sql.NullInt64{Int64: params.ChangedBy, Valid: params.ChangedBy != 0},
+		Reason:        params.Reason,
 	})
 }
 
@@ -103,6 +359,14 @@ func (r *appointmentRepository) GetDoctorAppointments(ctx context.Context, param
 	})
 }
 
+func (r *appointmentRepository) GetParticipants(ctx context.Context, appointmentId int64) (*database.GetAppointmentParticipantsRow, error) {
+	participants, err := r.store.GetAppointmentParticipants(ctx, appointmentId)
+	if err != nil {
+		return nil, err
+	}
+	return &participants, nil
+}
+
 func (r *appointmentRepository) GetPatientAppointments(ctx context.Context, params GetPatientAppointmentsParams) ([]database.GetPatientAppointmentsRow, error) {
 	return r.store.GetPatientAppointments(ctx, database.GetPatientAppointmentsParams{
 		PatientID:   params.PatientID,
@@ -114,6 +378,10 @@ func (r *appointmentRepository) GetPatientAppointments(ctx context.Context, para
 func (r *appointmentRepository) CreateAppointmentWithPayment(ctx context.Context, params CreateAppointmentWithPaymentParams) (*CreateAppointmentWithPaymentTxResults, error) {
 	var result CreateAppointmentWithPaymentTxResults
 	err := r.store.ExecTx(ctx, func(q *database.Queries) error {
+		// holds that have run out but haven't been swept yet would still be refused by the no_overlapping_appointments constraint
+		if _, err := expireHolds(ctx, q, params.DoctorID, params.HeldAfter); err != nil {
+			return err
+		}
 		var err error
 		// create appointment record
 		result.Appointment, err = q.CreateAppointment(ctx, database.CreateAppointmentParams{
@@ -128,14 +396,20 @@ func (r *appointmentRepository) CreateAppointmentWithPayment(ctx context.Context
 		}
 		// create payment record
 		result.Payment, err = q.CreatePayment(ctx, database.CreatePaymentParams{
-			AppointmentID: result.Appointment.AppointmentID,
-			DoctorID:      params.DoctorID,
-			PatientID:     params.PatientID,
-			Reference:     params.Reference,
-			Amount:        params.Amount,
+			AppointmentID:   result.Appointment.AppointmentID,
+			DoctorID:        params.DoctorID,
+			PatientID:       params.PatientID,
+			Reference:       params.Reference,
+			Amount:          params.Amount,
+			ConsultationFee: params.ConsultationFee,
+			PlatformFee:     params.PlatformFee,
+			Tax:             params.Tax,
+			PaymentMethod:   params.PaymentMethod,
+			PayerPhone:      params.PayerPhone,
+			SubaccountCode:  params.SubaccountCode,
 		})
 
 		return err
 	})
-	return &result, err
+	return &result, translateSlotError(err)
 }
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrentBookingsOfOneSlot(t *testing.T) {
+	doctor := createRandomVerifiedDoctor(t)
+	startTime := time.Now().UTC().AddDate(0, 0, 7).Truncate(24 * time.Hour).Add(10 * time.Hour)
+	_, err := NewAvailabilityRepository(store).Create(context.Background(), CreateAvailabilityParams{
+		DoctorID:        doctor.DoctorID,
+		DayOfWeek:       int32(startTime.Weekday()),
+		StartTime:       "08:00",
+		EndTime:         "17:00",
+		IntervalMinutes: 30,
+	})
+	require.NoError(t, err)
+
+	const bookings = 8
+	patients := make([]database.Patient, bookings)
+	for i := range patients {
+		patients[i] = createRandomPatient(t)
+	}
+
+	repo := NewAppointmentRepository(store)
+	var wg sync.WaitGroup
+	errs := make(chan error, bookings)
+	for i := 0; i < bookings; i++ {
+		wg.Add(1)
+		go func(patient database.Patient, offset time.Duration) {
+			defer wg.Done()
+			// the overlapping bookings don't all start at the same time
+			_, err := repo.CreateAppointmentWithPayment(context.Background(), CreateAppointmentWithPaymentParams{
+				DoctorID:  doctor.DoctorID,
+				PatientID: patient.PatientID,
+				StartTime: startTime.Add(offset),
+				EndTime:   startTime.Add(offset + 30*time.Minute),
+				Reason:    util.RandString(20),
+				Reference: util.RandString(16),
+				Amount:    "1250.00",
+			})
+			errs <- err
+		}(patients[i], time.Duration(i%3)*10*time.Minute)
+	}
+	wg.Wait()
+	close(errs)
+
+	var booked int
+	for err := range errs {
+		if err == nil {
+			booked++
+			continue
+		}
+		require.ErrorIs(t, err, ErrSlotTaken)
+	}
+	require.Equal(t, 1, booked)
+
+	// the slot is free again once the booking is cancelled
+	t.Run("cancelled appointments don't hold the slot", func(t *testing.T) {
+		first, err := repo.CreateAppointmentWithPayment(context.Background(), CreateAppointmentWithPaymentParams{
+			DoctorID:  doctor.DoctorID,
+			PatientID: patients[0].PatientID,
+			StartTime: startTime.Add(2 * time.Hour),
+			EndTime:   startTime.Add(2*time.Hour + 30*time.Minute),
+			Reason:    util.RandString(20),
+			Reference: util.RandString(16),
+			Amount:    "1250.00",
+		})
+		require.NoError(t, err)
+		err = repo.UpdateAppointmentStatus(context.Background(), UpdateAppointmentStatusParams{
+			AppointmentID: first.Appointment.AppointmentID,
+			From:          database.AppointmentStatusPendingPayment,
+			To:            database.AppointmentStatusCancelled,
+			Actor:         "patient",
+			ChangedBy:     patients[0].UserID,
+			Reason:        "changed my mind",
+		})
+		require.NoError(t, err)
+		_, err = repo.CreateAppointmentWithPayment(context.Background(), CreateAppointmentWithPaymentParams{
+			DoctorID:  doctor.DoctorID,
+			PatientID: patients[1].PatientID,
+			StartTime: startTime.Add(2 * time.Hour),
+			EndTime:   startTime.Add(2*time.Hour + 30*time.Minute),
+			Reason:    util.RandString(20),
+			Reference: util.RandString(16),
+			Amount:    "1250.00",
+		})
+		require.NoError(t, err)
+	})
+	// holds that have run out count as free before the sweeper gets to them , like they do in the slot listing
+	t.Run("expired holds don't hold the slot", func(t *testing.T) {
+		book := func(patient database.Patient, heldAfter time.Time) (*CreateAppointmentWithPaymentTxResults, error) {
+			return repo.CreateAppointmentWithPayment(context.Background(), CreateAppointmentWithPaymentParams{
+				DoctorID:  doctor.DoctorID,
+				PatientID: patient.PatientID,
+				StartTime: startTime.Add(3 * time.Hour),
+				EndTime:   startTime.Add(3*time.Hour + 30*time.Minute),
+				Reason:    util.RandString(20),
+				Reference: util.RandString(16),
+				Amount:    "1250.00",
+				HeldAfter: heldAfter,
+			})
+		}
+		check := func(heldAfter time.Time) database.CheckAppointmentSlotRow {
+			slot, err := repo.CheckSlot(context.Background(), CheckAppointmentSlotParams{
+				DoctorID:  doctor.DoctorID,
+				StartTime: startTime.Add(3 * time.Hour),
+				EndTime:   startTime.Add(3*time.Hour + 30*time.Minute),
+				HeldAfter: heldAfter,
+			})
+			require.NoError(t, err)
+			return slot
+		}
+		held, err := book(patients[2], time.Now().Add(-15*time.Minute))
+		require.NoError(t, err)
+		require.True(t, check(time.Now().Add(-15*time.Minute)).AlreadyBooked)
+		_, err = book(patients[3], time.Now().Add(-15*time.Minute))
+		require.ErrorIs(t, err, ErrSlotTaken)
+
+		// the hold is expired by the booking that takes the slot
+		expiredAt := time.Now().Add(time.Minute)
+		require.False(t, check(expiredAt).AlreadyBooked)
+		_, err = book(patients[3], expiredAt)
+		require.NoError(t, err)
+		appointment, err := repo.GetById(context.Background(), held.Appointment.AppointmentID)
+		require.NoError(t, err)
+		require.Equal(t, database.AppointmentStatusCancelled, appointment.CurrentStatus)
+		payment, err := store.GetPaymentByReference(context.Background(), held.Payment.Reference)
+		require.NoError(t, err)
+		require.Equal(t, database.PaymentStatusFailed, payment.CurrentStatus)
+	})
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/audit"
+	"github.com/mbeka02/lyra_backend/internal/database"
+)
+
+type ListAuditEventsParams struct {
+	OccurredAfter  time.Time
+	OccurredBefore time.Time
+	// zero values match everything
+	PatientID    int64
+	ActorUserID  int64
+	ResourceType string
+	Action       string
+	Limit        int32
+	Offset       int32
+}
+
+type ListPatientRecordAccessesParams struct {
+	PatientID int64
+	// the patient's own reads are left out
+	PatientUserID int64
+	Limit         int32
+	Offset        int32
+}
+
+type AuditRepository interface {
+	// Append chains the event to the last one in the log and saves it
+	Append(ctx context.Context, event audit.Event) (*database.AuditEvent, error)
+	List(ctx context.Context, params ListAuditEventsParams) ([]database.AuditEvent, error)
+	ListPatientRecordAccesses(ctx context.Context, params ListPatientRecordAccessesParams) ([]database.ListPatientRecordAccessesRow, error)
+	// ListChain returns the events after afterEventId in the order they were chained
+	ListChain(ctx context.Context, afterEventId int64, limit int32) ([]audit.ChainedEvent, error)
+	// GetHash returns the hash of an event , the genesis hash when eventId is 0
+	GetHash(ctx context.Context, eventId int64) (string, error)
+}
+
+type auditRepository struct {
+	store *database.Store
+}
+
+func NewAuditRepository(store *database.Store) AuditRepository {
+	return &auditRepository{
+		store,
+	}
+}
+
+func (r *auditRepository) Append(ctx context.Context, event audit.Event) (*database.AuditEvent, error) {
+	var created database.AuditEvent
+	// postgres stores microseconds , the hash has to be computed over what is actually stored
+	event.OccurredAt = event.OccurredAt.UTC().Truncate(time.Microsecond)
+	err := r.store.ExecTx(ctx, func(q *database.Queries) error {
+		if err := q.LockAuditChain(ctx); err != nil {
+			return err
+		}
+		prevHash, err := q.GetLastAuditEventHash(ctx)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			prevHash = audit.GenesisHash
+		}
+		created, err = q.CreateAuditEvent(ctx, database.CreateAuditEventParams{
+			ActorUserID:  event.ActorUserID,
+			ActorRole:    event.ActorRole,
+			PatientID:    event.PatientID,
+			ResourceType: string(event.ResourceType),
+			ResourceID:   event.ResourceID,
+			Action:       string(event.Action),
+			RequestID:    event.RequestID,
+			ClientIp:     event.ClientIP,
+			OccurredAt:   event.OccurredAt,
+			PrevHash:     prevHash,
+			Hash:         audit.Hash(prevHash, event),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (r *auditRepository) List(ctx context.Context, params ListAuditEventsParams) ([]database.AuditEvent, error) {
+	return r.store.ListAuditEvents(ctx, database.ListAuditEventsParams{
+		OccurredAfter:  params.OccurredAfter,
+		OccurredBefore: params.OccurredBefore,
+		PatientID:      params.PatientID,
+		ActorUserID:    params.ActorUserID,
+		ResourceType:   params.ResourceType,
+		Action:         params.Action,
+		SetLimit:       params.Limit,
+		SetOffset:      params.Offset,
+	})
+}
+
+func (r *auditRepository) ListPatientRecordAccesses(ctx context.Context, params ListPatientRecordAccessesParams) ([]database.ListPatientRecordAccessesRow, error) {
+	return r.store.ListPatientRecordAccesses(ctx, database.ListPatientRecordAccessesParams{
+		PatientID:     params.PatientID,
+		PatientUserID: params.PatientUserID,
+		SetLimit:      params.Limit,
+		SetOffset:     params.Offset,
+	})
+}
+
+func (r *auditRepository) ListChain(ctx context.Context, afterEventId int64, limit int32) ([]audit.ChainedEvent, error) {
+	rows, err := r.store.ListAuditChain(ctx, database.ListAuditChainParams{
+		AfterEventID: afterEventId,
+		SetLimit:     limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	events := make([]audit.ChainedEvent, len(rows))
+	for i, row := range rows {
+		events[i] = audit.ChainedEvent{
+			EventID:  row.EventID,
+			PrevHash: row.PrevHash,
+			Hash:     row.Hash,
+			Event: audit.Event{
+				ActorUserID:  row.ActorUserID,
+				ActorRole:    row.ActorRole,
+				PatientID:    row.PatientID,
+				ResourceType: audit.ResourceType(row.ResourceType),
+				ResourceID:   row.ResourceID,
+				Action:       audit.Action(row.Action),
+				RequestID:    row.RequestID,
+				ClientIP:     row.ClientIp,
+				OccurredAt:   row.OccurredAt,
+			},
+		}
+	}
+	return events, nil
+}
+
+func (r *auditRepository) GetHash(ctx context.Context, eventId int64) (string, error) {
+	if eventId == 0 {
+		return audit.GenesisHash, nil
+	}
+	return r.store.GetAuditEventHash(ctx, eventId)
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/audit"
+	"github.com/mbeka02/lyra_backend/internal/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditChain(t *testing.T) {
+	repo := NewAuditRepository(store)
+	ctx := context.Background()
+	patientId := util.RandInt(1_000_000, 2_000_000)
+
+	var lastId int64
+	for i := 0; i < 3; i++ {
+		event, err := repo.Append(ctx, audit.Event{
+			ActorUserID:  util.RandInt(1, 1000),
+			ActorRole:    "specialist",
+			PatientID:    patientId,
+			ResourceType: audit.ResourceAllergy,
+			ResourceID:   util.RandString(8),
+			Action:       audit.ActionRead,
+			RequestID:    util.RandString(12),
+			ClientIP:     "127.0.0.1",
+			OccurredAt:   time.Now(),
+		})
+		require.NoError(t, err)
+		require.Len(t, event.Hash, 64)
+		lastId = event.EventID
+	}
+
+	// the whole log , including events from other tests , still verifies
+	events, err := repo.ListChain(ctx, 0, 10_000)
+	require.NoError(t, err)
+	require.Equal(t, lastId, events[len(events)-1].EventID)
+	_, ok := audit.VerifyChain(audit.GenesisHash, events)
+	require.True(t, ok)
+
+	listed, err := repo.List(ctx, ListAuditEventsParams{
+		OccurredAfter:  time.Now().Add(-time.Hour),
+		OccurredBefore: time.Now().Add(time.Hour),
+		PatientID:      patientId,
+		Limit:          10,
+	})
+	require.NoError(t, err)
+	require.Len(t, listed, 3)
+
+	// the log can't be edited or cleared
+	_, err = store.DB().ExecContext(ctx, "UPDATE audit_events SET patient_id=1 WHERE event_id=$1", lastId)
+	require.ErrorContains(t, err, "append-only")
+	_, err = store.DB().ExecContext(ctx, "DELETE FROM audit_events WHERE event_id=$1", lastId)
+	require.ErrorContains(t, err, "append-only")
+}
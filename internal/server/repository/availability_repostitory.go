@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/mbeka02/lyra_backend/internal/database"
@@ -17,16 +18,65 @@ type CreateAvailabilityParams struct {
 	// IsRecurring bool      `json:"is_recurring"`
 }
 type GetSlotsParams struct {
-	DoctorID  int64
-	DayOfWeek int32
-	SlotDate  time.Time
+	DoctorID int64
+	// a date on the doctor's calendar , the weekly windows of its day of the week are used , the slots are generated in their timezone
+	SlotDate time.Time
+	// unpaid appointments created after this still hold their slot
+	HeldAfter time.Time
+}
+type SearchSlotsParams struct {
+	County         string
+	Specialization string
+	MinPrice       string
+	MaxPrice       string
+	MinExperience  int32
+	MaxExperience  int32
+	// [From, To) are dates on each doctor's calendar
+	From time.Time
+	To   time.Time
+	// unpaid appointments created after this still hold their slot
+	HeldAfter      time.Time
+	SlotsPerDoctor int32
+	// the page of doctors , ordered by their first open slot
+	Limit  int32
+	Offset int32
+}
+type CreateExceptionParams struct {
+	DoctorID        int64
+	Kind            database.AvailabilityExceptionKind
+	StartsAt        time.Time
+	EndsAt          time.Time
+	IntervalMinutes int32
+	Reason          string
+	// unpaid appointments created after this still hold their slot and conflict with a block
+	HeldAfter time.Time
+}
+type SetBookingRulesParams struct {
+	DoctorID         int64
+	BufferMinutes    int32
+	MinNoticeMinutes int32
+	// 0 for no limit
+	HorizonDays int32
 }
 type AvailabilityRepository interface {
 	Create(ctx context.Context, params CreateAvailabilityParams) (*database.Availability, error)
 	GetByDoctor(ctx context.Context, doctorId int64) ([]database.Availability, error)
 	GetSlots(ctx context.Context, params GetSlotsParams) ([]database.GetAppointmentSlotsRow, error)
+	// SearchSlots returns the earliest open slots of a page of verified doctors , a row per slot
+	SearchSlots(ctx context.Context, params SearchSlotsParams) ([]database.SearchAvailableSlotsRow, error)
 	DeleteById(ctx context.Context, availabilityId int64, doctorId int64) error
 	DeleteByDay(ctx context.Context, dayOfWeek int32, doctorId int64) error
+	// CreateException adds a dated exception , a block that overlaps active appointments isn't added and the appointments are returned instead
+	CreateException(ctx context.Context, params CreateExceptionParams) (*database.AvailabilityException, []database.ListBlockConflictsRow, error)
+	ListExceptions(ctx context.Context, doctorId int64, from, to time.Time) ([]database.AvailabilityException, error)
+	DeleteException(ctx context.Context, exceptionId int64, doctorId int64) error
+	ListHolidays(ctx context.Context, from, to time.Time) ([]database.PublicHoliday, error)
+	// SetObservesHolidays opts a doctor in or out of the public holidays , opting in is refused with the upcoming active appointments that fall on one
+	SetObservesHolidays(ctx context.Context, doctorId int64, observes bool, heldAfter time.Time) ([]database.ListBlockConflictsRow, error)
+	SetTimezone(ctx context.Context, doctorId int64, timezone string) (string, error)
+	// GetBookingRules returns sql.ErrNoRows for doctors that haven't set any rules
+	GetBookingRules(ctx context.Context, doctorId int64) (*database.BookingRule, error)
+	SetBookingRules(ctx context.Context, params SetBookingRulesParams) (*database.BookingRule, error)
 }
 
 type availabilityRepository struct {
@@ -42,8 +92,25 @@ func NewAvailabilityRepository(store *database.Store) AvailabilityRepository {
 func (r *availabilityRepository) GetSlots(ctx context.Context, params GetSlotsParams) ([]database.GetAppointmentSlotsRow, error) {
 	return r.store.GetAppointmentSlots(ctx, database.GetAppointmentSlotsParams{
 		DoctorID:  params.DoctorID,
-		DayOfWeek: params.DayOfWeek,
-		Column3:   params.SlotDate,
+		SlotDate:  params.SlotDate,
+		HeldAfter: params.HeldAfter,
+	})
+}
+
+func (r *availabilityRepository) SearchSlots(ctx context.Context, params SearchSlotsParams) ([]database.SearchAvailableSlotsRow, error) {
+	return r.store.SearchAvailableSlots(ctx, database.SearchAvailableSlotsParams{
+		FromDate:          params.From,
+		ToDate:            params.To,
+		HeldAfter:         params.HeldAfter,
+		SlotsPerDoctor:    params.SlotsPerDoctor,
+		SetCounty:         params.County,
+		SetSpecialization: params.Specialization,
+		SetMinPrice:       params.MinPrice,
+		SetMaxPrice:       params.MaxPrice,
+		SetMinExperience:  params.MinExperience,
+		SetMaxExperience:  params.MaxExperience,
+		SetLimit:          params.Limit,
+		SetOffset:         params.Offset,
 	})
 }
 
@@ -78,3 +145,129 @@ func (r *availabilityRepository) DeleteByDay(ctx context.Context, dayOfWeek int3
 		DoctorID:  doctorId,
 	})
 }
+
+func (r *availabilityRepository) CreateException(ctx context.Context, params CreateExceptionParams) (*database.AvailabilityException, []database.ListBlockConflictsRow, error) {
+	var exception database.AvailabilityException
+	var conflicts []database.ListBlockConflictsRow
+	err := r.store.ExecTx(ctx, func(q *database.Queries) error {
+		if params.Kind == database.AvailabilityExceptionKindBlock {
+			var err error
+			conflicts, err = q.ListBlockConflicts(ctx, database.ListBlockConflictsParams{
+				DoctorID:  params.DoctorID,
+				StartsAt:  params.StartsAt,
+				EndsAt:    params.EndsAt,
+				HeldAfter: params.HeldAfter,
+			})
+			if err != nil {
+				return err
+			}
+			if len(conflicts) > 0 {
+				return nil
+			}
+		}
+		var err error
+		exception, err = q.CreateAvailabilityException(ctx, database.CreateAvailabilityExceptionParams{
+			DoctorID:        params.DoctorID,
+			Kind:            params.Kind,
+			StartsAt:        params.StartsAt,
+			EndsAt:          params.EndsAt,
+			IntervalMinutes: params.IntervalMinutes,
+			Reason:          params.Reason,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(conflicts) > 0 {
+		return nil, conflicts, nil
+	}
+	return &exception, nil, nil
+}
+
+func (r *availabilityRepository) ListExceptions(ctx context.Context, doctorId int64, from, to time.Time) ([]database.AvailabilityException, error) {
+	return r.store.ListAvailabilityExceptions(ctx, database.ListAvailabilityExceptionsParams{
+		DoctorID: doctorId,
+		FromTime: from,
+		ToTime:   to,
+	})
+}
+
+func (r *availabilityRepository) DeleteException(ctx context.Context, exceptionId int64, doctorId int64) error {
+	deleted, err := r.store.DeleteAvailabilityException(ctx, database.DeleteAvailabilityExceptionParams{
+		ExceptionID: exceptionId,
+		DoctorID:    doctorId,
+	})
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *availabilityRepository) ListHolidays(ctx context.Context, from, to time.Time) ([]database.PublicHoliday, error) {
+	return r.store.ListPublicHolidays(ctx, database.ListPublicHolidaysParams{
+		FromDate: from,
+		ToDate:   to,
+	})
+}
+
+func (r *availabilityRepository) SetObservesHolidays(ctx context.Context, doctorId int64, observes bool, heldAfter time.Time) ([]database.ListBlockConflictsRow, error) {
+	var conflicts []database.ListBlockConflictsRow
+	err := r.store.ExecTx(ctx, func(q *database.Queries) error {
+		if observes {
+			appointments, err := q.ListHolidayConflicts(ctx, database.ListHolidayConflictsParams{
+				DoctorID:  doctorId,
+				HeldAfter: heldAfter,
+			})
+			if err != nil {
+				return err
+			}
+			for _, appointment := range appointments {
+				conflicts = append(conflicts, database.ListBlockConflictsRow(appointment))
+			}
+			if len(conflicts) > 0 {
+				return nil
+			}
+		}
+		_, err := q.SetObservesPublicHolidays(ctx, database.SetObservesPublicHolidaysParams{
+			DoctorID:               doctorId,
+			ObservesPublicHolidays: observes,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conflicts, nil
+}
+
+func (r *availabilityRepository) SetTimezone(ctx context.Context, doctorId int64, timezone string) (string, error) {
+	return r.store.SetDoctorTimezone(ctx, database.SetDoctorTimezoneParams{
+		DoctorID: doctorId,
+		Timezone: timezone,
+	})
+}
+
+func (r *availabilityRepository) GetBookingRules(ctx context.Context, doctorId int64) (*database.BookingRule, error) {
+	rules, err := r.store.GetBookingRules(ctx, doctorId)
+	if err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+func (r *availabilityRepository) SetBookingRules(ctx context.Context, params SetBookingRulesParams) (*database.BookingRule, error) {
+	rules, err := r.store.UpsertBookingRules(ctx, database.UpsertBookingRulesParams{
+		DoctorID:         params.DoctorID,
+		BufferMinutes:    params.BufferMinutes,
+		MinNoticeMinutes: params.MinNoticeMinutes,
+		HorizonDays:      params.HorizonDays,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
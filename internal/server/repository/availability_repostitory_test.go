@@ -0,0 +1,509 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAvailabilityExceptions(t *testing.T) {
+	doctor := createRandomVerifiedDoctor(t)
+	patient := createRandomPatient(t)
+	day := time.Now().UTC().AddDate(0, 0, 14).Truncate(24 * time.Hour)
+	availabilityRepo := NewAvailabilityRepository(store)
+	// the doctor's calendar is in UTC so that the wall clock times below are the same as the UTC ones
+	_, err := availabilityRepo.SetTimezone(context.Background(), doctor.DoctorID, "UTC")
+	require.NoError(t, err)
+	_, err = availabilityRepo.Create(context.Background(), CreateAvailabilityParams{
+		DoctorID:        doctor.DoctorID,
+		DayOfWeek:       int32(day.Weekday()),
+		StartTime:       "08:00",
+		EndTime:         "17:00",
+		IntervalMinutes: 60,
+	})
+	require.NoError(t, err)
+	slots := func(date time.Time) []database.GetAppointmentSlotsRow {
+		rows, err := availabilityRepo.GetSlots(context.Background(), GetSlotsParams{
+			DoctorID:  doctor.DoctorID,
+			SlotDate:  date,
+			HeldAfter: time.Now().Add(-15 * time.Minute),
+		})
+		require.NoError(t, err)
+		return rows
+	}
+	book := func(start time.Time, length time.Duration) error {
+		_, err := NewAppointmentRepository(store).CreateAppointmentWithPayment(context.Background(), CreateAppointmentWithPaymentParams{
+			DoctorID:  doctor.DoctorID,
+			PatientID: patient.PatientID,
+			StartTime: start,
+			EndTime:   start.Add(length),
+			Reason:    util.RandString(20),
+			Reference: util.RandString(16),
+			Amount:    "1250.00",
+		})
+		return err
+	}
+	require.Len(t, slots(day), 9)
+	require.NoError(t, book(day.Add(10*time.Hour), time.Hour))
+
+	t.Run("blocks over appointments are refused", func(t *testing.T) {
+		exception, conflicts, err := availabilityRepo.CreateException(context.Background(), CreateExceptionParams{
+			DoctorID:  doctor.DoctorID,
+			Kind:      database.AvailabilityExceptionKindBlock,
+			StartsAt:  day.Add(9 * time.Hour),
+			EndsAt:    day.Add(12 * time.Hour),
+			HeldAfter: time.Now().Add(-15 * time.Minute),
+		})
+		require.NoError(t, err)
+		require.Nil(t, exception)
+		require.Len(t, conflicts, 1)
+		require.Equal(t, day.Add(10*time.Hour), conflicts[0].StartTime.UTC())
+	})
+
+	t.Run("blocked slots aren't offered or bookable", func(t *testing.T) {
+		exception, conflicts, err := availabilityRepo.CreateException(context.Background(), CreateExceptionParams{
+			DoctorID:        doctor.DoctorID,
+			Kind:            database.AvailabilityExceptionKindBlock,
+			StartsAt:        day.Add(13 * time.Hour),
+			EndsAt:          day.Add(15 * time.Hour),
+			IntervalMinutes: 60,
+			Reason:          "clinic meeting",
+			HeldAfter:       time.Now().Add(-15 * time.Minute),
+		})
+		require.NoError(t, err)
+		require.Empty(t, conflicts)
+		require.NotNil(t, exception)
+
+		offered := slots(day)
+		require.Len(t, offered, 7)
+		for _, slot := range offered {
+			require.NotEqual(t, "13:00:00", slot.SlotStartTime)
+			require.NotEqual(t, "14:00:00", slot.SlotStartTime)
+		}
+		require.ErrorIs(t, book(day.Add(13*time.Hour+30*time.Minute), 30*time.Minute), ErrSlotUnavailable)
+
+		// removing the block frees the slots again
+		require.NoError(t, availabilityRepo.DeleteException(context.Background(), exception.ExceptionID, doctor.DoctorID))
+		require.Len(t, slots(day), 9)
+		require.ErrorIs(t, availabilityRepo.DeleteException(context.Background(), exception.ExceptionID, doctor.DoctorID), sql.ErrNoRows)
+	})
+
+	t.Run("extra hours are offered and bookable", func(t *testing.T) {
+		// the doctor has no weekly window on the next day
+		extraDay := day.AddDate(0, 0, 1)
+		require.Empty(t, slots(extraDay))
+		require.ErrorIs(t, book(extraDay.Add(10*time.Hour), 30*time.Minute), ErrSlotUnavailable)
+
+		_, conflicts, err := availabilityRepo.CreateException(context.Background(), CreateExceptionParams{
+			DoctorID:        doctor.DoctorID,
+			Kind:            database.AvailabilityExceptionKindExtra,
+			StartsAt:        extraDay.Add(10 * time.Hour),
+			EndsAt:          extraDay.Add(12 * time.Hour),
+			IntervalMinutes: 30,
+		})
+		require.NoError(t, err)
+		require.Empty(t, conflicts)
+		require.Len(t, slots(extraDay), 4)
+		require.NoError(t, book(extraDay.Add(10*time.Hour+30*time.Minute), 30*time.Minute))
+
+		exceptions, err := availabilityRepo.ListExceptions(context.Background(), doctor.DoctorID, extraDay, extraDay.AddDate(0, 0, 1))
+		require.NoError(t, err)
+		require.Len(t, exceptions, 1)
+	})
+}
+
+func TestObservedPublicHolidays(t *testing.T) {
+	availabilityRepo := NewAvailabilityRepository(store)
+	now := time.Now().UTC()
+	holidays, err := availabilityRepo.ListHolidays(context.Background(), now.AddDate(0, 0, 1), now.AddDate(1, 0, 0))
+	require.NoError(t, err)
+	if len(holidays) == 0 {
+		t.Skip("the calendar has no upcoming holidays")
+	}
+	holiday := holidays[0].HolidayDate.UTC()
+
+	doctor := createRandomVerifiedDoctor(t)
+	patient := createRandomPatient(t)
+	_, err = availabilityRepo.SetTimezone(context.Background(), doctor.DoctorID, "UTC")
+	require.NoError(t, err)
+	_, err = availabilityRepo.Create(context.Background(), CreateAvailabilityParams{
+		DoctorID:        doctor.DoctorID,
+		DayOfWeek:       int32(holiday.Weekday()),
+		StartTime:       "08:00",
+		EndTime:         "17:00",
+		IntervalMinutes: 60,
+	})
+	require.NoError(t, err)
+	slots := func() []database.GetAppointmentSlotsRow {
+		rows, err := availabilityRepo.GetSlots(context.Background(), GetSlotsParams{
+			DoctorID:  doctor.DoctorID,
+			SlotDate:  holiday,
+			HeldAfter: time.Now().Add(-15 * time.Minute),
+		})
+		require.NoError(t, err)
+		return rows
+	}
+	// holidays are only observed by the doctors that opt in
+	require.Len(t, slots(), 9)
+
+	appointmentRepo := NewAppointmentRepository(store)
+	booking, err := appointmentRepo.CreateAppointmentWithPayment(context.Background(), CreateAppointmentWithPaymentParams{
+		DoctorID:  doctor.DoctorID,
+		PatientID: patient.PatientID,
+		StartTime: holiday.Add(9 * time.Hour),
+		EndTime:   holiday.Add(10 * time.Hour),
+		Reason:    util.RandString(20),
+		Reference: util.RandString(16),
+		Amount:    "1250.00",
+	})
+	require.NoError(t, err)
+
+	conflicts, err := availabilityRepo.SetObservesHolidays(context.Background(), doctor.DoctorID, true, time.Now().Add(-15*time.Minute))
+	require.NoError(t, err)
+	require.Len(t, conflicts, 1)
+	require.Equal(t, booking.Appointment.AppointmentID, conflicts[0].AppointmentID)
+
+	require.NoError(t, appointmentRepo.UpdateAppointmentStatus(context.Background(), UpdateAppointmentStatusParams{
+		AppointmentID: booking.Appointment.AppointmentID,
+		From:          database.AppointmentStatusPendingPayment,
+		To:            database.AppointmentStatusCancelled,
+		Actor:         "patient",
+		ChangedBy:     patient.UserID,
+		Reason:        "public holiday",
+	}))
+	conflicts, err = availabilityRepo.SetObservesHolidays(context.Background(), doctor.DoctorID, true, time.Now().Add(-15*time.Minute))
+	require.NoError(t, err)
+	require.Empty(t, conflicts)
+
+	require.Empty(t, slots())
+	_, err = appointmentRepo.CreateAppointmentWithPayment(context.Background(), CreateAppointmentWithPaymentParams{
+		DoctorID:  doctor.DoctorID,
+		PatientID: patient.PatientID,
+		StartTime: holiday.Add(11 * time.Hour),
+		EndTime:   holiday.Add(12 * time.Hour),
+		Reason:    util.RandString(20),
+		Reference: util.RandString(16),
+		Amount:    "1250.00",
+	})
+	require.ErrorIs(t, err, ErrSlotUnavailable)
+}
+
+// lastSunday is the last sunday of a month , when the clocks change in Europe
+func lastSunday(year int, month time.Month) time.Time {
+	day := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC)
+	return day.AddDate(0, 0, -int(day.Weekday()))
+}
+
+func TestSlotsAcrossDST(t *testing.T) {
+	doctor := createRandomVerifiedDoctor(t)
+	availabilityRepo := NewAvailabilityRepository(store)
+	_, err := availabilityRepo.SetTimezone(context.Background(), doctor.DoctorID, "Europe/London")
+	require.NoError(t, err)
+	_, err = availabilityRepo.Create(context.Background(), CreateAvailabilityParams{
+		DoctorID:        doctor.DoctorID,
+		DayOfWeek:       int32(time.Sunday),
+		StartTime:       "00:00",
+		EndTime:         "04:00",
+		IntervalMinutes: 60,
+	})
+	require.NoError(t, err)
+	slots := func(date time.Time) []database.GetAppointmentSlotsRow {
+		rows, err := availabilityRepo.GetSlots(context.Background(), GetSlotsParams{
+			DoctorID:  doctor.DoctorID,
+			SlotDate:  date,
+			HeldAfter: time.Now().Add(-15 * time.Minute),
+		})
+		require.NoError(t, err)
+		return rows
+	}
+	year := time.Now().Year() + 1
+
+	t.Run("the clocks go forward", func(t *testing.T) {
+		day := lastSunday(year, time.March)
+		rows := slots(day)
+		// 01:00 doesn't exist that night
+		require.Len(t, rows, 3)
+		for i, local := range []string{"00:00:00", "02:00:00", "03:00:00"} {
+			require.Equal(t, local, rows[i].SlotStartTime)
+			require.Equal(t, "Europe/London", rows[i].Timezone)
+			require.True(t, rows[i].SlotStart.Equal(day.Add(time.Duration(i)*time.Hour)))
+			require.Equal(t, time.Hour, rows[i].SlotEnd.Sub(rows[i].SlotStart))
+		}
+	})
+
+	t.Run("the clocks go back", func(t *testing.T) {
+		day := lastSunday(year, time.October)
+		rows := slots(day)
+		require.Len(t, rows, 4)
+		// midnight is still BST
+		require.True(t, rows[0].SlotStart.Equal(day.Add(-time.Hour)))
+		for i := range rows {
+			require.Equal(t, time.Hour, rows[i].SlotEnd.Sub(rows[i].SlotStart))
+			if i > 0 {
+				require.False(t, rows[i].SlotStart.Before(rows[i-1].SlotEnd))
+			}
+		}
+		require.True(t, rows[3].SlotStart.Equal(day.Add(3*time.Hour)))
+	})
+}
+
+func TestBookingsUseTheDoctorTimezone(t *testing.T) {
+	doctor := createRandomVerifiedDoctor(t)
+	patient := createRandomPatient(t)
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	availabilityRepo := NewAvailabilityRepository(store)
+	_, err = availabilityRepo.SetTimezone(context.Background(), doctor.DoctorID, newYork.String())
+	require.NoError(t, err)
+
+	date := time.Now().In(newYork).AddDate(0, 0, 10)
+	_, err = availabilityRepo.Create(context.Background(), CreateAvailabilityParams{
+		DoctorID:        doctor.DoctorID,
+		DayOfWeek:       int32(date.Weekday()),
+		StartTime:       "08:00",
+		EndTime:         "17:00",
+		IntervalMinutes: 60,
+	})
+	require.NoError(t, err)
+	book := func(hour int) error {
+		start := time.Date(date.Year(), date.Month(), date.Day(), hour, 0, 0, 0, newYork)
+		_, err := NewAppointmentRepository(store).CreateAppointmentWithPayment(context.Background(), CreateAppointmentWithPaymentParams{
+			DoctorID:  doctor.DoctorID,
+			PatientID: patient.PatientID,
+			StartTime: start.UTC(),
+			EndTime:   start.Add(time.Hour).UTC(),
+			Reason:    util.RandString(20),
+			Reference: util.RandString(16),
+			Amount:    "1250.00",
+		})
+		return err
+	}
+	// 16:00 in New York is 20:00 or 21:00 in UTC , it would be outside the window if it was read on the database's clock
+	require.NoError(t, book(16))
+	require.ErrorIs(t, book(17), ErrSlotUnavailable)
+	require.ErrorIs(t, book(7), ErrSlotUnavailable)
+
+	rows, err := availabilityRepo.GetSlots(context.Background(), GetSlotsParams{
+		DoctorID:  doctor.DoctorID,
+		SlotDate:  time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC),
+		HeldAfter: time.Now().Add(-15 * time.Minute),
+	})
+	require.NoError(t, err)
+	require.Len(t, rows, 9)
+	require.Equal(t, "08:00:00", rows[0].SlotStartTime)
+	require.True(t, rows[0].SlotStart.Equal(time.Date(date.Year(), date.Month(), date.Day(), 8, 0, 0, 0, newYork)))
+	require.Equal(t, "booked", rows[8].SlotStatus)
+}
+
+func TestSearchSlots(t *testing.T) {
+	doctor := createRandomVerifiedDoctor(t)
+	patient := createRandomPatient(t)
+	day := time.Now().UTC().AddDate(0, 0, 14).Truncate(24 * time.Hour)
+	availabilityRepo := NewAvailabilityRepository(store)
+	_, err := availabilityRepo.SetTimezone(context.Background(), doctor.DoctorID, "UTC")
+	require.NoError(t, err)
+	_, err = availabilityRepo.Create(context.Background(), CreateAvailabilityParams{
+		DoctorID:        doctor.DoctorID,
+		DayOfWeek:       int32(day.Weekday()),
+		StartTime:       "08:00",
+		EndTime:         "12:00",
+		IntervalMinutes: 60,
+	})
+	require.NoError(t, err)
+	_, err = NewAppointmentRepository(store).CreateAppointmentWithPayment(context.Background(), CreateAppointmentWithPaymentParams{
+		DoctorID:  doctor.DoctorID,
+		PatientID: patient.PatientID,
+		StartTime: day.Add(8 * time.Hour),
+		EndTime:   day.Add(9 * time.Hour),
+		Reason:    util.RandString(20),
+		Reference: util.RandString(16),
+		Amount:    "1250.00",
+	})
+	require.NoError(t, err)
+	search := func(specialization string, from time.Time, days int) []database.SearchAvailableSlotsRow {
+		rows, err := availabilityRepo.SearchSlots(context.Background(), SearchSlotsParams{
+			Specialization: specialization,
+			MaxExperience:  10000,
+			From:           from,
+			To:             from.AddDate(0, 0, days),
+			HeldAfter:      time.Now().Add(-15 * time.Minute),
+			SlotsPerDoctor: 2,
+			Limit:          10,
+		})
+		require.NoError(t, err)
+		return rows
+	}
+
+	// the booked 08:00 slot is skipped and only the two earliest open ones are returned
+	rows := search(doctor.Specialization, day.AddDate(0, 0, -3), 7)
+	require.Len(t, rows, 2)
+	require.Equal(t, doctor.DoctorID, rows[0].DoctorID)
+	require.Equal(t, day.Add(9*time.Hour), rows[0].SlotStart.UTC())
+	require.Equal(t, "10:00:00", rows[1].SlotStartTime)
+
+	// the range ends before the doctor's day
+	require.Empty(t, search(doctor.Specialization, day.AddDate(0, 0, -3), 3))
+
+	_, _, err = availabilityRepo.CreateException(context.Background(), CreateExceptionParams{
+		DoctorID:  doctor.DoctorID,
+		Kind:      database.AvailabilityExceptionKindBlock,
+		StartsAt:  day.Add(9 * time.Hour),
+		EndsAt:    day.Add(11 * time.Hour),
+		HeldAfter: time.Now().Add(-15 * time.Minute),
+	})
+	require.NoError(t, err)
+	rows = search(doctor.Specialization, day, 1)
+	require.Len(t, rows, 1)
+	require.Equal(t, "11:00:00", rows[0].SlotStartTime)
+
+	// doctors that aren't verified aren't searched
+	unverified := createRandomDoctor(t)
+	require.Empty(t, search(unverified.Specialization, day, 1))
+}
+
+func TestBookingRules(t *testing.T) {
+	doctor := createRandomVerifiedDoctor(t)
+	patient := createRandomPatient(t)
+	day := time.Now().UTC().AddDate(0, 0, 14).Truncate(24 * time.Hour)
+	availabilityRepo := NewAvailabilityRepository(store)
+	appointmentRepo := NewAppointmentRepository(store)
+	_, err := availabilityRepo.SetTimezone(context.Background(), doctor.DoctorID, "UTC")
+	require.NoError(t, err)
+	_, err = availabilityRepo.Create(context.Background(), CreateAvailabilityParams{
+		DoctorID:        doctor.DoctorID,
+		DayOfWeek:       int32(day.Weekday()),
+		StartTime:       "08:00",
+		EndTime:         "17:00",
+		IntervalMinutes: 60,
+	})
+	require.NoError(t, err)
+	_, err = availabilityRepo.GetBookingRules(context.Background(), doctor.DoctorID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	rules, err := availabilityRepo.SetBookingRules(context.Background(), SetBookingRulesParams{
+		DoctorID:         doctor.DoctorID,
+		BufferMinutes:    10,
+		MinNoticeMinutes: 120,
+		HorizonDays:      60,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(10), rules.BufferMinutes)
+
+	book := func(start time.Time, length time.Duration) error {
+		_, err := appointmentRepo.CreateAppointmentWithPayment(context.Background(), CreateAppointmentWithPaymentParams{
+			DoctorID:  doctor.DoctorID,
+			PatientID: patient.PatientID,
+			StartTime: start,
+			EndTime:   start.Add(length),
+			Reason:    util.RandString(20),
+			Reference: util.RandString(16),
+			Amount:    "1250.00",
+		})
+		return err
+	}
+	check := func(start time.Time, length time.Duration) database.CheckAppointmentSlotRow {
+		slot, err := appointmentRepo.CheckSlot(context.Background(), CheckAppointmentSlotParams{
+			DoctorID:  doctor.DoctorID,
+			StartTime: start,
+			EndTime:   start.Add(length),
+		})
+		require.NoError(t, err)
+		return slot
+	}
+	slots := func(date time.Time) []database.GetAppointmentSlotsRow {
+		rows, err := availabilityRepo.GetSlots(context.Background(), GetSlotsParams{
+			DoctorID:  doctor.DoctorID,
+			SlotDate:  date,
+			HeldAfter: time.Now().Add(-15 * time.Minute),
+		})
+		require.NoError(t, err)
+		return rows
+	}
+
+	t.Run("buffer", func(t *testing.T) {
+		require.NoError(t, book(day.Add(10*time.Hour), time.Hour))
+		require.True(t, check(day.Add(11*time.Hour+5*time.Minute), 30*time.Minute).TooClose)
+		require.ErrorIs(t, book(day.Add(11*time.Hour+5*time.Minute), 30*time.Minute), ErrBookingRules)
+		require.False(t, check(day.Add(11*time.Hour+10*time.Minute), 30*time.Minute).TooClose)
+
+		// the slots next to the appointment are taken by its buffer
+		for _, slot := range slots(day) {
+			switch slot.SlotStartTime {
+			case "09:00:00", "10:00:00", "11:00:00":
+				require.Equal(t, "booked", slot.SlotStatus)
+			default:
+				require.Equal(t, "available", slot.SlotStatus)
+			}
+		}
+	})
+
+	t.Run("horizon", func(t *testing.T) {
+		// the same weekday ten weeks later is more than 60 days out
+		later := day.AddDate(0, 0, 70)
+		require.Empty(t, slots(later))
+		require.True(t, check(later.Add(9*time.Hour), time.Hour).TooFar)
+		require.ErrorIs(t, book(later.Add(9*time.Hour), time.Hour), ErrBookingRules)
+	})
+
+	t.Run("minimum notice", func(t *testing.T) {
+		soon := time.Now().UTC().Truncate(time.Hour).Add(time.Hour)
+		_, _, err := availabilityRepo.CreateException(context.Background(), CreateExceptionParams{
+			DoctorID:        doctor.DoctorID,
+			Kind:            database.AvailabilityExceptionKindExtra,
+			StartsAt:        soon,
+			EndsAt:          soon.Add(4 * time.Hour),
+			IntervalMinutes: 60,
+		})
+		require.NoError(t, err)
+		require.True(t, check(soon, time.Hour).TooSoon)
+		require.ErrorIs(t, book(soon, time.Hour), ErrBookingRules)
+		require.False(t, check(soon.Add(2*time.Hour), time.Hour).TooSoon)
+		require.NoError(t, book(soon.Add(2*time.Hour), time.Hour))
+	})
+}
+
+func TestPayingForAHeldAppointment(t *testing.T) {
+	doctor := createRandomVerifiedDoctor(t)
+	patient := createRandomPatient(t)
+	day := time.Now().UTC().AddDate(0, 0, 14).Truncate(24 * time.Hour)
+	availabilityRepo := NewAvailabilityRepository(store)
+	_, err := availabilityRepo.SetTimezone(context.Background(), doctor.DoctorID, "UTC")
+	require.NoError(t, err)
+	_, err = availabilityRepo.Create(context.Background(), CreateAvailabilityParams{
+		DoctorID:        doctor.DoctorID,
+		DayOfWeek:       int32(day.Weekday()),
+		StartTime:       "08:00",
+		EndTime:         "17:00",
+		IntervalMinutes: 60,
+	})
+	require.NoError(t, err)
+	reference := util.RandString(16)
+	_, err = NewAppointmentRepository(store).CreateAppointmentWithPayment(context.Background(), CreateAppointmentWithPaymentParams{
+		DoctorID:  doctor.DoctorID,
+		PatientID: patient.PatientID,
+		StartTime: day.Add(10 * time.Hour),
+		EndTime:   day.Add(11 * time.Hour),
+		Reason:    util.RandString(20),
+		Reference: reference,
+		Amount:    "1250.00",
+	})
+	require.NoError(t, err)
+
+	// the doctor drops the day and asks for more notice while the patient is paying , the held slot is still theirs
+	require.NoError(t, availabilityRepo.DeleteByDay(context.Background(), int32(day.Weekday()), doctor.DoctorID))
+	_, err = availabilityRepo.SetBookingRules(context.Background(), SetBookingRulesParams{
+		DoctorID:         doctor.DoctorID,
+		MinNoticeMinutes: 60 * 24 * 30,
+	})
+	require.NoError(t, err)
+	require.NoError(t, NewPaymentRepository(store).UpdatePaymentAndAppointmentStatus(context.Background(), UpdatePaymentAndAppointmentStatusParams{
+		Reference:             reference,
+		PaymentStatus:         string(database.PaymentStatusCompleted),
+		AppointmentStatus:     string(database.AppointmentStatusScheduled),
+		FromAppointmentStatus: string(database.AppointmentStatusPendingPayment),
+	}))
+}
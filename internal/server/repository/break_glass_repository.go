@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+)
+
+type CreateBreakGlassGrantParams struct {
+	DoctorID  int64
+	PatientID int64
+	Reason    string
+	ExpiresAt time.Time
+}
+
+type ListBreakGlassGrantsParams struct {
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// 0 matches every patient / doctor
+	PatientID int64
+	DoctorID  int64
+	Limit     int32
+	Offset    int32
+}
+
+type BreakGlassRepository interface {
+	CreateGrant(ctx context.Context, params CreateBreakGlassGrantParams) (*database.BreakGlassGrant, error)
+	// GetActiveGrant returns the unexpired grant with the latest expiry , it returns sql.ErrNoRows if there is none
+	GetActiveGrant(ctx context.Context, doctorId, patientId int64) (*database.BreakGlassGrant, error)
+	RecordAccess(ctx context.Context, grantId int64, resource string) error
+	ListGrants(ctx context.Context, params ListBreakGlassGrantsParams) ([]database.ListBreakGlassGrantsRow, error)
+	ListAccesses(ctx context.Context, grantId int64) ([]database.BreakGlassAccess, error)
+}
+
+type breakGlassRepository struct {
+	store *database.Store
+}
+
+func NewBreakGlassRepository(store *database.Store) BreakGlassRepository {
+	return &breakGlassRepository{
+		store,
+	}
+}
+
+func (r *breakGlassRepository) CreateGrant(ctx context.Context, params CreateBreakGlassGrantParams) (*database.BreakGlassGrant, error) {
+	grant, err := r.store.CreateBreakGlassGrant(ctx, database.CreateBreakGlassGrantParams{
+		DoctorID:  params.DoctorID,
+		PatientID: params.PatientID,
+		Reason:    params.Reason,
+		ExpiresAt: params.ExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &grant, nil
+}
+
+func (r *breakGlassRepository) GetActiveGrant(ctx context.Context, doctorId, patientId int64) (*database.BreakGlassGrant, error) {
+	grant, err := r.store.GetActiveBreakGlassGrant(ctx, database.GetActiveBreakGlassGrantParams{
+		DoctorID:  doctorId,
+		PatientID: patientId,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &grant, nil
+}
+
+func (r *breakGlassRepository) RecordAccess(ctx context.Context, grantId int64, resource string) error {
+	return r.store.RecordBreakGlassAccess(ctx, database.RecordBreakGlassAccessParams{
+		GrantID:  grantId,
+		Resource: resource,
+	})
+}
+
+func (r *breakGlassRepository) ListGrants(ctx context.Context, params ListBreakGlassGrantsParams) ([]database.ListBreakGlassGrantsRow, error) {
+	return r.store.ListBreakGlassGrants(ctx, database.ListBreakGlassGrantsParams{
+		CreatedAfter:  params.CreatedAfter,
+		CreatedBefore: params.CreatedBefore,
+		PatientID:     params.PatientID,
+		DoctorID:      params.DoctorID,
+		SetLimit:      params.Limit,
+		SetOffset:     params.Offset,
+	})
+}
+
+func (r *breakGlassRepository) ListAccesses(ctx context.Context, grantId int64) ([]database.BreakGlassAccess, error) {
+	return r.store.ListBreakGlassAccesses(ctx, grantId)
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreakGlassGrant(t *testing.T) {
+	doctor := createRandomDoctor(t)
+	patient := createRandomPatient(t)
+	repo := NewBreakGlassRepository(store)
+	ctx := context.Background()
+
+	// nothing has been granted yet
+	_, err := repo.GetActiveGrant(ctx, doctor.DoctorID, patient.PatientID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// an expired grant doesn't give access
+	_, err = repo.CreateGrant(ctx, CreateBreakGlassGrantParams{
+		DoctorID:  doctor.DoctorID,
+		PatientID: patient.PatientID,
+		Reason:    "referral arrived before the first booking",
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	require.NoError(t, err)
+	_, err = repo.GetActiveGrant(ctx, doctor.DoctorID, patient.PatientID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	grant, err := repo.CreateGrant(ctx, CreateBreakGlassGrantParams{
+		DoctorID:  doctor.DoctorID,
+		PatientID: patient.PatientID,
+		Reason:    "patient brought into the emergency room unconscious",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	active, err := repo.GetActiveGrant(ctx, doctor.DoctorID, patient.PatientID)
+	require.NoError(t, err)
+	require.Equal(t, grant.GrantID, active.GrantID)
+
+	require.NoError(t, repo.RecordAccess(ctx, grant.GrantID, "GET /api/v1/patients/1/allergies"))
+	require.NoError(t, repo.RecordAccess(ctx, grant.GrantID, "GET /api/v1/patients/1/medications"))
+	accesses, err := repo.ListAccesses(ctx, grant.GrantID)
+	require.NoError(t, err)
+	require.Len(t, accesses, 2)
+
+	grants, err := repo.ListGrants(ctx, ListBreakGlassGrantsParams{
+		CreatedAfter:  time.Now().Add(-time.Hour),
+		CreatedBefore: time.Now().Add(time.Hour),
+		PatientID:     patient.PatientID,
+		Limit:         10,
+	})
+	require.NoError(t, err)
+	require.Len(t, grants, 2)
+	// newest first
+	require.Equal(t, grant.GrantID, grants[0].GrantID)
+	require.Equal(t, int64(2), grants[0].AccessCount)
+	require.NotEmpty(t, grants[0].DoctorName)
+	require.NotEmpty(t, grants[0].PatientName)
+}
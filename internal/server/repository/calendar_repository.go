@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+)
+
+// CalendarRepository holds the secret ICS feeds of the users , only the hash of each feed's token is stored
+type CalendarRepository interface {
+	// SetFeed replaces the user's feed token
+	SetFeed(ctx context.Context, userId int64, tokenHash string) error
+	// DeleteFeed returns sql.ErrNoRows if the user has no feed
+	DeleteFeed(ctx context.Context, userId int64) error
+	GetFeedOwner(ctx context.Context, tokenHash string) (*database.GetCalendarFeedOwnerRow, error)
+}
+
+type calendarRepository struct {
+	store *database.Store
+}
+
+func NewCalendarRepository(store *database.Store) CalendarRepository {
+	return &calendarRepository{
+		store,
+	}
+}
+
+func (r *calendarRepository) SetFeed(ctx context.Context, userId int64, tokenHash string) error {
+	_, err := r.store.UpsertCalendarFeed(ctx, database.UpsertCalendarFeedParams{
+		UserID:    userId,
+		TokenHash: tokenHash,
+	})
+	return err
+}
+
+func (r *calendarRepository) DeleteFeed(ctx context.Context, userId int64) error {
+	deleted, err := r.store.DeleteCalendarFeed(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *calendarRepository) GetFeedOwner(ctx context.Context, tokenHash string) (*database.GetCalendarFeedOwnerRow, error) {
+	owner, err := r.store.GetCalendarFeedOwner(ctx, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	return &owner, nil
+}
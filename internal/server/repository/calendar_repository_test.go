@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalendarFeeds(t *testing.T) {
+	user := createRandomUser(t)
+	repo := NewCalendarRepository(store)
+
+	first := util.RandString(64)
+	require.NoError(t, repo.SetFeed(context.Background(), user.UserID, first))
+	owner, err := repo.GetFeedOwner(context.Background(), first)
+	require.NoError(t, err)
+	require.Equal(t, user.UserID, owner.UserID)
+	require.Equal(t, user.UserRole, owner.UserRole)
+
+	// a new token replaces the old one
+	second := util.RandString(64)
+	require.NoError(t, repo.SetFeed(context.Background(), user.UserID, second))
+	_, err = repo.GetFeedOwner(context.Background(), first)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = repo.GetFeedOwner(context.Background(), second)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.DeleteFeed(context.Background(), user.UserID))
+	_, err = repo.GetFeedOwner(context.Background(), second)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.ErrorIs(t, repo.DeleteFeed(context.Background(), user.UserID), sql.ErrNoRows)
+}
+
+func TestGetAppointmentParticipants(t *testing.T) {
+	doctor := createRandomVerifiedDoctor(t)
+	patient := createRandomPatient(t)
+	startTime := time.Now().UTC().AddDate(0, 0, 11).Truncate(24 * time.Hour).Add(10 * time.Hour)
+	_, err := NewAvailabilityRepository(store).Create(context.Background(), CreateAvailabilityParams{
+		DoctorID:        doctor.DoctorID,
+		DayOfWeek:       int32(startTime.Weekday()),
+		StartTime:       "08:00",
+		EndTime:         "17:00",
+		IntervalMinutes: 30,
+	})
+	require.NoError(t, err)
+
+	appointmentRepo := NewAppointmentRepository(store)
+	booking, err := appointmentRepo.CreateAppointmentWithPayment(context.Background(), CreateAppointmentWithPaymentParams{
+		DoctorID:        doctor.DoctorID,
+		PatientID:       patient.PatientID,
+		StartTime:       startTime,
+		EndTime:         startTime.Add(30 * time.Minute),
+		Reason:          util.RandString(20),
+		Reference:       util.RandString(16),
+		Amount:          "1200.00",
+		ConsultationFee: "1000.00",
+		PlatformFee:     "100.00",
+		Tax:             "100.00",
+		PaymentMethod:   "paystack",
+	})
+	require.NoError(t, err)
+	appointmentId := booking.Appointment.AppointmentID
+
+	participants, err := appointmentRepo.GetParticipants(context.Background(), appointmentId)
+	require.NoError(t, err)
+	require.Equal(t, appointmentId, participants.AppointmentID)
+	require.Equal(t, database.AppointmentStatusPendingPayment, participants.CurrentStatus)
+	require.Equal(t, "Africa/Nairobi", participants.DoctorTimezone)
+	require.NotEmpty(t, participants.DoctorEmail)
+	require.NotEmpty(t, participants.PatientEmail)
+	require.Zero(t, participants.RescheduleCount)
+
+	_, err = appointmentRepo.GetParticipants(context.Background(), appointmentId+1000)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
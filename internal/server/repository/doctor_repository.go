@@ -14,6 +14,8 @@ type CreateDoctorParams struct {
 	PricePerHour      string
 	YearsOfExperience int32
 	UserID            int64
+	// the IANA timezone the doctor's availability is in
+	Timezone string
 }
 type GetDoctorsParams struct {
 	Offset         int32
@@ -29,11 +31,36 @@ type GetDoctorsParams struct {
 	SortOrder string // Sorting order (asc, desc)
 }
 
+type UpdateVerificationStatusParams struct {
+	DoctorID int64
+	// the update only succeeds if the doctor is still in this status
+	From      database.VerificationStatus
+	To        database.VerificationStatus
+	Reason    string
+	ChangedBy int64
+}
+type CreateLicenseDocumentParams struct {
+	DoctorID    int64
+	FileURL     string
+	FileName    string
+	ContentType string
+}
+
 type DoctorRepository interface {
 	Create(ctx context.Context, params CreateDoctorParams) (*database.Doctor, error)
+	GetById(ctx context.Context, doctorId int64) (*database.Doctor, error)
+	GetByUserId(ctx context.Context, userId int64) (*database.Doctor, error)
+	// GetAllDoctors only returns verified doctors
 	GetAllDoctors(ctx context.Context, params GetDoctorsParams) ([]database.GetDoctorsRow, error)
 	GetDoctorIdByUserId(ctx context.Context, userId int64) (int64, error)
 	ListPatientsUnderCare(ctx context.Context, doctorId int64) ([]database.ListPatientsUnderDoctorCareRow, error)
+	// UpdateVerificationStatus changes the status and records who changed it ,
+	// it returns sql.ErrNoRows if the doctor is no longer in the From status
+	UpdateVerificationStatus(ctx context.Context, params UpdateVerificationStatusParams) (*database.Doctor, error)
+	ListVerificationEvents(ctx context.Context, doctorId int64) ([]database.DoctorVerificationEvent, error)
+	ListByVerificationStatus(ctx context.Context, status database.VerificationStatus, limit, offset int32) ([]database.ListDoctorsByVerificationStatusRow, error)
+	CreateLicenseDocument(ctx context.Context, params CreateLicenseDocumentParams) (*database.DoctorLicenseDocument, error)
+	ListLicenseDocuments(ctx context.Context, doctorId int64) ([]database.DoctorLicenseDocument, error)
 }
 
 type doctorRepository struct {
@@ -63,6 +90,7 @@ func (r *doctorRepository) Create(ctx context.Context, params CreateDoctorParams
 			County:            params.County,
 			YearsOfExperience: params.YearsOfExperience,
 			PricePerHour:      params.PricePerHour,
+			Timezone:          params.Timezone,
 		})
 		if err != nil {
 			return err
@@ -95,3 +123,75 @@ func (r *doctorRepository) GetAllDoctors(ctx context.Context, params GetDoctorsP
 		SetOffset: params.Offset,
 	})
 }
+
+func (r *doctorRepository) GetById(ctx context.Context, doctorId int64) (*database.Doctor, error) {
+	doctor, err := r.store.GetDoctorById(ctx, doctorId)
+	if err != nil {
+		return nil, err
+	}
+	return &doctor, nil
+}
+
+func (r *doctorRepository) GetByUserId(ctx context.Context, userId int64) (*database.Doctor, error) {
+	doctor, err := r.store.GetDoctorByUserId(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	return &doctor, nil
+}
+
+func (r *doctorRepository) UpdateVerificationStatus(ctx context.Context, params UpdateVerificationStatusParams) (*database.Doctor, error) {
+	var doctor database.Doctor
+	err := r.store.ExecTx(ctx, func(q *database.Queries) error {
+		var err error
+		doctor, err = q.UpdateDoctorVerificationStatus(ctx, database.UpdateDoctorVerificationStatusParams{
+			DoctorID:   params.DoctorID,
+			FromStatus: params.From,
+			ToStatus:   params.To,
+			Reason:     params.Reason,
+		})
+		if err != nil {
+			return err
+		}
+		return q.CreateDoctorVerificationEvent(ctx, database.CreateDoctorVerificationEventParams{
+			DoctorID:   params.DoctorID,
+			FromStatus: params.From,
+			ToStatus:   params.To,
+			Reason:     params.Reason,
+			ChangedBy:  params.ChangedBy,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &doctor, nil
+}
+
+func (r *doctorRepository) ListVerificationEvents(ctx context.Context, doctorId int64) ([]database.DoctorVerificationEvent, error) {
+	return r.store.ListDoctorVerificationEvents(ctx, doctorId)
+}
+
+func (r *doctorRepository) ListByVerificationStatus(ctx context.Context, status database.VerificationStatus, limit, offset int32) ([]database.ListDoctorsByVerificationStatusRow, error) {
+	return r.store.ListDoctorsByVerificationStatus(ctx, database.ListDoctorsByVerificationStatusParams{
+		Status:    status,
+		SetLimit:  limit,
+		SetOffset: offset,
+	})
+}
+
+func (r *doctorRepository) CreateLicenseDocument(ctx context.Context, params CreateLicenseDocumentParams) (*database.DoctorLicenseDocument, error) {
+	document, err := r.store.CreateDoctorLicenseDocument(ctx, database.CreateDoctorLicenseDocumentParams{
+		DoctorID:    params.DoctorID,
+		FileUrl:     params.FileURL,
+		FileName:    params.FileName,
+		ContentType: params.ContentType,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &document, nil
+}
+
+func (r *doctorRepository) ListLicenseDocuments(ctx context.Context, doctorId int64) ([]database.DoctorLicenseDocument, error) {
+	return r.store.ListDoctorLicenseDocuments(ctx, doctorId)
+}
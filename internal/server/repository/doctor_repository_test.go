@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/util"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomDoctor(t *testing.T) database.Doctor {
+	user := createRandomUser(t)
+	repo := NewDoctorRepository(store)
+	doctor, err := repo.Create(context.Background(), CreateDoctorParams{
+		UserID:            user.UserID,
+		Specialization:    util.RandString(10),
+		LicenseNumber:     util.RandString(12),
+		Description:       util.RandString(40),
+		County:            "Nairobi",
+		PricePerHour:      "2500.00",
+		YearsOfExperience: int32(util.RandInt(1, 30)),
+		Timezone:          "Africa/Nairobi",
+	})
+	require.NoError(t, err)
+	require.Equal(t, user.UserID, doctor.UserID)
+
+	doctorId, err := repo.GetDoctorIdByUserId(context.Background(), user.UserID)
+	require.NoError(t, err)
+	require.Equal(t, doctor.DoctorID, doctorId)
+	return *doctor
+}
+
+func TestCreateDoctor(t *testing.T) {
+	createRandomDoctor(t)
+}
+
+// createRandomVerifiedDoctor creates a doctor that can be listed and booked
+func createRandomVerifiedDoctor(t *testing.T) database.Doctor {
+	doctor := createRandomDoctor(t)
+	admin := createRandomUser(t)
+	verified, err := NewDoctorRepository(store).UpdateVerificationStatus(context.Background(), UpdateVerificationStatusParams{
+		DoctorID:  doctor.DoctorID,
+		From:      database.VerificationStatusPending,
+		To:        database.VerificationStatusVerified,
+		ChangedBy: admin.UserID,
+	})
+	require.NoError(t, err)
+	return *verified
+}
+
+func TestDoctorVerification(t *testing.T) {
+	repo := NewDoctorRepository(store)
+	doctor := createRandomDoctor(t)
+	admin := createRandomUser(t)
+	require.Equal(t, database.VerificationStatusPending, doctor.VerificationStatus)
+
+	listed := func() bool {
+		rows, err := repo.GetAllDoctors(context.Background(), GetDoctorsParams{
+			Specialization: doctor.Specialization,
+			MaxExperience:  100,
+			Limit:          10,
+		})
+		require.NoError(t, err)
+		for _, row := range rows {
+			if row.DoctorID == doctor.DoctorID {
+				return true
+			}
+		}
+		return false
+	}
+	require.False(t, listed())
+
+	document, err := repo.CreateLicenseDocument(context.Background(), CreateLicenseDocumentParams{
+		DoctorID:    doctor.DoctorID,
+		FileURL:     "https://storage.googleapis.com/licenses/" + util.RandString(12),
+		FileName:    "license.pdf",
+		ContentType: "application/pdf",
+	})
+	require.NoError(t, err)
+	documents, err := repo.ListLicenseDocuments(context.Background(), doctor.DoctorID)
+	require.NoError(t, err)
+	require.Len(t, documents, 1)
+	require.Equal(t, document.DocumentID, documents[0].DocumentID)
+
+	verified, err := repo.UpdateVerificationStatus(context.Background(), UpdateVerificationStatusParams{
+		DoctorID:  doctor.DoctorID,
+		From:      database.VerificationStatusPending,
+		To:        database.VerificationStatusVerified,
+		ChangedBy: admin.UserID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, database.VerificationStatusVerified, verified.VerificationStatus)
+	require.True(t, verified.VerifiedAt.Valid)
+	require.True(t, listed())
+
+	// the doctor is no longer pending
+	_, err = repo.UpdateVerificationStatus(context.Background(), UpdateVerificationStatusParams{
+		DoctorID:  doctor.DoctorID,
+		From:      database.VerificationStatusPending,
+		To:        database.VerificationStatusRejected,
+		Reason:    "license number does not match the register",
+		ChangedBy: admin.UserID,
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = repo.UpdateVerificationStatus(context.Background(), UpdateVerificationStatusParams{
+		DoctorID:  doctor.DoctorID,
+		From:      database.VerificationStatusVerified,
+		To:        database.VerificationStatusSuspended,
+		Reason:    "license expired",
+		ChangedBy: admin.UserID,
+	})
+	require.NoError(t, err)
+	require.False(t, listed())
+
+	events, err := repo.ListVerificationEvents(context.Background(), doctor.DoctorID)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, database.VerificationStatusSuspended, events[0].ToStatus)
+	require.Equal(t, "license expired", events[0].Reason)
+	require.Equal(t, admin.UserID, events[0].ChangedBy)
+}
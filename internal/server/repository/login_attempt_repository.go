@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mbeka02/lyra_backend/internal/database"
+)
+
+type BlockLoginParams struct {
+	Email      string
+	RetryAfter time.Time
+	// zero when the account isn't being locked
+	LockedUntil time.Time
+}
+type CreateAccountUnlockTokenParams struct {
+	UserID    int64
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+// LoginAttemptRepository tracks failed logins per email address , emails are matched case insensitively
+type LoginAttemptRepository interface {
+	// Get returns sql.ErrNoRows if there haven't been any failures since the last successful login
+	Get(ctx context.Context, email string) (*database.LoginAttempt, error)
+	// RecordFailure counts a failed login and returns the updated count
+	RecordFailure(ctx context.Context, email string) (*database.LoginAttempt, error)
+	// RecordSecondFactorFailure counts a wrong code entered against the challenge as a failed login ,
+	// ChallengeFailures is the number of wrong codes entered against this challenge
+	RecordSecondFactorFailure(ctx context.Context, email string, challengeId uuid.UUID) (*database.LoginAttempt, error)
+	Block(ctx context.Context, params BlockLoginParams) error
+	// Clear forgets the failures , it is called after a successful login
+	Clear(ctx context.Context, email string) error
+	// CreateUnlockToken stores a new unlock token and invalidates any that were issued before it
+	CreateUnlockToken(ctx context.Context, params CreateAccountUnlockTokenParams) error
+	// Unlock consumes the token and clears the failures of the account it was issued for.
+	// It returns sql.ErrNoRows if the token is unknown , used or expired
+	Unlock(ctx context.Context, tokenHash string) (int64, error)
+	// UnlockUser clears the failures of the account and invalidates any unlock links that were sent for it
+	UnlockUser(ctx context.Context, userId int64) error
+}
+
+type loginAttemptRepository struct {
+	store *database.Store
+}
+
+func NewLoginAttemptRepository(store *database.Store) LoginAttemptRepository {
+	return &loginAttemptRepository{
+		store,
+	}
+}
+
+func (r *loginAttemptRepository) Get(ctx context.Context, email string) (*database.LoginAttempt, error) {
+	attempt, err := r.store.GetLoginAttempt(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+func (r *loginAttemptRepository) RecordFailure(ctx context.Context, email string) (*database.LoginAttempt, error) {
+	attempt, err := r.store.RecordFailedLogin(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+func (r *loginAttemptRepository) RecordSecondFactorFailure(ctx context.Context, email string, challengeId uuid.UUID) (*database.LoginAttempt, error) {
+	attempt, err := r.store.RecordFailedSecondFactor(ctx, database.RecordFailedSecondFactorParams{
+		Email:       email,
+		ChallengeID: uuid.NullUUID{UUID: challengeId, Valid: true},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+func (r *loginAttemptRepository) Block(ctx context.Context, params BlockLoginParams) error {
+	return r.store.BlockLogin(ctx, database.BlockLoginParams{
+		Email:       params.Email,
+		RetryAfter:  sql.NullTime{Time: params.RetryAfter, Valid: !params.RetryAfter.IsZero()},
+		LockedUntil: sql.NullTime{Time: params.LockedUntil, Valid: !params.LockedUntil.IsZero()},
+	})
+}
+
+func (r *loginAttemptRepository) Clear(ctx context.Context, email string) error {
+	return r.store.ClearLoginAttempts(ctx, email)
+}
+
+func (r *loginAttemptRepository) CreateUnlockToken(ctx context.Context, params CreateAccountUnlockTokenParams) error {
+	return r.store.ExecTx(ctx, func(q *database.Queries) error {
+		if err := q.InvalidateAccountUnlockTokens(ctx, params.UserID); err != nil {
+			return err
+		}
+		return q.CreateAccountUnlockToken(ctx, database.CreateAccountUnlockTokenParams{
+			UserID:    params.UserID,
+			TokenHash: params.TokenHash,
+			ExpiresAt: params.ExpiresAt,
+		})
+	})
+}
+
+func (r *loginAttemptRepository) Unlock(ctx context.Context, tokenHash string) (int64, error) {
+	var userId int64
+	err := r.store.ExecTx(ctx, func(q *database.Queries) error {
+		token, err := q.ConsumeAccountUnlockToken(ctx, tokenHash)
+		if err != nil {
+			return err
+		}
+		userId = token.UserID
+		return unlockUser(ctx, q, token.UserID)
+	})
+	return userId, err
+}
+
+func (r *loginAttemptRepository) UnlockUser(ctx context.Context, userId int64) error {
+	return r.store.ExecTx(ctx, func(q *database.Queries) error {
+		return unlockUser(ctx, q, userId)
+	})
+}
+
+func unlockUser(ctx context.Context, q *database.Queries, userId int64) error {
+	user, err := q.GetUserById(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if err := q.InvalidateAccountUnlockTokens(ctx, userId); err != nil {
+		return err
+	}
+	return q.ClearLoginAttempts(ctx, user.Email)
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mbeka02/lyra_backend/internal/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordFailedLogin(t *testing.T) {
+	repo := NewLoginAttemptRepository(store)
+	email := util.RandEmail()
+
+	_, err := repo.Get(context.Background(), email)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	attempt, err := repo.RecordFailure(context.Background(), email)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), attempt.FailedAttempts)
+	// the case of the address doesn't matter
+	attempt, err = repo.RecordFailure(context.Background(), strings.ToUpper(email))
+	require.NoError(t, err)
+	require.Equal(t, int32(2), attempt.FailedAttempts)
+
+	// a lockout that has run out starts the count again
+	err = repo.Block(context.Background(), BlockLoginParams{
+		Email:       email,
+		RetryAfter:  time.Now().Add(-time.Minute),
+		LockedUntil: time.Now().Add(-time.Second),
+	})
+	require.NoError(t, err)
+	attempt, err = repo.RecordFailure(context.Background(), email)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), attempt.FailedAttempts)
+	require.False(t, attempt.LockedUntil.Valid)
+
+	require.NoError(t, repo.Clear(context.Background(), email))
+	_, err = repo.Get(context.Background(), email)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestRecordSecondFactorFailure(t *testing.T) {
+	repo := NewLoginAttemptRepository(store)
+	email := util.RandEmail()
+	first, second := uuid.New(), uuid.New()
+
+	// the wrong password and the wrong codes are counted together
+	_, err := repo.RecordFailure(context.Background(), email)
+	require.NoError(t, err)
+	attempt, err := repo.RecordSecondFactorFailure(context.Background(), email, first)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), attempt.FailedAttempts)
+	require.Equal(t, int32(1), attempt.ChallengeFailures)
+	attempt, err = repo.RecordSecondFactorFailure(context.Background(), strings.ToUpper(email), first)
+	require.NoError(t, err)
+	require.Equal(t, int32(3), attempt.FailedAttempts)
+	require.Equal(t, int32(2), attempt.ChallengeFailures)
+
+	// a new challenge only starts its own count again
+	attempt, err = repo.RecordSecondFactorFailure(context.Background(), email, second)
+	require.NoError(t, err)
+	require.Equal(t, int32(4), attempt.FailedAttempts)
+	require.Equal(t, int32(1), attempt.ChallengeFailures)
+	require.Equal(t, second, attempt.ChallengeID.UUID)
+}
+
+func TestUnlockTokenIsSingleUse(t *testing.T) {
+	randomUser := createRandomUser(t)
+	repo := NewLoginAttemptRepository(store)
+
+	_, err := repo.RecordFailure(context.Background(), randomUser.Email)
+	require.NoError(t, err)
+	err = repo.Block(context.Background(), BlockLoginParams{
+		Email:       randomUser.Email,
+		RetryAfter:  time.Now().Add(time.Hour),
+		LockedUntil: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	tokenHash := util.RandString(64)
+	err = repo.CreateUnlockToken(context.Background(), CreateAccountUnlockTokenParams{
+		UserID:    randomUser.UserID,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	userId, err := repo.Unlock(context.Background(), tokenHash)
+	require.NoError(t, err)
+	require.Equal(t, randomUser.UserID, userId)
+	_, err = repo.Get(context.Background(), randomUser.Email)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = repo.Unlock(context.Background(), tokenHash)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
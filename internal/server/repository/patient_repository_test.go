@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/util"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomPatient(t *testing.T) database.Patient {
+	user := createRandomUser(t)
+	repo := NewPatientRepository(store)
+	result, err := repo.Create(context.Background(), CreatePatientParams{
+		UserID:                user.UserID,
+		Address:               util.RandString(20),
+		EmergencyContactName:  util.RandName(),
+		EmergencyContactPhone: util.RandPhoneNumber(),
+	})
+	require.NoError(t, err)
+	require.Equal(t, user.UserID, result.Patient.UserID)
+
+	patientId, err := repo.GetPatientIdByUserId(context.Background(), user.UserID)
+	require.NoError(t, err)
+	require.Equal(t, result.Patient.PatientID, patientId)
+	return result.Patient
+}
+
+func TestCreatePatient(t *testing.T) {
+	createRandomPatient(t)
+}
@@ -2,6 +2,10 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
 
 	"github.com/mbeka02/lyra_backend/internal/database"
 )
@@ -10,13 +14,76 @@ type paymentRepository struct {
 	store *database.Store
 }
 type UpdatePaymentAndAppointmentStatusParams struct {
-	PaymentStatus     string
+	PaymentStatus string
+	// the appointment is left as it is when this is empty
 	AppointmentStatus string
+	// the appointment only moves if it's still in this status
+	FromAppointmentStatus string
+	Reference             string
+	// the provider's id for the transaction , kept as it is when this is empty
+	ProviderTransactionID string
+}
+type ClaimWebhookEventParams struct {
+	EventID  string
+	Provider string
+	Event    string
+	Payload  json.RawMessage
+	// a claim made before this is taken to have been abandoned
+	ClaimedBefore time.Time
+}
+type UpdateRefundStatusParams struct {
+	// the reference of the payment that was refunded , may be empty when the refund id is set
+	Reference string
+	// may be empty , the latest refund of the payment is updated then
+	ProviderRefundID string
+	ProviderStatus   string
+	// the payment is left as it is when this is empty
+	PaymentStatus string
+}
+
+type RefundUnbookedPaymentParams struct {
+	Reference             string
+	ProviderTransactionID string
+	Reason                string
+	IdempotencyKey        string
+}
+
+// RefundStatusPending is the status of a refund that hasn't been accepted by the provider yet
+const RefundStatusPending = "pending"
+
+type RecordRefundResultParams struct {
+	RefundID int64
+	// empty when the provider didn't accept the refund
+	ProviderRefundID string
+	ProviderStatus   string
+	// the payment is left as it is when this is empty
+	PaymentStatus string
+}
+type RecordDisputeParams struct {
 	Reference         string
+	ProviderDisputeID string
+	Status            string
+	Resolution        string
+	RefundAmount      string
+	Currency          string
 }
 type PaymentRepository interface {
 	UpdatePaymentAndAppointmentStatus(ctx context.Context, params UpdatePaymentAndAppointmentStatusParams) error
 	GetPaymentByReference(ctx context.Context, reference string) (*database.Payment, error)
+	GetPaymentByAppointmentId(ctx context.Context, appointmentId int64) (*database.Payment, error)
+	// ClaimWebhookEvent records a webhook event and returns false if it has already been processed
+	// or if another delivery of it is being processed
+	ClaimWebhookEvent(ctx context.Context, params ClaimWebhookEventParams) (bool, error)
+	// ReleaseWebhookEvent gives up the claim on an event that couldn't be processed
+	ReleaseWebhookEvent(ctx context.Context, eventId string) error
+	MarkWebhookEventProcessed(ctx context.Context, eventId string) error
+	UpdateRefundStatus(ctx context.Context, params UpdateRefundStatusParams) (*database.Refund, error)
+	// RefundUnbookedPayment records a payment that went through for an appointment that can't be booked any more as completed
+	// and refunds all of it , the refund is pending until it has been sent to the provider
+	RefundUnbookedPayment(ctx context.Context, params RefundUnbookedPaymentParams) (*database.Refund, error)
+	// RecordRefundResult records what the provider answered when a pending refund was sent to it
+	RecordRefundResult(ctx context.Context, params RecordRefundResultParams) (*database.Refund, error)
+	RecordDispute(ctx context.Context, params RecordDisputeParams) (*database.PaymentDispute, error)
 }
 
 func NewPaymentRepository(store *database.Store) PaymentRepository {
@@ -31,30 +98,187 @@ func (r *paymentRepository) GetPaymentByReference(ctx context.Context, reference
 	return &payment, nil
 }
 
+func (r *paymentRepository) GetPaymentByAppointmentId(ctx context.Context, appointmentId int64) (*database.Payment, error) {
+	payment, err := r.store.GetPaymentByAppointmentId(ctx, appointmentId)
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
 func (r *paymentRepository) UpdatePaymentAndAppointmentStatus(ctx context.Context, params UpdatePaymentAndAppointmentStatusParams) error {
 	// UPDATES THE PAYMENT AND APPOINTMENT STATUS AT THE SAME TIME
 	return r.store.ExecTx(ctx, func(q *database.Queries) error {
-		var (
-			err     error
-			payment database.Payment
-		)
 		// get the payment  record
-		payment, err = q.GetPaymentByReference(ctx, params.Reference)
-
+		payment, err := q.GetPaymentByReference(ctx, params.Reference)
+		if err != nil {
+			return err
+		}
 		// update the payment status
 		err = q.UpdatePaymentStatus(ctx, database.UpdatePaymentStatusParams{
-			CurrentStatus: database.PaymentStatus(params.PaymentStatus),
-			Reference:     params.Reference,
+			CurrentStatus:         database.PaymentStatus(params.PaymentStatus),
+			Reference:             params.Reference,
+			ProviderTransactionID: params.ProviderTransactionID,
 		})
 		if err != nil {
 			return err
 		}
-		// update the appointment status
-		err = q.UpdateAppointmentStatus(ctx, database.UpdateAppointmentStatusParams{
+		// the doctor's share is added to their ledger once , redeliveries of the same success are ignored
+		if database.PaymentStatus(params.PaymentStatus) == database.PaymentStatusCompleted {
+			if err := q.RecordPaymentEarning(ctx, payment.PaymentID); err != nil {
+				return err
+			}
+		}
+		if params.AppointmentStatus == "" {
+			return nil
+		}
+		// update the appointment status , these changes always come from the payment provider
+		return updateAppointmentStatus(ctx, q, UpdateAppointmentStatusParams{
 			AppointmentID: payment.AppointmentID,
-			CurrentStatus: database.AppointmentStatus(params.AppointmentStatus),
+			From:          database.AppointmentStatus(params.FromAppointmentStatus),
+			To:            database.AppointmentStatus(params.AppointmentStatus),
+			Actor:         "payment",
+			Reason:        "payment " + params.PaymentStatus,
+		})
+	})
+}
+
+func (r *paymentRepository) ClaimWebhookEvent(ctx context.Context, params ClaimWebhookEventParams) (bool, error) {
+	_, err := r.store.ClaimWebhookEvent(ctx, database.ClaimWebhookEventParams{
+		EventID:       params.EventID,
+		Provider:      params.Provider,
+		Event:         params.Event,
+		Payload:       params.Payload,
+		ClaimedBefore: params.ClaimedBefore,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *paymentRepository) ReleaseWebhookEvent(ctx context.Context, eventId string) error {
+	return r.store.ReleaseWebhookEvent(ctx, eventId)
+}
+
+func (r *paymentRepository) MarkWebhookEventProcessed(ctx context.Context, eventId string) error {
+	return r.store.MarkWebhookEventProcessed(ctx, eventId)
+}
+
+func (r *paymentRepository) UpdateRefundStatus(ctx context.Context, params UpdateRefundStatusParams) (*database.Refund, error) {
+	var refund database.Refund
+	err := r.store.ExecTx(ctx, func(q *database.Queries) error {
+		var err error
+		refund, err = q.UpdateRefundProviderStatus(ctx, database.UpdateRefundProviderStatusParams{
+			ProviderStatus:   params.ProviderStatus,
+			Reference:        params.Reference,
+			ProviderRefundID: params.ProviderRefundID,
+		})
+		if err != nil || params.PaymentStatus == "" {
+			return err
+		}
+		// the refund failed , the doctor keeps their share
+		if err := q.ReverseRefundEarning(ctx, sql.NullInt64{Int64: refund.RefundID, Valid: true}); err != nil {
+			return err
+		}
+		return q.UpdatePaymentStatusById(ctx, database.UpdatePaymentStatusByIdParams{
+			CurrentStatus: database.PaymentStatus(params.PaymentStatus),
+			PaymentID:     refund.PaymentID,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+func (r *paymentRepository) RefundUnbookedPayment(ctx context.Context, params RefundUnbookedPaymentParams) (*database.Refund, error) {
+	var refund database.Refund
+	err := r.store.ExecTx(ctx, func(q *database.Queries) error {
+		payment, err := q.GetPaymentByReference(ctx, params.Reference)
+		if err != nil {
+			return err
+		}
+		err = q.UpdatePaymentStatus(ctx, database.UpdatePaymentStatusParams{
+			CurrentStatus:         database.PaymentStatusCompleted,
+			Reference:             params.Reference,
+			ProviderTransactionID: params.ProviderTransactionID,
+		})
+		if err != nil {
+			return err
+		}
+		// the earning and the refund cancel each other out in the doctor's ledger
+		if err := q.RecordPaymentEarning(ctx, payment.PaymentID); err != nil {
+			return err
+		}
+		refund, err = q.CreateRefund(ctx, database.CreateRefundParams{
+			PaymentID:      payment.PaymentID,
+			AppointmentID:  payment.AppointmentID,
+			Amount:         payment.Amount,
+			Currency:       payment.Currency,
+			Reason:         params.Reason,
+			ProviderStatus: RefundStatusPending,
+			IdempotencyKey: params.IdempotencyKey,
 		})
+		if err != nil {
+			return err
+		}
+		if err := q.RecordRefundEarning(ctx, refund.RefundID); err != nil {
+			return err
+		}
+		return q.UpdatePaymentStatusById(ctx, database.UpdatePaymentStatusByIdParams{
+			CurrentStatus: database.PaymentStatusRefunded,
+			PaymentID:     payment.PaymentID,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
 
-		return err
+func (r *paymentRepository) RecordRefundResult(ctx context.Context, params RecordRefundResultParams) (*database.Refund, error) {
+	var refund database.Refund
+	err := r.store.ExecTx(ctx, func(q *database.Queries) error {
+		var err error
+		refund, err = q.SetRefundProviderResult(ctx, database.SetRefundProviderResultParams{
+			RefundID:         params.RefundID,
+			ProviderRefundID: params.ProviderRefundID,
+			ProviderStatus:   params.ProviderStatus,
+		})
+		if err != nil || params.PaymentStatus == "" {
+			return err
+		}
+		// the provider turned the refund down , the doctor keeps their share
+		if err := q.ReverseRefundEarning(ctx, sql.NullInt64{Int64: refund.RefundID, Valid: true}); err != nil {
+			return err
+		}
+		return q.UpdatePaymentStatusById(ctx, database.UpdatePaymentStatusByIdParams{
+			CurrentStatus: database.PaymentStatus(params.PaymentStatus),
+			PaymentID:     refund.PaymentID,
+		})
 	})
+	if err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+func (r *paymentRepository) RecordDispute(ctx context.Context, params RecordDisputeParams) (*database.PaymentDispute, error) {
+	payment, err := r.store.GetPaymentByReference(ctx, params.Reference)
+	if err != nil {
+		return nil, err
+	}
+	dispute, err := r.store.UpsertPaymentDispute(ctx, database.UpsertPaymentDisputeParams{
+		PaymentID:         payment.PaymentID,
+		ProviderDisputeID: params.ProviderDisputeID,
+		Status:            params.Status,
+		Resolution:        params.Resolution,
+		RefundAmount:      params.RefundAmount,
+		Currency:          params.Currency,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &dispute, nil
 }
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimWebhookEvent(t *testing.T) {
+	repo := NewPaymentRepository(store)
+	params := ClaimWebhookEventParams{
+		EventID:       "paystack:charge.success:" + util.RandString(10),
+		Provider:      "paystack",
+		Event:         "charge.success",
+		Payload:       json.RawMessage(`{"event":"charge.success"}`),
+		ClaimedBefore: time.Now().Add(-5 * time.Minute),
+	}
+	claim := func(params ClaimWebhookEventParams) bool {
+		claimed, err := repo.ClaimWebhookEvent(context.Background(), params)
+		require.NoError(t, err)
+		return claimed
+	}
+
+	require.True(t, claim(params))
+	// a redelivery that arrives while the first one is being processed is ignored
+	require.False(t, claim(params))
+
+	// the claim is given up when the processing fails , the next delivery is processed
+	require.NoError(t, repo.ReleaseWebhookEvent(context.Background(), params.EventID))
+	require.True(t, claim(params))
+
+	// a claim that is older than ClaimedBefore has been abandoned
+	abandoned := params
+	abandoned.ClaimedBefore = time.Now().Add(time.Minute)
+	require.True(t, claim(abandoned))
+
+	require.NoError(t, repo.MarkWebhookEventProcessed(context.Background(), params.EventID))
+	require.NoError(t, repo.ReleaseWebhookEvent(context.Background(), params.EventID))
+	require.False(t, claim(abandoned))
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+)
+
+type UpsertPayoutAccountParams struct {
+	DoctorID       int64
+	SubaccountCode string
+	BusinessName   string
+	BankCode       string
+	SettlementBank string
+	// only the last digits of the account number are stored
+	AccountNumberLast4 string
+}
+type ListEarningsParams struct {
+	DoctorID int64
+	// the range is [From , To)
+	From   time.Time
+	To     time.Time
+	Limit  int32
+	Offset int32
+}
+type ListPayoutsParams struct {
+	From   time.Time
+	To     time.Time
+	Limit  int32
+	Offset int32
+}
+
+// PayoutRepository holds the doctors' payout accounts and the ledger of what they earned ,
+// the ledger entries themselves are made with the payment and refund updates
+type PayoutRepository interface {
+	UpsertAccount(ctx context.Context, params UpsertPayoutAccountParams) (*database.DoctorPayoutAccount, error)
+	GetAccount(ctx context.Context, doctorId int64) (*database.DoctorPayoutAccount, error)
+	ListEarnings(ctx context.Context, params ListEarningsParams) ([]database.DoctorEarning, error)
+	GetEarningsSummary(ctx context.Context, doctorId int64, from, to time.Time) (*database.GetDoctorEarningsSummaryRow, error)
+	ListPayouts(ctx context.Context, params ListPayoutsParams) ([]database.ListDoctorPayoutsRow, error)
+}
+
+type payoutRepository struct {
+	store *database.Store
+}
+
+func NewPayoutRepository(store *database.Store) PayoutRepository {
+	return &payoutRepository{
+		store,
+	}
+}
+
+func (r *payoutRepository) UpsertAccount(ctx context.Context, params UpsertPayoutAccountParams) (*database.DoctorPayoutAccount, error) {
+	account, err := r.store.UpsertDoctorPayoutAccount(ctx, database.UpsertDoctorPayoutAccountParams{
+		DoctorID:           params.DoctorID,
+		SubaccountCode:     params.SubaccountCode,
+		BusinessName:       params.BusinessName,
+		BankCode:           params.BankCode,
+		SettlementBank:     params.SettlementBank,
+		AccountNumberLast4: params.AccountNumberLast4,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (r *payoutRepository) GetAccount(ctx context.Context, doctorId int64) (*database.DoctorPayoutAccount, error) {
+	account, err := r.store.GetDoctorPayoutAccount(ctx, doctorId)
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (r *payoutRepository) ListEarnings(ctx context.Context, params ListEarningsParams) ([]database.DoctorEarning, error) {
+	return r.store.ListDoctorEarnings(ctx, database.ListDoctorEarningsParams{
+		DoctorID:    params.DoctorID,
+		CreatedFrom: params.From,
+		CreatedTo:   params.To,
+		SetLimit:    params.Limit,
+		SetOffset:   params.Offset,
+	})
+}
+
+func (r *payoutRepository) GetEarningsSummary(ctx context.Context, doctorId int64, from, to time.Time) (*database.GetDoctorEarningsSummaryRow, error) {
+	summary, err := r.store.GetDoctorEarningsSummary(ctx, database.GetDoctorEarningsSummaryParams{
+		DoctorID:    doctorId,
+		CreatedFrom: from,
+		CreatedTo:   to,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+func (r *payoutRepository) ListPayouts(ctx context.Context, params ListPayoutsParams) ([]database.ListDoctorPayoutsRow, error) {
+	return r.store.ListDoctorPayouts(ctx, database.ListDoctorPayoutsParams{
+		CreatedFrom: params.From,
+		CreatedTo:   params.To,
+		SetLimit:    params.Limit,
+		SetOffset:   params.Offset,
+	})
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoctorEarningsLedger(t *testing.T) {
+	doctor := createRandomVerifiedDoctor(t)
+	patient := createRandomPatient(t)
+	startTime := time.Now().UTC().AddDate(0, 0, 9).Truncate(24 * time.Hour).Add(10 * time.Hour)
+	_, err := NewAvailabilityRepository(store).Create(context.Background(), CreateAvailabilityParams{
+		DoctorID:        doctor.DoctorID,
+		DayOfWeek:       int32(startTime.Weekday()),
+		StartTime:       "08:00",
+		EndTime:         "17:00",
+		IntervalMinutes: 30,
+	})
+	require.NoError(t, err)
+
+	payoutRepo := NewPayoutRepository(store)
+	account, err := payoutRepo.UpsertAccount(context.Background(), UpsertPayoutAccountParams{
+		DoctorID:           doctor.DoctorID,
+		SubaccountCode:     "ACCT_" + util.RandString(10),
+		BusinessName:       "Dr. " + util.RandString(8),
+		BankCode:           "68",
+		SettlementBank:     "Equity Bank",
+		AccountNumberLast4: "1234",
+	})
+	require.NoError(t, err)
+
+	reference := util.RandString(16)
+	booking, err := NewAppointmentRepository(store).CreateAppointmentWithPayment(context.Background(), CreateAppointmentWithPaymentParams{
+		DoctorID:        doctor.DoctorID,
+		PatientID:       patient.PatientID,
+		StartTime:       startTime,
+		EndTime:         startTime.Add(30 * time.Minute),
+		Reason:          util.RandString(20),
+		Reference:       reference,
+		Amount:          "1200.00",
+		ConsultationFee: "1000.00",
+		PlatformFee:     "100.00",
+		Tax:             "100.00",
+		PaymentMethod:   "paystack",
+		SubaccountCode:  account.SubaccountCode,
+	})
+	require.NoError(t, err)
+
+	// the success is delivered twice , the doctor is only credited once
+	paymentRepo := NewPaymentRepository(store)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, paymentRepo.UpdatePaymentAndAppointmentStatus(context.Background(), UpdatePaymentAndAppointmentStatusParams{
+			Reference:     reference,
+			PaymentStatus: string(database.PaymentStatusCompleted),
+		}))
+	}
+	from, to := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	summary, err := payoutRepo.GetEarningsSummary(context.Background(), doctor.DoctorID, from, to)
+	require.NoError(t, err)
+	require.Equal(t, "1200.00", summary.GrossAmount)
+	require.Equal(t, "200.00", summary.Commission)
+	require.Equal(t, "1000.00", summary.NetAmount)
+	require.Equal(t, "1000.00", summary.SettledAmount)
+	require.Equal(t, "0.00", summary.OwedAmount)
+
+	// half of the payment is refunded , the doctor gives up half of their share
+	refund, err := NewAppointmentRepository(store).CancelAppointmentWithRefund(context.Background(), CancelAppointmentWithRefundParams{
+		Cancellation: UpdateAppointmentStatusParams{
+			AppointmentID: booking.Appointment.AppointmentID,
+			From:          database.AppointmentStatusPendingPayment,
+			To:            database.AppointmentStatusCancelled,
+			Actor:         "patient",
+			ChangedBy:     patient.UserID,
+			Reason:        "changed my mind",
+		},
+		PaymentID:      booking.Payment.PaymentID,
+		PaymentStatus:  database.PaymentStatusPartiallyRefunded,
+		Amount:         "600.00",
+		Currency:       "KES",
+		IdempotencyKey: fmt.Sprintf("appointment_%d_cancellation", booking.Appointment.AppointmentID),
+	})
+	require.NoError(t, err)
+	require.Equal(t, RefundStatusPending, refund.ProviderStatus)
+	require.Empty(t, refund.ProviderRefundID)
+	// the refund is sent to the provider once the cancellation has been committed
+	refund, err = paymentRepo.RecordRefundResult(context.Background(), RecordRefundResultParams{
+		RefundID:         refund.RefundID,
+		ProviderRefundID: "3018284",
+		ProviderStatus:   "pending",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "3018284", refund.ProviderRefundID)
+	summary, err = payoutRepo.GetEarningsSummary(context.Background(), doctor.DoctorID, from, to)
+	require.NoError(t, err)
+	require.Equal(t, "600.00", summary.GrossAmount)
+	require.Equal(t, "500.00", summary.NetAmount)
+
+	// the refund failed , the doctor keeps all of their share
+	_, err = paymentRepo.UpdateRefundStatus(context.Background(), UpdateRefundStatusParams{
+		Reference:        reference,
+		ProviderRefundID: refund.ProviderRefundID,
+		ProviderStatus:   "failed",
+		PaymentStatus:    string(database.PaymentStatusCompleted),
+	})
+	require.NoError(t, err)
+	entries, err := payoutRepo.ListEarnings(context.Background(), ListEarningsParams{DoctorID: doctor.DoctorID, From: from, To: to, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, database.EarningEntryTypeRefundReversal, entries[0].EntryType)
+	summary, err = payoutRepo.GetEarningsSummary(context.Background(), doctor.DoctorID, from, to)
+	require.NoError(t, err)
+	require.Equal(t, "1000.00", summary.NetAmount)
+
+	payouts, err := payoutRepo.ListPayouts(context.Background(), ListPayoutsParams{From: from, To: to, Limit: 1000})
+	require.NoError(t, err)
+	var found bool
+	for _, payout := range payouts {
+		if payout.DoctorID == doctor.DoctorID {
+			found = true
+			require.Equal(t, int64(1), payout.Payments)
+			require.Equal(t, account.SubaccountCode, payout.SubaccountCode)
+		}
+	}
+	require.True(t, found)
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+)
+
+type CreateReconciliationItemParams struct {
+	RunID          int64
+	PaymentID      int64
+	Reference      string
+	Outcome        string
+	ProviderStatus string
+	ExpectedAmount string
+	// empty when the provider couldn't be reached
+	ProviderAmount   string
+	ExpectedCurrency string
+	ProviderCurrency string
+	Detail           string
+}
+type FinishReconciliationRunParams struct {
+	RunID      int64
+	Checked    int32
+	Updated    int32
+	Mismatched int32
+	Failed     int32
+}
+type ReconciliationRepository interface {
+	ListStalePendingPayments(ctx context.Context, createdBefore time.Time, limit int32) ([]database.Payment, error)
+	StartRun(ctx context.Context) (*database.ReconciliationRun, error)
+	FinishRun(ctx context.Context, params FinishReconciliationRunParams) (*database.ReconciliationRun, error)
+	CreateItem(ctx context.Context, params CreateReconciliationItemParams) (*database.ReconciliationItem, error)
+	// FlagMismatch records a mismatch that was found outside of a reconciliation run (e.g. in a webhook) as a run of its own ,
+	// it shows up in the reports and the payment is left to the admins like the mismatches the reconciler finds. RunID is ignored
+	FlagMismatch(ctx context.Context, params CreateReconciliationItemParams) (*database.ReconciliationItem, error)
+	ListRuns(ctx context.Context, limit, offset int32) ([]database.ReconciliationRun, error)
+	GetRun(ctx context.Context, runId int64) (*database.ReconciliationRun, error)
+	ListItems(ctx context.Context, runId int64) ([]database.ReconciliationItem, error)
+}
+
+type reconciliationRepository struct {
+	store *database.Store
+}
+
+func NewReconciliationRepository(store *database.Store) ReconciliationRepository {
+	return &reconciliationRepository{
+		store,
+	}
+}
+
+func (r *reconciliationRepository) ListStalePendingPayments(ctx context.Context, createdBefore time.Time, limit int32) ([]database.Payment, error) {
+	return r.store.ListStalePendingPayments(ctx, database.ListStalePendingPaymentsParams{
+		CreatedBefore: createdBefore,
+		SetLimit:      limit,
+	})
+}
+
+func (r *reconciliationRepository) StartRun(ctx context.Context) (*database.ReconciliationRun, error) {
+	run, err := r.store.CreateReconciliationRun(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (r *reconciliationRepository) FinishRun(ctx context.Context, params FinishReconciliationRunParams) (*database.ReconciliationRun, error) {
+	run, err := r.store.FinishReconciliationRun(ctx, database.FinishReconciliationRunParams{
+		RunID:      params.RunID,
+		Checked:    params.Checked,
+		Updated:    params.Updated,
+		Mismatched: params.Mismatched,
+		Failed:     params.Failed,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (r *reconciliationRepository) CreateItem(ctx context.Context, params CreateReconciliationItemParams) (*database.ReconciliationItem, error) {
+	item, err := r.store.CreateReconciliationItem(ctx, database.CreateReconciliationItemParams{
+		RunID:            params.RunID,
+		PaymentID:        params.PaymentID,
+		Reference:        params.Reference,
+		Outcome:          params.Outcome,
+		ProviderStatus:   params.ProviderStatus,
+		ExpectedAmount:   params.ExpectedAmount,
+		ProviderAmount:   sql.NullString{String: params.ProviderAmount, Valid: params.ProviderAmount != ""},
+		ExpectedCurrency: params.ExpectedCurrency,
+		ProviderCurrency: params.ProviderCurrency,
+		Detail:           params.Detail,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (r *reconciliationRepository) FlagMismatch(ctx context.Context, params CreateReconciliationItemParams) (*database.ReconciliationItem, error) {
+	var item database.ReconciliationItem
+	err := r.store.ExecTx(ctx, func(q *database.Queries) error {
+		run, err := q.CreateReconciliationRun(ctx)
+		if err != nil {
+			return err
+		}
+		item, err = q.CreateReconciliationItem(ctx, database.CreateReconciliationItemParams{
+			RunID:            run.RunID,
+			PaymentID:        params.PaymentID,
+			Reference:        params.Reference,
+			Outcome:          params.Outcome,
+			ProviderStatus:   params.ProviderStatus,
+			ExpectedAmount:   params.ExpectedAmount,
+			ProviderAmount:   sql.NullString{String: params.ProviderAmount, Valid: params.ProviderAmount != ""},
+			ExpectedCurrency: params.ExpectedCurrency,
+			ProviderCurrency: params.ProviderCurrency,
+			Detail:           params.Detail,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = q.FinishReconciliationRun(ctx, database.FinishReconciliationRunParams{
+			RunID:      run.RunID,
+			Checked:    1,
+			Mismatched: 1,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (r *reconciliationRepository) ListRuns(ctx context.Context, limit, offset int32) ([]database.ReconciliationRun, error) {
+	return r.store.ListReconciliationRuns(ctx, database.ListReconciliationRunsParams{
+		SetLimit:  limit,
+		SetOffset: offset,
+	})
+}
+
+func (r *reconciliationRepository) GetRun(ctx context.Context, runId int64) (*database.ReconciliationRun, error) {
+	run, err := r.store.GetReconciliationRun(ctx, runId)
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (r *reconciliationRepository) ListItems(ctx context.Context, runId int64) ([]database.ReconciliationItem, error) {
+	return r.store.ListReconciliationItems(ctx, runId)
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mbeka02/lyra_backend/internal/database"
+)
+
+type CreateSessionParams struct {
+	SessionID      uuid.UUID
+	UserID         int64
+	RefreshTokenID uuid.UUID
+	UserAgent      string
+	ClientIP       string
+	ExpiresAt      time.Time
+}
+
+type RotateSessionParams struct {
+	SessionID             uuid.UUID
+	CurrentRefreshTokenID uuid.UUID
+	NewRefreshTokenID     uuid.UUID
+	ExpiresAt             time.Time
+}
+
+type SessionRepository interface {
+	Create(ctx context.Context, params CreateSessionParams) (*database.Session, error)
+	GetById(ctx context.Context, sessionId uuid.UUID) (*database.Session, error)
+	// GetForAuth returns the session together with the owner's last password change
+	GetForAuth(ctx context.Context, sessionId uuid.UUID) (*database.GetSessionForAuthRow, error)
+	// Rotate swaps the refresh token id only if the presented one is still the current one, it returns sql.ErrNoRows otherwise
+	Rotate(ctx context.Context, params RotateSessionParams) (*database.Session, error)
+	Revoke(ctx context.Context, sessionId uuid.UUID) error
+	RevokeAllForUser(ctx context.Context, userId int64) error
+}
+
+type sessionRepository struct {
+	store *database.Store
+}
+
+func NewSessionRepository(store *database.Store) SessionRepository {
+	return &sessionRepository{
+		store,
+	}
+}
+
+func (r *sessionRepository) Create(ctx context.Context, params CreateSessionParams) (*database.Session, error) {
+	session, err := r.store.CreateSession(ctx, database.CreateSessionParams{
+		SessionID:      params.SessionID,
+		UserID:         params.UserID,
+		RefreshTokenID: params.RefreshTokenID,
+		UserAgent:      params.UserAgent,
+		ClientIp:       params.ClientIP,
+		ExpiresAt:      params.ExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *sessionRepository) GetById(ctx context.Context, sessionId uuid.UUID) (*database.Session, error) {
+	session, err := r.store.GetSession(ctx, sessionId)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *sessionRepository) GetForAuth(ctx context.Context, sessionId uuid.UUID) (*database.GetSessionForAuthRow, error) {
+	session, err := r.store.GetSessionForAuth(ctx, sessionId)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *sessionRepository) Rotate(ctx context.Context, params RotateSessionParams) (*database.Session, error) {
+	session, err := r.store.RotateSessionRefreshToken(ctx, database.RotateSessionRefreshTokenParams{
+		SessionID:             params.SessionID,
+		CurrentRefreshTokenID: params.CurrentRefreshTokenID,
+		NewRefreshTokenID:     params.NewRefreshTokenID,
+		ExpiresAt:             params.ExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *sessionRepository) Revoke(ctx context.Context, sessionId uuid.UUID) error {
+	return r.store.RevokeSession(ctx, sessionId)
+}
+
+func (r *sessionRepository) RevokeAllForUser(ctx context.Context, userId int64) error {
+	return r.store.RevokeUserSessions(ctx, userId)
+}
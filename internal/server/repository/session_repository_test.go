@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomSession(t *testing.T, userId int64) *database.Session {
+	repo := NewSessionRepository(store)
+	params := CreateSessionParams{
+		SessionID:      uuid.New(),
+		UserID:         userId,
+		RefreshTokenID: uuid.New(),
+		UserAgent:      "lyra-test",
+		ClientIP:       "127.0.0.1",
+		ExpiresAt:      time.Now().Add(time.Hour),
+	}
+	session, err := repo.Create(context.Background(), params)
+	require.NoError(t, err)
+	require.Equal(t, params.SessionID, session.SessionID)
+	require.Equal(t, params.RefreshTokenID, session.RefreshTokenID)
+	require.False(t, session.IsRevoked)
+	return session
+}
+
+func TestRotateSession(t *testing.T) {
+	user := createRandomUser(t)
+	session := createRandomSession(t, user.UserID)
+	repo := NewSessionRepository(store)
+
+	newTokenId := uuid.New()
+	rotated, err := repo.Rotate(context.Background(), RotateSessionParams{
+		SessionID:             session.SessionID,
+		CurrentRefreshTokenID: session.RefreshTokenID,
+		NewRefreshTokenID:     newTokenId,
+		ExpiresAt:             time.Now().Add(2 * time.Hour),
+	})
+	require.NoError(t, err)
+	require.Equal(t, newTokenId, rotated.RefreshTokenID)
+
+	// the old refresh token id is no longer current so it can't be rotated again
+	_, err = repo.Rotate(context.Background(), RotateSessionParams{
+		SessionID:             session.SessionID,
+		CurrentRefreshTokenID: session.RefreshTokenID,
+		NewRefreshTokenID:     uuid.New(),
+		ExpiresAt:             time.Now().Add(2 * time.Hour),
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestRevokeSession(t *testing.T) {
+	user := createRandomUser(t)
+	session := createRandomSession(t, user.UserID)
+	repo := NewSessionRepository(store)
+
+	require.NoError(t, repo.Revoke(context.Background(), session.SessionID))
+	revoked, err := repo.GetById(context.Background(), session.SessionID)
+	require.NoError(t, err)
+	require.True(t, revoked.IsRevoked)
+	require.True(t, revoked.RevokedAt.Valid)
+
+	// a revoked session can't be rotated
+	_, err = repo.Rotate(context.Background(), RotateSessionParams{
+		SessionID:             session.SessionID,
+		CurrentRefreshTokenID: session.RefreshTokenID,
+		NewRefreshTokenID:     uuid.New(),
+		ExpiresAt:             time.Now().Add(time.Hour),
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestRevokeAllSessionsForUser(t *testing.T) {
+	user := createRandomUser(t)
+	first := createRandomSession(t, user.UserID)
+	second := createRandomSession(t, user.UserID)
+	repo := NewSessionRepository(store)
+
+	require.NoError(t, repo.RevokeAllForUser(context.Background(), user.UserID))
+	for _, id := range []uuid.UUID{first.SessionID, second.SessionID} {
+		session, err := repo.GetById(context.Background(), id)
+		require.NoError(t, err)
+		require.True(t, session.IsRevoked)
+	}
+}
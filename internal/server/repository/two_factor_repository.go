@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+)
+
+type EnableTwoFactorParams struct {
+	UserID int64
+	// the TOTP step of the code used to confirm enrolment
+	Step               int64
+	RecoveryCodeHashes []string
+}
+
+type TwoFactorRepository interface {
+	Get(ctx context.Context, userId int64) (*database.UserTwoFactor, error)
+	// StartEnrollment saves a pending secret , it returns sql.ErrNoRows if 2FA is already enabled
+	StartEnrollment(ctx context.Context, userId int64, secretCiphertext string) (*database.UserTwoFactor, error)
+	// Enable turns on 2FA and replaces the user's recovery codes
+	Enable(ctx context.Context, params EnableTwoFactorParams) error
+	// UseStep marks a TOTP step as used , it returns sql.ErrNoRows if the code is being replayed
+	UseStep(ctx context.Context, userId int64, step int64) error
+	// UseRecoveryCode consumes a recovery code , it returns sql.ErrNoRows if there is no unused code with this hash
+	UseRecoveryCode(ctx context.Context, userId int64, codeHash string) error
+	Disable(ctx context.Context, userId int64) error
+}
+
+type twoFactorRepository struct {
+	store *database.Store
+}
+
+func NewTwoFactorRepository(store *database.Store) TwoFactorRepository {
+	return &twoFactorRepository{
+		store,
+	}
+}
+
+func (r *twoFactorRepository) Get(ctx context.Context, userId int64) (*database.UserTwoFactor, error) {
+	twoFactor, err := r.store.GetUserTwoFactor(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	return &twoFactor, nil
+}
+
+func (r *twoFactorRepository) StartEnrollment(ctx context.Context, userId int64, secretCiphertext string) (*database.UserTwoFactor, error) {
+	twoFactor, err := r.store.UpsertPendingTwoFactor(ctx, database.UpsertPendingTwoFactorParams{
+		UserID:           userId,
+		SecretCiphertext: secretCiphertext,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &twoFactor, nil
+}
+
+func (r *twoFactorRepository) Enable(ctx context.Context, params EnableTwoFactorParams) error {
+	return r.store.ExecTx(ctx, func(q *database.Queries) error {
+		err := q.EnableTwoFactor(ctx, database.EnableTwoFactorParams{
+			UserID:       params.UserID,
+			LastUsedStep: params.Step,
+		})
+		if err != nil {
+			return err
+		}
+		if err := q.DeleteRecoveryCodes(ctx, params.UserID); err != nil {
+			return err
+		}
+		for _, hash := range params.RecoveryCodeHashes {
+			err := q.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+				UserID:   params.UserID,
+				CodeHash: hash,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *twoFactorRepository) UseStep(ctx context.Context, userId int64, step int64) error {
+	_, err := r.store.UseTwoFactorStep(ctx, database.UseTwoFactorStepParams{
+		UserID:       userId,
+		LastUsedStep: step,
+	})
+	return err
+}
+
+func (r *twoFactorRepository) UseRecoveryCode(ctx context.Context, userId int64, codeHash string) error {
+	_, err := r.store.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+		UserID:   userId,
+		CodeHash: codeHash,
+	})
+	return err
+}
+
+func (r *twoFactorRepository) Disable(ctx context.Context, userId int64) error {
+	return r.store.ExecTx(ctx, func(q *database.Queries) error {
+		if err := q.DeleteRecoveryCodes(ctx, userId); err != nil {
+			return err
+		}
+		return q.DeleteTwoFactor(ctx, userId)
+	})
+}
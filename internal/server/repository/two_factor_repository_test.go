@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/mbeka02/lyra_backend/internal/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwoFactorEnrollment(t *testing.T) {
+	user := createRandomUser(t)
+	repo := NewTwoFactorRepository(store)
+
+	pending, err := repo.StartEnrollment(context.Background(), user.UserID, "ciphertext")
+	require.NoError(t, err)
+	require.False(t, pending.EnabledAt.Valid)
+
+	// enrolment can be restarted until it is confirmed
+	_, err = repo.StartEnrollment(context.Background(), user.UserID, "other-ciphertext")
+	require.NoError(t, err)
+
+	recoveryHash := util.RandString(64)
+	err = repo.Enable(context.Background(), EnableTwoFactorParams{
+		UserID:             user.UserID,
+		Step:               100,
+		RecoveryCodeHashes: []string{recoveryHash, util.RandString(64)},
+	})
+	require.NoError(t, err)
+
+	enabled, err := repo.Get(context.Background(), user.UserID)
+	require.NoError(t, err)
+	require.True(t, enabled.EnabledAt.Valid)
+	require.Equal(t, "other-ciphertext", enabled.SecretCiphertext)
+
+	// an enabled secret can't be replaced
+	_, err = repo.StartEnrollment(context.Background(), user.UserID, "attacker-ciphertext")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// codes can't be replayed
+	require.ErrorIs(t, repo.UseStep(context.Background(), user.UserID, 100), sql.ErrNoRows)
+	require.NoError(t, repo.UseStep(context.Background(), user.UserID, 101))
+	require.ErrorIs(t, repo.UseStep(context.Background(), user.UserID, 101), sql.ErrNoRows)
+
+	// recovery codes are single use
+	require.NoError(t, repo.UseRecoveryCode(context.Background(), user.UserID, recoveryHash))
+	require.ErrorIs(t, repo.UseRecoveryCode(context.Background(), user.UserID, recoveryHash), sql.ErrNoRows)
+
+	require.NoError(t, repo.Disable(context.Background(), user.UserID))
+	_, err = repo.Get(context.Background(), user.UserID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
@@ -22,12 +22,38 @@ type UpdateUserParams struct {
 	TelephoneNumber string
 	UserId          int64
 }
+type CreatePasswordResetTokenParams struct {
+	UserID    int64
+	TokenHash string
+	ExpiresAt time.Time
+}
+type ResetPasswordParams struct {
+	TokenHash string
+	Password  string
+	ChangedAt time.Time
+}
+type UpdatePasswordParams struct {
+	UserID    int64
+	Password  string
+	ChangedAt time.Time
+}
 type UserRepository interface {
 	Create(ctx context.Context, params CreateUserParams) (*database.User, error)
 	GetByEmail(ctx context.Context, email string) (*database.User, error)
 	GetById(ctx context.Context, id int64) (*database.User, error)
 	Update(ctx context.Context, params UpdateUserParams) error
 	UpdateProfilePicture(ctx context.Context, profilePictureURL string, userId int64) error
+	// MarkVerificationEmailSent records that a verification email is being sent, it returns sql.ErrNoRows if the user is
+	// already verified or the previous email was sent after sentBefore
+	MarkVerificationEmailSent(ctx context.Context, userId int64, sentBefore time.Time) (*database.User, error)
+	VerifyEmail(ctx context.Context, userId int64, email string) error
+	// CreatePasswordResetToken stores a new reset token and invalidates any that were issued before it
+	CreatePasswordResetToken(ctx context.Context, params CreatePasswordResetTokenParams) error
+	// ResetPassword consumes the reset token , sets the new password and revokes all the user's sessions.
+	// It returns sql.ErrNoRows if the token is unknown , used or expired
+	ResetPassword(ctx context.Context, params ResetPasswordParams) (int64, error)
+	// UpdatePassword sets the new password and revokes all the user's sessions
+	UpdatePassword(ctx context.Context, params UpdatePasswordParams) error
 }
 
 type userRepository struct {
@@ -86,3 +112,73 @@ func (r *userRepository) GetById(ctx context.Context, userId int64) (*database.U
 	}
 	return &user, nil
 }
+
+func (r *userRepository) MarkVerificationEmailSent(ctx context.Context, userId int64, sentBefore time.Time) (*database.User, error) {
+	user, err := r.store.MarkVerificationEmailSent(ctx, database.MarkVerificationEmailSentParams{
+		UserID:     userId,
+		SentBefore: sentBefore,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *userRepository) VerifyEmail(ctx context.Context, userId int64, email string) error {
+	return r.store.VerifyUserEmail(ctx, database.VerifyUserEmailParams{
+		UserID: userId,
+		Email:  email,
+	})
+}
+
+func (r *userRepository) CreatePasswordResetToken(ctx context.Context, params CreatePasswordResetTokenParams) error {
+	return r.store.ExecTx(ctx, func(q *database.Queries) error {
+		if err := q.InvalidatePasswordResetTokens(ctx, params.UserID); err != nil {
+			return err
+		}
+		return q.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+			UserID:    params.UserID,
+			TokenHash: params.TokenHash,
+			ExpiresAt: params.ExpiresAt,
+		})
+	})
+}
+
+func (r *userRepository) ResetPassword(ctx context.Context, params ResetPasswordParams) (int64, error) {
+	var userId int64
+	err := r.store.ExecTx(ctx, func(q *database.Queries) error {
+		token, err := q.ConsumePasswordResetToken(ctx, params.TokenHash)
+		if err != nil {
+			return err
+		}
+		userId = token.UserID
+		return updatePassword(ctx, q, UpdatePasswordParams{
+			UserID:    token.UserID,
+			Password:  params.Password,
+			ChangedAt: params.ChangedAt,
+		})
+	})
+	return userId, err
+}
+
+func (r *userRepository) UpdatePassword(ctx context.Context, params UpdatePasswordParams) error {
+	return r.store.ExecTx(ctx, func(q *database.Queries) error {
+		return updatePassword(ctx, q, params)
+	})
+}
+
+func updatePassword(ctx context.Context, q *database.Queries, params UpdatePasswordParams) error {
+	err := q.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+		Password:          params.Password,
+		PasswordChangedAt: params.ChangedAt,
+		UserID:            params.UserID,
+	})
+	if err != nil {
+		return err
+	}
+	// outstanding reset links and every logged in device stop working once the password changes
+	if err := q.InvalidatePasswordResetTokens(ctx, params.UserID); err != nil {
+		return err
+	}
+	return q.RevokeUserSessions(ctx, params.UserID)
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"testing"
 	"time"
 
@@ -68,3 +69,91 @@ func TestGetUserById(t *testing.T) {
 
 	require.WithinDuration(t, randomUser.CreatedAt, user.CreatedAt, time.Second)
 }
+
+func TestMarkVerificationEmailSent(t *testing.T) {
+	randomUser := createRandomUser(t)
+	repo := NewUserRepository(store)
+
+	user, err := repo.MarkVerificationEmailSent(context.Background(), randomUser.UserID, time.Now())
+	require.NoError(t, err)
+	require.True(t, user.VerificationSentAt.Valid)
+
+	// a second email inside the resend interval is throttled
+	_, err = repo.MarkVerificationEmailSent(context.Background(), randomUser.UserID, time.Now().Add(-time.Minute))
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	require.NoError(t, repo.VerifyEmail(context.Background(), randomUser.UserID, randomUser.Email))
+	verified, err := repo.GetById(context.Background(), randomUser.UserID)
+	require.NoError(t, err)
+	require.True(t, verified.VerifiedAt.Valid)
+
+	// verified users don't get any more emails
+	_, err = repo.MarkVerificationEmailSent(context.Background(), randomUser.UserID, time.Now().Add(time.Hour))
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestResetPasswordTokenIsSingleUse(t *testing.T) {
+	randomUser := createRandomUser(t)
+	repo := NewUserRepository(store)
+	session := createRandomSession(t, randomUser.UserID)
+
+	err := repo.CreatePasswordResetToken(context.Background(), CreatePasswordResetTokenParams{
+		UserID:    randomUser.UserID,
+		TokenHash: util.RandString(64),
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	tokenHash := util.RandString(64)
+	// issuing a new token invalidates the previous one
+	err = repo.CreatePasswordResetToken(context.Background(), CreatePasswordResetTokenParams{
+		UserID:    randomUser.UserID,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	changedAt := time.Now().Truncate(time.Microsecond)
+	userId, err := repo.ResetPassword(context.Background(), ResetPasswordParams{
+		TokenHash: tokenHash,
+		Password:  "myNewSuperDuperSecretPassword",
+		ChangedAt: changedAt,
+	})
+	require.NoError(t, err)
+	require.Equal(t, randomUser.UserID, userId)
+
+	user, err := repo.GetById(context.Background(), randomUser.UserID)
+	require.NoError(t, err)
+	require.Equal(t, "myNewSuperDuperSecretPassword", user.Password)
+	require.WithinDuration(t, changedAt, user.PasswordChangedAt, time.Microsecond)
+
+	// the user's sessions are revoked
+	revoked, err := NewSessionRepository(store).GetById(context.Background(), session.SessionID)
+	require.NoError(t, err)
+	require.True(t, revoked.IsRevoked)
+
+	_, err = repo.ResetPassword(context.Background(), ResetPasswordParams{
+		TokenHash: tokenHash,
+		Password:  "anotherSuperDuperSecretPassword",
+		ChangedAt: time.Now(),
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestExpiredPasswordResetToken(t *testing.T) {
+	randomUser := createRandomUser(t)
+	repo := NewUserRepository(store)
+	tokenHash := util.RandString(64)
+	err := repo.CreatePasswordResetToken(context.Background(), CreatePasswordResetTokenParams{
+		UserID:    randomUser.UserID,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	require.NoError(t, err)
+
+	_, err = repo.ResetPassword(context.Background(), ResetPasswordParams{
+		TokenHash: tokenHash,
+		Password:  "myNewSuperDuperSecretPassword",
+		ChangedAt: time.Now(),
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
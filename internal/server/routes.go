@@ -9,6 +9,7 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/go-chi/httprate"
+	"github.com/mbeka02/lyra_backend/internal/auth"
 	m "github.com/mbeka02/lyra_backend/internal/server/middleware"
 )
 
@@ -40,6 +41,20 @@ func (s *Server) RegisterRoutes() http.Handler {
 	r.Get("/health", s.healthHandler)
 	r.Post("/register", s.handlers.User.HandleCreateUser)
 	r.Post("/login", s.handlers.User.HandleLogin)
+	// second step of the login for users with two factor authentication
+	r.Post("/login/2fa/verify", s.handlers.TwoFactor.HandleVerifyLogin)
+	r.Post("/login/2fa/enroll", s.handlers.TwoFactor.HandleBeginLoginEnrollment)
+	r.Post("/token/refresh", s.handlers.User.HandleRefreshToken)
+	r.Get("/verify-email", s.handlers.User.HandleVerifyEmail)
+	r.Post("/password/forgot", s.handlers.User.HandleForgotPassword)
+	r.Post("/password/reset", s.handlers.User.HandleResetPassword)
+	// opened from the link emailed when an account is locked
+	r.Post("/login/unlock", s.handlers.User.HandleUnlockAccount)
+	// calendar apps subscribe to the feed without logging in , the secret token in the URL identifies the user
+	r.Get("/calendar/{feed}", s.handlers.Calendar.HandleGetFeed)
+	// logging out needs a valid access token so that only the owner of the session can revoke it
+	r.With(m.AuthMiddleware(s.opts.AuthMaker, s.services.Session)).Post("/logout", s.handlers.User.HandleLogout)
+	r.With(m.AuthMiddleware(s.opts.AuthMaker, s.services.Session)).Post("/logout/all", s.handlers.User.HandleLogoutAll)
 
 	// API versioning - all API endpoints under /api/v1
 	r.Route("/api/v1", func(r chi.Router) {
@@ -47,94 +62,180 @@ func (s *Server) RegisterRoutes() http.Handler {
 		r.Route("/payments", func(r chi.Router) {
 			r.Post("/webhook", s.handlers.Payment.PaymentWebhook)
 			r.Get("/callback", s.handlers.Payment.PaymentCallback)
+			// daraja sends the results of STK pushes and refunds here , the request carries the callback token
+			r.Post("/mpesa/callback", s.handlers.Payment.MpesaCallback)
 		})
 
 		// Protected routes
 		r.Group(func(r chi.Router) {
 			// Apply authentication middleware to all routes in this group
-			r.Use(m.AuthMiddleware(s.opts.AuthMaker))
+			r.Use(m.AuthMiddleware(s.opts.AuthMaker, s.services.Session))
+			// attributes the audit events recorded while serving the request
+			r.Use(m.RequestAuditInfo)
 
 			// User endpoints
 			r.Route("/users", func(r chi.Router) {
 				r.Get("/me", s.handlers.User.HandleGetUser)
 				r.Patch("/me", s.handlers.User.HandleUpdateUser)
 				r.Patch("/me/profile-picture", s.handlers.User.HandleProfilePicture)
+				r.Patch("/me/password", s.handlers.User.HandleChangePassword)
+				// two factor authentication
+				r.Post("/me/2fa/enroll", s.handlers.TwoFactor.HandleBeginEnrollment)
+				r.Post("/me/2fa/confirm", s.handlers.TwoFactor.HandleConfirmEnrollment)
+				r.Post("/me/2fa/disable", s.handlers.TwoFactor.HandleDisable)
+				r.Post("/me/verify-email/resend", s.handlers.User.HandleResendVerificationEmail)
+				// the ICS subscription URL of the user's scheduled appointments , creating it again replaces the old one
+				r.Post("/me/calendar-feed", s.handlers.Calendar.HandleCreateFeed)
+				r.Delete("/me/calendar-feed", s.handlers.Calendar.HandleDeleteFeed)
 			})
 
 			// Patient endpoints
 			r.Route("/patients", func(r chi.Router) {
-				r.Post("/", s.handlers.Patient.HandleCreatePatient)
-				r.Get("/appointments", s.handlers.Appointment.HandleGetPatientAppointments)
-				r.Get("/{patientId}", s.handlers.Patient.HandleGetPatient)
-				// allergies
-				r.Route("/{patientId}/allergies", func(r chi.Router) {
-					r.Post("/", s.handlers.Allergy.HandleCreateAllergy)
-					r.Get("/", s.handlers.Allergy.HandleListAllergies)
-					r.Route("/{allergyId}", func(r chi.Router) {
-						r.Get("/", s.handlers.Allergy.HandleGetAllergy)
-						r.Put("/", s.handlers.Allergy.HandleUpdateAllergy)
-						r.Delete("/", s.handlers.Allergy.HandleDeleteAllergy)
+				r.With(m.RequirePermission(auth.PermissionPatientsOnboard)).Post("/", s.handlers.Patient.HandleCreatePatient)
+				r.With(m.RequirePermission(auth.PermissionAppointmentsBook)).Get("/appointments", s.handlers.Appointment.HandleGetPatientAppointments)
+				// who has accessed the patient's record
+				r.With(m.RequirePermission(auth.PermissionAccessLogRead)).Get("/access-log", s.handlers.Audit.HandleListRecordAccesses)
+				// every route under a patient goes through the access policy
+				r.Route("/{patientId}", func(r chi.Router) {
+					r.Use(m.RequirePatientAccess(s.services.AccessPolicy))
+					r.With(m.RequirePermission(auth.PermissionEHRRead)).Get("/", s.handlers.Patient.HandleGetPatient)
+					// allergies
+					r.Route("/allergies", func(r chi.Router) {
+						r.With(m.RequirePermission(auth.PermissionEHRWrite)).Post("/", s.handlers.Allergy.HandleCreateAllergy)
+						r.With(m.RequirePermission(auth.PermissionEHRRead)).Get("/", s.handlers.Allergy.HandleListAllergies)
+						r.Route("/{allergyId}", func(r chi.Router) {
+							r.With(m.RequirePermission(auth.PermissionEHRRead)).Get("/", s.handlers.Allergy.HandleGetAllergy)
+							r.With(m.RequirePermission(auth.PermissionEHRWrite)).Put("/", s.handlers.Allergy.HandleUpdateAllergy)
+							r.With(m.RequirePermission(auth.PermissionEHRWrite)).Delete("/", s.handlers.Allergy.HandleDeleteAllergy)
+						})
 					})
-				})
-				// medications
-				r.Route("/{patientId}/medications", func(r chi.Router) {
-					r.Post("/", s.handlers.MedicationStatement.HandleCreateMedication)
-					r.Get("/", s.handlers.MedicationStatement.HandleListMedications)
-					r.Route("/{medicationId}", func(r chi.Router) {
-						r.Get("/", s.handlers.MedicationStatement.HandleGetMedication)
-						r.Put("/", s.handlers.MedicationStatement.HandleUpdateMedication)
-						r.Delete("/", s.handlers.MedicationStatement.HandleDeleteMedication)
+					// medications
+					r.Route("/medications", func(r chi.Router) {
+						r.With(m.RequirePermission(auth.PermissionEHRWrite)).Post("/", s.handlers.MedicationStatement.HandleCreateMedication)
+						r.With(m.RequirePermission(auth.PermissionEHRRead)).Get("/", s.handlers.MedicationStatement.HandleListMedications)
+						r.Route("/{medicationId}", func(r chi.Router) {
+							r.With(m.RequirePermission(auth.PermissionEHRRead)).Get("/", s.handlers.MedicationStatement.HandleGetMedication)
+							r.With(m.RequirePermission(auth.PermissionEHRWrite)).Put("/", s.handlers.MedicationStatement.HandleUpdateMedication)
+							r.With(m.RequirePermission(auth.PermissionEHRWrite)).Delete("/", s.handlers.MedicationStatement.HandleDeleteMedication)
+						})
 					})
-				})
-				// Observations
-				r.Route("/{patientId}/observations", func(r chi.Router) {
-					r.Post("/", s.handlers.Observation.HandleCreateObservationInDB)
-					r.Get("/", s.handlers.Observation.HandleListObservations)
-					r.Route("/{observationId}", func(r chi.Router) {
-						r.Get("/", s.handlers.Observation.HandleGetObservation)
-						r.Put("/", s.handlers.Observation.HandleUpdateObservation)
-						r.Delete("/", s.handlers.Observation.HandleDeleteObservation)
+					// Observations
+					r.Route("/observations", func(r chi.Router) {
+						r.With(m.RequirePermission(auth.PermissionEHRWrite)).Post("/", s.handlers.Observation.HandleCreateObservationInDB)
+						r.With(m.RequirePermission(auth.PermissionEHRRead)).Get("/", s.handlers.Observation.HandleListObservations)
+						r.Route("/{observationId}", func(r chi.Router) {
+							r.With(m.RequirePermission(auth.PermissionEHRRead)).Get("/", s.handlers.Observation.HandleGetObservation)
+							r.With(m.RequirePermission(auth.PermissionEHRWrite)).Put("/", s.handlers.Observation.HandleUpdateObservation)
+							r.With(m.RequirePermission(auth.PermissionEHRWrite)).Delete("/", s.handlers.Observation.HandleDeleteObservation)
+						})
 					})
 				})
 			})
 			// Doctor endpoints
 			r.Route("/doctors", func(r chi.Router) {
 				r.Get("/", s.handlers.Doctor.HandleGetDoctors)
-				r.Get("/my-patients", s.handlers.Doctor.HandleListMyPatients)
-				r.Post("/", s.handlers.Doctor.HandleCreateDoctor)
-				r.Get("/appointments", s.handlers.Appointment.HandleGetDoctorAppointments)
+				r.With(m.RequirePermission(auth.PermissionPatientsView)).Get("/my-patients", s.handlers.Doctor.HandleListMyPatients)
+				r.With(m.RequirePermission(auth.PermissionDoctorsOnboard)).Post("/", s.handlers.Doctor.HandleCreateDoctor)
+				// license verification , doctors aren't listed or bookable until an admin has verified them
+				r.With(m.RequirePermission(auth.PermissionDoctorsOnboard)).Post("/license", s.handlers.LicenseVerification.HandleUploadLicense)
+				r.With(m.RequirePermission(auth.PermissionDoctorsOnboard)).Get("/verification", s.handlers.LicenseVerification.HandleGetOwnVerification)
+				r.With(m.RequirePermission(auth.PermissionScheduleManage)).Get("/appointments", s.handlers.Appointment.HandleGetDoctorAppointments)
+				// where the doctor's share of each payment is settled and what they have earned
+				r.Group(func(r chi.Router) {
+					r.Use(m.RequirePermission(auth.PermissionPayoutsManage))
+					r.Get("/payout-account", s.handlers.Payout.HandleGetAccount)
+					r.Put("/payout-account", s.handlers.Payout.HandleRegisterAccount)
+					r.Get("/earnings", s.handlers.Payout.HandleGetEarnings)
+				})
 
 				// Doctor availability endpoints
 				r.Route("/availability", func(r chi.Router) {
-					r.Get("/", s.handlers.Availability.HandleGetAvailabilityByDoctor)
-					r.Post("/", s.handlers.Availability.HandleCreateAvailability)
+					// anyone can look up the free slots of a doctor
 					r.Post("/slots", s.handlers.Availability.HandleGetSlots)
-					r.Delete("/id/{availabilityId}", s.handlers.Availability.HandleDeleteById)
-					r.Delete("/day/{dayOfWeek}", s.handlers.Availability.HandleDeleteByDay)
+					// the earliest open slots of the doctors that match the GetDoctors filters
+					r.Get("/search", s.handlers.Availability.HandleSearchSlots)
+					r.Get("/holidays", s.handlers.Availability.HandleListHolidays)
+					r.Group(func(r chi.Router) {
+						r.Use(m.RequirePermission(auth.PermissionScheduleManage))
+						r.Get("/", s.handlers.Availability.HandleGetAvailabilityByDoctor)
+						r.Post("/", s.handlers.Availability.HandleCreateAvailability)
+						r.Delete("/id/{availabilityId}", s.handlers.Availability.HandleDeleteById)
+						r.Delete("/day/{dayOfWeek}", s.handlers.Availability.HandleDeleteByDay)
+						// dated blocks and extra hours on top of the weekly windows
+						r.Get("/exceptions", s.handlers.Availability.HandleListExceptions)
+						r.Post("/exceptions", s.handlers.Availability.HandleCreateException)
+						r.Delete("/exceptions/{exceptionId}", s.handlers.Availability.HandleDeleteException)
+						r.Put("/holidays", s.handlers.Availability.HandleSetHolidays)
+						// the timezone the weekly windows are in
+						r.Put("/timezone", s.handlers.Availability.HandleSetTimezone)
+						// buffer between appointments , minimum notice and booking horizon
+						r.Get("/rules", s.handlers.Availability.HandleGetBookingRules)
+						r.Put("/rules", s.handlers.Availability.HandleSetBookingRules)
+					})
 				})
 			})
 
 			// Appointment endpoints
 			r.Route("/appointments", func(r chi.Router) {
-				r.Patch("/status", s.handlers.Appointment.HandleUpdateStatus)
+				r.With(m.RequirePermission(auth.PermissionAppointmentsManage)).Patch("/status", s.handlers.Appointment.HandleUpdateStatus)
 				r.Get("/completed", s.handlers.Appointment.HandleGetCompletedAppointments)
-				r.Post("/", s.handlers.Appointment.HandleCreateAppointment)
+				r.With(m.RequirePermission(auth.PermissionAppointmentsBook)).Post("/", s.handlers.Appointment.HandleCreateAppointment)
+				r.Route("/{appointmentId}", func(r chi.Router) {
+					r.With(m.RequirePermission(auth.PermissionAppointmentsCancel)).Post("/cancel", s.handlers.Appointment.HandleCancelAppointment)
+					r.With(m.RequirePermission(auth.PermissionAppointmentsBook)).Post("/reschedule", s.handlers.Appointment.HandleRescheduleAppointment)
+					r.Get("/reschedules", s.handlers.Appointment.HandleListReschedules)
+					r.Get("/history", s.handlers.Appointment.HandleListStatusHistory)
+				})
 			})
 			// protected payments endpoints
 			r.Route("/payments", func(r chi.Router) {
 				r.Get("/status", s.handlers.Payment.GetPaymentStatus)
 			})
+			// emergency access to a patient outside the care relationship
+			r.With(m.RequirePermission(auth.PermissionBreakGlass)).Post("/break-glass", s.handlers.BreakGlass.HandleGrantAccess)
+			// Admin endpoints
+			r.Route("/admin", func(r chi.Router) {
+				r.Route("/break-glass", func(r chi.Router) {
+					r.Use(m.RequirePermission(auth.PermissionAuditRead))
+					r.Get("/", s.handlers.BreakGlass.HandleListGrants)
+					r.Get("/{grantId}/accesses", s.handlers.BreakGlass.HandleListAccesses)
+				})
+				r.Route("/doctors", func(r chi.Router) {
+					r.Use(m.RequirePermission(auth.PermissionDoctorsVerify))
+					r.Get("/", s.handlers.LicenseVerification.HandleListDoctors)
+					r.Route("/{doctorId}", func(r chi.Router) {
+						r.Get("/verification", s.handlers.LicenseVerification.HandleGetVerification)
+						r.Post("/approve", s.handlers.LicenseVerification.HandleApprove)
+						r.Post("/reject", s.handlers.LicenseVerification.HandleReject)
+						r.Post("/suspend", s.handlers.LicenseVerification.HandleSuspend)
+					})
+				})
+				r.With(m.RequirePermission(auth.PermissionUsersManage)).Post("/users/{userId}/unlock", s.handlers.User.HandleAdminUnlockUser)
+				r.Route("/audit", func(r chi.Router) {
+					r.Use(m.RequirePermission(auth.PermissionAuditRead))
+					r.Get("/", s.handlers.Audit.HandleListEvents)
+					r.Get("/verify", s.handlers.Audit.HandleVerifyChain)
+				})
+				// payments that were checked with their provider because the webhook never arrived
+				r.Route("/payments/reconciliation", func(r chi.Router) {
+					r.Use(m.RequirePermission(auth.PermissionPaymentsReview))
+					r.Get("/", s.handlers.Reconciliation.HandleListRuns)
+					r.Get("/{runId}", s.handlers.Reconciliation.HandleGetReport)
+				})
+				// what each doctor earned and what the platform still owes them
+				r.With(m.RequirePermission(auth.PermissionPaymentsReview)).Get("/payouts", s.handlers.Payout.HandleGetPayoutReport)
+			})
 			// Document endpoints
 			r.Route("/documents", func(r chi.Router) {
-				r.Get("/", s.handlers.DocumentReference.HandleListPatientDocuments)
-				r.Post("/upload", s.handlers.DocumentReference.HandleCreateDocumentReference)
+				r.With(m.RequirePermission(auth.PermissionEHRRead)).Get("/", s.handlers.DocumentReference.HandleListPatientDocuments)
+				r.With(m.RequirePermission(auth.PermissionEHRWrite)).Post("/upload", s.handlers.DocumentReference.HandleCreateDocumentReference)
 				// Observation endpoints
 				r.Route("/observations", func(r chi.Router) {
-					r.Get("/", s.handlers.Observation.HandleListPatientObservations)
-					r.Post("/note", s.handlers.Observation.HandleCreateConsultationNote)
+					r.With(m.RequirePermission(auth.PermissionEHRRead)).Get("/", s.handlers.Observation.HandleListPatientObservations)
+					r.With(m.RequirePermission(auth.PermissionNotesWrite)).Post("/note", s.handlers.Observation.HandleCreateConsultationNote)
 				})
 				// Endpoint to create a signed URL for document operations
-				r.Post("/signed-url", s.handlers.DocumentReference.HandleCreateSignedURL)
+				r.With(m.RequirePermission(auth.PermissionEHRRead)).Post("/signed-url", s.handlers.DocumentReference.HandleCreateSignedURL)
 			})
 		})
 	})
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"time"
@@ -10,6 +11,7 @@ import (
 	"github.com/mbeka02/lyra_backend/internal/auth"
 	"github.com/mbeka02/lyra_backend/internal/database"
 	"github.com/mbeka02/lyra_backend/internal/fhir"
+	"github.com/mbeka02/lyra_backend/internal/mailer"
 	"github.com/mbeka02/lyra_backend/internal/objstore"
 	"github.com/mbeka02/lyra_backend/internal/payment"
 	"github.com/mbeka02/lyra_backend/internal/server/handler"
@@ -19,18 +21,34 @@ import (
 )
 
 type ConfigOptions struct {
-	Port                string
-	AccessTokenDuration time.Duration
-	AuthMaker           auth.Maker
-	ImageStorage        objstore.Storage
-	FileStorage         objstore.Storage
-	PaymentProcessor    *payment.PaymentProcessor
-	StreamClient        *streamsdk.StreamClient
-	FHIRClient          *fhir.FHIRClient
+	Port                 string
+	AccessTokenDuration  time.Duration
+	RefreshTokenDuration time.Duration
+	AuthMaker            auth.Maker
+	ImageStorage         objstore.Storage
+	FileStorage          objstore.Storage
+	PaymentProviders     payment.Providers
+	Subaccounts          payment.Subaccounts
+	StreamClient         *streamsdk.StreamClient
+	FHIRClient           *fhir.FHIRClient
+	Mailer               mailer.Mailer
+	Verification         service.VerificationConfig
+	PasswordReset        service.PasswordResetConfig
+	SecretCipher         *auth.SecretCipher
+	TwoFactor            service.TwoFactorConfig
+	BookingPolicy        service.BookingPolicy
+	RefundPolicy         service.RefundPolicy
+	PricingPolicy        service.PricingPolicy
+	PaymentHold          service.PaymentHoldConfig
+	Reconciliation       service.PaymentReconciliationConfig
+	BreakGlass           service.BreakGlassConfig
+	Lockout              service.LockoutConfig
+	Calendar             service.CalendarConfig
 }
 type Server struct {
 	opts     ConfigOptions
 	db       *database.Store
+	services Services
 	handlers Handlers
 }
 type Handlers struct {
@@ -41,14 +59,26 @@ type Handlers struct {
 	Appointment         *handler.AppointmentHandler
 	Payment             *handler.PaymentHandler
 	DocumentReference   *handler.DocumentReferenceHandler
+	TwoFactor           *handler.TwoFactorHandler
 	Observation         *handler.ObservationHandler
 	Allergy             *handler.AllergyHandler
 	MedicationStatement *handler.MedicationHandler
+	BreakGlass          *handler.BreakGlassHandler
+	Audit               *handler.AuditHandler
+	LicenseVerification *handler.LicenseVerificationHandler
+	Reconciliation      *handler.ReconciliationHandler
+	Payout              *handler.PayoutHandler
+	Calendar            *handler.CalendarHandler
 }
 type Services struct {
 	User                service.UserService
+	Session             service.SessionService
+	Verification        service.VerificationService
+	Password            service.PasswordService
+	TwoFactor           service.TwoFactorService
 	Patient             service.PatientService
 	Doctor              service.DoctorService
+	AccessPolicy        service.AccessPolicy
 	Availability        service.AvailabilityService
 	Appointment         service.AppointmentService
 	Payment             service.PaymentService
@@ -56,9 +86,19 @@ type Services struct {
 	Observation         service.ObservationService
 	Allergy             service.AllergyService
 	MedicationStatement service.MedicationService
+	BreakGlass          service.BreakGlassService
+	Audit               service.AuditService
+	Lockout             service.LockoutService
+	LicenseVerification service.LicenseVerificationService
+	HoldSweeper         service.HoldSweeper
+	Reconciler          service.PaymentReconciler
+	Payout              service.PayoutService
+	Calendar            service.CalendarService
 }
 type Repositories struct {
 	User                repository.UserRepository
+	Session             repository.SessionRepository
+	TwoFactor           repository.TwoFactorRepository
 	Patient             repository.PatientRepository
 	Doctor              repository.DoctorRepository
 	Availability        repository.AvailabilityRepository
@@ -67,11 +107,19 @@ type Repositories struct {
 	Allergy             repository.AllergyIntoleranceRepository
 	MedicationStatement repository.MedicationStatementRepository
 	Observation         repository.ObservationRepository
+	BreakGlass          repository.BreakGlassRepository
+	Audit               repository.AuditRepository
+	LoginAttempt        repository.LoginAttemptRepository
+	Reconciliation      repository.ReconciliationRepository
+	Payout              repository.PayoutRepository
+	Calendar            repository.CalendarRepository
 }
 
 func initRepositories(store *database.Store) Repositories {
 	return Repositories{
 		User:                repository.NewUserRepository(store),
+		Session:             repository.NewSessionRepository(store),
+		TwoFactor:           repository.NewTwoFactorRepository(store),
 		Patient:             repository.NewPatientRepository(store),
 		Doctor:              repository.NewDoctorRepository(store),
 		Availability:        repository.NewAvailabilityRepository(store),
@@ -80,36 +128,74 @@ func initRepositories(store *database.Store) Repositories {
 		Allergy:             repository.NewSQLAllergyIntoleranceRepository(store),
 		MedicationStatement: repository.NewSQLMedicationStatementRepository(store),
 		Observation:         repository.NewSQLObservationRepository(store),
+		BreakGlass:          repository.NewBreakGlassRepository(store),
+		Audit:               repository.NewAuditRepository(store),
+		LoginAttempt:        repository.NewLoginAttemptRepository(store),
+		Reconciliation:      repository.NewReconciliationRepository(store),
+		Payout:              repository.NewPayoutRepository(store),
+		Calendar:            repository.NewCalendarRepository(store),
 	}
 }
 
-func initServices(repos Repositories, maker auth.Maker, imgStorage, fileStorage objstore.Storage, duration time.Duration, paymentProcessor *payment.PaymentProcessor, streamClient *streamsdk.StreamClient, fhirClient *fhir.FHIRClient) Services {
+func initServices(repos Repositories, opts ConfigOptions) Services {
+	fhirClient := opts.FHIRClient
+	fileStorage := opts.FileStorage
+	paymentProviders := opts.PaymentProviders
+	sessionService := service.NewSessionService(repos.Session, repos.User, opts.AuthMaker, opts.AccessTokenDuration, opts.RefreshTokenDuration)
+	verificationService := service.NewVerificationService(repos.User, opts.AuthMaker, opts.Mailer, opts.Verification)
+	twoFactorService := service.NewTwoFactorService(repos.TwoFactor, repos.User, opts.AuthMaker, opts.SecretCipher, opts.TwoFactor)
+	patientService := service.NewPatientService(repos.Patient, fhirClient, fileStorage)
+	doctorService := service.NewDoctorService(repos.Doctor, repos.Appointment)
+	auditService := service.NewAuditService(repos.Audit, repos.Patient)
+	lockoutService := service.NewLockoutService(repos.LoginAttempt, repos.User, opts.Mailer, opts.Lockout)
+	calendarService := service.NewCalendarService(repos.Calendar, repos.Appointment, repos.Doctor, repos.Patient, opts.Mailer, opts.Calendar)
+	paymentService := service.NewPaymentService(paymentProviders, repos.Payment, repos.Appointment, repos.Reconciliation, calendarService)
 	return Services{
-		User:                service.NewUserService(repos.User, maker, streamClient, imgStorage, duration),
-		Patient:             service.NewPatientService(repos.Patient, fhirClient, fileStorage),
-		Doctor:              service.NewDoctorService(repos.Doctor, repos.Appointment),
-		Availability:        service.NewAvailabilityService(repos.Availability, repos.Doctor),
-		Appointment:         service.NewAppointmentService(repos.Appointment, repos.Patient, repos.Doctor, paymentProcessor),
-		Payment:             service.NewPaymentService(paymentProcessor, repos.Payment),
-		DocumentReference:   service.NewDocumentReferenceService(fhirClient, fileStorage),
-		Observation:         service.NewObservationService(repos.Observation, fhirClient),
-		Allergy:             service.NewAllergyService(repos.Allergy),
-		MedicationStatement: service.NewMedicationService(repos.MedicationStatement),
+		User:                service.NewUserService(repos.User, sessionService, verificationService, twoFactorService, lockoutService, opts.StreamClient, opts.ImageStorage),
+		TwoFactor:           twoFactorService,
+		Session:             sessionService,
+		Verification:        verificationService,
+		Password:            service.NewPasswordService(repos.User, sessionService, opts.Mailer, opts.PasswordReset),
+		Patient:             patientService,
+		Doctor:              doctorService,
+		AccessPolicy:        service.NewAccessPolicy(patientService, doctorService, repos.BreakGlass),
+		Availability:        service.NewAvailabilityService(repos.Availability, repos.Doctor, opts.PaymentHold),
+		Appointment:         service.NewAppointmentService(repos.Appointment, repos.Patient, repos.Doctor, repos.User, repos.Payment, repos.Payout, paymentProviders, opts.BookingPolicy, opts.RefundPolicy, opts.PricingPolicy, opts.PaymentHold, calendarService),
+		Payment:             paymentService,
+		DocumentReference:   service.NewDocumentReferenceService(fhirClient, fileStorage, auditService),
+		Observation:         service.NewObservationService(repos.Observation, fhirClient, auditService),
+		Allergy:             service.NewAllergyService(repos.Allergy, auditService),
+		MedicationStatement: service.NewMedicationService(repos.MedicationStatement, auditService),
+		BreakGlass:          service.NewBreakGlassService(repos.BreakGlass, repos.Patient, repos.User, doctorService, opts.Mailer, auditService, opts.BreakGlass),
+		Audit:               auditService,
+		Lockout:             lockoutService,
+		LicenseVerification: service.NewLicenseVerificationService(repos.Doctor, fileStorage),
+		HoldSweeper:         service.NewHoldSweeper(repos.Appointment, opts.PaymentHold),
+		Reconciler:          service.NewPaymentReconciler(paymentService, repos.Reconciliation, opts.Reconciliation),
+		Payout:              service.NewPayoutService(repos.Payout, repos.Doctor, opts.Subaccounts, opts.PricingPolicy),
+		Calendar:            calendarService,
 	}
 }
 
 func initHandlers(services Services) Handlers {
 	return Handlers{
-		User:                handler.NewUserHandler(services.User),
-		Patient:             handler.NewPatientHandler(services.Patient),
+		User:                handler.NewUserHandler(services.User, services.Session, services.Verification, services.Password, services.Lockout),
+		Patient:             handler.NewPatientHandler(services.Patient, services.Audit),
 		Doctor:              handler.NewDoctorHandler(services.Doctor),
 		Availability:        handler.NewAvailabilityHandler(services.Availability),
 		Appointment:         handler.NewAppointmentHandler(services.Appointment),
 		Payment:             handler.NewPaymentHandler(services.Payment),
-		DocumentReference:   handler.NewDocumentReferenceHandler(services.Patient, services.Doctor, services.DocumentReference),
-		Observation:         handler.NewObservationHandler(services.Patient, services.Doctor, services.Observation),
+		TwoFactor:           handler.NewTwoFactorHandler(services.User, services.TwoFactor),
+		DocumentReference:   handler.NewDocumentReferenceHandler(services.AccessPolicy, services.Doctor, services.DocumentReference),
+		Observation:         handler.NewObservationHandler(services.AccessPolicy, services.Doctor, services.Observation),
 		Allergy:             handler.NewAllergyHandler(services.Allergy, services.Patient),
 		MedicationStatement: handler.NewMedicationHandler(services.MedicationStatement),
+		BreakGlass:          handler.NewBreakGlassHandler(services.BreakGlass),
+		Audit:               handler.NewAuditHandler(services.Audit),
+		LicenseVerification: handler.NewLicenseVerificationHandler(services.LicenseVerification),
+		Reconciliation:      handler.NewReconciliationHandler(services.Reconciler),
+		Payout:              handler.NewPayoutHandler(services.Payout),
+		Calendar:            handler.NewCalendarHandler(services.Calendar),
 	}
 }
 
@@ -118,13 +204,14 @@ func NewServer(opts ConfigOptions) *http.Server {
 	// repository(data access) layer
 	repositories := initRepositories(store)
 	// service layer
-	services := initServices(repositories, opts.AuthMaker, opts.ImageStorage, opts.FileStorage, opts.AccessTokenDuration, opts.PaymentProcessor, opts.StreamClient, opts.FHIRClient)
+	services := initServices(repositories, opts)
 	// transport layer
 	handlers := initHandlers(services)
 
 	NewServer := &Server{
 		opts:     opts,
 		db:       store,
+		services: services,
 		handlers: handlers,
 	}
 
@@ -136,6 +223,11 @@ func NewServer(opts ConfigOptions) *http.Server {
 		ReadTimeout:  45 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
+	// background workers stop when the server shuts down
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	server.RegisterOnShutdown(stopWorkers)
+	go services.HoldSweeper.Run(workerCtx)
+	go services.Reconciler.Run(workerCtx)
 
 	return server
 }
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/mbeka02/lyra_backend/internal/auth"
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+)
+
+// AccessPolicy decides whether a user can reach a patient's health record.
+// A patient can only reach their own record and a specialist can only reach the patients they have a (paid and non-cancelled) appointment with.
+// A specialist can also read the record of any patient they hold an unexpired break-glass grant for , those reads are recorded against the grant
+type AccessPolicy interface {
+	CanAccessPatient(ctx context.Context, payload *auth.Payload, access model.PatientAccessRequest) (bool, error)
+	// ResolvePatientID returns the patient the user is acting on , patients always act on their own record
+	ResolvePatientID(ctx context.Context, payload *auth.Payload, access model.PatientAccessRequest) (int64, error)
+}
+
+var (
+	ErrPatientAccessDenied = errors.New("you are not authorized to access the records of this patient")
+	ErrMissingPatientID    = errors.New("the id of the patient is required")
+)
+
+type accessPolicy struct {
+	patientService PatientService
+	doctorService  DoctorService
+	breakGlassRepo repository.BreakGlassRepository
+}
+
+func NewAccessPolicy(patientService PatientService, doctorService DoctorService, breakGlassRepo repository.BreakGlassRepository) AccessPolicy {
+	return &accessPolicy{
+		patientService,
+		doctorService,
+		breakGlassRepo,
+	}
+}
+
+func (p *accessPolicy) CanAccessPatient(ctx context.Context, payload *auth.Payload, access model.PatientAccessRequest) (bool, error) {
+	patientID := access.PatientID
+	switch payload.Role {
+	case auth.RolePatient:
+		ownPatientID, err := p.patientService.GetPatientIdByUserId(ctx, payload.UserID)
+		if err != nil {
+			// the user hasn't created a patient profile yet so there's no record they can access
+			if errors.Is(err, sql.ErrNoRows) {
+				return false, nil
+			}
+			return false, fmt.Errorf("unable to get the patient details for this account:%v", err)
+		}
+		return ownPatientID == patientID, nil
+	case auth.RoleSpecialist:
+		doctorID, err := p.doctorService.GetDoctorIdByUserId(ctx, payload.UserID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return false, nil
+			}
+			return false, fmt.Errorf("unable to get the doctor details for this account:%v", err)
+		}
+		underCare, err := p.doctorService.IsPatientUnderCare(ctx, doctorID, patientID)
+		if err != nil || underCare {
+			return underCare, err
+		}
+		if !access.ReadOnly {
+			return false, nil
+		}
+		return p.checkBreakGlass(ctx, doctorID, access)
+	default:
+		return false, nil
+	}
+}
+
+// checkBreakGlass allows the read if the doctor holds an unexpired grant for the patient and records it
+func (p *accessPolicy) checkBreakGlass(ctx context.Context, doctorID int64, access model.PatientAccessRequest) (bool, error) {
+	grant, err := p.breakGlassRepo.GetActiveGrant(ctx, doctorID, access.PatientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("unable to check for emergency access grants:%v", err)
+	}
+	// the read isn't allowed unless it has been recorded
+	if err := p.breakGlassRepo.RecordAccess(ctx, grant.GrantID, access.Resource); err != nil {
+		return false, fmt.Errorf("unable to record emergency access:%v", err)
+	}
+	return true, nil
+}
+
+func (p *accessPolicy) ResolvePatientID(ctx context.Context, payload *auth.Payload, access model.PatientAccessRequest) (int64, error) {
+	requestedPatientID := access.PatientID
+	if payload.Role == auth.RolePatient {
+		patientID, err := p.patientService.GetPatientIdByUserId(ctx, payload.UserID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return 0, ErrPatientAccessDenied
+			}
+			return 0, fmt.Errorf("unable to get the patient details for this account:%v", err)
+		}
+		// a patient can leave out the id but they can't act on someone else's record
+		if requestedPatientID != 0 && requestedPatientID != patientID {
+			return 0, ErrPatientAccessDenied
+		}
+		return patientID, nil
+	}
+	if requestedPatientID == 0 {
+		return 0, ErrMissingPatientID
+	}
+	allowed, err := p.CanAccessPatient(ctx, payload, access)
+	if err != nil {
+		return 0, err
+	}
+	if !allowed {
+		return 0, ErrPatientAccessDenied
+	}
+	return requestedPatientID, nil
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/mbeka02/lyra_backend/internal/auth"
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+	"github.com/stretchr/testify/require"
+)
+
+// fakes only implement the methods the access policy calls
+type fakePatientService struct {
+	PatientService
+	patientIDs map[int64]int64
+	err        error
+}
+
+func (f *fakePatientService) GetPatientIdByUserId(ctx context.Context, userId int64) (int64, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	patientID, ok := f.patientIDs[userId]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return patientID, nil
+}
+
+type fakeDoctorService struct {
+	DoctorService
+	doctorIDs map[int64]int64
+	// doctor id -> patients under their care
+	patients map[int64][]int64
+	err      error
+}
+
+func (f *fakeDoctorService) GetDoctorIdByUserId(ctx context.Context, userId int64) (int64, error) {
+	doctorID, ok := f.doctorIDs[userId]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return doctorID, nil
+}
+
+func (f *fakeDoctorService) IsPatientUnderCare(ctx context.Context, doctorID int64, patientID int64) (bool, error) {
+	if f.err != nil {
+		return false, f.err
+	}
+	for _, id := range f.patients[doctorID] {
+		if id == patientID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type fakeBreakGlassRepository struct {
+	repository.BreakGlassRepository
+	// doctor id -> patient id -> grant id
+	grants    map[int64]map[int64]int64
+	recordErr error
+	// resources recorded per grant
+	accesses map[int64][]string
+}
+
+func (f *fakeBreakGlassRepository) GetActiveGrant(ctx context.Context, doctorId, patientId int64) (*database.BreakGlassGrant, error) {
+	grantID, ok := f.grants[doctorId][patientId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &database.BreakGlassGrant{GrantID: grantID, DoctorID: doctorId, PatientID: patientId}, nil
+}
+
+func (f *fakeBreakGlassRepository) CreateGrant(ctx context.Context, params repository.CreateBreakGlassGrantParams) (*database.BreakGlassGrant, error) {
+	if f.grants == nil {
+		f.grants = map[int64]map[int64]int64{}
+	}
+	if f.grants[params.DoctorID] == nil {
+		f.grants[params.DoctorID] = map[int64]int64{}
+	}
+	f.grants[params.DoctorID][params.PatientID] = grantID
+	return &database.BreakGlassGrant{
+		GrantID:   grantID,
+		DoctorID:  params.DoctorID,
+		PatientID: params.PatientID,
+		Reason:    params.Reason,
+		ExpiresAt: params.ExpiresAt,
+	}, nil
+}
+
+func (f *fakeBreakGlassRepository) RecordAccess(ctx context.Context, grantId int64, resource string) error {
+	if f.recordErr != nil {
+		return f.recordErr
+	}
+	if f.accesses == nil {
+		f.accesses = map[int64][]string{}
+	}
+	f.accesses[grantId] = append(f.accesses[grantId], resource)
+	return nil
+}
+
+const (
+	patientUserID      = 1
+	patientID          = 10
+	otherPatientID     = 11
+	specialistUserID   = 2
+	doctorID           = 20
+	noProfileUserID    = 3
+	unrelatedPatientID = 12
+	grantedPatientID   = 13
+	grantID            = 30
+)
+
+func read(patientID int64) model.PatientAccessRequest {
+	return model.PatientAccessRequest{PatientID: patientID, ReadOnly: true, Resource: "GET /records"}
+}
+
+func write(patientID int64) model.PatientAccessRequest {
+	return model.PatientAccessRequest{PatientID: patientID, Resource: "POST /records"}
+}
+
+func newTestAccessPolicy(breakGlassRepo *fakeBreakGlassRepository) AccessPolicy {
+	return NewAccessPolicy(
+		&fakePatientService{patientIDs: map[int64]int64{patientUserID: patientID}},
+		&fakeDoctorService{
+			doctorIDs: map[int64]int64{specialistUserID: doctorID},
+			patients:  map[int64][]int64{doctorID: {patientID, otherPatientID}},
+		},
+		breakGlassRepo,
+	)
+}
+
+func TestCanAccessPatient(t *testing.T) {
+	policy := newTestAccessPolicy(&fakeBreakGlassRepository{})
+	testCases := []struct {
+		name      string
+		payload   *auth.Payload
+		patientID int64
+		allowed   bool
+	}{
+		{"patient reads their own record", &auth.Payload{UserID: patientUserID, Role: auth.RolePatient}, patientID, true},
+		{"patient reads another patient's record", &auth.Payload{UserID: patientUserID, Role: auth.RolePatient}, otherPatientID, false},
+		{"patient without a profile", &auth.Payload{UserID: noProfileUserID, Role: auth.RolePatient}, patientID, false},
+		{"specialist reads a patient under their care", &auth.Payload{UserID: specialistUserID, Role: auth.RoleSpecialist}, otherPatientID, true},
+		{"specialist reads a patient not under their care", &auth.Payload{UserID: specialistUserID, Role: auth.RoleSpecialist}, unrelatedPatientID, false},
+		{"specialist without a doctor profile", &auth.Payload{UserID: noProfileUserID, Role: auth.RoleSpecialist}, patientID, false},
+		{"admin", &auth.Payload{UserID: noProfileUserID, Role: auth.RoleAdmin}, patientID, false},
+		{"unknown role", &auth.Payload{UserID: patientUserID, Role: "unknown"}, patientID, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			allowed, err := policy.CanAccessPatient(context.Background(), tc.payload, read(tc.patientID))
+			require.NoError(t, err)
+			require.Equal(t, tc.allowed, allowed)
+			allowed, err = policy.CanAccessPatient(context.Background(), tc.payload, write(tc.patientID))
+			require.NoError(t, err)
+			require.Equal(t, tc.allowed, allowed)
+		})
+	}
+}
+
+func TestCanAccessPatientLookupError(t *testing.T) {
+	lookupErr := errors.New("connection refused")
+	policy := NewAccessPolicy(
+		&fakePatientService{err: lookupErr},
+		&fakeDoctorService{doctorIDs: map[int64]int64{specialistUserID: doctorID}, err: lookupErr},
+		&fakeBreakGlassRepository{},
+	)
+	// failures are surfaced as errors rather than silently denying or allowing access
+	allowed, err := policy.CanAccessPatient(context.Background(), &auth.Payload{UserID: patientUserID, Role: auth.RolePatient}, read(patientID))
+	require.Error(t, err)
+	require.False(t, allowed)
+
+	allowed, err = policy.CanAccessPatient(context.Background(), &auth.Payload{UserID: specialistUserID, Role: auth.RoleSpecialist}, read(patientID))
+	require.ErrorIs(t, err, lookupErr)
+	require.False(t, allowed)
+}
+
+func TestBreakGlassAccess(t *testing.T) {
+	breakGlassRepo := &fakeBreakGlassRepository{
+		grants: map[int64]map[int64]int64{doctorID: {grantedPatientID: grantID}},
+	}
+	policy := newTestAccessPolicy(breakGlassRepo)
+	specialist := &auth.Payload{UserID: specialistUserID, Role: auth.RoleSpecialist}
+
+	// reads under a grant are allowed and recorded
+	allowed, err := policy.CanAccessPatient(context.Background(), specialist, read(grantedPatientID))
+	require.NoError(t, err)
+	require.True(t, allowed)
+	require.Equal(t, []string{"GET /records"}, breakGlassRepo.accesses[grantID])
+
+	// a grant doesn't allow writes
+	allowed, err = policy.CanAccessPatient(context.Background(), specialist, write(grantedPatientID))
+	require.NoError(t, err)
+	require.False(t, allowed)
+
+	// reads through the care relationship aren't recorded against a grant
+	allowed, err = policy.CanAccessPatient(context.Background(), specialist, read(patientID))
+	require.NoError(t, err)
+	require.True(t, allowed)
+	require.Len(t, breakGlassRepo.accesses[grantID], 1)
+
+	// the grant only covers the one patient
+	_, err = policy.ResolvePatientID(context.Background(), specialist, read(unrelatedPatientID))
+	require.ErrorIs(t, err, ErrPatientAccessDenied)
+
+	// the read is refused if it can't be recorded
+	breakGlassRepo.recordErr = errors.New("connection refused")
+	allowed, err = policy.CanAccessPatient(context.Background(), specialist, read(grantedPatientID))
+	require.Error(t, err)
+	require.False(t, allowed)
+}
+
+func TestResolvePatientID(t *testing.T) {
+	policy := newTestAccessPolicy(&fakeBreakGlassRepository{})
+	testCases := []struct {
+		name              string
+		payload           *auth.Payload
+		requestedID       int64
+		expectedPatientID int64
+		expectedErr       error
+	}{
+		{"patient without an id acts on their own record", &auth.Payload{UserID: patientUserID, Role: auth.RolePatient}, 0, patientID, nil},
+		{"patient naming their own record", &auth.Payload{UserID: patientUserID, Role: auth.RolePatient}, patientID, patientID, nil},
+		{"patient naming another patient", &auth.Payload{UserID: patientUserID, Role: auth.RolePatient}, otherPatientID, 0, ErrPatientAccessDenied},
+		{"patient without a profile", &auth.Payload{UserID: noProfileUserID, Role: auth.RolePatient}, 0, 0, ErrPatientAccessDenied},
+		{"specialist naming a patient under their care", &auth.Payload{UserID: specialistUserID, Role: auth.RoleSpecialist}, patientID, patientID, nil},
+		{"specialist without an id", &auth.Payload{UserID: specialistUserID, Role: auth.RoleSpecialist}, 0, 0, ErrMissingPatientID},
+		{"specialist naming a patient not under their care", &auth.Payload{UserID: specialistUserID, Role: auth.RoleSpecialist}, unrelatedPatientID, 0, ErrPatientAccessDenied},
+		{"specialist without a doctor profile", &auth.Payload{UserID: noProfileUserID, Role: auth.RoleSpecialist}, patientID, 0, ErrPatientAccessDenied},
+		{"admin", &auth.Payload{UserID: noProfileUserID, Role: auth.RoleAdmin}, patientID, 0, ErrPatientAccessDenied},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resolved, err := policy.ResolvePatientID(context.Background(), tc.payload, write(tc.requestedID))
+			if tc.expectedErr != nil {
+				require.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedPatientID, resolved)
+		})
+	}
+}
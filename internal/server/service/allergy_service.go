@@ -6,11 +6,13 @@ import (
 	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/mbeka02/lyra_backend/internal/audit"
 	"github.com/mbeka02/lyra_backend/internal/database"
 	"github.com/mbeka02/lyra_backend/internal/model"
 	"github.com/mbeka02/lyra_backend/internal/server/repository"
 )
 
+// access to forPatientID is checked by the RequirePatientAccess middleware before any of these are called
 type AllergyService interface {
 	CreateAllergy(ctx context.Context, req model.CreateAllergyIntoleranceRequest, actingUserID int64, forPatientID int64) (database.AllergyIntolerance, error)
 	GetAllergy(ctx context.Context, allergyID uuid.UUID, actingUserID int64, forPatientID int64) (database.AllergyIntolerance, error)
@@ -20,19 +22,19 @@ type AllergyService interface {
 }
 
 type allergyService struct {
-	allergyRepo repository.AllergyIntoleranceRepository
+	allergyRepo  repository.AllergyIntoleranceRepository
+	auditService AuditService
 	// patientRepo    repository.PatientRepository // TODO: validate patient existence
 }
 
-func NewAllergyService(allergyRepo repository.AllergyIntoleranceRepository) AllergyService {
+func NewAllergyService(allergyRepo repository.AllergyIntoleranceRepository, auditService AuditService) AllergyService {
 	return &allergyService{
-		allergyRepo: allergyRepo,
+		allergyRepo:  allergyRepo,
+		auditService: auditService,
 	}
 }
 
 func (s *allergyService) CreateAllergy(ctx context.Context, req model.CreateAllergyIntoleranceRequest, actingUserID int64, forPatientID int64) (database.AllergyIntolerance, error) {
-	// TODO: Authorization: Can actingUserID create allergy for forPatientID?
-
 	params := database.CreateAllergyIntoleranceParams{
 		PatientID:                 forPatientID,
 		ClinicalStatusCode:        req.ClinicalStatusCode,
@@ -43,22 +45,33 @@ func (s *allergyService) CreateAllergy(ctx context.Context, req model.CreateAlle
 		Criticality:               ToNullString(req.Criticality),
 		ReactionManifestationText: ToNullString(req.ReactionManifestationText),
 	}
-	return s.allergyRepo.Create(ctx, params)
+	allergy, err := s.allergyRepo.Create(ctx, params)
+	if err != nil {
+		return allergy, err
+	}
+	s.record(ctx, forPatientID, allergy.ID.String(), audit.ActionCreate)
+	return allergy, nil
 }
 
 func (s *allergyService) GetAllergy(ctx context.Context, allergyID uuid.UUID, actingUserID int64, forPatientID int64) (database.AllergyIntolerance, error) {
-	// TODO: Authorization: Can actingUserID view allergy for forPatientID?
-	return s.allergyRepo.GetByID(ctx, allergyID, forPatientID)
+	allergy, err := s.allergyRepo.GetByID(ctx, allergyID, forPatientID)
+	if err != nil {
+		return allergy, err
+	}
+	s.record(ctx, forPatientID, allergyID.String(), audit.ActionRead)
+	return allergy, nil
 }
 
 func (s *allergyService) ListAllergiesForPatient(ctx context.Context, actingUserID int64, forPatientID int64) ([]database.AllergyIntolerance, error) {
-	// TODO: Authorization: Can actingUserID list allergies for forPatientID?
-	return s.allergyRepo.ListByPatientID(ctx, forPatientID)
+	allergies, err := s.allergyRepo.ListByPatientID(ctx, forPatientID)
+	if err != nil {
+		return allergies, err
+	}
+	s.record(ctx, forPatientID, "", audit.ActionList)
+	return allergies, nil
 }
 
 func (s *allergyService) UpdateAllergy(ctx context.Context, allergyID uuid.UUID, req model.UpdateAllergyIntoleranceRequest, actingUserID int64, forPatientID int64) (database.AllergyIntolerance, error) {
-	// TODO: Authorization: Can actingUserID update allergy for forPatientID?
-
 	params := database.UpdateAllergyIntoleranceParams{
 		ID:                        allergyID,
 		PatientID:                 forPatientID, // Used in WHERE clause for safety
@@ -70,13 +83,29 @@ func (s *allergyService) UpdateAllergy(ctx context.Context, allergyID uuid.UUID,
 		Criticality:               ToNullString(req.Criticality),
 		ReactionManifestationText: ToNullString(req.ReactionManifestationText),
 	}
-	return s.allergyRepo.Update(ctx, params)
+	allergy, err := s.allergyRepo.Update(ctx, params)
+	if err != nil {
+		return allergy, err
+	}
+	s.record(ctx, forPatientID, allergyID.String(), audit.ActionUpdate)
+	return allergy, nil
 }
 
 func (s *allergyService) DeleteAllergy(ctx context.Context, allergyID uuid.UUID, actingUserID int64, forPatientID int64) error {
-	// TODO: Authorization: Can actingUserID delete allergy for forPatientID?
+	if err := s.allergyRepo.Delete(ctx, allergyID, forPatientID); err != nil {
+		return err
+	}
+	s.record(ctx, forPatientID, allergyID.String(), audit.ActionDelete)
+	return nil
+}
 
-	return s.allergyRepo.Delete(ctx, allergyID, forPatientID)
+func (s *allergyService) record(ctx context.Context, patientID int64, resourceID string, action audit.Action) {
+	s.auditService.Record(ctx, AuditEntry{
+		PatientID:    patientID,
+		ResourceType: audit.ResourceAllergy,
+		ResourceID:   resourceID,
+		Action:       action,
+	})
 }
 
 // Helper for nullable strings (put in a common utils package or keep here for now)
@@ -2,22 +2,87 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
-	"strconv"
+	"time"
 
+	"github.com/mbeka02/lyra_backend/internal/auth"
 	"github.com/mbeka02/lyra_backend/internal/database"
 	"github.com/mbeka02/lyra_backend/internal/model"
 	"github.com/mbeka02/lyra_backend/internal/payment"
 	"github.com/mbeka02/lyra_backend/internal/server/repository"
 )
 
+var (
+	ErrDoctorUnavailable         = errors.New("this doctor is not available for booking")
+	ErrAppointmentNotFound       = errors.New("appointment not found")
+	ErrAppointmentAccessDenied   = errors.New("you are not a participant in this appointment")
+	ErrAppointmentNotCancellable = errors.New("only appointments that are pending payment or scheduled can be cancelled")
+	// rescheduling
+	ErrAppointmentNotReschedulable = errors.New("only scheduled appointments can be rescheduled")
+	ErrRescheduleWindowClosed      = errors.New("the appointment is too close to its start time to be rescheduled")
+	ErrRescheduleLimitReached      = errors.New("this appointment has been rescheduled the maximum number of times")
+	ErrInvalidAppointmentTime      = errors.New("the new start time must be in the future and differ from the current one")
+	ErrSlotUnavailable             = errors.New("this time is outside the doctor's availability")
+	ErrSlotTaken                   = errors.New("this time slot has already been booked")
+	// the doctor's booking rules , the specific errors wrap ErrBookingRules
+	ErrBookingRules    = errors.New("this time doesn't meet the doctor's booking rules")
+	ErrBookingTooSoon  = fmt.Errorf("%w , the doctor needs more notice", ErrBookingRules)
+	ErrBookingTooFar   = fmt.Errorf("%w , the doctor doesn't take bookings this far ahead", ErrBookingRules)
+	ErrBookingTooClose = fmt.Errorf("%w , it's too close to another of the doctor's appointments", ErrBookingRules)
+	// payment
+	ErrUnsupportedPaymentMethod = errors.New("this payment method is not available")
+	ErrInvalidPhoneNumber       = errors.New("the phone number can't receive M-Pesa payments")
+)
+
 type appointmentService struct {
 	appointmentRepo  repository.AppointmentRepository
 	patientRepo      repository.PatientRepository
 	doctorRepo       repository.DoctorRepository
-	paymentProcessor *payment.PaymentProcessor
+	userRepo         repository.UserRepository
+	paymentRepo      repository.PaymentRepository
+	payoutRepo       repository.PayoutRepository
+	paymentProviders payment.Providers
+	policy           BookingPolicy
+	refundPolicy     RefundPolicy
+	pricing          PricingPolicy
+	paymentHold      PaymentHoldConfig
+	invites          InviteSender
 }
+
+// BookingPolicy holds the configurable rules that apply when patients book appointments
+type BookingPolicy struct {
+	RequireVerifiedEmail bool
+	// how many times a single appointment can be rescheduled
+	RescheduleLimit int64
+	// appointments can't be rescheduled once they are this close to their start time
+	RescheduleCutoff time.Duration
+}
+
+// RefundPolicy decides how much of the payment is returned when an appointment is cancelled
+type RefundPolicy struct {
+	// patients that cancel more than this long before the appointment starts get a full refund
+	FullRefundWindow time.Duration
+	// the percentage refunded to patients that cancel inside the window but before the appointment starts
+	PartialRefundPercent int64
+}
+
+// RefundAmount returns the part of the amount paid (in cents) that is refunded for a cancellation made at cancelledAt ,
+// the patient gets a full refund whenever the doctor is the one that cancels
+func (p RefundPolicy) RefundAmount(paid int64, startTime, cancelledAt time.Time, cancelledBy string) int64 {
+	switch {
+	case cancelledBy == auth.RoleSpecialist:
+		return paid
+	case !cancelledAt.Before(startTime):
+		return 0
+	case startTime.Sub(cancelledAt) > p.FullRefundWindow:
+		return paid
+	default:
+		return paid * p.PartialRefundPercent / 100
+	}
+}
+
 type GetAppointmentsParams struct {
 	UserID   int64
 	Interval int32
@@ -28,38 +93,329 @@ type GetAppointmentIDsParams struct {
 	Role   string
 }
 type UpdateAppointmentStatusParams struct {
+	UserID        int64
+	Role          string
 	AppointmentID int64
 	Status        string
+	Reason        string
+}
+
+type CancelAppointmentParams struct {
+	UserID        int64
+	Role          string
+	AppointmentID int64
+	Reason        string
+}
+
+type RescheduleAppointmentParams struct {
+	UserID        int64
+	Role          string
+	AppointmentID int64
+	// the appointment keeps its length so only the new start time is needed
+	StartTime time.Time
+	Reason    string
 }
 
 type AppointmentService interface {
-	CreateAppointmentWithPayment(ctx context.Context, req model.CreateAppointmentRequest, userId int64, email string) (*model.InitializeTransactionResponse, error)
+	CreateAppointmentWithPayment(ctx context.Context, req model.CreateAppointmentRequest, userId int64, email string) (*model.CreateAppointmentResponse, error)
 
 	GetPatientAppointments(ctx context.Context, params GetAppointmentsParams) ([]database.GetPatientAppointmentsRow, error)
 	GetDoctorAppointments(ctx context.Context, params GetAppointmentsParams) ([]database.GetDoctorAppointmentsRow, error)
 	GetAppointmentIDs(ctx context.Context, params GetAppointmentIDsParams) ([]int64, error)
-	UpdateAppointmentStatus(ctx context.Context, params model.UpdateAppointmentStatusRequest) error
+	// UpdateAppointmentStatus moves the appointment along its lifecycle , only the transitions in appointmentTransitions are allowed
+	UpdateAppointmentStatus(ctx context.Context, params UpdateAppointmentStatusParams) error
+	// ListStatusHistory returns every status change of the appointment , oldest first
+	ListStatusHistory(ctx context.Context, userId int64, role string, appointmentId int64) ([]database.AppointmentStatusHistory, error)
+	// CancelAppointment cancels an appointment on behalf of the patient or doctor taking part in it and refunds what the refund policy allows
+	CancelAppointment(ctx context.Context, params CancelAppointmentParams) (*model.CancelAppointmentResponse, error)
+	// RescheduleAppointment moves a scheduled appointment to a new slot , the payment stays with the appointment
+	RescheduleAppointment(ctx context.Context, params RescheduleAppointmentParams) (*database.Appointment, error)
+	// ListReschedules returns the times the appointment was moved from , oldest first
+	ListReschedules(ctx context.Context, userId int64, role string, appointmentId int64) ([]database.AppointmentReschedule, error)
 }
 
-func NewAppointmentService(appointmentRepo repository.AppointmentRepository, patientRepo repository.PatientRepository, doctorRepo repository.DoctorRepository, paymentProcessor *payment.PaymentProcessor) AppointmentService {
+func NewAppointmentService(appointmentRepo repository.AppointmentRepository, patientRepo repository.PatientRepository, doctorRepo repository.DoctorRepository, userRepo repository.UserRepository, paymentRepo repository.PaymentRepository, payoutRepo repository.PayoutRepository, paymentProviders payment.Providers, policy BookingPolicy, refundPolicy RefundPolicy, pricing PricingPolicy, paymentHold PaymentHoldConfig, invites InviteSender) AppointmentService {
 	return &appointmentService{
 		appointmentRepo,
 		patientRepo,
 		doctorRepo,
-		paymentProcessor,
+		userRepo,
+		paymentRepo,
+		payoutRepo,
+		paymentProviders,
+		policy,
+		refundPolicy,
+		pricing,
+		paymentHold,
+		invites,
 	}
 }
 
-func (s *appointmentService) UpdateAppointmentStatus(ctx context.Context, params model.UpdateAppointmentStatusRequest) error {
-	return s.appointmentRepo.UpdateAppointmentStatus(ctx, repository.UpdateAppointmentStatusParams{
-		Status:        params.Status,
-		AppointmentID: params.AppointmentID,
+func (s *appointmentService) CancelAppointment(ctx context.Context, params CancelAppointmentParams) (*model.CancelAppointmentResponse, error) {
+	appointment, err := s.getAppointmentForParticipant(ctx, params.UserID, params.Role, params.AppointmentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatusTransition(appointment.CurrentStatus, database.AppointmentStatusCancelled, params.Role); err != nil {
+		if errors.Is(err, ErrInvalidStatusTransition) {
+			return nil, ErrAppointmentNotCancellable
+		}
+		return nil, err
+	}
+	cancellation := repository.UpdateAppointmentStatusParams{
+		AppointmentID: appointment.AppointmentID,
+		From:          appointment.CurrentStatus,
+		To:            database.AppointmentStatusCancelled,
+		Actor:         params.Role,
+		ChangedBy:     params.UserID,
+		Reason:        params.Reason,
+	}
+	response := &model.CancelAppointmentResponse{
+		AppointmentID: appointment.AppointmentID,
+		Status:        string(database.AppointmentStatusCancelled),
+		RefundAmount:  payment.FormatMinorUnits(0),
+	}
+	paid, err := s.paymentRepo.GetPaymentByAppointmentId(ctx, appointment.AppointmentID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the payment for this appointment:%v", err)
+	}
+	response.PaymentStatus = string(paid.CurrentStatus)
+
+	var refundAmount int64
+	// nothing has been charged for appointments that are still pending payment
+	if paid.CurrentStatus == database.PaymentStatusCompleted {
+		amount, err := payment.ToMinorUnits(paid.Amount)
+		if err != nil {
+			return nil, err
+		}
+		refundAmount = s.refundPolicy.RefundAmount(amount, appointment.StartTime, time.Now(), params.Role)
+		if refundAmount > 0 {
+			response.PaymentStatus = string(database.PaymentStatusPartiallyRefunded)
+			if refundAmount == amount {
+				response.PaymentStatus = string(database.PaymentStatusRefunded)
+			}
+		}
+	}
+	if refundAmount == 0 {
+		if err := s.appointmentRepo.UpdateAppointmentStatus(ctx, cancellation); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrAppointmentNotCancellable
+			}
+			return nil, fmt.Errorf("unable to cancel the appointment:%v", err)
+		}
+		s.sendCancellation(ctx, appointment)
+		return response, nil
+	}
+
+	// the refund is recorded with the cancellation and only sent once both have been committed ,
+	// so the appointment isn't locked while the provider is called and no refund is sent without a record of it
+	refund, err := s.appointmentRepo.CancelAppointmentWithRefund(ctx, repository.CancelAppointmentWithRefundParams{
+		Cancellation:   cancellation,
+		PaymentID:      paid.PaymentID,
+		PaymentStatus:  database.PaymentStatus(response.PaymentStatus),
+		Amount:         payment.FormatMinorUnits(refundAmount),
+		Currency:       paid.Currency,
+		IdempotencyKey: refundIdempotencyKey(appointment.AppointmentID),
 	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAppointmentNotCancellable
+		}
+		return nil, fmt.Errorf("unable to cancel the appointment:%v", err)
+	}
+	refund = issueRefund(ctx, s.paymentProviders, s.paymentRepo, refund, *paid, payment.RefundRequest{
+		Amount: refundAmount,
+		Reason: params.Reason,
+		Note:   fmt.Sprintf("appointment %d cancelled by the %s", appointment.AppointmentID, params.Role),
+	})
+	response.RefundAmount = refund.Amount
+	response.RefundStatus = refund.ProviderStatus
+	if refund.ProviderStatus == refundFailed {
+		response.PaymentStatus = string(database.PaymentStatusCompleted)
+	}
+	s.sendCancellation(ctx, appointment)
+	return response, nil
+}
+
+// refundIdempotencyKey identifies the refund of an appointment's cancellation , an appointment is only ever cancelled once
+func refundIdempotencyKey(appointmentId int64) string {
+	return fmt.Sprintf("appointment_%d_cancellation", appointmentId)
+}
+
+// sendCancellation withdraws the invite of a cancelled appointment , invites are only sent once an appointment has been paid for
+func (s *appointmentService) sendCancellation(ctx context.Context, appointment *database.Appointment) {
+	if appointment.CurrentStatus == database.AppointmentStatusScheduled {
+		s.invites.SendInvite(ctx, appointment.AppointmentID)
+	}
+}
+
+func (s *appointmentService) RescheduleAppointment(ctx context.Context, params RescheduleAppointmentParams) (*database.Appointment, error) {
+	appointment, err := s.getAppointmentForParticipant(ctx, params.UserID, params.Role, params.AppointmentID)
+	if err != nil {
+		return nil, err
+	}
+	if appointment.CurrentStatus != database.AppointmentStatusScheduled {
+		return nil, ErrAppointmentNotReschedulable
+	}
+	if time.Until(appointment.StartTime) < s.policy.RescheduleCutoff {
+		return nil, ErrRescheduleWindowClosed
+	}
+	if !params.StartTime.After(time.Now()) || params.StartTime.Equal(appointment.StartTime) {
+		return nil, ErrInvalidAppointmentTime
+	}
+	reschedules, err := s.appointmentRepo.CountReschedules(ctx, appointment.AppointmentID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the reschedule history of the appointment:%v", err)
+	}
+	if reschedules >= s.policy.RescheduleLimit {
+		return nil, ErrRescheduleLimitReached
+	}
+	endTime := params.StartTime.Add(appointment.EndTime.Sub(appointment.StartTime))
+	slot, err := s.appointmentRepo.CheckSlot(ctx, repository.CheckAppointmentSlotParams{
+		DoctorID:      appointment.DoctorID,
+		AppointmentID: appointment.AppointmentID,
+		StartTime:     params.StartTime,
+		EndTime:       endTime,
+		HeldAfter:     s.paymentHold.heldAfter(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to check the new slot:%v", err)
+	}
+	if err := checkSlot(slot); err != nil {
+		return nil, err
+	}
+	rescheduled, err := s.appointmentRepo.RescheduleAppointment(ctx, repository.RescheduleAppointmentParams{
+		AppointmentID:     appointment.AppointmentID,
+		DoctorID:          appointment.DoctorID,
+		PreviousStartTime: appointment.StartTime,
+		PreviousEndTime:   appointment.EndTime,
+		StartTime:         params.StartTime,
+		EndTime:           endTime,
+		Reason:            params.Reason,
+		RescheduledBy:     params.UserID,
+		HeldAfter:         s.paymentHold.heldAfter(),
+	})
+	if err != nil {
+		// the appointment was moved or cancelled after it was read
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAppointmentNotReschedulable
+		}
+		// another booking took the slot after it was checked
+		if errors.Is(err, repository.ErrSlotTaken) {
+			return nil, ErrSlotTaken
+		}
+		// a block or a holiday was added after the slot was checked
+		if errors.Is(err, repository.ErrSlotUnavailable) {
+			return nil, ErrSlotUnavailable
+		}
+		if errors.Is(err, repository.ErrBookingRules) {
+			return nil, ErrBookingRules
+		}
+		return nil, fmt.Errorf("unable to reschedule the appointment:%v", err)
+	}
+	// the invite keeps its UID so that calendars move the event instead of adding another one
+	s.invites.SendInvite(ctx, rescheduled.AppointmentID)
+	return rescheduled, nil
+}
+
+func (s *appointmentService) ListReschedules(ctx context.Context, userId int64, role string, appointmentId int64) ([]database.AppointmentReschedule, error) {
+	if _, err := s.getAppointmentForParticipant(ctx, userId, role, appointmentId); err != nil {
+		return nil, err
+	}
+	return s.appointmentRepo.ListReschedules(ctx, appointmentId)
+}
+
+// getAppointmentForParticipant returns the appointment if the user is taking part in it
+func (s *appointmentService) getAppointmentForParticipant(ctx context.Context, userId int64, role string, appointmentId int64) (*database.Appointment, error) {
+	appointment, err := s.appointmentRepo.GetById(ctx, appointmentId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAppointmentNotFound
+		}
+		return nil, fmt.Errorf("unable to get the appointment:%v", err)
+	}
+	if err := s.checkParticipant(ctx, userId, role, appointment); err != nil {
+		return nil, err
+	}
+	return appointment, nil
+}
+
+// checkParticipant makes sure the user is the patient or the doctor in the appointment
+func (s *appointmentService) checkParticipant(ctx context.Context, userId int64, role string, appointment *database.Appointment) error {
+	var (
+		participantID int64
+		err           error
+	)
+	switch role {
+	case auth.RolePatient:
+		participantID, err = s.patientRepo.GetPatientIdByUserId(ctx, userId)
+		if err == nil && participantID == appointment.PatientID {
+			return nil
+		}
+	case auth.RoleSpecialist:
+		participantID, err = s.doctorRepo.GetDoctorIdByUserId(ctx, userId)
+		if err == nil && participantID == appointment.DoctorID {
+			return nil
+		}
+	default:
+		return ErrAppointmentAccessDenied
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("unable to get the profile for this account:%v", err)
+	}
+	return ErrAppointmentAccessDenied
+}
+
+func (s *appointmentService) UpdateAppointmentStatus(ctx context.Context, params UpdateAppointmentStatusParams) error {
+	to := database.AppointmentStatus(params.Status)
+	if !isAppointmentStatus(to) {
+		return ErrInvalidAppointmentStatus
+	}
+	// cancellations go through the refund policy
+	if to == database.AppointmentStatusCancelled {
+		_, err := s.CancelAppointment(ctx, CancelAppointmentParams{
+			UserID:        params.UserID,
+			Role:          params.Role,
+			AppointmentID: params.AppointmentID,
+			Reason:        params.Reason,
+		})
+		return err
+	}
+	appointment, err := s.getAppointmentForParticipant(ctx, params.UserID, params.Role, params.AppointmentID)
+	if err != nil {
+		return err
+	}
+	if err := checkStatusTransition(appointment.CurrentStatus, to, params.Role); err != nil {
+		return err
+	}
+	err = s.appointmentRepo.UpdateAppointmentStatus(ctx, repository.UpdateAppointmentStatusParams{
+		AppointmentID: appointment.AppointmentID,
+		From:          appointment.CurrentStatus,
+		To:            to,
+		Actor:         params.Role,
+		ChangedBy:     params.UserID,
+		Reason:        params.Reason,
+	})
+	if err != nil {
+		// the status changed after the appointment was read
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidStatusTransition
+		}
+		return fmt.Errorf("unable to update the appointment status:%v", err)
+	}
+	return nil
+}
+
+func (s *appointmentService) ListStatusHistory(ctx context.Context, userId int64, role string, appointmentId int64) ([]database.AppointmentStatusHistory, error) {
+	if _, err := s.getAppointmentForParticipant(ctx, userId, role, appointmentId); err != nil {
+		return nil, err
+	}
+	return s.appointmentRepo.ListStatusHistory(ctx, appointmentId)
 }
 
 func (s *appointmentService) GetAppointmentIDs(ctx context.Context, params GetAppointmentIDsParams) ([]int64, error) {
 	switch params.Role {
-	case "patient":
+	case auth.RolePatient:
 		patientID, err := s.patientRepo.GetPatientIdByUserId(ctx, params.UserID)
 		if err != nil {
 			return nil, errors.New("unable to get the patient details for this account")
@@ -68,7 +424,7 @@ func (s *appointmentService) GetAppointmentIDs(ctx context.Context, params GetAp
 			Role: params.Role,
 			ID:   patientID,
 		})
-	case "specialist":
+	case auth.RoleSpecialist:
 		doctorID, err := s.doctorRepo.GetDoctorIdByUserId(ctx, params.UserID)
 		if err != nil {
 			return nil, errors.New("unable to get the doctor details for this account")
@@ -106,30 +462,102 @@ func (s *appointmentService) GetPatientAppointments(ctx context.Context, params
 	})
 }
 
+// checkSlot turns a slot that can't be booked into the error the patient is shown
+func checkSlot(slot database.CheckAppointmentSlotRow) error {
+	switch {
+	case !slot.WithinAvailability:
+		return ErrSlotUnavailable
+	case slot.AlreadyBooked:
+		return ErrSlotTaken
+	case slot.TooSoon:
+		return ErrBookingTooSoon
+	case slot.TooFar:
+		return ErrBookingTooFar
+	case slot.TooClose:
+		return ErrBookingTooClose
+	}
+	return nil
+}
+
 // TODO: CLEAN THIS UP
-func (s *appointmentService) CreateAppointmentWithPayment(ctx context.Context, req model.CreateAppointmentRequest, userId int64, email string) (*model.InitializeTransactionResponse, error) {
+func (s *appointmentService) CreateAppointmentWithPayment(ctx context.Context, req model.CreateAppointmentRequest, userId int64, email string) (*model.CreateAppointmentResponse, error) {
+	if s.policy.RequireVerifiedEmail {
+		user, err := s.userRepo.GetById(ctx, userId)
+		if err != nil {
+			return nil, errors.New("unable to get the user details of this account")
+		}
+		if !user.VerifiedAt.Valid {
+			return nil, ErrEmailNotVerified
+		}
+	}
 	patientId, err := s.patientRepo.GetPatientIdByUserId(ctx, userId)
 	if err != nil {
 		return nil, errors.New("unable to get the user details of this account")
 	}
-	// convert amount to a float64
-	amountFloat, err := strconv.ParseFloat(req.Amount, 64)
+	// only verified doctors can be booked , checked before the patient is asked to pay
+	doctor, err := s.doctorRepo.GetById(ctx, req.DoctorID)
 	if err != nil {
-		// Handle error
-		return nil, fmt.Errorf("failed to parse payment amount as float64")
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrDoctorNotFound
+		}
+		return nil, fmt.Errorf("unable to get the doctor details:%v", err)
+	}
+	if doctor.VerificationStatus != database.VerificationStatusVerified {
+		return nil, ErrDoctorUnavailable
+	}
+	// the time is checked before the patient is asked to pay , the database checks it again when the appointment is added
+	slot, err := s.appointmentRepo.CheckSlot(ctx, repository.CheckAppointmentSlotParams{
+		DoctorID:  doctor.DoctorID,
+		StartTime: req.StartTime,
+		EndTime:   req.EndTime,
+		HeldAfter: s.paymentHold.heldAfter(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to check the slot:%v", err)
+	}
+	if err := checkSlot(slot); err != nil {
+		return nil, err
+	}
+	// the patient is charged the doctor's price for the length of the slot , never an amount sent by the client
+	price, err := s.pricing.Quote(doctor.PricePerHour, req.StartTime, req.EndTime)
+	if err != nil {
+		if errors.Is(err, ErrInvalidAppointmentDuration) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("unable to price the appointment:%v", err)
 	}
 
-	// Multiply by 100 for cents
-	amountInCents := int64(amountFloat * 100)
-
-	// send paystack  initialize payment request
-	response, err := s.paymentProcessor.InitializeTransaction(model.InitializeTransactionRequest{
-		Email:  email,
-		Amount: amountInCents,
+	provider, err := s.paymentProviders.Get(req.PaymentMethod)
+	if err != nil {
+		return nil, ErrUnsupportedPaymentMethod
+	}
+	// the payment is split with the doctor's subaccount if they have registered one , the platform keeps its fee and the tax
+	var subaccount string
+	account, err := s.payoutRepo.GetAccount(ctx, doctor.DoctorID)
+	switch {
+	case err == nil:
+		subaccount = account.SubaccountCode
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, fmt.Errorf("unable to get the doctor's payout account:%v", err)
+	}
+	// start the payment with the provider the patient chose
+	result, err := provider.Initialize(ctx, payment.InitializeRequest{
+		Amount:        price.Total,
+		Email:         email,
+		PhoneNumber:   req.PhoneNumber,
+		Description:   "Consultation",
+		SubAccount:    subaccount,
+		PlatformShare: price.Total - price.ConsultationFee,
 	})
 	if err != nil {
+		if errors.Is(err, payment.ErrInvalidPhoneNumber) {
+			return nil, ErrInvalidPhoneNumber
+		}
 		return nil, fmt.Errorf("payment processing error:%v", err)
 	}
+	// providers that only take whole units round the amount up , the difference goes to the platform so the breakdown still adds up
+	price.PlatformFee += result.Amount - price.Total
+	price.Total = result.Amount
 	// add records to db (transaction)
 	_, err = s.appointmentRepo.CreateAppointmentWithPayment(ctx, repository.CreateAppointmentWithPaymentParams{
 		// appointment details
@@ -139,11 +567,36 @@ func (s *appointmentService) CreateAppointmentWithPayment(ctx context.Context, r
 		StartTime: req.StartTime,
 		EndTime:   req.EndTime,
 		// payment details
-		Reference: response.Data.Reference,
-		Amount:    req.Amount,
+		Reference:       result.Reference,
+		Amount:          payment.FormatMinorUnits(price.Total),
+		ConsultationFee: payment.FormatMinorUnits(price.ConsultationFee),
+		PlatformFee:     payment.FormatMinorUnits(price.PlatformFee),
+		Tax:             payment.FormatMinorUnits(price.Tax),
+		PaymentMethod:   provider.Name(),
+		PayerPhone:      req.PhoneNumber,
+		SubaccountCode:  result.SubAccount,
+		HeldAfter:       s.paymentHold.heldAfter(),
 	})
 	if err != nil {
+		// a concurrent booking holds an overlapping slot , the initialized transaction is never paid and simply lapses
+		if errors.Is(err, repository.ErrSlotTaken) {
+			return nil, ErrSlotTaken
+		}
+		// e.g. the doctor has blocked the time off
+		if errors.Is(err, repository.ErrSlotUnavailable) {
+			return nil, ErrSlotUnavailable
+		}
+		// a concurrent booking took the time next to it
+		if errors.Is(err, repository.ErrBookingRules) {
+			return nil, ErrBookingTooClose
+		}
 		return nil, err
 	}
-	return response, nil
+	return &model.CreateAppointmentResponse{
+		PaymentMethod:    provider.Name(),
+		Reference:        result.Reference,
+		AuthorizationURL: result.AuthorizationURL,
+		Amount:           payment.FormatMinorUnits(price.Total),
+		Message:          result.Message,
+	}, nil
 }
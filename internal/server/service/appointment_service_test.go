@@ -0,0 +1,558 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/auth"
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/payment"
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAppointmentRepository struct {
+	repository.AppointmentRepository
+	appointments map[int64]*database.Appointment
+	reschedules  []database.AppointmentReschedule
+	history      []repository.UpdateAppointmentStatusParams
+	// the slot returned by CheckSlot
+	slot database.CheckAppointmentSlotRow
+	// returned by RescheduleAppointment , e.g. when a concurrent booking wins the slot
+	rescheduleErr error
+	// the refunded cancellations
+	refunds []repository.CancelAppointmentWithRefundParams
+	// what the calendar feeds and invites are built from
+	participants        map[int64]*database.GetAppointmentParticipantsRow
+	doctorAppointments  []database.GetDoctorAppointmentsRow
+	patientAppointments []database.GetPatientAppointmentsRow
+}
+
+func (f *fakeAppointmentRepository) GetById(ctx context.Context, appointmentId int64) (*database.Appointment, error) {
+	appointment, ok := f.appointments[appointmentId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *appointment
+	return &copied, nil
+}
+
+func (f *fakeAppointmentRepository) UpdateAppointmentStatus(ctx context.Context, params repository.UpdateAppointmentStatusParams) error {
+	appointment := f.appointments[params.AppointmentID]
+	if appointment.CurrentStatus != params.From {
+		return sql.ErrNoRows
+	}
+	appointment.CurrentStatus = params.To
+	f.history = append(f.history, params)
+	return nil
+}
+
+func (f *fakeAppointmentRepository) CheckSlot(ctx context.Context, params repository.CheckAppointmentSlotParams) (database.CheckAppointmentSlotRow, error) {
+	return f.slot, nil
+}
+
+func (f *fakeAppointmentRepository) CountReschedules(ctx context.Context, appointmentId int64) (int64, error) {
+	var count int64
+	for _, reschedule := range f.reschedules {
+		if reschedule.AppointmentID == appointmentId {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (f *fakeAppointmentRepository) RescheduleAppointment(ctx context.Context, params repository.RescheduleAppointmentParams) (*database.Appointment, error) {
+	if f.rescheduleErr != nil {
+		return nil, f.rescheduleErr
+	}
+	appointment := f.appointments[params.AppointmentID]
+	if appointment.CurrentStatus != database.AppointmentStatusScheduled || !appointment.StartTime.Equal(params.PreviousStartTime) {
+		return nil, sql.ErrNoRows
+	}
+	appointment.StartTime = params.StartTime
+	appointment.EndTime = params.EndTime
+	f.reschedules = append(f.reschedules, database.AppointmentReschedule{
+		AppointmentID:     params.AppointmentID,
+		PreviousStartTime: params.PreviousStartTime,
+		PreviousEndTime:   params.PreviousEndTime,
+		NewStartTime:      params.StartTime,
+		NewEndTime:        params.EndTime,
+		RescheduledBy:     params.RescheduledBy,
+	})
+	copied := *appointment
+	return &copied, nil
+}
+
+func (f *fakeAppointmentRepository) CancelAppointmentWithRefund(ctx context.Context, params repository.CancelAppointmentWithRefundParams) (*database.Refund, error) {
+	if err := f.UpdateAppointmentStatus(ctx, params.Cancellation); err != nil {
+		return nil, err
+	}
+	f.refunds = append(f.refunds, params)
+	return &database.Refund{
+		RefundID:       int64(len(f.refunds)),
+		PaymentID:      params.PaymentID,
+		AppointmentID:  params.Cancellation.AppointmentID,
+		Amount:         params.Amount,
+		ProviderStatus: repository.RefundStatusPending,
+		IdempotencyKey: params.IdempotencyKey,
+	}, nil
+}
+
+type fakePaymentRepository struct {
+	repository.PaymentRepository
+	payments map[int64]*database.Payment
+	// webhook events by id and whether they have been processed
+	events         map[string]bool
+	refundUpdates  []repository.UpdateRefundStatusParams
+	disputes       []repository.RecordDisputeParams
+	paymentUpdates []repository.UpdatePaymentAndAppointmentStatusParams
+	refundResults  []repository.RecordRefundResultParams
+	// payments refunded because the appointment was gone by the time they went through
+	unbookedRefunds []repository.RefundUnbookedPaymentParams
+}
+
+func (f *fakePaymentRepository) RecordRefundResult(ctx context.Context, params repository.RecordRefundResultParams) (*database.Refund, error) {
+	f.refundResults = append(f.refundResults, params)
+	return &database.Refund{RefundID: params.RefundID, Amount: "750.00", ProviderRefundID: params.ProviderRefundID, ProviderStatus: params.ProviderStatus}, nil
+}
+
+// fakeRefundProvider stands in for paystack when refunding , it sees whether the cancellation was committed before the refund was sent
+type fakeRefundProvider struct {
+	payment.Provider
+	appointmentRepo *fakeAppointmentRepository
+	err             error
+	refunds         []payment.RefundRequest
+	// the status of the appointment when the refund was sent
+	statuses []database.AppointmentStatus
+}
+
+func (f *fakeRefundProvider) Name() string {
+	return payment.MethodPaystack
+}
+
+func (f *fakeRefundProvider) Refund(ctx context.Context, request payment.RefundRequest) (*payment.RefundResult, error) {
+	f.refunds = append(f.refunds, request)
+	for _, appointment := range f.appointmentRepo.appointments {
+		f.statuses = append(f.statuses, appointment.CurrentStatus)
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &payment.RefundResult{ID: "3018284", Status: "pending"}, nil
+}
+
+func (f *fakePaymentRepository) GetPaymentByAppointmentId(ctx context.Context, appointmentId int64) (*database.Payment, error) {
+	payment, ok := f.payments[appointmentId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return payment, nil
+}
+
+func (f *fakePatientRepository) GetPatientIdByUserId(ctx context.Context, userId int64) (int64, error) {
+	for patientID, user := range f.users {
+		if user.UserID == userId {
+			return patientID, nil
+		}
+	}
+	return 0, sql.ErrNoRows
+}
+
+func (f *fakeDoctorRepository) GetDoctorIdByUserId(ctx context.Context, userId int64) (int64, error) {
+	doctor, err := f.GetByUserId(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+	return doctor.DoctorID, nil
+}
+
+func TestRefundAmount(t *testing.T) {
+	policy := RefundPolicy{FullRefundWindow: 24 * time.Hour, PartialRefundPercent: 50}
+	start := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	paid := int64(150050)
+
+	testCases := []struct {
+		name        string
+		cancelledAt time.Time
+		cancelledBy string
+		expected    int64
+	}{
+		{"more than a day ahead", start.Add(-25 * time.Hour), auth.RolePatient, paid},
+		{"exactly at the window", start.Add(-24 * time.Hour), auth.RolePatient, 75025},
+		{"inside the window", start.Add(-time.Hour), auth.RolePatient, 75025},
+		{"at the start", start, auth.RolePatient, 0},
+		{"after the start", start.Add(10 * time.Minute), auth.RolePatient, 0},
+		{"doctor cancels inside the window", start.Add(-time.Hour), auth.RoleSpecialist, paid},
+		{"doctor cancels after the start", start.Add(10 * time.Minute), auth.RoleSpecialist, paid},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, policy.RefundAmount(paid, start, tc.cancelledAt, tc.cancelledBy))
+		})
+	}
+}
+
+func TestCancelAppointment(t *testing.T) {
+	const (
+		pendingAppointmentID = 40
+		startedAppointmentID = 41
+		completedID          = 42
+	)
+	newService := func() (AppointmentService, *fakeAppointmentRepository) {
+		appointmentRepo := &fakeAppointmentRepository{appointments: map[int64]*database.Appointment{
+			pendingAppointmentID: {AppointmentID: pendingAppointmentID, PatientID: patientID, DoctorID: doctorID, CurrentStatus: database.AppointmentStatusPendingPayment, StartTime: time.Now().Add(48 * time.Hour)},
+			startedAppointmentID: {AppointmentID: startedAppointmentID, PatientID: patientID, DoctorID: doctorID, CurrentStatus: database.AppointmentStatusScheduled, StartTime: time.Now().Add(-5 * time.Minute)},
+			completedID:          {AppointmentID: completedID, PatientID: patientID, DoctorID: doctorID, CurrentStatus: database.AppointmentStatusCompleted, StartTime: time.Now().Add(-48 * time.Hour)},
+		}}
+		paymentRepo := &fakePaymentRepository{payments: map[int64]*database.Payment{
+			pendingAppointmentID: {PaymentID: 1, AppointmentID: pendingAppointmentID, Amount: "1500.00", CurrentStatus: database.PaymentStatusPending},
+			startedAppointmentID: {PaymentID: 2, AppointmentID: startedAppointmentID, Amount: "1500.00", CurrentStatus: database.PaymentStatusCompleted},
+			completedID:          {PaymentID: 3, AppointmentID: completedID, Amount: "1500.00", CurrentStatus: database.PaymentStatusCompleted},
+		}}
+		patientRepo := &fakePatientRepository{users: map[int64]database.User{
+			patientID:      {UserID: patientUserID},
+			otherPatientID: {UserID: noProfileUserID},
+		}}
+		doctorRepo := &fakeDoctorRepository{doctors: map[int64]*database.Doctor{
+			doctorID: {DoctorID: doctorID, UserID: specialistUserID},
+		}}
+		// the payment processor is never reached since none of these cancellations are refunded
+		service := NewAppointmentService(appointmentRepo, patientRepo, doctorRepo, &fakeUserRepository{}, paymentRepo, nil, nil, BookingPolicy{}, RefundPolicy{FullRefundWindow: 24 * time.Hour, PartialRefundPercent: 50}, PricingPolicy{}, PaymentHoldConfig{}, &fakeInviteSender{})
+		return service, appointmentRepo
+	}
+
+	t.Run("patient cancels an unpaid appointment", func(t *testing.T) {
+		service, appointmentRepo := newService()
+		response, err := service.CancelAppointment(context.Background(), CancelAppointmentParams{
+			UserID: patientUserID, Role: auth.RolePatient, AppointmentID: pendingAppointmentID, Reason: "no longer needed",
+		})
+		require.NoError(t, err)
+		require.Equal(t, "cancelled", response.Status)
+		require.Equal(t, "pending", response.PaymentStatus)
+		require.Equal(t, "0.00", response.RefundAmount)
+		require.Equal(t, database.AppointmentStatusCancelled, appointmentRepo.appointments[pendingAppointmentID].CurrentStatus)
+	})
+
+	t.Run("patient cancels after the start", func(t *testing.T) {
+		service, appointmentRepo := newService()
+		response, err := service.CancelAppointment(context.Background(), CancelAppointmentParams{
+			UserID: patientUserID, Role: auth.RolePatient, AppointmentID: startedAppointmentID, Reason: "running late",
+		})
+		require.NoError(t, err)
+		require.Equal(t, "completed", response.PaymentStatus)
+		require.Equal(t, "0.00", response.RefundAmount)
+		require.Equal(t, database.AppointmentStatusCancelled, appointmentRepo.appointments[startedAppointmentID].CurrentStatus)
+	})
+
+	t.Run("another patient", func(t *testing.T) {
+		service, _ := newService()
+		_, err := service.CancelAppointment(context.Background(), CancelAppointmentParams{
+			UserID: noProfileUserID, Role: auth.RolePatient, AppointmentID: pendingAppointmentID, Reason: "not mine",
+		})
+		require.ErrorIs(t, err, ErrAppointmentAccessDenied)
+	})
+
+	t.Run("doctor without a profile", func(t *testing.T) {
+		service, _ := newService()
+		_, err := service.CancelAppointment(context.Background(), CancelAppointmentParams{
+			UserID: patientUserID, Role: auth.RoleSpecialist, AppointmentID: pendingAppointmentID, Reason: "not mine",
+		})
+		require.ErrorIs(t, err, ErrAppointmentAccessDenied)
+	})
+
+	t.Run("completed appointment", func(t *testing.T) {
+		service, _ := newService()
+		_, err := service.CancelAppointment(context.Background(), CancelAppointmentParams{
+			UserID: specialistUserID, Role: auth.RoleSpecialist, AppointmentID: completedID, Reason: "too late",
+		})
+		require.ErrorIs(t, err, ErrAppointmentNotCancellable)
+	})
+
+	t.Run("missing appointment", func(t *testing.T) {
+		service, _ := newService()
+		_, err := service.CancelAppointment(context.Background(), CancelAppointmentParams{
+			UserID: patientUserID, Role: auth.RolePatient, AppointmentID: 999, Reason: "missing",
+		})
+		require.ErrorIs(t, err, ErrAppointmentNotFound)
+	})
+}
+
+func TestCancelAppointmentWithRefund(t *testing.T) {
+	const appointmentID = 45
+	newService := func(refundErr error) (AppointmentService, *fakeAppointmentRepository, *fakePaymentRepository, *fakeRefundProvider) {
+		appointmentRepo := &fakeAppointmentRepository{appointments: map[int64]*database.Appointment{
+			appointmentID: {AppointmentID: appointmentID, PatientID: patientID, DoctorID: doctorID, CurrentStatus: database.AppointmentStatusScheduled, StartTime: time.Now().Add(6 * time.Hour)},
+		}}
+		paymentRepo := &fakePaymentRepository{payments: map[int64]*database.Payment{
+			appointmentID: {PaymentID: 4, AppointmentID: appointmentID, Reference: "ref_45", Amount: "1500.00", Currency: "KES", PaymentMethod: payment.MethodPaystack, CurrentStatus: database.PaymentStatusCompleted},
+		}}
+		patientRepo := &fakePatientRepository{users: map[int64]database.User{
+			patientID: {UserID: patientUserID},
+		}}
+		provider := &fakeRefundProvider{appointmentRepo: appointmentRepo, err: refundErr}
+		// half of the payment is refunded inside the full refund window
+		service := NewAppointmentService(appointmentRepo, patientRepo, &fakeDoctorRepository{}, &fakeUserRepository{}, paymentRepo, nil, payment.NewProviders(provider), BookingPolicy{}, RefundPolicy{FullRefundWindow: 24 * time.Hour, PartialRefundPercent: 50}, PricingPolicy{}, PaymentHoldConfig{}, &fakeInviteSender{})
+		return service, appointmentRepo, paymentRepo, provider
+	}
+	cancel := func(service AppointmentService) (*model.CancelAppointmentResponse, error) {
+		return service.CancelAppointment(context.Background(), CancelAppointmentParams{
+			UserID: patientUserID, Role: auth.RolePatient, AppointmentID: appointmentID, Reason: "feeling better",
+		})
+	}
+
+	t.Run("the refund is sent after the cancellation is committed", func(t *testing.T) {
+		service, appointmentRepo, paymentRepo, provider := newService(nil)
+		response, err := cancel(service)
+		require.NoError(t, err)
+		require.Len(t, appointmentRepo.refunds, 1)
+		require.Equal(t, "appointment_45_cancellation", appointmentRepo.refunds[0].IdempotencyKey)
+		require.Equal(t, database.PaymentStatusPartiallyRefunded, appointmentRepo.refunds[0].PaymentStatus)
+		require.Len(t, provider.refunds, 1)
+		require.Equal(t, []database.AppointmentStatus{database.AppointmentStatusCancelled}, provider.statuses)
+		require.Equal(t, []repository.RecordRefundResultParams{{RefundID: 1, ProviderRefundID: "3018284", ProviderStatus: "pending"}}, paymentRepo.refundResults)
+		require.Equal(t, "partially_refunded", response.PaymentStatus)
+		require.Equal(t, "pending", response.RefundStatus)
+	})
+
+	t.Run("the provider turns the refund down", func(t *testing.T) {
+		service, appointmentRepo, paymentRepo, _ := newService(errors.New("paystack error:insufficient balance"))
+		response, err := cancel(service)
+		require.NoError(t, err)
+		// the cancellation stands , the payment is treated as paid again
+		require.Equal(t, database.AppointmentStatusCancelled, appointmentRepo.appointments[appointmentID].CurrentStatus)
+		require.Equal(t, []repository.RecordRefundResultParams{{RefundID: 1, ProviderStatus: "failed", PaymentStatus: "completed"}}, paymentRepo.refundResults)
+		require.Equal(t, "completed", response.PaymentStatus)
+		require.Equal(t, "failed", response.RefundStatus)
+	})
+
+	t.Run("a cancelled appointment isn't refunded again", func(t *testing.T) {
+		service, _, _, provider := newService(nil)
+		_, err := cancel(service)
+		require.NoError(t, err)
+		_, err = cancel(service)
+		require.ErrorIs(t, err, ErrAppointmentNotCancellable)
+		require.Len(t, provider.refunds, 1)
+	})
+}
+
+func TestRescheduleAppointment(t *testing.T) {
+	const (
+		scheduledID = 50
+		soonID      = 51
+	)
+	start := time.Now().Add(72 * time.Hour).Truncate(time.Hour)
+	newService := func() (AppointmentService, *fakeAppointmentRepository) {
+		appointmentRepo := &fakeAppointmentRepository{
+			appointments: map[int64]*database.Appointment{
+				scheduledID: {AppointmentID: scheduledID, PatientID: patientID, DoctorID: doctorID, CurrentStatus: database.AppointmentStatusScheduled, StartTime: start, EndTime: start.Add(30 * time.Minute)},
+				soonID:      {AppointmentID: soonID, PatientID: patientID, DoctorID: doctorID, CurrentStatus: database.AppointmentStatusScheduled, StartTime: time.Now().Add(time.Hour), EndTime: time.Now().Add(90 * time.Minute)},
+			},
+			slot: database.CheckAppointmentSlotRow{WithinAvailability: true},
+		}
+		patientRepo := &fakePatientRepository{users: map[int64]database.User{
+			patientID: {UserID: patientUserID},
+		}}
+		policy := BookingPolicy{RescheduleLimit: 2, RescheduleCutoff: 12 * time.Hour}
+		service := NewAppointmentService(appointmentRepo, patientRepo, &fakeDoctorRepository{}, &fakeUserRepository{}, &fakePaymentRepository{}, nil, nil, policy, RefundPolicy{}, PricingPolicy{}, PaymentHoldConfig{}, &fakeInviteSender{})
+		return service, appointmentRepo
+	}
+	reschedule := func(service AppointmentService, appointmentID int64, startTime time.Time) (*database.Appointment, error) {
+		return service.RescheduleAppointment(context.Background(), RescheduleAppointmentParams{
+			UserID: patientUserID, Role: auth.RolePatient, AppointmentID: appointmentID, StartTime: startTime,
+		})
+	}
+
+	t.Run("keeps the length of the appointment and records the previous times", func(t *testing.T) {
+		service, appointmentRepo := newService()
+		newStart := start.Add(24 * time.Hour)
+		appointment, err := reschedule(service, scheduledID, newStart)
+		require.NoError(t, err)
+		require.True(t, appointment.StartTime.Equal(newStart))
+		require.True(t, appointment.EndTime.Equal(newStart.Add(30*time.Minute)))
+		require.Len(t, appointmentRepo.reschedules, 1)
+		require.True(t, appointmentRepo.reschedules[0].PreviousStartTime.Equal(start))
+		require.Equal(t, int64(patientUserID), appointmentRepo.reschedules[0].RescheduledBy)
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		service, _ := newService()
+		_, err := reschedule(service, scheduledID, start.Add(24*time.Hour))
+		require.NoError(t, err)
+		_, err = reschedule(service, scheduledID, start.Add(48*time.Hour))
+		require.NoError(t, err)
+		_, err = reschedule(service, scheduledID, start.Add(72*time.Hour))
+		require.ErrorIs(t, err, ErrRescheduleLimitReached)
+	})
+
+	t.Run("inside the cut-off", func(t *testing.T) {
+		service, _ := newService()
+		_, err := reschedule(service, soonID, start)
+		require.ErrorIs(t, err, ErrRescheduleWindowClosed)
+	})
+
+	t.Run("new time in the past", func(t *testing.T) {
+		service, _ := newService()
+		_, err := reschedule(service, scheduledID, time.Now().Add(-time.Hour))
+		require.ErrorIs(t, err, ErrInvalidAppointmentTime)
+	})
+
+	t.Run("slot outside availability", func(t *testing.T) {
+		service, appointmentRepo := newService()
+		appointmentRepo.slot = database.CheckAppointmentSlotRow{WithinAvailability: false}
+		_, err := reschedule(service, scheduledID, start.Add(24*time.Hour))
+		require.ErrorIs(t, err, ErrSlotUnavailable)
+	})
+
+	t.Run("slot already booked", func(t *testing.T) {
+		service, appointmentRepo := newService()
+		appointmentRepo.slot = database.CheckAppointmentSlotRow{WithinAvailability: true, AlreadyBooked: true}
+		_, err := reschedule(service, scheduledID, start.Add(24*time.Hour))
+		require.ErrorIs(t, err, ErrSlotTaken)
+		require.Empty(t, appointmentRepo.reschedules)
+	})
+
+	t.Run("slot breaks the booking rules", func(t *testing.T) {
+		rules := []struct {
+			slot database.CheckAppointmentSlotRow
+			err  error
+		}{
+			{database.CheckAppointmentSlotRow{WithinAvailability: true, TooSoon: true}, ErrBookingTooSoon},
+			{database.CheckAppointmentSlotRow{WithinAvailability: true, TooFar: true}, ErrBookingTooFar},
+			{database.CheckAppointmentSlotRow{WithinAvailability: true, TooClose: true}, ErrBookingTooClose},
+		}
+		for _, rule := range rules {
+			service, appointmentRepo := newService()
+			appointmentRepo.slot = rule.slot
+			_, err := reschedule(service, scheduledID, start.Add(24*time.Hour))
+			require.ErrorIs(t, err, rule.err)
+			require.ErrorIs(t, err, ErrBookingRules)
+			require.Empty(t, appointmentRepo.reschedules)
+		}
+	})
+
+	t.Run("slot taken after it was checked", func(t *testing.T) {
+		service, appointmentRepo := newService()
+		appointmentRepo.rescheduleErr = repository.ErrSlotTaken
+		_, err := reschedule(service, scheduledID, start.Add(24*time.Hour))
+		require.ErrorIs(t, err, ErrSlotTaken)
+	})
+
+	t.Run("cancelled appointment", func(t *testing.T) {
+		service, appointmentRepo := newService()
+		appointmentRepo.appointments[scheduledID].CurrentStatus = database.AppointmentStatusCancelled
+		_, err := reschedule(service, scheduledID, start.Add(24*time.Hour))
+		require.ErrorIs(t, err, ErrAppointmentNotReschedulable)
+	})
+}
+
+func TestCheckStatusTransition(t *testing.T) {
+	testCases := []struct {
+		from, to database.AppointmentStatus
+		actor    string
+		expected error
+	}{
+		{database.AppointmentStatusPendingPayment, database.AppointmentStatusScheduled, actorPayment, nil},
+		{database.AppointmentStatusPendingPayment, database.AppointmentStatusScheduled, auth.RolePatient, ErrStatusTransitionForbidden},
+		{database.AppointmentStatusPendingPayment, database.AppointmentStatusScheduled, auth.RoleSpecialist, ErrStatusTransitionForbidden},
+		{database.AppointmentStatusPendingPayment, database.AppointmentStatusCompleted, auth.RolePatient, ErrInvalidStatusTransition},
+		{database.AppointmentStatusPendingPayment, database.AppointmentStatusCancelled, actorSystem, nil},
+		{database.AppointmentStatusScheduled, database.AppointmentStatusInProgress, auth.RoleSpecialist, nil},
+		{database.AppointmentStatusScheduled, database.AppointmentStatusInProgress, auth.RolePatient, ErrStatusTransitionForbidden},
+		{database.AppointmentStatusScheduled, database.AppointmentStatusCompleted, auth.RoleSpecialist, ErrInvalidStatusTransition},
+		{database.AppointmentStatusScheduled, database.AppointmentStatusCancelled, auth.RolePatient, nil},
+		{database.AppointmentStatusInProgress, database.AppointmentStatusCompleted, auth.RoleSpecialist, nil},
+		{database.AppointmentStatusInProgress, database.AppointmentStatusCancelled, auth.RoleSpecialist, ErrInvalidStatusTransition},
+		{database.AppointmentStatusCompleted, database.AppointmentStatusScheduled, auth.RoleAdmin, ErrInvalidStatusTransition},
+		{database.AppointmentStatusCancelled, database.AppointmentStatusScheduled, actorPayment, ErrInvalidStatusTransition},
+	}
+	for _, tc := range testCases {
+		err := checkStatusTransition(tc.from, tc.to, tc.actor)
+		if tc.expected == nil {
+			require.NoError(t, err, "%s -> %s by %s", tc.from, tc.to, tc.actor)
+		} else {
+			require.ErrorIs(t, err, tc.expected, "%s -> %s by %s", tc.from, tc.to, tc.actor)
+		}
+	}
+}
+
+func TestUpdateAppointmentStatus(t *testing.T) {
+	const (
+		pendingID   = 60
+		scheduledID = 61
+		otherID     = 62
+	)
+	newService := func() (AppointmentService, *fakeAppointmentRepository) {
+		appointmentRepo := &fakeAppointmentRepository{appointments: map[int64]*database.Appointment{
+			pendingID:   {AppointmentID: pendingID, PatientID: patientID, DoctorID: doctorID, CurrentStatus: database.AppointmentStatusPendingPayment},
+			scheduledID: {AppointmentID: scheduledID, PatientID: patientID, DoctorID: doctorID, CurrentStatus: database.AppointmentStatusScheduled},
+			// booked with another doctor
+			otherID: {AppointmentID: otherID, PatientID: patientID, DoctorID: doctorID + 1, CurrentStatus: database.AppointmentStatusScheduled},
+		}}
+		patientRepo := &fakePatientRepository{users: map[int64]database.User{
+			patientID: {UserID: patientUserID},
+		}}
+		doctorRepo := &fakeDoctorRepository{doctors: map[int64]*database.Doctor{
+			doctorID: {DoctorID: doctorID, UserID: specialistUserID},
+		}}
+		paymentRepo := &fakePaymentRepository{payments: map[int64]*database.Payment{
+			pendingID: {PaymentID: 1, AppointmentID: pendingID, Amount: "1500.00", CurrentStatus: database.PaymentStatusPending},
+		}}
+		service := NewAppointmentService(appointmentRepo, patientRepo, doctorRepo, &fakeUserRepository{}, paymentRepo, nil, nil, BookingPolicy{}, RefundPolicy{}, PricingPolicy{}, PaymentHoldConfig{}, &fakeInviteSender{})
+		return service, appointmentRepo
+	}
+	asDoctor := func(appointmentID int64, status string) UpdateAppointmentStatusParams {
+		return UpdateAppointmentStatusParams{UserID: specialistUserID, Role: auth.RoleSpecialist, AppointmentID: appointmentID, Status: status}
+	}
+
+	t.Run("doctor runs the consultation", func(t *testing.T) {
+		service, appointmentRepo := newService()
+		require.NoError(t, service.UpdateAppointmentStatus(context.Background(), asDoctor(scheduledID, "in_progress")))
+		require.NoError(t, service.UpdateAppointmentStatus(context.Background(), asDoctor(scheduledID, "completed")))
+		require.Equal(t, database.AppointmentStatusCompleted, appointmentRepo.appointments[scheduledID].CurrentStatus)
+		require.Len(t, appointmentRepo.history, 2)
+		require.Equal(t, database.AppointmentStatusScheduled, appointmentRepo.history[0].From)
+		require.Equal(t, auth.RoleSpecialist, appointmentRepo.history[0].Actor)
+		require.Equal(t, int64(specialistUserID), appointmentRepo.history[0].ChangedBy)
+	})
+
+	t.Run("unpaid appointments can't be scheduled by hand", func(t *testing.T) {
+		service, appointmentRepo := newService()
+		err := service.UpdateAppointmentStatus(context.Background(), asDoctor(pendingID, "scheduled"))
+		require.ErrorIs(t, err, ErrStatusTransitionForbidden)
+		err = service.UpdateAppointmentStatus(context.Background(), asDoctor(pendingID, "completed"))
+		require.ErrorIs(t, err, ErrInvalidStatusTransition)
+		require.Empty(t, appointmentRepo.history)
+	})
+
+	t.Run("patients can't complete their appointments", func(t *testing.T) {
+		service, _ := newService()
+		err := service.UpdateAppointmentStatus(context.Background(), UpdateAppointmentStatusParams{
+			UserID: patientUserID, Role: auth.RolePatient, AppointmentID: scheduledID, Status: "in_progress",
+		})
+		require.ErrorIs(t, err, ErrStatusTransitionForbidden)
+	})
+
+	t.Run("another doctor's appointment", func(t *testing.T) {
+		service, _ := newService()
+		err := service.UpdateAppointmentStatus(context.Background(), asDoctor(otherID, "in_progress"))
+		require.ErrorIs(t, err, ErrAppointmentAccessDenied)
+	})
+
+	t.Run("unknown status", func(t *testing.T) {
+		service, _ := newService()
+		err := service.UpdateAppointmentStatus(context.Background(), asDoctor(scheduledID, "done"))
+		require.ErrorIs(t, err, ErrInvalidAppointmentStatus)
+	})
+
+	t.Run("cancelled through the refund policy", func(t *testing.T) {
+		service, appointmentRepo := newService()
+		require.NoError(t, service.UpdateAppointmentStatus(context.Background(), asDoctor(pendingID, "cancelled")))
+		require.Equal(t, database.AppointmentStatusCancelled, appointmentRepo.appointments[pendingID].CurrentStatus)
+		require.Len(t, appointmentRepo.history, 1)
+		require.Equal(t, database.AppointmentStatusPendingPayment, appointmentRepo.history[0].From)
+	})
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/mbeka02/lyra_backend/internal/auth"
+	"github.com/mbeka02/lyra_backend/internal/database"
+)
+
+// actors that aren't users
+const (
+	// the payment provider confirming or failing the payment for an appointment
+	actorPayment = "payment"
+	// background jobs such as the hold sweeper
+	actorSystem = "system"
+)
+
+var (
+	ErrInvalidAppointmentStatus  = errors.New("unknown appointment status")
+	ErrInvalidStatusTransition   = errors.New("the appointment can't move from its current status to the requested one")
+	ErrStatusTransitionForbidden = errors.New("you are not allowed to move the appointment to this status")
+)
+
+// appointmentTransitions maps each status to the statuses it can move to and who can make that move ,
+// a status that isn't listed (completed , cancelled) is final
+var appointmentTransitions = map[database.AppointmentStatus]map[database.AppointmentStatus][]string{
+	database.AppointmentStatusPendingPayment: {
+		// only a confirmed payment schedules an appointment
+		database.AppointmentStatusScheduled: {actorPayment},
+		database.AppointmentStatusCancelled: {auth.RolePatient, auth.RoleSpecialist, actorSystem},
+	},
+	database.AppointmentStatusScheduled: {
+		database.AppointmentStatusInProgress: {auth.RoleSpecialist},
+		database.AppointmentStatusCancelled:  {auth.RolePatient, auth.RoleSpecialist},
+	},
+	database.AppointmentStatusInProgress: {
+		database.AppointmentStatusCompleted: {auth.RoleSpecialist},
+	},
+}
+
+// checkStatusTransition returns ErrInvalidStatusTransition if the appointment can't move from one status to the other at all
+// and ErrStatusTransitionForbidden if it can but not by this actor
+func checkStatusTransition(from, to database.AppointmentStatus, actor string) error {
+	actors, ok := appointmentTransitions[from][to]
+	if !ok {
+		return ErrInvalidStatusTransition
+	}
+	for _, allowed := range actors {
+		if allowed == actor {
+			return nil
+		}
+	}
+	return ErrStatusTransitionForbidden
+}
+
+func isAppointmentStatus(status database.AppointmentStatus) bool {
+	switch status {
+	case database.AppointmentStatusPendingPayment,
+		database.AppointmentStatusScheduled,
+		database.AppointmentStatusInProgress,
+		database.AppointmentStatusCompleted,
+		database.AppointmentStatusCancelled:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/audit"
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+)
+
+// number of events read at a time when verifying the chain
+const auditVerifyBatchSize = 1000
+
+// AuditEntry is what the caller knows about an event , who made the request is taken from the context
+type AuditEntry struct {
+	PatientID    int64
+	ResourceType audit.ResourceType
+	ResourceID   string
+	Action       audit.Action
+}
+
+type AuditService interface {
+	// Record appends an event to the audit log , failures are logged and never fail the request
+	Record(ctx context.Context, entry AuditEntry)
+	ListEvents(ctx context.Context, params repository.ListAuditEventsParams) (model.ListAuditEventsResponse, error)
+	// ListRecordAccesses returns who other than the patient has read or changed their record
+	ListRecordAccesses(ctx context.Context, userId int64, limit, offset int32) (model.ListRecordAccessesResponse, error)
+	// VerifyChain recomputes the hash chain to detect edited , inserted or removed events
+	VerifyChain(ctx context.Context) (model.AuditChainVerification, error)
+}
+
+type auditService struct {
+	auditRepo   repository.AuditRepository
+	patientRepo repository.PatientRepository
+}
+
+func NewAuditService(auditRepo repository.AuditRepository, patientRepo repository.PatientRepository) AuditService {
+	return &auditService{
+		auditRepo,
+		patientRepo,
+	}
+}
+
+func (s *auditService) Record(ctx context.Context, entry AuditEntry) {
+	event := audit.Event{
+		PatientID:    entry.PatientID,
+		ResourceType: entry.ResourceType,
+		ResourceID:   entry.ResourceID,
+		Action:       entry.Action,
+		OccurredAt:   time.Now(),
+	}
+	if info, ok := audit.RequestInfoFromContext(ctx); ok {
+		event.ActorUserID = info.ActorUserID
+		event.ActorRole = info.ActorRole
+		event.RequestID = info.RequestID
+		event.ClientIP = info.ClientIP
+	} else {
+		event.ActorRole = "system"
+	}
+	// the event is still recorded if the request was cancelled after the change was made
+	if _, err := s.auditRepo.Append(context.WithoutCancel(ctx), event); err != nil {
+		log.Printf("unable to record audit event %+v: %v", event, err)
+	}
+}
+
+func (s *auditService) ListEvents(ctx context.Context, params repository.ListAuditEventsParams) (model.ListAuditEventsResponse, error) {
+	limit := params.Limit
+	// Fetch the limit+1 to determine if there's more data
+	params.Limit = limit + 1
+	events, err := s.auditRepo.List(ctx, params)
+	if err != nil {
+		return model.ListAuditEventsResponse{}, err
+	}
+	hasMore := false
+	if len(events) > int(limit) {
+		hasMore = true
+		events = events[:limit]
+	}
+	return model.ListAuditEventsResponse{
+		Events:  events,
+		HasMore: hasMore,
+	}, nil
+}
+
+func (s *auditService) ListRecordAccesses(ctx context.Context, userId int64, limit, offset int32) (model.ListRecordAccessesResponse, error) {
+	patientID, err := s.patientRepo.GetPatientIdByUserId(ctx, userId)
+	if err != nil {
+		return model.ListRecordAccessesResponse{}, fmt.Errorf("unable to get the patient details for this account:%v", err)
+	}
+	rows, err := s.auditRepo.ListPatientRecordAccesses(ctx, repository.ListPatientRecordAccessesParams{
+		PatientID:     patientID,
+		PatientUserID: userId,
+		Limit:         limit + 1,
+		Offset:        offset,
+	})
+	if err != nil {
+		return model.ListRecordAccessesResponse{}, err
+	}
+	hasMore := false
+	if len(rows) > int(limit) {
+		hasMore = true
+		rows = rows[:limit]
+	}
+	accesses := make([]model.RecordAccess, len(rows))
+	for i, row := range rows {
+		accesses[i] = model.RecordAccess{
+			ActorName:    row.ActorName.String,
+			ActorRole:    row.ActorRole,
+			ResourceType: row.ResourceType,
+			Action:       row.Action,
+			OccurredAt:   row.OccurredAt,
+		}
+	}
+	return model.ListRecordAccessesResponse{
+		Accesses: accesses,
+		HasMore:  hasMore,
+	}, nil
+}
+
+func (s *auditService) VerifyChain(ctx context.Context) (model.AuditChainVerification, error) {
+	var result model.AuditChainVerification
+	prevHash := audit.GenesisHash
+	var lastEventID int64
+	for {
+		events, err := s.auditRepo.ListChain(ctx, lastEventID, auditVerifyBatchSize)
+		if err != nil {
+			return result, fmt.Errorf("unable to read the audit log:%v", err)
+		}
+		if invalidID, ok := audit.VerifyChain(prevHash, events); !ok {
+			for _, e := range events {
+				if e.EventID == invalidID {
+					break
+				}
+				result.EventsChecked++
+			}
+			result.FirstInvalidEventID = invalidID
+			return result, nil
+		}
+		result.EventsChecked += int64(len(events))
+		if len(events) < auditVerifyBatchSize {
+			result.Valid = true
+			return result, nil
+		}
+		lastEventID = events[len(events)-1].EventID
+		prevHash = events[len(events)-1].Hash
+	}
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/audit"
+	"github.com/mbeka02/lyra_backend/internal/auth"
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAuditRepository keeps the chain in memory
+type fakeAuditRepository struct {
+	repository.AuditRepository
+	events []audit.ChainedEvent
+}
+
+func (f *fakeAuditRepository) Append(ctx context.Context, event audit.Event) (*database.AuditEvent, error) {
+	prevHash := audit.GenesisHash
+	if len(f.events) > 0 {
+		prevHash = f.events[len(f.events)-1].Hash
+	}
+	event.OccurredAt = event.OccurredAt.UTC().Truncate(time.Microsecond)
+	chained := audit.ChainedEvent{
+		EventID:  int64(len(f.events) + 1),
+		PrevHash: prevHash,
+		Hash:     audit.Hash(prevHash, event),
+		Event:    event,
+	}
+	f.events = append(f.events, chained)
+	return &database.AuditEvent{EventID: chained.EventID, Hash: chained.Hash}, nil
+}
+
+func (f *fakeAuditRepository) ListChain(ctx context.Context, afterEventId int64, limit int32) ([]audit.ChainedEvent, error) {
+	var events []audit.ChainedEvent
+	for _, e := range f.events {
+		if e.EventID > afterEventId && len(events) < int(limit) {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// fakeAuditService collects the entries recorded by the other services
+type fakeAuditService struct {
+	AuditService
+	entries []AuditEntry
+}
+
+func (f *fakeAuditService) Record(ctx context.Context, entry AuditEntry) {
+	f.entries = append(f.entries, entry)
+}
+
+func TestRecordAuditEvent(t *testing.T) {
+	auditRepo := &fakeAuditRepository{}
+	auditService := NewAuditService(auditRepo, nil)
+	entry := AuditEntry{
+		PatientID:    patientID,
+		ResourceType: audit.ResourceAllergy,
+		ResourceID:   "4c1b6f0e-3b8f-4c55-9a3e-2f6f1f0e9c11",
+		Action:       audit.ActionRead,
+	}
+
+	ctx := audit.WithRequestInfo(context.Background(), audit.RequestInfo{
+		ActorUserID: specialistUserID,
+		ActorRole:   auth.RoleSpecialist,
+		RequestID:   "host/abc-000001",
+		ClientIP:    "10.0.0.7",
+	})
+	auditService.Record(ctx, entry)
+	// events recorded outside a request are attributed to the system
+	auditService.Record(context.Background(), entry)
+
+	require.Len(t, auditRepo.events, 2)
+	event := auditRepo.events[0].Event
+	require.Equal(t, int64(specialistUserID), event.ActorUserID)
+	require.Equal(t, auth.RoleSpecialist, event.ActorRole)
+	require.Equal(t, "host/abc-000001", event.RequestID)
+	require.Equal(t, "10.0.0.7", event.ClientIP)
+	require.Equal(t, int64(patientID), event.PatientID)
+	require.Equal(t, audit.ResourceAllergy, event.ResourceType)
+	require.Equal(t, entry.ResourceID, event.ResourceID)
+	require.Equal(t, audit.ActionRead, event.Action)
+	require.WithinDuration(t, time.Now(), event.OccurredAt, time.Minute)
+
+	require.Equal(t, int64(0), auditRepo.events[1].Event.ActorUserID)
+	require.Equal(t, "system", auditRepo.events[1].Event.ActorRole)
+}
+
+func TestVerifyAuditChain(t *testing.T) {
+	auditRepo := &fakeAuditRepository{}
+	auditService := NewAuditService(auditRepo, nil)
+	ctx := context.Background()
+
+	result, err := auditService.VerifyChain(ctx)
+	require.NoError(t, err)
+	require.True(t, result.Valid)
+	require.Zero(t, result.EventsChecked)
+
+	// enough events to span more than one batch
+	total := auditVerifyBatchSize + 5
+	for i := 0; i < total; i++ {
+		auditService.Record(ctx, AuditEntry{PatientID: int64(i), ResourceType: audit.ResourcePatient, Action: audit.ActionRead})
+	}
+	result, err = auditService.VerifyChain(ctx)
+	require.NoError(t, err)
+	require.True(t, result.Valid)
+	require.Equal(t, int64(total), result.EventsChecked)
+
+	// edit an event in the second batch
+	tampered := &auditRepo.events[auditVerifyBatchSize+2]
+	tampered.Event.PatientID = 999
+	result, err = auditService.VerifyChain(ctx)
+	require.NoError(t, err)
+	require.False(t, result.Valid)
+	require.Equal(t, tampered.EventID, result.FirstInvalidEventID)
+	require.Equal(t, int64(auditVerifyBatchSize+2), result.EventsChecked)
+}
@@ -2,32 +2,142 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/mbeka02/lyra_backend/internal/database"
 	"github.com/mbeka02/lyra_backend/internal/model"
 	"github.com/mbeka02/lyra_backend/internal/server/repository"
 )
 
+var (
+	ErrInvalidExceptionRange = errors.New("an exception has to end after it starts and can't be entirely in the past")
+	ErrInvalidExtraHours     = errors.New("extra hours have to start in the future , fit in a single day and hold at least one slot")
+	ErrExceptionNotFound     = errors.New("exception not found")
+	// ErrScheduleConflict is returned with the appointments that are in the way of a block or a holiday
+	ErrScheduleConflict    = errors.New("you have appointments at this time , they have to be cancelled or rescheduled first")
+	ErrInvalidBookingRules = errors.New("the minimum notice has to be shorter than the booking horizon")
+	ErrInvalidSearchRange  = fmt.Errorf("a slot search has to end after it starts and cover at most %d days", maxSearchDays)
+)
+
+const (
+	// extra hours without an interval are split into hour long slots like the weekly windows
+	defaultIntervalMinutes = 60
+	// a search generates the slots of every matching doctor for each day so the range is kept short
+	maxSearchDays         = 14
+	defaultSlotsPerDoctor = 3
+	maxSlotsPerDoctor     = 10
+)
+
 type availabilityService struct {
 	availabilityRepo repository.AvailabilityRepository
 	doctorRepo       repository.DoctorRepository
+	paymentHold      PaymentHoldConfig
 }
 
 type AvailabilityService interface {
 	CreateAvailability(ctx context.Context, req model.CreateAvailabilityRequest, userId int64) (*database.Availability, error)
 	GetAvailabilityByDoctor(ctx context.Context, userId int64) ([]database.Availability, error)
-	GetSlots(ctx context.Context, req model.GetSlotsRequest) ([]database.GetAppointmentSlotsRow, error)
+	// GetSlots returns the slots of a doctor on a date of their calendar
+	GetSlots(ctx context.Context, req model.GetSlotsRequest) ([]model.Slot, error)
+	// SearchSlots returns a page of the doctors that match the filters with their earliest open slots in the range ,
+	// the doctors that can be seen soonest come first
+	SearchSlots(ctx context.Context, req model.SlotSearchRequest) (model.SlotSearchResponse, error)
 	DeleteById(ctx context.Context, avavailabilityId int64, userId int64) error
 	DeleteByDay(ctx context.Context, dayOfWeek int32, userId int64) error
+	// CreateException blocks a range of the doctor's schedule or adds extra hours on a date ,
+	// a block that overlaps active appointments is refused with ErrScheduleConflict and the appointments
+	CreateException(ctx context.Context, req model.CreateAvailabilityExceptionRequest, userId int64) (*database.AvailabilityException, []database.ListBlockConflictsRow, error)
+	ListExceptions(ctx context.Context, userId int64, from, to time.Time) ([]database.AvailabilityException, error)
+	DeleteException(ctx context.Context, exceptionId int64, userId int64) error
+	ListHolidays(ctx context.Context, from, to time.Time) ([]database.PublicHoliday, error)
+	// SetObservesHolidays opts the doctor in or out of the public holidays , opting in with appointments on an upcoming holiday is refused like a block
+	SetObservesHolidays(ctx context.Context, userId int64, observes bool) ([]database.ListBlockConflictsRow, error)
+	// SetTimezone changes the timezone the doctor's weekly availability is in , booked appointments keep their times
+	SetTimezone(ctx context.Context, userId int64, timezone string) (string, error)
+	// GetBookingRules returns the doctor's booking rules , doctors that haven't set any get rules that allow every booking
+	GetBookingRules(ctx context.Context, userId int64) (*database.BookingRule, error)
+	SetBookingRules(ctx context.Context, req model.SetBookingRulesRequest, userId int64) (*database.BookingRule, error)
 }
 
-func (s *availabilityService) GetSlots(ctx context.Context, req model.GetSlotsRequest) ([]database.GetAppointmentSlotsRow, error) {
-	return s.availabilityRepo.GetSlots(ctx, repository.GetSlotsParams{
+func (s *availabilityService) GetSlots(ctx context.Context, req model.GetSlotsRequest) ([]model.Slot, error) {
+	rows, err := s.availabilityRepo.GetSlots(ctx, repository.GetSlotsParams{
 		DoctorID:  req.DoctorID,
-		DayOfWeek: req.DayOfWeek,
-		SlotDate:  req.SlotDate,
+		SlotDate:  calendarDate(req.SlotDate),
+		HeldAfter: s.paymentHold.heldAfter(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newSlots(rows)
+}
+
+func (s *availabilityService) SearchSlots(ctx context.Context, req model.SlotSearchRequest) (model.SlotSearchResponse, error) {
+	from, to := calendarDate(req.From), calendarDate(req.To)
+	if !from.Before(to) || to.Sub(from) > maxSearchDays*24*time.Hour {
+		return model.SlotSearchResponse{}, ErrInvalidSearchRange
+	}
+	slotsPerDoctor := req.SlotsPerDoctor
+	if slotsPerDoctor <= 0 {
+		slotsPerDoctor = defaultSlotsPerDoctor
+	}
+	slotsPerDoctor = min(slotsPerDoctor, maxSlotsPerDoctor)
+
+	rows, err := s.availabilityRepo.SearchSlots(ctx, repository.SearchSlotsParams{
+		County:         req.County,
+		Specialization: req.Specialization,
+		MinPrice:       req.MinPrice,
+		MaxPrice:       req.MaxPrice,
+		MinExperience:  req.MinExperience,
+		MaxExperience:  req.MaxExperience,
+		From:           from,
+		To:             to,
+		HeldAfter:      s.paymentHold.heldAfter(),
+		SlotsPerDoctor: slotsPerDoctor,
+		// Fetch the limit+1 doctors to determine if there's more data
+		Limit:  req.Limit + 1,
+		Offset: req.Offset,
 	})
+	if err != nil {
+		return model.SlotSearchResponse{}, fmt.Errorf("unable to search for slots:%v", err)
+	}
+	// the rows of a doctor are next to each other
+	doctors := []model.DoctorSlots{}
+	for _, row := range rows {
+		if len(doctors) == 0 || doctors[len(doctors)-1].DoctorID != row.DoctorID {
+			doctors = append(doctors, model.DoctorSlots{
+				DoctorDetails: model.DoctorDetails{
+					DoctorID:          row.DoctorID,
+					FullName:          row.FullName,
+					Specialization:    row.Specialization,
+					ProfileImageUrl:   row.ProfileImageUrl,
+					Description:       row.Description,
+					County:            row.County,
+					PricePerHour:      row.PricePerHour,
+					YearsOfExperience: row.YearsOfExperience,
+					Timezone:          row.Timezone,
+				},
+				Slots: []model.Slot{},
+			})
+		}
+		slot, err := newSlot(row.SlotStart, row.SlotEnd, row.Timezone, row.SlotStartTime, row.SlotEndTime, "available")
+		if err != nil {
+			return model.SlotSearchResponse{}, err
+		}
+		current := &doctors[len(doctors)-1]
+		current.Slots = append(current.Slots, slot)
+	}
+	hasMore := false
+	if len(doctors) > int(req.Limit) {
+		hasMore = true
+		doctors = doctors[:req.Limit]
+	}
+	return model.SlotSearchResponse{
+		HasMore: hasMore,
+		Doctors: doctors,
+	}, nil
 }
 
 func (s *availabilityService) DeleteById(ctx context.Context, avavailabilityId int64, userId int64) error {
@@ -46,10 +156,11 @@ func (s *availabilityService) DeleteByDay(ctx context.Context, dayOfWeek int32,
 	return s.availabilityRepo.DeleteByDay(ctx, dayOfWeek, doctorId)
 }
 
-func NewAvailabilityService(availabilityRepo repository.AvailabilityRepository, doctorRepo repository.DoctorRepository) AvailabilityService {
+func NewAvailabilityService(availabilityRepo repository.AvailabilityRepository, doctorRepo repository.DoctorRepository, paymentHold PaymentHoldConfig) AvailabilityService {
 	return &availabilityService{
 		availabilityRepo,
 		doctorRepo,
+		paymentHold,
 	}
 }
 
@@ -76,3 +187,132 @@ func (s *availabilityService) GetAvailabilityByDoctor(ctx context.Context, userI
 
 	return s.availabilityRepo.GetByDoctor(ctx, doctorId)
 }
+
+func (s *availabilityService) CreateException(ctx context.Context, req model.CreateAvailabilityExceptionRequest, userId int64) (*database.AvailabilityException, []database.ListBlockConflictsRow, error) {
+	doctorId, err := s.doctorRepo.GetDoctorIdByUserId(ctx, userId)
+	if err != nil {
+		return nil, nil, errors.New("unable to get the user details of this account")
+	}
+	if !req.EndsAt.After(req.StartsAt) || !req.EndsAt.After(time.Now()) {
+		return nil, nil, ErrInvalidExceptionRange
+	}
+	kind := database.AvailabilityExceptionKind(req.Kind)
+	// blocks don't have slots , the interval only applies to extra hours
+	interval := int32(defaultIntervalMinutes)
+	if kind == database.AvailabilityExceptionKindExtra {
+		if req.IntervalMinutes != 0 {
+			interval = req.IntervalMinutes
+		}
+		length := req.EndsAt.Sub(req.StartsAt)
+		if interval < 0 || !req.StartsAt.After(time.Now()) || length > 24*time.Hour || length < time.Duration(interval)*time.Minute {
+			return nil, nil, ErrInvalidExtraHours
+		}
+	}
+	exception, conflicts, err := s.availabilityRepo.CreateException(ctx, repository.CreateExceptionParams{
+		DoctorID:        doctorId,
+		Kind:            kind,
+		StartsAt:        req.StartsAt,
+		EndsAt:          req.EndsAt,
+		IntervalMinutes: interval,
+		Reason:          req.Reason,
+		HeldAfter:       s.paymentHold.heldAfter(),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to add the exception:%v", err)
+	}
+	if len(conflicts) > 0 {
+		return nil, conflicts, ErrScheduleConflict
+	}
+	return exception, nil, nil
+}
+
+func (s *availabilityService) ListExceptions(ctx context.Context, userId int64, from, to time.Time) ([]database.AvailabilityException, error) {
+	doctorId, err := s.doctorRepo.GetDoctorIdByUserId(ctx, userId)
+	if err != nil {
+		return nil, errors.New("unable to get the user details of this account")
+	}
+	return s.availabilityRepo.ListExceptions(ctx, doctorId, from, to)
+}
+
+func (s *availabilityService) DeleteException(ctx context.Context, exceptionId int64, userId int64) error {
+	doctorId, err := s.doctorRepo.GetDoctorIdByUserId(ctx, userId)
+	if err != nil {
+		return errors.New("unable to get the user details of this account")
+	}
+	if err := s.availabilityRepo.DeleteException(ctx, exceptionId, doctorId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrExceptionNotFound
+		}
+		return fmt.Errorf("unable to remove the exception:%v", err)
+	}
+	return nil
+}
+
+func (s *availabilityService) ListHolidays(ctx context.Context, from, to time.Time) ([]database.PublicHoliday, error) {
+	return s.availabilityRepo.ListHolidays(ctx, from, to)
+}
+
+func (s *availabilityService) SetObservesHolidays(ctx context.Context, userId int64, observes bool) ([]database.ListBlockConflictsRow, error) {
+	doctorId, err := s.doctorRepo.GetDoctorIdByUserId(ctx, userId)
+	if err != nil {
+		return nil, errors.New("unable to get the user details of this account")
+	}
+	conflicts, err := s.availabilityRepo.SetObservesHolidays(ctx, doctorId, observes, s.paymentHold.heldAfter())
+	if err != nil {
+		return nil, fmt.Errorf("unable to update the holiday setting:%v", err)
+	}
+	if len(conflicts) > 0 {
+		return conflicts, ErrScheduleConflict
+	}
+	return nil, nil
+}
+
+func (s *availabilityService) SetTimezone(ctx context.Context, userId int64, timezone string) (string, error) {
+	if _, err := LoadTimezone(timezone); err != nil {
+		return "", err
+	}
+	doctorId, err := s.doctorRepo.GetDoctorIdByUserId(ctx, userId)
+	if err != nil {
+		return "", errors.New("unable to get the user details of this account")
+	}
+	updated, err := s.availabilityRepo.SetTimezone(ctx, doctorId, timezone)
+	if err != nil {
+		return "", fmt.Errorf("unable to update the timezone:%v", err)
+	}
+	return updated, nil
+}
+
+func (s *availabilityService) GetBookingRules(ctx context.Context, userId int64) (*database.BookingRule, error) {
+	doctorId, err := s.doctorRepo.GetDoctorIdByUserId(ctx, userId)
+	if err != nil {
+		return nil, errors.New("unable to get the user details of this account")
+	}
+	rules, err := s.availabilityRepo.GetBookingRules(ctx, doctorId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &database.BookingRule{DoctorID: doctorId}, nil
+		}
+		return nil, fmt.Errorf("unable to get the booking rules:%v", err)
+	}
+	return rules, nil
+}
+
+func (s *availabilityService) SetBookingRules(ctx context.Context, req model.SetBookingRulesRequest, userId int64) (*database.BookingRule, error) {
+	if req.HorizonDays > 0 && time.Duration(req.MinNoticeMinutes)*time.Minute >= time.Duration(req.HorizonDays)*24*time.Hour {
+		return nil, ErrInvalidBookingRules
+	}
+	doctorId, err := s.doctorRepo.GetDoctorIdByUserId(ctx, userId)
+	if err != nil {
+		return nil, errors.New("unable to get the user details of this account")
+	}
+	rules, err := s.availabilityRepo.SetBookingRules(ctx, repository.SetBookingRulesParams{
+		DoctorID:         doctorId,
+		BufferMinutes:    req.BufferMinutes,
+		MinNoticeMinutes: req.MinNoticeMinutes,
+		HorizonDays:      req.HorizonDays,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to update the booking rules:%v", err)
+	}
+	return rules, nil
+}
@@ -0,0 +1,277 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAvailabilityRepository struct {
+	repository.AvailabilityRepository
+	// the appointments that are in the way of blocks and holidays
+	conflicts  []database.ListBlockConflictsRow
+	exceptions []repository.CreateExceptionParams
+	observes   bool
+	// the slots returned by GetSlots and the params they were asked for with
+	slots       []database.GetAppointmentSlotsRow
+	slotsParams repository.GetSlotsParams
+	// the rows returned by SearchSlots and the params of the last search
+	searchRows   []database.SearchAvailableSlotsRow
+	searchParams repository.SearchSlotsParams
+	rules        *database.BookingRule
+}
+
+func (f *fakeAvailabilityRepository) GetBookingRules(ctx context.Context, doctorId int64) (*database.BookingRule, error) {
+	if f.rules == nil {
+		return nil, sql.ErrNoRows
+	}
+	return f.rules, nil
+}
+
+func (f *fakeAvailabilityRepository) SetBookingRules(ctx context.Context, params repository.SetBookingRulesParams) (*database.BookingRule, error) {
+	f.rules = &database.BookingRule{
+		DoctorID:         params.DoctorID,
+		BufferMinutes:    params.BufferMinutes,
+		MinNoticeMinutes: params.MinNoticeMinutes,
+		HorizonDays:      params.HorizonDays,
+	}
+	return f.rules, nil
+}
+
+func (f *fakeAvailabilityRepository) SearchSlots(ctx context.Context, params repository.SearchSlotsParams) ([]database.SearchAvailableSlotsRow, error) {
+	f.searchParams = params
+	return f.searchRows, nil
+}
+
+func (f *fakeAvailabilityRepository) GetSlots(ctx context.Context, params repository.GetSlotsParams) ([]database.GetAppointmentSlotsRow, error) {
+	f.slotsParams = params
+	return f.slots, nil
+}
+
+func (f *fakeAvailabilityRepository) CreateException(ctx context.Context, params repository.CreateExceptionParams) (*database.AvailabilityException, []database.ListBlockConflictsRow, error) {
+	if params.Kind == database.AvailabilityExceptionKindBlock && len(f.conflicts) > 0 {
+		return nil, f.conflicts, nil
+	}
+	f.exceptions = append(f.exceptions, params)
+	return &database.AvailabilityException{
+		ExceptionID:     int64(len(f.exceptions)),
+		DoctorID:        params.DoctorID,
+		Kind:            params.Kind,
+		StartsAt:        params.StartsAt,
+		EndsAt:          params.EndsAt,
+		IntervalMinutes: params.IntervalMinutes,
+		Reason:          params.Reason,
+	}, nil, nil
+}
+
+func (f *fakeAvailabilityRepository) SetObservesHolidays(ctx context.Context, doctorId int64, observes bool, heldAfter time.Time) ([]database.ListBlockConflictsRow, error) {
+	if observes && len(f.conflicts) > 0 {
+		return f.conflicts, nil
+	}
+	f.observes = observes
+	return nil, nil
+}
+
+func TestCreateAvailabilityException(t *testing.T) {
+	doctorRepo := &fakeDoctorRepository{doctors: map[int64]*database.Doctor{
+		doctorID: {DoctorID: doctorID, UserID: specialistUserID},
+	}}
+	tomorrow := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+
+	t.Run("blocks a range", func(t *testing.T) {
+		availabilityRepo := &fakeAvailabilityRepository{}
+		service := NewAvailabilityService(availabilityRepo, doctorRepo, PaymentHoldConfig{Duration: 15 * time.Minute})
+		exception, conflicts, err := service.CreateException(context.Background(), model.CreateAvailabilityExceptionRequest{
+			Kind:     "block",
+			StartsAt: tomorrow,
+			EndsAt:   tomorrow.AddDate(0, 0, 7),
+			Reason:   "vacation",
+		}, specialistUserID)
+		require.NoError(t, err)
+		require.Empty(t, conflicts)
+		require.Equal(t, database.AvailabilityExceptionKindBlock, exception.Kind)
+		require.Equal(t, int64(doctorID), availabilityRepo.exceptions[0].DoctorID)
+	})
+
+	t.Run("extra hours default to hour long slots", func(t *testing.T) {
+		availabilityRepo := &fakeAvailabilityRepository{}
+		service := NewAvailabilityService(availabilityRepo, doctorRepo, PaymentHoldConfig{})
+		exception, _, err := service.CreateException(context.Background(), model.CreateAvailabilityExceptionRequest{
+			Kind:     "extra",
+			StartsAt: tomorrow,
+			EndsAt:   tomorrow.Add(3 * time.Hour),
+		}, specialistUserID)
+		require.NoError(t, err)
+		require.Equal(t, int32(defaultIntervalMinutes), exception.IntervalMinutes)
+	})
+
+	t.Run("blocks over appointments are refused", func(t *testing.T) {
+		availabilityRepo := &fakeAvailabilityRepository{conflicts: []database.ListBlockConflictsRow{
+			{AppointmentID: 1, StartTime: tomorrow.Add(time.Hour), EndTime: tomorrow.Add(2 * time.Hour), CurrentStatus: database.AppointmentStatusScheduled},
+		}}
+		service := NewAvailabilityService(availabilityRepo, doctorRepo, PaymentHoldConfig{})
+		_, conflicts, err := service.CreateException(context.Background(), model.CreateAvailabilityExceptionRequest{
+			Kind:     "block",
+			StartsAt: tomorrow,
+			EndsAt:   tomorrow.Add(4 * time.Hour),
+		}, specialistUserID)
+		require.ErrorIs(t, err, ErrScheduleConflict)
+		require.Len(t, conflicts, 1)
+		require.Empty(t, availabilityRepo.exceptions)
+	})
+
+	invalid := []struct {
+		name    string
+		request model.CreateAvailabilityExceptionRequest
+		err     error
+	}{
+		{"ends before it starts", model.CreateAvailabilityExceptionRequest{Kind: "block", StartsAt: tomorrow, EndsAt: tomorrow.Add(-time.Hour)}, ErrInvalidExceptionRange},
+		{"in the past", model.CreateAvailabilityExceptionRequest{Kind: "block", StartsAt: tomorrow.AddDate(0, 0, -3), EndsAt: tomorrow.AddDate(0, 0, -2)}, ErrInvalidExceptionRange},
+		{"extra hours over more than a day", model.CreateAvailabilityExceptionRequest{Kind: "extra", StartsAt: tomorrow, EndsAt: tomorrow.Add(25 * time.Hour)}, ErrInvalidExtraHours},
+		{"extra hours shorter than a slot", model.CreateAvailabilityExceptionRequest{Kind: "extra", StartsAt: tomorrow, EndsAt: tomorrow.Add(30 * time.Minute), IntervalMinutes: 45}, ErrInvalidExtraHours},
+		{"extra hours that have started", model.CreateAvailabilityExceptionRequest{Kind: "extra", StartsAt: time.Now().Add(-time.Hour), EndsAt: time.Now().Add(time.Hour)}, ErrInvalidExtraHours},
+	}
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			availabilityRepo := &fakeAvailabilityRepository{}
+			service := NewAvailabilityService(availabilityRepo, doctorRepo, PaymentHoldConfig{})
+			_, _, err := service.CreateException(context.Background(), tc.request, specialistUserID)
+			require.ErrorIs(t, err, tc.err)
+			require.Empty(t, availabilityRepo.exceptions)
+		})
+	}
+}
+
+func TestSetObservesHolidays(t *testing.T) {
+	doctorRepo := &fakeDoctorRepository{doctors: map[int64]*database.Doctor{
+		doctorID: {DoctorID: doctorID, UserID: specialistUserID},
+	}}
+
+	t.Run("opts in", func(t *testing.T) {
+		availabilityRepo := &fakeAvailabilityRepository{}
+		service := NewAvailabilityService(availabilityRepo, doctorRepo, PaymentHoldConfig{})
+		_, err := service.SetObservesHolidays(context.Background(), specialistUserID, true)
+		require.NoError(t, err)
+		require.True(t, availabilityRepo.observes)
+	})
+
+	t.Run("appointments on a holiday are in the way", func(t *testing.T) {
+		availabilityRepo := &fakeAvailabilityRepository{conflicts: []database.ListBlockConflictsRow{{AppointmentID: 1}}}
+		service := NewAvailabilityService(availabilityRepo, doctorRepo, PaymentHoldConfig{})
+		conflicts, err := service.SetObservesHolidays(context.Background(), specialistUserID, true)
+		require.ErrorIs(t, err, ErrScheduleConflict)
+		require.Len(t, conflicts, 1)
+		require.False(t, availabilityRepo.observes)
+
+		// opting out is never in the way
+		_, err = service.SetObservesHolidays(context.Background(), specialistUserID, false)
+		require.NoError(t, err)
+	})
+}
+
+func TestSearchSlots(t *testing.T) {
+	monday := time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	row := func(doctorId int64, hour int) database.SearchAvailableSlotsRow {
+		start := time.Date(2026, time.October, 19, hour, 0, 0, 0, time.UTC)
+		return database.SearchAvailableSlotsRow{
+			DoctorID:  doctorId,
+			FullName:  "Dr. Test",
+			Timezone:  "Africa/Nairobi",
+			SlotStart: start,
+			SlotEnd:   start.Add(time.Hour),
+		}
+	}
+
+	t.Run("groups the slots of each doctor", func(t *testing.T) {
+		availabilityRepo := &fakeAvailabilityRepository{searchRows: []database.SearchAvailableSlotsRow{
+			row(1, 6), row(1, 7), row(2, 8), row(3, 9), row(3, 10),
+		}}
+		service := NewAvailabilityService(availabilityRepo, &fakeDoctorRepository{}, PaymentHoldConfig{})
+		response, err := service.SearchSlots(context.Background(), model.SlotSearchRequest{
+			From:  monday,
+			To:    monday.AddDate(0, 0, 7),
+			Limit: 2,
+		})
+		require.NoError(t, err)
+		// a page more than the limit is asked for to tell if there are more doctors
+		require.Equal(t, int32(3), availabilityRepo.searchParams.Limit)
+		require.Equal(t, int32(defaultSlotsPerDoctor), availabilityRepo.searchParams.SlotsPerDoctor)
+		require.True(t, response.HasMore)
+		require.Len(t, response.Doctors, 2)
+		require.Len(t, response.Doctors[0].Slots, 2)
+		require.Len(t, response.Doctors[1].Slots, 1)
+		require.Equal(t, "available", response.Doctors[1].Slots[0].SlotStatus)
+		require.Equal(t, 11, response.Doctors[1].Slots[0].LocalStartTime.Hour())
+	})
+
+	t.Run("the last page", func(t *testing.T) {
+		availabilityRepo := &fakeAvailabilityRepository{searchRows: []database.SearchAvailableSlotsRow{row(1, 6)}}
+		service := NewAvailabilityService(availabilityRepo, &fakeDoctorRepository{}, PaymentHoldConfig{})
+		response, err := service.SearchSlots(context.Background(), model.SlotSearchRequest{
+			From:           monday,
+			To:             monday.AddDate(0, 0, 1),
+			SlotsPerDoctor: 50,
+			Limit:          10,
+		})
+		require.NoError(t, err)
+		require.False(t, response.HasMore)
+		require.Len(t, response.Doctors, 1)
+		require.Equal(t, int32(maxSlotsPerDoctor), availabilityRepo.searchParams.SlotsPerDoctor)
+	})
+
+	invalid := []struct {
+		name     string
+		from, to time.Time
+	}{
+		{"ends before it starts", monday, monday.AddDate(0, 0, -1)},
+		{"empty", monday, monday},
+		{"too long", monday, monday.AddDate(0, 0, maxSearchDays+1)},
+	}
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			availabilityRepo := &fakeAvailabilityRepository{}
+			service := NewAvailabilityService(availabilityRepo, &fakeDoctorRepository{}, PaymentHoldConfig{})
+			_, err := service.SearchSlots(context.Background(), model.SlotSearchRequest{From: tc.from, To: tc.to, Limit: 10})
+			require.ErrorIs(t, err, ErrInvalidSearchRange)
+		})
+	}
+}
+
+func TestBookingRules(t *testing.T) {
+	doctorRepo := &fakeDoctorRepository{doctors: map[int64]*database.Doctor{
+		doctorID: {DoctorID: doctorID, UserID: specialistUserID},
+	}}
+	availabilityRepo := &fakeAvailabilityRepository{}
+	service := NewAvailabilityService(availabilityRepo, doctorRepo, PaymentHoldConfig{})
+
+	// doctors without rules can be booked at any time
+	rules, err := service.GetBookingRules(context.Background(), specialistUserID)
+	require.NoError(t, err)
+	require.Equal(t, database.BookingRule{DoctorID: doctorID}, *rules)
+
+	_, err = service.SetBookingRules(context.Background(), model.SetBookingRulesRequest{
+		BufferMinutes:    10,
+		MinNoticeMinutes: 120,
+		HorizonDays:      60,
+	}, specialistUserID)
+	require.NoError(t, err)
+	rules, err = service.GetBookingRules(context.Background(), specialistUserID)
+	require.NoError(t, err)
+	require.Equal(t, int32(10), rules.BufferMinutes)
+	require.Equal(t, int32(120), rules.MinNoticeMinutes)
+	require.Equal(t, int32(60), rules.HorizonDays)
+
+	// nothing could be booked if the notice was as long as the horizon
+	_, err = service.SetBookingRules(context.Background(), model.SetBookingRulesRequest{
+		MinNoticeMinutes: 2 * 24 * 60,
+		HorizonDays:      2,
+	}, specialistUserID)
+	require.ErrorIs(t, err, ErrInvalidBookingRules)
+	require.Equal(t, int32(60), availabilityRepo.rules.HorizonDays)
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/audit"
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/mailer"
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+)
+
+var (
+	ErrPatientNotFound     = errors.New("patient not found")
+	ErrBreakGlassNotNeeded = errors.New("the patient is already under your care")
+)
+
+type BreakGlassConfig struct {
+	// how long a grant gives access for
+	Duration time.Duration
+}
+
+// BreakGlassService gives specialists time-boxed emergency access to patients they have no care relationship with
+type BreakGlassService interface {
+	// GrantAccess records the grant and notifies the patient
+	GrantAccess(ctx context.Context, userId int64, req model.BreakGlassRequest) (*model.BreakGlassGrantResponse, error)
+	// ListGrants reports the grants made between from and to , patientId and doctorId are optional filters
+	ListGrants(ctx context.Context, from, to time.Time, patientId, doctorId int64, limit, offset int32) (model.ListBreakGlassGrantsResponse, error)
+	// ListAccesses returns the reads made under a grant
+	ListAccesses(ctx context.Context, grantId int64) ([]database.BreakGlassAccess, error)
+}
+
+type breakGlassService struct {
+	breakGlassRepo repository.BreakGlassRepository
+	patientRepo    repository.PatientRepository
+	userRepo       repository.UserRepository
+	doctorService  DoctorService
+	mailer         mailer.Mailer
+	auditService   AuditService
+	config         BreakGlassConfig
+}
+
+func NewBreakGlassService(breakGlassRepo repository.BreakGlassRepository, patientRepo repository.PatientRepository, userRepo repository.UserRepository, doctorService DoctorService, mailer mailer.Mailer, auditService AuditService, config BreakGlassConfig) BreakGlassService {
+	return &breakGlassService{
+		breakGlassRepo,
+		patientRepo,
+		userRepo,
+		doctorService,
+		mailer,
+		auditService,
+		config,
+	}
+}
+
+func (s *breakGlassService) GrantAccess(ctx context.Context, userId int64, req model.BreakGlassRequest) (*model.BreakGlassGrantResponse, error) {
+	doctorID, err := s.doctorService.GetDoctorIdByUserId(ctx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the doctor details for this account:%v", err)
+	}
+	patient, err := s.patientRepo.GetPatientAccountDetails(ctx, req.PatientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPatientNotFound
+		}
+		return nil, fmt.Errorf("unable to get the patient details:%v", err)
+	}
+	underCare, err := s.doctorService.IsPatientUnderCare(ctx, doctorID, req.PatientID)
+	if err != nil {
+		return nil, err
+	}
+	if underCare {
+		return nil, ErrBreakGlassNotNeeded
+	}
+	grant, err := s.breakGlassRepo.CreateGrant(ctx, repository.CreateBreakGlassGrantParams{
+		DoctorID:  doctorID,
+		PatientID: req.PatientID,
+		Reason:    req.Reason,
+		ExpiresAt: time.Now().Add(s.config.Duration),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to save the emergency access grant:%v", err)
+	}
+	log.Printf("break-glass: doctor %d was granted access to patient %d until %s (grant %d)", doctorID, req.PatientID, grant.ExpiresAt.Format(time.RFC3339), grant.GrantID)
+	s.auditService.Record(ctx, AuditEntry{
+		PatientID:    req.PatientID,
+		ResourceType: audit.ResourceBreakGlass,
+		ResourceID:   strconv.FormatInt(grant.GrantID, 10),
+		Action:       audit.ActionBreakGlass,
+	})
+
+	doctor, err := s.userRepo.GetById(ctx, userId)
+	if err != nil {
+		log.Printf("unable to get the doctor's details for break-glass grant %d: %v", grant.GrantID, err)
+	} else {
+		email := mailer.NewBreakGlassNotificationEmail(patient.User.FullName, patient.User.Email, doctor.FullName, grant.Reason, grant.ExpiresAt)
+		if err := s.mailer.Send(ctx, email); err != nil {
+			log.Printf("unable to notify patient %d about break-glass grant %d: %v", req.PatientID, grant.GrantID, err)
+		}
+	}
+
+	return &model.BreakGlassGrantResponse{
+		GrantID:   grant.GrantID,
+		PatientID: grant.PatientID,
+		Reason:    grant.Reason,
+		ExpiresAt: grant.ExpiresAt,
+		CreatedAt: grant.CreatedAt,
+	}, nil
+}
+
+func (s *breakGlassService) ListGrants(ctx context.Context, from, to time.Time, patientId, doctorId int64, limit, offset int32) (model.ListBreakGlassGrantsResponse, error) {
+	rows, err := s.breakGlassRepo.ListGrants(ctx, repository.ListBreakGlassGrantsParams{
+		CreatedAfter:  from,
+		CreatedBefore: to,
+		PatientID:     patientId,
+		DoctorID:      doctorId,
+		// Fetch the limit+1 to determine if there's more data
+		Limit:  limit + 1,
+		Offset: offset,
+	})
+	if err != nil {
+		return model.ListBreakGlassGrantsResponse{}, err
+	}
+	hasMore := false
+	if len(rows) > int(limit) {
+		hasMore = true
+		rows = rows[:limit]
+	}
+	grants := make([]model.BreakGlassGrantReport, len(rows))
+	for i, row := range rows {
+		grants[i] = model.BreakGlassGrantReport{
+			GrantID:     row.GrantID,
+			DoctorID:    row.DoctorID,
+			DoctorName:  row.DoctorName,
+			PatientID:   row.PatientID,
+			PatientName: row.PatientName,
+			Reason:      row.Reason,
+			ExpiresAt:   row.ExpiresAt,
+			CreatedAt:   row.CreatedAt,
+			AccessCount: row.AccessCount,
+		}
+	}
+	return model.ListBreakGlassGrantsResponse{
+		Grants:  grants,
+		HasMore: hasMore,
+	}, nil
+}
+
+func (s *breakGlassService) ListAccesses(ctx context.Context, grantId int64) ([]database.BreakGlassAccess, error) {
+	return s.breakGlassRepo.ListAccesses(ctx, grantId)
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/audit"
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/mailer"
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePatientRepository struct {
+	repository.PatientRepository
+	users map[int64]database.User
+}
+
+func (f *fakePatientRepository) GetPatientAccountDetails(ctx context.Context, patientID int64) (*repository.GetPatientAccountDetailsTxResult, error) {
+	user, ok := f.users[patientID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &repository.GetPatientAccountDetailsTxResult{
+		User:    user,
+		Patient: database.Patient{PatientID: patientID, UserID: user.UserID},
+	}, nil
+}
+
+type fakeUserRepository struct {
+	repository.UserRepository
+	users map[int64]database.User
+}
+
+func (f *fakeUserRepository) GetById(ctx context.Context, userId int64) (*database.User, error) {
+	user, ok := f.users[userId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &user, nil
+}
+
+type fakeMailer struct {
+	sent []mailer.Message
+}
+
+func (f *fakeMailer) Send(ctx context.Context, message mailer.Message) error {
+	f.sent = append(f.sent, message)
+	return nil
+}
+
+func TestGrantBreakGlassAccess(t *testing.T) {
+	breakGlassRepo := &fakeBreakGlassRepository{}
+	mail := &fakeMailer{}
+	auditService := &fakeAuditService{}
+	breakGlassService := NewBreakGlassService(
+		breakGlassRepo,
+		&fakePatientRepository{users: map[int64]database.User{
+			patientID:          {UserID: patientUserID, FullName: "Jane Wanjiru", Email: "jane@example.com"},
+			unrelatedPatientID: {UserID: 4, FullName: "Otieno Omondi", Email: "otieno@example.com"},
+		}},
+		&fakeUserRepository{users: map[int64]database.User{specialistUserID: {UserID: specialistUserID, FullName: "Amina Hassan"}}},
+		&fakeDoctorService{
+			doctorIDs: map[int64]int64{specialistUserID: doctorID},
+			patients:  map[int64][]int64{doctorID: {patientID}},
+		},
+		mail,
+		auditService,
+		BreakGlassConfig{Duration: time.Hour},
+	)
+	reason := "referral from the county hospital arrived before the booking"
+
+	// the patient is already under the doctor's care
+	_, err := breakGlassService.GrantAccess(context.Background(), specialistUserID, model.BreakGlassRequest{PatientID: patientID, Reason: reason})
+	require.ErrorIs(t, err, ErrBreakGlassNotNeeded)
+
+	_, err = breakGlassService.GrantAccess(context.Background(), specialistUserID, model.BreakGlassRequest{PatientID: 999, Reason: reason})
+	require.ErrorIs(t, err, ErrPatientNotFound)
+	require.Empty(t, mail.sent)
+
+	grant, err := breakGlassService.GrantAccess(context.Background(), specialistUserID, model.BreakGlassRequest{PatientID: unrelatedPatientID, Reason: reason})
+	require.NoError(t, err)
+	require.Equal(t, int64(unrelatedPatientID), grant.PatientID)
+	require.WithinDuration(t, time.Now().Add(time.Hour), grant.ExpiresAt, time.Minute)
+	require.Contains(t, breakGlassRepo.grants[doctorID], int64(unrelatedPatientID))
+	require.Len(t, auditService.entries, 1)
+	require.Equal(t, audit.ActionBreakGlass, auditService.entries[0].Action)
+	require.Equal(t, int64(unrelatedPatientID), auditService.entries[0].PatientID)
+
+	// the patient is told who accessed their record and why
+	require.Len(t, mail.sent, 1)
+	require.Equal(t, "otieno@example.com", mail.sent[0].ToAddress)
+	require.Contains(t, mail.sent[0].PlainText, "Amina Hassan")
+	require.Contains(t, mail.sent[0].PlainText, reason)
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/auth"
+	"github.com/mbeka02/lyra_backend/internal/calendar"
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/mailer"
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+)
+
+var ErrCalendarFeedNotFound = errors.New("calendar feed not found")
+
+// feeds list the scheduled appointments of the coming year
+const calendarFeedDays = 365
+
+type CalendarConfig struct {
+	// BaseURL is the public URL of the API , feeds are served from {BaseURL}/calendar/{token}.ics
+	// and its host makes the UIDs of the events unique
+	BaseURL string
+	// the invites are sent by and organized by the platform
+	OrganizerName  string
+	OrganizerEmail string
+}
+
+// InviteSender sends the calendar invite of an appointment to its doctor and patient , errors are logged and never returned
+// since the change to the appointment has already been made
+type InviteSender interface {
+	SendInvite(ctx context.Context, appointmentId int64)
+}
+
+type CalendarService interface {
+	InviteSender
+	// CreateFeed returns a new secret subscription URL for the user's scheduled appointments , the previous URL stops working
+	CreateFeed(ctx context.Context, userId int64) (string, error)
+	DeleteFeed(ctx context.Context, userId int64) error
+	// Feed returns the ICS calendar of the owner of the token
+	Feed(ctx context.Context, token string) ([]byte, error)
+}
+
+type calendarService struct {
+	calendarRepo    repository.CalendarRepository
+	appointmentRepo repository.AppointmentRepository
+	doctorRepo      repository.DoctorRepository
+	patientRepo     repository.PatientRepository
+	mailer          mailer.Mailer
+	config          CalendarConfig
+}
+
+func NewCalendarService(calendarRepo repository.CalendarRepository, appointmentRepo repository.AppointmentRepository, doctorRepo repository.DoctorRepository, patientRepo repository.PatientRepository, mailer mailer.Mailer, config CalendarConfig) CalendarService {
+	return &calendarService{
+		calendarRepo,
+		appointmentRepo,
+		doctorRepo,
+		patientRepo,
+		mailer,
+		config,
+	}
+}
+
+// uidDomain is the host of the API , the UIDs only have to be unique to it
+func (s *calendarService) uidDomain() string {
+	base, err := url.Parse(s.config.BaseURL)
+	if err != nil || base.Hostname() == "" {
+		return "lyra"
+	}
+	return base.Hostname()
+}
+
+func (s *calendarService) CreateFeed(ctx context.Context, userId int64) (string, error) {
+	token, err := auth.NewOpaqueToken()
+	if err != nil {
+		return "", fmt.Errorf("unable to generate the feed token:%v", err)
+	}
+	if err := s.calendarRepo.SetFeed(ctx, userId, auth.HashOpaqueToken(token)); err != nil {
+		return "", fmt.Errorf("unable to save the feed token:%v", err)
+	}
+	return fmt.Sprintf("%s/calendar/%s.ics", s.config.BaseURL, token), nil
+}
+
+func (s *calendarService) DeleteFeed(ctx context.Context, userId int64) error {
+	if err := s.calendarRepo.DeleteFeed(ctx, userId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrCalendarFeedNotFound
+		}
+		return fmt.Errorf("unable to delete the feed:%v", err)
+	}
+	return nil
+}
+
+func (s *calendarService) Feed(ctx context.Context, token string) ([]byte, error) {
+	owner, err := s.calendarRepo.GetFeedOwner(ctx, auth.HashOpaqueToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCalendarFeedNotFound
+		}
+		return nil, fmt.Errorf("unable to get the feed:%v", err)
+	}
+	domain := s.uidDomain()
+	feed := calendar.Calendar{Method: calendar.MethodPublish, Name: "Lyra appointments"}
+	switch owner.UserRole {
+	case database.RoleSpecialist:
+		doctorId, err := s.doctorRepo.GetDoctorIdByUserId(ctx, owner.UserID)
+		if err != nil {
+			return nil, errors.New("unable to get the user details of this account")
+		}
+		rows, err := s.appointmentRepo.GetDoctorAppointments(ctx, repository.GetDoctorAppointmentsParams{
+			DoctorID: doctorId,
+			Interval: calendarFeedDays,
+			Status:   string(database.AppointmentStatusScheduled),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get the appointments:%v", err)
+		}
+		for _, row := range rows {
+			feed.Events = append(feed.Events, feedEvent(domain, row.AppointmentID, row.StartTime, row.EndTime, row.UpdatedAt,
+				fmt.Sprintf("Consultation with %s", row.PatientName)))
+		}
+	case database.RolePatient:
+		patientId, err := s.patientRepo.GetPatientIdByUserId(ctx, owner.UserID)
+		if err != nil {
+			return nil, errors.New("unable to get the user details of this account")
+		}
+		rows, err := s.appointmentRepo.GetPatientAppointments(ctx, repository.GetPatientAppointmentsParams{
+			PatientID: patientId,
+			Interval:  calendarFeedDays,
+			Status:    string(database.AppointmentStatusScheduled),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get the appointments:%v", err)
+		}
+		for _, row := range rows {
+			feed.Events = append(feed.Events, feedEvent(domain, row.AppointmentID, row.StartTime, row.EndTime, row.UpdatedAt,
+				fmt.Sprintf("Consultation with Dr. %s", row.DoctorName)))
+		}
+	}
+	return feed.Encode(time.Now()), nil
+}
+
+// feedEvent is an appointment in a feed , the reason for it is left out since the feed ends up in third party calendars
+func feedEvent(domain string, appointmentId int64, start, end time.Time, updatedAt sql.NullTime, summary string) calendar.Event {
+	return calendar.Event{
+		UID:          calendar.AppointmentUID(appointmentId, domain),
+		Start:        start,
+		End:          end,
+		Summary:      summary,
+		LastModified: updatedAt.Time,
+	}
+}
+
+// newInvite is the invite of an appointment as it is now , every reschedule is a new version of the event
+// and a cancellation comes after all of them
+func newInvite(participants *database.GetAppointmentParticipantsRow, domain string, organizer calendar.Person, summary string) (calendar.Calendar, bool) {
+	event := calendar.Event{
+		UID:       calendar.AppointmentUID(participants.AppointmentID, domain),
+		Sequence:  int(participants.RescheduleCount),
+		Start:     participants.StartTime,
+		End:       participants.EndTime,
+		Summary:   summary,
+		Organizer: organizer,
+		Attendees: []calendar.Person{
+			{Name: participants.DoctorName, Email: participants.DoctorEmail},
+			{Name: participants.PatientName, Email: participants.PatientEmail},
+		},
+	}
+	switch participants.CurrentStatus {
+	case database.AppointmentStatusScheduled:
+		return calendar.Calendar{Method: calendar.MethodRequest, Events: []calendar.Event{event}}, true
+	case database.AppointmentStatusCancelled:
+		event.Sequence++
+		event.Status = calendar.StatusCancelled
+		return calendar.Calendar{Method: calendar.MethodCancel, Events: []calendar.Event{event}}, true
+	}
+	return calendar.Calendar{}, false
+}
+
+func (s *calendarService) SendInvite(ctx context.Context, appointmentId int64) {
+	participants, err := s.appointmentRepo.GetParticipants(ctx, appointmentId)
+	if err != nil {
+		log.Printf("unable to get the participants of appointment %d for its invite: %v", appointmentId, err)
+		return
+	}
+	location, err := LoadTimezone(participants.DoctorTimezone)
+	if err != nil {
+		location = time.UTC
+	}
+	organizer := calendar.Person{Name: s.config.OrganizerName, Email: s.config.OrganizerEmail}
+	recipients := []struct {
+		name, email, summary string
+	}{
+		{participants.DoctorName, participants.DoctorEmail, fmt.Sprintf("Consultation with %s", participants.PatientName)},
+		{participants.PatientName, participants.PatientEmail, fmt.Sprintf("Consultation with Dr. %s", participants.DoctorName)},
+	}
+	now := time.Now()
+	for _, recipient := range recipients {
+		invite, ok := newInvite(participants, s.uidDomain(), organizer, recipient.summary)
+		if !ok {
+			return
+		}
+		email := mailer.NewAppointmentInviteEmail(recipient.name, recipient.email, recipient.summary, participants.StartTime.In(location),
+			invite.Method == calendar.MethodCancel, invite.Encode(now), string(invite.Method))
+		if err := s.mailer.Send(ctx, email); err != nil {
+			log.Printf("unable to send the invite of appointment %d: %v", appointmentId, err)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/auth"
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/payment"
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeInviteSender struct {
+	sent []int64
+}
+
+func (f *fakeInviteSender) SendInvite(ctx context.Context, appointmentId int64) {
+	f.sent = append(f.sent, appointmentId)
+}
+
+type fakeCalendarRepository struct {
+	repository.CalendarRepository
+	// feed token hashes by user
+	feeds map[int64]string
+	roles map[int64]database.Role
+}
+
+func (f *fakeCalendarRepository) SetFeed(ctx context.Context, userId int64, tokenHash string) error {
+	f.feeds[userId] = tokenHash
+	return nil
+}
+
+func (f *fakeCalendarRepository) DeleteFeed(ctx context.Context, userId int64) error {
+	if _, ok := f.feeds[userId]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(f.feeds, userId)
+	return nil
+}
+
+func (f *fakeCalendarRepository) GetFeedOwner(ctx context.Context, tokenHash string) (*database.GetCalendarFeedOwnerRow, error) {
+	for userId, hash := range f.feeds {
+		if hash == tokenHash {
+			return &database.GetCalendarFeedOwnerRow{UserID: userId, UserRole: f.roles[userId]}, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (f *fakeAppointmentRepository) GetParticipants(ctx context.Context, appointmentId int64) (*database.GetAppointmentParticipantsRow, error) {
+	participants, ok := f.participants[appointmentId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return participants, nil
+}
+
+func (f *fakeAppointmentRepository) GetDoctorAppointments(ctx context.Context, params repository.GetDoctorAppointmentsParams) ([]database.GetDoctorAppointmentsRow, error) {
+	var rows []database.GetDoctorAppointmentsRow
+	for _, row := range f.doctorAppointments {
+		if row.DoctorID == params.DoctorID && string(row.CurrentStatus) == params.Status {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+func (f *fakeAppointmentRepository) GetPatientAppointments(ctx context.Context, params repository.GetPatientAppointmentsParams) ([]database.GetPatientAppointmentsRow, error) {
+	var rows []database.GetPatientAppointmentsRow
+	for _, row := range f.patientAppointments {
+		if row.PatientID == params.PatientID && string(row.CurrentStatus) == params.Status {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// unfoldICS splits an iCalendar object into its unfolded content lines
+func unfoldICS(ics []byte) []string {
+	return strings.Split(strings.TrimSuffix(strings.ReplaceAll(string(ics), "\r\n ", ""), "\r\n"), "\r\n")
+}
+
+func feedToken(t *testing.T, feedURL string) string {
+	t.Helper()
+	require.True(t, strings.HasPrefix(feedURL, "https://api.lyra.test/calendar/"), feedURL)
+	require.True(t, strings.HasSuffix(feedURL, ".ics"), feedURL)
+	return strings.TrimSuffix(strings.TrimPrefix(feedURL, "https://api.lyra.test/calendar/"), ".ics")
+}
+
+func TestCalendarFeed(t *testing.T) {
+	start := time.Date(2026, 11, 2, 7, 0, 0, 0, time.UTC)
+	newService := func() (CalendarService, *fakeCalendarRepository) {
+		calendarRepo := &fakeCalendarRepository{
+			feeds: map[int64]string{},
+			roles: map[int64]database.Role{specialistUserID: database.RoleSpecialist, patientUserID: database.RolePatient},
+		}
+		appointmentRepo := &fakeAppointmentRepository{
+			doctorAppointments: []database.GetDoctorAppointmentsRow{
+				{AppointmentID: 70, DoctorID: doctorID, CurrentStatus: database.AppointmentStatusScheduled, Reason: "chest pain", StartTime: start, EndTime: start.Add(30 * time.Minute), PatientName: "Amina Odhiambo"},
+				{AppointmentID: 71, DoctorID: doctorID, CurrentStatus: database.AppointmentStatusCancelled, StartTime: start.Add(time.Hour), EndTime: start.Add(90 * time.Minute), PatientName: "Brian Kiptoo"},
+			},
+			patientAppointments: []database.GetPatientAppointmentsRow{
+				{AppointmentID: 70, PatientID: patientID, CurrentStatus: database.AppointmentStatusScheduled, Reason: "chest pain", StartTime: start, EndTime: start.Add(30 * time.Minute), DoctorName: "Jo Wanjiru"},
+			},
+		}
+		doctorRepo := &fakeDoctorRepository{doctors: map[int64]*database.Doctor{
+			doctorID: {DoctorID: doctorID, UserID: specialistUserID},
+		}}
+		patientRepo := &fakePatientRepository{users: map[int64]database.User{
+			patientID: {UserID: patientUserID},
+		}}
+		config := CalendarConfig{BaseURL: "https://api.lyra.test", OrganizerName: "Lyra", OrganizerEmail: "appointments@lyra.test"}
+		return NewCalendarService(calendarRepo, appointmentRepo, doctorRepo, patientRepo, &fakeMailer{}, config), calendarRepo
+	}
+
+	t.Run("doctor feed lists the scheduled appointments", func(t *testing.T) {
+		service, calendarRepo := newService()
+		feedURL, err := service.CreateFeed(context.Background(), specialistUserID)
+		require.NoError(t, err)
+		token := feedToken(t, feedURL)
+		// only the hash of the token is stored
+		require.Equal(t, auth.HashOpaqueToken(token), calendarRepo.feeds[specialistUserID])
+
+		feed, err := service.Feed(context.Background(), token)
+		require.NoError(t, err)
+		lines := unfoldICS(feed)
+		require.Contains(t, lines, "METHOD:PUBLISH")
+		require.Contains(t, lines, "UID:appointment-70@api.lyra.test")
+		require.Contains(t, lines, "DTSTART:20261102T070000Z")
+		require.Contains(t, lines, "SUMMARY:Consultation with Amina Odhiambo")
+		require.NotContains(t, lines, "UID:appointment-71@api.lyra.test")
+		// the reason for the visit never leaves the platform
+		require.NotContains(t, string(feed), "chest pain")
+	})
+
+	t.Run("patient feed uses the same UIDs", func(t *testing.T) {
+		service, _ := newService()
+		feedURL, err := service.CreateFeed(context.Background(), patientUserID)
+		require.NoError(t, err)
+		feed, err := service.Feed(context.Background(), feedToken(t, feedURL))
+		require.NoError(t, err)
+		lines := unfoldICS(feed)
+		require.Contains(t, lines, "UID:appointment-70@api.lyra.test")
+		require.Contains(t, lines, "SUMMARY:Consultation with Dr. Jo Wanjiru")
+	})
+
+	t.Run("creating a feed again replaces the old URL", func(t *testing.T) {
+		service, _ := newService()
+		first, err := service.CreateFeed(context.Background(), patientUserID)
+		require.NoError(t, err)
+		second, err := service.CreateFeed(context.Background(), patientUserID)
+		require.NoError(t, err)
+		require.NotEqual(t, first, second)
+		_, err = service.Feed(context.Background(), feedToken(t, first))
+		require.ErrorIs(t, err, ErrCalendarFeedNotFound)
+		_, err = service.Feed(context.Background(), feedToken(t, second))
+		require.NoError(t, err)
+	})
+
+	t.Run("deleted feed", func(t *testing.T) {
+		service, _ := newService()
+		feedURL, err := service.CreateFeed(context.Background(), patientUserID)
+		require.NoError(t, err)
+		require.NoError(t, service.DeleteFeed(context.Background(), patientUserID))
+		_, err = service.Feed(context.Background(), feedToken(t, feedURL))
+		require.ErrorIs(t, err, ErrCalendarFeedNotFound)
+		require.ErrorIs(t, service.DeleteFeed(context.Background(), patientUserID), ErrCalendarFeedNotFound)
+	})
+}
+
+func TestSendInvite(t *testing.T) {
+	const appointmentID = 80
+	start := time.Date(2026, 11, 2, 7, 0, 0, 0, time.UTC)
+	newService := func(status database.AppointmentStatus, reschedules int64) (CalendarService, *fakeMailer) {
+		appointmentRepo := &fakeAppointmentRepository{participants: map[int64]*database.GetAppointmentParticipantsRow{
+			appointmentID: {
+				AppointmentID:   appointmentID,
+				StartTime:       start,
+				EndTime:         start.Add(30 * time.Minute),
+				CurrentStatus:   status,
+				DoctorTimezone:  "Africa/Nairobi",
+				DoctorName:      "Jo Wanjiru",
+				DoctorEmail:     "jo@example.com",
+				PatientName:     "Amina Odhiambo",
+				PatientEmail:    "amina@example.com",
+				RescheduleCount: reschedules,
+			},
+		}}
+		mail := &fakeMailer{}
+		config := CalendarConfig{BaseURL: "https://api.lyra.test", OrganizerName: "Lyra", OrganizerEmail: "appointments@lyra.test"}
+		return NewCalendarService(&fakeCalendarRepository{}, appointmentRepo, &fakeDoctorRepository{}, &fakePatientRepository{}, mail, config), mail
+	}
+	invite := func(t *testing.T, mail *fakeMailer, i int) []string {
+		t.Helper()
+		require.Len(t, mail.sent[i].Attachments, 1)
+		return unfoldICS(mail.sent[i].Attachments[0].Content)
+	}
+
+	t.Run("booked appointment", func(t *testing.T) {
+		service, mail := newService(database.AppointmentStatusScheduled, 0)
+		service.SendInvite(context.Background(), appointmentID)
+		require.Len(t, mail.sent, 2)
+		require.Equal(t, "jo@example.com", mail.sent[0].ToAddress)
+		require.Equal(t, "amina@example.com", mail.sent[1].ToAddress)
+		for i := range mail.sent {
+			lines := invite(t, mail, i)
+			require.Contains(t, lines, "METHOD:REQUEST")
+			require.Contains(t, lines, "UID:appointment-80@api.lyra.test")
+			require.Contains(t, lines, "SEQUENCE:0")
+			require.Contains(t, lines, `ORGANIZER;CN="Lyra":mailto:appointments@lyra.test`)
+		}
+		require.Equal(t, "text/calendar; charset=utf-8; method=REQUEST", mail.sent[0].Attachments[0].ContentType)
+	})
+
+	t.Run("rescheduled appointment is a new version of the same event", func(t *testing.T) {
+		service, mail := newService(database.AppointmentStatusScheduled, 2)
+		service.SendInvite(context.Background(), appointmentID)
+		lines := invite(t, mail, 0)
+		require.Contains(t, lines, "UID:appointment-80@api.lyra.test")
+		require.Contains(t, lines, "SEQUENCE:2")
+	})
+
+	t.Run("cancelled appointment", func(t *testing.T) {
+		service, mail := newService(database.AppointmentStatusCancelled, 2)
+		service.SendInvite(context.Background(), appointmentID)
+		require.Len(t, mail.sent, 2)
+		lines := invite(t, mail, 1)
+		require.Contains(t, lines, "METHOD:CANCEL")
+		require.Contains(t, lines, "STATUS:CANCELLED")
+		require.Contains(t, lines, "UID:appointment-80@api.lyra.test")
+		// the cancellation comes after every reschedule
+		require.Contains(t, lines, "SEQUENCE:3")
+	})
+
+	t.Run("no invite for other statuses", func(t *testing.T) {
+		service, mail := newService(database.AppointmentStatusPendingPayment, 0)
+		service.SendInvite(context.Background(), appointmentID)
+		require.Empty(t, mail.sent)
+	})
+
+	t.Run("missing appointment", func(t *testing.T) {
+		service, mail := newService(database.AppointmentStatusScheduled, 0)
+		service.SendInvite(context.Background(), 999)
+		require.Empty(t, mail.sent)
+	})
+}
+
+func TestInvitesFollowTheAppointment(t *testing.T) {
+	const (
+		pendingID   = 90
+		scheduledID = 91
+		startedID   = 92
+	)
+	start := time.Now().Add(72 * time.Hour).Truncate(time.Hour)
+	newService := func() (AppointmentService, *fakeInviteSender) {
+		appointmentRepo := &fakeAppointmentRepository{
+			appointments: map[int64]*database.Appointment{
+				pendingID:   {AppointmentID: pendingID, PatientID: patientID, DoctorID: doctorID, CurrentStatus: database.AppointmentStatusPendingPayment, StartTime: start, EndTime: start.Add(30 * time.Minute)},
+				scheduledID: {AppointmentID: scheduledID, PatientID: patientID, DoctorID: doctorID, CurrentStatus: database.AppointmentStatusScheduled, StartTime: start, EndTime: start.Add(30 * time.Minute)},
+				startedID:   {AppointmentID: startedID, PatientID: patientID, DoctorID: doctorID, CurrentStatus: database.AppointmentStatusScheduled, StartTime: time.Now().Add(-5 * time.Minute), EndTime: time.Now().Add(25 * time.Minute)},
+			},
+			slot: database.CheckAppointmentSlotRow{WithinAvailability: true},
+		}
+		paymentRepo := &fakePaymentRepository{payments: map[int64]*database.Payment{
+			pendingID:   {PaymentID: 1, AppointmentID: pendingID, Amount: "1500.00", CurrentStatus: database.PaymentStatusPending},
+			scheduledID: {PaymentID: 2, AppointmentID: scheduledID, Amount: "1500.00", CurrentStatus: database.PaymentStatusCompleted},
+			startedID:   {PaymentID: 3, AppointmentID: startedID, Amount: "1500.00", CurrentStatus: database.PaymentStatusCompleted},
+		}}
+		patientRepo := &fakePatientRepository{users: map[int64]database.User{
+			patientID: {UserID: patientUserID},
+		}}
+		invites := &fakeInviteSender{}
+		// nothing is refunded after the start so the payment processor is never reached
+		service := NewAppointmentService(appointmentRepo, patientRepo, &fakeDoctorRepository{}, &fakeUserRepository{}, paymentRepo, nil, nil, BookingPolicy{RescheduleLimit: 2}, RefundPolicy{}, PricingPolicy{}, PaymentHoldConfig{}, invites)
+		return service, invites
+	}
+
+	t.Run("reschedule", func(t *testing.T) {
+		service, invites := newService()
+		_, err := service.RescheduleAppointment(context.Background(), RescheduleAppointmentParams{
+			UserID: patientUserID, Role: auth.RolePatient, AppointmentID: scheduledID, StartTime: start.Add(24 * time.Hour),
+		})
+		require.NoError(t, err)
+		require.Equal(t, []int64{scheduledID}, invites.sent)
+	})
+
+	t.Run("cancelling a booked appointment", func(t *testing.T) {
+		service, invites := newService()
+		_, err := service.CancelAppointment(context.Background(), CancelAppointmentParams{
+			UserID: patientUserID, Role: auth.RolePatient, AppointmentID: startedID, Reason: "running late",
+		})
+		require.NoError(t, err)
+		require.Equal(t, []int64{startedID}, invites.sent)
+	})
+
+	t.Run("no invite was sent for an unpaid appointment", func(t *testing.T) {
+		service, invites := newService()
+		_, err := service.CancelAppointment(context.Background(), CancelAppointmentParams{
+			UserID: patientUserID, Role: auth.RolePatient, AppointmentID: pendingID, Reason: "no longer needed",
+		})
+		require.NoError(t, err)
+		require.Empty(t, invites.sent)
+	})
+
+	t.Run("payment books the appointment", func(t *testing.T) {
+		paymentRepo := &fakePaymentRepository{payments: map[int64]*database.Payment{
+			pendingID: {PaymentID: 1, AppointmentID: pendingID, Reference: "ref_90", CurrentStatus: database.PaymentStatusPending, Amount: "1500.00", Currency: "KES"},
+		}}
+		appointmentRepo := &fakeAppointmentRepository{appointments: map[int64]*database.Appointment{
+			pendingID: {AppointmentID: pendingID, CurrentStatus: database.AppointmentStatusPendingPayment},
+		}}
+		invites := &fakeInviteSender{}
+		service := NewPaymentService(payment.NewProviders(payment.NewPaystack("sk_test")), paymentRepo, appointmentRepo, &fakeReconciliationRepository{}, invites)
+		body := `{"event":"charge.success","data":{"id":1,"reference":"ref_90","status":"success","amount":150000,"currency":"KES"}}`
+		err := service.HandleWebhook(context.Background(), payment.MethodPaystack, payment.WebhookRequest{
+			Body:   []byte(body),
+			Header: http.Header{"X-Paystack-Signature": []string{signWebhook(body)}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []int64{pendingID}, invites.sent)
+	})
+}
@@ -38,6 +38,13 @@ func (s *doctorService) ListPatientsUnderCare(ctx context.Context, userID int64)
 }
 
 func (s *doctorService) CreateDoctor(ctx context.Context, req model.CreateDoctorRequest, userId int64) (*database.Doctor, error) {
+	timezone := req.Timezone
+	if timezone == "" {
+		timezone = DefaultTimezone
+	}
+	if _, err := LoadTimezone(timezone); err != nil {
+		return nil, err
+	}
 	return s.doctorRepo.Create(ctx, repository.CreateDoctorParams{
 		Specialization:    req.Specialization,
 		LicenseNumber:     req.LicenseNumber,
@@ -46,6 +53,7 @@ func (s *doctorService) CreateDoctor(ctx context.Context, req model.CreateDoctor
 		PricePerHour:      req.PricePerHour,
 		YearsOfExperience: req.YearsOfExperience,
 		UserID:            userId,
+		Timezone:          timezone,
 	})
 }
 
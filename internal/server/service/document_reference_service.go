@@ -2,9 +2,11 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"mime/multipart"
 	"net/url"
+	"path"
 	"path/filepath" // For getting file extension
 	"strconv"
 	"strings"
@@ -13,6 +15,7 @@ import (
 	"github.com/google/uuid" // For unique object names
 	samplyFhir "github.com/samply/golang-fhir-models/fhir-models/fhir"
 
+	"github.com/mbeka02/lyra_backend/internal/audit"
 	"github.com/mbeka02/lyra_backend/internal/fhir"
 	"github.com/mbeka02/lyra_backend/internal/model"
 	"github.com/mbeka02/lyra_backend/internal/objstore" // Need storage
@@ -33,25 +36,70 @@ type DocumentReferenceService interface {
 	CreateDocumentReference(ctx context.Context, input model.CreateDocumentReferenceServiceInput) (*samplyFhir.DocumentReference, error)
 	// Returns a FHIR Bundle.
 	ListPatientDocuments(ctx context.Context, patientID int64, count int, pageToken string) (*samplyFhir.Bundle, error)
-	GetSignedURL(ctx context.Context, unisgnedURL string) (string, error)
+	// GetSignedURL signs a download URL for one of the patient's documents , the caller has to have checked access to the patient
+	GetSignedURL(ctx context.Context, patientID int64, unsignedURL string) (string, error)
 }
 
+var ErrNotPatientDocument = errors.New("the URL is not of a patient document")
+
 type documentReferenceService struct {
-	fhirClient  *fhir.FHIRClient
-	fileStorage objstore.Storage // Inject storage dependency
+	fhirClient   *fhir.FHIRClient
+	fileStorage  objstore.Storage // Inject storage dependency
+	auditService AuditService
 }
 
 // NewDocumentReferenceService creates a new DocumentReferenceService.
-func NewDocumentReferenceService(fhirClient *fhir.FHIRClient, fileStorage objstore.Storage) DocumentReferenceService {
+func NewDocumentReferenceService(fhirClient *fhir.FHIRClient, fileStorage objstore.Storage, auditService AuditService) DocumentReferenceService {
 	return &documentReferenceService{
-		fhirClient:  fhirClient,
-		fileStorage: fileStorage,
+		fhirClient:   fhirClient,
+		fileStorage:  fileStorage,
+		auditService: auditService,
 	}
 }
 
-func (s *documentReferenceService) GetSignedURL(ctx context.Context, unisgnedURL string) (string, error) {
-	return s.fileStorage.CreateSignedURL(unisgnedURL, time.Hour*72)
-	// return s.fileStorage.GenerateGetObjectSignedURL(ctx, unisgnedURL, "", time.Hour*48)
+// DocumentPatientID returns the patient a document belongs to , documents are stored as patients_{patientId}_documents_{uuid}_{ext}
+func DocumentPatientID(unsignedURL string) (int64, error) {
+	_, patientID, err := parseDocumentURL(unsignedURL)
+	return patientID, err
+}
+
+func parseDocumentURL(unsignedURL string) (string, int64, error) {
+	parsed, err := url.Parse(unsignedURL)
+	if err != nil {
+		return "", 0, ErrNotPatientDocument
+	}
+	// the storage signs the last part of the path
+	objectName := path.Base(parsed.Path)
+	parts := strings.SplitN(objectName, "_", 4)
+	if len(parts) < 4 || parts[0] != "patients" || parts[2] != "documents" {
+		return "", 0, ErrNotPatientDocument
+	}
+	patientID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || patientID <= 0 {
+		return "", 0, ErrNotPatientDocument
+	}
+	return objectName, patientID, nil
+}
+
+func (s *documentReferenceService) GetSignedURL(ctx context.Context, patientID int64, unsignedURL string) (string, error) {
+	objectName, documentPatientID, err := parseDocumentURL(unsignedURL)
+	if err != nil {
+		return "", err
+	}
+	if documentPatientID != patientID {
+		return "", ErrNotPatientDocument
+	}
+	signedURL, err := s.fileStorage.CreateSignedURL(unsignedURL, time.Hour*72)
+	if err != nil {
+		return "", err
+	}
+	s.auditService.Record(ctx, AuditEntry{
+		PatientID:    patientID,
+		ResourceType: audit.ResourceDocument,
+		ResourceID:   objectName,
+		Action:       audit.ActionRead,
+	})
+	return signedURL, nil
 }
 
 func (s *documentReferenceService) CreateDocumentReference(ctx context.Context, input model.CreateDocumentReferenceServiceInput) (*samplyFhir.DocumentReference, error) {
@@ -109,6 +157,16 @@ func (s *documentReferenceService) CreateDocumentReference(ctx context.Context,
 		return nil, fmt.Errorf("failed to save DocumentReference in FHIR store: %w", err)
 	}
 
+	resourceID := ""
+	if savedFhirDocRef.Id != nil {
+		resourceID = *savedFhirDocRef.Id
+	}
+	s.auditService.Record(ctx, AuditEntry{
+		PatientID:    metadata.PatientID,
+		ResourceType: audit.ResourceDocument,
+		ResourceID:   resourceID,
+		Action:       audit.ActionCreate,
+	})
 	// Return the saved resource
 	return savedFhirDocRef, nil
 }
@@ -144,6 +202,11 @@ func (s *documentReferenceService) ListPatientDocuments(ctx context.Context, pat
 	if err != nil {
 		return nil, fmt.Errorf("failed to search document references in FHIR store: %w", err)
 	}
+	s.auditService.Record(ctx, AuditEntry{
+		PatientID:    patientID,
+		ResourceType: audit.ResourceDocument,
+		Action:       audit.ActionList,
+	})
 
 	// Return the resulting bundle
 	// The bundle contains the list of DocumentReference resources in bundle.Entry
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mbeka02/lyra_backend/internal/audit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentPatientID(t *testing.T) {
+	testCases := []struct {
+		name      string
+		url       string
+		patientID int64
+		err       error
+	}{
+		{"patient document", "https://storage.googleapis.com/lyra-records/patients_12_documents_0b6f6e4e-8d1c-4c44-9a32-0a3c1b2e7f11_.pdf", 12, nil},
+		{"profile image", "https://storage.googleapis.com/lyra-images/user_12_profile.jpg", 0, ErrNotPatientDocument},
+		{"license document", "https://storage.googleapis.com/lyra-records/doctors_3_licenses_a1.pdf", 0, ErrNotPatientDocument},
+		{"invalid patient id", "https://storage.googleapis.com/lyra-records/patients_abc_documents_a1_.pdf", 0, ErrNotPatientDocument},
+		{"missing document part", "https://storage.googleapis.com/lyra-records/patients_12", 0, ErrNotPatientDocument},
+		{"negative patient id", "https://storage.googleapis.com/lyra-records/patients_-12_documents_a1_.pdf", 0, ErrNotPatientDocument},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			patientID, err := DocumentPatientID(tc.url)
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.patientID, patientID)
+		})
+	}
+}
+
+func TestGetSignedURL(t *testing.T) {
+	const unsignedURL = "https://storage.googleapis.com/lyra-records/patients_12_documents_0b6f6e4e_.pdf"
+	auditService := &fakeAuditService{}
+	documentService := NewDocumentReferenceService(nil, &fakeStorage{}, auditService)
+
+	t.Run("signs the patient's document and records the read", func(t *testing.T) {
+		signedURL, err := documentService.GetSignedURL(context.Background(), 12, unsignedURL)
+		require.NoError(t, err)
+		require.Equal(t, unsignedURL+"?signed", signedURL)
+		require.Len(t, auditService.entries, 1)
+		require.Equal(t, int64(12), auditService.entries[0].PatientID)
+		require.Equal(t, audit.ActionRead, auditService.entries[0].Action)
+		require.Equal(t, "patients_12_documents_0b6f6e4e_.pdf", auditService.entries[0].ResourceID)
+	})
+
+	t.Run("document of another patient", func(t *testing.T) {
+		_, err := documentService.GetSignedURL(context.Background(), 13, unsignedURL)
+		require.ErrorIs(t, err, ErrNotPatientDocument)
+	})
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+)
+
+type PaymentHoldConfig struct {
+	// how long an unpaid appointment holds its slot before it is cancelled
+	Duration time.Duration
+	// how often the expired holds are swept
+	SweepInterval time.Duration
+}
+
+// heldAfter is when the unpaid appointments that still hold their slot were created ,
+// the ones created at or before it are free to book again even if they haven't been swept yet
+func (c PaymentHoldConfig) heldAfter() time.Time {
+	return time.Now().Add(-c.Duration)
+}
+
+// HoldSweeper cancels the appointments that were never paid for (the patient abandoned checkout) so that their slots are released
+type HoldSweeper interface {
+	// Run sweeps every SweepInterval until the context is cancelled
+	Run(ctx context.Context)
+	// Sweep cancels the expired holds once and returns the ids of the cancelled appointments
+	Sweep(ctx context.Context) ([]int64, error)
+}
+
+type holdSweeper struct {
+	appointmentRepo repository.AppointmentRepository
+	config          PaymentHoldConfig
+}
+
+func NewHoldSweeper(appointmentRepo repository.AppointmentRepository, config PaymentHoldConfig) HoldSweeper {
+	return &holdSweeper{
+		appointmentRepo,
+		config,
+	}
+}
+
+func (s *holdSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.SweepInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.Sweep(ctx); err != nil {
+			log.Printf("unable to expire unpaid appointments: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *holdSweeper) Sweep(ctx context.Context) ([]int64, error) {
+	expired, err := s.appointmentRepo.ExpirePendingAppointments(ctx, s.config.heldAfter())
+	if err != nil {
+		return nil, err
+	}
+	if len(expired) > 0 {
+		log.Printf("expired %d unpaid appointments: %v", len(expired), expired)
+	}
+	return expired, nil
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/stretchr/testify/require"
+)
+
+func (f *fakeAppointmentRepository) ExpirePendingAppointments(ctx context.Context, createdBefore time.Time) ([]int64, error) {
+	var expired []int64
+	for id, appointment := range f.appointments {
+		if appointment.CurrentStatus == database.AppointmentStatusPendingPayment && !appointment.CreatedAt.After(createdBefore) {
+			appointment.CurrentStatus = database.AppointmentStatusCancelled
+			expired = append(expired, id)
+		}
+	}
+	return expired, nil
+}
+
+func TestHoldSweeper(t *testing.T) {
+	now := time.Now()
+	appointmentRepo := &fakeAppointmentRepository{appointments: map[int64]*database.Appointment{
+		1: {AppointmentID: 1, CurrentStatus: database.AppointmentStatusPendingPayment, CreatedAt: now.Add(-20 * time.Minute)},
+		2: {AppointmentID: 2, CurrentStatus: database.AppointmentStatusPendingPayment, CreatedAt: now.Add(-5 * time.Minute)},
+		3: {AppointmentID: 3, CurrentStatus: database.AppointmentStatusScheduled, CreatedAt: now.Add(-time.Hour)},
+	}}
+	sweeper := NewHoldSweeper(appointmentRepo, PaymentHoldConfig{Duration: 15 * time.Minute, SweepInterval: time.Millisecond})
+
+	expired, err := sweeper.Sweep(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []int64{1}, expired)
+	require.Equal(t, database.AppointmentStatusCancelled, appointmentRepo.appointments[1].CurrentStatus)
+	// the live hold and the paid appointment are left alone
+	require.Equal(t, database.AppointmentStatusPendingPayment, appointmentRepo.appointments[2].CurrentStatus)
+	require.Equal(t, database.AppointmentStatusScheduled, appointmentRepo.appointments[3].CurrentStatus)
+
+	// Run stops once the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		sweeper.Run(ctx)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the sweeper didn't stop after its context was cancelled")
+	}
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/objstore"
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+)
+
+const (
+	maxLicenseDocumentSize = 10 * 1024 * 1024 // 10 MB
+	// how long the links to license documents given to reviewers stay valid
+	licenseDocumentURLDuration = 15 * time.Minute
+)
+
+var allowedLicenseDocumentTypes = map[string]bool{
+	"application/pdf": true,
+	"image/jpeg":      true,
+	"image/png":       true,
+}
+
+var (
+	ErrDoctorNotFound                = errors.New("doctor not found")
+	ErrInvalidVerificationTransition = errors.New("the doctor's verification status doesn't allow this change")
+	ErrReviewReasonRequired          = errors.New("a reason is required when rejecting or suspending a doctor")
+	ErrInvalidLicenseDocument        = errors.New("invalid license document")
+)
+
+// verificationTransitions lists the statuses an admin can move a doctor to from each status.
+// A rejected doctor goes back to pending by uploading a new license document
+var verificationTransitions = map[database.VerificationStatus][]database.VerificationStatus{
+	database.VerificationStatusPending:   {database.VerificationStatusVerified, database.VerificationStatusRejected},
+	database.VerificationStatusVerified:  {database.VerificationStatusSuspended},
+	database.VerificationStatusSuspended: {database.VerificationStatusVerified},
+}
+
+func canTransition(from, to database.VerificationStatus) bool {
+	for _, allowed := range verificationTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// LicenseVerificationService keeps doctors out of search and booking until an admin has checked their license
+type LicenseVerificationService interface {
+	// UploadLicense stores a license document , a rejected doctor is put back in the review queue
+	UploadLicense(ctx context.Context, userId int64, fileHeader *multipart.FileHeader) (*model.LicenseDocumentResponse, error)
+	GetOwnVerification(ctx context.Context, userId int64) (model.DoctorVerificationResponse, error)
+	GetVerification(ctx context.Context, doctorId int64) (model.DoctorVerificationResponse, error)
+	ListByStatus(ctx context.Context, status database.VerificationStatus, limit, offset int32) (model.ListDoctorVerificationsResponse, error)
+	// Review moves the doctor to the status chosen by the admin
+	Review(ctx context.Context, adminUserId, doctorId int64, to database.VerificationStatus, req model.ReviewDoctorRequest) (model.DoctorVerificationResponse, error)
+}
+
+type licenseVerificationService struct {
+	doctorRepo  repository.DoctorRepository
+	fileStorage objstore.Storage
+}
+
+func NewLicenseVerificationService(doctorRepo repository.DoctorRepository, fileStorage objstore.Storage) LicenseVerificationService {
+	return &licenseVerificationService{
+		doctorRepo,
+		fileStorage,
+	}
+}
+
+func (s *licenseVerificationService) UploadLicense(ctx context.Context, userId int64, fileHeader *multipart.FileHeader) (*model.LicenseDocumentResponse, error) {
+	if err := validateLicenseDocument(fileHeader); err != nil {
+		return nil, err
+	}
+	doctor, err := s.doctorRepo.GetByUserId(ctx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the doctor details for this account:%v", err)
+	}
+	objectName := fmt.Sprintf("doctors_%d_licenses_%s%s", doctor.DoctorID, uuid.NewString(), filepath.Ext(fileHeader.Filename))
+	fileURL, err := s.fileStorage.Upload(ctx, objectName, fileHeader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to upload the license document:%v", err)
+	}
+	document, err := s.doctorRepo.CreateLicenseDocument(ctx, repository.CreateLicenseDocumentParams{
+		DoctorID:    doctor.DoctorID,
+		FileURL:     fileURL,
+		FileName:    filepath.Base(fileHeader.Filename),
+		ContentType: fileHeader.Header.Get("Content-Type"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to save the license document:%v", err)
+	}
+	if doctor.VerificationStatus == database.VerificationStatusRejected {
+		_, err := s.doctorRepo.UpdateVerificationStatus(ctx, repository.UpdateVerificationStatusParams{
+			DoctorID:  doctor.DoctorID,
+			From:      database.VerificationStatusRejected,
+			To:        database.VerificationStatusPending,
+			Reason:    "new license document uploaded",
+			ChangedBy: userId,
+		})
+		// someone else changed the status in the meantime , the document is still saved
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("unable to resubmit the doctor for review:%v", err)
+		}
+	}
+	return &model.LicenseDocumentResponse{
+		DocumentID:  document.DocumentID,
+		FileName:    document.FileName,
+		ContentType: document.ContentType,
+		UploadedAt:  document.UploadedAt,
+	}, nil
+}
+
+func (s *licenseVerificationService) GetOwnVerification(ctx context.Context, userId int64) (model.DoctorVerificationResponse, error) {
+	doctor, err := s.doctorRepo.GetByUserId(ctx, userId)
+	if err != nil {
+		return model.DoctorVerificationResponse{}, fmt.Errorf("unable to get the doctor details for this account:%v", err)
+	}
+	return s.verificationResponse(ctx, doctor)
+}
+
+func (s *licenseVerificationService) GetVerification(ctx context.Context, doctorId int64) (model.DoctorVerificationResponse, error) {
+	doctor, err := s.doctorRepo.GetById(ctx, doctorId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.DoctorVerificationResponse{}, ErrDoctorNotFound
+		}
+		return model.DoctorVerificationResponse{}, fmt.Errorf("unable to get the doctor details:%v", err)
+	}
+	return s.verificationResponse(ctx, doctor)
+}
+
+func (s *licenseVerificationService) ListByStatus(ctx context.Context, status database.VerificationStatus, limit, offset int32) (model.ListDoctorVerificationsResponse, error) {
+	// Fetch the limit+1 to determine if there's more data
+	rows, err := s.doctorRepo.ListByVerificationStatus(ctx, status, limit+1, offset)
+	if err != nil {
+		return model.ListDoctorVerificationsResponse{}, err
+	}
+	hasMore := false
+	if len(rows) > int(limit) {
+		hasMore = true
+		rows = rows[:limit]
+	}
+	return model.ListDoctorVerificationsResponse{
+		Doctors: rows,
+		HasMore: hasMore,
+	}, nil
+}
+
+func (s *licenseVerificationService) Review(ctx context.Context, adminUserId, doctorId int64, to database.VerificationStatus, req model.ReviewDoctorRequest) (model.DoctorVerificationResponse, error) {
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" && (to == database.VerificationStatusRejected || to == database.VerificationStatusSuspended) {
+		return model.DoctorVerificationResponse{}, ErrReviewReasonRequired
+	}
+	doctor, err := s.doctorRepo.GetById(ctx, doctorId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.DoctorVerificationResponse{}, ErrDoctorNotFound
+		}
+		return model.DoctorVerificationResponse{}, fmt.Errorf("unable to get the doctor details:%v", err)
+	}
+	if !canTransition(doctor.VerificationStatus, to) {
+		return model.DoctorVerificationResponse{}, ErrInvalidVerificationTransition
+	}
+	updated, err := s.doctorRepo.UpdateVerificationStatus(ctx, repository.UpdateVerificationStatusParams{
+		DoctorID:  doctorId,
+		From:      doctor.VerificationStatus,
+		To:        to,
+		Reason:    reason,
+		ChangedBy: adminUserId,
+	})
+	if err != nil {
+		// another admin reviewed the doctor first
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.DoctorVerificationResponse{}, ErrInvalidVerificationTransition
+		}
+		return model.DoctorVerificationResponse{}, fmt.Errorf("unable to update the verification status:%v", err)
+	}
+	log.Printf("doctor %d verification changed from %s to %s by user %d", doctorId, doctor.VerificationStatus, to, adminUserId)
+	return s.verificationResponse(ctx, updated)
+}
+
+func (s *licenseVerificationService) verificationResponse(ctx context.Context, doctor *database.Doctor) (model.DoctorVerificationResponse, error) {
+	documents, err := s.doctorRepo.ListLicenseDocuments(ctx, doctor.DoctorID)
+	if err != nil {
+		return model.DoctorVerificationResponse{}, fmt.Errorf("unable to get the license documents:%v", err)
+	}
+	history, err := s.doctorRepo.ListVerificationEvents(ctx, doctor.DoctorID)
+	if err != nil {
+		return model.DoctorVerificationResponse{}, fmt.Errorf("unable to get the verification history:%v", err)
+	}
+	response := model.DoctorVerificationResponse{
+		DoctorID:      doctor.DoctorID,
+		LicenseNumber: doctor.LicenseNumber,
+		Status:        doctor.VerificationStatus,
+		Reason:        doctor.VerificationReason,
+		Documents:     make([]model.LicenseDocumentResponse, len(documents)),
+		History:       history,
+	}
+	if doctor.VerifiedAt.Valid {
+		response.VerifiedAt = &doctor.VerifiedAt.Time
+	}
+	for i, document := range documents {
+		signedURL, err := s.fileStorage.CreateSignedURL(document.FileUrl, licenseDocumentURLDuration)
+		if err != nil {
+			return model.DoctorVerificationResponse{}, fmt.Errorf("unable to create a link to the license document:%v", err)
+		}
+		response.Documents[i] = model.LicenseDocumentResponse{
+			DocumentID:  document.DocumentID,
+			FileName:    document.FileName,
+			ContentType: document.ContentType,
+			URL:         signedURL,
+			UploadedAt:  document.UploadedAt,
+		}
+	}
+	return response, nil
+}
+
+func validateLicenseDocument(fileHeader *multipart.FileHeader) error {
+	if fileHeader.Size > maxLicenseDocumentSize {
+		return fmt.Errorf("%w: the document size %d exceeds the limit of %d bytes", ErrInvalidLicenseDocument, fileHeader.Size, maxLicenseDocumentSize)
+	}
+	contentType := strings.ToLower(fileHeader.Header.Get("Content-Type"))
+	if !allowedLicenseDocumentTypes[contentType] {
+		return fmt.Errorf("%w: the format %q is not supported , upload a PDF , JPEG or PNG", ErrInvalidLicenseDocument, contentType)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"mime/multipart"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/objstore"
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDoctorRepository struct {
+	repository.DoctorRepository
+	doctors   map[int64]*database.Doctor
+	documents []database.DoctorLicenseDocument
+	events    []database.DoctorVerificationEvent
+}
+
+func (f *fakeDoctorRepository) GetById(ctx context.Context, doctorId int64) (*database.Doctor, error) {
+	doctor, ok := f.doctors[doctorId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *doctor
+	return &copied, nil
+}
+
+func (f *fakeDoctorRepository) GetByUserId(ctx context.Context, userId int64) (*database.Doctor, error) {
+	for _, doctor := range f.doctors {
+		if doctor.UserID == userId {
+			copied := *doctor
+			return &copied, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (f *fakeDoctorRepository) UpdateVerificationStatus(ctx context.Context, params repository.UpdateVerificationStatusParams) (*database.Doctor, error) {
+	doctor, ok := f.doctors[params.DoctorID]
+	if !ok || doctor.VerificationStatus != params.From {
+		return nil, sql.ErrNoRows
+	}
+	doctor.VerificationStatus = params.To
+	doctor.VerificationReason = params.Reason
+	f.events = append(f.events, database.DoctorVerificationEvent{
+		DoctorID:   params.DoctorID,
+		FromStatus: params.From,
+		ToStatus:   params.To,
+		Reason:     params.Reason,
+		ChangedBy:  params.ChangedBy,
+	})
+	copied := *doctor
+	return &copied, nil
+}
+
+func (f *fakeDoctorRepository) CreateLicenseDocument(ctx context.Context, params repository.CreateLicenseDocumentParams) (*database.DoctorLicenseDocument, error) {
+	document := database.DoctorLicenseDocument{
+		DocumentID:  int64(len(f.documents) + 1),
+		DoctorID:    params.DoctorID,
+		FileUrl:     params.FileURL,
+		FileName:    params.FileName,
+		ContentType: params.ContentType,
+	}
+	f.documents = append(f.documents, document)
+	return &document, nil
+}
+
+func (f *fakeDoctorRepository) ListLicenseDocuments(ctx context.Context, doctorId int64) ([]database.DoctorLicenseDocument, error) {
+	return f.documents, nil
+}
+
+func (f *fakeDoctorRepository) ListVerificationEvents(ctx context.Context, doctorId int64) ([]database.DoctorVerificationEvent, error) {
+	return f.events, nil
+}
+
+type fakeStorage struct {
+	objstore.Storage
+	uploaded []string
+}
+
+func (f *fakeStorage) Upload(ctx context.Context, objName string, fileHeader *multipart.FileHeader) (string, error) {
+	f.uploaded = append(f.uploaded, objName)
+	return "https://storage.googleapis.com/lyra-records/" + objName, nil
+}
+
+func (f *fakeStorage) CreateSignedURL(unsignedURL string, duration time.Duration) (string, error) {
+	return unsignedURL + "?signed", nil
+}
+
+func newLicenseFile(contentType string) *multipart.FileHeader {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType)
+	return &multipart.FileHeader{Filename: "license.pdf", Header: header, Size: 1024}
+}
+
+func TestReviewDoctor(t *testing.T) {
+	const adminUserID = 5
+	doctorRepo := &fakeDoctorRepository{doctors: map[int64]*database.Doctor{
+		doctorID: {DoctorID: doctorID, UserID: specialistUserID, VerificationStatus: database.VerificationStatusPending},
+	}}
+	verification := NewLicenseVerificationService(doctorRepo, &fakeStorage{})
+	ctx := context.Background()
+
+	_, err := verification.Review(ctx, adminUserID, 999, database.VerificationStatusVerified, model.ReviewDoctorRequest{})
+	require.ErrorIs(t, err, ErrDoctorNotFound)
+	// rejecting needs a reason
+	_, err = verification.Review(ctx, adminUserID, doctorID, database.VerificationStatusRejected, model.ReviewDoctorRequest{Reason: "  "})
+	require.ErrorIs(t, err, ErrReviewReasonRequired)
+	// a pending doctor can't be suspended
+	_, err = verification.Review(ctx, adminUserID, doctorID, database.VerificationStatusSuspended, model.ReviewDoctorRequest{Reason: "complaints"})
+	require.ErrorIs(t, err, ErrInvalidVerificationTransition)
+
+	response, err := verification.Review(ctx, adminUserID, doctorID, database.VerificationStatusVerified, model.ReviewDoctorRequest{})
+	require.NoError(t, err)
+	require.Equal(t, database.VerificationStatusVerified, response.Status)
+	// approving twice isn't allowed
+	_, err = verification.Review(ctx, adminUserID, doctorID, database.VerificationStatusVerified, model.ReviewDoctorRequest{})
+	require.ErrorIs(t, err, ErrInvalidVerificationTransition)
+
+	response, err = verification.Review(ctx, adminUserID, doctorID, database.VerificationStatusSuspended, model.ReviewDoctorRequest{Reason: "license expired"})
+	require.NoError(t, err)
+	require.Equal(t, database.VerificationStatusSuspended, response.Status)
+	require.Equal(t, "license expired", response.Reason)
+	require.Len(t, response.History, 2)
+	require.Equal(t, int64(adminUserID), response.History[1].ChangedBy)
+}
+
+func TestUploadLicense(t *testing.T) {
+	doctorRepo := &fakeDoctorRepository{doctors: map[int64]*database.Doctor{
+		doctorID: {DoctorID: doctorID, UserID: specialistUserID, VerificationStatus: database.VerificationStatusRejected, VerificationReason: "the document is unreadable"},
+	}}
+	storage := &fakeStorage{}
+	verification := NewLicenseVerificationService(doctorRepo, storage)
+	ctx := context.Background()
+
+	_, err := verification.UploadLicense(ctx, specialistUserID, newLicenseFile("application/zip"))
+	require.ErrorIs(t, err, ErrInvalidLicenseDocument)
+	require.Empty(t, storage.uploaded)
+
+	document, err := verification.UploadLicense(ctx, specialistUserID, newLicenseFile("application/pdf"))
+	require.NoError(t, err)
+	require.Equal(t, "license.pdf", document.FileName)
+	require.Len(t, storage.uploaded, 1)
+
+	// a rejected doctor is put back in the review queue
+	response, err := verification.GetOwnVerification(ctx, specialistUserID)
+	require.NoError(t, err)
+	require.Equal(t, database.VerificationStatusPending, response.Status)
+	require.Len(t, response.Documents, 1)
+	require.Contains(t, response.Documents[0].URL, "?signed")
+}
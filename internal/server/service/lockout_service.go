@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mbeka02/lyra_backend/internal/auth"
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/mailer"
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+)
+
+var (
+	ErrLoginThrottled     = errors.New("too many failed login attempts , please wait before trying again")
+	ErrAccountLocked      = errors.New("the account has been locked after too many failed login attempts , use the link sent to your email to unlock it")
+	ErrInvalidUnlockToken = errors.New("the unlock link is invalid or has expired")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrChallengeExhausted = errors.New("too many wrong codes have been entered , please log in again")
+)
+
+// LoginBlockedError is returned while a login is throttled or locked , it wraps ErrLoginThrottled or ErrAccountLocked
+type LoginBlockedError struct {
+	Err        error
+	RetryAfter time.Time
+}
+
+func (e *LoginBlockedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *LoginBlockedError) Unwrap() error {
+	return e.Err
+}
+
+type LockoutConfig struct {
+	// failures allowed before the backoff starts
+	FreeAttempts int
+	// the wait after the first failure past FreeAttempts , it doubles with every failure up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// failures after which the account is locked
+	MaxAttempts     int
+	LockoutDuration time.Duration
+	// wrong second factor codes allowed per login challenge
+	MaxChallengeAttempts int
+	// UnlockURL is the page the emailed link opens , the token is appended as the "token" query parameter
+	UnlockURL string
+}
+
+// LockoutService throttles logins per email address , failures are tracked whether or not an account exists
+// so that the responses don't reveal which addresses are registered
+type LockoutService interface {
+	// CheckLogin returns a *LoginBlockedError if the email can't be used to log in yet
+	CheckLogin(ctx context.Context, email string) error
+	// RecordFailedLogin returns a *LoginBlockedError if the failure locked the account
+	RecordFailedLogin(ctx context.Context, email string) error
+	// CheckSecondFactor returns ErrChallengeExhausted if too many wrong codes have been entered against the challenge
+	// and a *LoginBlockedError if the email can't be used to log in yet
+	CheckSecondFactor(ctx context.Context, email string, challengeId uuid.UUID) error
+	// RecordFailedSecondFactor counts a wrong code as a failed login , it returns a *LoginBlockedError if the failure
+	// locked the account and ErrChallengeExhausted if the challenge can't be used again
+	RecordFailedSecondFactor(ctx context.Context, email string, challengeId uuid.UUID) error
+	// RecordSuccessfulLogin forgets the failures , it is called once the user has been fully authenticated
+	RecordSuccessfulLogin(ctx context.Context, email string)
+	// Unlock uses the token from the emailed link
+	Unlock(ctx context.Context, req model.UnlockAccountRequest) error
+	// UnlockUser is used by admins
+	UnlockUser(ctx context.Context, userId int64) error
+}
+
+type lockoutService struct {
+	loginAttemptRepo repository.LoginAttemptRepository
+	userRepo         repository.UserRepository
+	mailer           mailer.Mailer
+	config           LockoutConfig
+}
+
+func NewLockoutService(loginAttemptRepo repository.LoginAttemptRepository, userRepo repository.UserRepository, mailer mailer.Mailer, config LockoutConfig) LockoutService {
+	return &lockoutService{
+		loginAttemptRepo,
+		userRepo,
+		mailer,
+		config,
+	}
+}
+
+func (s *lockoutService) CheckLogin(ctx context.Context, email string) error {
+	attempt, err := s.loginAttemptRepo.Get(ctx, email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("unable to check the failed login attempts:%v", err)
+	}
+	return checkAttempt(attempt)
+}
+
+func checkAttempt(attempt *database.LoginAttempt) error {
+	now := time.Now()
+	if attempt.LockedUntil.Valid && attempt.LockedUntil.Time.After(now) {
+		return &LoginBlockedError{Err: ErrAccountLocked, RetryAfter: attempt.LockedUntil.Time}
+	}
+	if attempt.RetryAfter.Valid && attempt.RetryAfter.Time.After(now) {
+		return &LoginBlockedError{Err: ErrLoginThrottled, RetryAfter: attempt.RetryAfter.Time}
+	}
+	return nil
+}
+
+func (s *lockoutService) RecordFailedLogin(ctx context.Context, email string) error {
+	attempt, err := s.loginAttemptRepo.RecordFailure(ctx, email)
+	if err != nil {
+		log.Printf("unable to record the failed login for %s: %v", email, err)
+		return nil
+	}
+	return s.throttle(ctx, email, attempt)
+}
+
+func (s *lockoutService) CheckSecondFactor(ctx context.Context, email string, challengeId uuid.UUID) error {
+	attempt, err := s.loginAttemptRepo.Get(ctx, email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("unable to check the failed login attempts:%v", err)
+	}
+	if s.challengeExhausted(attempt, challengeId) {
+		return ErrChallengeExhausted
+	}
+	return checkAttempt(attempt)
+}
+
+func (s *lockoutService) RecordFailedSecondFactor(ctx context.Context, email string, challengeId uuid.UUID) error {
+	attempt, err := s.loginAttemptRepo.RecordSecondFactorFailure(ctx, email, challengeId)
+	if err != nil {
+		log.Printf("unable to record the failed second factor for %s: %v", email, err)
+		return nil
+	}
+	if err := s.throttle(ctx, email, attempt); err != nil {
+		return err
+	}
+	if s.challengeExhausted(attempt, challengeId) {
+		log.Printf("login challenge for %s refused after %d wrong codes", email, attempt.ChallengeFailures)
+		return ErrChallengeExhausted
+	}
+	return nil
+}
+
+func (s *lockoutService) challengeExhausted(attempt *database.LoginAttempt, challengeId uuid.UUID) bool {
+	return attempt.ChallengeID.Valid && attempt.ChallengeID.UUID == challengeId && int(attempt.ChallengeFailures) >= s.config.MaxChallengeAttempts
+}
+
+// throttle starts the backoff once the free attempts have been used up and locks the account after MaxAttempts failures
+func (s *lockoutService) throttle(ctx context.Context, email string, attempt *database.LoginAttempt) error {
+	failures := int(attempt.FailedAttempts)
+	if failures <= s.config.FreeAttempts {
+		return nil
+	}
+	now := time.Now()
+	params := repository.BlockLoginParams{
+		Email:      email,
+		RetryAfter: now.Add(s.backoff(failures)),
+	}
+	locked := failures >= s.config.MaxAttempts
+	if locked {
+		params.LockedUntil = now.Add(s.config.LockoutDuration)
+		params.RetryAfter = params.LockedUntil
+	}
+	if err := s.loginAttemptRepo.Block(ctx, params); err != nil {
+		log.Printf("unable to throttle logins for %s: %v", email, err)
+		return nil
+	}
+	if !locked {
+		return nil
+	}
+	log.Printf("login for %s locked until %s after %d failed attempts", email, params.LockedUntil.Format(time.RFC3339), failures)
+	s.sendUnlockEmail(ctx, email, params.LockedUntil)
+	return &LoginBlockedError{Err: ErrAccountLocked, RetryAfter: params.LockedUntil}
+}
+
+// backoff doubles the wait for every failure past the free attempts
+func (s *lockoutService) backoff(failures int) time.Duration {
+	delay := s.config.BaseDelay
+	for i := s.config.FreeAttempts + 1; i < failures; i++ {
+		delay *= 2
+		if delay >= s.config.MaxDelay {
+			return s.config.MaxDelay
+		}
+	}
+	return delay
+}
+
+// sendUnlockEmail lets the owner of the account unlock it straight away , nothing is sent if no account uses the address
+func (s *lockoutService) sendUnlockEmail(ctx context.Context, email string, lockedUntil time.Time) {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("unable to get the details of the locked account %s: %v", email, err)
+		}
+		return
+	}
+	token, err := auth.NewOpaqueToken()
+	if err != nil {
+		log.Printf("unable to generate the unlock token for user %d: %v", user.UserID, err)
+		return
+	}
+	// the link isn't needed once the lockout runs out
+	err = s.loginAttemptRepo.CreateUnlockToken(ctx, repository.CreateAccountUnlockTokenParams{
+		UserID:    user.UserID,
+		TokenHash: auth.HashOpaqueToken(token),
+		ExpiresAt: lockedUntil,
+	})
+	if err != nil {
+		log.Printf("unable to save the unlock token for user %d: %v", user.UserID, err)
+		return
+	}
+	link := fmt.Sprintf("%s?token=%s", s.config.UnlockURL, url.QueryEscape(token))
+	if err := s.mailer.Send(ctx, mailer.NewAccountLockedEmail(user.FullName, user.Email, link, lockedUntil)); err != nil {
+		log.Printf("unable to send the unlock email to user %d: %v", user.UserID, err)
+	}
+}
+
+func (s *lockoutService) RecordSuccessfulLogin(ctx context.Context, email string) {
+	if err := s.loginAttemptRepo.Clear(ctx, email); err != nil {
+		log.Printf("unable to clear the failed login attempts for %s: %v", email, err)
+	}
+}
+
+func (s *lockoutService) Unlock(ctx context.Context, req model.UnlockAccountRequest) error {
+	userId, err := s.loginAttemptRepo.Unlock(ctx, auth.HashOpaqueToken(req.Token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidUnlockToken
+		}
+		return fmt.Errorf("unable to unlock the account:%v", err)
+	}
+	log.Printf("user %d unlocked their account", userId)
+	return nil
+}
+
+func (s *lockoutService) UnlockUser(ctx context.Context, userId int64) error {
+	if err := s.loginAttemptRepo.UnlockUser(ctx, userId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("unable to unlock the account:%v", err)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLoginAttemptRepository struct {
+	repository.LoginAttemptRepository
+	attempts     map[string]*database.LoginAttempt
+	unlockTokens map[string]int64
+}
+
+func newFakeLoginAttemptRepository() *fakeLoginAttemptRepository {
+	return &fakeLoginAttemptRepository{
+		attempts:     map[string]*database.LoginAttempt{},
+		unlockTokens: map[string]int64{},
+	}
+}
+
+func (f *fakeLoginAttemptRepository) Get(ctx context.Context, email string) (*database.LoginAttempt, error) {
+	attempt, ok := f.attempts[strings.ToLower(email)]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return attempt, nil
+}
+
+func (f *fakeLoginAttemptRepository) RecordFailure(ctx context.Context, email string) (*database.LoginAttempt, error) {
+	email = strings.ToLower(email)
+	attempt, ok := f.attempts[email]
+	if !ok {
+		attempt = &database.LoginAttempt{Email: email}
+		f.attempts[email] = attempt
+	}
+	attempt.FailedAttempts++
+	attempt.LastFailedAt = time.Now()
+	return attempt, nil
+}
+
+func (f *fakeLoginAttemptRepository) RecordSecondFactorFailure(ctx context.Context, email string, challengeId uuid.UUID) (*database.LoginAttempt, error) {
+	attempt, _ := f.RecordFailure(ctx, email)
+	if attempt.ChallengeID.UUID != challengeId {
+		attempt.ChallengeID = uuid.NullUUID{UUID: challengeId, Valid: true}
+		attempt.ChallengeFailures = 0
+	}
+	attempt.ChallengeFailures++
+	return attempt, nil
+}
+
+func (f *fakeLoginAttemptRepository) Block(ctx context.Context, params repository.BlockLoginParams) error {
+	attempt := f.attempts[strings.ToLower(params.Email)]
+	attempt.RetryAfter = sql.NullTime{Time: params.RetryAfter, Valid: !params.RetryAfter.IsZero()}
+	attempt.LockedUntil = sql.NullTime{Time: params.LockedUntil, Valid: !params.LockedUntil.IsZero()}
+	return nil
+}
+
+func (f *fakeLoginAttemptRepository) Clear(ctx context.Context, email string) error {
+	delete(f.attempts, strings.ToLower(email))
+	return nil
+}
+
+func (f *fakeLoginAttemptRepository) CreateUnlockToken(ctx context.Context, params repository.CreateAccountUnlockTokenParams) error {
+	f.unlockTokens[params.TokenHash] = params.UserID
+	return nil
+}
+
+func (f *fakeUserRepository) GetByEmail(ctx context.Context, email string) (*database.User, error) {
+	for _, user := range f.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func testLockoutConfig() LockoutConfig {
+	return LockoutConfig{
+		FreeAttempts:         3,
+		BaseDelay:            time.Second,
+		MaxDelay:             10 * time.Second,
+		MaxAttempts:          10,
+		LockoutDuration:      30 * time.Minute,
+		MaxChallengeAttempts: 3,
+		UnlockURL:            "https://lyra.example.com/unlock",
+	}
+}
+
+func TestLoginBackoff(t *testing.T) {
+	lockout := &lockoutService{config: testLockoutConfig()}
+	testCases := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{7, 8 * time.Second},
+		{8, 10 * time.Second},
+		{20, 10 * time.Second},
+	}
+	for _, tc := range testCases {
+		require.Equal(t, tc.expected, lockout.backoff(tc.failures), "failures: %d", tc.failures)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	const email = "jane@example.com"
+	attemptRepo := newFakeLoginAttemptRepository()
+	mail := &fakeMailer{}
+	lockout := NewLockoutService(
+		attemptRepo,
+		&fakeUserRepository{users: map[int64]database.User{patientUserID: {UserID: patientUserID, FullName: "Jane Wanjiru", Email: email}}},
+		mail,
+		testLockoutConfig(),
+	)
+	ctx := context.Background()
+
+	// the first few failures aren't throttled
+	for i := 0; i < 3; i++ {
+		require.NoError(t, lockout.RecordFailedLogin(ctx, email))
+		require.NoError(t, lockout.CheckLogin(ctx, email))
+	}
+	require.NoError(t, lockout.RecordFailedLogin(ctx, email))
+	err := lockout.CheckLogin(ctx, "JANE@example.com")
+	require.ErrorIs(t, err, ErrLoginThrottled)
+	var blocked *LoginBlockedError
+	require.ErrorAs(t, err, &blocked)
+	require.WithinDuration(t, time.Now().Add(time.Second), blocked.RetryAfter, time.Second)
+
+	for i := 5; i < 10; i++ {
+		require.NoError(t, lockout.RecordFailedLogin(ctx, email))
+	}
+	require.Empty(t, mail.sent)
+	// the tenth failure locks the account and emails the owner an unlock link
+	err = lockout.RecordFailedLogin(ctx, email)
+	require.ErrorIs(t, err, ErrAccountLocked)
+	require.ErrorIs(t, lockout.CheckLogin(ctx, email), ErrAccountLocked)
+	require.Len(t, mail.sent, 1)
+	require.Equal(t, email, mail.sent[0].ToAddress)
+	require.Contains(t, mail.sent[0].PlainText, "https://lyra.example.com/unlock?token=")
+	require.Len(t, attemptRepo.unlockTokens, 1)
+
+	// a successful login forgets the failures
+	lockout.RecordSuccessfulLogin(ctx, email)
+	require.NoError(t, lockout.CheckLogin(ctx, email))
+}
+
+func TestLockoutOfUnknownEmail(t *testing.T) {
+	attemptRepo := newFakeLoginAttemptRepository()
+	mail := &fakeMailer{}
+	lockout := NewLockoutService(attemptRepo, &fakeUserRepository{}, mail, testLockoutConfig())
+	ctx := context.Background()
+
+	// addresses without an account are throttled the same way but there is no one to email
+	var err error
+	for i := 0; i < 10; i++ {
+		err = lockout.RecordFailedLogin(ctx, "nobody@example.com")
+	}
+	require.ErrorIs(t, err, ErrAccountLocked)
+	require.Empty(t, mail.sent)
+	require.Empty(t, attemptRepo.unlockTokens)
+}
@@ -6,11 +6,13 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/mbeka02/lyra_backend/internal/audit"
 	"github.com/mbeka02/lyra_backend/internal/database"
 	"github.com/mbeka02/lyra_backend/internal/model"
 	"github.com/mbeka02/lyra_backend/internal/server/repository"
 )
 
+// access to forPatientID is checked by the RequirePatientAccess middleware before any of these are called
 type MedicationService interface {
 	CreateMedication(ctx context.Context, req model.CreateMedicationStatementRequest, actingUserID int64, forPatientID int64) (database.MedicationStatement, error)
 	GetMedication(ctx context.Context, medicationID uuid.UUID, actingUserID int64, forPatientID int64) (database.MedicationStatement, error)
@@ -21,14 +23,14 @@ type MedicationService interface {
 
 type medicationService struct {
 	medicationRepo repository.MedicationStatementRepository
+	auditService   AuditService
 }
 
-func NewMedicationService(medRepo repository.MedicationStatementRepository) MedicationService {
-	return &medicationService{medicationRepo: medRepo}
+func NewMedicationService(medRepo repository.MedicationStatementRepository, auditService AuditService) MedicationService {
+	return &medicationService{medicationRepo: medRepo, auditService: auditService}
 }
 
 func (s *medicationService) CreateMedication(ctx context.Context, req model.CreateMedicationStatementRequest, actingUserID int64, forPatientID int64) (database.MedicationStatement, error) {
-	// TODO: Authorization
 	params := database.CreateMedicationStatementParams{
 		PatientID:             forPatientID,
 		Status:                req.Status,
@@ -38,21 +40,33 @@ func (s *medicationService) CreateMedication(ctx context.Context, req model.Crea
 		DosageText:            ToNullString(req.DosageText),
 		EffectiveDateTime:     ToNullTime(req.EffectiveDateTime),
 	}
-	return s.medicationRepo.Create(ctx, params)
+	medication, err := s.medicationRepo.Create(ctx, params)
+	if err != nil {
+		return medication, err
+	}
+	s.record(ctx, forPatientID, medication.ID.String(), audit.ActionCreate)
+	return medication, nil
 }
 
 func (s *medicationService) GetMedication(ctx context.Context, medicationID uuid.UUID, actingUserID int64, forPatientID int64) (database.MedicationStatement, error) {
-	// TODO: Authorization
-	return s.medicationRepo.GetByID(ctx, medicationID, forPatientID)
+	medication, err := s.medicationRepo.GetByID(ctx, medicationID, forPatientID)
+	if err != nil {
+		return medication, err
+	}
+	s.record(ctx, forPatientID, medicationID.String(), audit.ActionRead)
+	return medication, nil
 }
 
 func (s *medicationService) ListMedicationsForPatient(ctx context.Context, actingUserID int64, forPatientID int64) ([]database.MedicationStatement, error) {
-	// TODO: Authorization
-	return s.medicationRepo.ListByPatientID(ctx, forPatientID)
+	medications, err := s.medicationRepo.ListByPatientID(ctx, forPatientID)
+	if err != nil {
+		return medications, err
+	}
+	s.record(ctx, forPatientID, "", audit.ActionList)
+	return medications, nil
 }
 
 func (s *medicationService) UpdateMedication(ctx context.Context, medicationID uuid.UUID, req model.UpdateMedicationStatementRequest, actingUserID int64, forPatientID int64) (database.MedicationStatement, error) {
-	// TODO: Authorization
 	params := database.UpdateMedicationStatementParams{
 		ID:                    medicationID,
 		PatientID:             forPatientID, // For WHERE clause
@@ -63,12 +77,29 @@ func (s *medicationService) UpdateMedication(ctx context.Context, medicationID u
 		DosageText:            ToNullString(req.DosageText),
 		EffectiveDateTime:     ToNullTime(req.EffectiveDateTime),
 	}
-	return s.medicationRepo.Update(ctx, params)
+	medication, err := s.medicationRepo.Update(ctx, params)
+	if err != nil {
+		return medication, err
+	}
+	s.record(ctx, forPatientID, medicationID.String(), audit.ActionUpdate)
+	return medication, nil
 }
 
 func (s *medicationService) DeleteMedication(ctx context.Context, medicationID uuid.UUID, actingUserID int64, forPatientID int64) error {
-	// TODO: Authorization
-	return s.medicationRepo.Delete(ctx, medicationID, forPatientID)
+	if err := s.medicationRepo.Delete(ctx, medicationID, forPatientID); err != nil {
+		return err
+	}
+	s.record(ctx, forPatientID, medicationID.String(), audit.ActionDelete)
+	return nil
+}
+
+func (s *medicationService) record(ctx context.Context, patientID int64, resourceID string, action audit.Action) {
+	s.auditService.Record(ctx, AuditEntry{
+		PatientID:    patientID,
+		ResourceType: audit.ResourceMedication,
+		ResourceID:   resourceID,
+		Action:       action,
+	})
 }
 
 func ToNullTime(t *time.Time) sql.NullTime {
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/mbeka02/lyra_backend/internal/audit"
 	"github.com/mbeka02/lyra_backend/internal/database"
 	"github.com/mbeka02/lyra_backend/internal/server/repository"
 	samplyFhir "github.com/samply/golang-fhir-models/fhir-models/fhir"
@@ -31,12 +32,14 @@ type ObservationService interface {
 type observationService struct {
 	observationRepo repository.ObservationRepository
 	fhirClient      *fhir.FHIRClient
+	auditService    AuditService
 }
 
-func NewObservationService(obsRepo repository.ObservationRepository, fhirClient *fhir.FHIRClient) ObservationService {
+func NewObservationService(obsRepo repository.ObservationRepository, fhirClient *fhir.FHIRClient, auditService AuditService) ObservationService {
 	return &observationService{
 		fhirClient:      fhirClient,
 		observationRepo: obsRepo,
+		auditService:    auditService,
 	}
 }
 
@@ -66,6 +69,11 @@ func (s *observationService) CreateConsultationNote(
 		// Return a more generic error to the handler/user
 		return nil, fmt.Errorf("failed to save consultation note")
 	}
+	resourceID := ""
+	if savedFhirObs.Id != nil {
+		resourceID = *savedFhirObs.Id
+	}
+	s.record(ctx, req.PatientID, resourceID, audit.ActionCreate)
 
 	// Return the saved resource (which includes server-assigned ID, meta, etc.)
 	return savedFhirObs, nil
@@ -103,6 +111,7 @@ func (s *observationService) SearchObservations(
 	if err != nil {
 		return nil, fmt.Errorf("failed to search observations in FHIR store: %w", err)
 	}
+	s.record(ctx, targetPatientID, "", audit.ActionList)
 	return bundle, nil
 }
 
@@ -138,9 +147,6 @@ func (s *observationService) CreateObservationInDB(
 	forPatientID int64,
 	// specialistIDIfCreating *int64, // Pass specialistID explicitly if relevant
 ) (database.Observation, error) {
-	// TODO: Authorization: Can actingUserID create observation for forPatientID?
-	// E.g., is actingUser the patient themselves (if allowed), or an authorized specialist?
-
 	params := database.CreateObservationParams{
 		PatientID:         forPatientID,
 		Status:            req.Status,
@@ -149,7 +155,12 @@ func (s *observationService) CreateObservationInDB(
 		ValueString:       req.ValueString,
 		// SpecialistID:        ToNullInt64(specialistIDIfCreating), // If tracking specialist
 	}
-	return s.observationRepo.Create(ctx, params)
+	observation, err := s.observationRepo.Create(ctx, params)
+	if err != nil {
+		return observation, err
+	}
+	s.record(ctx, forPatientID, observation.ID.String(), audit.ActionCreate)
+	return observation, nil
 }
 
 func (s *observationService) GetObservation(
@@ -158,8 +169,12 @@ func (s *observationService) GetObservation(
 	actingUserID int64,
 	forPatientID int64,
 ) (database.Observation, error) {
-	// TODO: Authorization: Can actingUserID view observation for forPatientID?
-	return s.observationRepo.GetByID(ctx, observationID, forPatientID)
+	observation, err := s.observationRepo.GetByID(ctx, observationID, forPatientID)
+	if err != nil {
+		return observation, err
+	}
+	s.record(ctx, forPatientID, observationID.String(), audit.ActionRead)
+	return observation, nil
 }
 
 func (s *observationService) ListObservationsForPatient(
@@ -167,8 +182,12 @@ func (s *observationService) ListObservationsForPatient(
 	actingUserID int64,
 	forPatientID int64,
 ) ([]database.Observation, error) {
-	// TODO: Authorization: Can actingUserID list observations for forPatientID?
-	return s.observationRepo.ListByPatientID(ctx, forPatientID)
+	observations, err := s.observationRepo.ListByPatientID(ctx, forPatientID)
+	if err != nil {
+		return observations, err
+	}
+	s.record(ctx, forPatientID, "", audit.ActionList)
+	return observations, nil
 }
 
 func (s *observationService) UpdateObservation(
@@ -179,8 +198,6 @@ func (s *observationService) UpdateObservation(
 	forPatientID int64,
 	// specialistIDIfUpdating *int64,
 ) (database.Observation, error) {
-	// TODO: Authorization: Can actingUserID update observation for forPatientID?
-
 	// Optional: Fetch existing to ensure it belongs to forPatientID before update
 	// _, err := s.observationRepo.GetByID(ctx, observationID, forPatientID)
 	// if err != nil {
@@ -197,7 +214,12 @@ func (s *observationService) UpdateObservation(
 		// SpecialistID:        ToNullInt64(specialistIDIfUpdating), // If tracking specialist
 		// UpdatedAt is handled by default in the query or trigger
 	}
-	return s.observationRepo.Update(ctx, params)
+	observation, err := s.observationRepo.Update(ctx, params)
+	if err != nil {
+		return observation, err
+	}
+	s.record(ctx, forPatientID, observationID.String(), audit.ActionUpdate)
+	return observation, nil
 }
 
 func (s *observationService) DeleteObservation(
@@ -206,14 +228,25 @@ func (s *observationService) DeleteObservation(
 	actingUserID int64,
 	forPatientID int64,
 ) error {
-	// TODO: Authorization: Can actingUserID delete observation for forPatientID?
-
 	// Optional: Fetch existing to ensure it belongs to forPatientID before delete
 	// _, err := s.observationRepo.GetByID(ctx, observationID, forPatientID)
 	// if err != nil {
 	// 	return fmt.Errorf("observation not found or access denied: %w", err)
 	// }
-	return s.observationRepo.Delete(ctx, observationID, forPatientID)
+	if err := s.observationRepo.Delete(ctx, observationID, forPatientID); err != nil {
+		return err
+	}
+	s.record(ctx, forPatientID, observationID.String(), audit.ActionDelete)
+	return nil
+}
+
+func (s *observationService) record(ctx context.Context, patientID int64, resourceID string, action audit.Action) {
+	s.auditService.Record(ctx, AuditEntry{
+		PatientID:    patientID,
+		ResourceType: audit.ResourceObservation,
+		ResourceID:   resourceID,
+		Action:       action,
+	})
 }
 
 // Helper for nullable int64 (if using specialist_id)
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/auth"
+	"github.com/mbeka02/lyra_backend/internal/mailer"
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+)
+
+var (
+	ErrInvalidResetToken = errors.New("the password reset link is invalid or has expired")
+	ErrIncorrectPassword = errors.New("the current password is incorrect")
+	ErrPasswordUnchanged = errors.New("the new password must be different from the current one")
+)
+
+type PasswordResetConfig struct {
+	// ResetURL is the page the emailed link opens , the token is appended as the "token" query parameter
+	ResetURL      string
+	TokenDuration time.Duration
+}
+
+type PasswordService interface {
+	// ForgotPassword emails a reset link if an account exists for the address , it doesn't reveal whether it does
+	ForgotPassword(ctx context.Context, req model.ForgotPasswordRequest) error
+	ResetPassword(ctx context.Context, req model.ResetPasswordRequest) error
+	// ChangePassword logs the user out everywhere and returns a fresh session for the device that made the change
+	ChangePassword(ctx context.Context, req model.ChangePasswordRequest, userId int64, client model.ClientInfo) (model.TokenResponse, error)
+}
+
+type passwordService struct {
+	userRepo       repository.UserRepository
+	sessionService SessionService
+	mailer         mailer.Mailer
+	config         PasswordResetConfig
+}
+
+func NewPasswordService(userRepo repository.UserRepository, sessionService SessionService, mailer mailer.Mailer, config PasswordResetConfig) PasswordService {
+	return &passwordService{
+		userRepo,
+		sessionService,
+		mailer,
+		config,
+	}
+}
+
+func (s *passwordService) ForgotPassword(ctx context.Context, req model.ForgotPasswordRequest) error {
+	user, err := s.userRepo.GetByEmail(ctx, req.Email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("unable to get user details:%v", err)
+	}
+	token, err := auth.NewOpaqueToken()
+	if err != nil {
+		return fmt.Errorf("unable to generate the reset token:%v", err)
+	}
+	err = s.userRepo.CreatePasswordResetToken(ctx, repository.CreatePasswordResetTokenParams{
+		UserID:    user.UserID,
+		TokenHash: auth.HashOpaqueToken(token),
+		ExpiresAt: time.Now().Add(s.config.TokenDuration),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to save the reset token:%v", err)
+	}
+	link := fmt.Sprintf("%s?token=%s", s.config.ResetURL, url.QueryEscape(token))
+	if err := s.mailer.Send(ctx, mailer.NewPasswordResetEmail(user.FullName, user.Email, link, s.config.TokenDuration)); err != nil {
+		log.Printf("unable to send the password reset email to user %d: %v", user.UserID, err)
+	}
+	return nil
+}
+
+func (s *passwordService) ResetPassword(ctx context.Context, req model.ResetPasswordRequest) error {
+	passwordHash, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		return fmt.Errorf("failed to process password:%v", err)
+	}
+	_, err = s.userRepo.ResetPassword(ctx, repository.ResetPasswordParams{
+		TokenHash: auth.HashOpaqueToken(req.Token),
+		Password:  passwordHash,
+		ChangedAt: passwordChangeTime(),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidResetToken
+		}
+		return fmt.Errorf("unable to reset the password:%v", err)
+	}
+	return nil
+}
+
+func (s *passwordService) ChangePassword(ctx context.Context, req model.ChangePasswordRequest, userId int64, client model.ClientInfo) (model.TokenResponse, error) {
+	user, err := s.userRepo.GetById(ctx, userId)
+	if err != nil {
+		return model.TokenResponse{}, fmt.Errorf("unable to get user details:%v", err)
+	}
+	if err := auth.ComparePassword(req.OldPassword, user.Password); err != nil {
+		return model.TokenResponse{}, ErrIncorrectPassword
+	}
+	if req.OldPassword == req.NewPassword {
+		return model.TokenResponse{}, ErrPasswordUnchanged
+	}
+	passwordHash, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		return model.TokenResponse{}, fmt.Errorf("failed to process password:%v", err)
+	}
+	err = s.userRepo.UpdatePassword(ctx, repository.UpdatePasswordParams{
+		UserID:    userId,
+		Password:  passwordHash,
+		ChangedAt: passwordChangeTime(),
+	})
+	if err != nil {
+		return model.TokenResponse{}, fmt.Errorf("unable to update the password:%v", err)
+	}
+	return s.sessionService.CreateSession(ctx, user, client)
+}
+
+// passwordChangeTime is truncated to postgres' precision so that tokens issued right after the change
+// aren't rejected because the stored value was rounded up
+func passwordChangeTime() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/payment"
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+)
+
+var ErrReconciliationRunNotFound = errors.New("reconciliation run not found")
+
+// the outcome recorded for each payment that is reconciled
+const (
+	reconciliationUpdated   = "updated"
+	reconciliationUnchanged = "unchanged"
+	reconciliationMismatch  = "mismatch"
+	reconciliationError     = "error"
+)
+
+type PaymentReconciliationConfig struct {
+	// payments that have been pending for longer than this are checked with the provider
+	StaleAfter time.Duration
+	// how often the pending payments are reconciled
+	Interval time.Duration
+	// the most payments checked in a single run
+	BatchSize int32
+}
+
+// PaymentReconciler catches up on payments whose webhook never arrived by asking the provider what happened to them
+type PaymentReconciler interface {
+	// Run reconciles every Interval until the context is cancelled
+	Run(ctx context.Context)
+	// Reconcile checks the stale pending payments once and returns the finished run
+	Reconcile(ctx context.Context) (*database.ReconciliationRun, error)
+	ListRuns(ctx context.Context, limit, offset int32) (model.ListReconciliationRunsResponse, error)
+	GetReport(ctx context.Context, runId int64) (*model.ReconciliationReport, error)
+}
+
+type paymentReconciler struct {
+	// the statuses are updated the same way the webhook and callback do it
+	payments           PaymentService
+	reconciliationRepo repository.ReconciliationRepository
+	config             PaymentReconciliationConfig
+}
+
+func NewPaymentReconciler(payments PaymentService, reconciliationRepo repository.ReconciliationRepository, config PaymentReconciliationConfig) PaymentReconciler {
+	return &paymentReconciler{
+		payments,
+		reconciliationRepo,
+		config,
+	}
+}
+
+func (r *paymentReconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.Reconcile(ctx); err != nil {
+			log.Printf("unable to reconcile pending payments: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *paymentReconciler) Reconcile(ctx context.Context) (*database.ReconciliationRun, error) {
+	stale, err := r.reconciliationRepo.ListStalePendingPayments(ctx, time.Now().Add(-r.config.StaleAfter), r.config.BatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the pending payments:%v", err)
+	}
+	// nothing is recorded for the runs that have nothing to check
+	if len(stale) == 0 {
+		return nil, nil
+	}
+	run, err := r.reconciliationRepo.StartRun(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to start a reconciliation run:%v", err)
+	}
+	totals := repository.FinishReconciliationRunParams{RunID: run.RunID}
+	for _, pending := range stale {
+		item := r.reconcilePayment(ctx, pending)
+		item.RunID = run.RunID
+		if _, err := r.reconciliationRepo.CreateItem(ctx, item); err != nil {
+			log.Printf("unable to record the reconciliation of payment %s: %v", pending.Reference, err)
+		}
+		totals.Checked++
+		switch item.Outcome {
+		case reconciliationUpdated:
+			totals.Updated++
+		case reconciliationMismatch:
+			totals.Mismatched++
+		case reconciliationError:
+			totals.Failed++
+		}
+	}
+	if totals.Mismatched > 0 || totals.Failed > 0 {
+		log.Printf("reconciliation run %d: %d payments mismatched and %d couldn't be checked", run.RunID, totals.Mismatched, totals.Failed)
+	}
+	return r.reconciliationRepo.FinishRun(ctx, totals)
+}
+
+// reconcilePayment verifies a single payment with the provider and moves it (and its appointment) to the status the provider reports
+func (r *paymentReconciler) reconcilePayment(ctx context.Context, pending database.Payment) repository.CreateReconciliationItemParams {
+	item := repository.CreateReconciliationItemParams{
+		PaymentID:        pending.PaymentID,
+		Reference:        pending.Reference,
+		ExpectedAmount:   pending.Amount,
+		ExpectedCurrency: pending.Currency,
+	}
+	verification, err := r.payments.VerifyPayment(ctx, pending)
+	if err != nil {
+		item.Outcome = reconciliationError
+		item.Detail = fmt.Sprintf("unable to verify the transaction: %v", err)
+		return item
+	}
+	item.ProviderStatus = verification.ProviderStatus
+	item.ProviderAmount = payment.FormatMinorUnits(verification.Amount)
+	item.ProviderCurrency = verification.Currency
+
+	paymentStatus, detail := checkVerification(pending, verification)
+	item.Detail = detail
+	switch {
+	case detail != "":
+		// the appointment isn't confirmed for a payment that doesn't match what was charged , an admin has to look at it
+		item.Outcome = reconciliationMismatch
+		return item
+	case paymentStatus == "":
+		item.Outcome = reconciliationUnchanged
+		return item
+	}
+	appointmentStatus := string(database.AppointmentStatusPendingPayment)
+	if paymentStatus == database.PaymentStatusCompleted {
+		appointmentStatus = string(database.AppointmentStatusScheduled)
+	}
+	refund, err := r.payments.UpdateStatus(ctx, pending.Reference, verification.TransactionID, string(paymentStatus), appointmentStatus)
+	if err != nil {
+		item.Outcome = reconciliationError
+		item.Detail = err.Error()
+		return item
+	}
+	item.Outcome = reconciliationUpdated
+	if refund != nil {
+		// e.g. the hold expired before the payment was confirmed , the patient paid for an appointment they don't have
+		item.Detail = fmt.Sprintf("the payment went through but the appointment was no longer held , refund %d is %s", refund.RefundID, refund.ProviderStatus)
+	}
+	return item
+}
+
+// checkVerification returns the status a pending payment should move to given what the provider reports (empty if it stays pending) ,
+// or a description of the mismatch when a successful transaction doesn't match the stored amount or currency
+func checkVerification(pending database.Payment, verification *payment.Verification) (database.PaymentStatus, string) {
+	switch verification.Status {
+	case payment.StatusSucceeded:
+		expected, err := payment.ToMinorUnits(pending.Amount)
+		if err != nil {
+			return "", fmt.Sprintf("the stored amount %q can't be read", pending.Amount)
+		}
+		if verification.Amount != expected {
+			return "", fmt.Sprintf("paid %s but %s was expected", payment.FormatMinorUnits(verification.Amount), pending.Amount)
+		}
+		if !sameCurrency(verification.Currency, pending.Currency) {
+			return "", fmt.Sprintf("paid in %s but %s was expected", verification.Currency, pending.Currency)
+		}
+		return database.PaymentStatusCompleted, ""
+	case payment.StatusFailed:
+		return database.PaymentStatusFailed, ""
+	}
+	// abandoned checkouts are left to the hold sweeper , the patient can still complete them while the hold lasts
+	return "", ""
+}
+
+// sameCurrency compares currency codes , the payments table defaults to KSH where paystack uses the ISO code KES
+func sameCurrency(a, b string) bool {
+	normalize := func(code string) string {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code == "KSH" {
+			return "KES"
+		}
+		return code
+	}
+	return normalize(a) == normalize(b)
+}
+
+func (r *paymentReconciler) ListRuns(ctx context.Context, limit, offset int32) (model.ListReconciliationRunsResponse, error) {
+	runs, err := r.reconciliationRepo.ListRuns(ctx, limit+1, offset)
+	if err != nil {
+		return model.ListReconciliationRunsResponse{}, err
+	}
+	hasMore := false
+	if len(runs) > int(limit) {
+		hasMore = true
+		runs = runs[:limit]
+	}
+	return model.ListReconciliationRunsResponse{
+		Runs:    runs,
+		HasMore: hasMore,
+	}, nil
+}
+
+func (r *paymentReconciler) GetReport(ctx context.Context, runId int64) (*model.ReconciliationReport, error) {
+	run, err := r.reconciliationRepo.GetRun(ctx, runId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrReconciliationRunNotFound
+		}
+		return nil, err
+	}
+	items, err := r.reconciliationRepo.ListItems(ctx, runId)
+	if err != nil {
+		return nil, err
+	}
+	return &model.ReconciliationReport{
+		Run:   *run,
+		Items: items,
+	}, nil
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/payment"
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeReconciliationRepository struct {
+	repository.ReconciliationRepository
+	stale []database.Payment
+	// how many runs were started , the items recorded in them and the params they were finished with
+	runs     int64
+	items    []repository.CreateReconciliationItemParams
+	finished []repository.FinishReconciliationRunParams
+	// the mismatches flagged outside of a run
+	flagged []repository.CreateReconciliationItemParams
+}
+
+func (f *fakeReconciliationRepository) ListStalePendingPayments(ctx context.Context, createdBefore time.Time, limit int32) ([]database.Payment, error) {
+	return f.stale, nil
+}
+
+func (f *fakeReconciliationRepository) StartRun(ctx context.Context) (*database.ReconciliationRun, error) {
+	f.runs++
+	return &database.ReconciliationRun{RunID: f.runs}, nil
+}
+
+func (f *fakeReconciliationRepository) CreateItem(ctx context.Context, params repository.CreateReconciliationItemParams) (*database.ReconciliationItem, error) {
+	f.items = append(f.items, params)
+	return &database.ReconciliationItem{RunID: params.RunID, PaymentID: params.PaymentID, Outcome: params.Outcome}, nil
+}
+
+func (f *fakeReconciliationRepository) FinishRun(ctx context.Context, params repository.FinishReconciliationRunParams) (*database.ReconciliationRun, error) {
+	f.finished = append(f.finished, params)
+	return &database.ReconciliationRun{RunID: params.RunID, Checked: params.Checked, Updated: params.Updated, Mismatched: params.Mismatched, Failed: params.Failed}, nil
+}
+
+func (f *fakeReconciliationRepository) FlagMismatch(ctx context.Context, params repository.CreateReconciliationItemParams) (*database.ReconciliationItem, error) {
+	f.flagged = append(f.flagged, params)
+	return &database.ReconciliationItem{PaymentID: params.PaymentID, Outcome: params.Outcome, Detail: params.Detail}, nil
+}
+
+// fakeVerifyProvider stands in for paystack when payments are verified , it answers with the verification (or error) for each reference
+type fakeVerifyProvider struct {
+	payment.Provider
+	verifications map[string]*payment.Verification
+	errs          map[string]error
+}
+
+func (f *fakeVerifyProvider) Name() string {
+	return payment.MethodPaystack
+}
+
+func (f *fakeVerifyProvider) Verify(ctx context.Context, details payment.PaymentDetails) (*payment.Verification, error) {
+	if err, ok := f.errs[details.Reference]; ok {
+		return nil, err
+	}
+	return f.verifications[details.Reference], nil
+}
+
+func TestReconcile(t *testing.T) {
+	succeeded := func(amount int64, currency string) *payment.Verification {
+		return &payment.Verification{Status: payment.StatusSucceeded, ProviderStatus: "success", Amount: amount, Currency: currency, TransactionID: "4099260516"}
+	}
+	testCases := []struct {
+		reference    string
+		verification *payment.Verification
+		err          error
+		outcome      string
+		// the statuses the payment and its appointment are moved to , empty if nothing is updated
+		paymentStatus     string
+		appointmentStatus string
+	}{
+		{reference: "ref_81", verification: succeeded(150000, "KES"), outcome: reconciliationUpdated, paymentStatus: "completed", appointmentStatus: "scheduled"},
+		{reference: "ref_82", verification: &payment.Verification{Status: payment.StatusFailed, ProviderStatus: "failed"}, outcome: reconciliationUpdated, paymentStatus: "failed"},
+		{reference: "ref_83", verification: &payment.Verification{Status: payment.StatusPending, ProviderStatus: "ongoing"}, outcome: reconciliationUnchanged},
+		{reference: "ref_84", verification: succeeded(100000, "KES"), outcome: reconciliationMismatch},
+		{reference: "ref_85", verification: succeeded(150000, "NGN"), outcome: reconciliationMismatch},
+		{reference: "ref_86", err: errors.New("paystack is unavailable"), outcome: reconciliationError},
+	}
+
+	paymentRepo := &fakePaymentRepository{payments: map[int64]*database.Payment{}}
+	appointmentRepo := &fakeAppointmentRepository{appointments: map[int64]*database.Appointment{}}
+	reconciliationRepo := &fakeReconciliationRepository{}
+	provider := &fakeVerifyProvider{verifications: map[string]*payment.Verification{}, errs: map[string]error{}}
+	for i, tc := range testCases {
+		appointmentID := int64(80 + i)
+		pending := database.Payment{
+			PaymentID: int64(i + 1), AppointmentID: appointmentID, Reference: tc.reference, Amount: "1500.00", Currency: "KSH",
+			PaymentMethod: payment.MethodPaystack, CurrentStatus: database.PaymentStatusPending,
+		}
+		paymentRepo.payments[appointmentID] = &pending
+		appointmentRepo.appointments[appointmentID] = &database.Appointment{AppointmentID: appointmentID, CurrentStatus: database.AppointmentStatusPendingPayment}
+		reconciliationRepo.stale = append(reconciliationRepo.stale, pending)
+		provider.verifications[tc.reference] = tc.verification
+		if tc.err != nil {
+			provider.errs[tc.reference] = tc.err
+		}
+	}
+	payments := NewPaymentService(payment.NewProviders(provider), paymentRepo, appointmentRepo, reconciliationRepo, &fakeInviteSender{})
+	reconciler := NewPaymentReconciler(payments, reconciliationRepo, PaymentReconciliationConfig{StaleAfter: time.Hour, BatchSize: 50})
+
+	run, err := reconciler.Reconcile(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(1), run.RunID)
+	require.Len(t, reconciliationRepo.items, len(testCases))
+	for i, tc := range testCases {
+		t.Run(tc.reference, func(t *testing.T) {
+			item := reconciliationRepo.items[i]
+			require.Equal(t, run.RunID, item.RunID)
+			require.Equal(t, tc.reference, item.Reference)
+			require.Equal(t, tc.outcome, item.Outcome)
+			require.Equal(t, "1500.00", item.ExpectedAmount)
+			if tc.outcome == reconciliationMismatch || tc.outcome == reconciliationError {
+				require.NotEmpty(t, item.Detail)
+			}
+
+			var update *repository.UpdatePaymentAndAppointmentStatusParams
+			for j := range paymentRepo.paymentUpdates {
+				if paymentRepo.paymentUpdates[j].Reference == tc.reference {
+					update = &paymentRepo.paymentUpdates[j]
+				}
+			}
+			if tc.paymentStatus == "" {
+				require.Nil(t, update)
+				require.Equal(t, database.PaymentStatusPending, paymentRepo.payments[int64(80+i)].CurrentStatus)
+				return
+			}
+			require.NotNil(t, update)
+			require.Equal(t, tc.paymentStatus, update.PaymentStatus)
+			require.Equal(t, tc.appointmentStatus, update.AppointmentStatus)
+		})
+	}
+	// the mismatches are recorded in the run , not flagged apart from it
+	require.Empty(t, reconciliationRepo.flagged)
+	require.Equal(t, []repository.FinishReconciliationRunParams{
+		{RunID: run.RunID, Checked: 6, Updated: 2, Mismatched: 2, Failed: 1},
+	}, reconciliationRepo.finished)
+
+	t.Run("nothing to reconcile", func(t *testing.T) {
+		reconciliationRepo := &fakeReconciliationRepository{}
+		reconciler := NewPaymentReconciler(payments, reconciliationRepo, PaymentReconciliationConfig{StaleAfter: time.Hour, BatchSize: 50})
+		run, err := reconciler.Reconcile(context.Background())
+		require.NoError(t, err)
+		require.Nil(t, run)
+		require.Zero(t, reconciliationRepo.runs)
+		require.Empty(t, reconciliationRepo.finished)
+	})
+}
+
+func TestCheckVerification(t *testing.T) {
+	pending := database.Payment{Reference: "ref_70", Amount: "1500.00", Currency: "KSH", CurrentStatus: database.PaymentStatusPending}
+	verification := func(status string, amount int64, currency string) *payment.Verification {
+		return &payment.Verification{Status: status, Amount: amount, Currency: currency}
+	}
+	testCases := []struct {
+		name         string
+		verification *payment.Verification
+		status       database.PaymentStatus
+		mismatch     bool
+	}{
+		{name: "paid in full", verification: verification(payment.StatusSucceeded, 150000, "KES"), status: database.PaymentStatusCompleted},
+		{name: "paid less", verification: verification(payment.StatusSucceeded, 100, "KES"), mismatch: true},
+		{name: "paid in another currency", verification: verification(payment.StatusSucceeded, 150000, "NGN"), mismatch: true},
+		{name: "failed", verification: verification(payment.StatusFailed, 150000, "KES"), status: database.PaymentStatusFailed},
+		{name: "still pending", verification: verification(payment.StatusPending, 150000, "KES")},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, detail := checkVerification(pending, tc.verification)
+			require.Equal(t, tc.status, status)
+			require.Equal(t, tc.mismatch, detail != "")
+		})
+	}
+}
+
+func TestSameCurrency(t *testing.T) {
+	require.True(t, sameCurrency("KES", "KSH"))
+	require.True(t, sameCurrency("kes", "KES"))
+	require.False(t, sameCurrency("KES", "USD"))
+}
@@ -2,82 +2,369 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/mbeka02/lyra_backend/internal/database"
-	"github.com/mbeka02/lyra_backend/internal/model"
 	"github.com/mbeka02/lyra_backend/internal/payment"
 	"github.com/mbeka02/lyra_backend/internal/server/repository"
 )
 
+var (
+	ErrInvalidWebhookSignature = errors.New("invalid signature")
+	ErrInvalidWebhookPayload   = errors.New("invalid webhook payload")
+)
+
+// webhookClaimDuration is how long a delivery of an event has to be processed before a redelivery can take it over
+const webhookClaimDuration = 5 * time.Minute
+
 type PaymentService interface {
-	UpdateStatusWebhook(ctx context.Context, req model.PaystackWebhookPayload) error
+	// HandleWebhook verifies and processes an event sent to the webhook of the provider for the payment method , events that have already been processed are ignored
+	HandleWebhook(ctx context.Context, method string, request payment.WebhookRequest) error
 	UpdateStatusCallback(ctx context.Context, reference string) (currentStatus string, err error)
 	GetPaymentByReference(ctx context.Context, reference string) (*database.Payment, error)
+	// VerifyPayment asks the provider a payment was made with what happened to it
+	VerifyPayment(ctx context.Context, paid database.Payment) (*payment.Verification, error)
+	// UpdateStatus updates both the payment and appointment statuses , the appointment only moves if the payment is allowed to move it from its current status.
+	// A payment that goes through for an appointment it can no longer book is refunded , the refund is returned
+	UpdateStatus(ctx context.Context, reference, transactionId, paymentStatus, appointmentStatus string) (*database.Refund, error)
 }
 
 type paymentService struct {
-	paymentProcessor *payment.PaymentProcessor
-	paymentRepo      repository.PaymentRepository
+	providers       payment.Providers
+	paymentRepo     repository.PaymentRepository
+	appointmentRepo repository.AppointmentRepository
+	// payments that don't match what the provider charged are flagged in the reconciliation reports
+	reconciliationRepo repository.ReconciliationRepository
+	invites            InviteSender
 }
 
-func NewPaymentService(paymentProcessor *payment.PaymentProcessor, repo repository.PaymentRepository) PaymentService {
-	return &paymentService{paymentProcessor, repo}
+func NewPaymentService(providers payment.Providers, repo repository.PaymentRepository, appointmentRepo repository.AppointmentRepository, reconciliationRepo repository.ReconciliationRepository, invites InviteSender) PaymentService {
+	return &paymentService{providers, repo, appointmentRepo, reconciliationRepo, invites}
 }
 
 func (s *paymentService) GetPaymentByReference(ctx context.Context, reference string) (*database.Payment, error) {
 	return s.paymentRepo.GetPaymentByReference(ctx, reference)
 }
 
-// updateStatus is a helper to update both payment and appointment statuses.
-func (s *paymentService) updateStatus(ctx context.Context, reference, paymentStatus, appointmentStatus string) error {
-	if err := s.paymentRepo.UpdatePaymentAndAppointmentStatus(ctx, repository.UpdatePaymentAndAppointmentStatusParams{
-		Reference:         reference,
-		PaymentStatus:     paymentStatus,
-		AppointmentStatus: appointmentStatus,
-	}); err != nil {
+func (s *paymentService) UpdateStatus(ctx context.Context, reference, transactionId, paymentStatus, appointmentStatus string) (*database.Refund, error) {
+	params := repository.UpdatePaymentAndAppointmentStatusParams{
+		Reference:             reference,
+		PaymentStatus:         paymentStatus,
+		ProviderTransactionID: transactionId,
+	}
+	paid, err := s.paymentRepo.GetPaymentByReference(ctx, reference)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the payment for reference %s: %w", reference, err)
+	}
+	appointment, err := s.appointmentRepo.GetById(ctx, paid.AppointmentID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the appointment for reference %s: %w", reference, err)
+	}
+	if appointment.CurrentStatus != database.AppointmentStatus(appointmentStatus) {
+		if err := checkStatusTransition(appointment.CurrentStatus, database.AppointmentStatus(appointmentStatus), actorPayment); err != nil {
+			if paymentStatus == string(database.PaymentStatusCompleted) && isUnpaid(paid.CurrentStatus) {
+				// e.g. the payment went through after the hold on the appointment expired and it was cancelled
+				return s.refundUnbooked(ctx, *paid, appointment, transactionId)
+			}
+			log.Printf("payment %s is %s but appointment %d stays %s: %v", reference, paymentStatus, appointment.AppointmentID, appointment.CurrentStatus, err)
+		} else {
+			params.FromAppointmentStatus = string(appointment.CurrentStatus)
+			params.AppointmentStatus = appointmentStatus
+		}
+	}
+	if err := s.paymentRepo.UpdatePaymentAndAppointmentStatus(ctx, params); err != nil {
 		log.Printf("Error updating status for reference %s: %v", reference, err)
-		return fmt.Errorf("unable to update status for reference %s: %w", reference, err)
+		return nil, fmt.Errorf("unable to update status for reference %s: %w", reference, err)
 	}
-	return nil
+	// the appointment is booked once it is paid for
+	if params.AppointmentStatus == string(database.AppointmentStatusScheduled) {
+		s.invites.SendInvite(ctx, appointment.AppointmentID)
+	}
+	return nil, nil
+}
+
+// isUnpaid reports whether the money for a payment hasn't been recorded yet
+func isUnpaid(status database.PaymentStatus) bool {
+	return status == database.PaymentStatusPending || status == database.PaymentStatusFailed
+}
+
+// refundUnbooked records a payment that went through for an appointment it can't book along with a full refund of it ,
+// then sends the refund to the provider
+func (s *paymentService) refundUnbooked(ctx context.Context, paid database.Payment, appointment *database.Appointment, transactionId string) (*database.Refund, error) {
+	reason := fmt.Sprintf("appointment %d was %s before it was paid for", appointment.AppointmentID, appointment.CurrentStatus)
+	refund, err := s.paymentRepo.RefundUnbookedPayment(ctx, repository.RefundUnbookedPaymentParams{
+		Reference:             paid.Reference,
+		ProviderTransactionID: transactionId,
+		Reason:                reason,
+		IdempotencyKey:        fmt.Sprintf("payment_%s_unbooked", paid.Reference),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to record the refund of payment %s: %w", paid.Reference, err)
+	}
+	amount, err := payment.ToMinorUnits(paid.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("the stored amount %q can't be read:%v", paid.Amount, err)
+	}
+	if transactionId != "" {
+		paid.ProviderTransactionID = transactionId
+	}
+	log.Printf("payment %s went through but appointment %d is %s , refunding it", paid.Reference, appointment.AppointmentID, appointment.CurrentStatus)
+	return issueRefund(ctx, s.providers, s.paymentRepo, refund, paid, payment.RefundRequest{
+		Amount: amount,
+		Reason: reason,
+		Note:   fmt.Sprintf("payment %s for appointment %d refunded", paid.Reference, appointment.AppointmentID),
+	}), nil
+}
+
+// confirmPayment books the appointment of a payment the provider reports as successful if what was paid matches the payment ,
+// one that doesn't match stays pending and is flagged for the admins like the reconciler does. It reports whether the payment was flagged
+func (s *paymentService) confirmPayment(ctx context.Context, paid database.Payment, verification *payment.Verification) (bool, error) {
+	if _, detail := checkVerification(paid, verification); detail != "" {
+		log.Printf("payment %s doesn't match what was charged , flagging it: %s", paid.Reference, detail)
+		_, err := s.reconciliationRepo.FlagMismatch(ctx, repository.CreateReconciliationItemParams{
+			PaymentID:        paid.PaymentID,
+			Reference:        paid.Reference,
+			Outcome:          reconciliationMismatch,
+			ProviderStatus:   verification.ProviderStatus,
+			ExpectedAmount:   paid.Amount,
+			ProviderAmount:   payment.FormatMinorUnits(verification.Amount),
+			ExpectedCurrency: paid.Currency,
+			ProviderCurrency: verification.Currency,
+			Detail:           detail,
+		})
+		if err != nil {
+			return false, fmt.Errorf("unable to flag payment %s:%v", paid.Reference, err)
+		}
+		return true, nil
+	}
+	_, err := s.UpdateStatus(ctx, paid.Reference, verification.TransactionID, string(database.PaymentStatusCompleted), string(database.AppointmentStatusScheduled))
+	return false, err
+}
+
+func (s *paymentService) VerifyPayment(ctx context.Context, paid database.Payment) (*payment.Verification, error) {
+	provider, err := s.providers.Get(paid.PaymentMethod)
+	if err != nil {
+		return nil, err
+	}
+	details, err := paymentDetails(paid)
+	if err != nil {
+		return nil, err
+	}
+	return provider.Verify(ctx, details)
+}
+
+// the status recorded for a refund the provider didn't accept
+const refundFailed = "failed"
+
+// issueRefund sends a recorded refund to the provider and records its answer , the cancellation or payment it was recorded for stands either way.
+// A refund the provider turns down is handled like a refund.failed event , the payment is treated as paid again and an admin has to retry it
+func issueRefund(ctx context.Context, providers payment.Providers, paymentRepo repository.PaymentRepository, refund *database.Refund, paid database.Payment, request payment.RefundRequest) *database.Refund {
+	result := repository.RecordRefundResultParams{RefundID: refund.RefundID}
+	sent, err := sendRefund(ctx, providers, paid, request)
+	if err != nil {
+		log.Printf("refund %d of payment %s failed: %v", refund.RefundID, paid.Reference, err)
+		result.ProviderStatus = refundFailed
+		result.PaymentStatus = string(database.PaymentStatusCompleted)
+	} else {
+		result.ProviderRefundID = sent.ID
+		result.ProviderStatus = sent.Status
+	}
+	recorded, err := paymentRepo.RecordRefundResult(ctx, result)
+	if err != nil {
+		log.Printf("unable to record the result of refund %d of payment %s (%s %s): %v", refund.RefundID, paid.Reference, result.ProviderRefundID, result.ProviderStatus, err)
+		return refund
+	}
+	return recorded
+}
+
+func sendRefund(ctx context.Context, providers payment.Providers, paid database.Payment, request payment.RefundRequest) (*payment.RefundResult, error) {
+	provider, err := providers.Get(paid.PaymentMethod)
+	if err != nil {
+		return nil, err
+	}
+	request.Payment, err = paymentDetails(paid)
+	if err != nil {
+		return nil, err
+	}
+	result, err := provider.Refund(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("refund processing error:%v", err)
+	}
+	return result, nil
+}
+
+// paymentDetails is what the provider needs to find a stored payment
+func paymentDetails(paid database.Payment) (payment.PaymentDetails, error) {
+	amount, err := payment.ToMinorUnits(paid.Amount)
+	if err != nil {
+		return payment.PaymentDetails{}, fmt.Errorf("the stored amount %q can't be read:%v", paid.Amount, err)
+	}
+	return payment.PaymentDetails{
+		Reference:     paid.Reference,
+		TransactionID: paid.ProviderTransactionID,
+		Amount:        amount,
+		PhoneNumber:   paid.PayerPhone,
+	}, nil
 }
 
 func (s *paymentService) UpdateStatusCallback(ctx context.Context, reference string) (string, error) {
-	verification, err := s.paymentProcessor.VerifyTransaction(reference)
+	paid, err := s.paymentRepo.GetPaymentByReference(ctx, reference)
+	if err != nil {
+		return "", fmt.Errorf("unable to get the payment for reference %s: %w", reference, err)
+	}
+	verification, err := s.VerifyPayment(ctx, *paid)
 	if err != nil {
 		// If verification fails, mark payment as failed.
-		if repoErr := s.updateStatus(ctx, reference, "failed", "pending_payment"); repoErr != nil {
+		if _, repoErr := s.UpdateStatus(ctx, reference, "", "failed", "pending_payment"); repoErr != nil {
 			return "failed", repoErr
 		}
 		return "failed", err
 	}
 	var paymentStatus string
-	switch verification.Data.Status {
-	case "success":
+	switch verification.Status {
+	case payment.StatusSucceeded:
 		paymentStatus = "completed"
-		if err := s.updateStatus(ctx, reference, paymentStatus, "scheduled"); err != nil {
+		flagged, err := s.confirmPayment(ctx, *paid, verification)
+		if err != nil {
 			return paymentStatus, err
 		}
-	case "pending":
+		if flagged {
+			paymentStatus = "pending"
+		}
+	case payment.StatusPending:
 		paymentStatus = "pending"
-		if err := s.updateStatus(ctx, reference, paymentStatus, "pending_payment"); err != nil {
+		if _, err := s.UpdateStatus(ctx, reference, "", paymentStatus, "pending_payment"); err != nil {
 			return paymentStatus, err
 		}
 	default:
 		paymentStatus = "failed"
-		if err := s.updateStatus(ctx, reference, paymentStatus, "pending_payment"); err != nil {
+		if _, err := s.UpdateStatus(ctx, reference, "", paymentStatus, "pending_payment"); err != nil {
 			return paymentStatus, err
 		}
 	}
 	return paymentStatus, nil
 }
 
-func (s *paymentService) UpdateStatusWebhook(ctx context.Context, req model.PaystackWebhookPayload) error {
-	event := req.Event
-	if event != "charge.success" {
-		log.Printf("Received unsupported Paystack event: %s", req.Event)
-		return fmt.Errorf("unsupported event type: %s", req.Event)
+func (s *paymentService) HandleWebhook(ctx context.Context, method string, request payment.WebhookRequest) error {
+	provider, err := s.providers.Get(method)
+	if err != nil {
+		return err
+	}
+	event, err := provider.ParseWebhook(request)
+	if err != nil {
+		switch {
+		case errors.Is(err, payment.ErrInvalidSignature):
+			return ErrInvalidWebhookSignature
+		case errors.Is(err, payment.ErrInvalidPayload):
+			return ErrInvalidWebhookPayload
+		}
+		return err
+	}
+	claimed, err := s.paymentRepo.ClaimWebhookEvent(ctx, repository.ClaimWebhookEventParams{
+		EventID:  event.ID,
+		Provider: provider.Name(),
+		Event:    event.ProviderType,
+		Payload:  request.Body,
+		// the processing has stopped part way if it hasn't finished by then , e.g. the server was restarted
+		ClaimedBefore: time.Now().Add(-webhookClaimDuration),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to record the webhook event:%v", err)
+	}
+	if !claimed {
+		// a redelivery of an event that has already been processed or is being processed
+		return nil
+	}
+	switch event.Type {
+	case payment.EventPaymentSucceeded:
+		err = s.handlePaymentSucceeded(ctx, event)
+	case payment.EventPaymentFailed:
+		err = s.handlePaymentFailed(ctx, event)
+	case payment.EventRefundProcessed, payment.EventRefundFailed:
+		err = s.handleRefund(ctx, event)
+	case payment.EventDispute:
+		err = s.handleDispute(ctx, event)
+	default:
+		log.Printf("ignoring unsupported %s event: %s", provider.Name(), event.ProviderType)
+	}
+	if err != nil {
+		// the event stays unprocessed so that the provider's retry is acted on
+		if releaseErr := s.paymentRepo.ReleaseWebhookEvent(ctx, event.ID); releaseErr != nil {
+			log.Printf("unable to release the webhook event %s: %v", event.ID, releaseErr)
+		}
+		return err
+	}
+	if err := s.paymentRepo.MarkWebhookEventProcessed(ctx, event.ID); err != nil {
+		return fmt.Errorf("unable to mark the webhook event as processed:%v", err)
+	}
+	return nil
+}
+
+func (s *paymentService) handlePaymentSucceeded(ctx context.Context, event *payment.WebhookEvent) error {
+	paid, err := s.paymentRepo.GetPaymentByReference(ctx, event.Reference)
+	if err != nil {
+		return fmt.Errorf("unable to get the payment for reference %s: %w", event.Reference, err)
+	}
+	_, err = s.confirmPayment(ctx, *paid, &payment.Verification{
+		Status:         payment.StatusSucceeded,
+		ProviderStatus: event.ProviderType,
+		Amount:         event.Amount,
+		Currency:       event.Currency,
+		TransactionID:  event.TransactionID,
+	})
+	return err
+}
+
+func (s *paymentService) handlePaymentFailed(ctx context.Context, event *payment.WebhookEvent) error {
+	paid, err := s.paymentRepo.GetPaymentByReference(ctx, event.Reference)
+	if err != nil {
+		return fmt.Errorf("unable to get the payment for reference %s: %w", event.Reference, err)
+	}
+	// a failed attempt doesn't undo a payment that has already gone through
+	if paid.CurrentStatus != database.PaymentStatusPending {
+		log.Printf("ignoring %s for payment %s that is already %s", event.ProviderType, event.Reference, paid.CurrentStatus)
+		return nil
+	}
+	// the appointment keeps its hold , it's cancelled by the hold sweeper if it's never paid for
+	_, err = s.UpdateStatus(ctx, event.Reference, "", "failed", "pending_payment")
+	return err
+}
+
+func (s *paymentService) handleRefund(ctx context.Context, event *payment.WebhookEvent) error {
+	params := repository.UpdateRefundStatusParams{
+		Reference:        event.Reference,
+		ProviderRefundID: event.RefundID,
+		ProviderStatus:   event.RefundStatus,
+	}
+	if event.Type == payment.EventRefundFailed {
+		// the money never left , the payment is treated as paid again and the refund has to be retried by an admin
+		params.PaymentStatus = string(database.PaymentStatusCompleted)
+		log.Printf("refund %s of payment %s failed", event.RefundID, event.Reference)
 	}
-	return s.updateStatus(ctx, req.Data.Reference, "completed", "scheduled")
+	if _, err := s.paymentRepo.UpdateRefundStatus(ctx, params); err != nil {
+		return fmt.Errorf("unable to update refund %s of payment %s: %w", event.RefundID, event.Reference, err)
+	}
+	return nil
+}
+
+func (s *paymentService) handleDispute(ctx context.Context, event *payment.WebhookEvent) error {
+	dispute := event.Dispute
+	if dispute == nil {
+		return ErrInvalidWebhookPayload
+	}
+	_, err := s.paymentRepo.RecordDispute(ctx, repository.RecordDisputeParams{
+		Reference:         event.Reference,
+		ProviderDisputeID: dispute.ID,
+		Status:            dispute.Status,
+		Resolution:        dispute.Resolution,
+		RefundAmount:      payment.FormatMinorUnits(dispute.RefundAmount),
+		Currency:          dispute.Currency,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to record dispute %s: %w", dispute.ID, err)
+	}
+	return nil
 }
@@ -0,0 +1,302 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/payment"
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+	"github.com/stretchr/testify/require"
+)
+
+func (f *fakePaymentRepository) GetPaymentByReference(ctx context.Context, reference string) (*database.Payment, error) {
+	for _, payment := range f.payments {
+		if payment.Reference == reference {
+			return payment, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (f *fakePaymentRepository) UpdatePaymentAndAppointmentStatus(ctx context.Context, params repository.UpdatePaymentAndAppointmentStatusParams) error {
+	payment, err := f.GetPaymentByReference(ctx, params.Reference)
+	if err != nil {
+		return err
+	}
+	payment.CurrentStatus = database.PaymentStatus(params.PaymentStatus)
+	f.paymentUpdates = append(f.paymentUpdates, params)
+	return nil
+}
+
+func (f *fakePaymentRepository) ClaimWebhookEvent(ctx context.Context, params repository.ClaimWebhookEventParams) (bool, error) {
+	if f.events == nil {
+		f.events = map[string]bool{}
+	}
+	// the event has been processed (true) or is being processed (false)
+	if _, ok := f.events[params.EventID]; ok {
+		return false, nil
+	}
+	f.events[params.EventID] = false
+	return true, nil
+}
+
+func (f *fakePaymentRepository) ReleaseWebhookEvent(ctx context.Context, eventId string) error {
+	delete(f.events, eventId)
+	return nil
+}
+
+func (f *fakePaymentRepository) MarkWebhookEventProcessed(ctx context.Context, eventId string) error {
+	f.events[eventId] = true
+	return nil
+}
+
+func (f *fakePaymentRepository) UpdateRefundStatus(ctx context.Context, params repository.UpdateRefundStatusParams) (*database.Refund, error) {
+	if params.Reference == "" {
+		// found by the refund id alone
+		f.refundUpdates = append(f.refundUpdates, params)
+		return &database.Refund{ProviderRefundID: params.ProviderRefundID, ProviderStatus: params.ProviderStatus}, nil
+	}
+	payment, err := f.GetPaymentByReference(ctx, params.Reference)
+	if err != nil {
+		return nil, err
+	}
+	if params.PaymentStatus != "" {
+		payment.CurrentStatus = database.PaymentStatus(params.PaymentStatus)
+	}
+	f.refundUpdates = append(f.refundUpdates, params)
+	return &database.Refund{PaymentID: payment.PaymentID, ProviderStatus: params.ProviderStatus}, nil
+}
+
+func (f *fakePaymentRepository) RecordDispute(ctx context.Context, params repository.RecordDisputeParams) (*database.PaymentDispute, error) {
+	if _, err := f.GetPaymentByReference(ctx, params.Reference); err != nil {
+		return nil, err
+	}
+	f.disputes = append(f.disputes, params)
+	return &database.PaymentDispute{ProviderDisputeID: params.ProviderDisputeID, Status: params.Status}, nil
+}
+
+func (f *fakePaymentRepository) RefundUnbookedPayment(ctx context.Context, params repository.RefundUnbookedPaymentParams) (*database.Refund, error) {
+	payment, err := f.GetPaymentByReference(ctx, params.Reference)
+	if err != nil {
+		return nil, err
+	}
+	payment.CurrentStatus = database.PaymentStatusRefunded
+	f.unbookedRefunds = append(f.unbookedRefunds, params)
+	return &database.Refund{RefundID: 9, PaymentID: payment.PaymentID, Amount: payment.Amount, ProviderStatus: repository.RefundStatusPending}, nil
+}
+
+func signWebhook(body string) string {
+	mac := hmac.New(sha512.New, []byte("sk_test"))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestHandleWebhook(t *testing.T) {
+	const appointmentID = 60
+	newService := func(paymentStatus database.PaymentStatus, appointmentStatus database.AppointmentStatus) (PaymentService, *fakePaymentRepository, *fakeAppointmentRepository) {
+		paymentRepo := &fakePaymentRepository{payments: map[int64]*database.Payment{
+			appointmentID: {PaymentID: 6, AppointmentID: appointmentID, Reference: "ref_60", CurrentStatus: paymentStatus, Amount: "1500.00", Currency: "KES"},
+		}}
+		appointmentRepo := &fakeAppointmentRepository{appointments: map[int64]*database.Appointment{
+			appointmentID: {AppointmentID: appointmentID, CurrentStatus: appointmentStatus},
+		}}
+		providers := payment.NewProviders(payment.NewPaystack("sk_test"), payment.NewMpesa(payment.MpesaConfig{CallbackToken: "cb_token"}))
+		return NewPaymentService(providers, paymentRepo, appointmentRepo, &fakeReconciliationRepository{}, &fakeInviteSender{}), paymentRepo, appointmentRepo
+	}
+	paystackWebhook := func(body, signature string) payment.WebhookRequest {
+		return payment.WebhookRequest{
+			Body:   []byte(body),
+			Header: http.Header{"X-Paystack-Signature": []string{signature}},
+		}
+	}
+	deliver := func(service PaymentService, body string) error {
+		return service.HandleWebhook(context.Background(), payment.MethodPaystack, paystackWebhook(body, signWebhook(body)))
+	}
+	deliverMpesa := func(service PaymentService, body, token string) error {
+		return service.HandleWebhook(context.Background(), payment.MethodMpesa, payment.WebhookRequest{
+			Body:  []byte(body),
+			Query: url.Values{"token": []string{token}},
+		})
+	}
+
+	t.Run("invalid signature", func(t *testing.T) {
+		service, paymentRepo, _ := newService(database.PaymentStatusPending, database.AppointmentStatusPendingPayment)
+		body := `{"event":"charge.success","data":{"id":1,"reference":"ref_60"}}`
+		err := service.HandleWebhook(context.Background(), payment.MethodPaystack, paystackWebhook(body, signWebhook(`{"event":"charge.success"}`)))
+		require.ErrorIs(t, err, ErrInvalidWebhookSignature)
+		require.Empty(t, paymentRepo.events)
+	})
+
+	t.Run("malformed payload", func(t *testing.T) {
+		service, _, _ := newService(database.PaymentStatusPending, database.AppointmentStatusPendingPayment)
+		require.ErrorIs(t, deliver(service, `{"event":`), ErrInvalidWebhookPayload)
+		require.ErrorIs(t, deliver(service, `{"event":"charge.success","data":{"id":2}}`), ErrInvalidWebhookPayload)
+	})
+
+	t.Run("charge success is only processed once", func(t *testing.T) {
+		service, paymentRepo, _ := newService(database.PaymentStatusPending, database.AppointmentStatusPendingPayment)
+		body := `{"event":"charge.success","data":{"id":1,"reference":"ref_60","status":"success","amount":150000,"currency":"KES"}}`
+		require.NoError(t, deliver(service, body))
+		require.NoError(t, deliver(service, body))
+		require.Len(t, paymentRepo.paymentUpdates, 1)
+		require.Equal(t, database.PaymentStatusCompleted, paymentRepo.payments[appointmentID].CurrentStatus)
+		require.Equal(t, "scheduled", paymentRepo.paymentUpdates[0].AppointmentStatus)
+		require.True(t, paymentRepo.events["paystack:charge.success:1"])
+	})
+
+	t.Run("charge success that doesn't match the payment", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			amount   int64
+			currency string
+		}{
+			{name: "paid less", amount: 100000, currency: "KES"},
+			{name: "paid in another currency", amount: 150000, currency: "NGN"},
+		}
+		for i, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				_, paymentRepo, appointmentRepo := newService(database.PaymentStatusPending, database.AppointmentStatusPendingPayment)
+				reconciliationRepo := &fakeReconciliationRepository{}
+				providers := payment.NewProviders(payment.NewPaystack("sk_test"))
+				service := NewPaymentService(providers, paymentRepo, appointmentRepo, reconciliationRepo, &fakeInviteSender{})
+				body := fmt.Sprintf(`{"event":"charge.success","data":{"id":%d,"reference":"ref_60","status":"success","amount":%d,"currency":%q}}`, 10+i, tc.amount, tc.currency)
+				require.NoError(t, deliver(service, body))
+				// the appointment isn't booked , the payment waits for an admin
+				require.Empty(t, paymentRepo.paymentUpdates)
+				require.Equal(t, database.PaymentStatusPending, paymentRepo.payments[appointmentID].CurrentStatus)
+				require.Equal(t, database.AppointmentStatusPendingPayment, appointmentRepo.appointments[appointmentID].CurrentStatus)
+				require.Len(t, reconciliationRepo.flagged, 1)
+				require.Equal(t, reconciliationMismatch, reconciliationRepo.flagged[0].Outcome)
+				require.Equal(t, int64(6), reconciliationRepo.flagged[0].PaymentID)
+				require.Equal(t, payment.FormatMinorUnits(tc.amount), reconciliationRepo.flagged[0].ProviderAmount)
+				require.Equal(t, tc.currency, reconciliationRepo.flagged[0].ProviderCurrency)
+				require.NotEmpty(t, reconciliationRepo.flagged[0].Detail)
+				require.True(t, paymentRepo.events[fmt.Sprintf("paystack:charge.success:%d", 10+i)])
+			})
+		}
+	})
+
+	t.Run("paid after the hold expired", func(t *testing.T) {
+		_, paymentRepo, appointmentRepo := newService(database.PaymentStatusFailed, database.AppointmentStatusCancelled)
+		paymentRepo.payments[appointmentID].PaymentMethod = payment.MethodPaystack
+		provider := &fakeRefundProvider{Provider: payment.NewPaystack("sk_test"), appointmentRepo: appointmentRepo}
+		service := NewPaymentService(payment.NewProviders(provider), paymentRepo, appointmentRepo, &fakeReconciliationRepository{}, &fakeInviteSender{})
+		require.NoError(t, deliver(service, `{"event":"charge.success","data":{"id":5,"reference":"ref_60","status":"success","amount":150000,"currency":"KES"}}`))
+		// the money is recorded with a refund of all of it and the appointment stays cancelled
+		require.Empty(t, paymentRepo.paymentUpdates)
+		require.Len(t, paymentRepo.unbookedRefunds, 1)
+		require.Equal(t, "5", paymentRepo.unbookedRefunds[0].ProviderTransactionID)
+		require.Equal(t, database.PaymentStatusRefunded, paymentRepo.payments[appointmentID].CurrentStatus)
+		require.Equal(t, database.AppointmentStatusCancelled, appointmentRepo.appointments[appointmentID].CurrentStatus)
+		require.Len(t, provider.refunds, 1)
+		require.Equal(t, int64(150000), provider.refunds[0].Amount)
+		require.Equal(t, []repository.RecordRefundResultParams{{RefundID: 9, ProviderRefundID: "3018284", ProviderStatus: "pending"}}, paymentRepo.refundResults)
+		require.True(t, paymentRepo.events["paystack:charge.success:5"])
+	})
+
+	t.Run("charge failed", func(t *testing.T) {
+		service, paymentRepo, _ := newService(database.PaymentStatusPending, database.AppointmentStatusPendingPayment)
+		require.NoError(t, deliver(service, `{"event":"charge.failed","data":{"id":3,"reference":"ref_60","status":"failed"}}`))
+		require.Equal(t, database.PaymentStatusFailed, paymentRepo.payments[appointmentID].CurrentStatus)
+	})
+
+	t.Run("charge failed after the payment went through", func(t *testing.T) {
+		service, paymentRepo, _ := newService(database.PaymentStatusCompleted, database.AppointmentStatusScheduled)
+		require.NoError(t, deliver(service, `{"event":"charge.failed","data":{"id":4,"reference":"ref_60","status":"failed"}}`))
+		require.Equal(t, database.PaymentStatusCompleted, paymentRepo.payments[appointmentID].CurrentStatus)
+		require.Empty(t, paymentRepo.paymentUpdates)
+	})
+
+	t.Run("refund processed", func(t *testing.T) {
+		service, paymentRepo, _ := newService(database.PaymentStatusRefunded, database.AppointmentStatusCancelled)
+		require.NoError(t, deliver(service, `{"event":"refund.processed","data":{"id":"3018284","status":"processed","transaction_reference":"ref_60","amount":"150000","currency":"KES"}}`))
+		require.Len(t, paymentRepo.refundUpdates, 1)
+		require.Equal(t, "3018284", paymentRepo.refundUpdates[0].ProviderRefundID)
+		require.Equal(t, "processed", paymentRepo.refundUpdates[0].ProviderStatus)
+		require.Equal(t, database.PaymentStatusRefunded, paymentRepo.payments[appointmentID].CurrentStatus)
+	})
+
+	t.Run("refund failed", func(t *testing.T) {
+		service, paymentRepo, _ := newService(database.PaymentStatusPartiallyRefunded, database.AppointmentStatusCancelled)
+		require.NoError(t, deliver(service, `{"event":"refund.failed","data":{"id":3018285,"status":"failed","transaction_reference":"ref_60"}}`))
+		require.Equal(t, database.PaymentStatusCompleted, paymentRepo.payments[appointmentID].CurrentStatus)
+	})
+
+	t.Run("dispute", func(t *testing.T) {
+		service, paymentRepo, _ := newService(database.PaymentStatusCompleted, database.AppointmentStatusCompleted)
+		require.NoError(t, deliver(service, `{"event":"charge.dispute.create","data":{"id":358,"status":"awaiting-merchant-feedback","resolution":null,"refund_amount":150000,"currency":"KES","transaction":{"id":1,"reference":"ref_60"}}}`))
+		require.NoError(t, deliver(service, `{"event":"charge.dispute.resolve","data":{"id":358,"status":"resolved","resolution":"merchant-accepted","refund_amount":150000,"currency":"KES","transaction":{"id":1,"reference":"ref_60"}}}`))
+		require.Len(t, paymentRepo.disputes, 2)
+		require.Equal(t, "358", paymentRepo.disputes[1].ProviderDisputeID)
+		require.Equal(t, "merchant-accepted", paymentRepo.disputes[1].Resolution)
+		require.Equal(t, "1500.00", paymentRepo.disputes[1].RefundAmount)
+	})
+
+	t.Run("unknown events are acknowledged", func(t *testing.T) {
+		service, paymentRepo, _ := newService(database.PaymentStatusPending, database.AppointmentStatusPendingPayment)
+		require.NoError(t, deliver(service, `{"event":"transfer.success","data":{"id":9}}`))
+		require.NoError(t, deliver(service, `{"event":"subscription.create","data":{}}`))
+		require.Empty(t, paymentRepo.paymentUpdates)
+		require.Len(t, paymentRepo.events, 2)
+	})
+
+	t.Run("failed events are retried", func(t *testing.T) {
+		service, paymentRepo, _ := newService(database.PaymentStatusPending, database.AppointmentStatusPendingPayment)
+		body := `{"event":"charge.success","data":{"id":5,"reference":"ref_unknown"}}`
+		err := deliver(service, body)
+		require.Error(t, err)
+		require.True(t, errors.Is(err, sql.ErrNoRows))
+		require.False(t, paymentRepo.events["paystack:charge.success:5"])
+		// still not processed , so the redelivery is acted on again
+		require.Error(t, deliver(service, body))
+	})
+
+	t.Run("redeliveries are ignored while the event is being processed", func(t *testing.T) {
+		service, paymentRepo, _ := newService(database.PaymentStatusPending, database.AppointmentStatusPendingPayment)
+		paymentRepo.events = map[string]bool{"paystack:charge.success:6": false}
+		require.NoError(t, deliver(service, `{"event":"charge.success","data":{"id":6,"reference":"ref_60","status":"success"}}`))
+		require.Empty(t, paymentRepo.paymentUpdates)
+	})
+
+	t.Run("mpesa callback with the wrong token", func(t *testing.T) {
+		service, paymentRepo, _ := newService(database.PaymentStatusPending, database.AppointmentStatusPendingPayment)
+		err := deliverMpesa(service, `{"Body":{"stkCallback":{"CheckoutRequestID":"ref_60","ResultCode":0}}}`, "guessed")
+		require.ErrorIs(t, err, ErrInvalidWebhookSignature)
+		require.Empty(t, paymentRepo.events)
+	})
+
+	t.Run("mpesa payment is only processed once", func(t *testing.T) {
+		service, paymentRepo, _ := newService(database.PaymentStatusPending, database.AppointmentStatusPendingPayment)
+		body := `{"Body":{"stkCallback":{"MerchantRequestID":"29115","CheckoutRequestID":"ref_60","ResultCode":0,"ResultDesc":"The service request is processed successfully.","CallbackMetadata":{"Item":[{"Name":"Amount","Value":1500},{"Name":"MpesaReceiptNumber","Value":"NLJ7RT61SV"},{"Name":"PhoneNumber","Value":254708374149}]}}}}`
+		require.NoError(t, deliverMpesa(service, body, "cb_token"))
+		require.NoError(t, deliverMpesa(service, body, "cb_token"))
+		require.Len(t, paymentRepo.paymentUpdates, 1)
+		require.Equal(t, "NLJ7RT61SV", paymentRepo.paymentUpdates[0].ProviderTransactionID)
+		require.Equal(t, database.PaymentStatusCompleted, paymentRepo.payments[appointmentID].CurrentStatus)
+		require.True(t, paymentRepo.events["mpesa:stk:ref_60"])
+	})
+
+	t.Run("mpesa payment cancelled by the patient", func(t *testing.T) {
+		service, paymentRepo, _ := newService(database.PaymentStatusPending, database.AppointmentStatusPendingPayment)
+		require.NoError(t, deliverMpesa(service, `{"Body":{"stkCallback":{"CheckoutRequestID":"ref_60","ResultCode":1032,"ResultDesc":"Request cancelled by user"}}}`, "cb_token"))
+		require.Equal(t, database.PaymentStatusFailed, paymentRepo.payments[appointmentID].CurrentStatus)
+	})
+
+	t.Run("mpesa refund result", func(t *testing.T) {
+		service, paymentRepo, _ := newService(database.PaymentStatusRefunded, database.AppointmentStatusCancelled)
+		require.NoError(t, deliverMpesa(service, `{"Result":{"ResultType":0,"ResultCode":0,"ResultDesc":"The service request is processed successfully.","ConversationID":"AG_20191219_00004e48cf7e3533f581","TransactionID":"NLJ41HAY6Q"}}`, "cb_token"))
+		require.Len(t, paymentRepo.refundUpdates, 1)
+		require.Empty(t, paymentRepo.refundUpdates[0].Reference)
+		require.Equal(t, "AG_20191219_00004e48cf7e3533f581", paymentRepo.refundUpdates[0].ProviderRefundID)
+		require.Equal(t, "processed", paymentRepo.refundUpdates[0].ProviderStatus)
+	})
+}
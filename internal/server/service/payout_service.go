@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/payment"
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+)
+
+var (
+	ErrPayoutAccountNotFound = errors.New("no payout account has been registered")
+	ErrPayoutAccountRejected = errors.New("the payout account was rejected")
+)
+
+type RegisterPayoutAccountParams struct {
+	UserID int64
+	// the doctor's email , the payment provider contacts them about settlements
+	Email   string
+	Request model.RegisterPayoutAccountRequest
+}
+type GetEarningsParams struct {
+	UserID int64
+	From   time.Time
+	To     time.Time
+	Limit  int32
+	Offset int32
+}
+
+type PayoutService interface {
+	// RegisterAccount creates the doctor's subaccount with the payment provider (or moves it to a new bank account) ,
+	// the payments made after it's registered are split between the doctor and the platform
+	RegisterAccount(ctx context.Context, params RegisterPayoutAccountParams) (*database.DoctorPayoutAccount, error)
+	GetAccount(ctx context.Context, userId int64) (*database.DoctorPayoutAccount, error)
+	// GetEarnings returns the doctor's ledger entries over a period , latest first , with their totals
+	GetEarnings(ctx context.Context, params GetEarningsParams) (*model.DoctorEarningsResponse, error)
+	// GetPayoutReport totals every doctor's earnings over a period
+	GetPayoutReport(ctx context.Context, from, to time.Time, limit, offset int32) (*model.PayoutReport, error)
+}
+
+type payoutService struct {
+	payoutRepo  repository.PayoutRepository
+	doctorRepo  repository.DoctorRepository
+	subaccounts payment.Subaccounts
+	pricing     PricingPolicy
+}
+
+func NewPayoutService(payoutRepo repository.PayoutRepository, doctorRepo repository.DoctorRepository, subaccounts payment.Subaccounts, pricing PricingPolicy) PayoutService {
+	return &payoutService{
+		payoutRepo,
+		doctorRepo,
+		subaccounts,
+		pricing,
+	}
+}
+
+func (s *payoutService) RegisterAccount(ctx context.Context, params RegisterPayoutAccountParams) (*database.DoctorPayoutAccount, error) {
+	doctorId, err := s.doctorRepo.GetDoctorIdByUserId(ctx, params.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the doctor details of this account:%v", err)
+	}
+	request := payment.SubaccountRequest{
+		BusinessName:     params.Request.BusinessName,
+		BankCode:         params.Request.BankCode,
+		AccountNumber:    params.Request.AccountNumber,
+		PercentageCharge: s.platformPercentage(),
+		Email:            params.Email,
+		Name:             params.Request.BusinessName,
+	}
+	var subaccount *payment.Subaccount
+	existing, err := s.payoutRepo.GetAccount(ctx, doctorId)
+	switch {
+	case err == nil:
+		subaccount, err = s.subaccounts.UpdateSubaccount(ctx, existing.SubaccountCode, request)
+	case errors.Is(err, sql.ErrNoRows):
+		subaccount, err = s.subaccounts.CreateSubaccount(ctx, request)
+	default:
+		return nil, fmt.Errorf("unable to get the payout account:%v", err)
+	}
+	if err != nil {
+		var paystackErr *payment.PaystackError
+		if errors.As(err, &paystackErr) {
+			return nil, fmt.Errorf("%w:%s", ErrPayoutAccountRejected, paystackErr.Message)
+		}
+		return nil, fmt.Errorf("unable to register the payout account:%v", err)
+	}
+	account, err := s.payoutRepo.UpsertAccount(ctx, repository.UpsertPayoutAccountParams{
+		DoctorID:           doctorId,
+		SubaccountCode:     subaccount.Code,
+		BusinessName:       subaccount.BusinessName,
+		BankCode:           params.Request.BankCode,
+		SettlementBank:     subaccount.SettlementBank,
+		AccountNumberLast4: lastDigits(params.Request.AccountNumber, 4),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to save the payout account:%v", err)
+	}
+	return account, nil
+}
+
+// platformPercentage is the share of a payment the platform keeps , the fee and tax are charged on top of the doctor's price
+// so they make up less of the total than their own percentages , payments set their exact share so this is only a fallback
+func (s *payoutService) platformPercentage() float64 {
+	extra := float64(s.pricing.PlatformFeePercent + s.pricing.TaxPercent)
+	return math.Round(extra*100/(100+extra)*100) / 100
+}
+
+func lastDigits(value string, n int) string {
+	if len(value) <= n {
+		return value
+	}
+	return value[len(value)-n:]
+}
+
+func (s *payoutService) GetAccount(ctx context.Context, userId int64) (*database.DoctorPayoutAccount, error) {
+	doctorId, err := s.doctorRepo.GetDoctorIdByUserId(ctx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the doctor details of this account:%v", err)
+	}
+	account, err := s.payoutRepo.GetAccount(ctx, doctorId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPayoutAccountNotFound
+		}
+		return nil, err
+	}
+	return account, nil
+}
+
+func (s *payoutService) GetEarnings(ctx context.Context, params GetEarningsParams) (*model.DoctorEarningsResponse, error) {
+	doctorId, err := s.doctorRepo.GetDoctorIdByUserId(ctx, params.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the doctor details of this account:%v", err)
+	}
+	summary, err := s.payoutRepo.GetEarningsSummary(ctx, doctorId, params.From, params.To)
+	if err != nil {
+		return nil, fmt.Errorf("unable to total the earnings:%v", err)
+	}
+	entries, err := s.payoutRepo.ListEarnings(ctx, repository.ListEarningsParams{
+		DoctorID: doctorId,
+		From:     params.From,
+		To:       params.To,
+		Limit:    params.Limit + 1,
+		Offset:   params.Offset,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the earnings:%v", err)
+	}
+	hasMore := false
+	if len(entries) > int(params.Limit) {
+		hasMore = true
+		entries = entries[:params.Limit]
+	}
+	return &model.DoctorEarningsResponse{
+		Summary: *summary,
+		Entries: entries,
+		HasMore: hasMore,
+	}, nil
+}
+
+func (s *payoutService) GetPayoutReport(ctx context.Context, from, to time.Time, limit, offset int32) (*model.PayoutReport, error) {
+	doctors, err := s.payoutRepo.ListPayouts(ctx, repository.ListPayoutsParams{
+		From:   from,
+		To:     to,
+		Limit:  limit + 1,
+		Offset: offset,
+	})
+	if err != nil {
+		return nil, err
+	}
+	hasMore := false
+	if len(doctors) > int(limit) {
+		hasMore = true
+		doctors = doctors[:limit]
+	}
+	return &model.PayoutReport{
+		From:    from,
+		To:      to,
+		Doctors: doctors,
+		HasMore: hasMore,
+	}, nil
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/payment"
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePayoutRepository struct {
+	repository.PayoutRepository
+	accounts map[int64]*database.DoctorPayoutAccount
+}
+
+func (f *fakePayoutRepository) GetAccount(ctx context.Context, doctorId int64) (*database.DoctorPayoutAccount, error) {
+	account, ok := f.accounts[doctorId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return account, nil
+}
+
+func (f *fakePayoutRepository) UpsertAccount(ctx context.Context, params repository.UpsertPayoutAccountParams) (*database.DoctorPayoutAccount, error) {
+	if f.accounts == nil {
+		f.accounts = map[int64]*database.DoctorPayoutAccount{}
+	}
+	account := &database.DoctorPayoutAccount{
+		DoctorID:           params.DoctorID,
+		SubaccountCode:     params.SubaccountCode,
+		BusinessName:       params.BusinessName,
+		BankCode:           params.BankCode,
+		SettlementBank:     params.SettlementBank,
+		AccountNumberLast4: params.AccountNumberLast4,
+	}
+	f.accounts[params.DoctorID] = account
+	return account, nil
+}
+
+type fakeSubaccounts struct {
+	created  []payment.SubaccountRequest
+	updated  map[string]payment.SubaccountRequest
+	rejected bool
+}
+
+func (f *fakeSubaccounts) CreateSubaccount(ctx context.Context, request payment.SubaccountRequest) (*payment.Subaccount, error) {
+	if f.rejected {
+		return nil, &payment.PaystackError{Message: "Account details are invalid"}
+	}
+	f.created = append(f.created, request)
+	return &payment.Subaccount{Code: "ACCT_new", BusinessName: request.BusinessName, SettlementBank: "Equity Bank"}, nil
+}
+
+func (f *fakeSubaccounts) UpdateSubaccount(ctx context.Context, code string, request payment.SubaccountRequest) (*payment.Subaccount, error) {
+	if f.updated == nil {
+		f.updated = map[string]payment.SubaccountRequest{}
+	}
+	f.updated[code] = request
+	return &payment.Subaccount{Code: code, BusinessName: request.BusinessName, SettlementBank: "KCB Bank"}, nil
+}
+
+func TestRegisterPayoutAccount(t *testing.T) {
+	doctorRepo := &fakeDoctorRepository{doctors: map[int64]*database.Doctor{
+		doctorID: {DoctorID: doctorID, UserID: specialistUserID},
+	}}
+	params := RegisterPayoutAccountParams{
+		UserID: specialistUserID,
+		Email:  "doctor@example.com",
+		Request: model.RegisterPayoutAccountRequest{
+			BusinessName:  "Dr. Wanjiru",
+			BankCode:      "68",
+			AccountNumber: "0123456789",
+		},
+	}
+
+	t.Run("creates a subaccount", func(t *testing.T) {
+		payoutRepo, subaccounts := &fakePayoutRepository{}, &fakeSubaccounts{}
+		service := NewPayoutService(payoutRepo, doctorRepo, subaccounts, PricingPolicy{PlatformFeePercent: 10, TaxPercent: 10})
+		account, err := service.RegisterAccount(context.Background(), params)
+		require.NoError(t, err)
+		require.Equal(t, "ACCT_new", account.SubaccountCode)
+		require.Equal(t, "6789", account.AccountNumberLast4)
+		require.Equal(t, "Equity Bank", account.SettlementBank)
+		require.Len(t, subaccounts.created, 1)
+		// the fee and tax are a sixth of a total that has them added on top
+		require.Equal(t, 16.67, subaccounts.created[0].PercentageCharge)
+	})
+
+	t.Run("a new bank account keeps the subaccount", func(t *testing.T) {
+		payoutRepo := &fakePayoutRepository{accounts: map[int64]*database.DoctorPayoutAccount{
+			doctorID: {DoctorID: doctorID, SubaccountCode: "ACCT_existing"},
+		}}
+		subaccounts := &fakeSubaccounts{}
+		service := NewPayoutService(payoutRepo, doctorRepo, subaccounts, PricingPolicy{})
+		account, err := service.RegisterAccount(context.Background(), params)
+		require.NoError(t, err)
+		require.Equal(t, "ACCT_existing", account.SubaccountCode)
+		require.Equal(t, "KCB Bank", account.SettlementBank)
+		require.Empty(t, subaccounts.created)
+		require.Contains(t, subaccounts.updated, "ACCT_existing")
+	})
+
+	t.Run("rejected bank details", func(t *testing.T) {
+		payoutRepo := &fakePayoutRepository{}
+		service := NewPayoutService(payoutRepo, doctorRepo, &fakeSubaccounts{rejected: true}, PricingPolicy{})
+		_, err := service.RegisterAccount(context.Background(), params)
+		require.ErrorIs(t, err, ErrPayoutAccountRejected)
+		require.Empty(t, payoutRepo.accounts)
+	})
+
+	t.Run("no account registered", func(t *testing.T) {
+		service := NewPayoutService(&fakePayoutRepository{}, doctorRepo, &fakeSubaccounts{}, PricingPolicy{})
+		_, err := service.GetAccount(context.Background(), specialistUserID)
+		require.True(t, errors.Is(err, ErrPayoutAccountNotFound))
+	})
+}
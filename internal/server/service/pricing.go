@@ -0,0 +1,50 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/payment"
+)
+
+var ErrInvalidAppointmentDuration = errors.New("the appointment must end after it starts")
+
+// PricingPolicy decides what a patient is charged for an appointment , all the amounts it works with are in cents
+type PricingPolicy struct {
+	// the percentage of the consultation fee added on top as the platform's fee
+	PlatformFeePercent int64
+	// the percentage charged as tax on the consultation and platform fees
+	TaxPercent int64
+}
+
+// PriceBreakdown is how the amount charged for an appointment is made up , in cents
+type PriceBreakdown struct {
+	ConsultationFee int64
+	PlatformFee     int64
+	Tax             int64
+	Total           int64
+}
+
+// Quote prorates the doctor's hourly price (as stored in the database) to the length of the appointment and adds the fees and taxes on top
+func (p PricingPolicy) Quote(pricePerHour string, startTime, endTime time.Time) (PriceBreakdown, error) {
+	duration := endTime.Sub(startTime)
+	if duration <= 0 {
+		return PriceBreakdown{}, ErrInvalidAppointmentDuration
+	}
+	hourly, err := payment.ToMinorUnits(pricePerHour)
+	if err != nil {
+		return PriceBreakdown{}, fmt.Errorf("unable to read the doctor's price:%v", err)
+	}
+	var breakdown PriceBreakdown
+	breakdown.ConsultationFee = prorate(hourly, int64(duration/time.Second), int64(time.Hour/time.Second))
+	breakdown.PlatformFee = prorate(breakdown.ConsultationFee, p.PlatformFeePercent, 100)
+	breakdown.Tax = prorate(breakdown.ConsultationFee+breakdown.PlatformFee, p.TaxPercent, 100)
+	breakdown.Total = breakdown.ConsultationFee + breakdown.PlatformFee + breakdown.Tax
+	return breakdown, nil
+}
+
+// prorate returns amount * numerator / denominator rounded half up to the nearest cent
+func prorate(amount, numerator, denominator int64) int64 {
+	return (amount*numerator + denominator/2) / denominator
+}
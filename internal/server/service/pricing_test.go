@@ -0,0 +1,63 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuote(t *testing.T) {
+	start := time.Date(2025, time.March, 3, 9, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name         string
+		policy       PricingPolicy
+		pricePerHour string
+		duration     time.Duration
+		expected     PriceBreakdown
+	}{
+		{
+			name:         "full hour without fees",
+			pricePerHour: "2500.00",
+			duration:     time.Hour,
+			expected:     PriceBreakdown{ConsultationFee: 250000, Total: 250000},
+		},
+		{
+			name:         "prorated to the slot",
+			pricePerHour: "2500.00",
+			duration:     30 * time.Minute,
+			expected:     PriceBreakdown{ConsultationFee: 125000, Total: 125000},
+		},
+		{
+			name:         "rounded to the nearest cent",
+			pricePerHour: "1000.00",
+			duration:     20 * time.Minute,
+			expected:     PriceBreakdown{ConsultationFee: 33333, Total: 33333},
+		},
+		{
+			name:         "fees and tax",
+			policy:       PricingPolicy{PlatformFeePercent: 10, TaxPercent: 16},
+			pricePerHour: "3000.50",
+			duration:     45 * time.Minute,
+			// 225037.5 rounds up , the tax is charged on the consultation and platform fees
+			expected: PriceBreakdown{ConsultationFee: 225038, PlatformFee: 22504, Tax: 39607, Total: 287149},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			breakdown, err := tc.policy.Quote(tc.pricePerHour, start, start.Add(tc.duration))
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, breakdown)
+		})
+	}
+
+	t.Run("end before start", func(t *testing.T) {
+		_, err := PricingPolicy{}.Quote("2500.00", start, start.Add(-time.Hour))
+		require.ErrorIs(t, err, ErrInvalidAppointmentDuration)
+	})
+
+	t.Run("invalid price", func(t *testing.T) {
+		_, err := PricingPolicy{}.Quote("abc", start, start.Add(time.Hour))
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mbeka02/lyra_backend/internal/auth"
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+)
+
+var (
+	ErrSessionRevoked     = errors.New("this session has been revoked")
+	ErrSessionExpired     = errors.New("this session has expired")
+	ErrRefreshTokenReused = errors.New("this refresh token has already been used, the session has been revoked")
+	ErrInvalidTokenType   = errors.New("this token can't be used for this operation")
+	ErrPasswordChanged    = errors.New("the password was changed after this token was issued , please login again")
+)
+
+type SessionService interface {
+	// CreateSession starts a new session for the user and issues the first access/refresh token pair
+	CreateSession(ctx context.Context, user *database.User, client model.ClientInfo) (model.TokenResponse, error)
+	// RefreshSession exchanges a refresh token for a new token pair, the old refresh token can't be used again
+	RefreshSession(ctx context.Context, refreshToken string) (model.TokenResponse, error)
+	RevokeSession(ctx context.Context, payload *auth.Payload) error
+	RevokeAllSessions(ctx context.Context, userId int64) error
+	// ValidateSession checks that the session an access token was issued under is still active
+	ValidateSession(ctx context.Context, payload *auth.Payload) error
+}
+
+type sessionService struct {
+	sessionRepo          repository.SessionRepository
+	userRepo             repository.UserRepository
+	authMaker            auth.Maker
+	accessTokenDuration  time.Duration
+	refreshTokenDuration time.Duration
+}
+
+func NewSessionService(
+	sessionRepo repository.SessionRepository,
+	userRepo repository.UserRepository,
+	authMaker auth.Maker,
+	accessTokenDuration time.Duration,
+	refreshTokenDuration time.Duration,
+) SessionService {
+	return &sessionService{
+		sessionRepo:          sessionRepo,
+		userRepo:             userRepo,
+		authMaker:            authMaker,
+		accessTokenDuration:  accessTokenDuration,
+		refreshTokenDuration: refreshTokenDuration,
+	}
+}
+
+func (s *sessionService) CreateSession(ctx context.Context, user *database.User, client model.ClientInfo) (model.TokenResponse, error) {
+	sessionId, err := uuid.NewRandom()
+	if err != nil {
+		return model.TokenResponse{}, fmt.Errorf("unable to generate the session id:%v", err)
+	}
+	refreshToken, refreshPayload, err := s.authMaker.Create(s.payloadParams(user, sessionId, auth.TokenTypeRefresh), s.refreshTokenDuration)
+	if err != nil {
+		return model.TokenResponse{}, err
+	}
+	_, err = s.sessionRepo.Create(ctx, repository.CreateSessionParams{
+		SessionID:      sessionId,
+		UserID:         user.UserID,
+		RefreshTokenID: refreshPayload.TokenID,
+		UserAgent:      client.UserAgent,
+		ClientIP:       client.ClientIP,
+		ExpiresAt:      refreshPayload.ExpiresAt,
+	})
+	if err != nil {
+		return model.TokenResponse{}, fmt.Errorf("unable to create the session:%v", err)
+	}
+	accessToken, accessPayload, err := s.authMaker.Create(s.payloadParams(user, sessionId, auth.TokenTypeAccess), s.accessTokenDuration)
+	if err != nil {
+		return model.TokenResponse{}, err
+	}
+	return model.TokenResponse{
+		SessionID:             sessionId,
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessPayload.ExpiresAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshPayload.ExpiresAt,
+	}, nil
+}
+
+func (s *sessionService) RefreshSession(ctx context.Context, refreshToken string) (model.TokenResponse, error) {
+	payload, err := s.authMaker.Verify(refreshToken)
+	if err != nil {
+		return model.TokenResponse{}, err
+	}
+	if payload.TokenType != auth.TokenTypeRefresh {
+		return model.TokenResponse{}, ErrInvalidTokenType
+	}
+	session, err := s.sessionRepo.GetById(ctx, payload.SessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.TokenResponse{}, ErrSessionRevoked
+		}
+		return model.TokenResponse{}, fmt.Errorf("unable to get the session:%v", err)
+	}
+	if session.UserID != payload.UserID {
+		return model.TokenResponse{}, auth.ErrInvalidToken
+	}
+	if session.IsRevoked {
+		return model.TokenResponse{}, ErrSessionRevoked
+	}
+	// a valid refresh token that is no longer the current one for the session has already been exchanged,
+	// someone is replaying it so the whole session is revoked
+	if session.RefreshTokenID != payload.TokenID {
+		return model.TokenResponse{}, s.revokeOnReuse(ctx, session.SessionID)
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return model.TokenResponse{}, ErrSessionExpired
+	}
+	user, err := s.userRepo.GetById(ctx, session.UserID)
+	if err != nil {
+		return model.TokenResponse{}, fmt.Errorf("unable to get user details:%v", err)
+	}
+	if payload.IssuedAt.Before(user.PasswordChangedAt) {
+		return model.TokenResponse{}, ErrPasswordChanged
+	}
+
+	newRefreshToken, refreshPayload, err := s.authMaker.Create(s.payloadParams(user, session.SessionID, auth.TokenTypeRefresh), s.refreshTokenDuration)
+	if err != nil {
+		return model.TokenResponse{}, err
+	}
+	_, err = s.sessionRepo.Rotate(ctx, repository.RotateSessionParams{
+		SessionID:             session.SessionID,
+		CurrentRefreshTokenID: payload.TokenID,
+		NewRefreshTokenID:     refreshPayload.TokenID,
+		ExpiresAt:             refreshPayload.ExpiresAt,
+	})
+	if err != nil {
+		// the token was rotated (or the session revoked) by a concurrent request
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.TokenResponse{}, s.revokeOnReuse(ctx, session.SessionID)
+		}
+		return model.TokenResponse{}, fmt.Errorf("unable to rotate the refresh token:%v", err)
+	}
+	accessToken, accessPayload, err := s.authMaker.Create(s.payloadParams(user, session.SessionID, auth.TokenTypeAccess), s.accessTokenDuration)
+	if err != nil {
+		return model.TokenResponse{}, err
+	}
+	return model.TokenResponse{
+		SessionID:             session.SessionID,
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessPayload.ExpiresAt,
+		RefreshToken:          newRefreshToken,
+		RefreshTokenExpiresAt: refreshPayload.ExpiresAt,
+	}, nil
+}
+
+func (s *sessionService) RevokeSession(ctx context.Context, payload *auth.Payload) error {
+	session, err := s.sessionRepo.GetById(ctx, payload.SessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrSessionRevoked
+		}
+		return fmt.Errorf("unable to get the session:%v", err)
+	}
+	if session.UserID != payload.UserID {
+		return auth.ErrInvalidToken
+	}
+	return s.sessionRepo.Revoke(ctx, session.SessionID)
+}
+
+func (s *sessionService) RevokeAllSessions(ctx context.Context, userId int64) error {
+	return s.sessionRepo.RevokeAllForUser(ctx, userId)
+}
+
+func (s *sessionService) ValidateSession(ctx context.Context, payload *auth.Payload) error {
+	if payload.SessionID == uuid.Nil {
+		return ErrSessionRevoked
+	}
+	session, err := s.sessionRepo.GetForAuth(ctx, payload.SessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrSessionRevoked
+		}
+		return fmt.Errorf("unable to get the session:%v", err)
+	}
+	if session.UserID != payload.UserID || session.IsRevoked {
+		return ErrSessionRevoked
+	}
+	if payload.IssuedAt.Before(session.PasswordChangedAt) {
+		return ErrPasswordChanged
+	}
+	return nil
+}
+
+func (s *sessionService) revokeOnReuse(ctx context.Context, sessionId uuid.UUID) error {
+	if err := s.sessionRepo.Revoke(ctx, sessionId); err != nil {
+		return fmt.Errorf("unable to revoke the session:%v", err)
+	}
+	return ErrRefreshTokenReused
+}
+
+func (s *sessionService) payloadParams(user *database.User, sessionId uuid.UUID, tokenType auth.TokenType) auth.PayloadParams {
+	return auth.PayloadParams{
+		UserID:    user.UserID,
+		Email:     user.Email,
+		Role:      string(user.UserRole),
+		SessionID: sessionId,
+		TokenType: tokenType,
+	}
+}
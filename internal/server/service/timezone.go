@@ -0,0 +1,61 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/model"
+)
+
+// DefaultTimezone is the timezone of doctors that haven't picked one
+const DefaultTimezone = "Africa/Nairobi"
+
+var ErrInvalidTimezone = errors.New("unknown timezone , expected an IANA name like Africa/Nairobi")
+
+// LoadTimezone loads an IANA timezone , the server's own timezone ("Local") isn't accepted since it changes with the deployment
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, ErrInvalidTimezone
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, ErrInvalidTimezone
+	}
+	return location, nil
+}
+
+// calendarDate is the date a client asked for , the day is read in the offset it was sent with and not in the server's timezone
+func calendarDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// newSlots converts the slots of a doctor into the times sent to clients , in UTC and in the doctor's timezone
+func newSlots(rows []database.GetAppointmentSlotsRow) ([]model.Slot, error) {
+	slots := make([]model.Slot, 0, len(rows))
+	for _, row := range rows {
+		slot, err := newSlot(row.SlotStart, row.SlotEnd, row.Timezone, row.SlotStartTime, row.SlotEndTime, row.SlotStatus)
+		if err != nil {
+			return nil, err
+		}
+		slots = append(slots, slot)
+	}
+	return slots, nil
+}
+
+func newSlot(start, end time.Time, timezone, startTime, endTime, status string) (model.Slot, error) {
+	location, err := LoadTimezone(timezone)
+	if err != nil {
+		return model.Slot{}, err
+	}
+	return model.Slot{
+		StartTime:      start.UTC(),
+		EndTime:        end.UTC(),
+		LocalStartTime: start.In(location),
+		LocalEndTime:   end.In(location),
+		Timezone:       timezone,
+		SlotStartTime:  startTime,
+		SlotEndTime:    endTime,
+		SlotStatus:     status,
+	}, nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadTimezone(t *testing.T) {
+	for _, name := range []string{"Africa/Nairobi", "Europe/London", "America/New_York", "UTC"} {
+		_, err := LoadTimezone(name)
+		require.NoError(t, err, name)
+	}
+	for _, name := range []string{"", "Local", "EAT", "Africa/Mombasa City", "+03:00"} {
+		_, err := LoadTimezone(name)
+		require.ErrorIs(t, err, ErrInvalidTimezone, name)
+	}
+}
+
+func TestNewSlotsAcrossDST(t *testing.T) {
+	hourLong := func(start time.Time, local string) database.GetAppointmentSlotsRow {
+		return database.GetAppointmentSlotsRow{
+			SlotStart:     start,
+			SlotEnd:       start.Add(time.Hour),
+			SlotStartTime: local,
+			Timezone:      "Europe/London",
+			SlotStatus:    "available",
+		}
+	}
+
+	t.Run("the clocks go forward", func(t *testing.T) {
+		// 01:00 doesn't exist in London on 29 March 2026 , the slot after midnight is at 02:00 BST
+		slots, err := newSlots([]database.GetAppointmentSlotsRow{
+			hourLong(time.Date(2026, 3, 29, 0, 0, 0, 0, time.UTC), "00:00:00"),
+			hourLong(time.Date(2026, 3, 29, 1, 0, 0, 0, time.UTC), "02:00:00"),
+		})
+		require.NoError(t, err)
+		require.Equal(t, "2026-03-29T00:00:00Z", slots[0].StartTime.Format(time.RFC3339))
+		require.Equal(t, "2026-03-29T00:00:00Z", slots[0].LocalStartTime.Format(time.RFC3339))
+		require.Equal(t, "2026-03-29T01:00:00Z", slots[1].StartTime.Format(time.RFC3339))
+		require.Equal(t, "2026-03-29T02:00:00+01:00", slots[1].LocalStartTime.Format(time.RFC3339))
+		// the first slot ends when the second starts even though the wall clock jumped
+		require.True(t, slots[0].EndTime.Equal(slots[1].StartTime))
+		require.Equal(t, "2026-03-29T02:00:00+01:00", slots[0].LocalEndTime.Format(time.RFC3339))
+	})
+
+	t.Run("the clocks go back", func(t *testing.T) {
+		// 01:00 happens twice in London on 25 October 2026 , once in BST and once in GMT
+		slots, err := newSlots([]database.GetAppointmentSlotsRow{
+			hourLong(time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC), "01:00:00"),
+			hourLong(time.Date(2026, 10, 25, 1, 0, 0, 0, time.UTC), "01:00:00"),
+		})
+		require.NoError(t, err)
+		require.Equal(t, "2026-10-25T01:00:00+01:00", slots[0].LocalStartTime.Format(time.RFC3339))
+		require.Equal(t, "2026-10-25T01:00:00Z", slots[1].LocalStartTime.Format(time.RFC3339))
+		require.Equal(t, time.Hour, slots[1].StartTime.Sub(slots[0].StartTime))
+		require.Equal(t, time.UTC, slots[0].StartTime.Location())
+	})
+
+	t.Run("unknown timezone", func(t *testing.T) {
+		row := hourLong(time.Now(), "09:00:00")
+		row.Timezone = "Mars/Olympus_Mons"
+		_, err := newSlots([]database.GetAppointmentSlotsRow{row})
+		require.ErrorIs(t, err, ErrInvalidTimezone)
+	})
+}
+
+func TestGetSlotsUsesTheRequestedCalendarDate(t *testing.T) {
+	availabilityRepo := &fakeAvailabilityRepository{}
+	service := NewAvailabilityService(availabilityRepo, &fakeDoctorRepository{}, PaymentHoldConfig{})
+	// midnight in Nairobi is still the previous day in UTC
+	nairobi, err := time.LoadLocation("Africa/Nairobi")
+	require.NoError(t, err)
+	_, err = service.GetSlots(context.Background(), model.GetSlotsRequest{
+		DoctorID: doctorID,
+		SlotDate: time.Date(2026, 3, 29, 0, 0, 0, 0, nairobi),
+	})
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2026, 3, 29, 0, 0, 0, 0, time.UTC), availabilityRepo.slotsParams.SlotDate)
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/auth"
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	ErrTwoFactorAlreadyEnabled = errors.New("two factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled    = errors.New("two factor authentication has not been set up for this account")
+	ErrInvalidTwoFactorCode    = errors.New("the two factor code is invalid")
+	ErrTwoFactorRequired       = errors.New("two factor authentication is required for your role and can't be disabled")
+)
+
+type TwoFactorConfig struct {
+	// Issuer is the name shown in authenticator apps
+	Issuer string
+	// EnforcedRoles must complete 2FA on every login
+	EnforcedRoles     []string
+	ChallengeDuration time.Duration
+}
+
+type TwoFactorService interface {
+	IsEnabled(ctx context.Context, userId int64) (bool, error)
+	IsEnforced(role string) bool
+	// BeginEnrollment generates a new secret , 2FA isn't active until ConfirmEnrollment succeeds
+	BeginEnrollment(ctx context.Context, userId int64, email string) (model.TwoFactorEnrollmentResponse, error)
+	// ConfirmEnrollment enables 2FA and returns the recovery codes , they are only ever shown once
+	ConfirmEnrollment(ctx context.Context, userId int64, code string) ([]string, error)
+	// VerifyCode accepts either a TOTP code or an unused recovery code
+	VerifyCode(ctx context.Context, userId int64, code, recoveryCode string) error
+	// Disable turns 2FA off after re-checking the password and a current code
+	Disable(ctx context.Context, userId int64, req model.DisableTwoFactorRequest) error
+	CreateChallenge(user *database.User, enrollmentRequired bool) (*model.MFAChallenge, error)
+	VerifyChallenge(challengeToken string) (*auth.Payload, error)
+}
+
+type twoFactorService struct {
+	twoFactorRepo repository.TwoFactorRepository
+	userRepo      repository.UserRepository
+	authMaker     auth.Maker
+	cipher        *auth.SecretCipher
+	config        TwoFactorConfig
+}
+
+func NewTwoFactorService(twoFactorRepo repository.TwoFactorRepository, userRepo repository.UserRepository, authMaker auth.Maker, cipher *auth.SecretCipher, config TwoFactorConfig) TwoFactorService {
+	return &twoFactorService{
+		twoFactorRepo,
+		userRepo,
+		authMaker,
+		cipher,
+		config,
+	}
+}
+
+func (s *twoFactorService) IsEnabled(ctx context.Context, userId int64) (bool, error) {
+	twoFactor, err := s.twoFactorRepo.Get(ctx, userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("unable to get the 2FA details:%v", err)
+	}
+	return twoFactor.EnabledAt.Valid, nil
+}
+
+func (s *twoFactorService) IsEnforced(role string) bool {
+	return slices.Contains(s.config.EnforcedRoles, role)
+}
+
+func (s *twoFactorService) BeginEnrollment(ctx context.Context, userId int64, email string) (model.TwoFactorEnrollmentResponse, error) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return model.TwoFactorEnrollmentResponse{}, fmt.Errorf("unable to generate the 2FA secret:%v", err)
+	}
+	ciphertext, err := s.cipher.Encrypt(secret)
+	if err != nil {
+		return model.TwoFactorEnrollmentResponse{}, fmt.Errorf("unable to encrypt the 2FA secret:%v", err)
+	}
+	_, err = s.twoFactorRepo.StartEnrollment(ctx, userId, ciphertext)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.TwoFactorEnrollmentResponse{}, ErrTwoFactorAlreadyEnabled
+		}
+		return model.TwoFactorEnrollmentResponse{}, fmt.Errorf("unable to save the 2FA secret:%v", err)
+	}
+	return model.TwoFactorEnrollmentResponse{
+		Secret:          secret,
+		ProvisioningURI: auth.TOTPProvisioningURI(s.config.Issuer, email, secret),
+	}, nil
+}
+
+func (s *twoFactorService) ConfirmEnrollment(ctx context.Context, userId int64, code string) ([]string, error) {
+	twoFactor, err := s.twoFactorRepo.Get(ctx, userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTwoFactorNotEnrolled
+		}
+		return nil, fmt.Errorf("unable to get the 2FA details:%v", err)
+	}
+	if twoFactor.EnabledAt.Valid {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	step, err := s.validateCode(twoFactor, code)
+	if err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate the recovery codes:%v", err)
+	}
+	err = s.twoFactorRepo.Enable(ctx, repository.EnableTwoFactorParams{
+		UserID:             userId,
+		Step:               step,
+		RecoveryCodeHashes: hashes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to enable 2FA:%v", err)
+	}
+	return codes, nil
+}
+
+func (s *twoFactorService) VerifyCode(ctx context.Context, userId int64, code, recoveryCode string) error {
+	twoFactor, err := s.twoFactorRepo.Get(ctx, userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTwoFactorNotEnrolled
+		}
+		return fmt.Errorf("unable to get the 2FA details:%v", err)
+	}
+	if !twoFactor.EnabledAt.Valid {
+		return ErrTwoFactorNotEnrolled
+	}
+	if recoveryCode != "" {
+		err := s.twoFactorRepo.UseRecoveryCode(ctx, userId, auth.HashOpaqueToken(normalizeRecoveryCode(recoveryCode)))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrInvalidTwoFactorCode
+			}
+			return fmt.Errorf("unable to use the recovery code:%v", err)
+		}
+		return nil
+	}
+	step, err := s.validateCode(twoFactor, code)
+	if err != nil {
+		return err
+	}
+	// codes stay valid for the whole period , refuse one that was already accepted
+	if err := s.twoFactorRepo.UseStep(ctx, userId, step); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidTwoFactorCode
+		}
+		return fmt.Errorf("unable to record the 2FA code:%v", err)
+	}
+	return nil
+}
+
+func (s *twoFactorService) Disable(ctx context.Context, userId int64, req model.DisableTwoFactorRequest) error {
+	user, err := s.userRepo.GetById(ctx, userId)
+	if err != nil {
+		return fmt.Errorf("unable to get user details:%v", err)
+	}
+	if s.IsEnforced(string(user.UserRole)) {
+		return ErrTwoFactorRequired
+	}
+	if err := auth.ComparePassword(req.Password, user.Password); err != nil {
+		return ErrIncorrectPassword
+	}
+	if err := s.VerifyCode(ctx, user.UserID, req.Code, ""); err != nil {
+		return err
+	}
+	return s.twoFactorRepo.Disable(ctx, user.UserID)
+}
+
+func (s *twoFactorService) CreateChallenge(user *database.User, enrollmentRequired bool) (*model.MFAChallenge, error) {
+	token, payload, err := s.authMaker.Create(auth.PayloadParams{
+		UserID:    user.UserID,
+		Email:     user.Email,
+		Role:      string(user.UserRole),
+		TokenType: auth.TokenTypeMFAChallenge,
+	}, s.config.ChallengeDuration)
+	if err != nil {
+		return nil, err
+	}
+	return &model.MFAChallenge{
+		ChallengeToken:     token,
+		ExpiresAt:          payload.ExpiresAt,
+		EnrollmentRequired: enrollmentRequired,
+	}, nil
+}
+
+func (s *twoFactorService) VerifyChallenge(challengeToken string) (*auth.Payload, error) {
+	payload, err := s.authMaker.Verify(challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	if payload.TokenType != auth.TokenTypeMFAChallenge {
+		return nil, ErrInvalidTokenType
+	}
+	return payload, nil
+}
+
+func (s *twoFactorService) validateCode(twoFactor *database.UserTwoFactor, code string) (int64, error) {
+	secret, err := s.cipher.Decrypt(twoFactor.SecretCiphertext)
+	if err != nil {
+		return 0, fmt.Errorf("unable to decrypt the 2FA secret:%v", err)
+	}
+	step, ok := auth.ValidateTOTPCode(secret, code, time.Now())
+	if !ok {
+		return 0, ErrInvalidTwoFactorCode
+	}
+	return step, nil
+}
+
+// newRecoveryCodes returns the codes to show the user and the hashes to store
+func newRecoveryCodes() ([]string, []string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(encoding.EncodeToString(buf))
+		code := raw[:4] + "-" + raw[4:]
+		codes = append(codes, code)
+		hashes = append(hashes, auth.HashOpaqueToken(normalizeRecoveryCode(code)))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode makes codes typed with different casing or without the dash match
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
@@ -5,12 +5,15 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log"
 	"mime/multipart"
 	"net/url"
 	"path"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/mbeka02/lyra_backend/internal/auth"
+	"github.com/mbeka02/lyra_backend/internal/database"
 	"github.com/mbeka02/lyra_backend/internal/model"
 	"github.com/mbeka02/lyra_backend/internal/objstore"
 	"github.com/mbeka02/lyra_backend/internal/server/repository"
@@ -32,42 +35,53 @@ var allowedImageTypes = map[string]bool{
 }
 
 type UserService interface {
-	CreateUser(ctx context.Context, req model.CreateUserRequest) (model.AuthResponse, error)
+	CreateUser(ctx context.Context, req model.CreateUserRequest, client model.ClientInfo) (model.LoginResponse, error)
 	GetUser(ctx context.Context, userId int64) (model.UserResponse, error)
-	Login(ctx context.Context, req model.LoginRequest) (model.AuthResponse, error)
+	// Login checks the password , users with 2FA (or whose role enforces it) get an MFA challenge instead of tokens
+	Login(ctx context.Context, req model.LoginRequest, client model.ClientInfo) (model.LoginResponse, error)
+	// VerifyTwoFactorLogin completes a login challenge , for users who are enrolling it also enables 2FA
+	VerifyTwoFactorLogin(ctx context.Context, req model.VerifyTwoFactorLoginRequest, client model.ClientInfo) (model.LoginResponse, error)
+	// BeginTwoFactorEnrollment lets users whose role enforces 2FA enrol during login
+	BeginTwoFactorEnrollment(ctx context.Context, req model.TwoFactorChallengeRequest) (model.TwoFactorEnrollmentResponse, error)
 	UpdateUser(ctx context.Context, req model.UpdateUserRequest, userId int64) error
 	UpdateProfilePicture(ctx context.Context, fileHeader *multipart.FileHeader, userId int64) error
 }
 
 type userService struct {
 	userRepo            repository.UserRepository
-	authMaker           auth.Maker
+	sessionService      SessionService
+	verificationService VerificationService
+	twoFactorService    TwoFactorService
+	lockoutService      LockoutService
 	streamClient        *streamsdk.StreamClient
 	imgStorage          objstore.Storage
-	accessTokenDuration time.Duration
 }
 
 // NewUserService initializes a new UserService.
 func NewUserService(
 	userRepo repository.UserRepository,
-	authMaker auth.Maker,
+	sessionService SessionService,
+	verificationService VerificationService,
+	twoFactorService TwoFactorService,
+	lockoutService LockoutService,
 	streamClient *streamsdk.StreamClient,
 	imgStorage objstore.Storage,
-	accessTokenDuration time.Duration,
 ) UserService {
 	return &userService{
 		userRepo:            userRepo,
-		authMaker:           authMaker,
+		sessionService:      sessionService,
+		verificationService: verificationService,
+		twoFactorService:    twoFactorService,
+		lockoutService:      lockoutService,
 		streamClient:        streamClient,
 		imgStorage:          imgStorage,
-		accessTokenDuration: accessTokenDuration,
 	}
 }
 
-func (s *userService) CreateUser(ctx context.Context, req model.CreateUserRequest) (model.AuthResponse, error) {
+func (s *userService) CreateUser(ctx context.Context, req model.CreateUserRequest, client model.ClientInfo) (model.LoginResponse, error) {
 	passwordHash, err := auth.HashPassword(req.Password)
 	if err != nil {
-		return model.AuthResponse{}, fmt.Errorf("failed to process password:%v", err)
+		return model.LoginResponse{}, fmt.Errorf("failed to process password:%v", err)
 	}
 
 	user, err := s.userRepo.Create(ctx, repository.CreateUserParams{
@@ -79,15 +93,13 @@ func (s *userService) CreateUser(ctx context.Context, req model.CreateUserReques
 		DateOfBirth:     req.DateOfBirth,
 	})
 	if err != nil {
-		return model.AuthResponse{}, fmt.Errorf("failed to create user:%v", err)
+		return model.LoginResponse{}, fmt.Errorf("failed to create user:%v", err)
 	}
-
-	userResponse := model.NewUserResponse(user)
-	// auth token
-	accessToken, err := s.authMaker.Create(user.UserID, user.Email, string(user.UserRole), s.accessTokenDuration)
-	if err != nil {
-		return model.AuthResponse{}, err
+	// the account is still usable if the email fails to send , the user can request another one
+	if err := s.verificationService.SendVerificationEmail(ctx, user); err != nil {
+		log.Printf("unable to send the verification email to user %d: %v", user.UserID, err)
 	}
+
 	// getstream
 	err = s.streamClient.CreateUser(ctx, streamsdk.CreateStreamUserParams{
 		UserID: user.UserID,
@@ -95,17 +107,9 @@ func (s *userService) CreateUser(ctx context.Context, req model.CreateUserReques
 		Email:  user.Email,
 	})
 	if err != nil {
-		return model.AuthResponse{}, fmt.Errorf("stream client error : %v", err)
-	}
-	getStreamToken, err := s.streamClient.CreateToken(fmt.Sprintf("%d", user.UserID))
-	if err != nil {
-		return model.AuthResponse{}, err
+		return model.LoginResponse{}, fmt.Errorf("stream client error : %v", err)
 	}
-	return model.AuthResponse{
-		AccessToken:    accessToken,
-		GetStreamToken: getStreamToken,
-		User:           userResponse,
-	}, nil
+	return s.completeLogin(ctx, user, client)
 }
 
 func (s *userService) GetUser(ctx context.Context, userId int64) (model.UserResponse, error) {
@@ -145,29 +149,127 @@ func (s *userService) UpdateProfilePicture(ctx context.Context, fileHeader *mult
 	return s.userRepo.UpdateProfilePicture(ctx, imageURL, userId)
 }
 
-func (s *userService) Login(ctx context.Context, req model.LoginRequest) (model.AuthResponse, error) {
+func (s *userService) Login(ctx context.Context, req model.LoginRequest, client model.ClientInfo) (model.LoginResponse, error) {
+	// the check comes first so that a throttled email doesn't cost a password comparison
+	if err := s.lockoutService.CheckLogin(ctx, req.Email); err != nil {
+		return model.LoginResponse{}, err
+	}
 	user, err := s.userRepo.GetByEmail(ctx, req.Email)
 	if err != nil {
-		return model.AuthResponse{}, errors.New("account does not exist")
+		return model.LoginResponse{}, s.loginFailed(ctx, req.Email, errors.New("account does not exist"))
 	}
 
 	if err := auth.ComparePassword(req.Password, user.Password); err != nil {
-		return model.AuthResponse{}, errors.New("the password is invalid")
+		return model.LoginResponse{}, s.loginFailed(ctx, req.Email, errors.New("the password is invalid"))
+	}
+	return s.completeLogin(ctx, user, client)
+}
+
+// loginFailed counts the failure , the lockout error takes the place of err if this failure locked the account
+func (s *userService) loginFailed(ctx context.Context, email string, err error) error {
+	if lockErr := s.lockoutService.RecordFailedLogin(ctx, email); lockErr != nil {
+		return lockErr
+	}
+	return err
+}
+
+func (s *userService) VerifyTwoFactorLogin(ctx context.Context, req model.VerifyTwoFactorLoginRequest, client model.ClientInfo) (model.LoginResponse, error) {
+	payload, err := s.twoFactorService.VerifyChallenge(req.ChallengeToken)
+	if err != nil {
+		return model.LoginResponse{}, err
+	}
+	user, err := s.userRepo.GetById(ctx, payload.UserID)
+	if err != nil {
+		return model.LoginResponse{}, fmt.Errorf("unable to get user details:%v", err)
+	}
+	// the challenge is refused once too many wrong codes have been entered against it
+	if err := s.lockoutService.CheckSecondFactor(ctx, user.Email, payload.TokenID); err != nil {
+		return model.LoginResponse{}, err
+	}
+	enabled, err := s.twoFactorService.IsEnabled(ctx, user.UserID)
+	if err != nil {
+		return model.LoginResponse{}, err
+	}
+	if enabled {
+		if err := s.twoFactorService.VerifyCode(ctx, user.UserID, req.Code, req.RecoveryCode); err != nil {
+			return model.LoginResponse{}, s.secondFactorFailed(ctx, user.Email, payload.TokenID, err)
+		}
+		s.lockoutService.RecordSuccessfulLogin(ctx, user.Email)
+		return s.issueTokens(ctx, user, client)
+	}
+	// first login since 2FA became mandatory for the user's role , the code confirms the enrolment
+	recoveryCodes, err := s.twoFactorService.ConfirmEnrollment(ctx, user.UserID, req.Code)
+	if err != nil {
+		return model.LoginResponse{}, s.secondFactorFailed(ctx, user.Email, payload.TokenID, err)
+	}
+	s.lockoutService.RecordSuccessfulLogin(ctx, user.Email)
+	response, err := s.issueTokens(ctx, user, client)
+	if err != nil {
+		return model.LoginResponse{}, err
+	}
+	response.RecoveryCodes = recoveryCodes
+	return response, nil
+}
+
+// secondFactorFailed counts a wrong code , the lockout error takes the place of err if the challenge or the account
+// can't be used any more
+func (s *userService) secondFactorFailed(ctx context.Context, email string, challengeId uuid.UUID, err error) error {
+	if !errors.Is(err, ErrInvalidTwoFactorCode) {
+		return err
+	}
+	if lockErr := s.lockoutService.RecordFailedSecondFactor(ctx, email, challengeId); lockErr != nil {
+		return lockErr
+	}
+	return err
+}
+
+func (s *userService) BeginTwoFactorEnrollment(ctx context.Context, req model.TwoFactorChallengeRequest) (model.TwoFactorEnrollmentResponse, error) {
+	payload, err := s.twoFactorService.VerifyChallenge(req.ChallengeToken)
+	if err != nil {
+		return model.TwoFactorEnrollmentResponse{}, err
+	}
+	user, err := s.userRepo.GetById(ctx, payload.UserID)
+	if err != nil {
+		return model.TwoFactorEnrollmentResponse{}, fmt.Errorf("unable to get user details:%v", err)
 	}
+	return s.twoFactorService.BeginEnrollment(ctx, user.UserID, user.Email)
+}
+
+// completeLogin runs after the password has been checked , it either issues tokens or asks for a second factor
+func (s *userService) completeLogin(ctx context.Context, user *database.User, client model.ClientInfo) (model.LoginResponse, error) {
+	enabled, err := s.twoFactorService.IsEnabled(ctx, user.UserID)
+	if err != nil {
+		return model.LoginResponse{}, err
+	}
+	enforced := s.twoFactorService.IsEnforced(string(user.UserRole))
+	// the failures are only forgotten once the user has been fully authenticated , a correct password isn't enough
+	// for users who still have to enter a second factor
+	if !enabled && !enforced {
+		s.lockoutService.RecordSuccessfulLogin(ctx, user.Email)
+		return s.issueTokens(ctx, user, client)
+	}
+	challenge, err := s.twoFactorService.CreateChallenge(user, !enabled)
+	if err != nil {
+		return model.LoginResponse{}, err
+	}
+	return model.LoginResponse{MFAChallenge: challenge}, nil
+}
 
-	userResponse := model.NewUserResponse(user)
-	accessToken, err := s.authMaker.Create(user.UserID, user.Email, string(user.UserRole), s.accessTokenDuration)
+func (s *userService) issueTokens(ctx context.Context, user *database.User, client model.ClientInfo) (model.LoginResponse, error) {
+	tokens, err := s.sessionService.CreateSession(ctx, user, client)
 	if err != nil {
-		return model.AuthResponse{}, err
+		return model.LoginResponse{}, err
 	}
 	getStreamToken, err := s.streamClient.CreateToken(fmt.Sprintf("%d", user.UserID))
 	if err != nil {
-		return model.AuthResponse{}, err
+		return model.LoginResponse{}, err
 	}
-	return model.AuthResponse{
-		AccessToken:    accessToken,
-		GetStreamToken: getStreamToken,
-		User:           userResponse,
+	return model.LoginResponse{
+		AuthResponse: &model.AuthResponse{
+			TokenResponse:  tokens,
+			GetStreamToken: getStreamToken,
+			User:           model.NewUserResponse(user),
+		},
 	}, nil
 }
 
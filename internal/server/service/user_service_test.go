@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/mbeka02/lyra_backend/internal/auth"
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/model"
+	"github.com/mbeka02/lyra_backend/internal/streamsdk"
+	"github.com/stretchr/testify/require"
+)
+
+const validTwoFactorCode = "123456"
+
+type fakeTwoFactorService struct {
+	TwoFactorService
+	challenges map[string]*auth.Payload
+}
+
+func (f *fakeTwoFactorService) IsEnabled(ctx context.Context, userId int64) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeTwoFactorService) IsEnforced(role string) bool {
+	return true
+}
+
+func (f *fakeTwoFactorService) CreateChallenge(user *database.User, enrollmentRequired bool) (*model.MFAChallenge, error) {
+	token := uuid.NewString()
+	f.challenges[token] = &auth.Payload{TokenID: uuid.New(), UserID: user.UserID, Email: user.Email}
+	return &model.MFAChallenge{ChallengeToken: token}, nil
+}
+
+func (f *fakeTwoFactorService) VerifyChallenge(challengeToken string) (*auth.Payload, error) {
+	payload, ok := f.challenges[challengeToken]
+	if !ok {
+		return nil, auth.ErrInvalidToken
+	}
+	return payload, nil
+}
+
+func (f *fakeTwoFactorService) VerifyCode(ctx context.Context, userId int64, code, recoveryCode string) error {
+	if code != validTwoFactorCode {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+type fakeSessionService struct {
+	SessionService
+}
+
+func (f *fakeSessionService) CreateSession(ctx context.Context, user *database.User, client model.ClientInfo) (model.TokenResponse, error) {
+	return model.TokenResponse{}, nil
+}
+
+func TestVerifyTwoFactorLoginAttempts(t *testing.T) {
+	const email = "dr.otieno@example.com"
+	password, err := auth.HashPassword("correct-password")
+	require.NoError(t, err)
+	users := &fakeUserRepository{users: map[int64]database.User{
+		specialistUserID: {UserID: specialistUserID, Email: email, Password: password, UserRole: database.RoleSpecialist},
+	}}
+	attemptRepo := newFakeLoginAttemptRepository()
+	lockout := NewLockoutService(attemptRepo, users, &fakeMailer{}, testLockoutConfig())
+	streamClient, err := streamsdk.NewStreamClient("key", "secret")
+	require.NoError(t, err)
+	userService := NewUserService(users, &fakeSessionService{}, nil, &fakeTwoFactorService{challenges: map[string]*auth.Payload{}}, lockout, streamClient, nil)
+	ctx := context.Background()
+
+	login := func() string {
+		response, err := userService.Login(ctx, model.LoginRequest{Email: email, Password: "correct-password"}, model.ClientInfo{})
+		require.NoError(t, err)
+		require.NotNil(t, response.MFAChallenge)
+		return response.MFAChallenge.ChallengeToken
+	}
+	verify := func(challenge, code string) error {
+		_, err := userService.VerifyTwoFactorLogin(ctx, model.VerifyTwoFactorLoginRequest{ChallengeToken: challenge, Code: code}, model.ClientInfo{})
+		return err
+	}
+
+	// the challenge is refused after a few wrong codes , even the right one
+	challenge := login()
+	for i := 0; i < 2; i++ {
+		require.ErrorIs(t, verify(challenge, "000000"), ErrInvalidTwoFactorCode)
+	}
+	require.ErrorIs(t, verify(challenge, "000000"), ErrChallengeExhausted)
+	require.ErrorIs(t, verify(challenge, validTwoFactorCode), ErrChallengeExhausted)
+
+	// the correct password doesn't forget the wrong codes
+	challenge = login()
+	require.Equal(t, int32(3), attemptRepo.attempts[email].FailedAttempts)
+	require.ErrorIs(t, verify(challenge, "000000"), ErrInvalidTwoFactorCode)
+	require.Equal(t, int32(4), attemptRepo.attempts[email].FailedAttempts)
+	require.ErrorIs(t, verify(challenge, validTwoFactorCode), ErrLoginThrottled)
+
+	// they are only forgotten once the second factor has been entered
+	attemptRepo.attempts[email].RetryAfter.Valid = false
+	require.NoError(t, verify(challenge, validTwoFactorCode))
+	require.NotContains(t, attemptRepo.attempts, email)
+}
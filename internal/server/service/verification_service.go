@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/mbeka02/lyra_backend/internal/auth"
+	"github.com/mbeka02/lyra_backend/internal/database"
+	"github.com/mbeka02/lyra_backend/internal/mailer"
+	"github.com/mbeka02/lyra_backend/internal/server/repository"
+)
+
+var (
+	ErrEmailAlreadyVerified  = errors.New("this email address has already been verified")
+	ErrVerificationThrottled = errors.New("a verification email was sent recently , please wait before requesting another one")
+	ErrEmailNotVerified      = errors.New("please verify your email address first")
+)
+
+type VerificationConfig struct {
+	// BaseURL is the public URL of the API , the verification link points to {BaseURL}/verify-email
+	BaseURL        string
+	TokenDuration  time.Duration
+	ResendInterval time.Duration
+}
+
+type VerificationService interface {
+	// SendVerificationEmail emails a signed , expiring verification link to a newly registered user
+	SendVerificationEmail(ctx context.Context, user *database.User) error
+	ResendVerificationEmail(ctx context.Context, userId int64) error
+	VerifyEmail(ctx context.Context, token string) error
+}
+
+type verificationService struct {
+	userRepo  repository.UserRepository
+	authMaker auth.Maker
+	mailer    mailer.Mailer
+	config    VerificationConfig
+}
+
+func NewVerificationService(userRepo repository.UserRepository, authMaker auth.Maker, mailer mailer.Mailer, config VerificationConfig) VerificationService {
+	return &verificationService{
+		userRepo,
+		authMaker,
+		mailer,
+		config,
+	}
+}
+
+func (s *verificationService) SendVerificationEmail(ctx context.Context, user *database.User) error {
+	if user.VerifiedAt.Valid {
+		return ErrEmailAlreadyVerified
+	}
+	// throttle : the previous email must have been sent before (now - resend interval)
+	_, err := s.userRepo.MarkVerificationEmailSent(ctx, user.UserID, time.Now().Add(-s.config.ResendInterval))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrVerificationThrottled
+		}
+		return fmt.Errorf("unable to update the user details:%v", err)
+	}
+
+	token, _, err := s.authMaker.Create(auth.PayloadParams{
+		UserID:    user.UserID,
+		Email:     user.Email,
+		Role:      string(user.UserRole),
+		TokenType: auth.TokenTypeEmailVerification,
+	}, s.config.TokenDuration)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/verify-email?token=%s", s.config.BaseURL, url.QueryEscape(token))
+	return s.mailer.Send(ctx, mailer.NewVerificationEmail(user.FullName, user.Email, link))
+}
+
+func (s *verificationService) ResendVerificationEmail(ctx context.Context, userId int64) error {
+	user, err := s.userRepo.GetById(ctx, userId)
+	if err != nil {
+		return fmt.Errorf("unable to get user details:%v", err)
+	}
+	return s.SendVerificationEmail(ctx, user)
+}
+
+func (s *verificationService) VerifyEmail(ctx context.Context, token string) error {
+	payload, err := s.authMaker.Verify(token)
+	if err != nil {
+		return err
+	}
+	if payload.TokenType != auth.TokenTypeEmailVerification {
+		return ErrInvalidTokenType
+	}
+	user, err := s.userRepo.GetById(ctx, payload.UserID)
+	if err != nil {
+		return fmt.Errorf("unable to get user details:%v", err)
+	}
+	// the link was issued for an address the user has since changed
+	if user.Email != payload.Email {
+		return auth.ErrInvalidToken
+	}
+	if user.VerifiedAt.Valid {
+		return nil
+	}
+	return s.userRepo.VerifyEmail(ctx, user.UserID, user.Email)
+}
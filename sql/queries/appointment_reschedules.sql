@@ -0,0 +1,18 @@
+-- name: CreateAppointmentReschedule :one
+INSERT INTO appointment_reschedules (
+  appointment_id,
+  previous_start_time,
+  previous_end_time,
+  new_start_time,
+  new_end_time,
+  reason,
+  rescheduled_by
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7
+) RETURNING *;
+
+-- name: CountAppointmentReschedules :one
+SELECT COUNT(*) FROM appointment_reschedules WHERE appointment_id = $1;
+
+-- name: ListAppointmentReschedules :many
+SELECT * FROM appointment_reschedules WHERE appointment_id = $1 ORDER BY created_at;
@@ -0,0 +1,14 @@
+-- name: CreateAppointmentStatusHistory :exec
+INSERT INTO appointment_status_history (
+  appointment_id,
+  from_status,
+  to_status,
+  actor,
+  changed_by,
+  reason
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+);
+
+-- name: ListAppointmentStatusHistory :many
+SELECT * FROM appointment_status_history WHERE appointment_id = $1 ORDER BY created_at, history_id;
@@ -54,9 +54,137 @@ SELECT EXISTS(
   AND current_status NOT IN ('pending_payment','cancelled')
   LIMIT 1
 );
--- name: UpdateAppointmentStatus :exec
-UPDATE appointments SET current_status=$1 WHERE appointment_id=$2;
 
 -- name: DeleteAppointment :exec
 DELETE FROM appointments WHERE appointment_id=$1;
 
+
+-- name: GetAppointmentById :one
+SELECT * FROM appointments WHERE appointment_id=$1;
+
+-- name: TransitionAppointmentStatus :execrows
+-- only succeeds if the appointment is still in from_status
+UPDATE appointments SET current_status = @to_status, updated_at = now()
+WHERE appointment_id = @appointment_id AND current_status = @from_status;
+
+-- name: CheckAppointmentSlot :one
+-- applies the same rules as the check_appointment_availability trigger and the no_overlapping_appointments constraint ,
+-- the appointment being moved doesn't count as an overlap and neither do unpaid appointments created at or before held_after
+-- (their hold has run out , they are expired when the appointment is added like they are hidden from the slot listing)
+-- (the time has to be in a weekly window on a day that isn't an observed holiday or in extra hours , and not in a block) ,
+-- the weekly windows are in the doctor's timezone , too_soon , too_far and too_close are the doctor's booking rules and are
+-- returned apart so that the patient can be told which one the time breaks
+WITH params AS (
+  SELECT
+    @doctor_id::bigint AS doctor_id,
+    @appointment_id::bigint AS appointment_id,
+    @start_time::timestamptz AS start_time,
+    @end_time::timestamptz AS end_time,
+    @held_after::timestamptz AS held_after
+),
+requested AS (
+  SELECT
+    params.*,
+    (params.start_time AT TIME ZONE d.timezone) AS local_start,
+    (params.end_time AT TIME ZONE d.timezone) AS local_end,
+    d.observes_public_holidays,
+    COALESCE(r.buffer_minutes, 0) AS buffer_minutes,
+    COALESCE(r.min_notice_minutes, 0) AS min_notice_minutes,
+    COALESCE(r.horizon_days, 0) AS horizon_days
+  FROM params
+  JOIN doctors d ON d.doctor_id = params.doctor_id
+  LEFT JOIN booking_rules r ON r.doctor_id = d.doctor_id
+)
+SELECT
+  EXISTS (
+    SELECT 1 WHERE (
+      EXISTS (
+        SELECT 1 FROM availability av
+        WHERE av.doctor_id = requested.doctor_id
+          AND av.is_recurring = true
+          AND av.day_of_week = EXTRACT(DOW FROM requested.local_start)
+          AND (av.start_time, av.end_time) OVERLAPS (requested.local_start::time, requested.local_end::time)
+          AND NOT (
+            requested.observes_public_holidays
+            AND EXISTS (SELECT 1 FROM public_holidays h WHERE h.holiday_date = requested.local_start::date)
+          )
+      ) OR EXISTS (
+        SELECT 1 FROM availability_exceptions ex
+        WHERE ex.doctor_id = requested.doctor_id
+          AND ex.kind = 'extra'
+          AND tstzrange(ex.starts_at, ex.ends_at, '[)') && tstzrange(requested.start_time, requested.end_time, '[)')
+      )
+    ) AND NOT EXISTS (
+      SELECT 1 FROM availability_exceptions bl
+      WHERE bl.doctor_id = requested.doctor_id
+        AND bl.kind = 'block'
+        AND tstzrange(bl.starts_at, bl.ends_at, '[)') && tstzrange(requested.start_time, requested.end_time, '[)')
+    )
+  ) AS within_availability,
+  EXISTS (
+    SELECT 1 FROM appointments ap
+    WHERE ap.doctor_id = requested.doctor_id
+      AND (ap.current_status IN ('scheduled', 'in_progress')
+        OR (ap.current_status = 'pending_payment' AND ap.created_at > requested.held_after))
+      AND ap.appointment_id != requested.appointment_id
+      AND ap.time_range && tstzrange(requested.start_time, requested.end_time, '[)')
+  ) AS already_booked,
+  requested.start_time < now() + requested.min_notice_minutes * interval '1 minute' AS too_soon,
+  EXISTS (
+    SELECT 1 WHERE requested.horizon_days > 0 AND requested.start_time > now() + requested.horizon_days * interval '1 day'
+  ) AS too_far,
+  EXISTS (
+    SELECT 1 FROM appointments ap
+    WHERE ap.doctor_id = requested.doctor_id
+      AND (ap.current_status IN ('scheduled', 'in_progress')
+        OR (ap.current_status = 'pending_payment' AND ap.created_at > requested.held_after))
+      AND ap.appointment_id != requested.appointment_id
+      AND ap.time_range && tstzrange(
+        requested.start_time - requested.buffer_minutes * interval '1 minute',
+        requested.end_time + requested.buffer_minutes * interval '1 minute',
+        '[)'
+      )
+  ) AS too_close
+FROM requested;
+
+-- name: RescheduleAppointment :one
+-- only succeeds if the appointment is still scheduled at the time it was read at
+UPDATE appointments SET start_time = @start_time, end_time = @end_time, updated_at = now()
+WHERE appointment_id = @appointment_id
+  AND current_status = 'scheduled'
+  AND start_time = @previous_start_time
+RETURNING *;
+
+-- name: ExpirePendingAppointments :many
+-- cancels the unpaid appointments whose hold has run out (only the doctor's if doctor_id isn't 0) and records the change in their history
+WITH expired AS (
+  UPDATE appointments SET current_status = 'cancelled', updated_at = now()
+  WHERE appointments.current_status = 'pending_payment' AND appointments.created_at <= @created_before
+    AND (@doctor_id::bigint = 0 OR appointments.doctor_id = @doctor_id::bigint)
+  RETURNING appointment_id
+)
+INSERT INTO appointment_status_history (appointment_id, from_status, to_status, actor, reason)
+SELECT appointment_id, 'pending_payment', 'cancelled', 'system', 'the payment hold expired'
+FROM expired
+RETURNING appointment_id;
+
+-- name: GetAppointmentParticipants :one
+-- the appointment with the doctor and the patient it is sent to , reschedule_count versions the calendar invites
+SELECT
+  a.appointment_id,
+  a.start_time,
+  a.end_time,
+  a.current_status,
+  a.updated_at,
+  d.timezone AS doctor_timezone,
+  du.full_name AS doctor_name,
+  du.email AS doctor_email,
+  pu.full_name AS patient_name,
+  pu.email AS patient_email,
+  (SELECT COUNT(*) FROM appointment_reschedules r WHERE r.appointment_id = a.appointment_id) AS reschedule_count
+FROM appointments a
+JOIN doctors d ON d.doctor_id = a.doctor_id
+JOIN users du ON du.user_id = d.user_id
+JOIN patients p ON p.patient_id = a.patient_id
+JOIN users pu ON pu.user_id = p.user_id
+WHERE a.appointment_id = @appointment_id;
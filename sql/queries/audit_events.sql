@@ -0,0 +1,43 @@
+-- name: LockAuditChain :exec
+-- serializes appends so that every event is chained to the one inserted right before it
+SELECT pg_advisory_xact_lock(hashtext('audit_events'));
+
+-- name: GetLastAuditEventHash :one
+SELECT hash FROM audit_events ORDER BY event_id DESC LIMIT 1;
+
+-- name: CreateAuditEvent :one
+INSERT INTO audit_events(
+  actor_user_id, actor_role, patient_id, resource_type, resource_id, action, request_id, client_ip, occurred_at, prev_hash, hash
+) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11) RETURNING *;
+
+-- name: ListAuditEvents :many
+SELECT * FROM audit_events
+WHERE occurred_at >= @occurred_after AND occurred_at < @occurred_before
+AND (@patient_id::bigint = 0 OR patient_id = @patient_id::bigint)
+AND (@actor_user_id::bigint = 0 OR actor_user_id = @actor_user_id::bigint)
+AND (TRIM(@resource_type::text) = '' OR resource_type = @resource_type::text)
+AND (TRIM(@action::text) = '' OR action = @action::text)
+ORDER BY event_id DESC
+LIMIT @set_limit::int OFFSET @set_offset::int;
+
+-- name: ListPatientRecordAccesses :many
+-- everyone other than the patient who touched the patient's record
+SELECT
+    e.event_id,
+    e.actor_user_id,
+    u.full_name AS actor_name,
+    e.actor_role,
+    e.resource_type,
+    e.action,
+    e.occurred_at
+FROM audit_events e
+LEFT JOIN users u ON u.user_id = e.actor_user_id
+WHERE e.patient_id = @patient_id AND e.actor_user_id <> @patient_user_id
+ORDER BY e.event_id DESC
+LIMIT @set_limit::int OFFSET @set_offset::int;
+
+-- name: ListAuditChain :many
+SELECT * FROM audit_events WHERE event_id > @after_event_id ORDER BY event_id LIMIT @set_limit::int;
+
+-- name: GetAuditEventHash :one
+SELECT hash FROM audit_events WHERE event_id=$1;
@@ -0,0 +1,52 @@
+-- name: CreateAvailabilityException :one
+INSERT INTO availability_exceptions (
+  doctor_id, kind, starts_at, ends_at, interval_minutes, reason
+) VALUES (
+  @doctor_id, @kind, @starts_at, @ends_at, @interval_minutes, @reason
+) RETURNING *;
+
+-- name: ListAvailabilityExceptions :many
+-- the exceptions that overlap [from_time, to_time)
+SELECT * FROM availability_exceptions
+WHERE doctor_id = @doctor_id
+  AND starts_at < @to_time::timestamptz
+  AND ends_at > @from_time::timestamptz
+ORDER BY starts_at;
+
+-- name: DeleteAvailabilityException :execrows
+DELETE FROM availability_exceptions WHERE exception_id = @exception_id AND doctor_id = @doctor_id;
+
+-- name: ListBlockConflicts :many
+-- the active appointments of a doctor that overlap [starts_at, ends_at) , unpaid ones only count while their hold is live
+SELECT appointment_id, start_time, end_time, current_status FROM appointments
+WHERE doctor_id = @doctor_id
+  AND time_range && tstzrange(@starts_at::timestamptz, @ends_at::timestamptz, '[)')
+  AND (
+    current_status IN ('scheduled', 'in_progress')
+    OR (current_status = 'pending_payment' AND created_at > @held_after::timestamptz)
+  )
+ORDER BY start_time;
+
+-- name: ListHolidayConflicts :many
+-- the upcoming active appointments of a doctor that fall on a public holiday in their timezone
+SELECT a.appointment_id, a.start_time, a.end_time, a.current_status FROM appointments a
+JOIN doctors d ON d.doctor_id = a.doctor_id
+JOIN public_holidays h ON h.holiday_date = (a.start_time AT TIME ZONE d.timezone)::date
+WHERE a.doctor_id = @doctor_id
+  AND a.start_time > now()
+  AND (
+    a.current_status IN ('scheduled', 'in_progress')
+    OR (a.current_status = 'pending_payment' AND a.created_at > @held_after::timestamptz)
+  )
+ORDER BY a.start_time;
+
+-- name: ListPublicHolidays :many
+-- the holidays in [from_date, to_date)
+SELECT * FROM public_holidays
+WHERE holiday_date >= @from_date::date AND holiday_date < @to_date::date
+ORDER BY holiday_date;
+
+-- name: SetObservesPublicHolidays :one
+UPDATE doctors SET observes_public_holidays = @observes_public_holidays, updated_at = now()
+WHERE doctor_id = @doctor_id
+RETURNING observes_public_holidays;
@@ -0,0 +1,15 @@
+-- name: GetBookingRules :one
+SELECT * FROM booking_rules WHERE doctor_id = @doctor_id;
+
+-- name: UpsertBookingRules :one
+INSERT INTO booking_rules (
+  doctor_id, buffer_minutes, min_notice_minutes, horizon_days
+) VALUES (
+  @doctor_id, @buffer_minutes, @min_notice_minutes, @horizon_days
+)
+ON CONFLICT (doctor_id) DO UPDATE SET
+  buffer_minutes = EXCLUDED.buffer_minutes,
+  min_notice_minutes = EXCLUDED.min_notice_minutes,
+  horizon_days = EXCLUDED.horizon_days,
+  updated_at = now()
+RETURNING *;
@@ -0,0 +1,36 @@
+-- name: CreateBreakGlassGrant :one
+INSERT INTO break_glass_grants(doctor_id, patient_id, reason, expires_at) VALUES ($1,$2,$3,$4) RETURNING *;
+
+-- name: GetActiveBreakGlassGrant :one
+SELECT * FROM break_glass_grants
+WHERE doctor_id=$1 AND patient_id=$2 AND expires_at > now()
+ORDER BY expires_at DESC
+LIMIT 1;
+
+-- name: RecordBreakGlassAccess :exec
+INSERT INTO break_glass_accesses(grant_id, resource) VALUES ($1,$2);
+
+-- name: ListBreakGlassGrants :many
+SELECT
+    g.grant_id,
+    g.doctor_id,
+    du.full_name AS doctor_name,
+    g.patient_id,
+    pu.full_name AS patient_name,
+    g.reason,
+    g.expires_at,
+    g.created_at,
+    (SELECT COUNT(*) FROM break_glass_accesses a WHERE a.grant_id = g.grant_id) AS access_count
+FROM break_glass_grants g
+JOIN doctors d ON d.doctor_id = g.doctor_id
+JOIN users du ON du.user_id = d.user_id
+JOIN patients p ON p.patient_id = g.patient_id
+JOIN users pu ON pu.user_id = p.user_id
+WHERE g.created_at >= @created_after AND g.created_at < @created_before
+AND (@patient_id::bigint = 0 OR g.patient_id = @patient_id::bigint)
+AND (@doctor_id::bigint = 0 OR g.doctor_id = @doctor_id::bigint)
+ORDER BY g.created_at DESC
+LIMIT @set_limit::int OFFSET @set_offset::int;
+
+-- name: ListBreakGlassAccesses :many
+SELECT * FROM break_glass_accesses WHERE grant_id=$1 ORDER BY accessed_at;
@@ -0,0 +1,12 @@
+-- name: UpsertCalendarFeed :one
+INSERT INTO calendar_feeds (user_id, token_hash) VALUES (@user_id, @token_hash)
+ON CONFLICT (user_id) DO UPDATE SET token_hash = EXCLUDED.token_hash, created_at = now()
+RETURNING *;
+
+-- name: DeleteCalendarFeed :execrows
+DELETE FROM calendar_feeds WHERE user_id = @user_id;
+
+-- name: GetCalendarFeedOwner :one
+SELECT u.user_id, u.user_role FROM calendar_feeds f
+JOIN users u ON u.user_id = f.user_id
+WHERE f.token_hash = @token_hash;
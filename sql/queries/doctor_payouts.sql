@@ -0,0 +1,90 @@
+-- name: UpsertDoctorPayoutAccount :one
+INSERT INTO doctor_payout_accounts (
+  doctor_id,
+  subaccount_code,
+  business_name,
+  bank_code,
+  settlement_bank,
+  account_number_last4
+) VALUES (
+  @doctor_id, @subaccount_code, @business_name, @bank_code, @settlement_bank, @account_number_last4
+)
+ON CONFLICT (doctor_id) DO UPDATE SET
+  subaccount_code = EXCLUDED.subaccount_code,
+  business_name = EXCLUDED.business_name,
+  bank_code = EXCLUDED.bank_code,
+  settlement_bank = EXCLUDED.settlement_bank,
+  account_number_last4 = EXCLUDED.account_number_last4,
+  updated_at = now()
+RETURNING *;
+
+-- name: GetDoctorPayoutAccount :one
+SELECT * FROM doctor_payout_accounts WHERE doctor_id = @doctor_id;
+
+-- name: RecordPaymentEarning :exec
+-- the doctor's share is the consultation fee , the platform keeps its fee and the tax
+INSERT INTO doctor_earnings (doctor_id, payment_id, appointment_id, entry_type, gross_amount, commission, net_amount, currency, settled_by_provider)
+SELECT p.doctor_id, p.payment_id, p.appointment_id, 'earning', p.amount, p.amount - p.consultation_fee, p.consultation_fee, p.currency, p.subaccount_code <> ''
+FROM payments p WHERE p.payment_id = @payment_id
+ON CONFLICT DO NOTHING;
+
+-- name: RecordRefundEarning :exec
+-- the refund comes out of the doctor's share and the commission in the same proportion they were paid in
+INSERT INTO doctor_earnings (doctor_id, payment_id, appointment_id, refund_id, entry_type, gross_amount, commission, net_amount, currency, settled_by_provider)
+SELECT p.doctor_id, p.payment_id, r.appointment_id, r.refund_id, 'refund', -r.amount,
+  -(r.amount - ROUND(r.amount * p.consultation_fee / p.amount, 2)),
+  -ROUND(r.amount * p.consultation_fee / p.amount, 2),
+  r.currency, p.subaccount_code <> ''
+FROM refunds r JOIN payments p ON p.payment_id = r.payment_id
+WHERE r.refund_id = @refund_id AND p.amount > 0
+ON CONFLICT DO NOTHING;
+
+-- name: ReverseRefundEarning :exec
+-- a failed refund gives the doctor their share back
+INSERT INTO doctor_earnings (doctor_id, payment_id, appointment_id, refund_id, entry_type, gross_amount, commission, net_amount, currency, settled_by_provider)
+SELECT e.doctor_id, e.payment_id, e.appointment_id, e.refund_id, 'refund_reversal', -e.gross_amount, -e.commission, -e.net_amount, e.currency, e.settled_by_provider
+FROM doctor_earnings e
+WHERE e.refund_id = @refund_id AND e.entry_type = 'refund'
+ON CONFLICT DO NOTHING;
+
+-- name: ListDoctorEarnings :many
+SELECT * FROM doctor_earnings
+WHERE doctor_id = @doctor_id
+  AND created_at >= @created_from
+  AND created_at < @created_to
+ORDER BY created_at DESC, entry_id DESC
+LIMIT @set_limit OFFSET @set_offset;
+
+-- name: GetDoctorEarningsSummary :one
+SELECT
+  COALESCE(SUM(gross_amount), 0)::numeric(12,2)::text AS gross_amount,
+  COALESCE(SUM(commission), 0)::numeric(12,2)::text AS commission,
+  COALESCE(SUM(net_amount), 0)::numeric(12,2)::text AS net_amount,
+  COALESCE(SUM(net_amount) FILTER (WHERE settled_by_provider), 0)::numeric(12,2)::text AS settled_amount,
+  COALESCE(SUM(net_amount) FILTER (WHERE NOT settled_by_provider), 0)::numeric(12,2)::text AS owed_amount
+FROM doctor_earnings
+WHERE doctor_id = @doctor_id
+  AND created_at >= @created_from
+  AND created_at < @created_to;
+
+-- name: ListDoctorPayouts :many
+-- what each doctor earned over the period , owed_amount is what the platform still has to pay out because it collected the payment itself
+SELECT
+  e.doctor_id,
+  u.full_name,
+  COALESCE(a.subaccount_code, '')::text AS subaccount_code,
+  COUNT(*) FILTER (WHERE e.entry_type = 'earning') AS payments,
+  COALESCE(SUM(e.gross_amount), 0)::numeric(12,2)::text AS gross_amount,
+  COALESCE(SUM(e.commission), 0)::numeric(12,2)::text AS commission,
+  COALESCE(SUM(e.net_amount), 0)::numeric(12,2)::text AS net_amount,
+  COALESCE(SUM(e.net_amount) FILTER (WHERE e.settled_by_provider), 0)::numeric(12,2)::text AS settled_amount,
+  COALESCE(SUM(e.net_amount) FILTER (WHERE NOT e.settled_by_provider), 0)::numeric(12,2)::text AS owed_amount
+FROM doctor_earnings e
+JOIN doctors d ON d.doctor_id = e.doctor_id
+JOIN users u ON u.user_id = d.user_id
+LEFT JOIN doctor_payout_accounts a ON a.doctor_id = e.doctor_id
+WHERE e.created_at >= @created_from
+  AND e.created_at < @created_to
+GROUP BY e.doctor_id, u.full_name, a.subaccount_code
+ORDER BY SUM(e.net_amount) FILTER (WHERE NOT e.settled_by_provider) DESC NULLS LAST, e.doctor_id
+LIMIT @set_limit OFFSET @set_offset;
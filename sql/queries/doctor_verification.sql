@@ -0,0 +1,44 @@
+-- name: GetDoctorById :one
+SELECT * FROM doctors WHERE doctor_id=$1;
+
+-- name: GetDoctorByUserId :one
+SELECT * FROM doctors WHERE user_id=$1;
+
+-- name: UpdateDoctorVerificationStatus :one
+-- only succeeds if the status hasn't changed since it was read
+UPDATE doctors SET verification_status = @to_status, verification_reason = @reason,
+verified_at = CASE WHEN @to_status = 'verified' THEN now() ELSE verified_at END,
+updated_at = now()
+WHERE doctor_id = @doctor_id AND verification_status = @from_status
+RETURNING *;
+
+-- name: CreateDoctorVerificationEvent :exec
+INSERT INTO doctor_verification_events(doctor_id, from_status, to_status, reason, changed_by) VALUES ($1,$2,$3,$4,$5);
+
+-- name: ListDoctorVerificationEvents :many
+SELECT * FROM doctor_verification_events WHERE doctor_id=$1 ORDER BY created_at DESC, event_id DESC;
+
+-- name: CreateDoctorLicenseDocument :one
+INSERT INTO doctor_license_documents(doctor_id, file_url, file_name, content_type) VALUES ($1,$2,$3,$4) RETURNING *;
+
+-- name: ListDoctorLicenseDocuments :many
+SELECT * FROM doctor_license_documents WHERE doctor_id=$1 ORDER BY uploaded_at DESC;
+
+-- name: ListDoctorsByVerificationStatus :many
+-- the review queue , oldest first so doctors are reviewed in the order they signed up
+SELECT
+    doctors.doctor_id,
+    doctors.user_id,
+    users.full_name,
+    users.email,
+    doctors.specialization,
+    doctors.license_number,
+    doctors.verification_status,
+    doctors.verification_reason,
+    doctors.created_at,
+    (SELECT COUNT(*) FROM doctor_license_documents d WHERE d.doctor_id = doctors.doctor_id) AS document_count
+FROM doctors
+INNER JOIN users ON doctors.user_id = users.user_id
+WHERE doctors.verification_status = @status
+ORDER BY doctors.created_at ASC
+LIMIT @set_limit::int OFFSET @set_offset::int;
@@ -1,5 +1,5 @@
 -- name: CreateDoctor :one
-INSERT INTO doctors(user_id,specialization,license_number,description , years_of_experience , county , price_per_hour) VALUES ($1,$2,$3,$4,$5,$6,$7)RETURNING *;
+INSERT INTO doctors(user_id,specialization,license_number,description , years_of_experience , county , price_per_hour, timezone) VALUES ($1,$2,$3,$4,$5,$6,$7,$8)RETURNING *;
 -- name: GetDoctorIdByUserId :one
 SELECT doctor_id FROM doctors WHERE user_id=$1;
 
@@ -30,12 +30,15 @@ SELECT
     doctors.description, 
     doctors.county, 
     doctors.price_per_hour, 
-    doctors.years_of_experience
+    doctors.years_of_experience,
+    doctors.timezone
 FROM doctors
 INNER JOIN users ON doctors.user_id = users.user_id
 WHERE 
+    -- only doctors whose license has been verified are listed
+    doctors.verification_status = 'verified'
     -- Filter for county - returns all results when empty
-    (TRIM(@set_county::text) = '' OR doctors.county ILIKE '%' || @set_county::text || '%')
+    AND (TRIM(@set_county::text) = '' OR doctors.county ILIKE '%' || @set_county::text || '%')
     AND (TRIM(@set_specialization::text) = '' OR doctors.specialization ILIKE '%' || @set_specialization::text || '%')
 AND (NULLIF(@set_min_price::text, '')::numeric IS NULL OR doctors.price_per_hour >= NULLIF(@set_min_price::text, '')::numeric)
     AND (NULLIF(@set_max_price::text, '')::numeric IS NULL OR doctors.price_per_hour <= NULLIF(@set_max_price::text, '')::numeric)
@@ -55,3 +58,8 @@ ORDER BY
         ELSE NULL
     END DESC
 LIMIT @set_limit::int OFFSET @set_offset::int;
+
+-- name: SetDoctorTimezone :one
+UPDATE doctors SET timezone = @timezone, updated_at = now()
+WHERE doctor_id = @doctor_id
+RETURNING timezone;
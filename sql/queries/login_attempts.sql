@@ -0,0 +1,40 @@
+-- emails are compared case insensitively so changing the case doesn't give an attacker a fresh set of attempts
+-- name: GetLoginAttempt :one
+SELECT * FROM login_attempts WHERE email=lower(@email);
+
+-- name: RecordFailedLogin :one
+-- counting starts again once a lockout has run out
+INSERT INTO login_attempts(email, failed_attempts, last_failed_at) VALUES (lower(@email), 1, now())
+ON CONFLICT (email) DO UPDATE SET
+failed_attempts = CASE WHEN login_attempts.locked_until IS NOT NULL AND login_attempts.locked_until <= now() THEN 1 ELSE login_attempts.failed_attempts + 1 END,
+locked_until = CASE WHEN login_attempts.locked_until IS NOT NULL AND login_attempts.locked_until <= now() THEN NULL ELSE login_attempts.locked_until END,
+last_failed_at = now()
+RETURNING *;
+
+-- name: RecordFailedSecondFactor :one
+-- the challenge count starts again with every new challenge , the login count carries on until the second factor succeeds
+INSERT INTO login_attempts(email, failed_attempts, last_failed_at, challenge_id, challenge_failures) VALUES (lower(@email), 1, now(), @challenge_id, 1)
+ON CONFLICT (email) DO UPDATE SET
+failed_attempts = CASE WHEN login_attempts.locked_until IS NOT NULL AND login_attempts.locked_until <= now() THEN 1 ELSE login_attempts.failed_attempts + 1 END,
+locked_until = CASE WHEN login_attempts.locked_until IS NOT NULL AND login_attempts.locked_until <= now() THEN NULL ELSE login_attempts.locked_until END,
+last_failed_at = now(),
+challenge_failures = CASE WHEN login_attempts.challenge_id = EXCLUDED.challenge_id THEN login_attempts.challenge_failures + 1 ELSE 1 END,
+challenge_id = EXCLUDED.challenge_id
+RETURNING *;
+
+-- name: BlockLogin :exec
+UPDATE login_attempts SET retry_after = @retry_after, locked_until = @locked_until WHERE email = lower(@email);
+
+-- name: ClearLoginAttempts :exec
+DELETE FROM login_attempts WHERE email=lower(@email);
+
+-- name: CreateAccountUnlockToken :exec
+INSERT INTO account_unlock_tokens(user_id, token_hash, expires_at) VALUES ($1,$2,$3);
+
+-- name: ConsumeAccountUnlockToken :one
+UPDATE account_unlock_tokens SET used_at=now()
+WHERE token_hash=$1 AND used_at IS NULL AND expires_at > now()
+RETURNING *;
+
+-- name: InvalidateAccountUnlockTokens :exec
+UPDATE account_unlock_tokens SET used_at=now() WHERE user_id=$1 AND used_at IS NULL;
@@ -0,0 +1,17 @@
+-- name: UpsertPaymentDispute :one
+INSERT INTO payment_disputes (
+  payment_id,
+  provider_dispute_id,
+  status,
+  resolution,
+  refund_amount,
+  currency
+) VALUES (
+  @payment_id, @provider_dispute_id, @status, @resolution, @refund_amount, @currency
+)
+ON CONFLICT (provider_dispute_id) DO UPDATE SET
+  status = EXCLUDED.status,
+  resolution = EXCLUDED.resolution,
+  refund_amount = EXCLUDED.refund_amount,
+  updated_at = now()
+RETURNING *;
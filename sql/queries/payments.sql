@@ -4,19 +4,43 @@ INSERT INTO payments (
   amount,
   patient_id,
   doctor_id,
-  appointment_id
+  appointment_id,
+  consultation_fee,
+  platform_fee,
+  tax,
+  payment_method,
+  payer_phone,
+  subaccount_code
 ) VALUES (
-  $1, $2, $3, $4, $5
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
 ) RETURNING *;
 
 -- name: UpdatePaymentStatus :exec
 UPDATE payments
 SET 
-  current_status = $1,
+  current_status = @current_status,
   --NB: Cast string literal to the appropriate type (payment status)
-  completed_at = CASE WHEN $1 = 'completed'::payment_status THEN NOW() ELSE completed_at END,
+  completed_at = CASE WHEN @current_status = 'completed'::payment_status THEN NOW() ELSE completed_at END,
+  -- only set when the provider reports it
+  provider_transaction_id = COALESCE(NULLIF(@provider_transaction_id::text, ''), provider_transaction_id),
   updated_at = NOW()
-WHERE reference = $2;
+WHERE reference = @reference;
 
 -- name: GetPaymentByReference :one
 SELECT * FROM payments WHERE reference = $1 LIMIT 1;
+
+-- name: GetPaymentByAppointmentId :one
+SELECT * FROM payments WHERE appointment_id = $1 LIMIT 1;
+
+-- name: UpdatePaymentStatusById :exec
+UPDATE payments SET current_status = $1, updated_at = NOW() WHERE payment_id = $2;
+
+-- name: FailExpiredHoldPayments :exec
+-- fails the payments of the unpaid appointments whose hold has run out (only the doctor's if doctor_id isn't 0)
+UPDATE payments p SET current_status = 'failed', updated_at = NOW()
+FROM appointments a
+WHERE a.appointment_id = p.appointment_id
+  AND a.current_status = 'pending_payment'
+  AND a.created_at <= @created_before
+  AND (@doctor_id::bigint = 0 OR a.doctor_id = @doctor_id::bigint)
+  AND p.current_status = 'pending';
@@ -0,0 +1,49 @@
+-- name: ListStalePendingPayments :many
+-- payments that have been pending for too long , the ones already flagged for a mismatch are left to the admins
+SELECT * FROM payments p
+WHERE p.current_status = 'pending'
+  AND p.created_at <= @created_before
+  AND NOT EXISTS (
+    SELECT 1 FROM reconciliation_items i
+    WHERE i.payment_id = p.payment_id AND i.outcome = 'mismatch'
+  )
+ORDER BY p.created_at
+LIMIT @set_limit;
+
+-- name: CreateReconciliationRun :one
+INSERT INTO reconciliation_runs DEFAULT VALUES RETURNING *;
+
+-- name: FinishReconciliationRun :one
+UPDATE reconciliation_runs SET
+  finished_at = now(),
+  checked = @checked,
+  updated = @updated,
+  mismatched = @mismatched,
+  failed = @failed
+WHERE run_id = @run_id
+RETURNING *;
+
+-- name: CreateReconciliationItem :one
+INSERT INTO reconciliation_items (
+  run_id,
+  payment_id,
+  reference,
+  outcome,
+  provider_status,
+  expected_amount,
+  provider_amount,
+  expected_currency,
+  provider_currency,
+  detail
+) VALUES (
+  @run_id, @payment_id, @reference, @outcome, @provider_status, @expected_amount, sqlc.narg(provider_amount), @expected_currency, @provider_currency, @detail
+) RETURNING *;
+
+-- name: ListReconciliationRuns :many
+SELECT * FROM reconciliation_runs ORDER BY started_at DESC LIMIT @set_limit OFFSET @set_offset;
+
+-- name: GetReconciliationRun :one
+SELECT * FROM reconciliation_runs WHERE run_id = @run_id;
+
+-- name: ListReconciliationItems :many
+SELECT * FROM reconciliation_items WHERE run_id = @run_id ORDER BY item_id;
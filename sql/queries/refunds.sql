@@ -0,0 +1,39 @@
+-- name: CreateRefund :one
+INSERT INTO refunds (
+  payment_id,
+  appointment_id,
+  amount,
+  currency,
+  reason,
+  initiated_by,
+  provider_refund_id,
+  provider_status,
+  idempotency_key
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9
+) RETURNING *;
+
+-- name: SetRefundProviderResult :one
+-- records what the provider answered when the refund was sent , a status the refund webhook already set is kept
+UPDATE refunds SET
+  provider_refund_id = @provider_refund_id,
+  provider_status = CASE WHEN provider_status = 'pending' THEN @provider_status::text ELSE provider_status END,
+  updated_at = now()
+WHERE refund_id = @refund_id
+RETURNING *;
+
+-- name: UpdateRefundProviderStatus :one
+-- the latest refund of the payment is updated when the provider doesn't send the refund id ,
+-- the refund is found by its id alone when the provider doesn't send the payment reference
+UPDATE refunds SET provider_status = @provider_status, updated_at = now()
+WHERE refund_id = (
+  SELECT r.refund_id FROM refunds r
+  JOIN payments p ON p.payment_id = r.payment_id
+  WHERE (@reference::text = '' OR p.reference = @reference::text)
+    -- the webhook can arrive before the provider's answer to the refund request has been recorded
+    AND (@provider_refund_id::text = '' OR r.provider_refund_id = @provider_refund_id::text
+      OR (r.provider_refund_id = '' AND @reference::text <> ''))
+  ORDER BY r.created_at DESC
+  LIMIT 1
+)
+RETURNING *;
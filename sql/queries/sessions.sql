@@ -0,0 +1,23 @@
+-- name: CreateSession :one
+INSERT INTO sessions(session_id, user_id, refresh_token_id, user_agent, client_ip, expires_at) VALUES ($1,$2,$3,$4,$5,$6) RETURNING *;
+
+-- name: GetSession :one
+SELECT * FROM sessions WHERE session_id=$1;
+
+-- name: RotateSessionRefreshToken :one
+UPDATE sessions SET refresh_token_id = @new_refresh_token_id, expires_at = @expires_at
+WHERE session_id = @session_id AND refresh_token_id = @current_refresh_token_id AND is_revoked=false
+RETURNING *;
+
+-- name: RevokeSession :exec
+UPDATE sessions SET is_revoked=true, revoked_at=now() WHERE session_id=$1 AND is_revoked=false;
+
+-- name: RevokeUserSessions :exec
+UPDATE sessions SET is_revoked=true, revoked_at=now() WHERE user_id=$1 AND is_revoked=false;
+
+-- name: GetSessionForAuth :one
+-- everything the auth middleware needs to decide if an access token is still valid
+SELECT s.session_id, s.user_id, s.is_revoked, u.password_changed_at
+FROM sessions s
+JOIN users u ON u.user_id = s.user_id
+WHERE s.session_id=$1;
@@ -0,0 +1,30 @@
+-- name: GetUserTwoFactor :one
+SELECT * FROM user_two_factor WHERE user_id=$1;
+
+-- name: UpsertPendingTwoFactor :one
+-- starts (or restarts) enrolment , an enabled configuration is never overwritten
+INSERT INTO user_two_factor(user_id, secret_ciphertext) VALUES ($1,$2)
+ON CONFLICT (user_id) DO UPDATE SET secret_ciphertext=EXCLUDED.secret_ciphertext, last_used_step=0, created_at=now()
+WHERE user_two_factor.enabled_at IS NULL
+RETURNING *;
+
+-- name: EnableTwoFactor :exec
+UPDATE user_two_factor SET enabled_at=now(), last_used_step=$2 WHERE user_id=$1 AND enabled_at IS NULL;
+
+-- name: UseTwoFactorStep :one
+-- records the accepted TOTP step , returns no rows if the step (or a later one) was already used
+UPDATE user_two_factor SET last_used_step=$2 WHERE user_id=$1 AND last_used_step < $2 RETURNING user_id;
+
+-- name: DeleteTwoFactor :exec
+DELETE FROM user_two_factor WHERE user_id=$1;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO two_factor_recovery_codes(user_id, code_hash) VALUES ($1,$2);
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM two_factor_recovery_codes WHERE user_id=$1;
+
+-- name: UseRecoveryCode :one
+UPDATE two_factor_recovery_codes SET used_at=now()
+WHERE user_id=$1 AND code_hash=$2 AND used_at IS NULL
+RETURNING code_id;
@@ -7,10 +7,26 @@ SELECT * FROM users WHERE user_id=$1;
 -- name: CreateUser :one
 INSERT INTO users(full_name , password ,date_of_birth, email , telephone_number ,user_role) VALUES ($1,$2,$3,$4,$5,$6) RETURNING *;
 -- name: UpdateUser :exec
-UPDATE users SET full_name=$1 ,email=$2 , telephone_number=$3 WHERE user_id=$4;
+-- changing the email address means the new one has to be verified again
+UPDATE users SET full_name=$1 ,email=$2 , telephone_number=$3,
+verified_at = CASE WHEN email=$2 THEN verified_at ELSE NULL END
+WHERE user_id=$4;
 
 -- name: UpdateProfilePicture :exec
 UPDATE users SET profile_image_url=$1 WHERE user_id=$2;
 
 -- name: CompleteOnboarding :exec
 UPDATE users SET is_onboarded=true WHERE user_id=$1;
+
+-- name: MarkVerificationEmailSent :one
+-- only succeeds if the user is unverified and the last email was sent before @sent_before
+UPDATE users SET verification_sent_at=now()
+WHERE user_id = @user_id AND verified_at IS NULL
+AND (verification_sent_at IS NULL OR verification_sent_at < @sent_before::timestamptz)
+RETURNING *;
+
+-- name: VerifyUserEmail :exec
+UPDATE users SET verified_at=now() WHERE user_id=$1 AND email=$2 AND verified_at IS NULL;
+
+-- name: UpdateUserPassword :exec
+UPDATE users SET password=$1, password_changed_at=$2 WHERE user_id=$3;
@@ -0,0 +1,23 @@
+-- name: ClaimWebhookEvent :one
+-- returns no rows if the event has already been processed or another delivery of it is being processed ,
+-- events that failed part way are claimed again and so are claims older than claimed_before (the server stopped part way)
+INSERT INTO webhook_events (
+  event_id,
+  provider,
+  event,
+  payload,
+  claimed_at
+) VALUES (
+  @event_id, @provider, @event, @payload, now()
+)
+ON CONFLICT (event_id) DO UPDATE SET attempts = webhook_events.attempts + 1, claimed_at = now()
+WHERE webhook_events.processed_at IS NULL
+  AND (webhook_events.claimed_at IS NULL OR webhook_events.claimed_at < @claimed_before::timestamptz)
+RETURNING *;
+
+-- name: ReleaseWebhookEvent :exec
+-- lets the provider's retry of an event that failed be processed straight away
+UPDATE webhook_events SET claimed_at = NULL WHERE event_id = @event_id AND processed_at IS NULL;
+
+-- name: MarkWebhookEventProcessed :exec
+UPDATE webhook_events SET processed_at = now() WHERE event_id = @event_id;
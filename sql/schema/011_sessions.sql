@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS sessions (
+session_id uuid PRIMARY KEY,
+user_id BIGINT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+-- id of the only refresh token that may currently be exchanged for this session
+refresh_token_id uuid NOT NULL,
+user_agent TEXT NOT NULL DEFAULT '',
+client_ip VARCHAR(64) NOT NULL DEFAULT '',
+is_revoked BOOLEAN NOT NULL DEFAULT false,
+expires_at TIMESTAMPTZ NOT NULL,
+created_at TIMESTAMPTZ NOT NULL DEFAULT (now()),
+revoked_at TIMESTAMPTZ
+);
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
+-- +goose Down
+DROP TABLE sessions;
@@ -0,0 +1,5 @@
+-- +goose Up
+-- when the last verification email was sent , used to throttle resends
+ALTER TABLE users ADD COLUMN verification_sent_at timestamptz;
+-- +goose Down
+ALTER TABLE users DROP COLUMN verification_sent_at;
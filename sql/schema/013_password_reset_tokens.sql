@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+token_id BIGSERIAL PRIMARY KEY,
+user_id BIGINT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+-- sha256 of the token that was emailed , the token itself is never stored
+token_hash VARCHAR(64) UNIQUE NOT NULL,
+expires_at TIMESTAMPTZ NOT NULL,
+used_at TIMESTAMPTZ,
+created_at TIMESTAMPTZ NOT NULL DEFAULT (now())
+);
+CREATE INDEX idx_password_reset_tokens_user_id ON password_reset_tokens(user_id);
+-- +goose Down
+DROP TABLE password_reset_tokens;
@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS user_two_factor (
+user_id BIGINT PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+-- TOTP secret encrypted with the server's symmetric key
+secret_ciphertext TEXT NOT NULL,
+-- NULL until the user confirms enrolment with a valid code
+enabled_at TIMESTAMPTZ,
+-- last TOTP time step that was accepted , a code can't be used twice
+last_used_step BIGINT NOT NULL DEFAULT 0,
+created_at TIMESTAMPTZ NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE IF NOT EXISTS two_factor_recovery_codes (
+code_id BIGSERIAL PRIMARY KEY,
+user_id BIGINT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+code_hash VARCHAR(64) NOT NULL,
+used_at TIMESTAMPTZ,
+created_at TIMESTAMPTZ NOT NULL DEFAULT (now())
+);
+CREATE INDEX idx_two_factor_recovery_codes_user_id ON two_factor_recovery_codes(user_id);
+-- +goose Down
+DROP TABLE two_factor_recovery_codes;
+DROP TABLE user_two_factor;
@@ -0,0 +1,6 @@
+-- +goose NO TRANSACTION
+-- +goose Up
+ALTER TYPE role ADD VALUE IF NOT EXISTS 'admin';
+-- +goose Down
+-- postgres can't drop a value from an enum , demote any admins instead
+UPDATE users SET user_role='patient' WHERE user_role='admin';
@@ -0,0 +1,23 @@
+-- +goose Up
+-- emergency access to a patient the specialist has no care relationship with
+CREATE TABLE IF NOT EXISTS break_glass_grants (
+grant_id BIGSERIAL PRIMARY KEY,
+doctor_id BIGINT NOT NULL REFERENCES doctors(doctor_id) ON DELETE CASCADE,
+patient_id BIGINT NOT NULL REFERENCES patients(patient_id) ON DELETE CASCADE,
+reason TEXT NOT NULL,
+expires_at TIMESTAMPTZ NOT NULL,
+created_at TIMESTAMPTZ NOT NULL DEFAULT (now())
+);
+CREATE INDEX idx_break_glass_grants_doctor_patient ON break_glass_grants(doctor_id,patient_id);
+CREATE INDEX idx_break_glass_grants_created_at ON break_glass_grants(created_at);
+-- every read made under a grant
+CREATE TABLE IF NOT EXISTS break_glass_accesses (
+access_id BIGSERIAL PRIMARY KEY,
+grant_id BIGINT NOT NULL REFERENCES break_glass_grants(grant_id) ON DELETE CASCADE,
+resource TEXT NOT NULL,
+accessed_at TIMESTAMPTZ NOT NULL DEFAULT (now())
+);
+CREATE INDEX idx_break_glass_accesses_grant_id ON break_glass_accesses(grant_id);
+-- +goose Down
+DROP TABLE break_glass_accesses;
+DROP TABLE break_glass_grants;
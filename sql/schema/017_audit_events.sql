@@ -0,0 +1,44 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS audit_events (
+event_id BIGSERIAL PRIMARY KEY,
+-- no foreign keys , events have to outlive the users and patients they mention
+actor_user_id BIGINT NOT NULL,
+actor_role VARCHAR(20) NOT NULL,
+patient_id BIGINT NOT NULL,
+resource_type VARCHAR(50) NOT NULL,
+resource_id TEXT NOT NULL DEFAULT '',
+action VARCHAR(20) NOT NULL,
+request_id TEXT NOT NULL DEFAULT '',
+client_ip TEXT NOT NULL DEFAULT '',
+occurred_at TIMESTAMPTZ NOT NULL,
+-- sha256 of the previous event's hash and this event's fields
+prev_hash VARCHAR(64) NOT NULL,
+hash VARCHAR(64) UNIQUE NOT NULL
+);
+CREATE INDEX idx_audit_events_patient_id ON audit_events(patient_id,occurred_at);
+CREATE INDEX idx_audit_events_actor_user_id ON audit_events(actor_user_id,occurred_at);
+CREATE INDEX idx_audit_events_occurred_at ON audit_events(occurred_at);
+
+-- the log is append-only
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION reject_audit_event_changes()
+RETURNS TRIGGER AS $BODY$
+BEGIN
+  RAISE EXCEPTION 'audit events are append-only';
+END;
+$BODY$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+CREATE TRIGGER audit_events_append_only
+BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW
+EXECUTE FUNCTION reject_audit_event_changes();
+CREATE TRIGGER audit_events_no_truncate
+BEFORE TRUNCATE ON audit_events
+FOR EACH STATEMENT
+EXECUTE FUNCTION reject_audit_event_changes();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS audit_events_no_truncate ON audit_events;
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+DROP FUNCTION IF EXISTS reject_audit_event_changes();
+DROP TABLE audit_events;
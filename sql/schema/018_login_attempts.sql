@@ -0,0 +1,25 @@
+-- +goose Up
+-- failed logins are tracked per email address (whether or not an account exists for it) so that a single
+-- account can't be brute forced from many IPs
+CREATE TABLE IF NOT EXISTS login_attempts (
+email varchar PRIMARY KEY,
+failed_attempts INT NOT NULL DEFAULT 0,
+last_failed_at TIMESTAMPTZ NOT NULL DEFAULT (now()),
+-- the next attempt isn't checked before this time (exponential backoff)
+retry_after TIMESTAMPTZ,
+-- set once there have been too many failures , cleared by the unlock link , an admin or a successful login after it expires
+locked_until TIMESTAMPTZ
+);
+CREATE TABLE IF NOT EXISTS account_unlock_tokens (
+token_id BIGSERIAL PRIMARY KEY,
+user_id BIGINT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+-- sha256 of the token that was emailed , the token itself is never stored
+token_hash VARCHAR(64) UNIQUE NOT NULL,
+expires_at TIMESTAMPTZ NOT NULL,
+used_at TIMESTAMPTZ,
+created_at TIMESTAMPTZ NOT NULL DEFAULT (now())
+);
+CREATE INDEX idx_account_unlock_tokens_user_id ON account_unlock_tokens(user_id);
+-- +goose Down
+DROP TABLE account_unlock_tokens;
+DROP TABLE login_attempts;
@@ -0,0 +1,55 @@
+-- +goose Up
+CREATE TYPE verification_status AS ENUM ('pending', 'verified', 'rejected', 'suspended');
+-- doctors that signed up before verification existed have to go through review like everyone else
+ALTER TABLE doctors ADD COLUMN verification_status verification_status NOT NULL DEFAULT 'pending',
+ADD COLUMN verification_reason TEXT NOT NULL DEFAULT '',
+ADD COLUMN verified_at TIMESTAMPTZ;
+CREATE INDEX idx_doctors_verification_status ON doctors(verification_status);
+CREATE TABLE IF NOT EXISTS doctor_license_documents (
+document_id BIGSERIAL PRIMARY KEY,
+doctor_id BIGINT NOT NULL REFERENCES doctors(doctor_id) ON DELETE CASCADE,
+file_url TEXT NOT NULL,
+file_name TEXT NOT NULL,
+content_type VARCHAR(255) NOT NULL,
+uploaded_at TIMESTAMPTZ NOT NULL DEFAULT (now())
+);
+CREATE INDEX idx_doctor_license_documents_doctor_id ON doctor_license_documents(doctor_id);
+-- every change of a doctor's verification status and who made it
+CREATE TABLE IF NOT EXISTS doctor_verification_events (
+event_id BIGSERIAL PRIMARY KEY,
+doctor_id BIGINT NOT NULL REFERENCES doctors(doctor_id) ON DELETE CASCADE,
+from_status verification_status NOT NULL,
+to_status verification_status NOT NULL,
+reason TEXT NOT NULL DEFAULT '',
+changed_by BIGINT NOT NULL REFERENCES users(user_id),
+created_at TIMESTAMPTZ NOT NULL DEFAULT (now())
+);
+CREATE INDEX idx_doctor_verification_events_doctor_id ON doctor_verification_events(doctor_id);
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION check_appointment_doctor_verified()
+RETURNS TRIGGER AS $BODY$
+BEGIN
+  IF NOT EXISTS (
+    SELECT 1 FROM doctors WHERE doctor_id = NEW.doctor_id AND verification_status = 'verified'
+  ) THEN
+    RAISE EXCEPTION 'Doctor is not verified';
+  END IF;
+  RETURN NEW;
+END;
+$BODY$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+-- existing appointments are kept if the doctor is later suspended , only new bookings are refused
+CREATE TRIGGER validate_appointment_doctor
+BEFORE INSERT ON appointments
+FOR EACH ROW
+EXECUTE FUNCTION check_appointment_doctor_verified();
+-- +goose Down
+DROP TRIGGER IF EXISTS validate_appointment_doctor ON appointments;
+DROP FUNCTION IF EXISTS check_appointment_doctor_verified();
+DROP TABLE doctor_verification_events;
+DROP TABLE doctor_license_documents;
+DROP INDEX IF EXISTS idx_doctors_verification_status;
+ALTER TABLE doctors DROP COLUMN verified_at,
+DROP COLUMN verification_reason,
+DROP COLUMN verification_status;
+DROP TYPE verification_status;
@@ -0,0 +1,25 @@
+-- +goose NO TRANSACTION
+-- +goose Up
+ALTER TYPE payment_status ADD VALUE IF NOT EXISTS 'refunded';
+ALTER TYPE payment_status ADD VALUE IF NOT EXISTS 'partially_refunded';
+-- refunds made when an appointment is cancelled , the amount is what the refund policy allowed at the time of cancellation
+CREATE TABLE IF NOT EXISTS refunds(
+refund_id BIGSERIAL PRIMARY KEY,
+payment_id BIGINT NOT NULL references payments(payment_id),
+appointment_id BIGINT NOT NULL references appointments(appointment_id),
+amount NUMERIC(10,2) NOT NULL,
+currency VARCHAR(4) NOT NULL,
+reason TEXT NOT NULL DEFAULT '',
+-- the user that cancelled the appointment
+initiated_by BIGINT NOT NULL references users(user_id),
+-- the id and status of the refund on paystack
+provider_refund_id VARCHAR NOT NULL,
+provider_status VARCHAR(30) NOT NULL,
+created_at TIMESTAMPTZ NOT NULL DEFAULT (now())
+);
+CREATE INDEX IF NOT EXISTS idx_refunds_payment_id ON refunds(payment_id);
+CREATE INDEX IF NOT EXISTS idx_refunds_appointment_id ON refunds(appointment_id);
+-- +goose Down
+DROP TABLE IF EXISTS refunds;
+-- postgres can't drop a value from an enum , refunded payments go back to completed instead
+UPDATE payments SET current_status='completed' WHERE current_status IN ('refunded','partially_refunded');
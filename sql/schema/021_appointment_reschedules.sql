@@ -0,0 +1,16 @@
+-- +goose Up
+-- every time an appointment is moved , the payment stays linked to the appointment so nothing changes on the payments side
+CREATE TABLE IF NOT EXISTS appointment_reschedules(
+reschedule_id BIGSERIAL PRIMARY KEY,
+appointment_id BIGINT NOT NULL REFERENCES appointments(appointment_id) ON DELETE CASCADE,
+previous_start_time TIMESTAMPTZ NOT NULL,
+previous_end_time TIMESTAMPTZ NOT NULL,
+new_start_time TIMESTAMPTZ NOT NULL,
+new_end_time TIMESTAMPTZ NOT NULL,
+reason TEXT NOT NULL DEFAULT '',
+rescheduled_by BIGINT NOT NULL REFERENCES users(user_id),
+created_at TIMESTAMPTZ NOT NULL DEFAULT (now())
+);
+CREATE INDEX IF NOT EXISTS idx_appointment_reschedules_appointment_id ON appointment_reschedules(appointment_id);
+-- +goose Down
+DROP TABLE IF EXISTS appointment_reschedules;
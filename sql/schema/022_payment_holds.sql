@@ -0,0 +1,105 @@
+-- +goose Up
+-- the sweeper looks up unpaid appointments by their age
+CREATE INDEX IF NOT EXISTS idx_appointments_pending_payment ON appointments(created_at) WHERE current_status = 'pending_payment';
+-- the availability rules only need to be checked when an appointment is booked , moved or confirmed ,
+-- otherwise cancelling (or expiring) an appointment would fail once the doctor has changed their availability
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION check_appointment_availability()
+RETURNS TRIGGER AS $BODY$
+DECLARE
+  slot_available boolean;
+  has_overlap boolean;
+  appt_start_time time;
+  appt_end_time time;
+  appt_dow integer;
+BEGIN
+  IF TG_OP = 'UPDATE'
+    AND NEW.doctor_id = OLD.doctor_id
+    AND NEW.start_time = OLD.start_time
+    AND NEW.end_time = OLD.end_time
+    AND (NEW.current_status <> 'scheduled' OR OLD.current_status = 'scheduled') THEN
+    RETURN NEW;
+  END IF;
+
+  -- Extract the time and date components from appointment timestamptz
+  appt_start_time := (NEW.start_time)::time;
+  appt_end_time := (NEW.end_time)::time;
+  appt_dow := EXTRACT(DOW FROM NEW.start_time);
+  
+  -- Check if the time slot exists in doctor's availability
+  SELECT EXISTS (
+    SELECT 1 FROM availability
+    WHERE doctor_id = NEW.doctor_id
+      AND (is_recurring = true AND day_of_week=appt_dow)
+      AND (start_time, end_time) OVERLAPS (appt_start_time, appt_end_time)
+  ) INTO slot_available;
+  
+  IF NOT slot_available THEN
+    RAISE EXCEPTION 'Time slot is not within doctor''s availability';
+  END IF;
+  
+  -- Check for overlapping appointments
+  SELECT EXISTS (
+    SELECT 1 FROM appointments
+    WHERE doctor_id = NEW.doctor_id
+      AND current_status = 'scheduled'
+      AND appointment_id != COALESCE(NEW.appointment_id, -1)
+      AND (start_time, end_time) OVERLAPS (NEW.start_time, NEW.end_time)
+  ) INTO has_overlap;
+  
+  IF has_overlap THEN
+    RAISE EXCEPTION 'Time slot is already booked';
+  END IF;
+  
+  RETURN NEW;
+END;
+$BODY$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION check_appointment_availability()
+RETURNS TRIGGER AS $BODY$
+DECLARE
+  slot_available boolean;
+  has_overlap boolean;
+  appt_start_time time;
+  appt_end_time time;
+  appt_date date;
+  appt_dow integer;
+BEGIN
+  -- Extract the time and date components from appointment timestamptz
+  appt_start_time := (NEW.start_time)::time;
+  appt_end_time := (NEW.end_time)::time;
+  appt_dow := EXTRACT(DOW FROM NEW.start_time);
+  
+  -- Check if the time slot exists in doctor's availability
+  SELECT EXISTS (
+    SELECT 1 FROM availability
+    WHERE doctor_id = NEW.doctor_id
+      AND (is_recurring = true AND day_of_week=appt_dow)
+      AND (start_time, end_time) OVERLAPS (appt_start_time, appt_end_time)
+  ) INTO slot_available;
+  
+  IF NOT slot_available THEN
+    RAISE EXCEPTION 'Time slot is not within doctor''s availability';
+  END IF;
+  
+  -- Check for overlapping appointments
+  SELECT EXISTS (
+    SELECT 1 FROM appointments
+    WHERE doctor_id = NEW.doctor_id
+      AND current_status = 'scheduled'
+      AND appointment_id != COALESCE(NEW.appointment_id, -1)
+      AND (start_time, end_time) OVERLAPS (NEW.start_time, NEW.end_time)
+  ) INTO has_overlap;
+  
+  IF has_overlap THEN
+    RAISE EXCEPTION 'Time slot is already booked';
+  END IF;
+  
+  RETURN NEW;
+END;
+$BODY$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+DROP INDEX IF EXISTS idx_appointments_pending_payment;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- every change to the status of an appointment , changed_by is empty when the change came from a payment or a background job
+CREATE TABLE IF NOT EXISTS appointment_status_history(
+history_id BIGSERIAL PRIMARY KEY,
+appointment_id BIGINT NOT NULL REFERENCES appointments(appointment_id) ON DELETE CASCADE,
+from_status appointment_status NOT NULL,
+to_status appointment_status NOT NULL,
+-- the role of the user that made the change , or payment / system
+actor VARCHAR(20) NOT NULL,
+changed_by BIGINT REFERENCES users(user_id),
+reason TEXT NOT NULL DEFAULT '',
+created_at TIMESTAMPTZ NOT NULL DEFAULT (now())
+);
+CREATE INDEX IF NOT EXISTS idx_appointment_status_history_appointment_id ON appointment_status_history(appointment_id);
+-- +goose Down
+DROP TABLE IF EXISTS appointment_status_history;
@@ -0,0 +1,120 @@
+-- +goose Up
+-- overlapping bookings are refused by the database itself , the old overlap check in the trigger could be passed by
+-- two concurrent bookings since it didn't lock anything and it ignored unpaid holds
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS time_range tstzrange GENERATED ALWAYS AS (tstzrange(start_time, end_time, '[)')) STORED;
+-- holds that overlap a paid appointment (or an earlier hold) were let through before , they have to go before the constraint can be added
+WITH overlapping AS (
+  UPDATE appointments a SET current_status = 'cancelled', updated_at = now()
+  WHERE a.current_status = 'pending_payment'
+    AND EXISTS (
+      SELECT 1 FROM appointments b
+      WHERE b.doctor_id = a.doctor_id
+        AND b.appointment_id != a.appointment_id
+        AND b.time_range && a.time_range
+        AND (b.current_status IN ('scheduled', 'in_progress') OR (b.current_status = 'pending_payment' AND b.appointment_id < a.appointment_id))
+    )
+  RETURNING a.appointment_id
+)
+INSERT INTO appointment_status_history (appointment_id, from_status, to_status, actor, reason)
+SELECT appointment_id, 'pending_payment', 'cancelled', 'system', 'the slot was already taken'
+FROM overlapping;
+ALTER TABLE appointments ADD CONSTRAINT no_overlapping_appointments
+  EXCLUDE USING gist (doctor_id WITH =, time_range WITH &&)
+  WHERE (current_status IN ('pending_payment', 'scheduled', 'in_progress'));
+
+-- the trigger is left with the availability check
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION check_appointment_availability()
+RETURNS TRIGGER AS $BODY$
+DECLARE
+  slot_available boolean;
+  appt_start_time time;
+  appt_end_time time;
+  appt_dow integer;
+BEGIN
+  IF TG_OP = 'UPDATE'
+    AND NEW.doctor_id = OLD.doctor_id
+    AND NEW.start_time = OLD.start_time
+    AND NEW.end_time = OLD.end_time
+    AND (NEW.current_status <> 'scheduled' OR OLD.current_status = 'scheduled') THEN
+    RETURN NEW;
+  END IF;
+
+  -- Extract the time and date components from appointment timestamptz
+  appt_start_time := (NEW.start_time)::time;
+  appt_end_time := (NEW.end_time)::time;
+  appt_dow := EXTRACT(DOW FROM NEW.start_time);
+  
+  -- Check if the time slot exists in doctor's availability
+  SELECT EXISTS (
+    SELECT 1 FROM availability
+    WHERE doctor_id = NEW.doctor_id
+      AND (is_recurring = true AND day_of_week=appt_dow)
+      AND (start_time, end_time) OVERLAPS (appt_start_time, appt_end_time)
+  ) INTO slot_available;
+  
+  IF NOT slot_available THEN
+    RAISE EXCEPTION 'Time slot is not within doctor''s availability';
+  END IF;
+  
+  RETURN NEW;
+END;
+$BODY$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION check_appointment_availability()
+RETURNS TRIGGER AS $BODY$
+DECLARE
+  slot_available boolean;
+  has_overlap boolean;
+  appt_start_time time;
+  appt_end_time time;
+  appt_dow integer;
+BEGIN
+  IF TG_OP = 'UPDATE'
+    AND NEW.doctor_id = OLD.doctor_id
+    AND NEW.start_time = OLD.start_time
+    AND NEW.end_time = OLD.end_time
+    AND (NEW.current_status <> 'scheduled' OR OLD.current_status = 'scheduled') THEN
+    RETURN NEW;
+  END IF;
+
+  -- Extract the time and date components from appointment timestamptz
+  appt_start_time := (NEW.start_time)::time;
+  appt_end_time := (NEW.end_time)::time;
+  appt_dow := EXTRACT(DOW FROM NEW.start_time);
+  
+  -- Check if the time slot exists in doctor's availability
+  SELECT EXISTS (
+    SELECT 1 FROM availability
+    WHERE doctor_id = NEW.doctor_id
+      AND (is_recurring = true AND day_of_week=appt_dow)
+      AND (start_time, end_time) OVERLAPS (appt_start_time, appt_end_time)
+  ) INTO slot_available;
+  
+  IF NOT slot_available THEN
+    RAISE EXCEPTION 'Time slot is not within doctor''s availability';
+  END IF;
+  
+  -- Check for overlapping appointments
+  SELECT EXISTS (
+    SELECT 1 FROM appointments
+    WHERE doctor_id = NEW.doctor_id
+      AND current_status = 'scheduled'
+      AND appointment_id != COALESCE(NEW.appointment_id, -1)
+      AND (start_time, end_time) OVERLAPS (NEW.start_time, NEW.end_time)
+  ) INTO has_overlap;
+  
+  IF has_overlap THEN
+    RAISE EXCEPTION 'Time slot is already booked';
+  END IF;
+  
+  RETURN NEW;
+END;
+$BODY$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+ALTER TABLE appointments DROP CONSTRAINT IF EXISTS no_overlapping_appointments;
+ALTER TABLE appointments DROP COLUMN IF EXISTS time_range;
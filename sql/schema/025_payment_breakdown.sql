@@ -0,0 +1,14 @@
+-- +goose Up
+-- the amount charged is worked out by the server , these record how it was arrived at (amount = consultation_fee + platform_fee + tax)
+ALTER TABLE payments
+  ADD COLUMN IF NOT EXISTS consultation_fee NUMERIC(10,2) NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS platform_fee NUMERIC(10,2) NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS tax NUMERIC(10,2) NOT NULL DEFAULT 0;
+-- existing payments were charged whatever the client sent , all of it is treated as the consultation fee
+UPDATE payments SET consultation_fee = amount;
+
+-- +goose Down
+ALTER TABLE payments
+  DROP COLUMN IF EXISTS consultation_fee,
+  DROP COLUMN IF EXISTS platform_fee,
+  DROP COLUMN IF EXISTS tax;
@@ -0,0 +1,31 @@
+-- +goose Up
+-- webhook events that have been received , an event is only acted on until it has been processed once so redeliveries are no-ops
+CREATE TABLE IF NOT EXISTS webhook_events(
+-- the provider , event type and the id of the object the event is about
+event_id VARCHAR PRIMARY KEY,
+provider VARCHAR(20) NOT NULL,
+event VARCHAR(60) NOT NULL,
+payload JSONB NOT NULL,
+attempts INT NOT NULL DEFAULT 1,
+received_at TIMESTAMPTZ NOT NULL DEFAULT (now()),
+processed_at TIMESTAMPTZ
+);
+-- chargebacks raised by patients against their payments
+CREATE TABLE IF NOT EXISTS payment_disputes(
+dispute_id BIGSERIAL PRIMARY KEY,
+payment_id BIGINT NOT NULL references payments(payment_id),
+provider_dispute_id VARCHAR UNIQUE NOT NULL,
+status VARCHAR(50) NOT NULL,
+resolution VARCHAR(50) NOT NULL DEFAULT '',
+refund_amount NUMERIC(10,2) NOT NULL DEFAULT 0,
+currency VARCHAR(4) NOT NULL,
+created_at TIMESTAMPTZ NOT NULL DEFAULT (now()),
+updated_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_payment_disputes_payment_id ON payment_disputes(payment_id);
+ALTER TABLE refunds ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE refunds DROP COLUMN IF EXISTS updated_at;
+DROP TABLE IF EXISTS payment_disputes;
+DROP TABLE IF EXISTS webhook_events;
@@ -0,0 +1,34 @@
+-- +goose Up
+-- every pass of the reconciliation worker over the stale pending payments
+CREATE TABLE IF NOT EXISTS reconciliation_runs(
+run_id BIGSERIAL PRIMARY KEY,
+started_at TIMESTAMPTZ NOT NULL DEFAULT (now()),
+finished_at TIMESTAMPTZ,
+checked INT NOT NULL DEFAULT 0,
+updated INT NOT NULL DEFAULT 0,
+mismatched INT NOT NULL DEFAULT 0,
+failed INT NOT NULL DEFAULT 0
+);
+-- what was found for each payment , outcome is one of updated , unchanged , mismatch and error
+CREATE TABLE IF NOT EXISTS reconciliation_items(
+item_id BIGSERIAL PRIMARY KEY,
+run_id BIGINT NOT NULL references reconciliation_runs(run_id) ON DELETE CASCADE,
+payment_id BIGINT NOT NULL references payments(payment_id),
+reference VARCHAR NOT NULL,
+outcome VARCHAR(20) NOT NULL,
+provider_status VARCHAR(30) NOT NULL DEFAULT '',
+expected_amount NUMERIC(10,2) NOT NULL,
+provider_amount NUMERIC(10,2),
+expected_currency VARCHAR(4) NOT NULL,
+provider_currency VARCHAR(4) NOT NULL DEFAULT '',
+detail TEXT NOT NULL DEFAULT '',
+created_at TIMESTAMPTZ NOT NULL DEFAULT (now())
+);
+CREATE INDEX IF NOT EXISTS idx_reconciliation_items_run_id ON reconciliation_items(run_id);
+CREATE INDEX IF NOT EXISTS idx_reconciliation_items_payment_id ON reconciliation_items(payment_id);
+CREATE INDEX IF NOT EXISTS idx_payments_pending ON payments(created_at) WHERE current_status = 'pending';
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_payments_pending;
+DROP TABLE IF EXISTS reconciliation_items;
+DROP TABLE IF EXISTS reconciliation_runs;
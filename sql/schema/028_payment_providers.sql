@@ -0,0 +1,17 @@
+-- +goose Up
+-- payments can go through paystack or M-Pesa , the ones made before the method was recorded went through paystack
+UPDATE payments SET payment_method = 'paystack' WHERE payment_method IS NULL;
+ALTER TABLE payments ALTER COLUMN payment_method SET DEFAULT 'paystack';
+ALTER TABLE payments ALTER COLUMN payment_method SET NOT NULL;
+ALTER TABLE payments
+  -- the provider's id for the completed transaction , M-Pesa reversals need the receipt number
+  ADD COLUMN IF NOT EXISTS provider_transaction_id VARCHAR NOT NULL DEFAULT '',
+  -- the phone an M-Pesa payment was made from , partial refunds are sent back to it
+  ADD COLUMN IF NOT EXISTS payer_phone VARCHAR(20) NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE payments
+  DROP COLUMN IF EXISTS provider_transaction_id,
+  DROP COLUMN IF EXISTS payer_phone;
+ALTER TABLE payments ALTER COLUMN payment_method DROP NOT NULL;
+ALTER TABLE payments ALTER COLUMN payment_method DROP DEFAULT;
@@ -0,0 +1,55 @@
+-- +goose Up
+-- the paystack subaccount a doctor's share of each payment is settled to , only the last digits of the account number are kept
+CREATE TABLE IF NOT EXISTS doctor_payout_accounts(
+doctor_id BIGINT PRIMARY KEY references doctors(doctor_id) ON DELETE CASCADE,
+subaccount_code VARCHAR(50) UNIQUE NOT NULL,
+business_name VARCHAR(255) NOT NULL,
+bank_code VARCHAR(20) NOT NULL,
+settlement_bank VARCHAR(255) NOT NULL DEFAULT '',
+account_number_last4 VARCHAR(4) NOT NULL,
+created_at TIMESTAMPTZ NOT NULL DEFAULT (now()),
+updated_at TIMESTAMPTZ NOT NULL DEFAULT (now())
+);
+-- the subaccount the payment was split with , empty when the platform collected all of it
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS subaccount_code VARCHAR(50) NOT NULL DEFAULT '';
+
+-- earning entries are made when a payment completes , refund entries when some of it is refunded and
+-- refund_reversal entries when a refund fails and the money stays with the doctor
+CREATE TYPE earning_entry_type AS ENUM ('earning', 'refund', 'refund_reversal');
+CREATE TABLE IF NOT EXISTS doctor_earnings(
+entry_id BIGSERIAL PRIMARY KEY,
+doctor_id BIGINT NOT NULL references doctors(doctor_id),
+payment_id BIGINT NOT NULL references payments(payment_id),
+appointment_id BIGINT NOT NULL references appointments(appointment_id),
+refund_id BIGINT references refunds(refund_id),
+entry_type earning_entry_type NOT NULL,
+-- what the patient paid (or got back) , split into the platform's commission (its fee and the tax) and the doctor's share
+gross_amount NUMERIC(10,2) NOT NULL,
+commission NUMERIC(10,2) NOT NULL,
+net_amount NUMERIC(10,2) NOT NULL,
+currency VARCHAR(4) NOT NULL,
+-- the doctor's share went straight to their subaccount , otherwise the platform owes it to them
+settled_by_provider BOOLEAN NOT NULL,
+created_at TIMESTAMPTZ NOT NULL DEFAULT (now())
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_doctor_earnings_payment ON doctor_earnings(payment_id) WHERE entry_type = 'earning';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_doctor_earnings_refund ON doctor_earnings(refund_id, entry_type) WHERE refund_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_doctor_earnings_doctor_id ON doctor_earnings(doctor_id, created_at);
+
+-- the payments taken before the ledger existed were all collected by the platform
+INSERT INTO doctor_earnings (doctor_id, payment_id, appointment_id, entry_type, gross_amount, commission, net_amount, currency, settled_by_provider, created_at)
+SELECT doctor_id, payment_id, appointment_id, 'earning', amount, platform_fee + tax, consultation_fee, currency, false, COALESCE(completed_at, created_at)
+FROM payments WHERE current_status IN ('completed', 'refunded', 'partially_refunded');
+INSERT INTO doctor_earnings (doctor_id, payment_id, appointment_id, refund_id, entry_type, gross_amount, commission, net_amount, currency, settled_by_provider, created_at)
+SELECT p.doctor_id, p.payment_id, r.appointment_id, r.refund_id, 'refund', -r.amount,
+  -(r.amount - ROUND(r.amount * p.consultation_fee / NULLIF(p.amount, 0), 2)),
+  -ROUND(r.amount * p.consultation_fee / NULLIF(p.amount, 0), 2),
+  r.currency, false, r.created_at
+FROM refunds r JOIN payments p ON p.payment_id = r.payment_id
+WHERE p.amount > 0;
+
+-- +goose Down
+DROP TABLE IF EXISTS doctor_earnings;
+DROP TYPE IF EXISTS earning_entry_type;
+ALTER TABLE payments DROP COLUMN IF EXISTS subaccount_code;
+DROP TABLE IF EXISTS doctor_payout_accounts;
@@ -0,0 +1,167 @@
+-- +goose Up
+-- dated changes to a doctor's weekly availability , a block takes the doctor out for [starts_at, ends_at) (time off , a vacation week)
+-- and extra hours open slots of interval_minutes on a single date (e.g. a one-off saturday clinic)
+CREATE TYPE availability_exception_kind AS ENUM ('block', 'extra');
+CREATE TABLE IF NOT EXISTS availability_exceptions(
+exception_id BIGSERIAL PRIMARY KEY,
+doctor_id BIGINT NOT NULL references doctors(doctor_id) ON DELETE CASCADE,
+kind availability_exception_kind NOT NULL,
+starts_at TIMESTAMPTZ NOT NULL,
+ends_at TIMESTAMPTZ NOT NULL,
+interval_minutes INTEGER NOT NULL DEFAULT 60,
+reason TEXT NOT NULL DEFAULT '',
+created_at TIMESTAMPTZ NOT NULL DEFAULT (now()),
+CHECK (ends_at > starts_at),
+CHECK (interval_minutes > 0)
+);
+CREATE INDEX IF NOT EXISTS idx_availability_exceptions_doctor_id ON availability_exceptions(doctor_id, starts_at);
+
+-- the kenyan public holidays , doctors that observe them aren't offered their weekly slots on these dates
+CREATE TABLE IF NOT EXISTS public_holidays(
+holiday_date DATE PRIMARY KEY,
+name VARCHAR(255) NOT NULL
+);
+ALTER TABLE doctors ADD COLUMN IF NOT EXISTS observes_public_holidays BOOLEAN NOT NULL DEFAULT false;
+
+-- holidays that fall on a sunday are observed on the monday after (Public Holidays Act) ,
+-- idd-ul-fitr depends on the moon sighting so the dates after 2025 are the expected ones until they are gazetted
+INSERT INTO public_holidays (holiday_date, name) VALUES
+('2025-01-01', 'New Year''s Day'),
+('2025-03-31', 'Idd-ul-Fitr'),
+('2025-04-18', 'Good Friday'),
+('2025-04-21', 'Easter Monday'),
+('2025-05-01', 'Labour Day'),
+('2025-06-02', 'Madaraka Day'),
+('2025-10-10', 'Mazingira Day'),
+('2025-10-20', 'Mashujaa Day'),
+('2025-12-12', 'Jamhuri Day'),
+('2025-12-25', 'Christmas Day'),
+('2025-12-26', 'Boxing Day'),
+('2026-01-01', 'New Year''s Day'),
+('2026-03-20', 'Idd-ul-Fitr'),
+('2026-04-03', 'Good Friday'),
+('2026-04-06', 'Easter Monday'),
+('2026-05-01', 'Labour Day'),
+('2026-06-01', 'Madaraka Day'),
+('2026-10-10', 'Mazingira Day'),
+('2026-10-20', 'Mashujaa Day'),
+('2026-12-12', 'Jamhuri Day'),
+('2026-12-25', 'Christmas Day'),
+('2026-12-26', 'Boxing Day'),
+('2027-01-01', 'New Year''s Day'),
+('2027-03-10', 'Idd-ul-Fitr'),
+('2027-03-26', 'Good Friday'),
+('2027-03-29', 'Easter Monday'),
+('2027-05-01', 'Labour Day'),
+('2027-06-01', 'Madaraka Day'),
+('2027-10-11', 'Mazingira Day'),
+('2027-10-20', 'Mashujaa Day'),
+('2027-12-13', 'Jamhuri Day'),
+('2027-12-25', 'Christmas Day'),
+('2027-12-27', 'Boxing Day')
+ON CONFLICT (holiday_date) DO NOTHING;
+
+-- bookings have to fall in a weekly window (unless it's a holiday the doctor observes) or in extra hours , and never in a block ,
+-- the violation is raised against doctor_availability so that it can be told apart from other errors
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION check_appointment_availability()
+RETURNS TRIGGER AS $BODY$
+DECLARE
+  slot_available boolean;
+  appt_start_time time;
+  appt_end_time time;
+  appt_dow integer;
+BEGIN
+  IF TG_OP = 'UPDATE'
+    AND NEW.doctor_id = OLD.doctor_id
+    AND NEW.start_time = OLD.start_time
+    AND NEW.end_time = OLD.end_time
+    AND (NEW.current_status <> 'scheduled' OR OLD.current_status = 'scheduled') THEN
+    RETURN NEW;
+  END IF;
+
+  -- Extract the time and date components from appointment timestamptz
+  appt_start_time := (NEW.start_time)::time;
+  appt_end_time := (NEW.end_time)::time;
+  appt_dow := EXTRACT(DOW FROM NEW.start_time);
+
+  IF EXISTS (
+    SELECT 1 FROM availability_exceptions
+    WHERE doctor_id = NEW.doctor_id
+      AND kind = 'block'
+      AND tstzrange(starts_at, ends_at, '[)') && tstzrange(NEW.start_time, NEW.end_time, '[)')
+  ) THEN
+    RAISE EXCEPTION 'Time slot is blocked in the doctor''s schedule'
+      USING ERRCODE = 'check_violation', CONSTRAINT = 'doctor_availability';
+  END IF;
+
+  -- Check if the time slot exists in doctor's availability
+  SELECT EXISTS (
+    SELECT 1 FROM availability
+    WHERE doctor_id = NEW.doctor_id
+      AND (is_recurring = true AND day_of_week=appt_dow)
+      AND (start_time, end_time) OVERLAPS (appt_start_time, appt_end_time)
+      AND NOT EXISTS (
+        SELECT 1 FROM public_holidays h JOIN doctors d ON d.doctor_id = NEW.doctor_id
+        WHERE h.holiday_date = (NEW.start_time)::date AND d.observes_public_holidays
+      )
+  ) OR EXISTS (
+    SELECT 1 FROM availability_exceptions
+    WHERE doctor_id = NEW.doctor_id
+      AND kind = 'extra'
+      AND tstzrange(starts_at, ends_at, '[)') && tstzrange(NEW.start_time, NEW.end_time, '[)')
+  ) INTO slot_available;
+
+  IF NOT slot_available THEN
+    RAISE EXCEPTION 'Time slot is not within doctor''s availability'
+      USING ERRCODE = 'check_violation', CONSTRAINT = 'doctor_availability';
+  END IF;
+
+  RETURN NEW;
+END;
+$BODY$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION check_appointment_availability()
+RETURNS TRIGGER AS $BODY$
+DECLARE
+  slot_available boolean;
+  appt_start_time time;
+  appt_end_time time;
+  appt_dow integer;
+BEGIN
+  IF TG_OP = 'UPDATE'
+    AND NEW.doctor_id = OLD.doctor_id
+    AND NEW.start_time = OLD.start_time
+    AND NEW.end_time = OLD.end_time
+    AND (NEW.current_status <> 'scheduled' OR OLD.current_status = 'scheduled') THEN
+    RETURN NEW;
+  END IF;
+
+  -- Extract the time and date components from appointment timestamptz
+  appt_start_time := (NEW.start_time)::time;
+  appt_end_time := (NEW.end_time)::time;
+  appt_dow := EXTRACT(DOW FROM NEW.start_time);
+
+  -- Check if the time slot exists in doctor's availability
+  SELECT EXISTS (
+    SELECT 1 FROM availability
+    WHERE doctor_id = NEW.doctor_id
+      AND (is_recurring = true AND day_of_week=appt_dow)
+      AND (start_time, end_time) OVERLAPS (appt_start_time, appt_end_time)
+  ) INTO slot_available;
+
+  IF NOT slot_available THEN
+    RAISE EXCEPTION 'Time slot is not within doctor''s availability';
+  END IF;
+
+  RETURN NEW;
+END;
+$BODY$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+ALTER TABLE doctors DROP COLUMN IF EXISTS observes_public_holidays;
+DROP TABLE IF EXISTS public_holidays;
+DROP TABLE IF EXISTS availability_exceptions;
+DROP TYPE IF EXISTS availability_exception_kind;
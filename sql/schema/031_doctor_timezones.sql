@@ -0,0 +1,128 @@
+-- +goose Up
+-- the doctor's availability is in their own timezone , slots used to be computed in the timezone of the database session
+-- which broke for servers that don't run in EAT
+ALTER TABLE doctors ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'Africa/Nairobi';
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION check_appointment_availability()
+RETURNS TRIGGER AS $BODY$
+DECLARE
+  slot_available boolean;
+  appt_start_time time;
+  appt_end_time time;
+  appt_dow integer;
+  appt_date date;
+  doctor_timezone text;
+BEGIN
+  IF TG_OP = 'UPDATE'
+    AND NEW.doctor_id = OLD.doctor_id
+    AND NEW.start_time = OLD.start_time
+    AND NEW.end_time = OLD.end_time
+    AND (NEW.current_status <> 'scheduled' OR OLD.current_status = 'scheduled') THEN
+    RETURN NEW;
+  END IF;
+
+  -- the weekly windows are wall clock times in the doctor's timezone , the session's timezone doesn't matter
+  SELECT timezone INTO doctor_timezone FROM doctors WHERE doctor_id = NEW.doctor_id;
+  appt_start_time := (NEW.start_time AT TIME ZONE doctor_timezone)::time;
+  appt_end_time := (NEW.end_time AT TIME ZONE doctor_timezone)::time;
+  appt_date := (NEW.start_time AT TIME ZONE doctor_timezone)::date;
+  appt_dow := EXTRACT(DOW FROM appt_date);
+
+  IF EXISTS (
+    SELECT 1 FROM availability_exceptions
+    WHERE doctor_id = NEW.doctor_id
+      AND kind = 'block'
+      AND tstzrange(starts_at, ends_at, '[)') && tstzrange(NEW.start_time, NEW.end_time, '[)')
+  ) THEN
+    RAISE EXCEPTION 'Time slot is blocked in the doctor''s schedule'
+      USING ERRCODE = 'check_violation', CONSTRAINT = 'doctor_availability';
+  END IF;
+
+  -- Check if the time slot exists in doctor's availability
+  SELECT EXISTS (
+    SELECT 1 FROM availability
+    WHERE doctor_id = NEW.doctor_id
+      AND (is_recurring = true AND day_of_week=appt_dow)
+      AND (start_time, end_time) OVERLAPS (appt_start_time, appt_end_time)
+      AND NOT EXISTS (
+        SELECT 1 FROM public_holidays h JOIN doctors d ON d.doctor_id = NEW.doctor_id
+        WHERE h.holiday_date = appt_date AND d.observes_public_holidays
+      )
+  ) OR EXISTS (
+    SELECT 1 FROM availability_exceptions
+    WHERE doctor_id = NEW.doctor_id
+      AND kind = 'extra'
+      AND tstzrange(starts_at, ends_at, '[)') && tstzrange(NEW.start_time, NEW.end_time, '[)')
+  ) INTO slot_available;
+
+  IF NOT slot_available THEN
+    RAISE EXCEPTION 'Time slot is not within doctor''s availability'
+      USING ERRCODE = 'check_violation', CONSTRAINT = 'doctor_availability';
+  END IF;
+
+  RETURN NEW;
+END;
+$BODY$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION check_appointment_availability()
+RETURNS TRIGGER AS $BODY$
+DECLARE
+  slot_available boolean;
+  appt_start_time time;
+  appt_end_time time;
+  appt_dow integer;
+BEGIN
+  IF TG_OP = 'UPDATE'
+    AND NEW.doctor_id = OLD.doctor_id
+    AND NEW.start_time = OLD.start_time
+    AND NEW.end_time = OLD.end_time
+    AND (NEW.current_status <> 'scheduled' OR OLD.current_status = 'scheduled') THEN
+    RETURN NEW;
+  END IF;
+
+  -- Extract the time and date components from appointment timestamptz
+  appt_start_time := (NEW.start_time)::time;
+  appt_end_time := (NEW.end_time)::time;
+  appt_dow := EXTRACT(DOW FROM NEW.start_time);
+
+  IF EXISTS (
+    SELECT 1 FROM availability_exceptions
+    WHERE doctor_id = NEW.doctor_id
+      AND kind = 'block'
+      AND tstzrange(starts_at, ends_at, '[)') && tstzrange(NEW.start_time, NEW.end_time, '[)')
+  ) THEN
+    RAISE EXCEPTION 'Time slot is blocked in the doctor''s schedule'
+      USING ERRCODE = 'check_violation', CONSTRAINT = 'doctor_availability';
+  END IF;
+
+  -- Check if the time slot exists in doctor's availability
+  SELECT EXISTS (
+    SELECT 1 FROM availability
+    WHERE doctor_id = NEW.doctor_id
+      AND (is_recurring = true AND day_of_week=appt_dow)
+      AND (start_time, end_time) OVERLAPS (appt_start_time, appt_end_time)
+      AND NOT EXISTS (
+        SELECT 1 FROM public_holidays h JOIN doctors d ON d.doctor_id = NEW.doctor_id
+        WHERE h.holiday_date = (NEW.start_time)::date AND d.observes_public_holidays
+      )
+  ) OR EXISTS (
+    SELECT 1 FROM availability_exceptions
+    WHERE doctor_id = NEW.doctor_id
+      AND kind = 'extra'
+      AND tstzrange(starts_at, ends_at, '[)') && tstzrange(NEW.start_time, NEW.end_time, '[)')
+  ) INTO slot_available;
+
+  IF NOT slot_available THEN
+    RAISE EXCEPTION 'Time slot is not within doctor''s availability'
+      USING ERRCODE = 'check_violation', CONSTRAINT = 'doctor_availability';
+  END IF;
+
+  RETURN NEW;
+END;
+$BODY$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+ALTER TABLE doctors DROP COLUMN IF EXISTS timezone;
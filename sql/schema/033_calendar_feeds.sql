@@ -0,0 +1,10 @@
+-- +goose Up
+-- a secret ICS subscription URL per user , only the hash of the token in it is stored and creating a new one replaces the old
+CREATE TABLE IF NOT EXISTS calendar_feeds(
+user_id BIGINT PRIMARY KEY references users(user_id) ON DELETE CASCADE,
+token_hash VARCHAR(64) NOT NULL UNIQUE,
+created_at TIMESTAMPTZ NOT NULL DEFAULT (now())
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS calendar_feeds;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- refunds are recorded as pending when the appointment is cancelled and sent to the provider once that has been committed ,
+-- the key ties a refund to the cancellation that made it so the same cancellation can't be refunded twice
+ALTER TABLE refunds ADD COLUMN IF NOT EXISTS idempotency_key VARCHAR(64);
+UPDATE refunds SET idempotency_key = 'refund_' || refund_id WHERE idempotency_key IS NULL;
+ALTER TABLE refunds ALTER COLUMN idempotency_key SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refunds_idempotency_key ON refunds(idempotency_key);
+-- empty until the provider has accepted the refund
+ALTER TABLE refunds ALTER COLUMN provider_refund_id SET DEFAULT '';
+
+-- +goose Down
+ALTER TABLE refunds ALTER COLUMN provider_refund_id DROP DEFAULT;
+DROP INDEX IF EXISTS idx_refunds_idempotency_key;
+ALTER TABLE refunds DROP COLUMN IF EXISTS idempotency_key;
@@ -0,0 +1,190 @@
+-- +goose Up
+-- the slot is checked when it is booked or moved , a held appointment keeps its slot until it is paid for or expires
+-- so confirming the payment (or any other status change) never fails because the doctor's schedule changed in between
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION check_appointment_availability()
+RETURNS TRIGGER AS $BODY$
+DECLARE
+  slot_available boolean;
+  appt_start_time time;
+  appt_end_time time;
+  appt_dow integer;
+  appt_date date;
+  doctor_timezone text;
+  rules booking_rules%ROWTYPE;
+BEGIN
+  IF TG_OP = 'UPDATE'
+    AND NEW.doctor_id = OLD.doctor_id
+    AND NEW.start_time = OLD.start_time
+    AND NEW.end_time = OLD.end_time THEN
+    RETURN NEW;
+  END IF;
+
+  -- the weekly windows are wall clock times in the doctor's timezone , the session's timezone doesn't matter
+  SELECT timezone INTO doctor_timezone FROM doctors WHERE doctor_id = NEW.doctor_id;
+  appt_start_time := (NEW.start_time AT TIME ZONE doctor_timezone)::time;
+  appt_end_time := (NEW.end_time AT TIME ZONE doctor_timezone)::time;
+  appt_date := (NEW.start_time AT TIME ZONE doctor_timezone)::date;
+  appt_dow := EXTRACT(DOW FROM appt_date);
+
+  -- the row is locked so that two bookings that are each clear of the buffer can't be made next to each other at once
+  SELECT * INTO rules FROM booking_rules WHERE doctor_id = NEW.doctor_id FOR UPDATE;
+  IF FOUND THEN
+    IF NEW.start_time < now() + rules.min_notice_minutes * interval '1 minute' THEN
+      RAISE EXCEPTION 'The doctor needs more notice for this booking'
+        USING ERRCODE = 'check_violation', CONSTRAINT = 'doctor_booking_rules';
+    END IF;
+    IF rules.horizon_days > 0 AND NEW.start_time > now() + rules.horizon_days * interval '1 day' THEN
+      RAISE EXCEPTION 'The doctor doesn''t take bookings this far ahead'
+        USING ERRCODE = 'check_violation', CONSTRAINT = 'doctor_booking_rules';
+    END IF;
+    IF rules.buffer_minutes > 0 AND EXISTS (
+      SELECT 1 FROM appointments
+      WHERE doctor_id = NEW.doctor_id
+        AND appointment_id <> NEW.appointment_id
+        AND current_status IN ('pending_payment', 'scheduled', 'in_progress')
+        AND time_range && tstzrange(
+          NEW.start_time - rules.buffer_minutes * interval '1 minute',
+          NEW.end_time + rules.buffer_minutes * interval '1 minute',
+          '[)'
+        )
+    ) THEN
+      RAISE EXCEPTION 'The booking is too close to another of the doctor''s appointments'
+        USING ERRCODE = 'check_violation', CONSTRAINT = 'doctor_booking_rules';
+    END IF;
+  END IF;
+
+  IF EXISTS (
+    SELECT 1 FROM availability_exceptions
+    WHERE doctor_id = NEW.doctor_id
+      AND kind = 'block'
+      AND tstzrange(starts_at, ends_at, '[)') && tstzrange(NEW.start_time, NEW.end_time, '[)')
+  ) THEN
+    RAISE EXCEPTION 'Time slot is blocked in the doctor''s schedule'
+      USING ERRCODE = 'check_violation', CONSTRAINT = 'doctor_availability';
+  END IF;
+
+  -- Check if the time slot exists in doctor's availability
+  SELECT EXISTS (
+    SELECT 1 FROM availability
+    WHERE doctor_id = NEW.doctor_id
+      AND (is_recurring = true AND day_of_week=appt_dow)
+      AND (start_time, end_time) OVERLAPS (appt_start_time, appt_end_time)
+      AND NOT EXISTS (
+        SELECT 1 FROM public_holidays h JOIN doctors d ON d.doctor_id = NEW.doctor_id
+        WHERE h.holiday_date = appt_date AND d.observes_public_holidays
+      )
+  ) OR EXISTS (
+    SELECT 1 FROM availability_exceptions
+    WHERE doctor_id = NEW.doctor_id
+      AND kind = 'extra'
+      AND tstzrange(starts_at, ends_at, '[)') && tstzrange(NEW.start_time, NEW.end_time, '[)')
+  ) INTO slot_available;
+
+  IF NOT slot_available THEN
+    RAISE EXCEPTION 'Time slot is not within doctor''s availability'
+      USING ERRCODE = 'check_violation', CONSTRAINT = 'doctor_availability';
+  END IF;
+
+  RETURN NEW;
+END;
+$BODY$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION check_appointment_availability()
+RETURNS TRIGGER AS $BODY$
+DECLARE
+  slot_available boolean;
+  appt_start_time time;
+  appt_end_time time;
+  appt_dow integer;
+  appt_date date;
+  doctor_timezone text;
+  rules booking_rules%ROWTYPE;
+BEGIN
+  IF TG_OP = 'UPDATE'
+    AND NEW.doctor_id = OLD.doctor_id
+    AND NEW.start_time = OLD.start_time
+    AND NEW.end_time = OLD.end_time
+    AND (NEW.current_status <> 'scheduled' OR OLD.current_status = 'scheduled') THEN
+    RETURN NEW;
+  END IF;
+
+  -- the weekly windows are wall clock times in the doctor's timezone , the session's timezone doesn't matter
+  SELECT timezone INTO doctor_timezone FROM doctors WHERE doctor_id = NEW.doctor_id;
+  appt_start_time := (NEW.start_time AT TIME ZONE doctor_timezone)::time;
+  appt_end_time := (NEW.end_time AT TIME ZONE doctor_timezone)::time;
+  appt_date := (NEW.start_time AT TIME ZONE doctor_timezone)::date;
+  appt_dow := EXTRACT(DOW FROM appt_date);
+
+  -- the booking rules apply when the time is picked , not when an unpaid appointment is paid for later on ,
+  -- the row is locked so that two bookings that are each clear of the buffer can't be made next to each other at once
+  IF TG_OP = 'INSERT'
+    OR NEW.doctor_id <> OLD.doctor_id
+    OR NEW.start_time <> OLD.start_time
+    OR NEW.end_time <> OLD.end_time THEN
+    SELECT * INTO rules FROM booking_rules WHERE doctor_id = NEW.doctor_id FOR UPDATE;
+    IF FOUND THEN
+      IF NEW.start_time < now() + rules.min_notice_minutes * interval '1 minute' THEN
+        RAISE EXCEPTION 'The doctor needs more notice for this booking'
+          USING ERRCODE = 'check_violation', CONSTRAINT = 'doctor_booking_rules';
+      END IF;
+      IF rules.horizon_days > 0 AND NEW.start_time > now() + rules.horizon_days * interval '1 day' THEN
+        RAISE EXCEPTION 'The doctor doesn''t take bookings this far ahead'
+          USING ERRCODE = 'check_violation', CONSTRAINT = 'doctor_booking_rules';
+      END IF;
+      IF rules.buffer_minutes > 0 AND EXISTS (
+        SELECT 1 FROM appointments
+        WHERE doctor_id = NEW.doctor_id
+          AND appointment_id <> NEW.appointment_id
+          AND current_status IN ('pending_payment', 'scheduled', 'in_progress')
+          AND time_range && tstzrange(
+            NEW.start_time - rules.buffer_minutes * interval '1 minute',
+            NEW.end_time + rules.buffer_minutes * interval '1 minute',
+            '[)'
+          )
+      ) THEN
+        RAISE EXCEPTION 'The booking is too close to another of the doctor''s appointments'
+          USING ERRCODE = 'check_violation', CONSTRAINT = 'doctor_booking_rules';
+      END IF;
+    END IF;
+  END IF;
+
+  IF EXISTS (
+    SELECT 1 FROM availability_exceptions
+    WHERE doctor_id = NEW.doctor_id
+      AND kind = 'block'
+      AND tstzrange(starts_at, ends_at, '[)') && tstzrange(NEW.start_time, NEW.end_time, '[)')
+  ) THEN
+    RAISE EXCEPTION 'Time slot is blocked in the doctor''s schedule'
+      USING ERRCODE = 'check_violation', CONSTRAINT = 'doctor_availability';
+  END IF;
+
+  -- Check if the time slot exists in doctor's availability
+  SELECT EXISTS (
+    SELECT 1 FROM availability
+    WHERE doctor_id = NEW.doctor_id
+      AND (is_recurring = true AND day_of_week=appt_dow)
+      AND (start_time, end_time) OVERLAPS (appt_start_time, appt_end_time)
+      AND NOT EXISTS (
+        SELECT 1 FROM public_holidays h JOIN doctors d ON d.doctor_id = NEW.doctor_id
+        WHERE h.holiday_date = appt_date AND d.observes_public_holidays
+      )
+  ) OR EXISTS (
+    SELECT 1 FROM availability_exceptions
+    WHERE doctor_id = NEW.doctor_id
+      AND kind = 'extra'
+      AND tstzrange(starts_at, ends_at, '[)') && tstzrange(NEW.start_time, NEW.end_time, '[)')
+  ) INTO slot_available;
+
+  IF NOT slot_available THEN
+    RAISE EXCEPTION 'Time slot is not within doctor''s availability'
+      USING ERRCODE = 'check_violation', CONSTRAINT = 'doctor_availability';
+  END IF;
+
+  RETURN NEW;
+END;
+$BODY$ LANGUAGE plpgsql;
+-- +goose StatementEnd
@@ -0,0 +1,9 @@
+-- +goose Up
+-- wrong second factor codes count as failed logins , the challenge they were entered against is tracked as well
+-- so that it can be refused after a few wrong codes without waiting for the whole account to be locked
+ALTER TABLE login_attempts ADD COLUMN IF NOT EXISTS challenge_id UUID;
+ALTER TABLE login_attempts ADD COLUMN IF NOT EXISTS challenge_failures INT NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE login_attempts DROP COLUMN IF EXISTS challenge_failures;
+ALTER TABLE login_attempts DROP COLUMN IF EXISTS challenge_id;
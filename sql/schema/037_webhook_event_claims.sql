@@ -0,0 +1,7 @@
+-- +goose Up
+-- set while a delivery of the event is being processed so that a redelivery arriving at the same time is a no-op ,
+-- cleared if the processing fails and treated as abandoned once it is old enough
+ALTER TABLE webhook_events ADD COLUMN IF NOT EXISTS claimed_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE webhook_events DROP COLUMN IF EXISTS claimed_at;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- a payment that goes through after its appointment was cancelled (e.g. the hold expired first) is refunded
+-- without anyone asking for it , initiated_by is NULL for those refunds
+ALTER TABLE refunds ALTER COLUMN initiated_by DROP NOT NULL;
+
+-- +goose Down
+UPDATE refunds r SET initiated_by = pt.user_id
+FROM appointments a JOIN patients pt ON pt.patient_id = a.patient_id
+WHERE a.appointment_id = r.appointment_id AND r.initiated_by IS NULL;
+ALTER TABLE refunds ALTER COLUMN initiated_by SET NOT NULL;